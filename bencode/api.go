@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"reflect"
+	"strings"
 
 	"github.com/anacrolix/missinggo/expect"
 )
@@ -49,6 +50,65 @@ func (e *UnmarshalTypeError) Error() string {
 	return fmt.Sprintf("cannot unmarshal a bencode %s into a %s", e.Value, e.Type)
 }
 
+// A value that couldn't be decoded into the Go value for it, and where it is. Type errors and errors
+// from Unmarshalers are returned as these, wrapping an UnmarshalTypeError or UnmarshalerError.
+// Unmarshalers can return a *DecodeError themselves, from decoding the bytes they're given, and it's
+// made relative to the data the Unmarshaler's value is in. Malformed data is a SyntaxError instead.
+type DecodeError struct {
+	// The offset of the value in the data.
+	Offset int64
+	// The keys and list indexes leading to the value, like "info.files[3].path[0]". It's empty for
+	// the top-level value.
+	Path string
+	// The Go type being decoded into.
+	Type reflect.Type
+	// The kind of bencode value found: "integer", "string", "list" or "dict".
+	Kind string
+	Err  error
+}
+
+func (e *DecodeError) Error() string {
+	path := e.Path
+	if path == "" {
+		path = "top level"
+	}
+	if ute, ok := e.Err.(*UnmarshalTypeError); ok {
+		expected := expectedKind(e.Type)
+		if expected == e.Kind {
+			expected = e.Type.String()
+		}
+		return fmt.Sprintf("wrong type at %s: expected %s, got %s at offset %d", path, expected, ute.Value, e.Offset)
+	}
+	return fmt.Sprintf("decoding %s at offset %d: %v", path, e.Offset, e.Err)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// The kind of bencode value that decodes into t.
+func expectedKind(t reflect.Type) string {
+	if textAllowed(t) && reflect.PtrTo(t).Implements(textUnmarshalerType) {
+		return "string"
+	}
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Uint,
+		reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Bool:
+		return "integer"
+	case reflect.String:
+		return "string"
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return "string"
+		}
+		return "list"
+	case reflect.Map, reflect.Struct:
+		return "dict"
+	default:
+		return t.String()
+	}
+}
+
 // Unmarshaler tried to write to an unexported (therefore unwritable) field.
 type UnmarshalFieldError struct {
 	Key   string
@@ -61,6 +121,32 @@ func (e *UnmarshalFieldError) Error() string {
 		e.Field.Name + "\" in type: " + e.Type.String()
 }
 
+// Returned when decoding structs from dicts that didn't have the keys of fields with the "required"
+// tag option. All the missing keys are found before this is returned, and the value is otherwise
+// decoded.
+type MissingKeysError struct {
+	// The paths of the missing keys, as for DecodeError.Path.
+	Keys []string
+}
+
+func (e *MissingKeysError) Error() string {
+	return "bencode: missing required keys: " + strings.Join(e.Keys, ", ")
+}
+
+// Returned by Decoders with DisallowUnknownFields for a dict key that isn't a field of the struct
+// being decoded into.
+type UnknownKeyError struct {
+	// The path of the key, as for DecodeError.Path.
+	Path string
+	// The offset of the key in the data.
+	Offset int64
+	Type   reflect.Type
+}
+
+func (e *UnknownKeyError) Error() string {
+	return fmt.Sprintf("bencode: unknown key at %s for type %v at offset %d", e.Path, e.Type, e.Offset)
+}
+
 // Malformed bencode input, unmarshaler failed to parse it.
 type SyntaxError struct {
 	Offset int64 // location of the error
@@ -71,6 +157,10 @@ func (e *SyntaxError) Error() string {
 	return fmt.Sprintf("bencode: syntax error (offset: %d): %s", e.Offset, e.What)
 }
 
+func (e *SyntaxError) Unwrap() error {
+	return e.What
+}
+
 // A non-nil error was returned after calling MarshalBencode on a type which
 // implements the Marshaler interface.
 type MarshalerError struct {
@@ -112,13 +202,28 @@ type Unmarshaler interface {
 // Marshal the value 'v' to the bencode form, return the result as []byte and
 // an error if any.
 func Marshal(v interface{}) ([]byte, error) {
-	var buf bytes.Buffer
-	e := Encoder{w: &buf}
-	err := e.Encode(v)
+	s := getMarshalState()
+	defer putMarshalState(s)
+	s.w.b = s.buf[:0]
+	err := s.e.Encode(v)
+	s.buf = s.w.b
 	if err != nil {
 		return nil, err
 	}
-	return buf.Bytes(), nil
+	return append([]byte(nil), s.buf...), nil
+}
+
+// Appends the encoding of v to dst, like Marshal. Encoding into a reused dst avoids allocating the
+// result.
+func MarshalAppend(dst []byte, v interface{}) ([]byte, error) {
+	s := getMarshalState()
+	defer putMarshalState(s)
+	s.w.b = dst
+	err := s.e.Encode(v)
+	if err != nil {
+		return dst, err
+	}
+	return s.w.b, nil
 }
 
 func MustMarshal(v interface{}) []byte {
@@ -130,8 +235,27 @@ func MustMarshal(v interface{}) []byte {
 // Unmarshal the bencode value in the 'data' to a value pointed by the 'v'
 // pointer, return a non-nil error if any.
 func Unmarshal(data []byte, v interface{}) (err error) {
+	return unmarshal(data, v, func(*Decoder) {})
+}
+
+// Like Unmarshal, with the limits set by Decoder.SetNetworkLimits, for data from peers and
+// trackers.
+func UnmarshalNetwork(data []byte, v interface{}) error {
+	return unmarshal(data, v, (*Decoder).SetNetworkLimits)
+}
+
+// Like Unmarshal, decoding strictly as for Decoder.Strict.
+func UnmarshalStrict(data []byte, v interface{}) error {
+	return unmarshal(data, v, func(d *Decoder) {
+		d.Strict = true
+	})
+}
+
+func unmarshal(data []byte, v interface{}, setup func(*Decoder)) (err error) {
 	buf := bytes.NewBuffer(data)
-	e := Decoder{r: buf}
+	// No string can be longer than the data holding it, so don't allocate for one.
+	e := Decoder{r: buf, MaxStrLen: int64(len(data)), data: data}
+	setup(&e)
 	err = e.Decode(v)
 	if err == nil && buf.Len() != 0 {
 		err = ErrUnusedTrailingBytes{buf.Len()}
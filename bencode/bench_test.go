@@ -9,6 +9,8 @@ import (
 	"github.com/bradfitz/iter"
 
 	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
+	pp "github.com/anacrolix/torrent/peer_protocol"
 )
 
 func marshalAndUnmarshal(tb testing.TB, orig krpc.Msg) (ret krpc.Msg) {
@@ -44,3 +46,37 @@ func BenchmarkMarshalThenUnmarshalKrpcMsg(tb *testing.B) {
 		marshalAndUnmarshal(tb, orig)
 	}
 }
+
+func benchmarkMarshalValues(b *testing.B) []interface{} {
+	mi, err := metainfo.LoadFromFile("testdata/continuum.torrent")
+	if err != nil {
+		b.Fatal(err)
+	}
+	return []interface{}{
+		mi,
+		pp.ExtendedHandshakeMessage{
+			M: map[pp.ExtensionName]pp.ExtensionNumber{
+				pp.ExtensionNameMetadata: 1,
+				pp.ExtensionNamePex:      2,
+			},
+			V:            "go.torrent dev 20201011",
+			Reqq:         250,
+			MetadataSize: 12345,
+			Port:         6881,
+			YourIp:       pp.CompactIp(net.ParseIP("1.2.3.4")),
+		},
+	}
+}
+
+func BenchmarkMarshal(b *testing.B) {
+	vs := benchmarkMarshalValues(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, v := range vs {
+			if _, err := bencode.Marshal(v); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
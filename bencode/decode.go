@@ -7,9 +7,10 @@ import (
 	"io"
 	"math/big"
 	"reflect"
-	"runtime"
 	"strconv"
+	"strings"
 	"sync"
+	"unicode/utf8"
 )
 
 type Decoder struct {
@@ -19,30 +20,91 @@ type Decoder struct {
 	}
 	// Sum of bytes used to Decode values.
 	Offset int64
-	buf    bytes.Buffer
+	// If positive, lists and dicts nested deeper than this are a syntax error. If zero,
+	// DefaultMaxDepth applies to lists and dicts decoded into Go types that nest, as those are
+	// decoded recursively. Empty interfaces, RawMessages, Unmarshalers, and the token API don't
+	// recurse, and have no default limit. Negative means no limit.
+	MaxDepth int
+	// If positive, strings longer than this are a syntax error, before anything is allocated for
+	// them.
+	MaxStrLen int64
+	// If positive, lists with more elements than this, and dicts with more entries, are a syntax
+	// error.
+	MaxCollectionItems int
+	// Reject data that doesn't decode strictly: integers that aren't plain decimal, dict keys that
+	// aren't strings, data that isn't canonical (see ErrNotCanonical), and data after the value.
+	// A strict Decoder can only decode one value, and Decode reads all the data to check there's
+	// nothing more. It's reported as ErrUnusedTrailingBytes.
+	Strict bool
+	// If set, integers that don't fit in the integer they're decoded into set it to its minimum or
+	// maximum instead, and OnClamp is called with the error there would have been. Decode into a
+	// big.Int for the exact value.
+	OnClamp func(warning *DecodeError)
+	// Strings decoded into an empty interface that aren't valid UTF-8 are []byte instead of
+	// string, so they can be told apart from text. Dict keys are always strings.
+	NonUTF8AsBytes bool
+	// Which value is decoded for a key that's duplicated in a dict. Within RawMessages, Bytes, and
+	// the data passed to Unmarshalers, all entries are kept.
+	DuplicateKeys DuplicateKeyPolicy
+	// If set, it's called for each duplicate dict key, including those within RawMessages and the
+	// like, with a DecodeError wrapping ErrDuplicateKey. Its path is to the key's value, and its Type
+	// is the Go type of the dict, if it's decoded into one.
+	OnDuplicateKey func(warning *DecodeError)
+	buf            bytes.Buffer
+	depth          int
+	// The data being decoded, if it's all in memory, from the start of the data read, for
+	// RawMessages to refer to.
+	data []byte
+	// The lists and dicts opened by NextToken.
+	tokenFrames []tokenFrame
+	// Reused by readOneValue.
+	valueFrames []valueFrame
+	// The keys of the dicts being decoded, for dupKeys.
+	dictKeys []string
+	// The keys and indexes leading to the value being decoded, for errors.
+	path []pathElem
+	// The paths of the required keys that were missing, for a MissingKeysError.
+	missing               []string
+	disallowUnknownFields bool
 }
 
+// Dict keys that aren't struct fields are an UnknownKeyError, instead of being ignored.
+func (d *Decoder) DisallowUnknownFields() {
+	d.disallowUnknownFields = true
+}
+
+// A dict key or list index leading to a value.
+type pathElem struct {
+	key string
+	// The list index, or -1 for a dict key.
+	index int
+}
+
+// Decodes the next value into v, which must be a non-nil pointer. Values decoded into an empty
+// interface have the same types every time: string for strings, int64 for integers, or *big.Int for
+// those that don't fit, []interface{} for lists, and map[string]interface{} for dicts. See
+// NonUTF8AsBytes.
 func (d *Decoder) Decode(v interface{}) (err error) {
-	defer func() {
-		if err != nil {
-			return
-		}
-		r := recover()
-		_, ok := r.(runtime.Error)
-		if ok {
-			panic(r)
-		}
-		err, ok = r.(error)
-		if !ok && r != nil {
-			panic(r)
-		}
-	}()
+	defer recoverError(&err)
 
 	pv := reflect.ValueOf(v)
 	if pv.Kind() != reflect.Ptr || pv.IsNil() {
 		return &UnmarshalInvalidArgError{reflect.TypeOf(v)}
 	}
 
+	// A Token's bytes may be left from NextToken.
+	d.buf.Reset()
+	d.path = d.path[:0]
+	d.missing = nil
+	if len(d.tokenFrames) != 0 {
+		// The value is in a list or dict opened by NextToken.
+		b := d.peekByte()
+		if b == 'e' {
+			d.throwSyntaxError(d.Offset, errors.New("unexpected 'e'"))
+		}
+		d.beginTokenValue(b, d.Offset)
+	}
+
 	ok, err := d.parseValue(pv.Elem())
 	if err != nil {
 		return
@@ -50,6 +112,12 @@ func (d *Decoder) Decode(v interface{}) (err error) {
 	if !ok {
 		d.throwSyntaxError(d.Offset-1, errors.New("unexpected 'e'"))
 	}
+	if d.Strict && len(d.tokenFrames) == 0 {
+		err = d.checkNoTrailingBytes()
+	}
+	if err == nil && d.missing != nil {
+		err = &MissingKeysError{d.missing}
+	}
 	return
 }
 
@@ -73,6 +141,14 @@ func (d *Decoder) readByte() byte {
 	return b
 }
 
+// Returns the next byte without consuming it.
+func (d *Decoder) peekByte() byte {
+	b := d.readByte()
+	d.r.UnreadByte()
+	d.Offset--
+	return b
+}
+
 // reads data writing it to 'd.buf' until 'sep' byte is encountered, 'sep' byte
 // is consumed, but not included into the 'd.buf'
 func (d *Decoder) readUntil(sep byte) {
@@ -85,6 +161,48 @@ func (d *Decoder) readUntil(sep byte) {
 	}
 }
 
+// The depth limit for Decoders that don't set one, when decoding into Go types that nest, like
+// recursive struct types. It's far deeper than any real data, but that decoding recurses, and
+// running out of stack can't be recovered from.
+const DefaultMaxDepth = 1 << 16
+
+// Called on entering a list or dict. The caller must call leave when it's done.
+func (d *Decoder) enter() {
+	d.depth++
+	if d.MaxDepth > 0 && d.depth > d.MaxDepth {
+		d.throwDepthExceeded(d.MaxDepth)
+	}
+}
+
+// Like enter, for lists and dicts that are decoded by recursing, where DefaultMaxDepth applies.
+func (d *Decoder) enterRecursive() {
+	d.enter()
+	if d.MaxDepth == 0 && d.depth > DefaultMaxDepth {
+		d.throwDepthExceeded(DefaultMaxDepth)
+	}
+}
+
+func (d *Decoder) throwDepthExceeded(maxDepth int) {
+	d.throwSyntaxError(d.Offset-1, ErrLimitExceeded{LimitDepth, int64(maxDepth), int64(d.depth)})
+}
+
+func (d *Decoder) leave() {
+	d.depth--
+}
+
+func (d *Decoder) checkStrLen(length int64, offset int64) {
+	if d.MaxStrLen > 0 && length > d.MaxStrLen {
+		d.throwSyntaxError(offset, ErrLimitExceeded{LimitStrLen, d.MaxStrLen, length})
+	}
+}
+
+// Called with the number of items read so far in a list, or entries in a dict.
+func (d *Decoder) checkCollectionItems(n int) {
+	if d.MaxCollectionItems > 0 && n > d.MaxCollectionItems {
+		d.throwSyntaxError(d.Offset-1, ErrLimitExceeded{LimitCollectionItems, int64(d.MaxCollectionItems), int64(n)})
+	}
+}
+
 func checkForIntParseError(err error, offset int64) {
 	if err != nil {
 		panic(&SyntaxError{
@@ -101,6 +219,55 @@ func (d *Decoder) throwSyntaxError(offset int64, err error) {
 	})
 }
 
+// Returns a DecodeError for the value of the given kind at offset, which couldn't be decoded into a
+// t.
+func (d *Decoder) decodeError(offset int64, t reflect.Type, kind string, err error) *DecodeError {
+	return &DecodeError{
+		Offset: offset,
+		Path:   d.pathString(),
+		Type:   t,
+		Kind:   kind,
+		Err:    err,
+	}
+}
+
+func (d *Decoder) pathString() string {
+	var sb strings.Builder
+	for _, e := range d.path {
+		if e.index >= 0 {
+			fmt.Fprintf(&sb, "[%d]", e.index)
+			continue
+		}
+		if sb.Len() != 0 {
+			sb.WriteByte('.')
+		}
+		sb.WriteString(e.key)
+	}
+	return sb.String()
+}
+
+// Appends the path inner, within a value, to the value's path outer.
+func joinPath(outer, inner string) string {
+	if outer == "" || inner == "" || inner[0] == '[' {
+		return outer + inner
+	}
+	return outer + "." + inner
+}
+
+// The kind of bencode value starting with b.
+func valueKind(b byte) string {
+	switch b {
+	case 'i':
+		return "integer"
+	case 'l':
+		return "list"
+	case 'd':
+		return "dict"
+	default:
+		return "string"
+	}
+}
+
 // called when 'i' was consumed
 func (d *Decoder) parseInt(v reflect.Value) {
 	start := d.Offset - 1
@@ -111,98 +278,155 @@ func (d *Decoder) parseInt(v reflect.Value) {
 			What:   errors.New("empty integer value"),
 		})
 	}
+	d.checkStrictInt(d.buf.Bytes(), start)
 
 	s := bytesAsString(d.buf.Bytes())
 
+	if v.Type() == bigIntType {
+		if _, ok := v.Addr().Interface().(*big.Int).SetString(s, 10); !ok {
+			d.throwSyntaxError(start, errors.New("failed to parse integer"))
+		}
+		d.buf.Reset()
+		return
+	}
+
 	switch v.Kind() {
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
 		n, err := strconv.ParseInt(s, 10, 64)
-		checkForIntParseError(err, start)
-
-		if v.OverflowInt(n) {
-			panic(&UnmarshalTypeError{
-				Value: "integer " + s,
-				Type:  v.Type(),
-			})
+		if isRangeError(err) || err == nil && v.OverflowInt(n) {
+			d.intOverflow(v, s, start)
+			break
 		}
+		checkForIntParseError(err, start)
 		v.SetInt(n)
 	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
 		n, err := strconv.ParseUint(s, 10, 64)
-		checkForIntParseError(err, start)
-
-		if v.OverflowUint(n) {
-			panic(&UnmarshalTypeError{
-				Value: "integer " + s,
-				Type:  v.Type(),
-			})
+		// Negative integers are out of range, other than "-0", which doesn't parse.
+		negative := s[0] == '-' && validInteger(d.buf.Bytes()) && s != "-0"
+		if isRangeError(err) || negative || err == nil && v.OverflowUint(n) {
+			d.intOverflow(v, s, start)
+			break
 		}
+		checkForIntParseError(err, start)
 		v.SetUint(n)
 	case reflect.Bool:
 		v.SetBool(s != "0")
 	case reflect.String:
 		v.SetString(s)
 	default:
-		panic(&UnmarshalTypeError{
+		panic(d.decodeError(start, v.Type(), "integer", &UnmarshalTypeError{
 			Value: "integer " + s,
 			Type:  v.Type(),
-		})
+		}))
 	}
 	d.buf.Reset()
 }
 
+func isRangeError(err error) bool {
+	ne, ok := err.(*strconv.NumError)
+	return ok && ne.Err == strconv.ErrRange
+}
+
+// Called when the integer s at offset doesn't fit in the integer v. It's a type error, unless
+// OnClamp is set.
+func (d *Decoder) intOverflow(v reflect.Value, s string, offset int64) {
+	err := d.decodeError(offset, v.Type(), "integer", &UnmarshalTypeError{
+		Value: "integer " + s,
+		Type:  v.Type(),
+	})
+	if d.OnClamp == nil {
+		panic(err)
+	}
+	bits := uint(v.Type().Bits())
+	negative := s[0] == '-'
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		min := int64(-1) << (bits - 1)
+		if negative {
+			v.SetInt(min)
+		} else {
+			v.SetInt(^min)
+		}
+	default:
+		if negative {
+			v.SetUint(0)
+		} else {
+			v.SetUint(^uint64(0) >> (64 - bits))
+		}
+	}
+	d.OnClamp(err)
+}
+
 func (d *Decoder) parseString(v reflect.Value) error {
 	start := d.Offset - 1
 
 	// read the string length first
 	d.readUntil(':')
+	d.checkStrictStrLen(d.buf.Bytes(), start)
 	length, err := strconv.ParseInt(bytesAsString(d.buf.Bytes()), 10, 0)
 	checkForIntParseError(err, start)
+	d.checkStrLen(length, start)
 
-	defer d.buf.Reset()
-
-	read := func(b []byte) {
-		n, err := io.ReadFull(d.r, b)
-		d.Offset += int64(n)
-		if err != nil {
-			checkForUnexpectedEOF(err, d.Offset)
-			panic(&SyntaxError{
-				Offset: d.Offset,
-				What:   errors.New("unexpected I/O error: " + err.Error()),
-			})
-		}
-	}
+	d.buf.Reset()
 
 	switch v.Kind() {
 	case reflect.String:
-		b := make([]byte, length)
-		read(b)
-		v.SetString(bytesAsString(b))
+		v.SetString(bytesAsString(d.readString(length)))
 		return nil
 	case reflect.Slice:
 		if v.Type().Elem().Kind() != reflect.Uint8 {
 			break
 		}
-		b := make([]byte, length)
-		read(b)
-		v.SetBytes(b)
+		v.SetBytes(d.readString(length))
 		return nil
 	case reflect.Array:
 		if v.Type().Elem().Kind() != reflect.Uint8 {
 			break
 		}
-		d.buf.Grow(int(length))
-		b := d.buf.Bytes()[:length]
-		read(b)
-		reflect.Copy(v, reflect.ValueOf(b))
+		reflect.Copy(v, reflect.ValueOf(d.readString(length)))
 		return nil
 	}
-	d.buf.Grow(int(length))
-	read(d.buf.Bytes()[:length])
+	d.readString(length)
 	// I believe we return here to support "ignore_unmarshal_type_error".
-	return &UnmarshalTypeError{
+	return d.decodeError(start, v.Type(), "string", &UnmarshalTypeError{
 		Value: "string",
 		Type:  v.Type(),
+	})
+}
+
+// Strings longer than this are read in chunks, rather than into a buffer of the full length.
+const maxStringPrealloc = 1 << 16
+
+// Returns the next length bytes. A length that runs past the end of the input is an error once the
+// input ends, without the full length having been allocated.
+func (d *Decoder) readString(length int64) []byte {
+	var (
+		b   []byte
+		n   int64
+		err error
+	)
+	if length <= maxStringPrealloc {
+		b = make([]byte, length)
+		var n1 int
+		n1, err = io.ReadFull(d.r, b)
+		n = int64(n1)
+	} else {
+		var buf bytes.Buffer
+		n, err = io.CopyN(&buf, d.r, length)
+		b = buf.Bytes()
+	}
+	d.Offset += n
+	if err != nil {
+		if err == io.ErrUnexpectedEOF {
+			err = io.EOF
+		}
+		checkForUnexpectedEOF(err, d.Offset)
+		panic(&SyntaxError{
+			Offset: d.Offset,
+			What:   errors.New("unexpected I/O error: " + err.Error()),
+		})
 	}
+	return b
 }
 
 // Info for parsing a dict value.
@@ -265,6 +489,8 @@ type structField struct {
 var (
 	structFieldsMu sync.Mutex
 	structFields   = map[reflect.Type]map[string]structField{}
+	// The keys of the required fields of each struct in structFields.
+	structRequiredKeys = map[reflect.Type][]string{}
 )
 
 func parseStructFields(struct_ reflect.Type, each func(string, structField)) {
@@ -288,10 +514,24 @@ func parseStructFields(struct_ reflect.Type, each func(string, structField)) {
 
 func saveStructFields(struct_ reflect.Type) {
 	m := make(map[string]structField)
+	var required []string
 	parseStructFields(struct_, func(key string, sf structField) {
 		m[key] = sf
+		if sf.tag.Required() {
+			required = append(required, key)
+		}
 	})
 	structFields[struct_] = m
+	structRequiredKeys[struct_] = required
+}
+
+func getRequiredKeys(struct_ reflect.Type) []string {
+	structFieldsMu.Lock()
+	defer structFieldsMu.Unlock()
+	if _, ok := structFields[struct_]; !ok {
+		saveStructFields(struct_)
+	}
+	return structRequiredKeys[struct_]
 }
 
 func getStructFieldForKey(struct_ reflect.Type, key string) (f structField, ok bool) {
@@ -307,38 +547,82 @@ func getStructFieldForKey(struct_ reflect.Type, key string) (f structField, ok b
 func (d *Decoder) parseDict(v reflect.Value) error {
 	// so, at this point 'd' byte was consumed, let's just read key/value
 	// pairs one by one
-	for {
+	var keys keyOrder
+	var required []string
+	var found []bool
+	if v.Kind() == reflect.Struct {
+		required = getRequiredKeys(v.Type())
+		found = make([]bool, len(required))
+	}
+	trackDups := d.trackingDuplicateKeys()
+	dups := d.beginDupKeys()
+	defer d.endDupKeys(&dups)
+	for n := 1; ; n++ {
+		keyOffset := d.Offset
+		if d.Strict {
+			d.checkStrictKeyStart(d.peekByte(), keyOffset)
+		}
 		var keyStr string
 		keyValue := reflect.ValueOf(&keyStr).Elem()
 		ok, err := d.parseValue(keyValue)
 		if err != nil {
-			return fmt.Errorf("error parsing dict key: %s", err)
+			return err
 		}
 		if !ok {
+			for i, key := range required {
+				if !found[i] {
+					d.missing = append(d.missing, joinPath(d.pathString(), key))
+				}
+			}
 			return nil
 		}
+		d.checkKeyOrder(&keys, []byte(keyStr), keyOffset)
+		d.checkCollectionItems(n)
+		for i, key := range required {
+			if key == keyStr {
+				found[i] = true
+			}
+		}
 
 		df := getDictField(v, keyStr)
+		if !df.Ok && d.disallowUnknownFields && v.Kind() == reflect.Struct {
+			panic(&UnknownKeyError{
+				Path:   joinPath(d.pathString(), keyStr),
+				Offset: keyOffset,
+				Type:   v.Type(),
+			})
+		}
+		if trackDups && d.isDuplicateKey(&dups, keyStr) {
+			d.duplicateKey(keyOffset, joinPath(d.pathString(), keyStr), v.Type())
+			if d.DuplicateKeys == FirstDuplicateKeyWins {
+				// Discard the value, as for unknown keys.
+				df.Ok = false
+			}
+		}
 
 		// now we need to actually parse it
+		valueStart := d.Offset
+		d.path = append(d.path, pathElem{key: keyStr, index: -1})
 		if df.Ok {
 			// log.Printf("parsing ok struct field for key %q", keyStr)
 			ok, err = d.parseValue(df.Value)
 		} else {
 			// Discard the value, there's nowhere to put it.
-			var if_ interface{}
-			if_, ok = d.parseValueInterface()
-			if if_ == nil {
-				err = fmt.Errorf("error parsing value for key %q", keyStr)
-			}
+			_, ok = d.parseValueInterface()
 		}
+		d.path = d.path[:len(d.path)-1]
 		if err != nil {
-			if _, ok := err.(*UnmarshalTypeError); !ok || !df.IgnoreUnmarshalTypeError {
-				return fmt.Errorf("parsing value for key %q: %s", keyStr, err)
+			// Only type errors for the value itself are ignored, not those for values within it.
+			de, _ := err.(*DecodeError)
+			if de == nil || de.Offset != valueStart || !df.IgnoreUnmarshalTypeError {
+				return err
+			}
+			if _, ok := de.Err.(*UnmarshalTypeError); !ok {
+				return err
 			}
 		}
 		if !ok {
-			return fmt.Errorf("missing value for key %q", keyStr)
+			d.throwSyntaxError(d.Offset-1, fmt.Errorf("missing value for key %q", keyStr))
 		}
 		if df.Ok {
 			df.Set()
@@ -346,20 +630,21 @@ func (d *Decoder) parseDict(v reflect.Value) error {
 	}
 }
 
-func (d *Decoder) parseList(v reflect.Value) error {
+// start is the offset of the list.
+func (d *Decoder) parseList(v reflect.Value, start int64) error {
 	switch v.Kind() {
 	default:
 		// If the list is a singleton of the expected type, use that value. See
 		// https://github.com/anacrolix/torrent/issues/297.
 		l := reflect.New(reflect.SliceOf(v.Type()))
-		if err := d.parseList(l.Elem()); err != nil {
+		if err := d.parseList(l.Elem(), start); err != nil {
 			return err
 		}
 		if l.Elem().Len() != 1 {
-			return &UnmarshalTypeError{
+			return d.decodeError(start, v.Type(), "list", &UnmarshalTypeError{
 				Value: "list",
 				Type:  v.Type(),
-			}
+			})
 		}
 		v.Set(l.Elem().Index(0))
 		return nil
@@ -374,7 +659,9 @@ func (d *Decoder) parseList(v reflect.Value) error {
 		}
 
 		if i < v.Len() {
+			d.path = append(d.path, pathElem{index: i})
 			ok, err := d.parseValue(v.Index(i))
+			d.path = d.path[:len(d.path)-1]
 			if err != nil {
 				return err
 			}
@@ -387,6 +674,7 @@ func (d *Decoder) parseList(v reflect.Value) error {
 				break
 			}
 		}
+		d.checkCollectionItems(i + 1)
 	}
 
 	if i < v.Len() {
@@ -406,36 +694,84 @@ func (d *Decoder) parseList(v reflect.Value) error {
 	return nil
 }
 
-func (d *Decoder) readOneValue() bool {
-	b, err := d.r.ReadByte()
-	if err != nil {
-		panic(err)
-	}
-	if b == 'e' {
-		d.r.UnreadByte()
-		return false
-	} else {
-		d.Offset++
-		d.buf.WriteByte(b)
+// A list or dict being read by readOneValue.
+type valueFrame struct {
+	dict bool
+	// Items read so far. For dicts, keys and values are both items.
+	n int
+	// Where the list or dict starts, in d.buf and in the data.
+	bufStart int
+	offset   int64
+	keys     keyOrder
+	// For dicts, the last key, and the keys so far, if duplicates are being reported.
+	key  string
+	dups dupKeys
+}
+
+// The path to the value being read by readOneValue, with the frames of the lists and dicts it's in.
+func (d *Decoder) valuePath(stack []valueFrame) string {
+	n := len(d.path)
+	for _, f := range stack {
+		if f.dict {
+			d.path = append(d.path, pathElem{key: f.key, index: -1})
+		} else {
+			d.path = append(d.path, pathElem{index: f.n})
+		}
 	}
+	s := d.pathString()
+	d.path = d.path[:n]
+	return s
+}
 
-	switch b {
-	case 'd', 'l':
-		// read until there is nothing to read
-		for d.readOneValue() {
+// Reads the next value into d.buf. It returns false if there's the end of a list or dict instead,
+// which isn't consumed. It doesn't recurse, so deep nesting costs only the memory for its stack.
+func (d *Decoder) readOneValue() bool {
+	stack, depth, dictKeys := d.valueFrames[:0], d.depth, len(d.dictKeys)
+	defer func() {
+		d.valueFrames, d.depth, d.dictKeys = stack[:0], depth, d.dictKeys[:dictKeys]
+	}()
+	reportDups := d.OnDuplicateKey != nil && !d.Strict
+	for {
+		itemStart, itemOffset := d.buf.Len(), d.Offset
+		b, err := d.r.ReadByte()
+		if err != nil {
+			panic(err)
 		}
-		// consume 'e' as well
-		b = d.readByte()
+		if b == 'e' && len(stack) == 0 {
+			d.r.UnreadByte()
+			return false
+		}
+		d.Offset++
 		d.buf.WriteByte(b)
-	case 'i':
-		d.readUntil('e')
-		d.buf.WriteString("e")
-	default:
-		if b >= '0' && b <= '9' {
+
+		switch {
+		case b == 'e':
+			top := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			d.leave()
+			d.endDupKeys(&top.dups)
+			itemStart, itemOffset = top.bufStart, top.offset
+		case b == 'd' || b == 'l':
+			d.enter()
+			stack = append(stack, valueFrame{
+				dict:     b == 'd',
+				bufStart: itemStart,
+				offset:   itemOffset,
+				dups:     d.beginDupKeys(),
+			})
+			continue
+		case b == 'i':
+			start := d.buf.Len()
+			d.readUntil('e')
+			d.checkStrictInt(d.buf.Bytes()[start:], itemOffset)
+			d.buf.WriteString("e")
+		case b >= '0' && b <= '9':
 			start := d.buf.Len() - 1
 			d.readUntil(':')
+			d.checkStrictStrLen(d.buf.Bytes()[start:], itemOffset)
 			length, err := strconv.ParseInt(bytesAsString(d.buf.Bytes()[start:]), 10, 64)
 			checkForIntParseError(err, d.Offset-1)
+			d.checkStrLen(length, d.Offset-1)
 
 			d.buf.WriteString(":")
 			n, err := io.CopyN(&d.buf, d.r, length)
@@ -447,14 +783,35 @@ func (d *Decoder) readOneValue() bool {
 					What:   errors.New("unexpected I/O error: " + err.Error()),
 				})
 			}
-			break
+		default:
+			d.raiseUnknownValueType(b, d.Offset-1)
 		}
 
-		d.raiseUnknownValueType(b, d.Offset-1)
+		// A value is complete.
+		if len(stack) == 0 {
+			return true
+		}
+		top := &stack[len(stack)-1]
+		top.n++
+		if top.dict {
+			// Keys and values are values.
+			d.checkCollectionItems((top.n + 1) / 2)
+			if top.n%2 == 1 && d.Strict {
+				key := d.buf.Bytes()[itemStart:]
+				d.checkStrictKeyStart(key[0], itemOffset)
+				d.checkKeyOrder(&top.keys, key[bytes.IndexByte(key, ':')+1:], itemOffset)
+			}
+			if top.n%2 == 1 && reportDups {
+				key := d.buf.Bytes()[itemStart:]
+				top.key = string(key[bytes.IndexByte(key, ':')+1:])
+				if d.isDuplicateKey(&top.dups, top.key) {
+					d.duplicateKey(itemOffset, d.valuePath(stack), nil)
+				}
+			}
+		} else {
+			d.checkCollectionItems(top.n)
+		}
 	}
-
-	return true
-
 }
 
 func (d *Decoder) parseUnmarshaler(v reflect.Value) bool {
@@ -466,13 +823,28 @@ func (d *Decoder) parseUnmarshaler(v reflect.Value) bool {
 		}
 	}
 	d.buf.Reset()
+	start := d.Offset
 	if !d.readOneValue() {
 		return false
 	}
 	m := v.Interface().(Unmarshaler)
 	err := m.UnmarshalBencode(d.buf.Bytes())
+	if mke, ok := err.(*MissingKeysError); ok {
+		// The value was decoded, but is missing keys.
+		for _, key := range mke.Keys {
+			d.missing = append(d.missing, joinPath(d.pathString(), key))
+		}
+		return true
+	}
+	if de, ok := err.(*DecodeError); ok {
+		// The error's from decoding the value's bytes. Make it relative to the data instead.
+		rebased := *de
+		rebased.Offset += start
+		rebased.Path = joinPath(d.pathString(), de.Path)
+		panic(&rebased)
+	}
 	if err != nil {
-		panic(&UnmarshalerError{v.Type(), err})
+		panic(d.decodeError(start, v.Type(), valueKind(d.buf.Bytes()[0]), &UnmarshalerError{v.Type(), err}))
 	}
 	return true
 }
@@ -490,8 +862,14 @@ func (d *Decoder) parseValue(v reflect.Value) (bool, error) {
 		v = v.Elem()
 	}
 
-	if d.parseUnmarshaler(v) {
+	if v.Type() == rawMessageType {
+		if d.parseRawMessage(v) {
+			return true, nil
+		}
+	} else if d.parseUnmarshaler(v) {
 		return true, nil
+	} else if ok, err := d.parseTextUnmarshaler(v); ok {
+		return true, err
 	}
 
 	// common case: interface{}
@@ -511,9 +889,13 @@ func (d *Decoder) parseValue(v reflect.Value) (bool, error) {
 	case 'e':
 		return false, nil
 	case 'd':
+		d.enterRecursive()
+		defer d.leave()
 		return true, d.parseDict(v)
 	case 'l':
-		return true, d.parseList(v)
+		d.enterRecursive()
+		defer d.leave()
+		return true, d.parseList(v, d.Offset-1)
 	case 'i':
 		d.parseInt(v)
 		return true, nil
@@ -539,32 +921,125 @@ func (d *Decoder) raiseUnknownValueType(b byte, offset int64) {
 	})
 }
 
-func (d *Decoder) parseValueInterface() (interface{}, bool) {
-	b, err := d.r.ReadByte()
-	if err != nil {
-		panic(err)
+// A list or dict being decoded by parseValueInterface.
+type interfaceFrame struct {
+	// Nil for lists.
+	dict map[string]interface{}
+	list []interface{}
+	// For dicts, the key of the value that's next, if there is one.
+	key     string
+	haveKey bool
+	// Whether the value for key is skipped, as a duplicate.
+	skip bool
+	// Entries decoded, counting duplicate keys.
+	n    int
+	keys keyOrder
+}
+
+// The path to the value being decoded by parseValueInterface, with the frames of the lists and
+// dicts it's in.
+func (d *Decoder) interfacePath(stack []interfaceFrame) string {
+	n := len(d.path)
+	for _, f := range stack {
+		if f.dict != nil {
+			d.path = append(d.path, pathElem{key: f.key, index: -1})
+		} else {
+			d.path = append(d.path, pathElem{index: len(f.list)})
+		}
 	}
-	d.Offset++
+	s := d.pathString()
+	d.path = d.path[:n]
+	return s
+}
 
-	switch b {
-	case 'e':
-		return nil, false
-	case 'd':
-		return d.parseDictInterface(), true
-	case 'l':
-		return d.parseListInterface(), true
-	case 'i':
-		return d.parseIntInterface(), true
-	default:
-		if b >= '0' && b <= '9' {
-			// string
+// Decodes the next value as an interface{}, or returns false if there's the end of a list or dict
+// instead. Lists and dicts are decoded with a stack instead of recursing, so there's only a depth
+// limit if MaxDepth is set.
+func (d *Decoder) parseValueInterface() (interface{}, bool) {
+	var stack []interfaceFrame
+	depth := d.depth
+	defer func() {
+		d.depth = depth
+	}()
+	for {
+		start := d.Offset
+		b, err := d.r.ReadByte()
+		if err != nil {
+			panic(err)
+		}
+		d.Offset++
+
+		var v interface{}
+		switch {
+		case b == 'e':
+			if len(stack) == 0 {
+				return nil, false
+			}
+			top := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			d.leave()
+			if top.dict != nil {
+				v = top.dict
+			} else if top.list != nil {
+				v = top.list
+			} else {
+				v = make([]interface{}, 0, 0)
+			}
+		case b == 'd':
+			d.enter()
+			stack = append(stack, interfaceFrame{dict: make(map[string]interface{})})
+			continue
+		case b == 'l':
+			d.enter()
+			stack = append(stack, interfaceFrame{})
+			continue
+		case b == 'i':
+			v = d.parseIntInterface()
+		case b >= '0' && b <= '9':
 			// append first digit of the length to the buffer
 			d.buf.WriteByte(b)
-			return d.parseStringInterface(), true
+			v = d.parseStringInterface()
+		default:
+			d.raiseUnknownValueType(b, d.Offset-1)
 		}
 
-		d.raiseUnknownValueType(b, d.Offset-1)
-		panic("unreachable")
+		// A value is complete.
+		if len(stack) == 0 {
+			return v, true
+		}
+		top := &stack[len(stack)-1]
+		if top.dict == nil {
+			top.list = append(top.list, v)
+			d.checkCollectionItems(len(top.list))
+			continue
+		}
+		if top.haveKey {
+			if !top.skip {
+				top.dict[top.key] = v
+			}
+			top.haveKey = false
+			top.n++
+			d.checkCollectionItems(top.n)
+			continue
+		}
+		if b, ok := v.([]byte); ok {
+			v = string(b)
+		}
+		key, ok := v.(string)
+		if !ok {
+			panic(&SyntaxError{
+				Offset: d.Offset,
+				What:   errors.New("non-string key in a dict"),
+			})
+		}
+		if d.Strict {
+			d.checkKeyOrder(&top.keys, []byte(key), start)
+		}
+		top.key, top.haveKey, top.skip = key, true, false
+		if _, ok := top.dict[key]; ok {
+			d.duplicateKey(start, d.interfacePath(stack), nil)
+			top.skip = d.DuplicateKeys == FirstDuplicateKeyWins
+		}
 	}
 }
 
@@ -577,9 +1052,10 @@ func (d *Decoder) parseIntInterface() (ret interface{}) {
 			What:   errors.New("empty integer value"),
 		})
 	}
+	d.checkStrictInt(d.buf.Bytes(), start)
 
 	n, err := strconv.ParseInt(d.buf.String(), 10, 64)
-	if ne, ok := err.(*strconv.NumError); ok && ne.Err == strconv.ErrRange {
+	if isRangeError(err) {
 		i := new(big.Int)
 		_, ok := i.SetString(d.buf.String(), 10)
 		if !ok {
@@ -603,8 +1079,10 @@ func (d *Decoder) parseStringInterface() interface{} {
 
 	// read the string length first
 	d.readUntil(':')
+	d.checkStrictStrLen(d.buf.Bytes(), start)
 	length, err := strconv.ParseInt(d.buf.String(), 10, 64)
 	checkForIntParseError(err, start)
+	d.checkStrLen(length, start)
 
 	d.buf.Reset()
 	n, err := io.CopyN(&d.buf, d.r, length)
@@ -617,49 +1095,12 @@ func (d *Decoder) parseStringInterface() interface{} {
 		})
 	}
 
-	s := d.buf.String()
+	var s interface{}
+	if d.NonUTF8AsBytes && !utf8.Valid(d.buf.Bytes()) {
+		s = append([]byte(nil), d.buf.Bytes()...)
+	} else {
+		s = d.buf.String()
+	}
 	d.buf.Reset()
 	return s
 }
-
-func (d *Decoder) parseDictInterface() interface{} {
-	dict := make(map[string]interface{})
-	for {
-		keyi, ok := d.parseValueInterface()
-		if !ok {
-			break
-		}
-
-		key, ok := keyi.(string)
-		if !ok {
-			panic(&SyntaxError{
-				Offset: d.Offset,
-				What:   errors.New("non-string key in a dict"),
-			})
-		}
-
-		valuei, ok := d.parseValueInterface()
-		if !ok {
-			break
-		}
-
-		dict[key] = valuei
-	}
-	return dict
-}
-
-func (d *Decoder) parseListInterface() interface{} {
-	var list []interface{}
-	for {
-		valuei, ok := d.parseValueInterface()
-		if !ok {
-			break
-		}
-
-		list = append(list, valuei)
-	}
-	if list == nil {
-		list = make([]interface{}, 0, 0)
-	}
-	return list
-}
@@ -2,9 +2,13 @@ package bencode
 
 import (
 	"bytes"
+	"errors"
+	"fmt"
 	"io"
+	"math"
 	"math/big"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -173,3 +177,385 @@ func TestUnmarshalByteArray(t *testing.T) {
 	assert.NoError(t, Unmarshal([]byte("2:hi"), &ba))
 	assert.EqualValues(t, "hi", ba[:])
 }
+
+func TestDecoderMaxDepth(t *testing.T) {
+	data := strings.Repeat("l", 3) + strings.Repeat("e", 3)
+	for _, v := range []interface{}{new(interface{}), new([][][]int), new(Bytes)} {
+		d := NewDecoder(strings.NewReader(data))
+		d.MaxDepth = 3
+		assert.NoError(t, d.Decode(v))
+		d = NewDecoder(strings.NewReader(data))
+		d.MaxDepth = 2
+		err := d.Decode(v)
+		require.IsType(t, (*SyntaxError)(nil), err)
+		assert.EqualError(t, err, "bencode: syntax error (offset: 2): nesting exceeds max depth of 2")
+	}
+}
+
+func TestDecoderMaxStrLen(t *testing.T) {
+	for _, v := range []interface{}{new(interface{}), new(string), new([]byte), new(Bytes)} {
+		d := NewDecoder(strings.NewReader("2:hi"))
+		d.MaxStrLen = 2
+		assert.NoError(t, d.Decode(v))
+		d = NewDecoder(strings.NewReader("1000000000:"))
+		d.MaxStrLen = 2
+		err := d.Decode(v)
+		require.IsType(t, (*SyntaxError)(nil), err)
+		assert.Contains(t, err.Error(), "string length 1000000000 exceeds max of 2")
+	}
+}
+
+type nestedList []nestedList
+
+func TestDecoderDefaultMaxDepth(t *testing.T) {
+	deep := strings.Repeat("l", DefaultMaxDepth+1) + strings.Repeat("e", DefaultMaxDepth+1)
+	var v nestedList
+	err := Unmarshal([]byte(deep), &v)
+	require.IsType(t, (*SyntaxError)(nil), err)
+	assert.Contains(t, err.Error(), fmt.Sprintf("nesting exceeds max depth of %d", DefaultMaxDepth))
+	d := NewDecoder(strings.NewReader(deep))
+	d.MaxDepth = -1
+	assert.NoError(t, d.Decode(&v))
+}
+
+// Decoding that doesn't recurse has no default depth limit.
+func TestDecodeDeepNesting(t *testing.T) {
+	const depth = 100000
+	deep := strings.Repeat("l", depth) + strings.Repeat("d1:a", depth) + "i1e" + strings.Repeat("e", 2*depth)
+	var v interface{}
+	require.NoError(t, Unmarshal([]byte(deep), &v))
+	for i := 0; i < depth; i++ {
+		v = v.([]interface{})[0]
+	}
+	for i := 0; i < depth; i++ {
+		v = v.(map[string]interface{})["a"]
+	}
+	assert.EqualValues(t, 1, v)
+	var raw RawMessage
+	require.NoError(t, Unmarshal([]byte(deep), &raw))
+	assert.Equal(t, deep, string(raw))
+	var b Bytes
+	require.NoError(t, NewDecoder(strings.NewReader(deep)).Decode(&b))
+	assert.Equal(t, deep, string(b))
+	var s struct{ A Bytes }
+	require.NoError(t, Unmarshal([]byte("d1:A"+deep+"e"), &s))
+	assert.Equal(t, deep, string(s.A))
+	d := NewDecoder(strings.NewReader(deep))
+	require.NoError(t, d.SkipValue())
+	assert.EqualValues(t, len(deep), d.Offset)
+
+	d = NewDecoder(strings.NewReader(deep))
+	d.MaxDepth = depth
+	var le ErrLimitExceeded
+	require.ErrorAs(t, d.Decode(&v), &le)
+	assert.EqualValues(t, depth+1, le.Actual)
+	// Decoding into nesting Go types recurses, and is limited.
+	assert.ErrorAs(t, Unmarshal([]byte(deep), new(nestedList)), &le)
+}
+
+func TestUnmarshalStringLongerThanInput(t *testing.T) {
+	for _, v := range []interface{}{new(interface{}), new(string), new([]byte), new(Bytes), new([2]byte), new(int)} {
+		err := Unmarshal([]byte("5697726615:x"), v)
+		require.IsType(t, (*SyntaxError)(nil), err)
+		assert.Contains(t, err.Error(), "string length 5697726615 exceeds max of 12")
+	}
+	// Decoders of streams don't know the length, but don't allocate it either.
+	for _, v := range []interface{}{new(string), new(Bytes)} {
+		err := NewDecoder(strings.NewReader("5697726615:short")).Decode(v)
+		require.IsType(t, (*SyntaxError)(nil), err)
+		assert.Contains(t, err.Error(), io.ErrUnexpectedEOF.Error())
+	}
+}
+
+func TestDecoderLimitExceeded(t *testing.T) {
+	check := func(err error, limit string, max int64) {
+		t.Helper()
+		require.IsType(t, (*SyntaxError)(nil), err)
+		var le ErrLimitExceeded
+		require.True(t, errors.As(err, &le), "%v", err)
+		assert.Equal(t, limit, le.Limit)
+		assert.EqualValues(t, max, le.Max)
+	}
+	longString := "999999999999:"
+	bigList := "l" + strings.Repeat("i0e", 1e6) + "e"
+	bigDict := "d" + strings.Repeat("0:i0e", 3) + "e"
+	for _, v := range []interface{}{new(interface{}), new([]int), new(Bytes), new(RawMessage)} {
+		d := NewDecoder(strings.NewReader(longString))
+		d.MaxStrLen = 1 << 20
+		err := d.Decode(v)
+		check(err, LimitStrLen, 1<<20)
+		var le ErrLimitExceeded
+		errors.As(err, &le)
+		assert.EqualValues(t, 999999999999, le.Actual)
+
+		d = NewDecoder(strings.NewReader(bigList))
+		d.MaxCollectionItems = 1000
+		check(d.Decode(v), LimitCollectionItems, 1000)
+
+		d = NewDecoder(strings.NewReader("llleee"))
+		d.MaxDepth = 2
+		check(d.Decode(v), LimitDepth, 2)
+	}
+	for _, v := range []interface{}{new(interface{}), new(map[string]int), new(struct{}), new(Bytes)} {
+		d := NewDecoder(strings.NewReader(bigDict))
+		d.MaxCollectionItems = 2
+		check(d.Decode(v), LimitCollectionItems, 2)
+		d = NewDecoder(strings.NewReader(bigDict))
+		d.MaxCollectionItems = 3
+		assert.NoError(t, d.Decode(v))
+	}
+}
+
+func TestUnmarshalNetwork(t *testing.T) {
+	var v interface{}
+	require.NoError(t, Unmarshal([]byte("l"+strings.Repeat("i0e", 1e6)+"e"), &v))
+	err := UnmarshalNetwork([]byte("l"+strings.Repeat("i0e", 1e6)+"e"), &v)
+	var le ErrLimitExceeded
+	require.True(t, errors.As(err, &le))
+	assert.Equal(t, ErrLimitExceeded{LimitCollectionItems, NetworkMaxCollectionItems, NetworkMaxCollectionItems + 1}, le)
+
+	deep := strings.Repeat("l", NetworkMaxDepth+1) + strings.Repeat("e", NetworkMaxDepth+1)
+	require.NoError(t, Unmarshal([]byte(deep), &v))
+	err = UnmarshalNetwork([]byte(deep), &v)
+	require.True(t, errors.As(err, &le))
+	assert.Equal(t, LimitDepth, le.Limit)
+
+	long := fmt.Sprintf("%d:%s", NetworkMaxStrLen+1, make([]byte, NetworkMaxStrLen+1))
+	require.NoError(t, Unmarshal([]byte(long), &v))
+	err = UnmarshalNetwork([]byte(long), &v)
+	require.True(t, errors.As(err, &le))
+	assert.Equal(t, LimitStrLen, le.Limit)
+	// Shorter data gets a lower string limit.
+	err = UnmarshalNetwork([]byte("999999999999:"), &v)
+	require.True(t, errors.As(err, &le))
+	assert.EqualValues(t, 13, le.Max)
+}
+
+type decodeErrorFile struct {
+	Length int64    `bencode:"length"`
+	Path   []string `bencode:"path"`
+}
+
+type decodeErrorUnmarshaler struct {
+	Files []decodeErrorFile
+}
+
+func (me *decodeErrorUnmarshaler) UnmarshalBencode(b []byte) error {
+	return Unmarshal(b, &me.Files)
+}
+
+type unmarshalerFails struct{}
+
+func (unmarshalerFails) UnmarshalBencode([]byte) error {
+	return errors.New("fails")
+}
+
+func TestDecodeErrorPath(t *testing.T) {
+	var v struct {
+		Info struct {
+			Files []decodeErrorFile `bencode:"files"`
+		} `bencode:"info"`
+		Other decodeErrorUnmarshaler `bencode:"other"`
+		Fail  unmarshalerFails       `bencode:"fail"`
+	}
+	check := func(data, path string, offset int64, kind string, msg string) {
+		t.Helper()
+		err := Unmarshal([]byte(data), &v)
+		var de *DecodeError
+		require.True(t, errors.As(err, &de), "%v", err)
+		assert.Equal(t, path, de.Path)
+		assert.Equal(t, offset, de.Offset)
+		assert.Equal(t, kind, de.Kind)
+		assert.EqualError(t, err, msg)
+	}
+	check("d4:infod5:filesld6:lengthi1eed6:length5:helloeeee", "info.files[1].length", 38, "string",
+		"wrong type at info.files[1].length: expected integer, got string at offset 38")
+	check("d4:infod5:filesld4:pathl1:ali1ei2eeeeeee", "info.files[0].path[1]", 27, "list",
+		"wrong type at info.files[0].path[1]: expected string, got list at offset 27")
+	// Within an Unmarshaler, the path and offset are still from the top.
+	check("d5:otherld6:lengthi1eed4:pathi5eeee", "other[1].path", 29, "integer",
+		"wrong type at other[1].path: expected list, got integer 5 at offset 29")
+	check("d4:faili1ee", "fail", 7, "integer",
+		"decoding fail at offset 7: bencode: error calling UnmarshalBencode for type bencode.unmarshalerFails: fails")
+	var i8 int8
+	err := Unmarshal([]byte("i300e"), &i8)
+	var de *DecodeError
+	require.True(t, errors.As(err, &de))
+	assert.EqualError(t, err, "wrong type at top level: expected int8, got integer 300 at offset 0")
+	var ute *UnmarshalTypeError
+	assert.True(t, errors.As(err, &ute))
+}
+
+func TestDecodeBigInt(t *testing.T) {
+	const huge = "123456789012345678901234567890"
+	var s struct {
+		A big.Int  `bencode:"a"`
+		B *big.Int `bencode:"b"`
+		C []*big.Int
+	}
+	require.NoError(t, Unmarshal([]byte("d1:Cli1ei-"+huge+"ee1:ai"+huge+"e1:bi-5ee"), &s))
+	assert.Equal(t, huge, s.A.String())
+	assert.EqualValues(t, -5, s.B.Int64())
+	require.Len(t, s.C, 2)
+	assert.Equal(t, "-"+huge, s.C[1].String())
+	b, err := Marshal(s)
+	require.NoError(t, err)
+	assert.Equal(t, "d1:Cli1ei-"+huge+"ee1:ai"+huge+"e1:bi-5ee", string(b))
+	assert.Error(t, Unmarshal([]byte("i1x2e"), &s.A))
+}
+
+func TestDecodeIntOverflow(t *testing.T) {
+	var i64 int64
+	err := Unmarshal([]byte("i9223372036854775808e"), &i64)
+	var ute *UnmarshalTypeError
+	require.True(t, errors.As(err, &ute), "%v", err)
+
+	var s struct {
+		I64 int64  `bencode:"a"`
+		I8  int8   `bencode:"b"`
+		U64 uint64 `bencode:"c"`
+		U16 uint16 `bencode:"d"`
+		N   int    `bencode:"e"`
+	}
+	var clamped []string
+	d := NewDecoder(strings.NewReader("d1:ai-99999999999999999999e1:bi128e1:ci99999999999999999999e1:di-1e1:ei7ee"))
+	d.OnClamp = func(warning *DecodeError) {
+		clamped = append(clamped, warning.Path)
+	}
+	require.NoError(t, d.Decode(&s))
+	assert.EqualValues(t, math.MinInt64, s.I64)
+	assert.EqualValues(t, math.MaxInt8, s.I8)
+	assert.EqualValues(t, uint64(math.MaxUint64), s.U64)
+	assert.EqualValues(t, 0, s.U16)
+	assert.EqualValues(t, 7, s.N)
+	assert.Equal(t, []string{"a", "b", "c", "d"}, clamped)
+}
+
+func TestDecodeInterfaceTypes(t *testing.T) {
+	const data = "d1:ai-1e1:bi99999999999999999999e1:cl0:2:\xff\xfee1:dde8:\xffnot utfi1ee"
+	huge, _ := new(big.Int).SetString("99999999999999999999", 10)
+	var v interface{}
+	require.NoError(t, Unmarshal([]byte(data), &v))
+	assert.Equal(t, map[string]interface{}{
+		"a":           int64(-1),
+		"b":           huge,
+		"c":           []interface{}{"", "\xff\xfe"},
+		"d":           map[string]interface{}{},
+		"\xffnot utf": int64(1),
+	}, v)
+
+	d := NewDecoder(strings.NewReader(data))
+	d.NonUTF8AsBytes = true
+	require.NoError(t, d.Decode(&v))
+	assert.Equal(t, map[string]interface{}{
+		"a":           int64(-1),
+		"b":           huge,
+		"c":           []interface{}{"", []byte("\xff\xfe")},
+		"d":           map[string]interface{}{},
+		"\xffnot utf": int64(1),
+	}, v)
+	b, err := Marshal(v)
+	require.NoError(t, err)
+	assert.Equal(t, data, string(b))
+}
+
+// Replaces []byte with string throughout v.
+func bytesToStrings(v interface{}) interface{} {
+	switch v := v.(type) {
+	case []byte:
+		return string(v)
+	case []interface{}:
+		for i := range v {
+			v[i] = bytesToStrings(v[i])
+		}
+	case map[string]interface{}:
+		for k := range v {
+			v[k] = bytesToStrings(v[k])
+		}
+	}
+	return v
+}
+
+// NonUTF8AsBytes changes only the types of the strings it applies to.
+func TestNonUTF8AsBytesParity(t *testing.T) {
+	for _, name := range []string{
+		"testdata/archlinux-2011.08.19-netinstall-i686.iso.torrent",
+		"testdata/continuum.torrent",
+	} {
+		data := loadFile(name, t)
+		var plain, withBytes interface{}
+		require.NoError(t, Unmarshal(data, &plain))
+		d := NewDecoder(bytes.NewReader(data))
+		d.NonUTF8AsBytes = true
+		require.NoError(t, d.Decode(&withBytes))
+		pieces := withBytes.(map[string]interface{})["info"].(map[string]interface{})["pieces"]
+		assert.IsType(t, []byte(nil), pieces, name)
+		assert.Equal(t, plain, bytesToStrings(withBytes), name)
+	}
+}
+
+type requiredInner struct {
+	Name string `bencode:"name,required"`
+	Size int    `bencode:"size,required"`
+}
+
+type requiredUnmarshaler struct {
+	Inner requiredInner
+}
+
+func (me *requiredUnmarshaler) UnmarshalBencode(b []byte) error {
+	return Unmarshal(b, &me.Inner)
+}
+
+func TestRequiredKeys(t *testing.T) {
+	var v struct {
+		A     int                 `bencode:"a,required"`
+		B     *int                `bencode:"b,required"`
+		C     int                 `bencode:"c"`
+		Files []requiredInner     `bencode:"files,required"`
+		Other requiredUnmarshaler `bencode:"other"`
+	}
+	err := Unmarshal([]byte("d1:ci3e5:filesld4:name1:xed4:sizei1eee5:otherd4:name1:yee"), &v)
+	var mke *MissingKeysError
+	require.True(t, errors.As(err, &mke), "%v", err)
+	assert.Equal(t, []string{"files[0].size", "files[1].name", "other.size", "a", "b"}, mke.Keys)
+	assert.EqualError(t, err, "bencode: missing required keys: files[0].size, files[1].name, other.size, a, b")
+	// The rest is decoded.
+	assert.Equal(t, 3, v.C)
+	assert.Equal(t, "y", v.Other.Inner.Name)
+	require.Len(t, v.Files, 2)
+	assert.Equal(t, 1, v.Files[1].Size)
+
+	require.NoError(t, Unmarshal([]byte("d1:ai0e1:bi0e5:filesle5:otherd4:name0:4:sizei0eee"), &v))
+	// Other errors come first.
+	err = Unmarshal([]byte("d1:ci3e5:filesi1ee"), &v)
+	var ute *UnmarshalTypeError
+	assert.True(t, errors.As(err, &ute), "%v", err)
+}
+
+func TestDisallowUnknownFields(t *testing.T) {
+	var v struct {
+		A int `bencode:"a"`
+		B struct {
+			C int `bencode:"c"`
+		} `bencode:"b"`
+		M map[string]int `bencode:"m"`
+		D int            `bencode:"-"`
+	}
+	data := "d1:ai1e1:bd1:ci2e1:xi3ee1:md1:yi4eee"
+	require.NoError(t, Unmarshal([]byte(data), &v))
+	d := NewDecoder(strings.NewReader(data))
+	d.DisallowUnknownFields()
+	err := d.Decode(&v)
+	var uke *UnknownKeyError
+	require.True(t, errors.As(err, &uke), "%v", err)
+	assert.Equal(t, "b.x", uke.Path)
+	assert.EqualValues(t, 17, uke.Offset)
+	d = NewDecoder(strings.NewReader("d1:Di1ee"))
+	d.DisallowUnknownFields()
+	assert.True(t, errors.As(d.Decode(&v), &uke))
+	// Map keys aren't fields.
+	d = NewDecoder(strings.NewReader("d1:md1:zi1eee"))
+	d.DisallowUnknownFields()
+	assert.NoError(t, d.Decode(&v))
+}
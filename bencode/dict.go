@@ -0,0 +1,120 @@
+package bencode
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+)
+
+// A dict that keeps its entries in the order they were decoded or added, for re-encoding data as it
+// was, such as when diagnosing interop problems. Marshal emits the entries in order, including any
+// duplicate keys, so a Dict decoded from data that isn't canonical encodes back to the same bytes.
+// Call Canonicalize to sort it. The values are RawMessages, which can be decoded in turn, including
+// into Dicts.
+type Dict []DictEntry
+
+type DictEntry struct {
+	Key   string
+	Value RawMessage
+}
+
+var (
+	_ Unmarshaler = &Dict{}
+	_ Marshaler   = Dict{}
+
+	dictType = reflect.TypeOf(Dict{})
+)
+
+// Returns the value for key. If the key is duplicated, it's the last value, as the Decoder takes by
+// default.
+func (me Dict) Get(key string) (RawMessage, bool) {
+	for i := len(me) - 1; i >= 0; i-- {
+		if me[i].Key == key {
+			return me[i].Value, true
+		}
+	}
+	return nil, false
+}
+
+// Sets the value for key to the encoding of v. The entry is replaced where it is, or added at the
+// end.
+func (me *Dict) Set(key string, v interface{}) error {
+	b, err := Marshal(v)
+	if err != nil {
+		return err
+	}
+	for i := len(*me) - 1; i >= 0; i-- {
+		if (*me)[i].Key == key {
+			(*me)[i].Value = b
+			return nil
+		}
+	}
+	*me = append(*me, DictEntry{key, b})
+	return nil
+}
+
+// Sorts the entries by key, and drops all but the last entry for duplicated keys, as required for
+// canonical bencode. The values aren't changed.
+func (me *Dict) Canonicalize() {
+	d := *me
+	sort.SliceStable(d, func(i, j int) bool { return d[i].Key < d[j].Key })
+	kept := d[:0]
+	for i, e := range d {
+		if i+1 < len(d) && d[i+1].Key == e.Key {
+			continue
+		}
+		kept = append(kept, e)
+	}
+	*me = kept
+}
+
+func (me Dict) MarshalBencode() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('d')
+	for _, e := range me {
+		if err := checkRawValue(e.Value); err != nil {
+			return nil, fmt.Errorf("value for key %q: %w", e.Key, err)
+		}
+		fmt.Fprintf(&buf, "%d:%s", len(e.Key), e.Key)
+		buf.Write(e.Value)
+	}
+	buf.WriteByte('e')
+	return buf.Bytes(), nil
+}
+
+// Sets the Dict to the entries of the dict b, in order. The values refer to a copy of b.
+func (me *Dict) UnmarshalBencode(b []byte) error {
+	b = append([]byte(nil), b...)
+	d := NewDecoder(bytes.NewReader(b))
+	tok, err := d.NextToken()
+	if err != nil {
+		return err
+	}
+	if tok.Kind != DictStart {
+		return &UnmarshalTypeError{Value: valueKind(b[0]), Type: dictType}
+	}
+	entries := make(Dict, 0)
+	for {
+		tok, err = d.NextToken()
+		if err != nil {
+			return err
+		}
+		if tok.Kind == DictEnd {
+			break
+		}
+		key := string(tok.Bytes)
+		start := d.Offset
+		if err := d.SkipValue(); err != nil {
+			return err
+		}
+		entries = append(entries, DictEntry{key, b[start:d.Offset:d.Offset]})
+	}
+	if _, err := d.NextToken(); err != io.EOF {
+		return errors.New("data after dict")
+	}
+	*me = entries
+	return nil
+}
@@ -0,0 +1,69 @@
+package bencode
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDictKeepsOrder(t *testing.T) {
+	data := "d1:bi1e1:ad1:zi-01e1:yi2ee1:bi3ee"
+	var d Dict
+	require.NoError(t, Unmarshal([]byte(data), &d))
+	assert.Equal(t, Dict{
+		{"b", RawMessage("i1e")},
+		{"a", RawMessage("d1:zi-01e1:yi2ee")},
+		{"b", RawMessage("i3e")},
+	}, d)
+	assert.Equal(t, data, string(MustMarshal(d)))
+
+	// Values can be decoded as Dicts in turn.
+	var inner Dict
+	require.NoError(t, Unmarshal(d[1].Value, &inner))
+	assert.Equal(t, Dict{{"z", RawMessage("i-01e")}, {"y", RawMessage("i2e")}}, inner)
+
+	v, ok := d.Get("b")
+	assert.True(t, ok)
+	assert.Equal(t, RawMessage("i3e"), v)
+	_, ok = d.Get("c")
+	assert.False(t, ok)
+
+	d.Canonicalize()
+	assert.Equal(t, "d1:ad1:zi-01e1:yi2ee1:bi3ee", string(MustMarshal(d)))
+}
+
+func TestDictSet(t *testing.T) {
+	var d Dict
+	assert.Equal(t, "de", string(MustMarshal(d)))
+	require.NoError(t, d.Set("z", 1))
+	require.NoError(t, d.Set("a", []string{"x"}))
+	require.NoError(t, d.Set("z", "two"))
+	assert.Equal(t, "d1:z3:two1:al1:xee", string(MustMarshal(d)))
+	assert.Error(t, d.Set("c", make(chan int)))
+}
+
+func TestDictInStruct(t *testing.T) {
+	var s struct {
+		A Dict `bencode:"a"`
+		B int  `bencode:"b"`
+	}
+	data := "d1:ad1:yi1e1:xi2ee1:bi3ee"
+	d := NewDecoder(strings.NewReader(data))
+	require.NoError(t, d.Decode(&s))
+	assert.Equal(t, Dict{{"y", RawMessage("i1e")}, {"x", RawMessage("i2e")}}, s.A)
+	assert.Equal(t, data, string(MustMarshal(s)))
+}
+
+func TestDictErrors(t *testing.T) {
+	var d Dict
+	var ute *UnmarshalTypeError
+	require.ErrorAs(t, d.UnmarshalBencode([]byte("li1ee")), &ute)
+	assert.Equal(t, "list", ute.Value)
+	assert.Error(t, Unmarshal([]byte("i1e"), &d))
+	assert.Error(t, d.UnmarshalBencode([]byte("d1:a")))
+	assert.Error(t, d.UnmarshalBencode([]byte("dei1e")))
+	_, err := Marshal(Dict{{"a", RawMessage("i1")}})
+	assert.Error(t, err)
+}
@@ -0,0 +1,80 @@
+package bencode
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+)
+
+// Which value a Decoder keeps for a key that appears more than once in the same dict. Duplicate keys
+// aren't allowed by BEP 3, but occur in the wild. Strict Decoders reject them instead.
+type DuplicateKeyPolicy int
+
+const (
+	// The last value for the key is decoded over the earlier ones.
+	LastDuplicateKeyWins DuplicateKeyPolicy = iota
+	// The first value for the key is kept, and later ones are skipped, as libtorrent does.
+	FirstDuplicateKeyWins
+)
+
+// Wrapped by the DecodeErrors passed to Decoder.OnDuplicateKey.
+var ErrDuplicateKey = errors.New("duplicate dict key")
+
+// The keys of a dict being decoded, to find duplicates. They're kept in Decoder.dictKeys from
+// start, which nested dicts share as a stack. Keys in order can't be duplicates, so they're only
+// searched for when they aren't, and if the order breaks, a set is used instead.
+type dupKeys struct {
+	start int
+	set   map[string]struct{}
+}
+
+// Whether duplicate keys need to be looked for. Strict Decoders find them with the key order.
+func (d *Decoder) trackingDuplicateKeys() bool {
+	return !d.Strict && (d.OnDuplicateKey != nil || d.DuplicateKeys == FirstDuplicateKeyWins)
+}
+
+func (d *Decoder) beginDupKeys() dupKeys {
+	return dupKeys{start: len(d.dictKeys)}
+}
+
+func (d *Decoder) endDupKeys(dk *dupKeys) {
+	d.dictKeys = d.dictKeys[:dk.start]
+}
+
+// Records key for the dict, and returns whether it was already there.
+func (d *Decoder) isDuplicateKey(dk *dupKeys, key string) bool {
+	if dk.set != nil {
+		if _, ok := dk.set[key]; ok {
+			return true
+		}
+		dk.set[key] = struct{}{}
+		return false
+	}
+	keys := d.dictKeys[dk.start:]
+	if n := len(keys); n == 0 || keys[n-1] < key {
+		d.dictKeys = append(d.dictKeys, key)
+		return false
+	}
+	if i := sort.SearchStrings(keys, key); keys[i] == key {
+		return true
+	}
+	dk.set = make(map[string]struct{}, len(keys)+1)
+	for _, k := range keys {
+		dk.set[k] = struct{}{}
+	}
+	dk.set[key] = struct{}{}
+	return false
+}
+
+// Reports the duplicate key at offset, with the path to its value, in a dict being decoded into t.
+func (d *Decoder) duplicateKey(offset int64, path string, t reflect.Type) {
+	if d.OnDuplicateKey != nil {
+		d.OnDuplicateKey(&DecodeError{
+			Offset: offset,
+			Path:   path,
+			Type:   t,
+			Kind:   "string",
+			Err:    ErrDuplicateKey,
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package bencode
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type duplicateKeysStruct struct {
+	A int            `bencode:"a"`
+	B map[string]int `bencode:"b"`
+	C RawMessage     `bencode:"c"`
+}
+
+const duplicateKeysData = "d1:ai1e1:bd1:xi1e1:yi2e1:xi3ee1:cd1:ki1e1:ki2ee1:ai2e1:zd1:zi1e1:zi2eee"
+
+// Decodes with the policy, returning the paths of the duplicates reported.
+func decodeDuplicateKeys(t *testing.T, policy DuplicateKeyPolicy, v interface{}) (paths []string) {
+	d := NewDecoder(strings.NewReader(duplicateKeysData))
+	d.DuplicateKeys = policy
+	d.OnDuplicateKey = func(warning *DecodeError) {
+		require.True(t, errors.Is(warning, ErrDuplicateKey))
+		paths = append(paths, warning.Path)
+	}
+	require.NoError(t, d.Decode(v))
+	return
+}
+
+func TestDuplicateKeys(t *testing.T) {
+	var s duplicateKeysStruct
+	// The unknown key "z" is discarded, but its duplicates are still found.
+	expectedPaths := []string{"b.x", "c.k", "a", "z.z"}
+	assert.Equal(t, expectedPaths, decodeDuplicateKeys(t, LastDuplicateKeyWins, &s))
+	assert.Equal(t, duplicateKeysStruct{2, map[string]int{"x": 3, "y": 2}, RawMessage("d1:ki1e1:ki2ee")}, s)
+
+	s = duplicateKeysStruct{}
+	assert.Equal(t, expectedPaths, decodeDuplicateKeys(t, FirstDuplicateKeyWins, &s))
+	assert.Equal(t, duplicateKeysStruct{1, map[string]int{"x": 1, "y": 2}, RawMessage("d1:ki1e1:ki2ee")}, s)
+
+	var v interface{}
+	assert.Equal(t, expectedPaths, decodeDuplicateKeys(t, LastDuplicateKeyWins, &v))
+	assert.EqualValues(t, 2, v.(map[string]interface{})["a"])
+	assert.EqualValues(t, 2, v.(map[string]interface{})["c"].(map[string]interface{})["k"])
+	assert.Equal(t, expectedPaths, decodeDuplicateKeys(t, FirstDuplicateKeyWins, &v))
+	assert.EqualValues(t, 1, v.(map[string]interface{})["a"])
+	assert.EqualValues(t, 1, v.(map[string]interface{})["c"].(map[string]interface{})["k"])
+
+	// Strict Decoders reject them.
+	d := NewDecoder(strings.NewReader(duplicateKeysData))
+	d.Strict = true
+	assert.True(t, errors.Is(d.Decode(&s), ErrNotCanonical))
+}
+
+func TestDuplicateKeysOutOfOrder(t *testing.T) {
+	var paths []string
+	d := NewDecoder(strings.NewReader("d1:bi1e1:ai2e1:ci3e1:bi4e1:ai5ee"))
+	d.OnDuplicateKey = func(warning *DecodeError) {
+		paths = append(paths, warning.Path)
+		assert.Equal(t, "duplicate dict key", warning.Err.Error())
+	}
+	var m map[string]int
+	require.NoError(t, d.Decode(&m))
+	assert.Equal(t, []string{"b", "a"}, paths)
+	assert.Equal(t, map[string]int{"a": 5, "b": 4, "c": 3}, m)
+}
+
+func TestDuplicateKeysInRawList(t *testing.T) {
+	var paths []string
+	d := NewDecoder(strings.NewReader("ld1:ai1eed1:ai1e1:ai2eee"))
+	d.OnDuplicateKey = func(warning *DecodeError) {
+		paths = append(paths, warning.Path)
+		assert.EqualValues(t, 16, warning.Offset)
+	}
+	var b Bytes
+	require.NoError(t, d.Decode(&b))
+	assert.Equal(t, []string{"[1].a"}, paths)
+}
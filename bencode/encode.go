@@ -21,6 +21,47 @@ type Encoder struct {
 	scratch [64]byte
 }
 
+// Appends what's written to a slice.
+type sliceWriter struct {
+	b []byte
+}
+
+func (me *sliceWriter) Write(p []byte) (int, error) {
+	me.b = append(me.b, p...)
+	return len(p), nil
+}
+
+// What Marshal and MarshalAppend use, reused through marshalStatePool.
+type marshalState struct {
+	e Encoder
+	w sliceWriter
+	// Output for Marshal, which copies it.
+	buf []byte
+}
+
+// Buffers that grow beyond this aren't kept for reuse.
+const maxPooledMarshalBuffer = 64 << 10
+
+var marshalStatePool = sync.Pool{
+	New: func() interface{} {
+		s := new(marshalState)
+		s.e.w = &s.w
+		return s
+	},
+}
+
+func getMarshalState() *marshalState {
+	return marshalStatePool.Get().(*marshalState)
+}
+
+func putMarshalState(s *marshalState) {
+	s.w.b = nil
+	if cap(s.buf) > maxPooledMarshalBuffer {
+		s.buf = nil
+	}
+	marshalStatePool.Put(s)
+}
+
 func (e *Encoder) Encode(v interface{}) (err error) {
 	if v == nil {
 		return
@@ -104,6 +145,10 @@ func (e *Encoder) reflectValue(v reflect.Value) {
 		return
 	}
 
+	if e.reflectTextMarshaler(v) {
+		return
+	}
+
 	if v.Type() == bigIntType {
 		e.writeString("i")
 		bi := v.Interface().(big.Int)
@@ -7,6 +7,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 type random_encode_test struct {
@@ -89,3 +90,16 @@ func TestRandomEncode(t *testing.T) {
 		assert.EqualValues(t, test.expected, string(data))
 	}
 }
+
+func TestMarshalAppend(t *testing.T) {
+	dst := []byte("prefix")
+	for _, test := range random_encode_tests {
+		data, err := MarshalAppend(dst[:6], test.value)
+		require.NoError(t, err, "%s", test)
+		assert.Equal(t, "prefix"+test.expected, string(data))
+		dst = data
+	}
+	data, err := MarshalAppend(dst[:6], struct{ A RawMessage }{RawMessage("i1")})
+	assert.Error(t, err)
+	assert.Equal(t, "prefix", string(data))
+}
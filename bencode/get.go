@@ -0,0 +1,150 @@
+package bencode
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// Wrapped by the errors of Get and the like when a dict key or list index isn't there.
+var ErrPathNotFound = errors.New("path not found")
+
+// Returns the value at path in the bencoded data, like Get(torrent, "info", "name"). Each element
+// of path is a dict key, or for lists, a decimal index. The data is scanned without decoding it.
+// Dicts on the path are scanned to their end, as the last of duplicate keys is used, and lists to
+// the element. Those parts of the data must be well-formed, but the rest isn't looked at. The
+// returned RawMessage is a slice of data.
+func Get(data []byte, path ...string) (RawMessage, error) {
+	i := 0
+	for n, elem := range path {
+		if i >= len(data) {
+			return nil, rawSyntaxError(i, "unexpected end of value")
+		}
+		var err error
+		var found bool
+		switch data[i] {
+		case 'd':
+			i, found, err = rawDictValue(data, i, elem)
+		case 'l':
+			index, convErr := strconv.Atoi(elem)
+			if convErr != nil || index < 0 {
+				return nil, fmt.Errorf("bencode: list index %q at %q isn't a number", elem, pathCopy(path, n))
+			}
+			i, found, err = rawListElem(data, i, index)
+		default:
+			return nil, fmt.Errorf("bencode: %v at %q isn't a dict or list", valueKind(data[i]), pathCopy(path, n))
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			return nil, fmt.Errorf("%w: %q", ErrPathNotFound, pathCopy(path, n+1))
+		}
+	}
+	end, err := rawValueEnd(data, i)
+	if err != nil {
+		return nil, err
+	}
+	return data[i:end:end], nil
+}
+
+// Returns the content of the string at path. See Get.
+func GetString(data []byte, path ...string) ([]byte, error) {
+	v, err := Get(data, path...)
+	if err != nil {
+		return nil, err
+	}
+	if v[0] < '0' || v[0] > '9' {
+		return nil, getTypeError(v, "string", path)
+	}
+	start, end, err := rawString(v, 0)
+	if err != nil {
+		return nil, err
+	}
+	return v[start:end:end], nil
+}
+
+// Returns the integer at path. See Get.
+func GetInt(data []byte, path ...string) (int64, error) {
+	v, err := Get(data, path...)
+	if err != nil {
+		return 0, err
+	}
+	if v[0] != 'i' {
+		return 0, getTypeError(v, "integer", path)
+	}
+	return strconv.ParseInt(bytesAsString(v[1:len(v)-1]), 10, 64)
+}
+
+// Returns the elements of the list at path. See Get.
+func GetList(data []byte, path ...string) (ret []RawMessage, err error) {
+	v, err := Get(data, path...)
+	if err != nil {
+		return nil, err
+	}
+	if v[0] != 'l' {
+		return nil, getTypeError(v, "list", path)
+	}
+	ret = make([]RawMessage, 0)
+	for i := 1; v[i] != 'e'; {
+		end, err := rawValueEnd(v, i)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, v[i:end:end])
+		i = end
+	}
+	return
+}
+
+func getTypeError(v RawMessage, expected string, path []string) error {
+	return fmt.Errorf("bencode: expected %s at %q, got %s", expected, pathCopy(path, len(path)), valueKind(v[0]))
+}
+
+// Copies the first n elements of path for an error, so that the path passed to Get needn't escape
+// to the heap.
+func pathCopy(path []string, n int) []string {
+	return append([]string(nil), path[:n]...)
+}
+
+// Finds the value for key in the dict at data[i]. If the key is duplicated, it's the last value,
+// as the Decoder takes by default.
+func rawDictValue(data []byte, i int, key string) (value int, found bool, err error) {
+	i++
+	for i < len(data) && data[i] != 'e' {
+		if data[i] < '0' || data[i] > '9' {
+			return 0, false, rawSyntaxError(i, "dict key isn't a string")
+		}
+		start, end, err := rawString(data, i)
+		if err != nil {
+			return 0, false, err
+		}
+		if bytesAsString(data[start:end]) == key {
+			value, found = end, true
+		}
+		if i, err = rawValueEnd(data, end); err != nil {
+			return 0, false, err
+		}
+	}
+	if i >= len(data) {
+		return 0, false, rawSyntaxError(i, "unexpected end of value")
+	}
+	return
+}
+
+// Finds the element at index in the list at data[i].
+func rawListElem(data []byte, i int, index int) (elem int, found bool, err error) {
+	i++
+	for ; i < len(data) && data[i] != 'e'; index-- {
+		if index == 0 {
+			return i, true, nil
+		}
+		if i, err = rawValueEnd(data, i); err != nil {
+			return 0, false, err
+		}
+	}
+	if i >= len(data) {
+		return 0, false, rawSyntaxError(i, "unexpected end of value")
+	}
+	return 0, false, nil
+}
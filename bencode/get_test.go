@@ -0,0 +1,94 @@
+package bencode
+
+import (
+	"crypto/sha1"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const getData = "d8:announce3:url4:infod5:filesld6:lengthi1e4:pathl1:aeed6:lengthi2e4:pathl1:b1:ceee" +
+	"4:name4:test6:pieces0:e5:nodesl0:ee"
+
+func TestGet(t *testing.T) {
+	data := []byte(getData)
+	v, err := Get(data, "info", "files", "1", "path")
+	require.NoError(t, err)
+	assert.Equal(t, RawMessage("l1:b1:ce"), v)
+	v, err = Get(data)
+	require.NoError(t, err)
+	assert.Equal(t, getData, string(v))
+
+	s, err := GetString(data, "info", "name")
+	require.NoError(t, err)
+	assert.Equal(t, "test", string(s))
+	i, err := GetInt(data, "info", "files", "1", "length")
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, i)
+	l, err := GetList(data, "info", "files", "1", "path")
+	require.NoError(t, err)
+	assert.Equal(t, []RawMessage{RawMessage("1:b"), RawMessage("1:c")}, l)
+	l, err = GetList(data, "info", "files", "0", "path", "0", "")
+	assert.Error(t, err)
+	assert.Nil(t, l)
+
+	// The infohash, without decoding.
+	info, err := Get(data, "info")
+	require.NoError(t, err)
+	var mi struct {
+		Info RawMessage `bencode:"info"`
+	}
+	require.NoError(t, Unmarshal(data, &mi))
+	assert.Equal(t, sha1.Sum(mi.Info), sha1.Sum(info))
+}
+
+func TestGetErrors(t *testing.T) {
+	data := []byte(getData)
+	for _, path := range [][]string{
+		{"comment"},
+		{"info", "files", "2"},
+		{"nodes", "1"},
+	} {
+		_, err := Get(data, path...)
+		assert.True(t, errors.Is(err, ErrPathNotFound), "%q: %v", path, err)
+	}
+	_, err := Get(data, "info", "files", "x")
+	assert.EqualError(t, err, `bencode: list index "x" at ["info" "files"] isn't a number`)
+	_, err = Get(data, "announce", "x")
+	assert.EqualError(t, err, `bencode: string at ["announce"] isn't a dict or list`)
+	_, err = GetInt(data, "info", "name")
+	assert.EqualError(t, err, `bencode: expected integer at ["info" "name"], got string`)
+	_, err = GetString(data, "info", "files")
+	assert.Error(t, err)
+
+	// The dicts on the path must be well-formed, but what comes after the list element needn't be.
+	for _, s := range []string{"d1:ai1x2e1:bi2ee", "d1:a", "d1:bi1e"} {
+		_, err = Get([]byte(s), "b")
+		assert.IsType(t, (*SyntaxError)(nil), err, "%q", s)
+	}
+	_, err = Get([]byte("l"), "0")
+	assert.IsType(t, (*SyntaxError)(nil), err)
+	_, err = Get([]byte("d1:bi1e1:ai2e"), "b")
+	assert.IsType(t, (*SyntaxError)(nil), err)
+	v, err := Get([]byte("l1:ai2e"), "0")
+	require.NoError(t, err)
+	assert.Equal(t, RawMessage("1:a"), v)
+}
+
+func TestGetDuplicateKeys(t *testing.T) {
+	// The last value, as Unmarshal would decode.
+	i, err := GetInt([]byte("d1:ai1e1:bi2e1:ai3ee"), "a")
+	require.NoError(t, err)
+	assert.EqualValues(t, 3, i)
+}
+
+func TestGetAllocs(t *testing.T) {
+	data := []byte(getData)
+	assert.Zero(t, testing.AllocsPerRun(100, func() {
+		GetString(data, "info", "files", "1", "path", "1")
+		GetInt(data, "info", "files", "0", "length")
+		Get(data, "info")
+	}))
+}
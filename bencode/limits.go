@@ -0,0 +1,48 @@
+package bencode
+
+import "fmt"
+
+// The Decoder limits, as named in ErrLimitExceeded.
+const (
+	LimitStrLen          = "string length"
+	LimitDepth           = "depth"
+	LimitCollectionItems = "collection items"
+)
+
+// A Decoder limit was exceeded. It's the What of the *SyntaxError returned, which unwraps to it.
+type ErrLimitExceeded struct {
+	// One of the Limit constants.
+	Limit string
+	Max   int64
+	// The length of the string, or for the other limits, the depth or count reached when the limit
+	// was found to be exceeded.
+	Actual int64
+}
+
+func (me ErrLimitExceeded) Error() string {
+	switch me.Limit {
+	case LimitDepth:
+		return fmt.Sprintf("nesting exceeds max depth of %d", me.Max)
+	case LimitCollectionItems:
+		return fmt.Sprintf("collection exceeds max of %d items", me.Max)
+	default:
+		return fmt.Sprintf("%v %d exceeds max of %d", me.Limit, me.Actual, me.Max)
+	}
+}
+
+// Conservative limits for data from peers and trackers, such as extension messages and announce
+// responses, which can be from anyone. See SetNetworkLimits.
+const (
+	NetworkMaxStrLen          = 1 << 20
+	NetworkMaxDepth           = 32
+	NetworkMaxCollectionItems = 1 << 16
+)
+
+// Sets the limits to the Network constants. A MaxStrLen that's already lower is kept.
+func (d *Decoder) SetNetworkLimits() {
+	if d.MaxStrLen <= 0 || d.MaxStrLen > NetworkMaxStrLen {
+		d.MaxStrLen = NetworkMaxStrLen
+	}
+	d.MaxDepth = NetworkMaxDepth
+	d.MaxCollectionItems = NetworkMaxCollectionItems
+}
@@ -0,0 +1,156 @@
+package bencode
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// An encoded value, kept as it is, like encoding/json.RawMessage. Decoding captures the exact bytes
+// of the value, and encoding writes them back verbatim. Both check the bytes are one well-formed
+// value, though not that it's canonical: integers can have leading zeros, and dict keys needn't be
+// sorted. Unlike Bytes, decoding with Unmarshal doesn't copy: the RawMessage refers to the data
+// being decoded, so that must not be modified after. Values decoded from an io.Reader are copied.
+type RawMessage []byte
+
+var (
+	_ Unmarshaler = &RawMessage{}
+	_ Marshaler   = RawMessage{}
+
+	rawMessageType = reflect.TypeOf(RawMessage{})
+)
+
+// Sets the RawMessage to a copy of b. The decoder avoids the copy where it can, and doesn't use
+// this.
+func (me *RawMessage) UnmarshalBencode(b []byte) error {
+	if err := checkRawValue(b); err != nil {
+		return err
+	}
+	*me = append((*me)[:0], b...)
+	return nil
+}
+
+func (me RawMessage) MarshalBencode() ([]byte, error) {
+	if err := checkRawValue(me); err != nil {
+		return nil, err
+	}
+	return me, nil
+}
+
+// Decodes a value into a RawMessage. If the Decoder has the data it's reading, the RawMessage is a
+// slice of it.
+func (d *Decoder) parseRawMessage(v reflect.Value) bool {
+	start := d.Offset
+	d.buf.Reset()
+	if !d.readOneValue() {
+		return false
+	}
+	var b []byte
+	if d.data != nil {
+		b = d.data[start:d.Offset:d.Offset]
+	} else {
+		b = append(b, d.buf.Bytes()...)
+	}
+	if err := checkRawValue(b); err != nil {
+		if se, ok := err.(*SyntaxError); ok {
+			se.Offset += start
+		}
+		panic(err)
+	}
+	v.SetBytes(b)
+	return true
+}
+
+// Returns a *SyntaxError if b isn't exactly one well-formed value. It doesn't recurse, so there's no
+// depth limit.
+func checkRawValue(b []byte) error {
+	end, err := rawValueEnd(b, 0)
+	if err != nil {
+		return err
+	}
+	if end != len(b) {
+		return rawSyntaxError(end, "%v bytes after the value", len(b)-end)
+	}
+	return nil
+}
+
+func rawSyntaxError(offset int, format string, args ...interface{}) error {
+	return &SyntaxError{Offset: int64(offset), What: fmt.Errorf(format, args...)}
+}
+
+// Returns the end of the well-formed value starting at b[i], or a *SyntaxError.
+func rawValueEnd(b []byte, i int) (int, error) {
+	// The open lists and dicts: 'l', and for dicts, 'd' if a key is next, and 'v' if a value is.
+	// Nesting deeper than the array is rare, and allocates.
+	var openArray [32]byte
+	open := openArray[:0]
+	for {
+		if i >= len(b) {
+			return 0, rawSyntaxError(i, "unexpected end of value")
+		}
+		c := b[i]
+		top := len(open) - 1
+		if top >= 0 && c == 'e' {
+			if open[top] == 'v' {
+				return 0, rawSyntaxError(i, "dict key without a value")
+			}
+			open = open[:top]
+			i++
+		} else {
+			if top >= 0 && open[top] != 'l' {
+				if open[top] == 'd' && (c < '0' || c > '9') {
+					return 0, rawSyntaxError(i, "dict key isn't a string")
+				}
+				open[top] ^= 'd' ^ 'v'
+			}
+			switch {
+			case c == 'l' || c == 'd':
+				open = append(open, c)
+				i++
+			case c == 'i':
+				j := i + 1
+				if j < len(b) && b[j] == '-' {
+					j++
+				}
+				digits := j
+				for j < len(b) && b[j] >= '0' && b[j] <= '9' {
+					j++
+				}
+				if j == digits || j >= len(b) || b[j] != 'e' {
+					return 0, rawSyntaxError(i, "bad integer")
+				}
+				i = j + 1
+			case c >= '0' && c <= '9':
+				_, end, err := rawString(b, i)
+				if err != nil {
+					return 0, err
+				}
+				i = end
+			default:
+				return 0, rawSyntaxError(i, "unknown value type %q", c)
+			}
+		}
+		if len(open) == 0 {
+			return i, nil
+		}
+	}
+}
+
+// Returns the extent of the content of the string at b[i].
+func rawString(b []byte, i int) (start, end int, err error) {
+	var length int
+	j := i
+	for ; j < len(b) && b[j] >= '0' && b[j] <= '9'; j++ {
+		length = length*10 + int(b[j]-'0')
+		if length > len(b) {
+			return 0, 0, rawSyntaxError(i, "string longer than the value")
+		}
+	}
+	if j >= len(b) || b[j] != ':' {
+		return 0, 0, rawSyntaxError(i, "bad string length")
+	}
+	j++
+	if length > len(b)-j {
+		return 0, 0, rawSyntaxError(i, "string longer than the value")
+	}
+	return j, j + length, nil
+}
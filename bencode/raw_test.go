@@ -0,0 +1,110 @@
+package bencode
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type rawMessageStruct struct {
+	A RawMessage  `bencode:"a"`
+	B *RawMessage `bencode:"b"`
+	C []RawMessage
+	D int `bencode:"d"`
+}
+
+func TestRawMessageUnmarshal(t *testing.T) {
+	data := []byte("d1:ad1:xi-01ee1:b5:hello1:Cli1el1:yee1:di3ee")
+	var s rawMessageStruct
+	require.NoError(t, Unmarshal(data, &s))
+	// Not canonical, and kept that way.
+	assert.Equal(t, RawMessage("d1:xi-01ee"), s.A)
+	assert.Equal(t, RawMessage("5:hello"), *s.B)
+	assert.Equal(t, []RawMessage{RawMessage("i1e"), RawMessage("l1:ye")}, s.C)
+	assert.Equal(t, 3, s.D)
+	// They're slices of the data.
+	data[7] = 'z'
+	assert.Equal(t, RawMessage("d1:zi-01ee"), s.A)
+	assert.Equal(t, len(s.A), cap(s.A))
+
+	b, err := Marshal(s)
+	require.NoError(t, err)
+	assert.Equal(t, "d1:Cli1el1:yee1:ad1:zi-01ee1:b5:hello1:di3ee", string(b))
+}
+
+func TestRawMessageDecoderCopies(t *testing.T) {
+	data := []byte("l3:abci4ee")
+	var l []RawMessage
+	require.NoError(t, NewDecoder(bytes.NewReader(data)).Decode(&l))
+	data[1] = '9'
+	assert.Equal(t, []RawMessage{RawMessage("3:abc"), RawMessage("i4e")}, l)
+}
+
+func TestRawMessageUnmarshalAllocs(t *testing.T) {
+	data := []byte("d1:ad1:xli1ei2ei3eee1:d5:helloe")
+	var s struct {
+		A RawMessage `bencode:"a"`
+		D RawMessage `bencode:"d"`
+	}
+	require.NoError(t, Unmarshal(data, &s))
+	withRaw := testing.AllocsPerRun(100, func() {
+		Unmarshal(data, &s)
+	})
+	var b struct {
+		A Bytes `bencode:"a"`
+		D Bytes `bencode:"d"`
+	}
+	withBytes := testing.AllocsPerRun(100, func() {
+		Unmarshal(data, &b)
+	})
+	// Bytes copies each value, and RawMessage doesn't.
+	assert.Less(t, withRaw, withBytes)
+}
+
+func TestRawMessageMalformed(t *testing.T) {
+	for _, s := range []string{
+		"",
+		"e",
+		"i1",
+		"ie",
+		"i-e",
+		"i1xe",
+		"3:ab",
+		"1x",
+		"l",
+		"d1:ae",
+		"di1ei2ee",
+		"x",
+		"i1ei2e",
+		"le1:a",
+	} {
+		err := new(RawMessage).UnmarshalBencode([]byte(s))
+		assert.IsType(t, (*SyntaxError)(nil), err, "%q", s)
+		_, err = RawMessage(s).MarshalBencode()
+		assert.Error(t, err, "%q", s)
+	}
+	_, err := Marshal(struct{ A RawMessage }{RawMessage("i1")})
+	assert.Error(t, err)
+}
+
+func TestRawMessageWellFormed(t *testing.T) {
+	for _, s := range []string{"i0e", "i-5e", "0:", "3:abc", "le", "de", "lli1eeded1:a0:ee", "d1:bi1e1:ai2ee"} {
+		var m RawMessage
+		require.NoError(t, m.UnmarshalBencode([]byte(s)), "%q", s)
+		assert.Equal(t, s, string(m))
+		b, err := m.MarshalBencode()
+		require.NoError(t, err)
+		assert.Equal(t, s, string(b))
+	}
+}
+
+func TestRawMessageDecodeError(t *testing.T) {
+	var s struct{ A RawMessage }
+	// The decoder's own checks don't look at integers.
+	err := Unmarshal([]byte("d1:Ai1x2ee"), &s)
+	var se *SyntaxError
+	require.ErrorAs(t, err, &se)
+	assert.EqualValues(t, 4, se.Offset)
+}
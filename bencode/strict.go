@@ -0,0 +1,93 @@
+package bencode
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Wrapped by the SyntaxErrors of strict Decoders for data that's well-formed, but isn't how the
+// value would be encoded: integers and string lengths with leading zeros, "-0", and dict keys that
+// are duplicated or out of order. Data without these encodes back to the same bytes, so an infohash
+// is unchanged by decoding and encoding its info.
+var ErrNotCanonical = errors.New("not canonical")
+
+func (d *Decoder) throwNotCanonical(offset int64, format string, args ...interface{}) {
+	d.throwSyntaxError(offset, fmt.Errorf("%w: %s", ErrNotCanonical, fmt.Sprintf(format, args...)))
+}
+
+// Checks the digits of the integer at offset, for strict Decoders.
+func (d *Decoder) checkStrictInt(b []byte, offset int64) {
+	if !d.Strict {
+		return
+	}
+	if !validInteger(b) {
+		d.throwSyntaxError(offset, fmt.Errorf("bad integer %q", b))
+	}
+	if bytes.Equal(b, []byte("-0")) {
+		d.throwNotCanonical(offset, "negative zero")
+	}
+	if b[0] == '-' {
+		b = b[1:]
+	}
+	if len(b) > 1 && b[0] == '0' {
+		d.throwNotCanonical(offset, "leading zero in integer")
+	}
+}
+
+// Checks the length digits of the string at offset, for strict Decoders.
+func (d *Decoder) checkStrictStrLen(b []byte, offset int64) {
+	if !d.Strict {
+		return
+	}
+	if !validInteger(b) || b[0] == '-' {
+		d.throwSyntaxError(offset, fmt.Errorf("bad string length %q", b))
+	}
+	if len(b) > 1 && b[0] == '0' {
+		d.throwNotCanonical(offset, "leading zero in string length")
+	}
+}
+
+// The keys of a dict, to check their order when decoding strictly.
+type keyOrder struct {
+	prev    []byte
+	started bool
+}
+
+// Checks the key at offset comes after the dict's previous key, for strict Decoders.
+func (d *Decoder) checkKeyOrder(ko *keyOrder, key []byte, offset int64) {
+	if !d.Strict {
+		return
+	}
+	if ko.started {
+		switch c := bytes.Compare(ko.prev, key); {
+		case c == 0:
+			d.throwNotCanonical(offset, "duplicate dict key %q", key)
+		case c > 0:
+			d.throwNotCanonical(offset, "dict key %q is after %q", key, ko.prev)
+		}
+	}
+	ko.prev = append(ko.prev[:0], key...)
+	ko.started = true
+}
+
+// Checks a dict key at offset starts with b, for strict Decoders. Otherwise non-string keys can be
+// decoded into strings.
+func (d *Decoder) checkStrictKeyStart(b byte, offset int64) {
+	if d.Strict && b != 'e' && (b < '0' || b > '9') {
+		d.throwSyntaxError(offset, errors.New("dict key isn't a string"))
+	}
+}
+
+// Reads the rest of the data after the top-level value, for strict Decoders.
+func (d *Decoder) checkNoTrailingBytes() error {
+	n, err := io.Copy(io.Discard, d.r)
+	if err != nil {
+		return err
+	}
+	if n != 0 {
+		return ErrUnusedTrailingBytes{int(n)}
+	}
+	return nil
+}
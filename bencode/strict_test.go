@@ -0,0 +1,97 @@
+package bencode
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Decodes s strictly in all the ways there are, and returns the errors.
+func strictDecodeErrors(s string) (errs []error) {
+	var (
+		i  interface{}
+		st struct {
+			A interface{} `bencode:"a"`
+			B interface{} `bencode:"b"`
+		}
+		m   map[string]interface{}
+		raw RawMessage
+	)
+	for _, v := range []interface{}{&i, &st, &m, &raw} {
+		errs = append(errs, UnmarshalStrict([]byte(s), v))
+	}
+	d := NewDecoder(strings.NewReader(s))
+	d.Strict = true
+	var err error
+	for err == nil {
+		err = d.SkipValue()
+	}
+	errs = append(errs, err)
+	return
+}
+
+func TestStrictNotCanonical(t *testing.T) {
+	for _, s := range []string{
+		"i01e",
+		"i-0e",
+		"i-01e",
+		"02:ab",
+		"d1:bi1e1:ai2ee",
+		"d1:ai1e1:ai2ee",
+		"d1:ad1:yi1e1:xi2eee",
+		"d1:ad1:b0:1:a0:ee",
+		"d1:a01:xe",
+	} {
+		for _, err := range strictDecodeErrors(s) {
+			assert.True(t, errors.Is(err, ErrNotCanonical), "%q: %v", s, err)
+			assert.IsType(t, (*SyntaxError)(nil), err, "%q", s)
+		}
+		var v interface{}
+		assert.NoError(t, Unmarshal([]byte(s), &v), "%q", s)
+	}
+}
+
+func TestStrictMalformed(t *testing.T) {
+	for _, s := range []string{"i+1e", "i1-e", "di1ei2ee", "+1:a"} {
+		for _, err := range strictDecodeErrors(s) {
+			assert.IsType(t, (*SyntaxError)(nil), err, "%q", s)
+			assert.False(t, errors.Is(err, ErrNotCanonical), "%q: %v", s, err)
+		}
+	}
+	// Leniently, an integer key decodes into a string.
+	var v struct {
+		A int `bencode:"1"`
+	}
+	require.NoError(t, Unmarshal([]byte("di1ei2ee"), &v))
+	assert.Equal(t, 2, v.A)
+}
+
+func TestStrictCanonical(t *testing.T) {
+	for _, s := range []string{"i0e", "i-1e", "i10e", "0:", "10:0123456789", "de", "d0:i0e1:ai1e1:bi2ee", "ldedee"} {
+		var v interface{}
+		require.NoError(t, UnmarshalStrict([]byte(s), &v), "%q", s)
+		b, err := Marshal(v)
+		require.NoError(t, err)
+		assert.Equal(t, s, string(b))
+	}
+}
+
+func TestStrictTrailingBytes(t *testing.T) {
+	var v interface{}
+	assert.Equal(t, ErrUnusedTrailingBytes{3}, UnmarshalStrict([]byte("i1eabc"), &v))
+	d := NewDecoder(bytes.NewReader([]byte("i1ei2e")))
+	d.Strict = true
+	assert.Equal(t, ErrUnusedTrailingBytes{3}, d.Decode(&v))
+	// Tokens can still be read one at a time.
+	d = NewDecoder(bytes.NewReader([]byte("li1e1:xe")))
+	d.Strict = true
+	for _, k := range []TokenKind{ListStart, Integer, String, ListEnd} {
+		tok, err := d.NextToken()
+		require.NoError(t, err)
+		assert.Equal(t, k, tok.Kind)
+	}
+}
@@ -36,6 +36,11 @@ func (me tag) OmitEmpty() bool {
 	return me.HasOpt("omitempty")
 }
 
+// The key must be in the dict the struct is decoded from. See MissingKeysError.
+func (me tag) Required() bool {
+	return me.HasOpt("required")
+}
+
 func (me tag) IgnoreUnmarshalTypeError() bool {
 	return me.HasOpt("ignore_unmarshal_type_error")
 }
@@ -0,0 +1,83 @@
+package bencode
+
+import (
+	"bytes"
+	"encoding"
+	"reflect"
+)
+
+// Types that don't implement Marshaler or Unmarshaler, but do implement encoding.TextMarshaler or
+// encoding.TextUnmarshaler, are encoded as strings of their text, like netip.AddrPort. A Marshaler
+// or Unmarshaler on either the type or a pointer to it always takes precedence. Byte slices and
+// arrays, like net.IP, and big.Int keep their usual encoding.
+
+var (
+	textMarshalerType   = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// Whether the text interfaces are used for values of type t, if t implements them.
+func textAllowed(t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == bigIntType || t.Kind() == reflect.Interface {
+		return false
+	}
+	if (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) && t.Elem().Kind() == reflect.Uint8 {
+		return false
+	}
+	return !t.Implements(marshalerType) && !t.Implements(unmarshalerType) &&
+		!reflect.PtrTo(t).Implements(marshalerType) && !reflect.PtrTo(t).Implements(unmarshalerType)
+}
+
+// Returns true if the value was encoded as a string with encoding.TextMarshaler.
+func (e *Encoder) reflectTextMarshaler(v reflect.Value) bool {
+	if !textAllowed(v.Type()) {
+		return false
+	}
+	if !v.Type().Implements(textMarshalerType) {
+		if v.Kind() != reflect.Ptr && v.CanAddr() && v.Addr().Type().Implements(textMarshalerType) {
+			v = v.Addr()
+		} else {
+			return false
+		}
+	}
+	if v.Kind() == reflect.Ptr && v.IsNil() {
+		// Encoded as the zero value.
+		return false
+	}
+	text, err := v.Interface().(encoding.TextMarshaler).MarshalText()
+	if err != nil {
+		panic(&MarshalerError{v.Type(), err})
+	}
+	e.reflectByteSlice(text)
+	return true
+}
+
+// Decodes a string into a value whose pointer implements encoding.TextUnmarshaler. The error is for
+// other kinds of bencode value, as for parseString.
+func (d *Decoder) parseTextUnmarshaler(v reflect.Value) (bool, error) {
+	if !textAllowed(v.Type()) || !v.Addr().Type().Implements(textUnmarshalerType) {
+		return false, nil
+	}
+	d.buf.Reset()
+	start := d.Offset
+	if !d.readOneValue() {
+		return false, nil
+	}
+	b := d.buf.Bytes()
+	if kind := valueKind(b[0]); kind != "string" {
+		d.buf.Reset()
+		return true, d.decodeError(start, v.Type(), kind, &UnmarshalTypeError{
+			Value: kind,
+			Type:  v.Type(),
+		})
+	}
+	err := v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText(b[bytes.IndexByte(b, ':')+1:])
+	d.buf.Reset()
+	if err != nil {
+		panic(d.decodeError(start, v.Type(), "string", &UnmarshalerError{v.Addr().Type(), err}))
+	}
+	return true, nil
+}
@@ -0,0 +1,95 @@
+package bencode
+
+import (
+	"errors"
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type textAddrs struct {
+	Addr netip.AddrPort        `bencode:"addr"`
+	Ptr  *netip.AddrPort       `bencode:"ptr,omitempty"`
+	List []netip.AddrPort      `bencode:"list"`
+	Map  map[string]netip.Addr `bencode:"map"`
+	IP   net.IP                `bencode:"ip"`
+}
+
+func TestTextMarshalerRoundTrip(t *testing.T) {
+	ptr := netip.MustParseAddrPort("[::1]:6881")
+	orig := textAddrs{
+		Addr: netip.MustParseAddrPort("1.2.3.4:5"),
+		Ptr:  &ptr,
+		List: []netip.AddrPort{netip.MustParseAddrPort("10.0.0.1:80"), netip.MustParseAddrPort("[2001:db8::1]:443")},
+		Map:  map[string]netip.Addr{"a": netip.MustParseAddr("fe80::1")},
+		IP:   net.IPv4(1, 2, 3, 4).To4(),
+	}
+	b, err := Marshal(orig)
+	require.NoError(t, err)
+	assert.Equal(t,
+		"d4:addr9:1.2.3.4:52:ip4:\x01\x02\x03\x044:listl11:10.0.0.1:8017:[2001:db8::1]:443e3:mapd1:a7:fe80::1e3:ptr10:[::1]:6881e",
+		string(b))
+	var decoded textAddrs
+	require.NoError(t, Unmarshal(b, &decoded))
+	assert.Equal(t, orig, decoded)
+}
+
+func TestTextUnmarshalerErrors(t *testing.T) {
+	var v textAddrs
+	err := Unmarshal([]byte("d4:addri5ee"), &v)
+	var ute *UnmarshalTypeError
+	require.True(t, errors.As(err, &ute), "%v", err)
+	assert.EqualError(t, err, "wrong type at addr: expected string, got integer at offset 7")
+
+	err = Unmarshal([]byte("d4:listl7:bad:addree"), &v)
+	var de *DecodeError
+	require.True(t, errors.As(err, &de), "%v", err)
+	assert.Equal(t, "list[0]", de.Path)
+	var ue *UnmarshalerError
+	assert.True(t, errors.As(err, &ue))
+}
+
+// Has both kinds of marshaling, and the bencode ones win.
+type textAndBencode struct {
+	s string
+}
+
+func (me textAndBencode) MarshalText() ([]byte, error) {
+	return []byte("text"), nil
+}
+
+func (me *textAndBencode) UnmarshalText(b []byte) error {
+	me.s = "text " + string(b)
+	return nil
+}
+
+func (me textAndBencode) MarshalBencode() ([]byte, error) {
+	return []byte("i1e"), nil
+}
+
+func (me *textAndBencode) UnmarshalBencode(b []byte) error {
+	me.s = "bencode " + string(b)
+	return nil
+}
+
+func TestTextMarshalerPrecedence(t *testing.T) {
+	b, err := Marshal(textAndBencode{})
+	require.NoError(t, err)
+	assert.Equal(t, "i1e", string(b))
+	var v textAndBencode
+	require.NoError(t, Unmarshal([]byte("4:abcd"), &v))
+	assert.Equal(t, "bencode 4:abcd", v.s)
+}
+
+func TestTextMarshalerIgnoreTypeError(t *testing.T) {
+	var v struct {
+		Addr netip.Addr `bencode:"addr,ignore_unmarshal_type_error"`
+		N    int        `bencode:"n"`
+	}
+	require.NoError(t, Unmarshal([]byte("d4:addrli1ee1:ni2ee"), &v))
+	assert.False(t, v.Addr.IsValid())
+	assert.Equal(t, 2, v.N)
+}
@@ -0,0 +1,249 @@
+package bencode
+
+import (
+	"errors"
+	"io"
+	"runtime"
+	"strconv"
+)
+
+type TokenKind int
+
+const (
+	DictStart TokenKind = iota + 1
+	DictEnd
+	ListStart
+	ListEnd
+	String
+	Integer
+)
+
+func (me TokenKind) String() string {
+	switch me {
+	case DictStart:
+		return "dict start"
+	case DictEnd:
+		return "dict end"
+	case ListStart:
+		return "list start"
+	case ListEnd:
+		return "list end"
+	case String:
+		return "string"
+	case Integer:
+		return "integer"
+	default:
+		return "unknown"
+	}
+}
+
+// A lexical element of bencoded data, returned by Decoder.NextToken.
+type Token struct {
+	Kind TokenKind
+	// The offset of the token in the data, as for Decoder.Offset.
+	Offset int64
+	// For strings, the content, and for integers, the digits. It's only valid until the next call
+	// to the Decoder.
+	Bytes []byte
+}
+
+// Parses the digits of an integer token.
+func (me Token) Int64() (int64, error) {
+	if me.Kind != Integer {
+		return 0, errors.New("not an integer")
+	}
+	return strconv.ParseInt(bytesAsString(me.Bytes), 10, 64)
+}
+
+// A list or dict opened by NextToken.
+type tokenFrame struct {
+	dict bool
+	// For dicts, whether a key is next.
+	keyNext bool
+	items   int
+	keys    keyOrder
+}
+
+// Returns the next token of the data, checking the structure as it goes: dict keys must be strings,
+// and lists and dicts must be closed. This allows scanning data without decoding all of it, as
+// with encoding/json.Decoder.Token. The Decoder limits apply. io.EOF is returned if the data ends
+// where a new top-level value could start. Between tokens, SkipValue or Decode can consume the
+// next value whole.
+func (d *Decoder) NextToken() (tok Token, err error) {
+	defer recoverError(&err)
+	return d.nextToken(false), nil
+}
+
+// Discards the next value, without reading any of it into memory. Decoder.Offset is then the end of
+// the value, so the extent of a value can be found. It's an error if the next token closes a list
+// or dict, and nothing is consumed.
+func (d *Decoder) SkipValue() (err error) {
+	defer recoverError(&err)
+	if d.peekByte() == 'e' {
+		d.throwSyntaxError(d.Offset, errors.New("no value to skip"))
+	}
+	tok := d.nextToken(true)
+	depth := len(d.tokenFrames)
+	switch tok.Kind {
+	case DictStart, ListStart:
+		for len(d.tokenFrames) >= depth {
+			d.nextToken(true)
+		}
+	}
+	return nil
+}
+
+// Reads the next token. If discard is true, strings are discarded instead of returned.
+func (d *Decoder) nextToken(discard bool) (tok Token) {
+	d.buf.Reset()
+	tok.Offset = d.Offset
+	b, err := d.r.ReadByte()
+	if err == io.EOF && len(d.tokenFrames) == 0 {
+		panic(io.EOF)
+	}
+	if err != nil {
+		checkForUnexpectedEOF(err, d.Offset)
+		panic(err)
+	}
+	d.Offset++
+	if b == 'e' {
+		if len(d.tokenFrames) == 0 {
+			d.throwSyntaxError(tok.Offset, errors.New("unexpected 'e'"))
+		}
+		top := d.tokenFrames[len(d.tokenFrames)-1]
+		if top.dict && !top.keyNext {
+			d.throwSyntaxError(tok.Offset, errors.New("missing value for dict key"))
+		}
+		d.tokenFrames = d.tokenFrames[:len(d.tokenFrames)-1]
+		d.leave()
+		tok.Kind = ListEnd
+		if top.dict {
+			tok.Kind = DictEnd
+		}
+		return
+	}
+	isKey := false
+	if n := len(d.tokenFrames); n != 0 {
+		isKey = d.tokenFrames[n-1].dict && d.tokenFrames[n-1].keyNext
+	}
+	d.beginTokenValue(b, tok.Offset)
+	switch {
+	case b == 'd' || b == 'l':
+		d.enter()
+		d.tokenFrames = append(d.tokenFrames, tokenFrame{dict: b == 'd', keyNext: true})
+		tok.Kind = ListStart
+		if b == 'd' {
+			tok.Kind = DictStart
+		}
+	case b == 'i':
+		d.readUntil('e')
+		if !validInteger(d.buf.Bytes()) {
+			d.throwSyntaxError(tok.Offset, errors.New("bad integer"))
+		}
+		d.checkStrictInt(d.buf.Bytes(), tok.Offset)
+		tok.Kind = Integer
+		tok.Bytes = d.buf.Bytes()
+	case b >= '0' && b <= '9':
+		d.buf.WriteByte(b)
+		d.readUntil(':')
+		d.checkStrictStrLen(d.buf.Bytes(), tok.Offset)
+		length, err := strconv.ParseInt(bytesAsString(d.buf.Bytes()), 10, 64)
+		checkForIntParseError(err, tok.Offset)
+		d.checkStrLen(length, tok.Offset)
+		d.buf.Reset()
+		// Strict Decoders need keys to check their order.
+		d.readTokenString(length, discard && !(d.Strict && isKey))
+		if isKey {
+			d.checkKeyOrder(&d.tokenFrames[len(d.tokenFrames)-1].keys, d.buf.Bytes(), tok.Offset)
+		}
+		tok.Kind = String
+		tok.Bytes = d.buf.Bytes()
+	default:
+		d.raiseUnknownValueType(b, tok.Offset)
+	}
+	return
+}
+
+// Reads a string of the given length into d.buf, or discards it. It's read in chunks, so a long
+// string declared by bad data doesn't allocate up front.
+func (d *Decoder) readTokenString(length int64, discard bool) {
+	const chunk = 4 << 10
+	for length > 0 {
+		n := length
+		if n > chunk {
+			n = chunk
+		}
+		if discard {
+			d.buf.Reset()
+		}
+		d.buf.Grow(int(n))
+		b := d.buf.AvailableBuffer()[:n]
+		read, err := io.ReadFull(d.r, b)
+		d.buf.Write(b[:read])
+		d.Offset += int64(read)
+		length -= int64(read)
+		if err == io.ErrUnexpectedEOF {
+			err = io.EOF
+		}
+		if err != nil {
+			checkForUnexpectedEOF(err, d.Offset)
+			panic(err)
+		}
+	}
+	if discard {
+		d.buf.Reset()
+	}
+}
+
+// Called with the first byte of a value read in the current list or dict, if any.
+func (d *Decoder) beginTokenValue(b byte, offset int64) {
+	if len(d.tokenFrames) == 0 {
+		return
+	}
+	top := &d.tokenFrames[len(d.tokenFrames)-1]
+	if top.dict {
+		if top.keyNext {
+			if b < '0' || b > '9' {
+				d.throwSyntaxError(offset, errors.New("dict key isn't a string"))
+			}
+			top.items++
+			d.checkCollectionItems(top.items)
+		}
+		top.keyNext = !top.keyNext
+	} else {
+		top.items++
+		d.checkCollectionItems(top.items)
+	}
+}
+
+// Sets err from a panic with an error, as raised by decoding.
+func recoverError(err *error) {
+	if *err != nil {
+		return
+	}
+	r := recover()
+	if _, ok := r.(runtime.Error); ok {
+		panic(r)
+	}
+	var ok bool
+	*err, ok = r.(error)
+	if !ok && r != nil {
+		panic(r)
+	}
+}
+
+// Whether b is an optional '-' and one or more digits.
+func validInteger(b []byte) bool {
+	if len(b) != 0 && b[0] == '-' {
+		b = b[1:]
+	}
+	if len(b) == 0 {
+		return false
+	}
+	for _, c := range b {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,272 @@
+package bencode
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type tokenString struct {
+	Kind   TokenKind
+	Offset int64
+	Bytes  string
+}
+
+func readAllTokens(t *testing.T, d *Decoder) (ret []tokenString) {
+	for {
+		tok, err := d.NextToken()
+		if err == io.EOF {
+			return
+		}
+		require.NoError(t, err)
+		ret = append(ret, tokenString{tok.Kind, tok.Offset, string(tok.Bytes)})
+	}
+}
+
+func TestNextToken(t *testing.T) {
+	d := NewDecoder(strings.NewReader("d1:ali-3ee1:bd0:0:ee3:end"))
+	assert.Equal(t, []tokenString{
+		{DictStart, 0, ""},
+		{String, 1, "a"},
+		{ListStart, 4, ""},
+		{Integer, 5, "-3"},
+		{ListEnd, 9, ""},
+		{String, 10, "b"},
+		{DictStart, 13, ""},
+		{String, 14, ""},
+		{String, 16, ""},
+		{DictEnd, 18, ""},
+		{DictEnd, 19, ""},
+		{String, 20, "end"},
+	}, readAllTokens(t, d))
+	assert.EqualValues(t, 25, d.Offset)
+}
+
+func TestNextTokenInt64(t *testing.T) {
+	tok, err := NewDecoder(strings.NewReader("i-42e")).NextToken()
+	require.NoError(t, err)
+	i, err := tok.Int64()
+	require.NoError(t, err)
+	assert.EqualValues(t, -42, i)
+	tok, err = NewDecoder(strings.NewReader("0:")).NextToken()
+	require.NoError(t, err)
+	_, err = tok.Int64()
+	assert.Error(t, err)
+}
+
+func TestSkipValue(t *testing.T) {
+	data := "d1:ai1e4:infod6:lengthi5e4:name1:xe1:zl1:yee"
+	d := NewDecoder(strings.NewReader(data))
+	_, err := d.NextToken()
+	require.NoError(t, err)
+	var extent [2]int64
+	for {
+		tok, err := d.NextToken()
+		require.NoError(t, err)
+		if tok.Kind == DictEnd {
+			break
+		}
+		key := string(tok.Bytes)
+		start := d.Offset
+		require.NoError(t, d.SkipValue())
+		if key == "info" {
+			extent = [2]int64{start, d.Offset}
+		}
+	}
+	assert.Equal(t, "d6:lengthi5e4:name1:xe", data[extent[0]:extent[1]])
+	_, err = d.NextToken()
+	assert.Equal(t, io.EOF, err)
+
+	// There's no value at the end of a list, and the end isn't consumed.
+	d = NewDecoder(strings.NewReader("le"))
+	_, err = d.NextToken()
+	require.NoError(t, err)
+	assert.IsType(t, (*SyntaxError)(nil), d.SkipValue())
+	tok, err := d.NextToken()
+	require.NoError(t, err)
+	assert.Equal(t, ListEnd, tok.Kind)
+}
+
+func TestNextTokenThenDecode(t *testing.T) {
+	d := NewDecoder(strings.NewReader("d1:ali1ei2ee1:bd1:xi3eee"))
+	var tokens []TokenKind
+	var a []int
+	var b map[string]int
+	for {
+		tok, err := d.NextToken()
+		require.NoError(t, err)
+		tokens = append(tokens, tok.Kind)
+		if tok.Kind == DictEnd {
+			break
+		}
+		switch string(tok.Bytes) {
+		case "a":
+			require.NoError(t, d.Decode(&a))
+		case "b":
+			require.NoError(t, d.Decode(&b))
+		}
+	}
+	assert.Equal(t, []TokenKind{DictStart, String, String, DictEnd}, tokens)
+	assert.Equal(t, []int{1, 2}, a)
+	assert.Equal(t, map[string]int{"x": 3}, b)
+
+	// Decode can't close the dict.
+	d = NewDecoder(strings.NewReader("de"))
+	_, err := d.NextToken()
+	require.NoError(t, err)
+	var v interface{}
+	assert.IsType(t, (*SyntaxError)(nil), d.Decode(&v))
+	// Decoded values count as dict keys.
+	d = NewDecoder(strings.NewReader("di1ei2ee"))
+	_, err = d.NextToken()
+	require.NoError(t, err)
+	assert.IsType(t, (*SyntaxError)(nil), d.Decode(&v))
+}
+
+func TestNextTokenMalformed(t *testing.T) {
+	for _, s := range []string{
+		"e",
+		"di1ei2ee",
+		"d1:ae",
+		"d1:a",
+		"l",
+		"i1",
+		"ie",
+		"i1xe",
+		"3:ab",
+		"x",
+	} {
+		d := NewDecoder(strings.NewReader(s))
+		var err error
+		for err == nil {
+			_, err = d.NextToken()
+		}
+		assert.IsType(t, (*SyntaxError)(nil), err, "%q", s)
+	}
+}
+
+func TestNextTokenLimits(t *testing.T) {
+	tokenErr := func(d *Decoder) error {
+		for {
+			if _, err := d.NextToken(); err != nil {
+				return err
+			}
+		}
+	}
+	var le ErrLimitExceeded
+	d := NewDecoder(strings.NewReader("lllleeee"))
+	d.MaxDepth = 3
+	require.True(t, errors.As(tokenErr(d), &le))
+	assert.Equal(t, LimitDepth, le.Limit)
+
+	d = NewDecoder(strings.NewReader("d1:ai1e1:bi2ee"))
+	d.MaxCollectionItems = 1
+	require.True(t, errors.As(tokenErr(d), &le))
+	assert.Equal(t, ErrLimitExceeded{LimitCollectionItems, 1, 2}, le)
+
+	d = NewDecoder(strings.NewReader("999999999999:"))
+	d.MaxStrLen = 10
+	require.True(t, errors.As(d.SkipValue(), &le))
+	assert.Equal(t, LimitStrLen, le.Limit)
+}
+
+// A torrent with the given amount of piece hashes, that's mostly info.
+func largeTorrent(piecesLen int) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("d8:announce35:http://tracker.example.com/announce")
+	buf.WriteString("7:comment4:test10:created by4:test13:creation datei1600000000e")
+	buf.WriteString("4:infod")
+	buf.WriteString("5:filesl")
+	for i := 0; i < 1000; i++ {
+		fmt.Fprintf(&buf, "d6:lengthi%de4:pathl4:file%d:%dee", i+1, len(fmt.Sprint(i)), i)
+	}
+	buf.WriteString("e4:name5:large12:piece lengthi262144e")
+	fmt.Fprintf(&buf, "6:pieces%d:", piecesLen)
+	buf.Write(make([]byte, piecesLen))
+	buf.WriteString("ee")
+	return buf.Bytes()
+}
+
+// Finds the announce URL and the infohash with the token API.
+func scanTorrent(data []byte) (announce string, infoHash [20]byte, err error) {
+	d := NewDecoder(bytes.NewReader(data))
+	if _, err = d.NextToken(); err != nil {
+		return
+	}
+	for {
+		var tok Token
+		tok, err = d.NextToken()
+		if err != nil || tok.Kind == DictEnd {
+			return
+		}
+		switch string(tok.Bytes) {
+		case "announce":
+			tok, err = d.NextToken()
+			announce = string(tok.Bytes)
+		case "info":
+			start := d.Offset
+			err = d.SkipValue()
+			infoHash = sha1.Sum(data[start:d.Offset])
+		default:
+			err = d.SkipValue()
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func TestScanTorrent(t *testing.T) {
+	data := largeTorrent(1000)
+	announce, infoHash, err := scanTorrent(data)
+	require.NoError(t, err)
+	assert.Equal(t, "http://tracker.example.com/announce", announce)
+	var mi struct {
+		Info RawMessage `bencode:"info"`
+	}
+	require.NoError(t, Unmarshal(data, &mi))
+	assert.Equal(t, sha1.Sum(mi.Info), infoHash)
+}
+
+// Extracting the announce URL and infohash from a 50 MB torrent, by scanning tokens and by decoding
+// everything.
+func BenchmarkScanTorrent(b *testing.B) {
+	data := largeTorrent(50 << 20)
+	b.Run("Tokens", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(int64(len(data)))
+		for i := 0; i < b.N; i++ {
+			if _, _, err := scanTorrent(data); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("Decode", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(int64(len(data)))
+		for i := 0; i < b.N; i++ {
+			var mi struct {
+				Announce string `bencode:"announce"`
+				Info     struct {
+					Files []struct {
+						Length int64    `bencode:"length"`
+						Path   []string `bencode:"path"`
+					} `bencode:"files"`
+					Name        string `bencode:"name"`
+					PieceLength int64  `bencode:"piece length"`
+					Pieces      []byte `bencode:"pieces"`
+				} `bencode:"info"`
+			}
+			if err := NewDecoder(bytes.NewReader(data)).Decode(&mi); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
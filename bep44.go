@@ -0,0 +1,115 @@
+package torrent
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/anacrolix/log"
+
+	"github.com/anacrolix/torrent/bep44"
+)
+
+// How long DhtRepublish waits to try again after putting an item fails.
+const dhtPutRetryDelay = time.Minute
+
+// Puts the item in the DHT through each of the client's DHT servers, returning how many nodes
+// stored it. Nodes drop items bep44.Expiry after they were put, so items have to be put again to
+// last, as DhtRepublish does.
+func (cl *Client) DhtPut(ctx context.Context, item *bep44.Item) (stored int, err error) {
+	if len(cl.dhtItemServers) == 0 {
+		return 0, errors.New("no DHT servers")
+	}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, s := range cl.dhtItemServers {
+		wg.Add(1)
+		go func(s *bep44.Server) {
+			defer wg.Done()
+			n, putErr := s.Put(ctx, item)
+			mu.Lock()
+			defer mu.Unlock()
+			stored += n
+			if putErr != nil && err == nil {
+				err = putErr
+			}
+		}(s)
+	}
+	wg.Wait()
+	if stored != 0 {
+		err = nil
+	}
+	return
+}
+
+// Gets the item at the target from the DHT, through each of the client's DHT servers. The salt is
+// that of the mutable item sought, as it's needed to verify the item. Of the mutable items found,
+// the one with the highest sequence number is returned. The error is bep44.ErrNotFound if the
+// nodes didn't have the item.
+func (cl *Client) DhtGet(ctx context.Context, target bep44.Target, salt []byte) (*bep44.Item, error) {
+	if len(cl.dhtItemServers) == 0 {
+		return nil, errors.New("no DHT servers")
+	}
+	var (
+		mu   sync.Mutex
+		wg   sync.WaitGroup
+		best *bep44.Item
+		err  error
+	)
+	for _, s := range cl.dhtItemServers {
+		wg.Add(1)
+		go func(s *bep44.Server) {
+			defer wg.Done()
+			i, getErr := s.Get(ctx, target, salt)
+			mu.Lock()
+			defer mu.Unlock()
+			if getErr != nil {
+				if err == nil || errors.Is(getErr, bep44.ErrNotFound) {
+					err = getErr
+				}
+			} else if best == nil || i.Seq > best.Seq {
+				best = i
+			}
+		}(s)
+	}
+	wg.Wait()
+	if best != nil {
+		return best, nil
+	}
+	return nil, err
+}
+
+// Puts the item in the DHT, and again every bep44.RepublishInterval so that it doesn't expire,
+// until stop is called or the client is closed. Failed puts are logged, and retried sooner.
+func (cl *Client) DhtRepublish(item *bep44.Item) (stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-cl.Closed():
+			cancel()
+		}
+	}()
+	go func() {
+		for {
+			delay := bep44.RepublishInterval
+			stored, err := cl.DhtPut(ctx, item)
+			if ctx.Err() != nil {
+				return
+			}
+			if err != nil {
+				cl.logger.WithDefaultLevel(log.Warning).Printf("error putting DHT item %v: %v", item.Target(), err)
+				delay = dhtPutRetryDelay
+			} else {
+				cl.logger.WithDefaultLevel(log.Debug).Printf("put DHT item %v to %v nodes", item.Target(), stored)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(delay):
+			}
+		}
+	}()
+	return cancel
+}
@@ -0,0 +1,136 @@
+// Package bep44 implements BEP 44, storing arbitrary data in the DHT. Immutable items are addressed
+// by the SHA-1 of their value. Mutable items are addressed by an ed25519 public key and an optional
+// salt, and can be replaced by items with a higher sequence number, signed by the same key.
+package bep44
+
+import (
+	"crypto/ed25519"
+	"crypto/sha1"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/anacrolix/dht/v2/krpc"
+
+	"github.com/anacrolix/torrent/bencode"
+)
+
+const (
+	// The longest bencoded value that nodes will store.
+	MaxValueLen = 1000
+	MaxSaltLen  = 64
+	// How long nodes keep items after they were last put.
+	Expiry = 2 * time.Hour
+	// How often DHT items should be put again, so that they don't expire.
+	RepublishInterval = time.Hour
+)
+
+// The errors that nodes reply with when they won't store an item.
+var (
+	ErrValueTooBig        = krpc.Error{Code: krpc.ErrorCodeMessageValueFieldTooBig, Msg: "message (v field) too big"}
+	ErrInvalidSignature   = krpc.Error{Code: krpc.ErrorCodeInvalidSignature, Msg: "invalid signature"}
+	ErrSaltTooBig         = krpc.Error{Code: krpc.ErrorCodeSaltFieldTooBig, Msg: "salt (salt field) too big"}
+	ErrCasMismatch        = krpc.Error{Code: krpc.ErrorCodeCasHashMismatched, Msg: "the CAS hash mismatched, re-read value and try again"}
+	ErrSeqLessThanCurrent = krpc.Error{Code: krpc.ErrorCodeSequenceNumberLessThanCurrent, Msg: "sequence number less than current"}
+)
+
+// The key an item is stored under in the DHT.
+type Target [20]byte
+
+func (t Target) String() string {
+	return fmt.Sprintf("%x", t[:])
+}
+
+// Returns the target of an immutable item with the bencoded value v.
+func ImmutableTarget(v []byte) Target {
+	return sha1.Sum(v)
+}
+
+// Returns the target of the mutable items with the public key k and the salt.
+func MutableTarget(k [32]byte, salt []byte) Target {
+	return sha1.Sum(append(k[:], salt...))
+}
+
+// An item stored in the DHT. Mutable items have a public key.
+type Item struct {
+	// The bencoded value.
+	V bencode.RawMessage
+	// The ed25519 public key of mutable items. Zero for immutable items.
+	K    [32]byte
+	Salt []byte
+	Seq  int64
+	Sig  [64]byte
+	// For puts of mutable items, if non-zero, the sequence number that the item being replaced must
+	// have, to avoid overwriting items that were put concurrently.
+	Cas int64
+}
+
+// Returns an immutable item with the value v, which is bencoded.
+func NewImmutable(v interface{}) (*Item, error) {
+	b, err := bencode.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	i := &Item{V: b}
+	return i, i.Check()
+}
+
+// Returns a mutable item with the value v, which is bencoded, signed with key.
+func NewMutable(v interface{}, seq int64, salt []byte, key ed25519.PrivateKey) (*Item, error) {
+	b, err := bencode.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	i := &Item{V: b, Salt: salt, Seq: seq}
+	copy(i.K[:], key.Public().(ed25519.PublicKey))
+	copy(i.Sig[:], ed25519.Sign(key, i.signedBuffer()))
+	return i, i.Check()
+}
+
+func (i *Item) IsMutable() bool {
+	return i.K != [32]byte{}
+}
+
+func (i *Item) Target() Target {
+	if i.IsMutable() {
+		return MutableTarget(i.K, i.Salt)
+	}
+	return ImmutableTarget(i.V)
+}
+
+// Returns an error if nodes won't store the item, because it's too big, or for mutable items, the
+// signature isn't valid.
+func (i *Item) Check() error {
+	if len(i.V) == 0 {
+		return krpc.Error{Code: krpc.ErrorCodeProtocolError, Msg: "no value"}
+	}
+	if len(i.V) > MaxValueLen {
+		return ErrValueTooBig
+	}
+	if !i.IsMutable() {
+		return nil
+	}
+	if len(i.Salt) > MaxSaltLen {
+		return ErrSaltTooBig
+	}
+	if !ed25519.Verify(i.K[:], i.signedBuffer(), i.Sig[:]) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// What's signed for mutable items: the salt, sequence number and value, as they'd be bencoded in a
+// dict, without the surrounding "d" and "e".
+func (i *Item) signedBuffer() []byte {
+	var b []byte
+	if len(i.Salt) != 0 {
+		b = append(b, "4:salt"...)
+		b = strconv.AppendInt(b, int64(len(i.Salt)), 10)
+		b = append(b, ':')
+		b = append(b, i.Salt...)
+	}
+	b = append(b, "3:seqi"...)
+	b = strconv.AppendInt(b, i.Seq, 10)
+	b = append(b, "e1:v"...)
+	return append(b, i.V...)
+}
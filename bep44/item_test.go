@@ -0,0 +1,70 @@
+package bep44
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/anacrolix/torrent/bencode"
+)
+
+func unhex(c *qt.C, s string) []byte {
+	b, err := hex.DecodeString(s)
+	c.Assert(err, qt.IsNil)
+	return b
+}
+
+// The test vectors from BEP 44.
+func TestItemTestVectors(t *testing.T) {
+	c := qt.New(t)
+	immutable, err := NewImmutable("Hello World!")
+	c.Assert(err, qt.IsNil)
+	c.Check(immutable.Target().String(), qt.Equals, "e5f96f6f38320f0f33959cb4d3d656452117aadb")
+
+	for _, tc := range []struct {
+		salt, sig, target string
+	}{
+		{"", "305ac8aeb6c9c151fa120f120ea2cfb923564e11552d06a5d856091e5e853cff1260d3f39e4999684aa92eb73ffd136e6f4f3ecbfda0ce53a1608ecd7ae21f01", "4a533d47ec9c7d95b1ad75f576cffc641853b750"},
+		{"foobar", "6834284b6b24c3204eb2fea824d82f88883a3d95e8b4a21b8c0ded553d17d17ddf9a8a7104b1258f30bed3787e6cb896fca78c58f8e03b5f18f14951a87d9a08", "411eba73b6f087ca51a3795d9c8c938d365e32c1"},
+	} {
+		i := Item{V: bencode.MustMarshal("Hello World!"), Salt: []byte(tc.salt), Seq: 1}
+		copy(i.K[:], unhex(c, "77ff84905a91936367c01360803104f92432fcd904a43511876df5cdf3e7e548"))
+		copy(i.Sig[:], unhex(c, tc.sig))
+		c.Check(i.Check(), qt.IsNil, qt.Commentf("%q", tc.salt))
+		c.Check(i.Target().String(), qt.Equals, tc.target)
+		i.Seq++
+		c.Check(i.Check(), qt.Equals, ErrInvalidSignature)
+	}
+}
+
+func TestNewMutable(t *testing.T) {
+	c := qt.New(t)
+	_, key, err := ed25519.GenerateKey(nil)
+	c.Assert(err, qt.IsNil)
+	i, err := NewMutable(map[string]int{"a": 1}, 2, []byte("salt"), key)
+	c.Assert(err, qt.IsNil)
+	c.Check(i.IsMutable(), qt.IsTrue)
+	c.Check(string(i.V), qt.Equals, "d1:ai1ee")
+	c.Check(i.Target(), qt.Equals, MutableTarget(i.K, []byte("salt")))
+	c.Check(i.Target(), qt.Not(qt.Equals), MutableTarget(i.K, nil))
+
+	// Everything that's signed is verified.
+	for _, tamper := range []func(*Item){
+		func(i *Item) { i.V = bencode.MustMarshal(map[string]int{"a": 2}) },
+		func(i *Item) { i.Salt = nil },
+		func(i *Item) { i.Seq = 3 },
+		func(i *Item) { i.Sig[0]++ },
+		func(i *Item) { i.K[0]++ },
+	} {
+		tampered := *i
+		tamper(&tampered)
+		c.Check(tampered.Check(), qt.Equals, ErrInvalidSignature)
+	}
+
+	_, err = NewMutable("a", 1, make([]byte, MaxSaltLen+1), key)
+	c.Check(err, qt.Equals, ErrSaltTooBig)
+	_, err = NewImmutable(string(make([]byte, MaxValueLen)))
+	c.Check(err, qt.Equals, ErrValueTooBig)
+}
@@ -0,0 +1,76 @@
+package bep44
+
+import (
+	"github.com/anacrolix/dht/v2/krpc"
+
+	"github.com/anacrolix/torrent/bencode"
+)
+
+// A KRPC message with the BEP 44 fields, that krpc.Msg doesn't have.
+type msg struct {
+	T string      `bencode:"t"`
+	Y string      `bencode:"y"`
+	Q string      `bencode:"q,omitempty"`
+	A *msgArgs    `bencode:"a,omitempty"`
+	R *msgReturn  `bencode:"r,omitempty"`
+	E *krpc.Error `bencode:"e,omitempty"`
+	// BEP 43: the sender doesn't reply to queries.
+	ReadOnly bool `bencode:"ro,omitempty"`
+}
+
+type msgArgs struct {
+	ID     krpc.ID  `bencode:"id"`
+	Target *krpc.ID `bencode:"target,omitempty"`
+	Token  string   `bencode:"token,omitempty"`
+	// For gets, only mutable items with a greater sequence number are wanted.
+	Seq  *int64             `bencode:"seq,omitempty"`
+	Cas  int64              `bencode:"cas,omitempty"`
+	K    []byte             `bencode:"k,omitempty"`
+	Salt []byte             `bencode:"salt,omitempty"`
+	Sig  []byte             `bencode:"sig,omitempty"`
+	V    bencode.RawMessage `bencode:"v,omitempty"`
+}
+
+type msgReturn struct {
+	ID     krpc.ID                  `bencode:"id"`
+	Token  string                   `bencode:"token,omitempty"`
+	Nodes  krpc.CompactIPv4NodeInfo `bencode:"nodes,omitempty"`
+	Nodes6 krpc.CompactIPv6NodeInfo `bencode:"nodes6,omitempty"`
+	K      []byte                   `bencode:"k,omitempty"`
+	Seq    *int64                   `bencode:"seq,omitempty"`
+	Sig    []byte                   `bencode:"sig,omitempty"`
+	V      bencode.RawMessage       `bencode:"v,omitempty"`
+}
+
+// Returns the item being put. It's checked when it's stored.
+func (a *msgArgs) item() (*Item, error) {
+	i := &Item{V: a.V, Salt: a.Salt, Cas: a.Cas}
+	if len(a.K) == 0 {
+		return i, nil
+	}
+	if len(a.K) != len(i.K) || len(a.Sig) != len(i.Sig) || a.Seq == nil {
+		return nil, krpc.Error{Code: krpc.ErrorCodeProtocolError, Msg: "bad mutable item"}
+	}
+	copy(i.K[:], a.K)
+	copy(i.Sig[:], a.Sig)
+	i.Seq = *a.Seq
+	return i, nil
+}
+
+// Returns the item in the reply, if it's valid and at the target.
+func (r *msgReturn) item(target Target, salt []byte) (*Item, bool) {
+	if len(r.V) == 0 {
+		return nil, false
+	}
+	i := &Item{V: r.V}
+	if len(r.K) != 0 {
+		if len(r.K) != len(i.K) || len(r.Sig) != len(i.Sig) || r.Seq == nil {
+			return nil, false
+		}
+		copy(i.K[:], r.K)
+		copy(i.Sig[:], r.Sig)
+		i.Salt = salt
+		i.Seq = *r.Seq
+	}
+	return i, i.Target() == target && i.Check() == nil
+}
@@ -0,0 +1,512 @@
+package bep44
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/binary"
+	"errors"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/anacrolix/dht/v2/krpc"
+	"github.com/anacrolix/missinggo"
+
+	"github.com/anacrolix/torrent/bencode"
+)
+
+const (
+	// How many of the nodes closest to a target items are put to, and are returned in get replies.
+	k = 8
+	// How many get queries a traversal has outstanding.
+	alpha              = 3
+	queryTimeout       = 10 * time.Second
+	tokenRotationDelay = 5 * time.Minute
+)
+
+// Returned by Server.Get when none of the nodes closest to the target have the item.
+var ErrNotFound = errors.New("item not found")
+
+// What a Server needs of the DHT server that it shares a conn with. *dht.Server has these.
+type Table interface {
+	ID() [20]byte
+	// The nodes in the routing table.
+	Nodes() []krpc.NodeInfo
+}
+
+// Serves and sends the BEP 44 get and put queries for a DHT server that doesn't support them. The
+// DHT server is given the conn returned by Conn, through which the Server takes the queries and
+// replies that are its own. Items put by other nodes are kept in a Store, which can be shared by
+// Servers.
+type Server struct {
+	conn  net.PacketConn
+	store *Store
+
+	mu            sync.Mutex
+	table         Table
+	transactions  map[transactionKey]chan msg
+	nextT         uint16
+	tokenSecrets  [2][20]byte
+	tokensRotated time.Time
+	readOnly      bool
+}
+
+type transactionKey struct {
+	t    string
+	addr string
+}
+
+func NewServer(conn net.PacketConn, store *Store) *Server {
+	s := &Server{
+		conn:          conn,
+		store:         store,
+		transactions:  make(map[transactionKey]chan msg),
+		tokensRotated: time.Now(),
+	}
+	for i := range s.tokenSecrets {
+		rand.Read(s.tokenSecrets[i][:])
+	}
+	return s
+}
+
+// Sets the DHT server that the Server shares its conn with. Queries aren't served or sent until
+// it's set.
+func (s *Server) SetTable(t Table) {
+	s.mu.Lock()
+	s.table = t
+	s.mu.Unlock()
+}
+
+// Sets whether the Server is a read-only node per BEP 43: queries aren't served, and those sent say
+// so, so that other nodes don't add ours to their routing tables.
+func (s *Server) SetReadOnly(readOnly bool) {
+	s.mu.Lock()
+	s.readOnly = readOnly
+	s.mu.Unlock()
+}
+
+// Returns the conn to give the DHT server. The get and put queries and the replies to the Server's
+// queries that are read from it are handled, and not returned.
+func (s *Server) Conn() net.PacketConn {
+	return serverConn{s.conn, s}
+}
+
+type serverConn struct {
+	net.PacketConn
+	s *Server
+}
+
+func (me serverConn) ReadFrom(b []byte) (n int, addr net.Addr, err error) {
+	for {
+		n, addr, err = me.PacketConn.ReadFrom(b)
+		if err != nil || !me.s.handlePacket(b[:n], addr) {
+			return
+		}
+	}
+}
+
+// Handles the packet if it's a get or put query, or a reply to one of ours. Returns whether it was
+// handled.
+func (s *Server) handlePacket(b []byte, addr net.Addr) bool {
+	y, err := bencode.GetString(b, "y")
+	if err != nil || len(y) != 1 {
+		return false
+	}
+	switch y[0] {
+	case 'q':
+		q, err := bencode.GetString(b, "q")
+		if err != nil || string(q) != "get" && string(q) != "put" {
+			return false
+		}
+		var m msg
+		if bencode.Unmarshal(b, &m) == nil && m.A != nil {
+			s.handleQuery(m, addr)
+		}
+		return true
+	case 'r', 'e':
+		t, err := bencode.GetString(b, "t")
+		if err != nil || !isOurTransactionId(t) {
+			return false
+		}
+		var m msg
+		if bencode.Unmarshal(b, &m) != nil {
+			return true
+		}
+		key := transactionKey{m.T, addr.String()}
+		s.mu.Lock()
+		ch, ok := s.transactions[key]
+		delete(s.transactions, key)
+		s.mu.Unlock()
+		if ok {
+			ch <- m
+		}
+		return true
+	}
+	return false
+}
+
+func (s *Server) handleQuery(m msg, addr net.Addr) {
+	s.mu.Lock()
+	table := s.table
+	readOnly := s.readOnly
+	s.mu.Unlock()
+	if table == nil || readOnly {
+		return
+	}
+	r := msgReturn{ID: table.ID()}
+	switch m.Q {
+	case "get":
+		if m.A.Target == nil {
+			s.replyError(m.T, addr, krpc.Error{Code: krpc.ErrorCodeProtocolError, Msg: "no target"})
+			return
+		}
+		target := Target(*m.A.Target)
+		r.Token = s.token(addr)
+		for _, ni := range closestNodes(table.Nodes(), target) {
+			if ni.Addr.IP.To4() != nil {
+				r.Nodes = append(r.Nodes, ni)
+			} else {
+				r.Nodes6 = append(r.Nodes6, ni)
+			}
+		}
+		if i, ok := s.store.Get(target); ok && (m.A.Seq == nil || i.Seq > *m.A.Seq) {
+			r.V = i.V
+			if i.IsMutable() {
+				r.K = i.K[:]
+				r.Sig = i.Sig[:]
+				r.Seq = &i.Seq
+			}
+		}
+	case "put":
+		if !s.validToken(m.A.Token, addr) {
+			s.replyError(m.T, addr, krpc.Error{Code: krpc.ErrorCodeProtocolError, Msg: "bad token"})
+			return
+		}
+		i, err := m.A.item()
+		if err == nil {
+			err = s.store.Put(i)
+		}
+		if err != nil {
+			s.replyError(m.T, addr, err)
+			return
+		}
+	}
+	s.write(msg{T: m.T, Y: "r", R: &r}, addr)
+}
+
+func (s *Server) replyError(t string, addr net.Addr, err error) {
+	kerr, ok := err.(krpc.Error)
+	if !ok {
+		kerr = krpc.Error{Code: krpc.ErrorCodeServerError, Msg: err.Error()}
+	}
+	s.write(msg{T: t, Y: "e", E: &kerr}, addr)
+}
+
+func (s *Server) write(m msg, addr net.Addr) error {
+	b, err := bencode.Marshal(m)
+	if err != nil {
+		return err
+	}
+	_, err = s.conn.WriteTo(b, addr)
+	return err
+}
+
+// Tokens are a hash of a secret and the querier's IP. The secrets are replaced periodically, and
+// tokens from the previous secret are still valid, so tokens last at least tokenRotationDelay.
+func (s *Server) token(addr net.Addr) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rotateTokenSecrets()
+	return tokenFor(s.tokenSecrets[0], addr)
+}
+
+func (s *Server) validToken(token string, addr net.Addr) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rotateTokenSecrets()
+	for _, secret := range s.tokenSecrets {
+		if token == tokenFor(secret, addr) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) rotateTokenSecrets() {
+	since := time.Since(s.tokensRotated)
+	if since < tokenRotationDelay {
+		return
+	}
+	s.tokenSecrets[1] = s.tokenSecrets[0]
+	if since >= 2*tokenRotationDelay {
+		rand.Read(s.tokenSecrets[1][:])
+	}
+	rand.Read(s.tokenSecrets[0][:])
+	s.tokensRotated = time.Now()
+}
+
+func tokenFor(secret [20]byte, addr net.Addr) string {
+	h := sha1.New()
+	h.Write(secret[:])
+	h.Write(missinggo.AddrIP(addr))
+	return string(h.Sum(nil)[:8])
+}
+
+// Our transaction IDs are 3 bytes starting with 'b'. The DHT server's are uvarints, which can't be
+// longer than a byte if the first byte is less than 0x80.
+func (s *Server) nextTransactionId() string {
+	var b [3]byte
+	b[0] = 'b'
+	binary.BigEndian.PutUint16(b[1:], s.nextT)
+	s.nextT++
+	return string(b[:])
+}
+
+func isOurTransactionId(t []byte) bool {
+	return len(t) == 3 && t[0] == 'b'
+}
+
+func (s *Server) query(ctx context.Context, addr net.Addr, q string, a msgArgs) (*msgReturn, error) {
+	s.mu.Lock()
+	if s.table == nil {
+		s.mu.Unlock()
+		return nil, errors.New("no DHT server")
+	}
+	a.ID = s.table.ID()
+	readOnly := s.readOnly
+	key := transactionKey{s.nextTransactionId(), addr.String()}
+	ch := make(chan msg, 1)
+	s.transactions[key] = ch
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.transactions, key)
+		s.mu.Unlock()
+	}()
+	if err := s.write(msg{T: key.t, Y: "q", Q: q, A: &a, ReadOnly: readOnly}, addr); err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+	select {
+	case m := <-ch:
+		if m.Y == "e" {
+			if m.E == nil {
+				return nil, errors.New("error reply has no error")
+			}
+			return nil, *m.E
+		}
+		if m.R == nil {
+			return nil, errors.New("reply has no return")
+		}
+		return m.R, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// A node that replied to a get query.
+type contact struct {
+	addr  *net.UDPAddr
+	id    [20]byte
+	token string
+}
+
+type traversalNode struct {
+	krpc.NodeInfo
+	queried bool
+	failed  bool
+}
+
+// Sends get queries to the nodes closest to the target, learning closer nodes from the replies,
+// until the k closest known nodes have replied or failed. onReturn is called with each reply.
+// Returns the closest k nodes that replied with a token.
+func (s *Server) traverse(ctx context.Context, target Target, onReturn func(*msgReturn)) ([]contact, error) {
+	s.mu.Lock()
+	table := s.table
+	s.mu.Unlock()
+	if table == nil {
+		return nil, errors.New("no DHT server")
+	}
+	ourId := table.ID()
+	var nodes []*traversalNode
+	seen := make(map[string]bool)
+	addNode := func(ni krpc.NodeInfo) {
+		addr := ni.Addr.String()
+		if ni.ID == ourId || ni.Addr.Port == 0 || seen[addr] {
+			return
+		}
+		seen[addr] = true
+		nodes = append(nodes, &traversalNode{NodeInfo: ni})
+	}
+	for _, ni := range table.Nodes() {
+		addNode(ni)
+	}
+	if len(nodes) == 0 {
+		return nil, errors.New("no nodes to start from")
+	}
+	type result struct {
+		node *traversalNode
+		r    *msgReturn
+		err  error
+	}
+	results := make(chan result)
+	inFlight := 0
+	var contacts []contact
+	krpcTarget := krpc.ID(target)
+	for {
+		sort.Slice(nodes, func(i, j int) bool {
+			return closer(nodes[i].ID, nodes[j].ID, target)
+		})
+		live := 0
+		for _, n := range nodes {
+			if live == k || inFlight == alpha {
+				break
+			}
+			if n.failed {
+				continue
+			}
+			live++
+			if n.queried {
+				continue
+			}
+			n.queried = true
+			inFlight++
+			go func(n *traversalNode) {
+				r, err := s.query(ctx, n.Addr.UDP(), "get", msgArgs{Target: &krpcTarget})
+				results <- result{n, r, err}
+			}(n)
+		}
+		if inFlight == 0 {
+			break
+		}
+		res := <-results
+		inFlight--
+		if res.err != nil {
+			res.node.failed = true
+			continue
+		}
+		for _, ni := range res.r.Nodes {
+			addNode(ni)
+		}
+		for _, ni := range res.r.Nodes6 {
+			addNode(ni)
+		}
+		if res.r.Token != "" {
+			contacts = append(contacts, contact{res.node.Addr.UDP(), res.node.ID, res.r.Token})
+		}
+		onReturn(res.r)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	sort.Slice(contacts, func(i, j int) bool {
+		return closer(contacts[i].id, contacts[j].id, target)
+	})
+	if len(contacts) > k {
+		contacts = contacts[:k]
+	}
+	return contacts, nil
+}
+
+// Finds the item at the target. The salt is that of the mutable item sought, which is needed to
+// verify it. Of the mutable items that are found, including any in our Store, the one with the
+// highest sequence number is returned.
+func (s *Server) Get(ctx context.Context, target Target, salt []byte) (*Item, error) {
+	var best *Item
+	if i, ok := s.store.Get(target); ok && bytes.Equal(i.Salt, salt) {
+		best = &i
+	}
+	_, err := s.traverse(ctx, target, func(r *msgReturn) {
+		i, ok := r.item(target, salt)
+		if ok && (best == nil || i.Seq > best.Seq) {
+			best = i
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	if best == nil {
+		return nil, ErrNotFound
+	}
+	return best, nil
+}
+
+// Puts the item to the k nodes closest to its target that reply, returning how many stored it. If
+// none did, the error is one of the nodes' refusals, if there were any.
+func (s *Server) Put(ctx context.Context, i *Item) (stored int, err error) {
+	if err := i.Check(); err != nil {
+		return 0, err
+	}
+	contacts, err := s.traverse(ctx, i.Target(), func(*msgReturn) {})
+	if err != nil {
+		return 0, err
+	}
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		refusal error
+	)
+	for _, c := range contacts {
+		a := i.putArgs()
+		a.Token = c.token
+		wg.Add(1)
+		go func(c contact) {
+			defer wg.Done()
+			_, err := s.query(ctx, c.addr, "put", a)
+			mu.Lock()
+			defer mu.Unlock()
+			if err == nil {
+				stored++
+			} else if _, ok := err.(krpc.Error); ok || refusal == nil {
+				refusal = err
+			}
+		}(c)
+	}
+	wg.Wait()
+	if stored != 0 {
+		return stored, nil
+	}
+	if refusal == nil {
+		refusal = errors.New("no nodes to put to")
+	}
+	return 0, refusal
+}
+
+func (i *Item) putArgs() msgArgs {
+	a := msgArgs{V: i.V}
+	if i.IsMutable() {
+		seq := i.Seq
+		a.K = i.K[:]
+		a.Sig = i.Sig[:]
+		a.Salt = i.Salt
+		a.Seq = &seq
+		a.Cas = i.Cas
+	}
+	return a
+}
+
+// Returns the closest k nodes to the target.
+func closestNodes(nodes []krpc.NodeInfo, target Target) []krpc.NodeInfo {
+	sort.Slice(nodes, func(i, j int) bool {
+		return closer(nodes[i].ID, nodes[j].ID, target)
+	})
+	if len(nodes) > k {
+		nodes = nodes[:k]
+	}
+	return nodes
+}
+
+// Whether a is closer to the target than b, by XOR distance.
+func closer(a, b [20]byte, target Target) bool {
+	for i := range target {
+		da, db := a[i]^target[i], b[i]^target[i]
+		if da != db {
+			return da < db
+		}
+	}
+	return false
+}
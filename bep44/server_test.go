@@ -0,0 +1,218 @@
+package bep44
+
+import (
+	"context"
+	"crypto/ed25519"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/anacrolix/dht/v2"
+	"github.com/anacrolix/dht/v2/krpc"
+	qt "github.com/frankban/quicktest"
+
+	"github.com/anacrolix/torrent/bencode"
+)
+
+type testNode struct {
+	*Server
+	dht   *dht.Server
+	store *Store
+}
+
+var (
+	testNodesOnce sync.Once
+	testNodes     []testNode
+	testNodesErr  error
+)
+
+// Returns DHT servers on loopback, that all know of the first. They're shared by the tests, and not
+// closed, as closing a dht.Server makes its questionable node pinger spin.
+func testNetwork(c *qt.C) []testNode {
+	testNodesOnce.Do(func() {
+		testNodes, testNodesErr = startTestNetwork(12)
+	})
+	c.Assert(testNodesErr, qt.IsNil)
+	return testNodes
+}
+
+func startTestNetwork(n int) (nodes []testNode, err error) {
+	for i := 0; i < n; i++ {
+		pc, err := net.ListenPacket("udp4", "127.0.0.1:0")
+		if err != nil {
+			return nil, err
+		}
+		store := new(Store)
+		s := NewServer(pc, store)
+		ds, err := dht.NewServer(&dht.ServerConfig{
+			Conn:       s.Conn(),
+			NoSecurity: true,
+			StartingNodes: func() ([]dht.Addr, error) {
+				return nil, nil
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+		s.SetTable(ds)
+		nodes = append(nodes, testNode{s, ds, store})
+	}
+	for _, n := range nodes[1:] {
+		if res := n.dht.Ping(nodes[0].dht.Addr().(*net.UDPAddr)); res.Err != nil {
+			return nil, res.Err
+		}
+	}
+	return
+}
+
+func testContext(c *qt.C) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	c.Cleanup(cancel)
+	return ctx
+}
+
+func TestPutGetImmutable(t *testing.T) {
+	c := qt.New(t)
+	nodes := testNetwork(c)
+	ctx := testContext(c)
+	i, err := NewImmutable("Hello World!")
+	c.Assert(err, qt.IsNil)
+	stored, err := nodes[1].Put(ctx, i)
+	c.Assert(err, qt.IsNil)
+	c.Check(stored, qt.Equals, k)
+	storing := 0
+	for _, n := range nodes {
+		if _, ok := n.store.Get(i.Target()); ok {
+			storing++
+		}
+	}
+	c.Check(storing, qt.Equals, k)
+
+	got, err := nodes[len(nodes)-1].Get(ctx, i.Target(), nil)
+	c.Assert(err, qt.IsNil)
+	c.Check(string(got.V), qt.Equals, "12:Hello World!")
+	c.Check(got.IsMutable(), qt.IsFalse)
+
+	_, err = nodes[2].Get(ctx, ImmutableTarget([]byte("1:a")), nil)
+	c.Check(err, qt.Equals, ErrNotFound)
+}
+
+func TestPutGetMutable(t *testing.T) {
+	c := qt.New(t)
+	nodes := testNetwork(c)
+	ctx := testContext(c)
+	_, key, err := ed25519.GenerateKey(nil)
+	c.Assert(err, qt.IsNil)
+	salt := []byte("salt")
+	put := func(v string, seq, cas int64) (int, error) {
+		i, err := NewMutable(v, seq, salt, key)
+		c.Assert(err, qt.IsNil)
+		i.Cas = cas
+		return nodes[1].Put(ctx, i)
+	}
+	stored, err := put("a", 1, 0)
+	c.Assert(err, qt.IsNil)
+	c.Check(stored, qt.Equals, k)
+	stored, err = put("b", 2, 1)
+	c.Assert(err, qt.IsNil)
+	c.Check(stored, qt.Equals, k)
+	_, err = put("c", 3, 1)
+	c.Check(err, qt.Equals, ErrCasMismatch)
+	_, err = put("c", 1, 0)
+	c.Check(err, qt.Equals, ErrSeqLessThanCurrent)
+
+	var pub [32]byte
+	copy(pub[:], key.Public().(ed25519.PublicKey))
+	target := MutableTarget(pub, salt)
+	got, err := nodes[2].Get(ctx, target, salt)
+	c.Assert(err, qt.IsNil)
+	c.Check(string(got.V), qt.Equals, "1:b")
+	c.Check(got.Seq, qt.Equals, int64(2))
+	// Without the salt, the item can't be verified.
+	_, err = nodes[2].Get(ctx, target, nil)
+	c.Check(err, qt.Equals, ErrNotFound)
+}
+
+func TestPutInvalidSignature(t *testing.T) {
+	c := qt.New(t)
+	nodes := testNetwork(c)
+	ctx := testContext(c)
+	_, key, err := ed25519.GenerateKey(nil)
+	c.Assert(err, qt.IsNil)
+	i, err := NewMutable("a", 1, nil, key)
+	c.Assert(err, qt.IsNil)
+	i.Seq = 2
+	_, err = nodes[1].Put(ctx, i)
+	c.Check(err, qt.Equals, ErrInvalidSignature)
+
+	// Nodes check the signature too.
+	addr := nodes[0].dht.Addr()
+	target := krpc.ID(i.Target())
+	r, err := nodes[1].query(ctx, addr, "get", msgArgs{Target: &target})
+	c.Assert(err, qt.IsNil)
+	a := i.putArgs()
+	a.Token = r.Token
+	_, err = nodes[1].query(ctx, addr, "put", a)
+	c.Check(err, qt.Equals, ErrInvalidSignature)
+	a.Token = "bad"
+	_, err = nodes[1].query(ctx, addr, "put", a)
+	c.Check(err, qt.ErrorMatches, ".*bad token")
+	_, ok := nodes[0].store.Get(i.Target())
+	c.Check(ok, qt.IsFalse)
+}
+
+func TestGetIgnoresForgedItems(t *testing.T) {
+	c := qt.New(t)
+	nodes := testNetwork(c)
+	ctx := testContext(c)
+	_, key, err := ed25519.GenerateKey(nil)
+	c.Assert(err, qt.IsNil)
+	i, err := NewMutable("a", 1, nil, key)
+	c.Assert(err, qt.IsNil)
+	stored, err := nodes[1].Put(ctx, i)
+	c.Assert(err, qt.IsNil)
+	c.Assert(stored, qt.Equals, k)
+	// A node returns a higher sequence number that isn't signed.
+	forged := *i
+	forged.V = []byte("1:b")
+	forged.Seq = 2
+	nodes[0].store.putUnchecked(i.Target(), forged)
+	got, err := nodes[1].Get(ctx, i.Target(), nil)
+	c.Assert(err, qt.IsNil)
+	c.Check(string(got.V), qt.Equals, "1:a")
+	// And an immutable item that doesn't match the target.
+	imm, err := NewImmutable("c")
+	c.Assert(err, qt.IsNil)
+	nodes[0].store.putUnchecked(imm.Target(), Item{V: []byte("1:d")})
+	_, err = nodes[1].Get(ctx, imm.Target(), nil)
+	c.Check(err, qt.Equals, ErrNotFound)
+}
+
+func TestReadOnly(t *testing.T) {
+	c := qt.New(t)
+	nodes, err := startTestNetwork(2)
+	c.Assert(err, qt.IsNil)
+	ro := nodes[1]
+	ro.SetReadOnly(true)
+	target := krpc.ID(MutableTarget([32]byte{1}, nil))
+
+	// Queries to it aren't answered.
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err = nodes[0].query(ctx, ro.dht.Addr(), "get", msgArgs{Target: &target})
+	c.Check(err, qt.Equals, context.DeadlineExceeded)
+
+	// Its own queries say that it's read-only.
+	pc, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	c.Assert(err, qt.IsNil)
+	defer pc.Close()
+	go ro.query(ctx, pc.LocalAddr(), "get", msgArgs{Target: &target})
+	b := make([]byte, 0x10000)
+	n, _, err := pc.ReadFrom(b)
+	c.Assert(err, qt.IsNil)
+	var m msg
+	c.Assert(bencode.Unmarshal(b[:n], &m), qt.IsNil)
+	c.Check(m.Q, qt.Equals, "get")
+	c.Check(m.ReadOnly, qt.IsTrue)
+}
@@ -0,0 +1,91 @@
+package bep44
+
+import (
+	"sync"
+	"time"
+
+	"github.com/anacrolix/dht/v2/krpc"
+)
+
+// The most items a Store keeps, so that the memory that other nodes can make us use is bounded.
+const maxStoredItems = 1 << 14
+
+// Keeps the items that other nodes put, until they expire. The zero value is ready to use. Safe for
+// concurrent use.
+type Store struct {
+	mu    sync.Mutex
+	items map[Target]storedItem
+}
+
+type storedItem struct {
+	Item
+	expires time.Time
+}
+
+// Stores the item, after checking it, and that it can replace the item stored at its target, if
+// there is one. Putting an item again keeps it from expiring.
+func (s *Store) Put(i *Item) error {
+	if err := i.Check(); err != nil {
+		return err
+	}
+	target := i.Target()
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if have, ok := s.items[target]; ok && have.expires.After(now) && i.IsMutable() {
+		if i.Cas != 0 && i.Cas != have.Seq {
+			return ErrCasMismatch
+		}
+		if i.Seq < have.Seq {
+			return ErrSeqLessThanCurrent
+		}
+	} else if len(s.items) >= maxStoredItems {
+		s.deleteExpired(now)
+		if len(s.items) >= maxStoredItems {
+			return krpc.Error{Code: krpc.ErrorCodeServerError, Msg: "store full"}
+		}
+	}
+	if s.items == nil {
+		s.items = make(map[Target]storedItem)
+	}
+	item := *i
+	item.V = append(item.V[:0:0], i.V...)
+	item.Salt = append(item.Salt[:0:0], i.Salt...)
+	item.Cas = 0
+	s.items[target] = storedItem{item, now.Add(Expiry)}
+	return nil
+}
+
+// Stores the item at the target without checking either, for tests to store items that other nodes
+// wouldn't have been able to put.
+func (s *Store) putUnchecked(target Target, i Item) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.items == nil {
+		s.items = make(map[Target]storedItem)
+	}
+	s.items[target] = storedItem{i, time.Now().Add(Expiry)}
+}
+
+// Returns the item stored at the target, if there is one that hasn't expired.
+func (s *Store) Get(target Target) (Item, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	have, ok := s.items[target]
+	if !ok {
+		return Item{}, false
+	}
+	if !have.expires.After(time.Now()) {
+		delete(s.items, target)
+		return Item{}, false
+	}
+	return have.Item, true
+}
+
+func (s *Store) deleteExpired(now time.Time) {
+	for target, have := range s.items {
+		if !have.expires.After(now) {
+			delete(s.items, target)
+		}
+	}
+}
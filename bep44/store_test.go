@@ -0,0 +1,55 @@
+package bep44
+
+import (
+	"crypto/ed25519"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestStorePut(t *testing.T) {
+	c := qt.New(t)
+	var s Store
+	_, key, err := ed25519.GenerateKey(nil)
+	c.Assert(err, qt.IsNil)
+	put := func(v string, seq, cas int64) error {
+		i, err := NewMutable(v, seq, nil, key)
+		c.Assert(err, qt.IsNil)
+		i.Cas = cas
+		return s.Put(i)
+	}
+	c.Assert(put("a", 2, 0), qt.IsNil)
+	target := MutableTarget(func() (k [32]byte) {
+		copy(k[:], key.Public().(ed25519.PublicKey))
+		return
+	}(), nil)
+	have, ok := s.Get(target)
+	c.Assert(ok, qt.IsTrue)
+	c.Check(string(have.V), qt.Equals, "1:a")
+
+	c.Check(put("b", 1, 0), qt.Equals, ErrSeqLessThanCurrent)
+	c.Check(put("b", 3, 1), qt.Equals, ErrCasMismatch)
+	c.Check(put("b", 3, 2), qt.IsNil)
+	// Putting the same sequence number again is a refresh.
+	c.Check(put("c", 3, 0), qt.IsNil)
+	have, _ = s.Get(target)
+	c.Check(string(have.V), qt.Equals, "1:c")
+	c.Check(have.Seq, qt.Equals, int64(3))
+
+	// Items with bad signatures aren't stored.
+	i, err := NewMutable("d", 4, nil, key)
+	c.Assert(err, qt.IsNil)
+	i.Sig[0]++
+	c.Check(s.Put(i), qt.Equals, ErrInvalidSignature)
+	have, _ = s.Get(target)
+	c.Check(have.Seq, qt.Equals, int64(3))
+
+	imm, err := NewImmutable("e")
+	c.Assert(err, qt.IsNil)
+	c.Assert(s.Put(imm), qt.IsNil)
+	have, ok = s.Get(ImmutableTarget([]byte("1:e")))
+	c.Check(ok, qt.IsTrue)
+	c.Check(have.IsMutable(), qt.IsFalse)
+	_, ok = s.Get(ImmutableTarget([]byte("1:f")))
+	c.Check(ok, qt.IsFalse)
+}
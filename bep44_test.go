@@ -0,0 +1,59 @@
+package torrent
+
+import (
+	"context"
+	"crypto/ed25519"
+	"net"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/anacrolix/torrent/bep44"
+)
+
+func TestDhtPutGet(t *testing.T) {
+	c := qt.New(t)
+	var clients []*Client
+	for i := 0; i < 3; i++ {
+		cl, err := NewClient(dhtTestingConfig(t))
+		c.Assert(err, qt.IsNil)
+		defer cl.Close()
+		clients = append(clients, cl)
+	}
+	// The others find each other through the first.
+	hub := clients[0].DhtServers()[0].Addr().(*net.UDPAddr)
+	for _, cl := range clients[1:] {
+		cl.DhtServers()[0].Ping(hub)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, key, err := ed25519.GenerateKey(nil)
+	c.Assert(err, qt.IsNil)
+	i, err := bep44.NewMutable("a", 1, nil, key)
+	c.Assert(err, qt.IsNil)
+	stored, err := clients[1].DhtPut(ctx, i)
+	c.Assert(err, qt.IsNil)
+	c.Check(stored, qt.Equals, 2)
+	got, err := clients[2].DhtGet(ctx, i.Target(), nil)
+	c.Assert(err, qt.IsNil)
+	c.Check(string(got.V), qt.Equals, "1:a")
+
+	i, err = bep44.NewMutable("b", 2, nil, key)
+	c.Assert(err, qt.IsNil)
+	stop := clients[1].DhtRepublish(i)
+	defer stop()
+	for {
+		got, err = clients[2].DhtGet(ctx, i.Target(), nil)
+		c.Assert(err, qt.IsNil)
+		if got.Seq == 2 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	c.Check(string(got.V), qt.Equals, "1:b")
+
+	_, err = clients[2].DhtGet(ctx, bep44.ImmutableTarget([]byte("1:c")), nil)
+	c.Check(err, qt.Equals, bep44.ErrNotFound)
+}
@@ -0,0 +1,162 @@
+package torrent
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/anacrolix/log"
+	"github.com/anacrolix/missinggo/v2"
+
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/bep44"
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+// How often MutableTorrents check the DHT for their publisher's updates.
+const mutableTorrentRecheckInterval = 30 * time.Minute
+
+// The value of a BEP 46 DHT item.
+type torrentPointer struct {
+	InfoHash metainfo.Hash `bencode:"ih"`
+}
+
+// Returns the DHT item for a BEP 46 mutable torrent, pointing it at the torrent with the infohash.
+// The magnet link for the mutable torrent has the key's public key and the salt. Put the item with
+// Client.DhtPut or DhtRepublish. To update the pointer, put an item with a higher seq.
+func NewTorrentPointer(ih metainfo.Hash, seq int64, salt []byte, key ed25519.PrivateKey) (*bep44.Item, error) {
+	return bep44.NewMutable(torrentPointer{ih}, seq, salt, key)
+}
+
+// A BEP 46 torrent, found through the public key in its magnet link, that its publisher can update
+// to point to another torrent.
+type MutableTorrent struct {
+	cl     *Client
+	magnet metainfo.Magnet
+	closed missinggo.Event
+
+	mu      sync.Mutex
+	torrent *Torrent
+	seq     int64
+}
+
+// Finds the torrent that the magnet link's public key points to in the DHT, and adds it. The DHT is
+// checked periodically for the publisher's updates, with the Callbacks.MutableTorrentUpdated called
+// when they're added, until the MutableTorrent is closed.
+func (cl *Client) AddMutableTorrent(ctx context.Context, m metainfo.Magnet) (*MutableTorrent, error) {
+	if !m.IsMutable() {
+		return nil, errors.New("magnet link has no public key")
+	}
+	mt := &MutableTorrent{cl: cl, magnet: m}
+	i, err := mt.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := mt.update(i); err != nil {
+		return nil, err
+	}
+	go mt.recheckPeriodically()
+	return mt, nil
+}
+
+// The torrent that the publisher last pointed to.
+func (mt *MutableTorrent) Torrent() *Torrent {
+	mt.mu.Lock()
+	defer mt.mu.Unlock()
+	return mt.torrent
+}
+
+// The sequence number of the DHT item that points to the Torrent.
+func (mt *MutableTorrent) Seq() int64 {
+	mt.mu.Lock()
+	defer mt.mu.Unlock()
+	return mt.seq
+}
+
+// Stops checking for updates. The torrents are left in the Client.
+func (mt *MutableTorrent) Close() {
+	mt.cl.lock()
+	mt.closed.Set()
+	mt.cl.unlock()
+}
+
+// Checks the DHT for an update now, rather than waiting for the periodic check. Returns whether the
+// torrent was updated.
+func (mt *MutableTorrent) Recheck(ctx context.Context) (bool, error) {
+	i, err := mt.get(ctx)
+	if err != nil {
+		return false, err
+	}
+	return mt.update(i)
+}
+
+func (mt *MutableTorrent) recheckPeriodically() {
+	for {
+		select {
+		case <-mt.closed.LockedChan(mt.cl.locker()):
+			return
+		case <-mt.cl.Closed():
+			return
+		case <-time.After(mutableTorrentRecheckInterval):
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		_, err := mt.Recheck(ctx)
+		cancel()
+		if err != nil {
+			mt.cl.logger.WithDefaultLevel(log.Warning).Printf("error checking for mutable torrent update: %v", err)
+		}
+	}
+}
+
+func (mt *MutableTorrent) target() bep44.Target {
+	return bep44.MutableTarget(mt.magnet.PublicKey, mt.magnet.Salt)
+}
+
+func (mt *MutableTorrent) get(ctx context.Context) (*bep44.Item, error) {
+	i, err := mt.cl.DhtGet(ctx, mt.target(), mt.magnet.Salt)
+	if err != nil {
+		return nil, fmt.Errorf("getting DHT item %v: %w", mt.target(), err)
+	}
+	return i, nil
+}
+
+// Switches to the torrent the item points to, if it's signed by the publisher, and is newer than
+// the item that the current torrent came from.
+func (mt *MutableTorrent) update(i *bep44.Item) (bool, error) {
+	if i.K != mt.magnet.PublicKey || !bytes.Equal(i.Salt, mt.magnet.Salt) {
+		return false, errors.New("item isn't the mutable torrent's")
+	}
+	if err := i.Check(); err != nil {
+		return false, err
+	}
+	var tp torrentPointer
+	if err := bencode.Unmarshal(i.V, &tp); err != nil {
+		return false, fmt.Errorf("decoding torrent pointer: %w", err)
+	}
+	mt.mu.Lock()
+	old := mt.torrent
+	if old != nil && i.Seq <= mt.seq {
+		mt.mu.Unlock()
+		return false, nil
+	}
+	spec := torrentSpecFromMagnet(mt.magnet)
+	spec.InfoHash = tp.InfoHash
+	t, _, err := mt.cl.AddTorrentSpec(spec)
+	if err != nil {
+		mt.mu.Unlock()
+		return false, err
+	}
+	mt.torrent = t
+	mt.seq = i.Seq
+	mt.mu.Unlock()
+	if old != nil && old != t {
+		for _, f := range mt.cl.config.Callbacks.MutableTorrentUpdated {
+			f(MutableTorrentUpdatedEvent{mt, old, t, i.Seq})
+		}
+	}
+	return old != t, nil
+}
@@ -0,0 +1,102 @@
+package torrent
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/hex"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/anacrolix/torrent/bep44"
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+func TestMutableTorrent(t *testing.T) {
+	c := qt.New(t)
+	var updates []MutableTorrentUpdatedEvent
+	var clients []*Client
+	for i := 0; i < 3; i++ {
+		cfg := dhtTestingConfig(t)
+		cfg.Callbacks.MutableTorrentUpdated = append(cfg.Callbacks.MutableTorrentUpdated, func(e MutableTorrentUpdatedEvent) {
+			updates = append(updates, e)
+		})
+		cl, err := NewClient(cfg)
+		c.Assert(err, qt.IsNil)
+		defer cl.Close()
+		clients = append(clients, cl)
+	}
+	hub := clients[0].DhtServers()[0].Addr().(*net.UDPAddr)
+	for _, cl := range clients[1:] {
+		cl.DhtServers()[0].Ping(hub)
+	}
+	publisher, consumer := clients[1], clients[2]
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	pub, key, err := ed25519.GenerateKey(nil)
+	c.Assert(err, qt.IsNil)
+	salt := []byte("salt")
+	put := func(ih metainfo.Hash, seq int64) *bep44.Item {
+		i, err := NewTorrentPointer(ih, seq, salt, key)
+		c.Assert(err, qt.IsNil)
+		_, err = publisher.DhtPut(ctx, i)
+		c.Assert(err, qt.IsNil)
+		return i
+	}
+	first := put(metainfo.HashBytes([]byte("first")), 1)
+
+	m, err := metainfo.ParseMagnetUri("magnet:?xs=urn:btpk:" + hex.EncodeToString(pub) + "&s=" + hex.EncodeToString(salt))
+	c.Assert(err, qt.IsNil)
+	mt, err := consumer.AddMutableTorrent(ctx, m)
+	c.Assert(err, qt.IsNil)
+	defer mt.Close()
+	old := mt.Torrent()
+	c.Check(old.InfoHash(), qt.Equals, metainfo.HashBytes([]byte("first")))
+	c.Check(mt.Seq(), qt.Equals, int64(1))
+
+	put(metainfo.HashBytes([]byte("second")), 2)
+	updated, err := mt.Recheck(ctx)
+	c.Assert(err, qt.IsNil)
+	c.Check(updated, qt.IsTrue)
+	c.Check(mt.Torrent().InfoHash(), qt.Equals, metainfo.HashBytes([]byte("second")))
+	c.Check(mt.Seq(), qt.Equals, int64(2))
+	c.Assert(updates, qt.HasLen, 1)
+	c.Check(updates[0].Old, qt.Equals, old)
+	c.Check(updates[0].New, qt.Equals, mt.Torrent())
+	c.Check(updates[0].Seq, qt.Equals, int64(2))
+
+	// Older pointers, such as a node might still return, are ignored.
+	updated, err = mt.update(first)
+	c.Assert(err, qt.IsNil)
+	c.Check(updated, qt.IsFalse)
+	c.Check(mt.Torrent().InfoHash(), qt.Equals, metainfo.HashBytes([]byte("second")))
+	// As are forged ones.
+	forged, err := NewTorrentPointer(metainfo.HashBytes([]byte("forged")), 3, salt, key)
+	c.Assert(err, qt.IsNil)
+	forged.Sig[0]++
+	_, err = mt.update(forged)
+	c.Check(err, qt.Equals, bep44.ErrInvalidSignature)
+	_, otherKey, err := ed25519.GenerateKey(nil)
+	c.Assert(err, qt.IsNil)
+	other, err := NewTorrentPointer(metainfo.HashBytes([]byte("other")), 3, salt, otherKey)
+	c.Assert(err, qt.IsNil)
+	_, err = mt.update(other)
+	c.Check(err, qt.Not(qt.IsNil))
+	c.Check(mt.Seq(), qt.Equals, int64(2))
+	c.Check(updates, qt.HasLen, 1)
+
+	// The salt is part of the target.
+	m.Salt = nil
+	_, err = consumer.AddMutableTorrent(ctx, m)
+	c.Check(errors.Is(err, bep44.ErrNotFound), qt.IsTrue, qt.Commentf("%v", err))
+}
+
+func TestTorrentSpecFromMutableMagnet(t *testing.T) {
+	c := qt.New(t)
+	_, err := TorrentSpecFromMagnetUri("magnet:?xs=urn:btpk:8543d3e6115f0f98c944077a4493dcd543e49c739fd998550a1f614ab36ed63e")
+	c.Check(err, qt.ErrorMatches, ".*AddMutableTorrent")
+}
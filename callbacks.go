@@ -25,6 +25,28 @@ type Callbacks struct {
 	SentRequest        []func(PeerRequestEvent)
 	PeerClosed         []func(*Peer)
 	NewPeer            []func(*Peer)
+	// Called when a tracker fails an announce with a reason that its previous announce didn't, such
+	// as that the torrent isn't registered. The Client lock is held.
+	TrackerFailureReason []func(TrackerFailureReasonEvent)
+	// Called when a mutable torrent's publisher points it at another torrent, which has been added to
+	// the Client. The Client lock isn't held.
+	MutableTorrentUpdated []func(MutableTorrentUpdatedEvent)
+}
+
+type TrackerFailureReasonEvent struct {
+	Torrent    *Torrent
+	TrackerUrl string
+	// Sanitized, but otherwise as the tracker gave it.
+	Reason string
+}
+
+type MutableTorrentUpdatedEvent struct {
+	MutableTorrent *MutableTorrent
+	// The torrent that was pointed to before. It's left in the Client.
+	Old *Torrent
+	New *Torrent
+	// The sequence number of the DHT item that points to New.
+	Seq int64
 }
 
 type ReceivedUsefulDataEvent = PeerMessageEvent
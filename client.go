@@ -11,6 +11,7 @@ import (
 	"io"
 	"net"
 	"net/http"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -38,11 +39,13 @@ import (
 	"github.com/anacrolix/missinggo/v2/conntrack"
 
 	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/bep44"
 	"github.com/anacrolix/torrent/iplist"
 	"github.com/anacrolix/torrent/metainfo"
 	"github.com/anacrolix/torrent/mse"
 	pp "github.com/anacrolix/torrent/peer_protocol"
 	"github.com/anacrolix/torrent/storage"
+	"github.com/anacrolix/torrent/webseed"
 )
 
 // Clients contain zero or more Torrents. A Client manages a blocklist, the
@@ -66,6 +69,17 @@ type Client struct {
 	listeners      []Listener
 	dhtServers     []DhtServer
 	ipBlockList    iplist.Ranger
+	// Incremented when nodes added with AddDhtNodes have been pinged, so DHT announces that failed
+	// for want of nodes can be retried.
+	dhtNodesAdded int
+	// Serve and send BEP 44 queries on the DHT servers' conns, storing items in dhtItems.
+	dhtItemServers []*bep44.Server
+	dhtItems       bep44.Store
+	dhtNodesSaver  dhtNodesSaver
+	// The sockets the anacrolix/dht servers in dhtServers were started on.
+	dhtSockets []*dhtSocket
+	// Whether the DHT is read-only, per BEP 43. Starts as ClientConfig.DhtReadOnly.
+	dhtReadOnly bool
 
 	// Set of addresses that have our client ID. This intentionally will
 	// include ourselves if we end up trying to connect to our own address
@@ -81,6 +95,7 @@ type Client struct {
 	websocketTrackers websocketTrackers
 
 	activeAnnounceLimiter limiter.Instance
+	publicIpReports       publicIpReports
 }
 
 type ipStr string
@@ -126,7 +141,6 @@ func (cl *Client) WriteStatus(_w io.Writer) {
 	fmt.Fprintf(w, "Listen port: %d\n", cl.LocalPort())
 	fmt.Fprintf(w, "Peer ID: %+q\n", cl.PeerID())
 	fmt.Fprintf(w, "Extension bits: %v\n", cl.config.Extensions)
-	fmt.Fprintf(w, "Announce key: %x\n", cl.announceKey())
 	fmt.Fprintf(w, "Banned IPs: %d\n", len(cl.badPeerIPsLocked()))
 	cl.eachDhtServer(func(s DhtServer) {
 		fmt.Fprintf(w, "%s DHT server at %s:\n", s.Addr().Network(), s.Addr().String())
@@ -167,8 +181,17 @@ func (cl *Client) initLogger() {
 	}
 }
 
-func (cl *Client) announceKey() int32 {
-	return int32(binary.BigEndian.Uint32(cl.peerID[16:20]))
+// Returns a random tracker announce key. Zero isn't returned, so it can mean unset.
+func newAnnounceKey() int32 {
+	var b [4]byte
+	for {
+		if _, err := rand.Read(b[:]); err != nil {
+			panic(err)
+		}
+		if key := int32(binary.BigEndian.Uint32(b[:])); key != 0 {
+			return key
+		}
+	}
 }
 
 func NewClient(cfg *ClientConfig) (cl *Client, err error) {
@@ -242,17 +265,33 @@ func NewClient(cfg *ClientConfig) (cl *Client, err error) {
 	}
 
 	go cl.forwardPort()
+	cl.dhtReadOnly = cfg.DhtReadOnly
 	if !cfg.NoDHT {
+		if cfg.DhtNodesFile != "" {
+			cl.loadDhtNodes()
+		}
 		for _, s := range sockets {
 			if pc, ok := s.(net.PacketConn); ok {
-				ds, err := cl.newAnacrolixDhtServer(pc)
-				if err != nil {
+				is := bep44.NewServer(pc, &cl.dhtItems)
+				sock := &dhtSocket{conn: is.Conn(), items: is}
+				if err := cl.startDhtSocketServer(sock, nil); err != nil {
 					panic(err)
 				}
-				cl.dhtServers = append(cl.dhtServers, anacrolixDhtServerWrapper{ds})
-				cl.onClose = append(cl.onClose, func() { ds.Close() })
+				cl.dhtItemServers = append(cl.dhtItemServers, is)
+				cl.dhtSockets = append(cl.dhtSockets, sock)
+				cl.dhtServers = append(cl.dhtServers, anacrolixDhtServerWrapper{sock.server})
+				cl.onClose = append(cl.onClose, sock.close)
 			}
 		}
+		if cfg.DhtNodesFile != "" {
+			// Closers are run in reverse, so this is before the DHT servers are retired.
+			cl.onClose = append(cl.onClose, func() {
+				if err := cl.saveDhtNodes(cl.dhtServers); err != nil {
+					cl.logger.WithDefaultLevel(log.Warning).Printf("error saving DHT nodes: %v", err)
+				}
+			})
+			go cl.saveDhtNodesPeriodically()
+		}
 	}
 
 	cl.websocketTrackers = websocketTrackers{
@@ -345,17 +384,15 @@ func (cl *Client) listenNetworks() (ns []network) {
 	return
 }
 
-func (cl *Client) newAnacrolixDhtServer(conn net.PacketConn) (s *dht.Server, err error) {
+// Starts a server on conn, with the nodes in its routing table.
+func (cl *Client) newAnacrolixDhtServer(conn *dhtServerConn, nodes []krpc.NodeInfo) (s *dht.Server, err error) {
+	publicIp := cl.dhtPublicIp(conn)
 	cfg := dht.ServerConfig{
-		IPBlocklist:    cl.ipBlockList,
-		Conn:           conn,
-		OnAnnouncePeer: cl.onDHTAnnouncePeer,
-		PublicIP: func() net.IP {
-			if connIsIpv6(conn) && cl.config.PublicIp6 != nil {
-				return cl.config.PublicIp6
-			}
-			return cl.config.PublicIp4
-		}(),
+		IPBlocklist:        cl.ipBlockList,
+		Conn:               conn,
+		OnAnnouncePeer:     cl.onDHTAnnouncePeer,
+		NoSecurity:         cl.config.DhtSecurity == DhtSecurityOff,
+		PublicIP:           publicIp,
 		StartingNodes:      cl.config.DhtStartingNodes(conn.LocalAddr().Network()),
 		ConnectionTracking: cl.config.ConnTracker,
 		OnQuery:            cl.config.DHTOnQuery,
@@ -364,9 +401,18 @@ func (cl *Client) newAnacrolixDhtServer(conn net.PacketConn) (s *dht.Server, err
 	if f := cl.config.ConfigureAnacrolixDhtServer; f != nil {
 		f(&cfg)
 	}
+	cfg.Logger = conn.logger(cfg.Logger)
+	if publicIp != nil && cfg.NodeId == [20]byte{} {
+		// The dht package only secures the ID if NoSecurity isn't set, but others may check it.
+		cfg.NodeId = secureDhtNodeId(publicIp)
+	}
 	s, err = dht.NewServer(&cfg)
 	if err == nil {
+		for _, ni := range nodes {
+			s.AddNode(ni)
+		}
 		go func() {
+			cl.pingSavedDhtNodes(s)
 			ts, err := s.Bootstrap()
 			if err != nil {
 				cl.logger.Printf("error bootstrapping dht: %s", err)
@@ -390,7 +436,8 @@ func (cl *Client) eachDhtServer(f func(DhtServer)) {
 }
 
 // Stops the client. All connections to peers are closed and all activity will
-// come to a halt.
+// come to a halt. Trackers are sent the stopped event in the background, which may not finish if
+// the process exits. See Shutdown.
 func (cl *Client) Close() {
 	cl.lock()
 	defer cl.unlock()
@@ -404,6 +451,77 @@ func (cl *Client) Close() {
 	cl.event.Broadcast()
 }
 
+// Sends the stopped event, with the final uploaded, downloaded and left counts, to the HTTP and UDP
+// trackers of all the torrents, waiting until they're done or ctx is, and then closes the client.
+// progress, if not nil, is called as each announce finishes. The results are returned, those that
+// didn't finish in time having ctx's error, so that stragglers can be logged.
+func (cl *Client) Shutdown(ctx context.Context, progress func(ShutdownAnnounce)) (ret []ShutdownAnnounce) {
+	defer cl.Close()
+	type stopping struct {
+		infoHash metainfo.Hash
+		ts       *trackerScraper
+	}
+	var all []stopping
+	cl.lock()
+	for ih, t := range cl.torrents {
+		for _, ts := range t.takeStartedTrackerScrapers() {
+			all = append(all, stopping{ih, ts})
+		}
+	}
+	cl.unlock()
+	ret = make([]ShutdownAnnounce, len(all))
+	for i, s := range all {
+		ret[i] = ShutdownAnnounce{
+			InfoHash:        s.infoHash,
+			TrackerAnnounce: TrackerAnnounce{Url: s.ts.u.String(), Event: tracker.Stopped},
+		}
+	}
+	// Guards ret, and what's below, against announces that finish after they're given up on.
+	var mu sync.Mutex
+	finished := make([]bool, len(all))
+	givenUp := false
+	var wg sync.WaitGroup
+	for i, s := range all {
+		wg.Add(1)
+		go func(i int, ts *trackerScraper) {
+			defer wg.Done()
+			ar := ts.announce(ctx, tracker.Stopped, 0)
+			mu.Lock()
+			defer mu.Unlock()
+			if givenUp {
+				return
+			}
+			sa := &ret[i]
+			sa.NumPeers = ar.NumPeers
+			sa.Interval = ar.Interval
+			sa.MinInterval = ar.MinInterval
+			sa.Err = ar.Err
+			finished[i] = true
+			if progress != nil {
+				progress(*sa)
+			}
+		}(i, s.ts)
+	}
+	allDone := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(allDone)
+	}()
+	select {
+	case <-allDone:
+	case <-ctx.Done():
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	givenUp = true
+	for i := range ret {
+		if !finished[i] {
+			ret[i].Err = ctx.Err()
+		}
+	}
+	return
+}
+
 func (cl *Client) ipBlockRange(ip net.IP) (r iplist.Range, blocked bool) {
 	if cl.ipBlockList == nil {
 		return
@@ -976,12 +1094,15 @@ func (cl *Client) sendInitialMessages(conn *PeerConn, torrent *Torrent) {
 					MetadataSize: torrent.metadataSize(),
 					// TODO: We can figured these out specific to the socket
 					// used.
-					Ipv4: pp.CompactIp(cl.config.PublicIp4.To4()),
-					Ipv6: cl.config.PublicIp6.To16(),
+					Ipv4: pp.CompactIp(cl.knownPublicIp(true).To4()),
+					Ipv6: cl.knownPublicIp(false).To16(),
 				}
-				if !cl.config.DisablePEX {
+				if torrent.pexEnabled() {
 					msg.M[pp.ExtensionNamePex] = pexExtendedId
 				}
+				if torrent.texEnabled() {
+					msg.M[pp.ExtensionNameTex] = texExtendedId
+				}
 				return bencode.MustMarshal(msg)
 			}(),
 		})
@@ -1000,7 +1121,8 @@ func (cl *Client) sendInitialMessages(conn *PeerConn, torrent *Torrent) {
 		}
 		conn.postBitfield()
 	}()
-	if conn.PeerExtensionBytes.SupportsDHT() && cl.config.Extensions.SupportsDHT() && cl.haveDhtServer() {
+	// Read-only DHT nodes don't answer the pings that peers send to the port.
+	if conn.PeerExtensionBytes.SupportsDHT() && cl.config.Extensions.SupportsDHT() && cl.haveDhtServer() && !cl.dhtReadOnly {
 		conn.post(pp.Message{
 			Type: pp.Port,
 			Port: cl.dhtPort(),
@@ -1025,7 +1147,7 @@ func (cl *Client) haveDhtServer() (ret bool) {
 // Process incoming ut_metadata message.
 func (cl *Client) gotMetadataExtensionMsg(payload []byte, t *Torrent, c *PeerConn) error {
 	var d map[string]int
-	err := bencode.Unmarshal(payload, &d)
+	err := bencode.UnmarshalNetwork(payload, &d)
 	if _, ok := err.(bencode.ErrUnusedTrailingBytes); ok {
 	} else if err != nil {
 		return fmt.Errorf("error unmarshalling bencode: %s", err)
@@ -1097,8 +1219,9 @@ func (cl *Client) newTorrent(ih metainfo.Hash, specStorage storage.ClientImpl) (
 	}
 
 	t = &Torrent{
-		cl:       cl,
-		infoHash: ih,
+		cl:          cl,
+		infoHash:    ih,
+		announceKey: newAnnounceKey(),
 		peers: prioritizedPeers{
 			om: btree.New(32),
 			getPrio: func(p PeerInfo) peerPriority {
@@ -1145,17 +1268,33 @@ func (cl *Client) AddTorrentInfoHash(infoHash metainfo.Hash) (t *Torrent, new bo
 func (cl *Client) AddTorrentInfoHashWithStorage(infoHash metainfo.Hash, specStorage storage.ClientImpl) (t *Torrent, new bool) {
 	cl.lock()
 	defer cl.unlock()
-	t, ok := cl.torrents[infoHash]
+	return cl.addTorrent(&TorrentSpec{InfoHash: infoHash, Storage: specStorage})
+}
+
+// Adds a torrent for the spec, with the fields that only apply to new torrents, if it's not in the
+// client already. The rest of the spec is left for MergeSpec. Call with the client lock held.
+func (cl *Client) addTorrent(spec *TorrentSpec) (t *Torrent, new bool) {
+	t, ok := cl.torrents[spec.InfoHash]
 	if ok {
 		return
 	}
 	new = true
 
-	t = cl.newTorrent(infoHash, specStorage)
+	t = cl.newTorrent(spec.InfoHash, spec.Storage)
+	// Set before the trackers and DHT are announced to, so they never see other values.
+	if spec.AnnounceKey != 0 {
+		t.announceKey = spec.AnnounceKey
+	}
+	t.carriedUploaded = spec.Uploaded
+	t.carriedDownloaded = spec.Downloaded
+	t.announceParams = spec.TrackerAnnounceParams
+	// The info is set afterwards, so it's too late to find it's private then.
+	t.dhtDisabled = spec.DisableDHT || infoBytesPrivate(spec.InfoBytes)
+	t.dhtAnnounceDisabled = spec.DisableDhtAnnounce
 	cl.eachDhtServer(func(s DhtServer) {
 		go t.dhtAnnouncer(s)
 	})
-	cl.torrents[infoHash] = t
+	cl.torrents[spec.InfoHash] = t
 	cl.clearAcceptLimits()
 	t.updateWantPeersEvent()
 	// Tickle Client.waitAccept, new torrent may want conns.
@@ -1163,10 +1302,25 @@ func (cl *Client) AddTorrentInfoHashWithStorage(infoHash metainfo.Hash, specStor
 	return
 }
 
+// Whether the info has the BEP 27 private flag. Info that doesn't unmarshal is left for
+// SetInfoBytes to refuse.
+func infoBytesPrivate(b []byte) bool {
+	if b == nil {
+		return false
+	}
+	var info metainfo.Info
+	if bencode.Unmarshal(b, &info) != nil {
+		return false
+	}
+	return info.IsPrivate()
+}
+
 // Add or merge a torrent spec. Returns new if the torrent wasn't already in the client. See also
 // Torrent.MergeSpec.
 func (cl *Client) AddTorrentSpec(spec *TorrentSpec) (t *Torrent, new bool, err error) {
-	t, new = cl.AddTorrentInfoHashWithStorage(spec.InfoHash, spec.Storage)
+	cl.lock()
+	t, new = cl.addTorrent(spec)
+	cl.unlock()
 	err = t.MergeSpec(spec)
 	if err != nil && new {
 		t.Drop()
@@ -1194,13 +1348,19 @@ func (t *Torrent) MergeSpec(spec *TorrentSpec) error {
 			return err
 		}
 	}
+	if !spec.SelectOnly.IsEmpty() {
+		go t.selectOnly(spec.SelectOnly)
+	}
 	cl := t.cl
-	cl.AddDhtNodes(spec.DhtNodes)
+	t.AddDhtNodes(spec.DhtNodes)
 	cl.lock()
 	defer cl.unlock()
 	useTorrentSources(spec.Sources, t)
 	for _, url := range spec.Webseeds {
-		t.addWebSeed(url)
+		t.addWebSeed(url, webseed.StyleUrlList)
+	}
+	for _, url := range spec.HttpSeeds {
+		t.addWebSeed(url, webseed.StyleHttpSeed)
 	}
 	for _, peerAddr := range spec.PeerAddrs {
 		t.addPeer(PeerInfo{
@@ -1220,9 +1380,10 @@ func (t *Torrent) MergeSpec(spec *TorrentSpec) error {
 }
 
 func useTorrentSources(sources []string, t *Torrent) {
+	delay := t.cl.config.TorrentSourcesDelay
 	for _, s := range sources {
 		go func(s string) {
-			err := useTorrentSource(s, t)
+			err := useTorrentSource(s, t, delay)
 			if err != nil {
 				t.logger.WithDefaultLevel(log.Warning).Printf("using torrent source %q: %v", s, err)
 			} else {
@@ -1232,10 +1393,20 @@ func useTorrentSources(sources []string, t *Torrent) {
 	}
 }
 
-func useTorrentSource(source string, t *Torrent) error {
+// Fetches the .torrent from source, unless the info is obtained some other way within delay.
+func useTorrentSource(source string, t *Torrent, delay time.Duration) error {
+	if delay > 0 {
+		select {
+		case <-time.After(delay):
+		case <-t.GotInfo():
+			return nil
+		case <-t.Closed():
+			return nil
+		}
+	}
 	req, err := http.NewRequest(http.MethodGet, source, nil)
 	if err != nil {
-		panic(err)
+		return err
 	}
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -1250,8 +1421,15 @@ func useTorrentSource(source string, t *Torrent) error {
 	req = req.WithContext(ctx)
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
 		return err
 	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected response status: %v", resp.Status)
+	}
 	mi, err := metainfo.Load(resp.Body)
 	if err != nil {
 		if ctx.Err() != nil {
@@ -1309,6 +1487,40 @@ func (cl *Client) Torrents() []*Torrent {
 	return cl.torrentsAsSlice()
 }
 
+// Returns the torrents in the client that info says may share files with it (BEP 38): those it lists
+// as similar, and those in any of the same collections. Torrents without their info yet can only
+// match by infohash. Torrents are in infohash order.
+func (cl *Client) SimilarTorrents(info *metainfo.Info) (ret []*Torrent) {
+	similar := make(map[metainfo.Hash]bool, len(info.Similar))
+	for _, h := range info.Similar {
+		similar[h] = true
+	}
+	collections := make(map[string]bool, len(info.Collections))
+	for _, c := range info.Collections {
+		collections[c] = true
+	}
+	cl.lock()
+	defer cl.unlock()
+	for ih, t := range cl.torrents {
+		if similar[ih] || t.haveInfo() && anyCollection(t.info.Collections, collections) {
+			ret = append(ret, t)
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return bytes.Compare(ret[i].infoHash[:], ret[j].infoHash[:]) < 0
+	})
+	return
+}
+
+func anyCollection(names []string, collections map[string]bool) bool {
+	for _, name := range names {
+		if collections[name] {
+			return true
+		}
+	}
+	return false
+}
+
 func (cl *Client) torrentsAsSlice() (ret []*Torrent) {
 	for _, t := range cl.torrents {
 		ret = append(ret, t)
@@ -1325,8 +1537,20 @@ func (cl *Client) AddMagnet(uri string) (T *Torrent, err error) {
 	return
 }
 
+// Adds the torrent described by mi. If the torrent is already in the client, mi is merged with what
+// it was added with, as by metainfo.Merge, and any new trackers are announced to.
 func (cl *Client) AddTorrent(mi *metainfo.MetaInfo) (T *Torrent, err error) {
-	T, _, err = cl.AddTorrentSpec(TorrentSpecFromMetaInfo(mi))
+	spec := TorrentSpecFromMetaInfo(mi)
+	cl.lock()
+	T, new := cl.addTorrent(spec)
+	cl.unlock()
+	T.mergeMetaInfo(mi)
+	// The trackers are in the torrent's metainfo now, merged by URL rather than tier by tier.
+	spec.Trackers = nil
+	err = T.MergeSpec(spec)
+	if err != nil && new {
+		T.Drop()
+	}
 	return
 }
 
@@ -1338,28 +1562,55 @@ func (cl *Client) AddTorrentFromFile(filename string) (T *Torrent, err error) {
 	return cl.AddTorrent(mi)
 }
 
+// Returns the DHT servers. The Client's own servers may be replaced by others if our public IP
+// changes, so don't hold on to them.
 func (cl *Client) DhtServers() []DhtServer {
+	cl.rLock()
+	defer cl.rUnlock()
 	return cl.dhtServers
 }
 
+// Adds nodes, given as "host:port" like metainfo.Node, to the DHT servers by pinging them, so that
+// those that reply go in the routing tables. Host names are resolved. Returns without waiting for
+// the replies.
 func (cl *Client) AddDhtNodes(nodes []string) {
 	for _, n := range nodes {
 		hmp := missinggo.SplitHostMaybePort(n)
-		ip := net.ParseIP(hmp.Host)
-		if ip == nil {
-			cl.logger.Printf("won't add DHT node with bad IP: %q", hmp.Host)
+		if hmp.Err != nil || hmp.NoPort {
+			cl.logger.Printf("won't add DHT node %q without a host and port", n)
 			continue
 		}
-		ni := krpc.NodeInfo{
-			Addr: krpc.NodeAddr{
-				IP:   ip,
-				Port: hmp.Port,
-			},
+		go cl.pingDhtNode(hmp.Host, hmp.Port)
+	}
+}
+
+func (cl *Client) pingDhtNode(host string, port int) {
+	ips := []net.IP{net.ParseIP(host)}
+	if ips[0] == nil {
+		var err error
+		ips, err = net.LookupIP(host)
+		if err != nil {
+			cl.logger.Printf("error resolving DHT node: %v", err)
+			return
 		}
-		cl.eachDhtServer(func(s DhtServer) {
-			s.AddNode(ni)
-		})
 	}
+	var wg sync.WaitGroup
+	servers := cl.DhtServers()
+	for _, ip := range ips {
+		addr := &net.UDPAddr{IP: ip, Port: port}
+		for _, s := range servers {
+			wg.Add(1)
+			go func(s DhtServer) {
+				defer wg.Done()
+				s.Ping(addr)
+			}(s)
+		}
+	}
+	wg.Wait()
+	cl.lock()
+	cl.dhtNodesAdded++
+	cl.event.Broadcast()
+	cl.unlock()
 }
 
 func (cl *Client) banPeerIP(ip net.IP) {
@@ -1454,13 +1705,13 @@ func (cl *Client) publicIp(peer net.IP) net.IP {
 	// TODO: Use BEP 10 to determine how peers are seeing us.
 	if peer.To4() != nil {
 		return firstNotNil(
-			cl.config.PublicIp4,
+			cl.knownPublicIp(true),
 			cl.findListenerIp(func(ip net.IP) bool { return ip.To4() != nil }),
 		)
 	}
 
 	return firstNotNil(
-		cl.config.PublicIp6,
+		cl.knownPublicIp(false),
 		cl.findListenerIp(func(ip net.IP) bool { return ip.To4() == nil }),
 	)
 }
@@ -1,13 +1,21 @@
 package torrent
 
 import (
+	"bytes"
+	"context"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"reflect"
+	"sort"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"testing/iotest"
 	"time"
@@ -26,6 +34,8 @@ import (
 	"github.com/anacrolix/torrent/iplist"
 	"github.com/anacrolix/torrent/metainfo"
 	"github.com/anacrolix/torrent/storage"
+	"github.com/anacrolix/torrent/tracker"
+	"github.com/anacrolix/torrent/webseed"
 )
 
 func TestClientDefault(t *testing.T) {
@@ -816,3 +826,276 @@ func TestClientDisabledImplicitNetworksButDhtEnabled(t *testing.T) {
 	assert.Empty(t, cl.listeners)
 	assert.NotEmpty(t, cl.DhtServers())
 }
+
+func TestClientSimilarTorrents(t *testing.T) {
+	c := quicktest.New(t)
+	cl, err := NewClient(TestingConfig(t))
+	c.Assert(err, quicktest.IsNil)
+	defer cl.Close()
+	add := func(name string, collections ...string) *Torrent {
+		mi := metainfo.MetaInfo{InfoBytes: bencode.MustMarshal(metainfo.Info{
+			Name:        name,
+			PieceLength: 1,
+			Length:      1,
+			Pieces:      make([]byte, metainfo.HashSize),
+			Collections: collections,
+		})}
+		tt, _, err := cl.AddTorrentSpec(TorrentSpecFromMetaInfo(&mi))
+		c.Assert(err, quicktest.IsNil)
+		return tt
+	}
+	a := add("a")
+	b := add("b", "x")
+	add("c", "y")
+	d, _ := cl.AddTorrentInfoHash(metainfo.Hash{4})
+	similar := cl.SimilarTorrents(&metainfo.Info{
+		Similar:     []metainfo.Hash{a.InfoHash(), d.InfoHash(), {5}},
+		Collections: []string{"x", "z"},
+	})
+	var got []metainfo.Hash
+	for _, t := range similar {
+		got = append(got, t.InfoHash())
+	}
+	expected := []metainfo.Hash{a.InfoHash(), b.InfoHash(), d.InfoHash()}
+	sort.Slice(expected, func(i, j int) bool {
+		return bytes.Compare(expected[i][:], expected[j][:]) < 0
+	})
+	c.Check(got, quicktest.DeepEquals, expected)
+	c.Check(cl.SimilarTorrents(&metainfo.Info{}), quicktest.HasLen, 0)
+}
+
+func TestAddTorrentMergesDuplicate(t *testing.T) {
+	c := quicktest.New(t)
+	cfg := TestingConfig(t)
+	cfg.DisableTrackers = false
+	cl, err := NewClient(cfg)
+	c.Assert(err, quicktest.IsNil)
+	defer cl.Close()
+	mi := testutil.GreetingMetaInfo()
+	mi.AnnounceList = metainfo.AnnounceList{{"http://127.0.0.1:1/a"}}
+	tt, err := cl.AddTorrent(mi)
+	c.Assert(err, quicktest.IsNil)
+	other := *mi
+	other.AnnounceList = metainfo.AnnounceList{{"http://127.0.0.1:1/b", "http://127.0.0.1:1/a"}}
+	other.UrlList = metainfo.UrlList{"http://127.0.0.1:1/ws"}
+	again, err := cl.AddTorrent(&other)
+	c.Assert(err, quicktest.IsNil)
+	c.Assert(again, quicktest.Equals, tt)
+	c.Check(tt.Metainfo().AnnounceList, quicktest.DeepEquals, metainfo.AnnounceList{
+		{"http://127.0.0.1:1/a"},
+		{"http://127.0.0.1:1/b"},
+	})
+	c.Check(tt.Metainfo().UrlList, quicktest.DeepEquals, metainfo.UrlList{"http://127.0.0.1:1/ws"})
+	cl.lock()
+	defer cl.unlock()
+	for _, url := range []string{"http://127.0.0.1:1/a", "http://127.0.0.1:1/b"} {
+		_, ok := tt.trackerAnnouncers[url]
+		c.Check(ok, quicktest.IsTrue, quicktest.Commentf(url))
+	}
+}
+
+func TestAddTorrentHttpSeeds(t *testing.T) {
+	c := quicktest.New(t)
+	cl, err := NewClient(TestingConfig(t))
+	c.Assert(err, quicktest.IsNil)
+	defer cl.Close()
+	mi := testutil.GreetingMetaInfo()
+	mi.UrlList = metainfo.UrlList{"http://127.0.0.1:1/files/"}
+	mi.HttpSeeds = metainfo.UrlList{"http://127.0.0.1:1/seed"}
+	tt, err := cl.AddTorrent(mi)
+	c.Assert(err, quicktest.IsNil)
+	c.Check(tt.Metainfo().UrlList, quicktest.DeepEquals, mi.UrlList)
+	c.Check(tt.Metainfo().HttpSeeds, quicktest.DeepEquals, mi.HttpSeeds)
+	cl.lock()
+	defer cl.unlock()
+	c.Check(tt.webSeeds["http://127.0.0.1:1/seed"].peerImpl.(*webseedPeer).client.Style, quicktest.Equals, webseed.StyleHttpSeed)
+}
+
+func TestMagnetExactSource(t *testing.T) {
+	c := quicktest.New(t)
+	mi := testutil.GreetingMetaInfo()
+	var buf bytes.Buffer
+	c.Assert(mi.Write(&buf), quicktest.IsNil)
+	var fetches int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		w.Write(buf.Bytes())
+	}))
+	defer s.Close()
+	cfg := TestingConfig(t)
+	cfg.TorrentSourcesDelay = 10 * time.Millisecond
+	cl, err := NewClient(cfg)
+	c.Assert(err, quicktest.IsNil)
+	defer cl.Close()
+	m := mi.MagnetWithOpts(metainfo.MagnetOpts{ExactSources: []string{s.URL + "/missing", s.URL + "/a.torrent"}})
+	tt, err := cl.AddMagnet(m.String())
+	c.Assert(err, quicktest.IsNil)
+	select {
+	case <-tt.GotInfo():
+	case <-time.After(10 * time.Second):
+		c.Fatal("info not fetched from exact source")
+	}
+	c.Check(tt.Name(), quicktest.Equals, testutil.GreetingFileName)
+	c.Check(atomic.LoadInt32(&fetches) >= 1, quicktest.IsTrue)
+}
+
+// Sources aren't fetched if the info turns up before the delay.
+func TestTorrentSourcesDelay(t *testing.T) {
+	c := quicktest.New(t)
+	mi := testutil.GreetingMetaInfo()
+	var fetches int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+	}))
+	defer s.Close()
+	cfg := TestingConfig(t)
+	cfg.TorrentSourcesDelay = 50 * time.Millisecond
+	cl, err := NewClient(cfg)
+	c.Assert(err, quicktest.IsNil)
+	defer cl.Close()
+	spec, err := TorrentSpecFromMagnetUri(mi.MagnetWithOpts(metainfo.MagnetOpts{ExactSources: []string{s.URL}}).String())
+	c.Assert(err, quicktest.IsNil)
+	spec.InfoBytes = mi.InfoBytes
+	_, _, err = cl.AddTorrentSpec(spec)
+	c.Assert(err, quicktest.IsNil)
+	time.Sleep(100 * time.Millisecond)
+	c.Check(atomic.LoadInt32(&fetches), quicktest.Equals, int32(0))
+}
+
+// A magnet's x.pe peers are connected to when it's added, so no trackers or DHT are needed.
+func TestMagnetPeerAddrs(t *testing.T) {
+	c := quicktest.New(t)
+	seederDataDir, mi := testutil.GreetingTestTorrent()
+	defer os.RemoveAll(seederDataDir)
+	cfg := TestingConfig(t)
+	cfg.Seed = true
+	cfg.DataDir = seederDataDir
+	seeder, err := NewClient(cfg)
+	c.Assert(err, quicktest.IsNil)
+	defer seeder.Close()
+	seederTorrent, _, err := seeder.AddTorrentSpec(TorrentSpecFromMetaInfo(mi))
+	c.Assert(err, quicktest.IsNil)
+	seederTorrent.VerifyData()
+	var peers []string
+	for _, la := range seeder.ListenAddrs() {
+		peers = append(peers, la.String())
+	}
+	m := mi.MagnetWithOpts(metainfo.MagnetOpts{Peers: peers})
+	leecher, err := NewClient(TestingConfig(t))
+	c.Assert(err, quicktest.IsNil)
+	defer leecher.Close()
+	tt, err := leecher.AddMagnet(m.String())
+	c.Assert(err, quicktest.IsNil)
+	select {
+	case <-tt.GotInfo():
+	case <-time.After(10 * time.Second):
+		c.Fatal("didn't get info from magnet peer")
+	}
+}
+
+func TestMagnetSelectOnly(t *testing.T) {
+	c := quicktest.New(t)
+	info := metainfo.Info{
+		Name:        "dir",
+		PieceLength: 4,
+		Pieces:      make([]byte, 4*metainfo.HashSize),
+		Files: []metainfo.FileInfo{
+			{Path: []string{"a"}, Length: 4},
+			{Path: []string{"b"}, Length: 4},
+			{Path: []string{"c"}, Length: 4},
+			{Path: []string{"d"}, Length: 4},
+		},
+	}
+	mi := &metainfo.MetaInfo{InfoBytes: bencode.MustMarshal(info)}
+	m := mi.MagnetWithOpts(metainfo.MagnetOpts{SelectOnly: metainfo.SelectOnlyIndices(3, 1)})
+	m.SelectOnly.Ranges = append(m.SelectOnly.Ranges, metainfo.IndexRange{First: 7, Last: 9})
+	m.SelectOnly.Invalid = []string{"x"}
+	cl, err := NewClient(TestingConfig(t))
+	c.Assert(err, quicktest.IsNil)
+	defer cl.Close()
+	tt, err := cl.AddMagnet(m.String())
+	c.Assert(err, quicktest.IsNil)
+	// The info arriving later, as from peers.
+	c.Assert(tt.SetInfoBytes(mi.InfoBytes), quicktest.IsNil)
+	expected := []piecePriority{PiecePriorityNone, PiecePriorityNormal, PiecePriorityNone, PiecePriorityNormal}
+	for i := 0; ; i++ {
+		var actual []piecePriority
+		for _, f := range tt.Files() {
+			actual = append(actual, f.Priority())
+		}
+		if reflect.DeepEqual(actual, expected) {
+			break
+		}
+		if i == 100 {
+			c.Fatalf("file priorities %v", actual)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// BEP 27: private torrents only get peers from trackers.
+func TestPrivateTorrentPeerSources(t *testing.T) {
+	c := quicktest.New(t)
+	cfg := TestingConfig(t)
+	cfg.NoDHT = false
+	cfg.DhtStartingNodes = func(string) dht.StartingNodesGetter {
+		return func() ([]dht.Addr, error) { return nil, nil }
+	}
+	cl, err := NewClient(cfg)
+	c.Assert(err, quicktest.IsNil)
+	defer cl.Close()
+	public := testutil.GreetingMetaInfo()
+	private := testutil.GreetingMetaInfo()
+	c.Assert(private.SetPrivate(true), quicktest.IsNil)
+	publicTorrent, err := cl.AddTorrent(public)
+	c.Assert(err, quicktest.IsNil)
+	c.Check(publicTorrent.DhtEnabled(), quicktest.IsTrue)
+	c.Check(publicTorrent.PexEnabled(), quicktest.IsTrue)
+	privateTorrent, err := cl.AddTorrent(private)
+	c.Assert(err, quicktest.IsNil)
+	c.Check(privateTorrent.DhtEnabled(), quicktest.IsFalse)
+	c.Check(privateTorrent.PexEnabled(), quicktest.IsFalse)
+}
+
+func TestTorrentScrape(t *testing.T) {
+	c := quicktest.New(t)
+	mi := testutil.GreetingMetaInfo()
+	ih := mi.HashInfoBytes()
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/scrape" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(bencode.MustMarshal(map[string]interface{}{
+			"files": map[string]interface{}{
+				string(ih[:]): map[string]int{"complete": 1, "downloaded": 2, "incomplete": 3},
+			},
+		}))
+	}))
+	defer s.Close()
+	cfg := TestingConfig(t)
+	cfg.DisableTrackers = false
+	cl, err := NewClient(cfg)
+	c.Assert(err, quicktest.IsNil)
+	defer cl.Close()
+	mi.AnnounceList = metainfo.AnnounceList{{s.URL + "/announce", s.URL + "/tracker"}}
+	tt, err := cl.AddTorrent(mi)
+	c.Assert(err, quicktest.IsNil)
+	scrapes := tt.Scrape(context.Background())
+	c.Assert(scrapes, quicktest.HasLen, 2)
+	c.Check(scrapes[0].Url, quicktest.Equals, s.URL+"/announce")
+	c.Check(scrapes[0].Err, quicktest.IsNil)
+	c.Check(scrapes[0].Stats, quicktest.Equals, tracker.ScrapeStats{Seeders: 1, Completed: 2, Leechers: 3})
+	c.Check(scrapes[1].Url, quicktest.Equals, s.URL+"/tracker")
+	c.Check(errors.As(scrapes[1].Err, new(tracker.ErrScrapeUnsupported)), quicktest.IsTrue)
+}
+
+func TestTorrentSpecFromV2OnlyMagnet(t *testing.T) {
+	c := quicktest.New(t)
+	_, err := TorrentSpecFromMagnetUri("magnet:?xt=urn:btmh:1220" + strings.Repeat("ab", 32))
+	c.Check(err, quicktest.ErrorMatches, "v2-only magnets aren't supported")
+	// Hybrid magnets use the v1 infohash.
+	spec, err := TorrentSpecFromMagnetUri("magnet:?xt=urn:btih:" + strings.Repeat("cd", 20) + "&xt=urn:btmh:1220" + strings.Repeat("ab", 32))
+	c.Assert(err, quicktest.IsNil)
+	c.Check(spec.InfoHash.HexString(), quicktest.Equals, strings.Repeat("cd", 20))
+}
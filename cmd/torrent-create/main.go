@@ -1,12 +1,12 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
 
 	"github.com/anacrolix/tagflag"
 
-	"github.com/anacrolix/torrent/bencode"
 	"github.com/anacrolix/torrent/metainfo"
 )
 
@@ -18,41 +18,52 @@ var (
 	}
 )
 
+func parseVersion(s string) (metainfo.InfoVersion, bool) {
+	for _, v := range []metainfo.InfoVersion{metainfo.InfoVersionV1, metainfo.InfoVersionHybrid, metainfo.InfoVersionV2} {
+		if v.String() == s {
+			return v, true
+		}
+	}
+	return 0, false
+}
+
 func main() {
 	log.SetFlags(log.Flags() | log.Lshortfile)
 	var args struct {
-		AnnounceList      []string `name:"a" help:"extra announce-list tier entry"`
-		EmptyAnnounceList bool     `name:"n" help:"exclude default announce-list entries"`
-		Comment           string   `name:"t" help:"comment"`
-		CreatedBy         string   `name:"c" help:"created by"`
+		AnnounceList      []string      `name:"a" help:"extra announce-list tier entry"`
+		EmptyAnnounceList bool          `name:"n" help:"exclude default announce-list entries"`
+		Comment           string        `name:"t" help:"comment"`
+		CreatedBy         string        `name:"c" help:"created by"`
+		PieceLength       tagflag.Bytes `name:"l" help:"piece length, chosen from the total length if zero"`
+		Version           string        `name:"v" help:"info version: v1, hybrid or v2"`
+		Private           bool          `name:"p" help:"set the private flag"`
+		WebSeed           []string      `name:"w" help:"webseed url"`
 		tagflag.StartPos
 		Root string
 	}
+	args.Version = metainfo.InfoVersionV1.String()
 	tagflag.Parse(&args, tagflag.Description("Creates a torrent metainfo for the file system rooted at ROOT, and outputs it to stdout."))
-	mi := metainfo.MetaInfo{
-		AnnounceList: builtinAnnounceList,
+	version, ok := parseVersion(args.Version)
+	if !ok {
+		log.Fatalf("unknown info version %q", args.Version)
 	}
-	if args.EmptyAnnounceList {
-		mi.AnnounceList = make([][]string, 0)
+	b := metainfo.NewBuilder().
+		Root(args.Root).
+		PieceLength(int64(args.PieceLength)).
+		Version(version).
+		Private(args.Private).
+		WebSeed(args.WebSeed...).
+		Comment(args.Comment).
+		CreatedBy(args.CreatedBy)
+	if !args.EmptyAnnounceList {
+		for _, tier := range builtinAnnounceList {
+			b.Tracker(tier...)
+		}
 	}
 	for _, a := range args.AnnounceList {
-		mi.AnnounceList = append(mi.AnnounceList, []string{a})
-	}
-	mi.SetDefaults()
-	if len(args.Comment) > 0 {
-		mi.Comment = args.Comment
-	}
-	if len(args.CreatedBy) > 0 {
-		mi.CreatedBy = args.CreatedBy
-	}
-	info := metainfo.Info{
-		PieceLength: 256 * 1024,
-	}
-	err := info.BuildFromFilePath(args.Root)
-	if err != nil {
-		log.Fatal(err)
+		b.Tracker(a)
 	}
-	mi.InfoBytes, err = bencode.Marshal(info)
+	mi, err := b.Build(context.Background())
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -33,11 +33,11 @@ func processReader(r io.Reader) error {
 		return fmt.Errorf("error unmarshalling info: %s", err)
 	}
 	if flags.JustName {
-		fmt.Printf("%s\n", info.Name)
+		fmt.Printf("%s\n", info.BestName())
 		return nil
 	}
 	d := map[string]interface{}{
-		"Name":         info.Name,
+		"Name":         info.BestName(),
 		"NumPieces":    info.NumPieces(),
 		"PieceLength":  info.PieceLength,
 		"InfoHash":     metainfo.HashInfoBytes().HexString(),
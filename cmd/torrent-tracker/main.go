@@ -0,0 +1,60 @@
+// Runs a tracker for private swarms, such as on a LAN.
+package main
+
+import (
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/anacrolix/tagflag"
+
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/anacrolix/torrent/tracker/server"
+)
+
+func main() {
+	log.SetFlags(log.Flags() | log.Lshortfile)
+	var args struct {
+		Http     string        `help:"address to serve HTTP announces on, at /announce"`
+		Udp      string        `help:"address to serve UDP announces on"`
+		Interval time.Duration `help:"how long peers wait between announces"`
+		Allow    []string      `help:"hex info hash to track; if any are given, only those are tracked"`
+	}
+	args.Http = ":6969"
+	args.Udp = ":6969"
+	args.Interval = server.DefaultInterval
+	tagflag.Parse(&args, tagflag.Description("Runs a tracker that keeps its swarms in memory."))
+	s := server.Server{
+		Interval:  args.Interval,
+		AllowList: len(args.Allow) != 0,
+	}
+	for _, a := range args.Allow {
+		var ih metainfo.Hash
+		if err := ih.FromHexString(a); err != nil {
+			log.Fatalf("parsing info hash %q: %v", a, err)
+		}
+		s.Allow(ih)
+	}
+	errs := make(chan error, 2)
+	if args.Udp != "" {
+		pc, err := net.ListenPacket("udp", args.Udp)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("serving UDP on %v", pc.LocalAddr())
+		go func() { errs <- s.ServeUDP(pc) }()
+	}
+	if args.Http != "" {
+		l, err := net.Listen("tcp", args.Http)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("serving HTTP on %v", l.Addr())
+		go func() { errs <- http.Serve(l, &s) }()
+	}
+	if args.Udp == "" && args.Http == "" {
+		log.Fatal("nothing to serve")
+	}
+	log.Fatal(<-errs)
+}
@@ -33,12 +33,34 @@ type ClientConfig struct {
 	// Don't announce to trackers. This only leaves DHT to discover peers.
 	DisableTrackers bool `long:"disable-trackers"`
 	DisablePEX      bool `long:"disable-pex"`
+	// Exchange tracker URLs with peers, as BEP 28 (lt_tex) describes. Trackers that work are sent,
+	// and those received are announced to after the metainfo's. Never done for private torrents.
+	TrackerExchange bool
+	// Trackers whose announces fail this many times in a row aren't announced to again for the
+	// rest of the session. Zero for no limit. Failures back off exponentially either way.
+	TrackerMaxConsecutiveFailures int
+	// Parameters for announces to all trackers, unless overridden with
+	// TorrentSpec.TrackerAnnounceParams.
+	TrackerAnnounceParams TrackerAnnounceParams
+	// Chooses the address families to announce to the tracker over. The default is
+	// TrackerIpFamiliesAll. Families disabled by DisableIPv4 and DisableIPv6 aren't used either way.
+	TrackerIpFamilies func(trackerUrl *url.URL) TrackerIpFamilies
 
 	// Don't create a DHT.
 	NoDHT            bool `long:"disable-dht"`
 	DhtStartingNodes func(network string) dht.StartingNodesGetter
 	// Called for each anacrolix/dht Server created for the Client.
 	ConfigureAnacrolixDhtServer func(*dht.ServerConfig)
+	// If set, the DHT routing tables are saved to this file periodically and when the Client is
+	// closed. The nodes in it are pinged when the Client starts, and DhtStartingNodes are only used
+	// if none of them reply.
+	DhtNodesFile string `long:"dht-nodes-file"`
+	// How strictly BEP 42 node IDs are enforced on other DHT nodes. The default is
+	// DhtSecurityPrefer.
+	DhtSecurity DhtSecurity
+	// Use the DHT as a BEP 43 read-only node, for lookups without serving other nodes. It can be
+	// changed with Client.SetDhtReadOnly.
+	DhtReadOnly bool `long:"dht-read-only"`
 
 	// Never send chunks to peers.
 	NoUpload bool `long:"no-upload"`
@@ -90,6 +112,14 @@ type ClientConfig struct {
 	HTTPProxy func(*http.Request) (*url.URL, error)
 	// HTTPUserAgent changes default UserAgent for HTTP requests
 	HTTPUserAgent string
+	// Returns the client to announce to the HTTP tracker with, such as one with its own proxy or
+	// TLS configuration. If it's nil, or returns nil, the client made from HTTPProxy is used. An
+	// injected client connects to the tracker by its URL as it is, so the tracker's addresses
+	// aren't chosen as for TrackerIpFamilies, or checked against the IPBlocklist.
+	TrackerHTTPClientForURL func(u *url.URL) *http.Client
+	// Returns headers to add to announces to the HTTP tracker, such as a User-Agent or cookies it
+	// requires. They replace any of the same name.
+	TrackerHTTPHeaderForURL func(u *url.URL) http.Header
 	// Updated occasionally to when there's been some changes to client
 	// behaviour in case other clients are assuming anything of us. See also
 	// `bep20`.
@@ -143,6 +173,9 @@ type ClientConfig struct {
 
 	DisableWebtorrent bool
 	DisableWebseeds   bool
+	// How long to wait for the info from peers before fetching a torrent's sources, such as the "xs"
+	// and "as" values of a magnet link. Sources are fetched immediately if this is zero.
+	TorrentSourcesDelay time.Duration
 
 	Callbacks Callbacks
 }
@@ -24,6 +24,18 @@ type PeerStorer interface {
 	PeerStore() peer_store.Interface
 }
 
+// Optional interface for DhtServers that can export their routing table, so that it can be saved to
+// ClientConfig.DhtNodesFile.
+type DhtNodesExporter interface {
+	Nodes() []krpc.NodeInfo
+}
+
+// Optional interface for DhtServers that can ask the nodes for an infohash for BEP 33 scrapes,
+// without announcing.
+type DhtScraper interface {
+	Scrape(hash [20]byte) (DhtAnnounce, error)
+}
+
 type DhtAnnounce interface {
 	Close()
 	Peers() <-chan dht.PeersValues
@@ -50,6 +62,11 @@ func (me anacrolixDhtServerWrapper) Announce(hash [20]byte, port int, impliedPor
 	return anacrolixDhtAnnounceWrapper{ann}, err
 }
 
+func (me anacrolixDhtServerWrapper) Scrape(hash [20]byte) (DhtAnnounce, error) {
+	ann, err := me.Server.Announce(hash, 0, false, dht.Scrape())
+	return anacrolixDhtAnnounceWrapper{ann}, err
+}
+
 func (me anacrolixDhtServerWrapper) Ping(addr *net.UDPAddr) {
 	me.Server.Ping(addr)
 }
@@ -0,0 +1,160 @@
+package torrent
+
+import (
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/anacrolix/dht/v2"
+	"github.com/anacrolix/dht/v2/krpc"
+	qt "github.com/frankban/quicktest"
+
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/internal/testutil"
+)
+
+// Starts a DHT node that sends its queries to the channel, and replies to get_peers with a token
+// and a peer.
+func startAnnounceNode(c *qt.C) (*net.UDPAddr, <-chan krpc.Msg) {
+	pc, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	c.Assert(err, qt.IsNil)
+	c.Cleanup(func() { pc.Close() })
+	queries := make(chan krpc.Msg, 100)
+	id := krpc.ID(dht.RandomNodeID())
+	go func() {
+		b := make([]byte, 0x10000)
+		for {
+			n, addr, err := pc.ReadFrom(b)
+			if err != nil {
+				return
+			}
+			var m krpc.Msg
+			if bencode.Unmarshal(b[:n], &m) != nil || m.Y != "q" || m.A == nil {
+				continue
+			}
+			select {
+			case queries <- m:
+			default:
+			}
+			r := krpc.Return{ID: id}
+			if m.Q == "get_peers" {
+				token := "token"
+				r.Token = &token
+				r.Values = []krpc.NodeAddr{{IP: net.IPv4(127, 0, 0, 1), Port: 2}}
+			}
+			pc.WriteTo(bencode.MustMarshal(krpc.Msg{T: m.T, Y: "r", R: &r}), addr)
+		}
+	}()
+	return pc.LocalAddr().(*net.UDPAddr), queries
+}
+
+// Returns the first query for the infohash that's q, if there's one within the timeout. Other
+// queries are discarded.
+func waitDhtQuery(queries <-chan krpc.Msg, q string, ih [20]byte, timeout time.Duration) (krpc.Msg, bool) {
+	after := time.After(timeout)
+	for {
+		select {
+		case m := <-queries:
+			if m.Q == q && m.A.InfoHash == ih {
+				return m, true
+			}
+		case <-after:
+			return krpc.Msg{}, false
+		}
+	}
+}
+
+// Starts a Client with an IPv4 DHT server that knows of the node.
+func newDhtAnnounceClient(c *qt.C, cfg *ClientConfig, node *net.UDPAddr) *Client {
+	cfg.DisableIPv6 = true
+	cl, err := NewClient(cfg)
+	c.Assert(err, qt.IsNil)
+	c.Cleanup(cl.Close)
+	cl.DhtServers()[0].Ping(node)
+	return cl
+}
+
+func TestTorrentDhtAnnounce(t *testing.T) {
+	c := qt.New(t)
+	node, queries := startAnnounceNode(c)
+	cl := newDhtAnnounceClient(c, dhtTestingConfig(t), node)
+
+	// Peers are looked up, but we're not announced.
+	ih := [20]byte{1}
+	tor, _, err := cl.AddTorrentSpec(&TorrentSpec{InfoHash: ih, DisableDhtAnnounce: true})
+	c.Assert(err, qt.IsNil)
+	c.Check(tor.DhtEnabled(), qt.IsTrue)
+	c.Check(tor.DhtAnnounce(), qt.IsFalse)
+	_, ok := waitDhtQuery(queries, "get_peers", ih, 10*time.Second)
+	c.Assert(ok, qt.IsTrue)
+	_, ok = waitDhtQuery(queries, "announce_peer", ih, time.Second)
+	c.Check(ok, qt.IsFalse)
+	stats := tor.Stats()
+	c.Check(stats.LastDhtAnnounce.IsZero(), qt.IsFalse)
+	c.Check(stats.DhtPeers, qt.Equals, 1)
+
+	// Announcing restarts the lookup. Our public IP isn't known, so the port is given.
+	tor.SetDhtAnnounce(true)
+	c.Check(tor.DhtAnnounce(), qt.IsTrue)
+	m, ok := waitDhtQuery(queries, "announce_peer", ih, 10*time.Second)
+	c.Assert(ok, qt.IsTrue)
+	c.Check(m.A.ImpliedPort, qt.IsFalse)
+	c.Assert(m.A.Port, qt.Not(qt.IsNil))
+	c.Check(*m.A.Port, qt.Equals, cl.LocalPort())
+}
+
+func TestTorrentDhtDisabled(t *testing.T) {
+	c := qt.New(t)
+	node, queries := startAnnounceNode(c)
+	cl := newDhtAnnounceClient(c, dhtTestingConfig(t), node)
+
+	disabled, _, err := cl.AddTorrentSpec(&TorrentSpec{InfoHash: [20]byte{2}, DisableDHT: true})
+	c.Assert(err, qt.IsNil)
+	c.Check(disabled.DhtEnabled(), qt.IsFalse)
+	c.Check(disabled.DhtAnnounce(), qt.IsFalse)
+
+	// Private infos are known before the DHT could be used.
+	dir, mi := testutil.GreetingTestTorrent()
+	defer os.RemoveAll(dir)
+	info, err := mi.UnmarshalInfo()
+	c.Assert(err, qt.IsNil)
+	private := true
+	info.Private = &private
+	mi.InfoBytes, err = bencode.Marshal(info)
+	c.Assert(err, qt.IsNil)
+	privateTorrent, err := cl.AddTorrent(mi)
+	c.Assert(err, qt.IsNil)
+	c.Check(privateTorrent.DhtEnabled(), qt.IsFalse)
+
+	// A torrent that's allowed the DHT shows that the others would have had time to use it.
+	_, _, err = cl.AddTorrentSpec(&TorrentSpec{InfoHash: [20]byte{3}})
+	c.Assert(err, qt.IsNil)
+	timeout := time.After(10 * time.Second)
+	for announced := false; !announced; {
+		select {
+		case m := <-queries:
+			c.Check(m.A.InfoHash, qt.Not(qt.Equals), krpc.ID{2})
+			c.Check(m.A.InfoHash, qt.Not(qt.Equals), krpc.ID(mi.HashInfoBytes()))
+			announced = m.Q == "announce_peer" && m.A.InfoHash == krpc.ID{3}
+		case <-timeout:
+			c.Fatal("no announce")
+		}
+	}
+	c.Check(disabled.Stats().LastDhtAnnounce.IsZero(), qt.IsTrue)
+}
+
+// Behind NAT, nodes are told to use the port our queries come from.
+func TestDhtAnnounceImpliedPortBehindNat(t *testing.T) {
+	c := qt.New(t)
+	node, queries := startAnnounceNode(c)
+	cfg := dhtTestingConfig(t)
+	cfg.PublicIp4 = net.IPv4(192, 0, 2, 1)
+	cl := newDhtAnnounceClient(c, cfg, node)
+	ih := [20]byte{1}
+	_, _, err := cl.AddTorrentSpec(&TorrentSpec{InfoHash: ih})
+	c.Assert(err, qt.IsNil)
+	m, ok := waitDhtQuery(queries, "announce_peer", ih, 10*time.Second)
+	c.Assert(ok, qt.IsTrue)
+	c.Check(m.A.ImpliedPort, qt.IsTrue)
+}
@@ -0,0 +1,210 @@
+package torrent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/anacrolix/dht/v2"
+	"github.com/anacrolix/dht/v2/krpc"
+	"github.com/anacrolix/log"
+
+	"github.com/anacrolix/torrent/bencode"
+)
+
+const (
+	dhtNodesFileVersion  = 1
+	dhtNodesSaveInterval = 5 * time.Minute
+	// Saved nodes that haven't been in a routing table for this long are forgotten.
+	dhtNodesMaxAge = 7 * 24 * time.Hour
+	// The most nodes saved, the most recently seen being kept.
+	maxSavedDhtNodes = 256
+	// How long a saved node has to reply to its ping when the Client starts.
+	dhtNodesPingTimeout = 10 * time.Second
+)
+
+// The bencoded content of ClientConfig.DhtNodesFile. Files with other versions are ignored.
+type dhtNodesFile struct {
+	Version int                `bencode:"version"`
+	Nodes   []dhtNodesFileNode `bencode:"nodes"`
+}
+
+type dhtNodesFileNode struct {
+	Id []byte `bencode:"id"`
+	// The compact IP and port, of 6 bytes for IPv4 or 18 for IPv6.
+	Addr []byte `bencode:"addr"`
+	// Unix time the node was last in a routing table.
+	LastSeen int64 `bencode:"seen"`
+}
+
+type savedDhtNode struct {
+	krpc.NodeInfo
+	lastSeen time.Time
+}
+
+// Returns the nodes in the file that haven't expired. Entries that can't be decoded are skipped.
+func readDhtNodesFile(name string, now time.Time) (ret []savedDhtNode, err error) {
+	b, err := ioutil.ReadFile(name)
+	if err != nil {
+		return
+	}
+	var f dhtNodesFile
+	if err = bencode.Unmarshal(b, &f); err != nil {
+		return
+	}
+	if f.Version != dhtNodesFileVersion {
+		err = fmt.Errorf("unsupported version %v", f.Version)
+		return
+	}
+	for _, fn := range f.Nodes {
+		var n savedDhtNode
+		if len(fn.Id) != len(n.ID) || len(fn.Addr) != net.IPv4len+2 && len(fn.Addr) != net.IPv6len+2 {
+			continue
+		}
+		if n.Addr.UnmarshalBinary(fn.Addr) != nil || n.Addr.Port == 0 {
+			continue
+		}
+		copy(n.ID[:], fn.Id)
+		n.lastSeen = time.Unix(fn.LastSeen, 0)
+		if now.Sub(n.lastSeen) < dhtNodesMaxAge {
+			ret = append(ret, n)
+		}
+	}
+	return
+}
+
+func writeDhtNodesFile(name string, nodes []savedDhtNode) error {
+	f := dhtNodesFile{Version: dhtNodesFileVersion, Nodes: make([]dhtNodesFileNode, 0, len(nodes))}
+	for _, n := range nodes {
+		addr, err := n.Addr.MarshalBinary()
+		if err != nil {
+			continue
+		}
+		f.Nodes = append(f.Nodes, dhtNodesFileNode{
+			Id:       append([]byte(nil), n.ID[:]...),
+			Addr:     addr,
+			LastSeen: n.lastSeen.Unix(),
+		})
+	}
+	b, err := bencode.Marshal(f)
+	if err != nil {
+		return err
+	}
+	// Written to the side and renamed, so that the file isn't left truncated.
+	tmp := name + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0640); err != nil {
+		return err
+	}
+	return os.Rename(tmp, name)
+}
+
+// Adds the current nodes to the saved ones, as seen now, keeping the most recently seen.
+func mergeSavedDhtNodes(saved []savedDhtNode, current []krpc.NodeInfo, now time.Time) (ret []savedDhtNode) {
+	seen := make(map[string]bool)
+	for _, ni := range current {
+		key := ni.Addr.String()
+		if ni.Addr.Port == 0 || seen[key] {
+			continue
+		}
+		seen[key] = true
+		ret = append(ret, savedDhtNode{ni, now})
+	}
+	for _, n := range saved {
+		key := n.Addr.String()
+		if seen[key] || now.Sub(n.lastSeen) >= dhtNodesMaxAge {
+			continue
+		}
+		seen[key] = true
+		ret = append(ret, n)
+	}
+	sort.SliceStable(ret, func(i, j int) bool {
+		return ret[i].lastSeen.After(ret[j].lastSeen)
+	})
+	if len(ret) > maxSavedDhtNodes {
+		ret = ret[:maxSavedDhtNodes]
+	}
+	return
+}
+
+// The nodes read from ClientConfig.DhtNodesFile, and written to it since.
+type dhtNodesSaver struct {
+	mu    sync.Mutex
+	nodes []savedDhtNode
+}
+
+func (cl *Client) loadDhtNodes() {
+	name := cl.config.DhtNodesFile
+	nodes, err := readDhtNodesFile(name, time.Now())
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		cl.logger.WithDefaultLevel(log.Warning).Printf("error reading DHT nodes file %q: %v", name, err)
+	}
+	cl.dhtNodesSaver.nodes = nodes
+}
+
+// Saves the nodes in the DHT servers' routing tables, and those saved before that are still fresh.
+func (cl *Client) saveDhtNodes(servers []DhtServer) error {
+	var current []krpc.NodeInfo
+	for _, s := range servers {
+		if e, ok := s.(DhtNodesExporter); ok {
+			current = append(current, e.Nodes()...)
+		}
+	}
+	me := &cl.dhtNodesSaver
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	me.nodes = mergeSavedDhtNodes(me.nodes, current, time.Now())
+	return writeDhtNodesFile(cl.config.DhtNodesFile, me.nodes)
+}
+
+func (cl *Client) saveDhtNodesPeriodically() {
+	for {
+		select {
+		case <-cl.Closed():
+			return
+		case <-time.After(dhtNodesSaveInterval):
+		}
+		if err := cl.saveDhtNodes(cl.DhtServers()); err != nil {
+			cl.logger.WithDefaultLevel(log.Warning).Printf("error saving DHT nodes: %v", err)
+		}
+	}
+}
+
+// Pings the saved nodes of the server's address family, returning when one replies, so that it's in
+// the routing table, or they've all failed. The rest are left to reply in the background.
+func (cl *Client) pingSavedDhtNodes(s *dht.Server) {
+	ipv6 := addrIpOrNil(s.Addr()).To4() == nil
+	var nodes []savedDhtNode
+	cl.dhtNodesSaver.mu.Lock()
+	for _, n := range cl.dhtNodesSaver.nodes {
+		if (n.Addr.IP.To4() == nil) == ipv6 {
+			nodes = append(nodes, n)
+		}
+	}
+	cl.dhtNodesSaver.mu.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), dhtNodesPingTimeout)
+	results := make(chan bool, len(nodes))
+	var wg sync.WaitGroup
+	for _, n := range nodes {
+		wg.Add(1)
+		go func(addr *net.UDPAddr) {
+			defer wg.Done()
+			res := s.Query(ctx, dht.NewAddr(addr), "ping", dht.QueryInput{})
+			results <- res.Err == nil
+		}(n.Addr.UDP())
+	}
+	go func() {
+		wg.Wait()
+		cancel()
+	}()
+	for range nodes {
+		if <-results {
+			return
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package torrent
+
+import (
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/anacrolix/dht/v2"
+	"github.com/anacrolix/dht/v2/krpc"
+	qt "github.com/frankban/quicktest"
+
+	"github.com/anacrolix/torrent/bencode"
+)
+
+func TestDhtNodesFile(t *testing.T) {
+	c := qt.New(t)
+	name := filepath.Join(t.TempDir(), "dht-nodes")
+	now := time.Now()
+	fresh := krpc.NodeInfo{ID: [20]byte{1}, Addr: krpc.NodeAddr{IP: net.IPv4(1, 2, 3, 4).To4(), Port: 1}}
+	v6 := krpc.NodeInfo{ID: [20]byte{2}, Addr: krpc.NodeAddr{IP: net.ParseIP("2001:db8::1"), Port: 2}}
+	stale := krpc.NodeInfo{ID: [20]byte{3}, Addr: krpc.NodeAddr{IP: net.IPv4(1, 2, 3, 5).To4(), Port: 3}}
+	c.Assert(writeDhtNodesFile(name, []savedDhtNode{
+		{stale, now.Add(-dhtNodesMaxAge)},
+		{fresh, now},
+		{v6, now.Add(-time.Hour)},
+	}), qt.IsNil)
+	nodes, err := readDhtNodesFile(name, now)
+	c.Assert(err, qt.IsNil)
+	c.Assert(nodes, qt.HasLen, 2)
+	c.Check(nodes[0].NodeInfo.Addr.String(), qt.Equals, fresh.Addr.String())
+	c.Check(nodes[0].ID, qt.Equals, fresh.ID)
+	c.Check(nodes[0].lastSeen.Unix(), qt.Equals, now.Unix())
+	c.Check(nodes[1].NodeInfo.Addr.String(), qt.Equals, v6.Addr.String())
+
+	// Entries that can't be decoded are skipped.
+	addr, _ := fresh.Addr.MarshalBinary()
+	b := bencode.MustMarshal(dhtNodesFile{Version: dhtNodesFileVersion, Nodes: []dhtNodesFileNode{
+		{Id: fresh.ID[:], Addr: addr[:5], LastSeen: now.Unix()},
+		{Id: fresh.ID[:19], Addr: addr, LastSeen: now.Unix()},
+		{Id: fresh.ID[:], Addr: addr, LastSeen: now.Unix()},
+	}})
+	c.Assert(ioutil.WriteFile(name, b, 0640), qt.IsNil)
+	nodes, err = readDhtNodesFile(name, now)
+	c.Assert(err, qt.IsNil)
+	c.Check(nodes, qt.HasLen, 1)
+
+	c.Assert(ioutil.WriteFile(name, bencode.MustMarshal(dhtNodesFile{Version: 2}), 0640), qt.IsNil)
+	_, err = readDhtNodesFile(name, now)
+	c.Check(err, qt.ErrorMatches, "unsupported version 2")
+}
+
+func TestMergeSavedDhtNodes(t *testing.T) {
+	c := qt.New(t)
+	now := time.Now()
+	node := func(port int) krpc.NodeInfo {
+		return krpc.NodeInfo{Addr: krpc.NodeAddr{IP: net.IPv4(1, 2, 3, 4).To4(), Port: port}}
+	}
+	var saved []savedDhtNode
+	for i := 1; i <= maxSavedDhtNodes; i++ {
+		saved = append(saved, savedDhtNode{node(i), now.Add(-time.Duration(i) * time.Minute)})
+	}
+	saved = append(saved, savedDhtNode{node(maxSavedDhtNodes + 1), now.Add(-dhtNodesMaxAge)})
+	merged := mergeSavedDhtNodes(saved, []krpc.NodeInfo{node(2), node(maxSavedDhtNodes + 2)}, now)
+	c.Assert(merged, qt.HasLen, maxSavedDhtNodes)
+	c.Check(merged[0].Addr.Port, qt.Equals, 2)
+	c.Check(merged[0].lastSeen, qt.Equals, now)
+	c.Check(merged[1].Addr.Port, qt.Equals, maxSavedDhtNodes+2)
+	c.Check(merged[2].Addr.Port, qt.Equals, 1)
+	// The least recently seen is dropped to make room.
+	c.Check(merged[len(merged)-1].Addr.Port, qt.Equals, maxSavedDhtNodes-1)
+}
+
+// A client started from a saved routing table doesn't need the bootstrap nodes.
+func TestDhtNodesFileRestore(t *testing.T) {
+	c := qt.New(t)
+	node, err := NewClient(dhtTestingConfig(t))
+	c.Assert(err, qt.IsNil)
+	defer node.Close()
+	nodeAddr := node.DhtServers()[0].Addr().(*net.UDPAddr)
+
+	nodesFile := filepath.Join(t.TempDir(), "dht-nodes")
+	cfg := dhtTestingConfig(t)
+	cfg.DisableIPv6 = true
+	cfg.DhtNodesFile = nodesFile
+	first, err := NewClient(cfg)
+	c.Assert(err, qt.IsNil)
+	first.DhtServers()[0].Ping(nodeAddr)
+	first.Close()
+	saved, err := readDhtNodesFile(nodesFile, time.Now())
+	c.Assert(err, qt.IsNil)
+	c.Assert(saved, qt.HasLen, 1)
+	c.Check(saved[0].Addr.String(), qt.Equals, nodeAddr.String())
+
+	bootstrap, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	c.Assert(err, qt.IsNil)
+	defer bootstrap.Close()
+	var gotStartingNodes int32
+	cfg.DhtStartingNodes = func(string) dht.StartingNodesGetter {
+		return func() ([]dht.Addr, error) {
+			atomic.StoreInt32(&gotStartingNodes, 1)
+			return []dht.Addr{dht.NewAddr(bootstrap.LocalAddr())}, nil
+		}
+	}
+	second, err := NewClient(cfg)
+	c.Assert(err, qt.IsNil)
+	defer second.Close()
+	ds := second.DhtServers()[0].(DhtNodesExporter)
+	// The table can also get the first client, which the node knows of.
+	hasNode := func() bool {
+		for _, ni := range ds.Nodes() {
+			if ni.Addr.String() == nodeAddr.String() {
+				return true
+			}
+		}
+		return false
+	}
+	deadline := time.Now().Add(10 * time.Second)
+	for !hasNode() {
+		c.Assert(time.Now().Before(deadline), qt.IsTrue)
+		time.Sleep(10 * time.Millisecond)
+	}
+	// Bootstrapping, which starts once the saved node has replied, goes through it.
+	bootstrap.SetReadDeadline(time.Now().Add(time.Second))
+	_, _, err = bootstrap.ReadFrom(make([]byte, 0x10000))
+	c.Check(err, qt.ErrorMatches, ".*timeout.*")
+	c.Check(atomic.LoadInt32(&gotStartingNodes), qt.Equals, int32(0))
+}
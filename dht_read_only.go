@@ -0,0 +1,53 @@
+package torrent
+
+import (
+	"errors"
+
+	"github.com/anacrolix/dht/v2/krpc"
+
+	"github.com/anacrolix/torrent/bencode"
+)
+
+// Sets whether the DHT is a BEP 43 read-only node, such as for metered networks. Read-only nodes
+// still look up peers and BEP 44 items, but don't reply to queries, and say that they're read-only
+// in their own, so that other nodes don't add them to their routing tables. Torrents don't announce
+// themselves to the DHT while it's read-only.
+func (cl *Client) SetDhtReadOnly(readOnly bool) {
+	cl.lock()
+	defer cl.unlock()
+	cl.dhtReadOnly = readOnly
+	for _, sock := range cl.dhtSockets {
+		sock.serverConn.setReadOnly(readOnly)
+		sock.items.SetReadOnly(readOnly)
+	}
+	// So torrents start or stop announcing.
+	cl.event.Broadcast()
+}
+
+// Whether the DHT is read-only. See SetDhtReadOnly.
+func (cl *Client) DhtReadOnly() bool {
+	cl.rLock()
+	defer cl.rUnlock()
+	return cl.dhtReadOnly
+}
+
+var errDhtReadOnlyAnnounce = errors.New("dht is read-only")
+
+func isDhtQuery(b []byte) bool {
+	y, err := bencode.GetString(b, "y")
+	return err == nil && string(y) == "q"
+}
+
+// Returns the query with the BEP 43 read-only flag set. announce_peer queries that were started
+// before the DHT became read-only are refused.
+func readOnlyDhtQuery(b []byte) ([]byte, error) {
+	var m krpc.Msg
+	if err := bencode.Unmarshal(b, &m); err != nil {
+		return nil, err
+	}
+	if m.Q == "announce_peer" {
+		return nil, errDhtReadOnlyAnnounce
+	}
+	m.ReadOnly = true
+	return bencode.Marshal(m)
+}
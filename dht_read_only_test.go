@@ -0,0 +1,102 @@
+package torrent
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/anacrolix/dht/v2/krpc"
+	qt "github.com/frankban/quicktest"
+
+	"github.com/anacrolix/torrent/bencode"
+)
+
+func TestReadOnlyDhtQuery(t *testing.T) {
+	c := qt.New(t)
+	port := 1
+	m := krpc.Msg{T: "aa", Y: "q", Q: "get_peers", A: &krpc.MsgArgs{ID: krpc.ID{1}, InfoHash: krpc.ID{2}}}
+	b, err := readOnlyDhtQuery(bencode.MustMarshal(m))
+	c.Assert(err, qt.IsNil)
+	m.ReadOnly = true
+	c.Check(string(b), qt.Equals, string(bencode.MustMarshal(m)))
+
+	m = krpc.Msg{T: "aa", Y: "q", Q: "announce_peer", A: &krpc.MsgArgs{ID: krpc.ID{1}, Port: &port}}
+	_, err = readOnlyDhtQuery(bencode.MustMarshal(m))
+	c.Check(err, qt.Equals, errDhtReadOnlyAnnounce)
+}
+
+// Sends a ping to addr, returning whether it's answered.
+func pingDhtAddr(c *qt.C, pc net.PacketConn, addr net.Addr) bool {
+	_, err := pc.WriteTo(bencode.MustMarshal(krpc.Msg{
+		T: "aa", Y: "q", Q: "ping", A: &krpc.MsgArgs{ID: krpc.ID{1}},
+	}), addr)
+	c.Assert(err, qt.IsNil)
+	pc.SetReadDeadline(time.Now().Add(500 * time.Millisecond))
+	_, _, err = pc.ReadFrom(make([]byte, 0x10000))
+	return err == nil
+}
+
+func TestDhtReadOnly(t *testing.T) {
+	c := qt.New(t)
+	nodeCfg := dhtTestingConfig(t)
+	var (
+		mu          sync.Mutex
+		queries     []string
+		allRo       = true
+		gotGetPeers = make(chan struct{}, 1)
+	)
+	nodeCfg.DHTOnQuery = func(m *krpc.Msg, _ net.Addr) bool {
+		mu.Lock()
+		queries = append(queries, m.Q)
+		allRo = allRo && m.ReadOnly
+		mu.Unlock()
+		if m.Q == "get_peers" {
+			select {
+			case gotGetPeers <- struct{}{}:
+			default:
+			}
+		}
+		return true
+	}
+	node, err := NewClient(nodeCfg)
+	c.Assert(err, qt.IsNil)
+	defer node.Close()
+
+	cfg := dhtTestingConfig(t)
+	cfg.DisableIPv6 = true
+	cfg.DhtReadOnly = true
+	cl, err := NewClient(cfg)
+	c.Assert(err, qt.IsNil)
+	defer cl.Close()
+	c.Check(cl.DhtReadOnly(), qt.IsTrue)
+	ds := cl.DhtServers()[0]
+	res := ds.(anacrolixDhtServerWrapper).Server.Ping(node.DhtServers()[0].Addr().(*net.UDPAddr))
+	c.Assert(res.Err, qt.IsNil)
+
+	// Queries aren't answered.
+	probe, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	c.Assert(err, qt.IsNil)
+	defer probe.Close()
+	c.Check(pingDhtAddr(c, probe, ds.Addr()), qt.IsFalse)
+
+	// Peers are looked up, but not announced to.
+	tor, _ := cl.AddTorrentInfoHash([20]byte{1})
+	defer tor.Drop()
+	select {
+	case <-gotGetPeers:
+	case <-time.After(10 * time.Second):
+		c.Fatal("no get_peers")
+	}
+	time.Sleep(time.Second)
+	mu.Lock()
+	c.Check(queries, qt.Not(qt.Contains), "announce_peer")
+	c.Check(queries, qt.Contains, "ping")
+	c.Check(allRo, qt.IsTrue)
+	mu.Unlock()
+
+	// The DHT can be made writable again.
+	cl.SetDhtReadOnly(false)
+	c.Check(cl.DhtReadOnly(), qt.IsFalse)
+	c.Check(pingDhtAddr(c, probe, ds.Addr()), qt.IsTrue)
+}
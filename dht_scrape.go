@@ -0,0 +1,131 @@
+package torrent
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/bits"
+	"sync"
+
+	"github.com/anacrolix/dht/v2/krpc"
+)
+
+// The size, in bits, and number of hashes of BEP 33 scrape bloom filters.
+const (
+	scrapeBloomFilterBits   = len(krpc.ScrapeBloomFilter{}) * 8
+	scrapeBloomFilterHashes = 2
+)
+
+// Estimates the number of IPs that have been added to a BEP 33 bloom filter of m bits, from the
+// number of them that are unset, c: ln(c/m) / (k * ln(1 - 1/m)). As in the BEP, c is at most m - 1,
+// and it's at least 1, so that a full filter doesn't estimate infinitely many.
+func estimateScrapeBloomFilterCount(bf *krpc.ScrapeBloomFilter) float64 {
+	c := 0
+	for _, b := range bf {
+		c += 8 - bits.OnesCount8(b)
+	}
+	if c > scrapeBloomFilterBits-1 {
+		c = scrapeBloomFilterBits - 1
+	}
+	if c < 1 {
+		c = 1
+	}
+	m := float64(scrapeBloomFilterBits)
+	return math.Log(float64(c)/m) / (scrapeBloomFilterHashes * math.Log(1-1/m))
+}
+
+// Rounds an estimate down. n IPs with no bits in common estimate a little over n, and the cap on
+// unset bits has an empty filter estimate a half.
+func scrapeBloomFilterCount(bf *krpc.ScrapeBloomFilter) int {
+	return int(estimateScrapeBloomFilterCount(bf))
+}
+
+// Combines the filters of a scrape's replies. The union of the IPs in the filters is in the result.
+func unionScrapeBloomFilter(dst *krpc.ScrapeBloomFilter, src *krpc.ScrapeBloomFilter) {
+	for i := range dst {
+		dst[i] |= src[i]
+	}
+}
+
+// Estimates the number of seeds and leechers in the torrent's swarm with a BEP 33 scrape of the
+// DHT, for torrents without trackers to ask. The nodes for the infohash give bloom filters of the
+// IPs that have announced to them, which are combined so that peers announcing to several nodes are
+// only counted once. Nodes that don't support scrapes are skipped. Returns when the traversal
+// completes, or with what's been gathered when ctx is done.
+func (t *Torrent) DhtScrape(ctx context.Context) (seeds, leechers int, err error) {
+	t.cl.rLock()
+	enabled := t.dhtEnabled()
+	t.cl.rUnlock()
+	if !enabled {
+		err = errors.New("dht not enabled for torrent")
+		return
+	}
+	var (
+		mu      sync.Mutex
+		bfsd    krpc.ScrapeBloomFilter
+		bfpe    krpc.ScrapeBloomFilter
+		replies int
+		wg      sync.WaitGroup
+		anns    []DhtAnnounce
+	)
+	for _, s := range t.cl.DhtServers() {
+		scraper, ok := s.(DhtScraper)
+		if !ok {
+			continue
+		}
+		ann, annErr := scraper.Scrape(t.infoHash)
+		if annErr != nil {
+			err = annErr
+			continue
+		}
+		anns = append(anns, ann)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for pv := range ann.Peers() {
+				if pv.BFsd == nil && pv.BFpe == nil {
+					continue
+				}
+				mu.Lock()
+				replies++
+				if pv.BFsd != nil {
+					unionScrapeBloomFilter(&bfsd, pv.BFsd)
+				}
+				if pv.BFpe != nil {
+					unionScrapeBloomFilter(&bfpe, pv.BFpe)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	if len(anns) == 0 {
+		if err == nil {
+			err = errors.New("no dht servers that can scrape")
+		}
+		return
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+	for _, ann := range anns {
+		ann.Close()
+	}
+	<-done
+	err = nil
+	if replies == 0 {
+		err = ctx.Err()
+		if err == nil {
+			err = errors.New("no dht nodes replied with scrapes")
+		}
+		return
+	}
+	seeds = scrapeBloomFilterCount(&bfsd)
+	leechers = scrapeBloomFilterCount(&bfpe)
+	return
+}
@@ -0,0 +1,132 @@
+package torrent
+
+import (
+	"context"
+	"math"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/anacrolix/dht/v2"
+	"github.com/anacrolix/dht/v2/krpc"
+	qt "github.com/frankban/quicktest"
+
+	"github.com/anacrolix/torrent/bencode"
+)
+
+func scrapeBloomFilterOf(ips []net.IP) (ret krpc.ScrapeBloomFilter) {
+	for _, ip := range ips {
+		ret.AddIp(ip)
+	}
+	return
+}
+
+func scrapeTestIps(from, to int) (ret []net.IP) {
+	for i := from; i < to; i++ {
+		ret = append(ret, net.IPv4(192, 0, 2, byte(i)).To4())
+	}
+	return
+}
+
+func TestEstimateScrapeBloomFilterCount(t *testing.T) {
+	c := qt.New(t)
+	// The test vector from BEP 33.
+	ips := scrapeTestIps(0, 256)
+	for i := 0; i < 1000; i++ {
+		ip := net.ParseIP("2001:db8::")
+		ip[14], ip[15] = byte(i>>8), byte(i)
+		ips = append(ips, ip)
+	}
+	bf := scrapeBloomFilterOf(ips)
+	c.Check(math.Abs(estimateScrapeBloomFilterCount(&bf)-1224.9308) < 1e-4, qt.IsTrue,
+		qt.Commentf("%v", estimateScrapeBloomFilterCount(&bf)))
+	c.Check(scrapeBloomFilterCount(&bf), qt.Equals, 1224)
+
+	var empty krpc.ScrapeBloomFilter
+	c.Check(estimateScrapeBloomFilterCount(&empty), qt.Equals, 0.5)
+	c.Check(scrapeBloomFilterCount(&empty), qt.Equals, 0)
+	one := scrapeBloomFilterOf(scrapeTestIps(0, 1))
+	c.Check(scrapeBloomFilterCount(&one), qt.Equals, 1)
+	var full krpc.ScrapeBloomFilter
+	for i := range full {
+		full[i] = 0xff
+	}
+	c.Check(math.IsInf(estimateScrapeBloomFilterCount(&full), 0), qt.IsFalse)
+
+	// The union of filters is the filter of the union.
+	bf = scrapeBloomFilterOf(scrapeTestIps(0, 10))
+	other := scrapeBloomFilterOf(scrapeTestIps(5, 15))
+	unionScrapeBloomFilter(&bf, &other)
+	c.Check(bf, qt.Equals, scrapeBloomFilterOf(scrapeTestIps(0, 15)))
+}
+
+// Starts a DHT node that replies to get_peers scrapes with filters of the seed and peer IPs.
+func startScrapeNode(c *qt.C, seeds, peers []net.IP) *net.UDPAddr {
+	pc, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	c.Assert(err, qt.IsNil)
+	c.Cleanup(func() { pc.Close() })
+	bfsd := scrapeBloomFilterOf(seeds)
+	bfpe := scrapeBloomFilterOf(peers)
+	id := krpc.ID(dht.RandomNodeID())
+	go func() {
+		b := make([]byte, 0x10000)
+		for {
+			n, addr, err := pc.ReadFrom(b)
+			if err != nil {
+				return
+			}
+			var m krpc.Msg
+			if bencode.Unmarshal(b[:n], &m) != nil || m.Y != "q" {
+				continue
+			}
+			r := krpc.Return{ID: id}
+			if m.Q == "get_peers" && m.A != nil && m.A.Scrape == 1 {
+				r.BFsd = &bfsd
+				r.BFpe = &bfpe
+			}
+			pc.WriteTo(bencode.MustMarshal(krpc.Msg{T: m.T, Y: "r", R: &r}), addr)
+		}
+	}()
+	return pc.LocalAddr().(*net.UDPAddr)
+}
+
+func TestDhtScrape(t *testing.T) {
+	c := qt.New(t)
+	// This node doesn't support scrapes.
+	plain, err := NewClient(dhtTestingConfig(t))
+	c.Assert(err, qt.IsNil)
+	defer plain.Close()
+	plainAddr := plain.DhtServers()[0].Addr().(*net.UDPAddr)
+	newScraper := func(nodes ...*net.UDPAddr) *Torrent {
+		cfg := dhtTestingConfig(t)
+		cfg.DisableIPv6 = true
+		cl, err := NewClient(cfg)
+		c.Assert(err, qt.IsNil)
+		c.Cleanup(cl.Close)
+		for _, n := range nodes {
+			cl.DhtServers()[0].Ping(n)
+		}
+		tor, _ := cl.AddTorrentInfoHash([20]byte{1})
+		return tor
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tor := newScraper(
+		startScrapeNode(c, scrapeTestIps(0, 10), scrapeTestIps(100, 120)),
+		startScrapeNode(c, scrapeTestIps(5, 15), scrapeTestIps(110, 130)),
+		plainAddr,
+	)
+	seeds, leechers, err := tor.DhtScrape(ctx)
+	c.Assert(err, qt.IsNil)
+	// Peers that announced to both nodes are counted once.
+	bfsd := scrapeBloomFilterOf(scrapeTestIps(0, 15))
+	bfpe := scrapeBloomFilterOf(scrapeTestIps(100, 130))
+	c.Check(seeds, qt.Equals, scrapeBloomFilterCount(&bfsd))
+	c.Check(leechers, qt.Equals, scrapeBloomFilterCount(&bfpe))
+	c.Check(seeds >= 14 && seeds <= 15, qt.IsTrue, qt.Commentf("%v", seeds))
+	c.Check(leechers >= 29 && leechers <= 30, qt.IsTrue, qt.Commentf("%v", leechers))
+
+	_, _, err = newScraper(plainAddr).DhtScrape(ctx)
+	c.Check(err, qt.ErrorMatches, "no dht nodes replied with scrapes")
+}
@@ -0,0 +1,259 @@
+package torrent
+
+import (
+	"errors"
+	"net"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/anacrolix/dht/v2"
+	"github.com/anacrolix/dht/v2/krpc"
+	"github.com/anacrolix/log"
+
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/bep44"
+)
+
+// How strictly BEP 42 is enforced on other DHT nodes. It ties node IDs to IPs, so that nodes can't
+// choose where they go in the keyspace. Our own node IDs are derived from our public IP, once it's
+// known, whatever the setting.
+type DhtSecurity int
+
+const (
+	// Nodes whose IDs don't match their IPs count as bad: they're dropped from the routing table to
+	// make room for other nodes, and aren't given out to other nodes.
+	DhtSecurityPrefer DhtSecurity = iota
+	// Node IDs aren't checked, for networks where NAT has nodes seeing the wrong IPs.
+	DhtSecurityOff
+	// Packets from nodes whose IDs don't match their IPs are dropped, so those nodes aren't used at
+	// all.
+	DhtSecurityRequire
+)
+
+// Returns a random node ID that's secure for ip, per BEP 42.
+func secureDhtNodeId(ip net.IP) (id [20]byte) {
+	id = dht.RandomNodeID()
+	dht.SecureNodeId(&id, ip)
+	return
+}
+
+// Whether a query or response is from a node with an ID that's secure for its IP. Other packets, and
+// those without a well-formed ID, are left to the dht package to deal with.
+func dhtPacketIdSecure(b []byte, from net.Addr) bool {
+	y, err := bencode.GetString(b, "y")
+	if err != nil {
+		return true
+	}
+	var key string
+	switch string(y) {
+	case "q":
+		key = "a"
+	case "r":
+		key = "r"
+	default:
+		return true
+	}
+	id, err := bencode.GetString(b, key, "id")
+	if err != nil || len(id) != 20 {
+		return true
+	}
+	var _id [20]byte
+	copy(_id[:], id)
+	return dht.NodeIdSecure(_id, addrIpOrNil(from))
+}
+
+// Our public IP as it's seen by DHT nodes on the conn. Call with the client lock held.
+func (cl *Client) dhtPublicIp(conn net.PacketConn) net.IP {
+	if ip := cl.knownPublicIp(false); connIsIpv6(conn) && ip != nil {
+		return ip
+	}
+	return cl.knownPublicIp(true)
+}
+
+// One of the Client's sockets, and the anacrolix/dht Server on it. The ID of a running Server is
+// fixed, so the Server is closed and replaced when our public IP changes and its ID isn't secure for
+// the new one. Guarded by the client lock.
+type dhtSocket struct {
+	// The conn shared with the BEP 44 server, which handles its packets first.
+	conn   net.PacketConn
+	items  *bep44.Server
+	server *dht.Server
+	// The conn of the server.
+	serverConn *dhtServerConn
+}
+
+// Starts a Server on the socket, with the nodes in its routing table to begin with, and has the
+// socket use it.
+func (cl *Client) startDhtSocketServer(sock *dhtSocket, nodes []krpc.NodeInfo) error {
+	sc := &dhtServerConn{
+		PacketConn: sock.conn,
+		require:    cl.config.DhtSecurity == DhtSecurityRequire,
+		closed:     make(chan struct{}),
+	}
+	sc.setReadOnly(cl.dhtReadOnly)
+	sock.items.SetReadOnly(cl.dhtReadOnly)
+	s, err := cl.newAnacrolixDhtServer(sc, nodes)
+	if err != nil {
+		return err
+	}
+	sc.server = s
+	sock.items.SetTable(s)
+	sock.server = s
+	sock.serverConn = sc
+	return nil
+}
+
+func (sock *dhtSocket) close() {
+	sock.server.Close()
+}
+
+// Replaces the DHT servers whose IDs aren't secure for our public IP, now that it's changed. The
+// replacements start with the routing tables of the servers they replace, which are closed. Call
+// with the client lock held.
+func (cl *Client) resecureDhtServers() {
+	for _, sock := range cl.dhtSockets {
+		ip := cl.dhtPublicIp(sock.conn)
+		old := sock.server
+		if ip == nil || dht.NodeIdSecure(old.ID(), ip) {
+			continue
+		}
+		if err := cl.startDhtSocketServer(sock, old.Nodes()); err != nil {
+			cl.logger.WithDefaultLevel(log.Warning).Printf("error replacing dht server: %v", err)
+			continue
+		}
+		cl.logger.WithDefaultLevel(log.Debug).Printf("replaced %v, for public ip %v", old, ip)
+		cl.replaceDhtServer(anacrolixDhtServerWrapper{old}, anacrolixDhtServerWrapper{sock.server})
+		old.Close()
+	}
+}
+
+// Has the torrents announce to the new DHT server in place of the old. Call with the client lock
+// held.
+func (cl *Client) replaceDhtServer(old, new DhtServer) {
+	servers := make([]DhtServer, 0, len(cl.dhtServers))
+	for _, s := range cl.dhtServers {
+		if s == old {
+			s = new
+		}
+		servers = append(servers, s)
+	}
+	cl.dhtServers = servers
+	for _, t := range cl.torrents {
+		go t.dhtAnnouncer(new)
+	}
+	// The old server's announcers return when they see it's gone.
+	cl.event.Broadcast()
+}
+
+// Whether the DHT server hasn't been replaced. Call with the client lock held.
+func (cl *Client) dhtServerCurrent(s DhtServer) bool {
+	for _, have := range cl.dhtServers {
+		if have == s {
+			return true
+		}
+	}
+	return false
+}
+
+var errDhtServerClosed = errors.New("dht server closed")
+
+// The conn of one of a dhtSocket's Servers. Closing it leaves the socket open for the Server that
+// replaces it, if there is one, and stops the Server's questionable node pinger, which doesn't
+// return when the Server is closed, and would spin. Enforces DhtSecurityRequire, and makes the Server read-only when the
+// DHT is, since the dht package only does that for Servers that are Passive from the start.
+type dhtServerConn struct {
+	net.PacketConn
+	require   bool
+	server    *dht.Server
+	closed    chan struct{}
+	closeOnce sync.Once
+	// Accessed atomically.
+	readOnly int32
+}
+
+func (me *dhtServerConn) ReadFrom(b []byte) (n int, addr net.Addr, err error) {
+	for {
+		n, addr, err = me.PacketConn.ReadFrom(b)
+		select {
+		case <-me.closed:
+			// The packet was for the replacement, if there is one, but one lost packet is no
+			// matter.
+			return 0, nil, errDhtServerClosed
+		default:
+		}
+		if err != nil {
+			return
+		}
+		if me.isReadOnly() && isDhtQuery(b[:n]) {
+			continue
+		}
+		if !me.require || dhtPacketIdSecure(b[:n], addr) {
+			return
+		}
+	}
+}
+
+func (me *dhtServerConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	select {
+	case <-me.closed:
+		return 0, errDhtServerClosed
+	default:
+	}
+	if me.isReadOnly() && isDhtQuery(b) {
+		ro, err := readOnlyDhtQuery(b)
+		if err != nil {
+			return 0, err
+		}
+		// The caller's packet was all written, if differently.
+		if _, err := me.PacketConn.WriteTo(ro, addr); err != nil {
+			return 0, err
+		}
+		return len(b), nil
+	}
+	return me.PacketConn.WriteTo(b, addr)
+}
+
+// Doesn't close the socket, which is closed with the Client. The Server's read in progress returns
+// with the next packet. Called by the Server's Close, with the Server locked.
+func (me *dhtServerConn) Close() error {
+	me.closeOnce.Do(func() {
+		close(me.closed)
+		// A node for the pinger to ping, so that it does, and exits. See logger.
+		id := me.server.ID()
+		id[19] ^= 1
+		me.server.AddNode(krpc.NodeInfo{ID: id, Addr: krpc.NodeAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1}})
+	})
+	return nil
+}
+
+// What the questionable node pinger of an anacrolix/dht Server logs before each ping.
+const dhtPingerLogText = "pinging questionable node"
+
+// Wraps the logger of the conn's Server, so that the Server's questionable node pinger exits when it
+// goes to ping after the Server is closed. No locks are held by the pinger when it logs.
+func (me *dhtServerConn) logger(l log.Logger) log.Logger {
+	return l.WithFilter(func(m log.Msg) bool {
+		select {
+		case <-me.closed:
+			if strings.HasPrefix(m.Text(), dhtPingerLogText) {
+				runtime.Goexit()
+			}
+		default:
+		}
+		return true
+	})
+}
+
+func (me *dhtServerConn) setReadOnly(readOnly bool) {
+	var i int32
+	if readOnly {
+		i = 1
+	}
+	atomic.StoreInt32(&me.readOnly, i)
+}
+
+func (me *dhtServerConn) isReadOnly() bool {
+	return atomic.LoadInt32(&me.readOnly) != 0
+}
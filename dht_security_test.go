@@ -0,0 +1,186 @@
+package torrent
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/anacrolix/dht/v2"
+	"github.com/anacrolix/dht/v2/krpc"
+	qt "github.com/frankban/quicktest"
+
+	"github.com/anacrolix/torrent/bencode"
+)
+
+// The test vectors from BEP 42.
+var dhtSecurityVectors = []struct {
+	ip string
+	id string
+}{
+	{"124.31.75.21", "5fbfbff10c5d6a4ec8a88e4c6ab4c28b95eee401"},
+	{"21.75.31.124", "5a3ce9c14e7a08645677bbd1cfe7d8f956d53256"},
+	{"65.23.51.170", "a5d43220bc8f112a3d426c84764f8c2a1150e616"},
+	{"84.124.73.14", "1b0321dd1bb1fe518101ceef99462b947a01ff41"},
+	{"43.213.53.83", "e56f6cbf5b7c4be0237986d5243b87aa6d51305a"},
+}
+
+func dhtSecurityVector(c *qt.C, i int) (ip net.IP, id [20]byte) {
+	v := dhtSecurityVectors[i]
+	b, err := hex.DecodeString(v.id)
+	c.Assert(err, qt.IsNil)
+	copy(id[:], b)
+	return net.ParseIP(v.ip), id
+}
+
+func TestSecureDhtNodeId(t *testing.T) {
+	c := qt.New(t)
+	for i := range dhtSecurityVectors {
+		ip, want := dhtSecurityVector(c, i)
+		c.Check(dht.NodeIdSecure(want, ip), qt.IsTrue, qt.Commentf("%v", ip))
+		// The first 21 bits come from the IP and the last byte.
+		id := want
+		id[0], id[1], id[2] = 0, 0, id[2]&7
+		dht.SecureNodeId(&id, ip)
+		c.Check(id, qt.Equals, want, qt.Commentf("%v", ip))
+		// Other IPs don't match.
+		other, _ := dhtSecurityVector(c, (i+1)%len(dhtSecurityVectors))
+		c.Check(dht.NodeIdSecure(want, other), qt.IsFalse, qt.Commentf("%v", ip))
+
+		id = secureDhtNodeId(ip)
+		c.Check(dht.NodeIdSecure(id, ip), qt.IsTrue, qt.Commentf("%v", ip))
+	}
+}
+
+func TestDhtPacketIdSecure(t *testing.T) {
+	c := qt.New(t)
+	ip, id := dhtSecurityVector(c, 0)
+	other, _ := dhtSecurityVector(c, 1)
+	query := bencode.MustMarshal(map[string]interface{}{
+		"t": "aa", "y": "q", "q": "ping", "a": map[string]interface{}{"id": string(id[:])},
+	})
+	response := bencode.MustMarshal(map[string]interface{}{
+		"t": "aa", "y": "r", "r": map[string]interface{}{"id": string(id[:])},
+	})
+	for _, b := range [][]byte{query, response} {
+		c.Check(dhtPacketIdSecure(b, &net.UDPAddr{IP: ip, Port: 1}), qt.IsTrue)
+		c.Check(dhtPacketIdSecure(b, &net.UDPAddr{IP: other, Port: 1}), qt.IsFalse)
+		// Local networks are exempt.
+		c.Check(dhtPacketIdSecure(b, &net.UDPAddr{IP: net.IPv4(192, 168, 1, 1), Port: 1}), qt.IsTrue)
+	}
+	// Those that have no ID to check are left alone.
+	c.Check(dhtPacketIdSecure([]byte("d1:t2:aa1:y1:e1:eli201e1:xee"), &net.UDPAddr{IP: other}), qt.IsTrue)
+	c.Check(dhtPacketIdSecure([]byte("d1:y1:re"), &net.UDPAddr{IP: other}), qt.IsTrue)
+}
+
+// Reporting our public IP replaces the DHT servers with ones that have IDs secure for it, keeping
+// their routing tables.
+func TestDhtServersResecuredOnPublicIpChange(t *testing.T) {
+	c := qt.New(t)
+	nodeCfg := dhtTestingConfig(t)
+	getPeersFrom := make(chan [20]byte, 100)
+	nodeCfg.DHTOnQuery = func(m *krpc.Msg, _ net.Addr) bool {
+		if m.Q == "get_peers" && m.SenderID() != nil {
+			select {
+			case getPeersFrom <- *m.SenderID():
+			default:
+			}
+		}
+		return true
+	}
+	node, err := NewClient(nodeCfg)
+	c.Assert(err, qt.IsNil)
+	defer node.Close()
+	nodeAddr := node.DhtServers()[0].Addr().(*net.UDPAddr)
+
+	cfg := dhtTestingConfig(t)
+	cfg.DisableIPv6 = true
+	cl, err := NewClient(cfg)
+	c.Assert(err, qt.IsNil)
+	defer cl.Close()
+	old := cl.DhtServers()[0]
+	old.Ping(nodeAddr)
+	c.Assert(old.(DhtNodesExporter).Nodes(), qt.HasLen, 1)
+	tor, _ := cl.AddTorrentInfoHash([20]byte{1})
+	defer tor.Drop()
+
+	ip, _ := dhtSecurityVector(c, 0)
+	cl.lock()
+	cl.reportPublicIp("test", ip)
+	cl.unlock()
+	servers := cl.DhtServers()
+	c.Assert(servers, qt.HasLen, 1)
+	s := servers[0]
+	c.Check(s, qt.Not(qt.Equals), old)
+	c.Check(dht.NodeIdSecure(s.ID(), ip), qt.IsTrue)
+	c.Check(s.Addr().String(), qt.Equals, old.Addr().String())
+	c.Check(s.(DhtNodesExporter).Nodes()[0].Addr.String(), qt.Equals, nodeAddr.String())
+	// The old server is closed.
+	c.Check(old.(anacrolixDhtServerWrapper).Server.Ping(nodeAddr).Err, qt.ErrorMatches, ".*"+errDhtServerClosed.Error())
+	// The torrent announces with the new server.
+	timeout := time.After(10 * time.Second)
+	for id := [20]byte{}; id != s.ID(); {
+		select {
+		case id = <-getPeersFrom:
+		case <-timeout:
+			c.Fatal("no announce from the new server")
+		}
+	}
+
+	// The same IP again doesn't change anything.
+	cl.lock()
+	cl.reportPublicIp("test2", ip)
+	cl.unlock()
+	c.Check(cl.DhtServers()[0], qt.Equals, s)
+}
+
+// The number of running questionable node pingers of the anacrolix/dht Servers.
+func numDhtPingers(servers []*dht.Server) (n int) {
+	buf := make([]byte, 1<<20)
+	for {
+		m := runtime.Stack(buf, true)
+		if m == len(buf) {
+			buf = make([]byte, 2*len(buf))
+			continue
+		}
+		for _, s := range servers {
+			n += strings.Count(string(buf[:m]), fmt.Sprintf("(*Server).questionableNodePinger(%p)", s))
+		}
+		return
+	}
+}
+
+// Waits for the number of running pingers of the Servers to be want.
+func waitDhtPingers(c *qt.C, servers []*dht.Server, want int) {
+	for deadline := time.Now().Add(10 * time.Second); numDhtPingers(servers) != want; {
+		if time.Now().After(deadline) {
+			c.Fatalf("%v dht pingers running, want %v", numDhtPingers(servers), want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestDhtServersClosed(t *testing.T) {
+	c := qt.New(t)
+	cl, err := NewClient(dhtTestingConfig(t))
+	c.Assert(err, qt.IsNil)
+	var servers []*dht.Server
+	cl.lock()
+	for _, sock := range cl.dhtSockets {
+		servers = append(servers, sock.server)
+	}
+	ip, _ := dhtSecurityVector(c, 0)
+	cl.reportPublicIp("test", ip)
+	for i, sock := range cl.dhtSockets {
+		c.Assert(sock.server, qt.Not(qt.Equals), servers[i])
+		servers = append(servers, sock.server)
+	}
+	cl.unlock()
+	// The replaced servers are closed.
+	waitDhtPingers(c, servers, len(cl.dhtSockets))
+	cl.Close()
+	waitDhtPingers(c, servers, 0)
+}
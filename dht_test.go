@@ -0,0 +1,53 @@
+package torrent
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/anacrolix/dht/v2"
+	qt "github.com/frankban/quicktest"
+
+	"github.com/anacrolix/torrent/internal/testutil"
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+func dhtTestingConfig(t *testing.T) *ClientConfig {
+	cfg := TestingConfig(t)
+	cfg.NoDHT = false
+	cfg.DhtStartingNodes = func(string) dht.StartingNodesGetter {
+		return func() ([]dht.Addr, error) { return nil, nil }
+	}
+	return cfg
+}
+
+// The metainfo's nodes are the only way the leecher has to find the seeder, there being no
+// trackers or DHT bootstrap nodes.
+func TestDhtNodesFromMetaInfo(t *testing.T) {
+	c := qt.New(t)
+	dir, mi := testutil.GreetingTestTorrent()
+	defer os.RemoveAll(dir)
+	cfg := dhtTestingConfig(t)
+	cfg.DataDir = dir
+	cfg.Seed = true
+	seeder, err := NewClient(cfg)
+	c.Assert(err, qt.IsNil)
+	defer seeder.Close()
+	seederTorrent, err := seeder.AddTorrent(mi)
+	c.Assert(err, qt.IsNil)
+	seederTorrent.VerifyData()
+
+	leecher, err := NewClient(dhtTestingConfig(t))
+	c.Assert(err, qt.IsNil)
+	defer leecher.Close()
+	mi.Nodes = []metainfo.Node{metainfo.Node(seeder.DhtServers()[0].Addr().String())}
+	spec := TorrentSpecFromMetaInfo(mi)
+	spec.InfoBytes = nil
+	leecherTorrent, _, err := leecher.AddTorrentSpec(spec)
+	c.Assert(err, qt.IsNil)
+	select {
+	case <-leecherTorrent.GotInfo():
+	case <-time.After(10 * time.Second):
+		c.Fatal("didn't get info")
+	}
+}
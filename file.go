@@ -91,9 +91,10 @@ func (f *File) bytesLeft() (left int64) {
 // The relative file path for a multi-file torrent, and the torrent name for a
 // single-file torrent.
 func (f *File) DisplayPath() string {
-	fip := f.FileInfo().Path
+	fi := f.FileInfo()
+	fip := fi.BestPath()
 	if len(fip) == 0 {
-		return f.t.info.Name
+		return f.t.info.BestName()
 	}
 	return strings.Join(fip, "/")
 }
@@ -172,7 +172,7 @@ func (rn rootNode) ReadDirAll(ctx context.Context) (dirents []fuse.Dirent, err e
 			continue
 		}
 		dirents = append(dirents, fuse.Dirent{
-			Name: info.Name,
+			Name: info.BestName(),
 			Type: func() fuse.DirentType {
 				if !info.IsDir() {
 					return fuse.DT_File
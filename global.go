@@ -18,6 +18,7 @@ const (
 const (
 	metadataExtendedId = iota + 1 // 0 is reserved for deleting keys
 	pexExtendedId
+	texExtendedId
 )
 
 func defaultPeerExtensionBytes() PeerExtensionBits {
@@ -0,0 +1,63 @@
+// Package merkle implements the SHA-256 merkle trees used to hash file contents in BitTorrent v2.
+// See BEP 52.
+package merkle
+
+import (
+	"crypto/sha256"
+	"fmt"
+)
+
+// The size of the data blocks that form the leaves of a file's tree.
+const BlockSize = 1 << 14
+
+type Hash = [sha256.Size]byte
+
+// Returns the root of the tree with the given leaves. The leaves are padded out to a power of two
+// with padHash, which should be the root of a subtree of the same height as the leaves, filled
+// with zero hashes.
+func Root(leaves []Hash, padHash Hash) Hash {
+	if len(leaves) == 0 {
+		return padHash
+	}
+	layer := make([]Hash, RoundUpToPowerOfTwo(uint(len(leaves))))
+	n := copy(layer, leaves)
+	for i := n; i < len(layer); i++ {
+		layer[i] = padHash
+	}
+	for len(layer) > 1 {
+		for i := 0; i < len(layer)/2; i++ {
+			layer[i] = hashPair(layer[2*i], layer[2*i+1])
+		}
+		layer = layer[:len(layer)/2]
+	}
+	return layer[0]
+}
+
+// Returns the root of a tree with numLeaves zero hashes as leaves. numLeaves must be a power of
+// two.
+func ZeroRoot(numLeaves int) (ret Hash) {
+	if numLeaves&(numLeaves-1) != 0 {
+		panic(fmt.Sprintf("%d not a power of two", numLeaves))
+	}
+	for ; numLeaves > 1; numLeaves /= 2 {
+		ret = hashPair(ret, ret)
+	}
+	return
+}
+
+func hashPair(l, r Hash) Hash {
+	h := sha256.New()
+	h.Write(l[:])
+	h.Write(r[:])
+	var ret Hash
+	h.Sum(ret[:0])
+	return ret
+}
+
+func RoundUpToPowerOfTwo(n uint) (ret uint) {
+	ret = 1
+	for ret < n {
+		ret <<= 1
+	}
+	return
+}
@@ -0,0 +1,28 @@
+package merkle
+
+import (
+	"crypto/sha256"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestRootSingleLeaf(t *testing.T) {
+	leaf := sha256.Sum256([]byte("hello"))
+	qt.Assert(t, Root([]Hash{leaf}, Hash{}), qt.Equals, leaf)
+}
+
+func TestRootPadding(t *testing.T) {
+	a := sha256.Sum256([]byte("a"))
+	b := sha256.Sum256([]byte("b"))
+	c := sha256.Sum256([]byte("c"))
+	ab := hashPair(a, b)
+	cz := hashPair(c, Hash{})
+	qt.Assert(t, Root([]Hash{a, b, c}, Hash{}), qt.Equals, hashPair(ab, cz))
+}
+
+func TestZeroRoot(t *testing.T) {
+	qt.Assert(t, ZeroRoot(1), qt.Equals, Hash{})
+	qt.Assert(t, ZeroRoot(4), qt.Equals, Root(make([]Hash, 4), Hash{}))
+	qt.Assert(t, func() { ZeroRoot(3) }, qt.PanicMatches, "3 not a power of two")
+}
@@ -1,5 +1,11 @@
 package metainfo
 
+import (
+	"math/rand"
+	"net/url"
+	"strings"
+)
+
 type AnnounceList [][]string
 
 func (al AnnounceList) Clone() (ret AnnounceList) {
@@ -21,6 +27,7 @@ func (al AnnounceList) OverridesAnnounce(announce string) bool {
 	return false
 }
 
+// Returns the set of URLs. Use OrderedDistinctValues where the order matters.
 func (al AnnounceList) DistinctValues() (ret map[string]struct{}) {
 	for _, tier := range al {
 		for _, v := range tier {
@@ -32,3 +39,124 @@ func (al AnnounceList) DistinctValues() (ret map[string]struct{}) {
 	}
 	return
 }
+
+// Returns each URL once, tier by tier, in the order they're stored.
+func (al AnnounceList) OrderedDistinctValues() (ret []string) {
+	seen := make(map[string]struct{})
+	for _, tier := range al {
+		for _, v := range tier {
+			if _, ok := seen[v]; ok {
+				continue
+			}
+			seen[v] = struct{}{}
+			ret = append(ret, v)
+		}
+	}
+	return
+}
+
+// Returns a copy with the URLs within each tier shuffled, and the tiers in their original order.
+// BEP 12 has clients do this once when a torrent is loaded.
+func (al AnnounceList) ShuffledTiers(r *rand.Rand) (ret AnnounceList) {
+	ret = al.Clone()
+	for _, tier := range ret {
+		r.Shuffle(len(tier), func(i, j int) { tier[i], tier[j] = tier[j], tier[i] })
+	}
+	return
+}
+
+// Appends a tier of the URLs that aren't already in the list. Nothing is added if that leaves the
+// tier empty. Surrounding whitespace is trimmed, and empty URLs are ignored.
+func (al *AnnounceList) AddTier(urls ...string) {
+	var tier []string
+	for _, url := range urls {
+		url = strings.TrimSpace(url)
+		if url != "" && !al.contains(url) && !containsString(tier, url) {
+			tier = append(tier, url)
+		}
+	}
+	if len(tier) != 0 {
+		*al = append(*al, tier)
+	}
+}
+
+// Appends the URL to tier i, unless it's already in the list. If there's no tier i, the URL is added
+// in a new tier at the end. Surrounding whitespace is trimmed, and an empty URL is ignored.
+func (al *AnnounceList) AddToTier(i int, url string) {
+	url = strings.TrimSpace(url)
+	if url == "" || al.contains(url) {
+		return
+	}
+	if i < 0 || i >= len(*al) {
+		*al = append(*al, []string{url})
+		return
+	}
+	(*al)[i] = append((*al)[i], url)
+}
+
+// Removes every occurrence of the URL, and any tiers that become empty.
+func (al *AnnounceList) Remove(url string) {
+	var ret AnnounceList
+	for _, tier := range *al {
+		var newTier []string
+		for _, u := range tier {
+			if u != url {
+				newTier = append(newTier, u)
+			}
+		}
+		if len(newTier) != 0 {
+			ret = append(ret, newTier)
+		}
+	}
+	*al = ret
+}
+
+// Trims whitespace from the URLs, and removes those that are empty, don't parse with url.Parse, or
+// were already seen in an earlier position. Tiers that become empty are removed.
+func (al *AnnounceList) Normalize() {
+	*al = al.normalized()
+}
+
+func (al AnnounceList) contains(url string) bool {
+	for _, tier := range al {
+		if containsString(tier, url) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(ss []string, s string) bool {
+	for _, have := range ss {
+		if have == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns a normalized copy, as by Normalize.
+func (al AnnounceList) normalized() (ret AnnounceList) {
+	seen := make(map[string]struct{})
+	for _, tier := range al {
+		var newTier []string
+		for _, u := range tier {
+			u = strings.TrimSpace(u)
+			if u == "" {
+				continue
+			}
+			if _, err := url.Parse(u); err != nil {
+				continue
+			}
+			if _, ok := seen[u]; ok {
+				continue
+			}
+			seen[u] = struct{}{}
+			newTier = append(newTier, u)
+		}
+		if len(newTier) != 0 {
+			ret = append(ret, newTier)
+		}
+	}
+	return
+}
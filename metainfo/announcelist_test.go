@@ -0,0 +1,129 @@
+package metainfo
+
+import (
+	"bytes"
+	"math/rand"
+	"reflect"
+	"sort"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/anacrolix/torrent/bencode"
+)
+
+func TestAnnounceListEdits(t *testing.T) {
+	c := qt.New(t)
+	var al AnnounceList
+	al.AddTier("http://a/announce", " http://b/announce ", "", "http://a/announce")
+	al.AddTier("http://b/announce")
+	c.Assert(al, qt.DeepEquals, AnnounceList{{"http://a/announce", "http://b/announce"}})
+	al.AddToTier(0, "http://c/announce")
+	al.AddToTier(0, "http://a/announce")
+	al.AddToTier(5, "http://d/announce")
+	c.Assert(al, qt.DeepEquals, AnnounceList{
+		{"http://a/announce", "http://b/announce", "http://c/announce"},
+		{"http://d/announce"},
+	})
+	clone := al.Clone()
+	al.Remove("http://d/announce")
+	al.Remove("http://b/announce")
+	c.Assert(al, qt.DeepEquals, AnnounceList{{"http://a/announce", "http://c/announce"}})
+	c.Assert(clone, qt.HasLen, 2)
+}
+
+func TestAnnounceListNormalize(t *testing.T) {
+	al := AnnounceList{
+		{},
+		{" http://a/announce\t", "http://b/announce", "://bad"},
+		{"http://a/announce", "  "},
+		{"http://b/announce\n", "udp://c:80"},
+	}
+	al.Normalize()
+	qt.Assert(t, al, qt.DeepEquals, AnnounceList{
+		{"http://a/announce", "http://b/announce"},
+		{"udp://c:80"},
+	})
+}
+
+// Trackers repeated across tiers, and padded with whitespace, are common in the wild.
+func TestUpvertedAnnounceListNormalized(t *testing.T) {
+	c := qt.New(t)
+	mi, err := Load(bytes.NewReader(bencode.MustMarshal(map[string]interface{}{
+		"announce": " http://a/announce ",
+		"announce-list": [][]string{
+			{" http://a/announce ", "http://b/announce"},
+			{"http://b/announce", "http://c/announce "},
+			{"http://a/announce"},
+		},
+		"info": map[string]interface{}{"name": "x", "pieces": "", "piece length": 1},
+	})))
+	c.Assert(err, qt.IsNil)
+	expected := AnnounceList{
+		{"http://a/announce", "http://b/announce"},
+		{"http://c/announce"},
+	}
+	c.Check(mi.UpvertedAnnounceList(), qt.DeepEquals, expected)
+	c.Check(mi.Magnet(nil, nil).Trackers, qt.DeepEquals,
+		[]string{"http://a/announce", "http://b/announce", "http://c/announce"})
+	mi.AnnounceList = nil
+	c.Check(mi.UpvertedAnnounceList(), qt.DeepEquals, AnnounceList{{"http://a/announce"}})
+}
+
+func TestUpvertedAnnounceListMerged(t *testing.T) {
+	c := qt.New(t)
+	mi := MetaInfo{
+		Announce:     "http://a/announce",
+		AnnounceList: AnnounceList{{"http://b/announce"}, {"http://c/announce"}},
+	}
+	c.Check(mi.UpvertedAnnounceList(), qt.DeepEquals, AnnounceList{{"http://b/announce"}, {"http://c/announce"}})
+	c.Check(mi.UpvertedAnnounceListMerged(), qt.DeepEquals,
+		AnnounceList{{"http://a/announce"}, {"http://b/announce"}, {"http://c/announce"}})
+	c.Check(mi.Magnet(nil, nil).Trackers, qt.DeepEquals,
+		[]string{"http://a/announce", "http://b/announce", "http://c/announce"})
+	// Already in a tier, so the tiers are unchanged.
+	mi.Announce = "http://c/announce"
+	c.Check(mi.UpvertedAnnounceListMerged(), qt.DeepEquals, AnnounceList{{"http://b/announce"}, {"http://c/announce"}})
+	mi.AnnounceList = nil
+	c.Check(mi.UpvertedAnnounceListMerged(), qt.DeepEquals, AnnounceList{{"http://c/announce"}})
+}
+
+func TestOrderedDistinctValues(t *testing.T) {
+	al := AnnounceList{{"c", "a"}, {"b", "a"}, {"c", "d"}}
+	qt.Assert(t, al.OrderedDistinctValues(), qt.DeepEquals, []string{"c", "a", "b", "d"})
+	qt.Assert(t, AnnounceList(nil).OrderedDistinctValues(), qt.IsNil)
+}
+
+func TestShuffledTiers(t *testing.T) {
+	c := qt.New(t)
+	al := AnnounceList{{"a", "b", "c", "d", "e", "f"}, {"g"}, {"h", "i"}}
+	r := rand.New(rand.NewSource(1))
+	changed := false
+	for i := 0; i < 10; i++ {
+		shuffled := al.ShuffledTiers(r)
+		c.Assert(shuffled, qt.HasLen, len(al))
+		for j, tier := range shuffled {
+			sorted := append([]string(nil), tier...)
+			sort.Strings(sorted)
+			// Only the order within each tier changes.
+			c.Assert(sorted, qt.DeepEquals, al[j])
+		}
+		if !reflect.DeepEqual(shuffled, al) {
+			changed = true
+		}
+	}
+	c.Check(changed, qt.IsTrue)
+	// The original isn't modified.
+	c.Check(al[0], qt.DeepEquals, []string{"a", "b", "c", "d", "e", "f"})
+}
+
+// Magnet links are the same every time, which matters for caching and testing.
+func TestMagnetTrackerOrderStable(t *testing.T) {
+	mi := MetaInfo{AnnounceList: AnnounceList{{"http://e/", "http://d/"}, {"http://c/", "http://b/", "http://a/"}}}
+	expected := mi.Magnet(nil, nil).String()
+	for i := 0; i < 20; i++ {
+		qt.Assert(t, mi.Magnet(nil, nil).String(), qt.Equals, expected)
+	}
+	qt.Assert(t, mi.Magnet(nil, nil).Trackers, qt.DeepEquals,
+		[]string{"http://e/", "http://d/", "http://c/", "http://b/", "http://a/"})
+}
@@ -0,0 +1,187 @@
+package metainfo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/anacrolix/torrent/bencode"
+)
+
+// Creates a MetaInfo for files on disk, with the settings given by chained calls:
+//
+//	mi, err := NewBuilder().Root(path).Private(true).Tracker(url).Build(ctx)
+//
+// Settings aren't checked until Build, which reports every problem with them together. This is what
+// the torrent-create command uses.
+type Builder struct {
+	root        string
+	name        string
+	mappings    []FileMapping
+	pieceLength int64
+	opts        BuildFromFilePathOpts
+	trackers    [][]string
+	webSeeds    []string
+	comment     string
+	createdBy   string
+	now         func() time.Time
+}
+
+func NewBuilder() *Builder {
+	return new(Builder)
+}
+
+// The file or directory to create the torrent for. Its base name is the info name.
+func (me *Builder) Root(path string) *Builder {
+	me.root = path
+	return me
+}
+
+// Adds files from anywhere on disk to a multi-file torrent with the given name, instead of using a
+// root. See Info.BuildFromFileMappings.
+func (me *Builder) Files(name string, mappings ...FileMapping) *Builder {
+	me.name = name
+	me.mappings = append(me.mappings, mappings...)
+	return me
+}
+
+// The piece length. If zero, the default, it's chosen with ChoosePieceLength.
+func (me *Builder) PieceLength(pieceLength int64) *Builder {
+	me.pieceLength = pieceLength
+	return me
+}
+
+// Which info fields to produce. InfoVersionV1 by default.
+func (me *Builder) Version(version InfoVersion) *Builder {
+	me.opts.Version = version
+	return me
+}
+
+// Sets the BEP 27 private flag. Private torrents need a tracker.
+func (me *Builder) Private(private bool) *Builder {
+	me.opts.Private = private
+	return me
+}
+
+// Adds a tier of trackers. The first tracker added is also the announce URL.
+func (me *Builder) Tracker(urls ...string) *Builder {
+	me.trackers = append(me.trackers, urls)
+	return me
+}
+
+// Adds BEP 19 webseeds.
+func (me *Builder) WebSeed(urls ...string) *Builder {
+	me.webSeeds = append(me.webSeeds, urls...)
+	return me
+}
+
+func (me *Builder) Comment(comment string) *Builder {
+	me.comment = comment
+	return me
+}
+
+// The creator. DefaultCreatedBy if empty.
+func (me *Builder) CreatedBy(createdBy string) *Builder {
+	me.createdBy = createdBy
+	return me
+}
+
+// The clock for the creation date. time.Now if nil, and can be fixed for reproducible output.
+func (me *Builder) Now(now func() time.Time) *Builder {
+	me.now = now
+	return me
+}
+
+// Replaces the options for building the info, including the version and private flag.
+func (me *Builder) BuildOpts(opts BuildFromFilePathOpts) *Builder {
+	me.opts = opts
+	return me
+}
+
+// Returns the problems with the settings.
+func (me *Builder) check() (errs []error) {
+	switch {
+	case me.root != "" && me.mappings != nil:
+		errs = append(errs, errors.New("both a root and file mappings"))
+	case me.mappings != nil:
+		_, _, mappingErrs := checkFileMappings(me.name, me.mappings, me.opts)
+		errs = append(errs, mappingErrs...)
+	case me.root == "":
+		errs = append(errs, errors.New("no root"))
+	}
+	pieceLength := me.pieceLength
+	if pieceLength < 0 {
+		errs = append(errs, fmt.Errorf("negative piece length %v", pieceLength))
+		pieceLength = 0
+	}
+	errs = append(errs, me.opts.check(pieceLength)...)
+	var numTrackers int
+	for _, tier := range me.trackers {
+		if len(tier) == 0 {
+			errs = append(errs, errors.New("empty tracker tier"))
+		}
+		for _, u := range tier {
+			if err := validateAnnounceURL(u); err != nil {
+				errs = append(errs, AnnounceURLError{u, err})
+			}
+			numTrackers++
+		}
+	}
+	if me.opts.Private && numTrackers == 0 {
+		errs = append(errs, errors.New("private torrents need a tracker"))
+	}
+	for _, s := range me.webSeeds {
+		if err := validateWebSeedURL(s); err != nil {
+			errs = append(errs, fmt.Errorf("bad webseed url %q: %w", s, err))
+		}
+	}
+	return
+}
+
+func validateWebSeedURL(s string) error {
+	u, err := url.Parse(s)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return errors.New("scheme must be http or https")
+	}
+	if u.Host == "" {
+		return errors.New("missing host")
+	}
+	return nil
+}
+
+// Hashes the files and returns the MetaInfo. If the settings are bad, all their problems are
+// returned joined with errors.Join, before any files are read.
+func (me *Builder) Build(ctx context.Context) (*MetaInfo, error) {
+	if errs := me.check(); errs != nil {
+		return nil, errors.Join(errs...)
+	}
+	info := Info{PieceLength: me.pieceLength}
+	var pieceLayers map[string]string
+	var err error
+	if me.mappings != nil {
+		pieceLayers, err = info.BuildFromFileMappings(ctx, me.name, me.mappings, me.opts)
+	} else {
+		pieceLayers, err = info.BuildFromFilePathOpts(ctx, me.root, me.opts)
+	}
+	if err != nil {
+		return nil, err
+	}
+	infoBytes, err := bencode.Marshal(info)
+	if err != nil {
+		return nil, err
+	}
+	mi := &MetaInfo{
+		Comment:     me.comment,
+		UrlList:     me.webSeeds,
+		PieceLayers: pieceLayers,
+	}
+	mi.SetAnnounceList(me.trackers)
+	mi.SetDefaultsOpts(SetDefaultsOpts{CreatedBy: me.createdBy, Now: me.now})
+	mi.SetInfoBytes(infoBytes)
+	return mi, nil
+}
@@ -0,0 +1,123 @@
+package metainfo
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+)
+
+var updateGolden = flag.Bool("update-golden", false, "rewrite the golden files in testdata")
+
+// Writes a fixed content tree, and returns its root.
+func writeBuilderTestData(c *qt.C) (root string) {
+	root = filepath.Join(c.Mkdir(), "content")
+	writeTreeFiles(c, root, map[string][]byte{
+		"a":       fileData(40000, 1),
+		"dir/b":   fileData(20000, 2),
+		"dir/c":   fileData(100, 3),
+		"empty":   nil,
+		"dir/d/e": fileData(16384, 4),
+	})
+	return
+}
+
+func fixedTestClock() time.Time {
+	return time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+}
+
+func checkGolden(c *qt.C, name string, actual []byte) {
+	path := filepath.Join("testdata", name)
+	if *updateGolden {
+		c.Assert(ioutil.WriteFile(path, actual, 0o644), qt.IsNil)
+	}
+	expected, err := os.ReadFile(path)
+	c.Assert(err, qt.IsNil)
+	c.Check(bytes.Equal(actual, expected), qt.IsTrue, qt.Commentf("output differs from %v", path))
+}
+
+func TestBuilderGolden(t *testing.T) {
+	root := writeBuilderTestData(qt.New(t))
+	for _, version := range []InfoVersion{InfoVersionV1, InfoVersionHybrid, InfoVersionV2} {
+		t.Run(version.String(), func(t *testing.T) {
+			c := qt.New(t)
+			mi, err := NewBuilder().
+				Root(root).
+				Version(version).
+				Private(true).
+				Tracker("http://a/announce", "http://b/announce").
+				Tracker("udp://c:6969").
+				WebSeed("http://seed/files/").
+				Comment("golden").
+				CreatedBy("builder test").
+				Now(fixedTestClock).
+				Build(context.Background())
+			c.Assert(err, qt.IsNil)
+			c.Check(mi.Validate(), qt.IsNil)
+			c.Check(mi.Announce, qt.Equals, "http://a/announce")
+			info, err := mi.Info()
+			c.Assert(err, qt.IsNil)
+			c.Check(info.IsPrivate(), qt.IsTrue)
+			c.Check(info.HasV1(), qt.Equals, version != InfoVersionV2)
+			c.Check(info.HasV2(), qt.Equals, version != InfoVersionV1)
+			var buf bytes.Buffer
+			c.Assert(mi.Write(&buf), qt.IsNil)
+			checkGolden(c, "builder-"+version.String()+".torrent", buf.Bytes())
+		})
+	}
+}
+
+func TestBuilderReportsAllProblems(t *testing.T) {
+	c := qt.New(t)
+	_, err := NewBuilder().
+		PieceLength(20000).
+		Version(InfoVersionHybrid).
+		Private(true).
+		Tracker().
+		WebSeed("ftp://seed/").
+		Build(context.Background())
+	c.Assert(err, qt.Not(qt.IsNil))
+	var msgs []string
+	for _, err := range err.(interface{ Unwrap() []error }).Unwrap() {
+		msgs = append(msgs, err.Error())
+	}
+	c.Check(msgs, qt.DeepEquals, []string{
+		"no root",
+		"v2 piece length must be a power of two of at least 16384",
+		"empty tracker tier",
+		"private torrents need a tracker",
+		`bad webseed url "ftp://seed/": scheme must be http or https`,
+	})
+}
+
+func TestBuilderBadTracker(t *testing.T) {
+	c := qt.New(t)
+	_, err := NewBuilder().Root(c.Mkdir()).Tracker("nothing").Build(context.Background())
+	var urlErr AnnounceURLError
+	c.Assert(errors.As(err, &urlErr), qt.IsTrue)
+	c.Check(urlErr.URL, qt.Equals, "nothing")
+}
+
+func TestBuilderDefaults(t *testing.T) {
+	c := qt.New(t)
+	root := writeBuilderTestData(c)
+	before := time.Now().Unix()
+	mi, err := NewBuilder().Root(root).Build(context.Background())
+	c.Assert(err, qt.IsNil)
+	c.Check(mi.CreatedBy, qt.Equals, DefaultCreatedBy)
+	c.Check(mi.CreationDate >= before, qt.IsTrue)
+	c.Check(mi.AnnounceList, qt.HasLen, 0)
+	info, err := mi.Info()
+	c.Assert(err, qt.IsNil)
+	c.Check(info.Name, qt.Equals, "content")
+	c.Check(info.PieceLength, qt.Equals, ChoosePieceLength(info.TotalLength()))
+	c.Check(strings.Join(info.UpvertedFiles()[0].Path, "/"), qt.Equals, "a")
+}
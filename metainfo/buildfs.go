@@ -0,0 +1,109 @@
+package metainfo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+)
+
+// Like BuildFromFilePathOpts, but the files come from fsys, and root is a slash-separated path in
+// it. If root is ".", there's no name to take from it, and info.Name must be set beforehand. Paths
+// passed to the filter are slash-separated. Symlinks can't be recorded, and symlinks to directories
+// can't be followed.
+func (info *Info) BuildFromFS(ctx context.Context, fsys fs.FS, root string, opts BuildFromFilePathOpts) (pieceLayers map[string]string, err error) {
+	name := path.Base(root)
+	if root == "." {
+		if info.Name == "" {
+			return nil, errors.New("info name must be set to build from the root of an fs.FS")
+		}
+		name = info.Name
+	}
+	w := fsBuildWalker{
+		ctx:  ctx,
+		opts: opts,
+		fsys: fsys,
+		root: root,
+	}
+	return info.build(ctx, name, opts, w.walkRoot, func(fi FileInfo) (io.ReadCloser, error) {
+		return fsys.Open(path.Join(append([]string{root}, fi.Path...)...))
+	})
+}
+
+// Collects the files below a root in an fs.FS for the builder.
+type fsBuildWalker struct {
+	ctx      context.Context
+	opts     BuildFromFilePathOpts
+	fsys     fs.FS
+	root     string
+	files    []FileInfo
+	excluded bool
+}
+
+func (w *fsBuildWalker) walkRoot() (length int64, files []FileInfo, excluded bool, err error) {
+	fi, err := fs.Stat(w.fsys, w.root)
+	if err != nil {
+		return
+	}
+	if !fi.IsDir() {
+		return fi.Size(), nil, false, nil
+	}
+	err = w.walkDir(w.root, nil)
+	return 0, w.files, w.excluded, err
+}
+
+func (w *fsBuildWalker) walkDir(dir string, relPath []string) error {
+	// These come sorted by name.
+	entries, err := fs.ReadDir(w.fsys, dir)
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 && w.opts.EmptyDirs {
+		w.files = append(w.files, FileInfo{Path: append(relPath[:len(relPath):len(relPath)], EmptyDirPlaceholder)})
+		return nil
+	}
+	for _, e := range entries {
+		if err := w.ctx.Err(); err != nil {
+			return err
+		}
+		childPath := path.Join(dir, e.Name())
+		childRelPath := append(relPath[:len(relPath):len(relPath)], e.Name())
+		fi, err := e.Info()
+		if err != nil {
+			return err
+		}
+		if fi.Mode()&fs.ModeSymlink != 0 {
+			switch w.opts.Symlinks {
+			case SymlinkFollow:
+				fi, err = fs.Stat(w.fsys, childPath)
+				if err != nil {
+					return fmt.Errorf("following symlink: %w", err)
+				}
+				if fi.IsDir() {
+					return fmt.Errorf("symlinked directory %q can't be followed in an fs.FS", path.Join(childRelPath...))
+				}
+			case SymlinkSkip:
+				continue
+			case SymlinkRecord:
+				return fmt.Errorf("symlink %q can't be recorded from an fs.FS", path.Join(childRelPath...))
+			default:
+				return fmt.Errorf("unknown symlink policy %v", w.opts.Symlinks)
+			}
+		}
+		if w.opts.Filter != nil && !w.opts.Filter(path.Join(childRelPath...), fi) {
+			w.excluded = true
+			continue
+		}
+		if fi.IsDir() {
+			err = w.walkDir(childPath, childRelPath)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		w.files = append(w.files, buildFileInfo(childRelPath, fi, w.opts))
+	}
+	return nil
+}
@@ -0,0 +1,177 @@
+package metainfo
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/anacrolix/torrent/bencode"
+)
+
+func TestBuildFromFSMatchesFilePath(t *testing.T) {
+	c := qt.New(t)
+	files := map[string]string{
+		"a":              "hello",
+		"empty":          "",
+		"sub/deep/b":     string(make([]byte, 20000)),
+		"sub/.DS_Store":  "junk",
+		"sub/deep/empty": "",
+	}
+	fsys := fstest.MapFS{}
+	root := filepath.Join(c.Mkdir(), "root")
+	treeFiles := make(map[string][]byte)
+	for name, data := range files {
+		fsys["root/"+name] = &fstest.MapFile{Data: []byte(data)}
+		treeFiles[name] = []byte(data)
+	}
+	writeTreeFiles(c, root, treeFiles)
+	filter, err := GlobFilter(JunkFilePatterns...)
+	c.Assert(err, qt.IsNil)
+	for _, opts := range []BuildFromFilePathOpts{
+		{Filter: filter},
+		{Filter: filter, PadFiles: true, PieceHashers: 2},
+		{Filter: filter, Version: InfoVersionHybrid},
+	} {
+		fromFS := Info{PieceLength: 16384}
+		fsLayers, err := fromFS.BuildFromFS(context.Background(), fsys, "root", opts)
+		c.Assert(err, qt.IsNil)
+		fromPath := Info{PieceLength: 16384}
+		pathLayers, err := fromPath.BuildFromFilePathOpts(context.Background(), root, opts)
+		c.Assert(err, qt.IsNil)
+		c.Check(fromFS.Name, qt.Equals, "root")
+		c.Check(string(bencode.MustMarshal(fromFS)), qt.Equals, string(bencode.MustMarshal(fromPath)))
+		c.Check(fsLayers, qt.DeepEquals, pathLayers)
+	}
+}
+
+//go:embed testdata/buildfs
+var buildFSTestData embed.FS
+
+func TestBuildFromEmbedFS(t *testing.T) {
+	c := qt.New(t)
+	for _, root := range []string{"testdata/buildfs", "testdata/buildfs/sub"} {
+		fromFS := Info{PieceLength: 16384}
+		_, err := fromFS.BuildFromFS(context.Background(), buildFSTestData, root, BuildFromFilePathOpts{})
+		c.Assert(err, qt.IsNil)
+		fromPath := Info{PieceLength: 16384}
+		err = fromPath.BuildFromFilePath(filepath.FromSlash(root))
+		c.Assert(err, qt.IsNil)
+		c.Check(string(bencode.MustMarshal(fromFS)), qt.Equals, string(bencode.MustMarshal(fromPath)))
+	}
+	// A subdirectory is named for itself, and has the files below it.
+	var info Info
+	_, err := info.BuildFromFS(context.Background(), buildFSTestData, "testdata/buildfs/sub", BuildFromFilePathOpts{})
+	c.Assert(err, qt.IsNil)
+	c.Check(info.Name, qt.Equals, "sub")
+	c.Check(info.Files, qt.DeepEquals, []FileInfo{
+		{Path: []string{"b"}, Length: 6},
+		{Path: []string{"deep", "empty"}},
+	})
+}
+
+func TestBuildFromFSMissing(t *testing.T) {
+	c := qt.New(t)
+	for _, fsys := range []fs.FS{buildFSTestData, fstest.MapFS{"a": &fstest.MapFile{}}} {
+		var info Info
+		_, err := info.BuildFromFS(context.Background(), fsys, "testdata/missing", BuildFromFilePathOpts{})
+		c.Check(errors.Is(err, fs.ErrNotExist), qt.IsTrue, qt.Commentf("%v", err))
+	}
+}
+
+func TestBuildFromFSHybrid(t *testing.T) {
+	c := qt.New(t)
+	a := make([]byte, 20000)
+	for i := range a {
+		a[i] = byte(i % 251)
+	}
+	b := make([]byte, 5000)
+	for i := range b {
+		b[i] = byte(i * 7)
+	}
+	info := Info{PieceLength: 16384, Name: "hybrid"}
+	pieceLayers, err := info.BuildFromFS(context.Background(), fstest.MapFS{
+		"a": &fstest.MapFile{Data: a},
+		"b": &fstest.MapFile{Data: b},
+	}, ".", BuildFromFilePathOpts{Version: InfoVersionHybrid})
+	c.Assert(err, qt.IsNil)
+	expected, err := LoadFromFile("testdata/hybrid.torrent")
+	c.Assert(err, qt.IsNil)
+	c.Check(string(bencode.MustMarshal(info)), qt.Equals, string(expected.InfoBytes))
+	c.Check(pieceLayers, qt.DeepEquals, expected.PieceLayers)
+}
+
+func TestBuildFromFSSingleFile(t *testing.T) {
+	c := qt.New(t)
+	var info Info
+	_, err := info.BuildFromFS(context.Background(), fstest.MapFS{
+		"dir/file": &fstest.MapFile{Data: []byte("hello")},
+	}, "dir/file", BuildFromFilePathOpts{})
+	c.Assert(err, qt.IsNil)
+	c.Check(info.Name, qt.Equals, "file")
+	c.Check(info.Length, qt.Equals, int64(5))
+	c.Check(info.Files, qt.IsNil)
+	c.Check(info.Pieces, qt.DeepEquals, HashBytes([]byte("hello")).Bytes())
+}
+
+func TestBuildFromFSRootNeedsName(t *testing.T) {
+	var info Info
+	_, err := info.BuildFromFS(context.Background(), fstest.MapFS{
+		"a": &fstest.MapFile{},
+	}, ".", BuildFromFilePathOpts{})
+	qt.Assert(t, err, qt.ErrorMatches, "info name must be set to build from the root of an fs.FS")
+}
+
+func TestBuildFromFSDirFS(t *testing.T) {
+	c := qt.New(t)
+	root := c.Mkdir()
+	writeTreeFiles(c, root, pathFiles("x/a", "x/b/c"))
+	var info Info
+	_, err := info.BuildFromFS(context.Background(), os.DirFS(root), "x", BuildFromFilePathOpts{})
+	c.Assert(err, qt.IsNil)
+	c.Check(info.Files, qt.DeepEquals, []FileInfo{
+		{Path: []string{"a"}, Length: 9},
+		{Path: []string{"b", "c"}, Length: 15},
+	})
+}
+
+func TestBuildEmptyDirs(t *testing.T) {
+	c := qt.New(t)
+	root := filepath.Join(c.Mkdir(), "root")
+	fsys := fstest.MapFS{"root/a": &fstest.MapFile{Data: []byte("hello")}}
+	for _, dir := range []string{"empty", "sub/empty", "sub/emptier"} {
+		c.Assert(os.MkdirAll(filepath.Join(root, filepath.FromSlash(dir)), 0o700), qt.IsNil)
+		fsys["root/"+dir] = &fstest.MapFile{Mode: fs.ModeDir}
+	}
+	c.Assert(ioutil.WriteFile(filepath.Join(root, "a"), []byte("hello"), 0o600), qt.IsNil)
+	for _, version := range []InfoVersion{InfoVersionV1, InfoVersionHybrid} {
+		opts := BuildFromFilePathOpts{Version: version, EmptyDirs: true}
+		var info Info
+		_, err := info.BuildFromFilePathOpts(context.Background(), root, opts)
+		c.Assert(err, qt.IsNil)
+		var paths []string
+		for _, fi := range info.UpvertedFiles() {
+			if !fi.IsPadding() {
+				paths = append(paths, path.Join(fi.Path...))
+			}
+		}
+		c.Check(paths, qt.DeepEquals, []string{"a", "empty/.keep", "sub/emptier/.keep", "sub/empty/.keep"})
+		var fromFS Info
+		_, err = fromFS.BuildFromFS(context.Background(), fsys, "root", opts)
+		c.Assert(err, qt.IsNil)
+		c.Check(string(bencode.MustMarshal(fromFS)), qt.Equals, string(bencode.MustMarshal(info)))
+	}
+	// Without the option, empty directories are lost.
+	var info Info
+	_, err := info.BuildFromFilePathOpts(context.Background(), root, BuildFromFilePathOpts{})
+	c.Assert(err, qt.IsNil)
+	c.Check(info.Files, qt.HasLen, 1)
+}
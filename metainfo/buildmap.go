@@ -0,0 +1,102 @@
+package metainfo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// A file on disk, and where it goes in an info built by BuildFromFileMappings.
+type FileMapping struct {
+	// The path of the file on disk. Symlinks are followed.
+	Source string
+	// The slash-separated path of the file in the info, below the info name.
+	TorrentPath string
+}
+
+// Builds a multi-file info with the given name from files that can be anywhere on disk, so they
+// needn't be gathered in one directory first. The files are hashed in the order given, and keep it
+// in the info, so opts.FileOrder doesn't apply. Infos with v2 fields need the files in FileOrderPath
+// order, as their file tree has no other. Missing sources, bad and colliding torrent paths, and an
+// unsuitable order are all reported together, before anything is hashed. opts.Filter and
+// opts.Symlinks don't apply either. Otherwise it's like BuildFromFilePathOpts.
+func (info *Info) BuildFromFileMappings(
+	ctx context.Context, name string, mappings []FileMapping, opts BuildFromFilePathOpts,
+) (pieceLayers map[string]string, err error) {
+	files, sources, errs := checkFileMappings(name, mappings, opts)
+	if errs != nil {
+		err = errors.Join(errs...)
+		return
+	}
+	opts.FileOrder = fileOrderGiven
+	walk := func() (int64, []FileInfo, bool, error) {
+		return 0, files, false, nil
+	}
+	return info.build(ctx, name, opts, walk, func(fi FileInfo) (io.ReadCloser, error) {
+		return os.Open(sources[strings.Join(fi.Path, "/")])
+	})
+}
+
+// Returns the files for the mappings, and their sources by torrent path, or the problems with them.
+func checkFileMappings(name string, mappings []FileMapping, opts BuildFromFilePathOpts) (
+	files []FileInfo, sources map[string]string, errs []error,
+) {
+	if reason := badPathReason([]string{name}); reason != "" {
+		errs = append(errs, FilePathError{[]string{name}, reason})
+	}
+	if len(mappings) == 0 {
+		errs = append(errs, errors.New("no files"))
+	}
+	sources = make(map[string]string, len(mappings))
+	var paths []string
+	// Directories implied by the torrent paths, to find files that collide with them.
+	dirs := make(map[string]string)
+	for _, m := range mappings {
+		path := strings.Split(m.TorrentPath, "/")
+		if reason := badPathReason(path); reason != "" {
+			errs = append(errs, FilePathError{path, reason})
+			continue
+		}
+		if prev, ok := sources[m.TorrentPath]; ok {
+			errs = append(errs, fmt.Errorf("%q and %q are both mapped to %q", prev, m.Source, m.TorrentPath))
+			continue
+		}
+		sources[m.TorrentPath] = m.Source
+		paths = append(paths, m.TorrentPath)
+		for i := 1; i < len(path); i++ {
+			dir := strings.Join(path[:i], "/")
+			if _, ok := dirs[dir]; !ok {
+				dirs[dir] = m.TorrentPath
+			}
+		}
+		fi, err := os.Stat(m.Source)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if fi.IsDir() {
+			errs = append(errs, fmt.Errorf("source %q is a directory", m.Source))
+			continue
+		}
+		files = append(files, buildFileInfo(path, fi, opts))
+	}
+	for _, path := range paths {
+		if child, ok := dirs[path]; ok {
+			errs = append(errs, fmt.Errorf("%q is both a file and the directory of %q", path, child))
+		}
+	}
+	if opts.Version.hasV2() {
+		for i := 1; i < len(files); i++ {
+			if !pathLess(files[i-1].Path, files[i].Path) {
+				errs = append(errs, fmt.Errorf(
+					"%v infos need files in path order, but %q is after %q",
+					opts.Version, strings.Join(files[i].Path, "/"), strings.Join(files[i-1].Path, "/")))
+				break
+			}
+		}
+	}
+	return
+}
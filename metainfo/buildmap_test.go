@@ -0,0 +1,121 @@
+package metainfo
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+// Writes the files in separate directories, and returns their paths by name.
+func writeMappingSources(c *qt.C, files map[string][]byte) map[string]string {
+	ret := make(map[string]string)
+	for name, data := range files {
+		dir := c.Mkdir()
+		writeTreeFiles(c, dir, map[string][]byte{name: data})
+		ret[name] = filepath.Join(dir, name)
+	}
+	return ret
+}
+
+func TestBuildFromFileMappings(t *testing.T) {
+	c := qt.New(t)
+	src := writeMappingSources(c, map[string][]byte{
+		"video.mkv": fileData(40000, 1),
+		"notes.txt": fileData(100, 2),
+	})
+	var info Info
+	_, err := info.BuildFromFileMappings(context.Background(), "Release", []FileMapping{
+		{src["video.mkv"], "video.mkv"},
+		{src["notes.txt"], "extras/notes.txt"},
+	}, BuildFromFilePathOpts{})
+	c.Assert(err, qt.IsNil)
+	c.Check(info.Name, qt.Equals, "Release")
+	// The declared order, though "extras" sorts first.
+	c.Check(info.Files, qt.DeepEquals, []FileInfo{
+		{Path: []string{"video.mkv"}, Length: 40000},
+		{Path: []string{"extras", "notes.txt"}, Length: 100},
+	})
+
+	// The same content, gathered in one directory.
+	root := filepath.Join(c.Mkdir(), "Release")
+	writeTreeFiles(c, root, map[string][]byte{
+		"video.mkv":        fileData(40000, 1),
+		"extras/notes.txt": fileData(100, 2),
+	})
+	good, err := VerifyData(context.Background(), &info, root, VerifyOpts{})
+	c.Assert(err, qt.IsNil)
+	c.Check(good, qt.DeepEquals, allGood(info.NumPieces()))
+}
+
+func TestBuildFromFileMappingsSingleFile(t *testing.T) {
+	c := qt.New(t)
+	src := writeMappingSources(c, map[string][]byte{"a": fileData(10, 1)})
+	var info Info
+	_, err := info.BuildFromFileMappings(context.Background(), "name", []FileMapping{{src["a"], "a"}}, BuildFromFilePathOpts{})
+	c.Assert(err, qt.IsNil)
+	// Still multi-file.
+	c.Check(info.IsDir(), qt.IsTrue)
+	c.Check(info.Files, qt.DeepEquals, []FileInfo{{Path: []string{"a"}, Length: 10}})
+}
+
+func TestBuildFromFileMappingsHybrid(t *testing.T) {
+	c := qt.New(t)
+	src := writeMappingSources(c, map[string][]byte{
+		"a": fileData(20000, 1),
+		"b": fileData(5000, 2),
+	})
+	var info Info
+	mappings := []FileMapping{{src["b"], "x/b"}, {src["a"], "a"}}
+	_, err := info.BuildFromFileMappings(context.Background(), "hybrid", mappings, BuildFromFilePathOpts{Version: InfoVersionHybrid})
+	c.Assert(err, qt.ErrorMatches, `hybrid infos need files in path order, but "a" is after "x/b"`)
+
+	mappings[0], mappings[1] = mappings[1], mappings[0]
+	pieceLayers, err := info.BuildFromFileMappings(context.Background(), "hybrid", mappings, BuildFromFilePathOpts{Version: InfoVersionHybrid})
+	c.Assert(err, qt.IsNil)
+	c.Check(info.HasV2(), qt.IsTrue)
+	c.Check(pieceLayers, qt.HasLen, 1)
+	c.Check(info.FileRoots(), qt.HasLen, 2)
+	c.Check(info.VerifyFileRoot("x/b", src["b"]), qt.IsNil)
+}
+
+func TestBuildFromFileMappingsProblems(t *testing.T) {
+	c := qt.New(t)
+	src := writeMappingSources(c, map[string][]byte{"a": nil, "b": nil})
+	var info Info
+	_, err := info.BuildFromFileMappings(context.Background(), "", []FileMapping{
+		{src["a"], "a"},
+		{src["b"], "a"},
+		{filepath.Join(c.Mkdir(), "missing"), "c"},
+		{src["b"], "../b"},
+		{src["b"], "a/b"},
+		{filepath.Dir(src["a"]), "dir"},
+	}, BuildFromFilePathOpts{})
+	c.Assert(err, qt.Not(qt.IsNil))
+	msgs := strings.Split(err.Error(), "\n")
+	c.Assert(msgs, qt.HasLen, 6)
+	c.Check(msgs[0], qt.Equals, `bad file path [""]: empty component`)
+	c.Check(msgs[1], qt.Matches, `".*a" and ".*b" are both mapped to "a"`)
+	c.Check(msgs[2], qt.Matches, `stat .*missing: no such file or directory`)
+	c.Check(msgs[3], qt.Equals, `bad file path [".." "b"]: parent directory component`)
+	c.Check(msgs[4], qt.Matches, `source ".*" is a directory`)
+	c.Check(msgs[5], qt.Equals, `"a" is both a file and the directory of "a/b"`)
+}
+
+func TestBuilderFiles(t *testing.T) {
+	c := qt.New(t)
+	src := writeMappingSources(c, map[string][]byte{"a": fileData(10, 1)})
+	mi, err := NewBuilder().Files("name", FileMapping{src["a"], "sub/a"}).Now(fixedTestClock).Build(context.Background())
+	c.Assert(err, qt.IsNil)
+	info, err := mi.Info()
+	c.Assert(err, qt.IsNil)
+	c.Check(info.Name, qt.Equals, "name")
+	c.Check(info.Files, qt.DeepEquals, []FileInfo{{Path: []string{"sub", "a"}, Length: 10}})
+
+	_, err = NewBuilder().Root(c.Mkdir()).Files("name", FileMapping{src["a"], "a"}).Build(context.Background())
+	c.Check(err, qt.ErrorMatches, "both a root and file mappings")
+	_, err = NewBuilder().Files("name", FileMapping{src["a"], ""}).PieceLength(-1).Build(context.Background())
+	c.Check(err, qt.ErrorMatches, "bad file path \\[\"\"\\]: empty component\nnegative piece length -1")
+}
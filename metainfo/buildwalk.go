@@ -0,0 +1,179 @@
+package metainfo
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Selects how the builder treats symlinks.
+type SymlinkPolicy int
+
+const (
+	// Symlinks are replaced by what they point to. Directories are walked, and symlinks that make a
+	// cycle are an error.
+	SymlinkFollow SymlinkPolicy = iota
+	// Symlinks are left out.
+	SymlinkSkip
+	// Symlinks are recorded as BEP 47 symlink files, with no data. The target must be inside the
+	// root, but needn't exist.
+	SymlinkRecord
+)
+
+// Collects the files below a root for the builder.
+type buildWalker struct {
+	ctx  context.Context
+	opts BuildFromFilePathOpts
+	root string
+	// The directories from the root down to the one being walked, for finding symlink cycles.
+	ancestors []os.FileInfo
+	files     []FileInfo
+	// Whether the filter left anything out.
+	excluded bool
+}
+
+// Returns the length of the root if it's a file, or the files below it if it's a directory.
+func (w *buildWalker) walkRoot() (length int64, files []FileInfo, excluded bool, err error) {
+	fi, err := os.Stat(w.root)
+	if err != nil {
+		return
+	}
+	if !fi.IsDir() {
+		return fi.Size(), nil, false, nil
+	}
+	err = w.walkDir(w.root, nil, fi)
+	return 0, w.files, w.excluded, err
+}
+
+func (w *buildWalker) walkDir(path string, relPath []string, fi os.FileInfo) error {
+	for _, a := range w.ancestors {
+		if os.SameFile(a, fi) {
+			return fmt.Errorf("symlink %q makes a cycle", filepath.Join(relPath...))
+		}
+	}
+	w.ancestors = append(w.ancestors, fi)
+	defer func() {
+		w.ancestors = w.ancestors[:len(w.ancestors)-1]
+	}()
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	names, err := f.Readdirnames(-1)
+	f.Close()
+	if err != nil {
+		return err
+	}
+	if len(names) == 0 && w.opts.EmptyDirs {
+		w.files = append(w.files, FileInfo{Path: append(relPath[:len(relPath):len(relPath)], EmptyDirPlaceholder)})
+		return nil
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := w.ctx.Err(); err != nil {
+			return err
+		}
+		childPath := filepath.Join(path, name)
+		fi, err := os.Lstat(childPath)
+		if err != nil {
+			return err
+		}
+		err = w.walk(childPath, append(relPath[:len(relPath):len(relPath)], name), fi)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fi is from Lstat.
+func (w *buildWalker) walk(path string, relPath []string, fi os.FileInfo) (err error) {
+	if fi.Mode()&os.ModeSymlink != 0 {
+		switch w.opts.Symlinks {
+		case SymlinkFollow:
+			fi, err = os.Stat(path)
+			if err != nil {
+				return fmt.Errorf("following symlink: %w", err)
+			}
+		case SymlinkSkip:
+			return nil
+		case SymlinkRecord:
+			return w.recordSymlink(path, relPath, fi)
+		default:
+			return fmt.Errorf("unknown symlink policy %v", w.opts.Symlinks)
+		}
+	}
+	if !w.include(relPath, fi) {
+		return nil
+	}
+	if fi.IsDir() {
+		// Directories are implicit in torrent files.
+		return w.walkDir(path, relPath, fi)
+	}
+	w.files = append(w.files, buildFileInfo(relPath, fi, w.opts))
+	return nil
+}
+
+// The FileInfo for a regular file found by a build walker.
+func buildFileInfo(relPath []string, fi os.FileInfo, opts BuildFromFilePathOpts) (ret FileInfo) {
+	ret = FileInfo{
+		Path:   relPath,
+		Length: fi.Size(),
+	}
+	// Sources like fstest.MapFS can have no time at all.
+	if opts.RecordMtimes && !fi.ModTime().IsZero() {
+		ret.Mtime = fi.ModTime().Unix()
+	}
+	return
+}
+
+func (w *buildWalker) include(relPath []string, fi os.FileInfo) bool {
+	if w.opts.Filter == nil || w.opts.Filter(filepath.Join(relPath...), fi) {
+		return true
+	}
+	w.excluded = true
+	return false
+}
+
+func (w *buildWalker) recordSymlink(path string, relPath []string, fi os.FileInfo) error {
+	if !w.include(relPath, fi) {
+		return nil
+	}
+	target, err := os.Readlink(path)
+	if err != nil {
+		return err
+	}
+	// Resolved lexically, as the target may not exist, and would usually be recreated where the
+	// torrent is downloaded.
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(filepath.Dir(path), target)
+	}
+	root, err := filepath.Abs(w.root)
+	if err != nil {
+		return err
+	}
+	target, err = filepath.Abs(target)
+	if err != nil {
+		return err
+	}
+	rel, err := filepath.Rel(root, target)
+	if err != nil {
+		return err
+	}
+	if rel == "." {
+		// There's no path to record.
+		return fmt.Errorf("symlink %q points at the root", filepath.Join(relPath...))
+	}
+	if rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("symlink %q points outside the root", filepath.Join(relPath...))
+	}
+	w.files = append(w.files, FileInfo{
+		Path:        relPath,
+		Attr:        "l",
+		SymlinkPath: strings.Split(rel, string(filepath.Separator)),
+	})
+	return nil
+}
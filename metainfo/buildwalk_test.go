@@ -0,0 +1,171 @@
+package metainfo
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func buildWithSymlinks(root string, policy SymlinkPolicy) (Info, error) {
+	info := Info{PieceLength: 16384}
+	_, err := info.BuildFromFilePathOpts(context.Background(), root, BuildFromFilePathOpts{Symlinks: policy})
+	return info, err
+}
+
+func skipWithoutSymlinks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks need privileges")
+	}
+}
+
+// Makes a root with a file "a", a directory "dir" holding "b", and a symlink "link" to target.
+func symlinkTestRoot(c *qt.C, target string) string {
+	root := c.Mkdir()
+	writeTreeFiles(c, root, pathFiles("a", "dir/b"))
+	c.Assert(os.Symlink(target, filepath.Join(root, "link")), qt.IsNil)
+	return root
+}
+
+func TestBuildSymlinkToFile(t *testing.T) {
+	skipWithoutSymlinks(t)
+	c := qt.New(t)
+	root := symlinkTestRoot(c, "a")
+	info, err := buildWithSymlinks(root, SymlinkFollow)
+	c.Assert(err, qt.IsNil)
+	c.Check(info.Files, qt.HasLen, 3)
+	c.Check(info.Files[2], qt.DeepEquals, FileInfo{Path: []string{"link"}, Length: 3})
+	c.Check(info.TotalLength(), qt.Equals, int64(3+15+3))
+
+	info, err = buildWithSymlinks(root, SymlinkSkip)
+	c.Assert(err, qt.IsNil)
+	c.Check(info.Files, qt.HasLen, 2)
+
+	info, err = buildWithSymlinks(root, SymlinkRecord)
+	c.Assert(err, qt.IsNil)
+	c.Check(info.Files, qt.HasLen, 3)
+	c.Check(info.Files[2], qt.DeepEquals, FileInfo{
+		Path:        []string{"link"},
+		Attr:        "l",
+		SymlinkPath: []string{"a"},
+	})
+	c.Check(info.Files[2].IsSymlink(), qt.IsTrue)
+	c.Check(info.TotalLength(), qt.Equals, int64(3+15))
+}
+
+func TestBuildSymlinkToDir(t *testing.T) {
+	skipWithoutSymlinks(t)
+	c := qt.New(t)
+	root := symlinkTestRoot(c, "dir")
+	info, err := buildWithSymlinks(root, SymlinkFollow)
+	c.Assert(err, qt.IsNil)
+	c.Check(info.Files, qt.HasLen, 3)
+	c.Check(info.Files[2], qt.DeepEquals, FileInfo{Path: []string{"link", "b"}, Length: 15})
+
+	info, err = buildWithSymlinks(root, SymlinkSkip)
+	c.Assert(err, qt.IsNil)
+	c.Check(info.Files, qt.HasLen, 2)
+
+	info, err = buildWithSymlinks(root, SymlinkRecord)
+	c.Assert(err, qt.IsNil)
+	c.Check(info.Files[2].SymlinkPath, qt.DeepEquals, []string{"dir"})
+}
+
+func TestBuildSymlinkOutsideRoot(t *testing.T) {
+	skipWithoutSymlinks(t)
+	c := qt.New(t)
+	outside := filepath.Join(c.Mkdir(), "outside")
+	writeTreeFiles(c, filepath.Dir(outside), pathFiles("outside"))
+	root := symlinkTestRoot(c, outside)
+	c.Assert(filepath.IsAbs(outside), qt.IsTrue)
+	info, err := buildWithSymlinks(root, SymlinkFollow)
+	c.Assert(err, qt.IsNil)
+	c.Check(info.Files[2], qt.DeepEquals, FileInfo{Path: []string{"link"}, Length: 21})
+
+	info, err = buildWithSymlinks(root, SymlinkSkip)
+	c.Assert(err, qt.IsNil)
+	c.Check(info.Files, qt.HasLen, 2)
+
+	_, err = buildWithSymlinks(root, SymlinkRecord)
+	c.Check(err, qt.ErrorMatches, `symlink "link" points outside the root`)
+}
+
+func TestBuildSymlinkDangling(t *testing.T) {
+	skipWithoutSymlinks(t)
+	c := qt.New(t)
+	root := symlinkTestRoot(c, "dir/missing")
+	_, err := buildWithSymlinks(root, SymlinkFollow)
+	c.Check(errors.Is(err, os.ErrNotExist), qt.IsTrue, qt.Commentf("%v", err))
+	c.Check(err, qt.ErrorMatches, "following symlink: .*")
+
+	info, err := buildWithSymlinks(root, SymlinkSkip)
+	c.Assert(err, qt.IsNil)
+	c.Check(info.Files, qt.HasLen, 2)
+
+	info, err = buildWithSymlinks(root, SymlinkRecord)
+	c.Assert(err, qt.IsNil)
+	c.Check(info.Files[2].SymlinkPath, qt.DeepEquals, []string{"dir", "missing"})
+}
+
+func TestBuildSymlinkCycle(t *testing.T) {
+	skipWithoutSymlinks(t)
+	c := qt.New(t)
+	root := c.Mkdir()
+	writeTreeFiles(c, root, pathFiles("dir/sub/a"))
+	c.Assert(os.Symlink("..", filepath.Join(root, "dir", "sub", "loop")), qt.IsNil)
+	_, err := buildWithSymlinks(root, SymlinkFollow)
+	c.Check(err, qt.ErrorMatches, `symlink "dir/sub/loop" makes a cycle`)
+
+	info, err := buildWithSymlinks(root, SymlinkRecord)
+	c.Assert(err, qt.IsNil)
+	c.Check(info.Files, qt.HasLen, 2)
+	c.Check(info.Files[1].SymlinkPath, qt.DeepEquals, []string{"dir"})
+
+	c.Assert(os.Symlink(".", filepath.Join(root, "self")), qt.IsNil)
+	_, err = buildWithSymlinks(root, SymlinkFollow)
+	c.Check(err, qt.ErrorMatches, `symlink "dir/sub/loop" makes a cycle`)
+	_, err = buildWithSymlinks(root, SymlinkRecord)
+	c.Check(err, qt.ErrorMatches, `symlink "self" points at the root`)
+}
+
+func TestBuildHybridRejectsRecordedSymlinks(t *testing.T) {
+	c := qt.New(t)
+	info := Info{PieceLength: 16384}
+	_, err := info.BuildFromFilePathOpts(context.Background(), c.Mkdir(), BuildFromFilePathOpts{
+		Version:  InfoVersionHybrid,
+		Symlinks: SymlinkRecord,
+	})
+	c.Check(err, qt.ErrorMatches, "hybrid infos can't record symlinks")
+}
+
+func TestBuildZeroLengthFiles(t *testing.T) {
+	c := qt.New(t)
+	files := map[string][]byte{
+		"0":  nil,
+		"1":  fileData(16384, 1),
+		"2a": nil,
+		"2b": nil,
+		"2c": nil,
+		"3":  fileData(100, 2),
+		"4":  nil,
+	}
+	for _, opts := range []BuildFromFilePathOpts{{}, {PadFiles: true}, {Version: InfoVersionHybrid}, {Version: InfoVersionV2}} {
+		info := buildCompareInfo(c, opts, files)
+		var names []string
+		for _, fi := range info.UpvertedFiles() {
+			if !fi.IsPadding() {
+				names = append(names, fi.DisplayPath(info))
+			}
+		}
+		c.Check(names, qt.DeepEquals, []string{"0", "1", "2a", "2b", "2c", "3", "4"}, qt.Commentf("%v", opts.Version))
+		if info.HasV1() {
+			c.Check(info.PieceEmptyFiles(0), qt.DeepEquals, []int{0})
+			// The last piece has the files at the boundary before it, and at the end.
+			c.Check(info.PieceEmptyFiles(1), qt.DeepEquals, []int{2, 3, 4, fileIndex(c, info, "4")})
+		}
+	}
+}
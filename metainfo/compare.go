@@ -0,0 +1,245 @@
+package metainfo
+
+import "strings"
+
+// Two files that look to have the same content, one from each of the infos compared by
+// CompareFiles.
+type FileMatch struct {
+	// Indices into the UpvertedFiles of each info.
+	A, B int
+	// What the match is based on.
+	By FileMatchEvidence
+}
+
+// What a FileMatch is based on. Matches by pieces root, SHA-1 or whole piece hashes are exact, and
+// the rest are probable.
+type FileMatchEvidence int
+
+const (
+	// The v2 pieces roots are equal. BEP 52.
+	FileMatchPiecesRoot FileMatchEvidence = iota
+	// The BEP 47 sha1 fields are equal.
+	FileMatchSha1
+	// The v1 piece hashes covering every byte of the files are equal. The files start on piece
+	// boundaries in both infos, which have the same piece length.
+	FileMatchPieces
+	// Some of the v1 piece hashes covering the files are equal, and none differ, but the pieces
+	// that also cover other data can't be compared.
+	FileMatchSomePieces
+	// Only the lengths and paths are equal.
+	FileMatchPath
+)
+
+func (me FileMatchEvidence) Exact() bool {
+	return me <= FileMatchPieces
+}
+
+func (me FileMatchEvidence) String() string {
+	switch me {
+	case FileMatchPiecesRoot:
+		return "pieces root"
+	case FileMatchSha1:
+		return "sha1"
+	case FileMatchPieces:
+		return "pieces"
+	case FileMatchSomePieces:
+		return "some pieces"
+	case FileMatchPath:
+		return "path"
+	default:
+		return "unknown"
+	}
+}
+
+// The result of CompareFiles. Indices are into the UpvertedFiles of each info.
+type FileComparison struct {
+	Exact    []FileMatch
+	Probable []FileMatch
+	// Files with no match in the other info.
+	OnlyA, OnlyB []int
+}
+
+// Matches the files of a with those of b by content, as far as the infos can tell. Files must be the
+// same length to match. They match exactly if their v2 pieces roots or BEP 47 SHA-1s are equal, or
+// if they're covered by the same v1 piece hashes. Otherwise they match probably if the v1 piece
+// hashes that can be compared are equal, or if they have the same path. Files with differing
+// hashes never match. Each file is matched at most once, with exact matches preferred. Padding and
+// empty files are left out.
+func CompareFiles(a, b *Info) (ret FileComparison) {
+	as, bs := fileEvidences(a), fileEvidences(b)
+	byLength := make(map[int64][]int)
+	for i := range bs {
+		if bs[i] != nil {
+			byLength[bs[i].length] = append(byLength[bs[i].length], i)
+		}
+	}
+	matchedB := make([]bool, len(bs))
+	for ai, ae := range as {
+		if ae == nil {
+			continue
+		}
+		best, bestBy := -1, FileMatchEvidence(0)
+		for _, bi := range byLength[ae.length] {
+			if matchedB[bi] {
+				continue
+			}
+			by, ok := ae.match(bs[bi])
+			if ok && (best < 0 || by < bestBy) {
+				best, bestBy = bi, by
+			}
+		}
+		if best < 0 {
+			ret.OnlyA = append(ret.OnlyA, ai)
+			continue
+		}
+		matchedB[best] = true
+		m := FileMatch{A: ai, B: best, By: bestBy}
+		if bestBy.Exact() {
+			ret.Exact = append(ret.Exact, m)
+		} else {
+			ret.Probable = append(ret.Probable, m)
+		}
+	}
+	for bi, be := range bs {
+		if be != nil && !matchedB[bi] {
+			ret.OnlyB = append(ret.OnlyB, bi)
+		}
+	}
+	return
+}
+
+// What an info says about the content of one of its files.
+type fileEvidence struct {
+	length     int64
+	path       string
+	piecesRoot string
+	sha1       string
+	// Set if the file starts on a piece boundary of a v1 info.
+	pieceLength int64
+	// The hashes of the pieces wholly within the file.
+	pieces []Hash
+	// The hash of the piece with the end of the file, if it doesn't end on a piece boundary and
+	// there's nothing but padding after it in the piece.
+	tail *Hash
+	// Whether the tail piece is padded, rather than being the short last piece.
+	tailPadded bool
+}
+
+// Returns nil for padding and empty files.
+func fileEvidences(info *Info) []*fileEvidence {
+	files := info.UpvertedFiles()
+	ret := make([]*fileEvidence, len(files))
+	hasPieces := info.HasV1() && !info.IsMerkle() && info.PieceLength > 0 && info.ValidatePieces() == nil
+	var offset int64
+	for i := range files {
+		fi := &files[i]
+		if fi.IsPadding() || fi.Length == 0 {
+			offset += fi.Length
+			continue
+		}
+		e := &fileEvidence{
+			length:     fi.Length,
+			path:       strings.Join(fi.BestPath(), "/"),
+			piecesRoot: info.filePiecesRoot(fi),
+			sha1:       fi.Sha1,
+		}
+		if !info.IsDir() {
+			e.path = info.BestName()
+		}
+		if hasPieces && offset%info.PieceLength == 0 {
+			e.setPieces(info, files, i, offset)
+		}
+		ret[i] = e
+		offset += fi.Length
+	}
+	return ret
+}
+
+func (e *fileEvidence) setPieces(info *Info, files []FileInfo, i int, offset int64) {
+	e.pieceLength = info.PieceLength
+	first := int(offset / info.PieceLength)
+	whole := int(e.length / info.PieceLength)
+	for p := first; p < first+whole; p++ {
+		e.pieces = append(e.pieces, info.Piece(p).Hash())
+	}
+	tailLength := e.length % info.PieceLength
+	if tailLength == 0 {
+		return
+	}
+	// The tail piece can be compared if the rest of it is padding, or there's no rest of it.
+	rest := info.PieceLength - tailLength
+	var padding int64
+	for _, fi := range files[i+1:] {
+		if padding >= rest || !fi.IsPadding() && fi.Length != 0 {
+			break
+		}
+		padding += fi.Length
+	}
+	switch {
+	case padding == rest:
+		e.tailPadded = true
+	case padding == 0 && offset+e.length == info.TotalLength():
+		// It's the short last piece.
+	default:
+		return
+	}
+	h := info.Piece(first + whole).Hash()
+	e.tail = &h
+}
+
+// Returns how e and o match, or false if they don't, or seem not to.
+func (e *fileEvidence) match(o *fileEvidence) (by FileMatchEvidence, ok bool) {
+	if e.length != o.length {
+		return
+	}
+	if e.piecesRoot != "" && o.piecesRoot != "" {
+		return FileMatchPiecesRoot, e.piecesRoot == o.piecesRoot
+	}
+	if e.sha1 != "" && o.sha1 != "" {
+		return FileMatchSha1, e.sha1 == o.sha1
+	}
+	if e.pieceLength != 0 && e.pieceLength == o.pieceLength {
+		for i := range e.pieces {
+			if e.pieces[i] != o.pieces[i] {
+				return
+			}
+		}
+		tailLength := e.length % e.pieceLength
+		if tailLength == 0 {
+			return FileMatchPieces, true
+		}
+		if e.tail != nil && o.tail != nil && e.tailPadded == o.tailPadded {
+			return FileMatchPieces, *e.tail == *o.tail
+		}
+		if len(e.pieces) != 0 {
+			return FileMatchSomePieces, true
+		}
+	}
+	if e.path == o.path {
+		return FileMatchPath, true
+	}
+	return
+}
+
+// Returns the v2 pieces root of the file, or "" if there isn't one.
+func (info *Info) filePiecesRoot(fi *FileInfo) string {
+	if !info.HasV2() {
+		return ""
+	}
+	path := fi.Path
+	if !info.IsDir() {
+		path = []string{info.Name}
+	}
+	ft := info.FileTree
+	for _, name := range path {
+		sub, ok := ft.Dir[name]
+		if !ok {
+			return ""
+		}
+		ft = sub
+	}
+	if ft.IsDir() {
+		return ""
+	}
+	return ft.File.PiecesRoot
+}
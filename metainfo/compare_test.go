@@ -0,0 +1,126 @@
+package metainfo
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func fileData(length int, seed byte) []byte {
+	b := make([]byte, length)
+	for i := range b {
+		b[i] = byte(i*7) ^ seed
+	}
+	return b
+}
+
+// Builds an info from files of the given data, with the paths relative to a new root.
+func buildCompareInfo(c *qt.C, opts BuildFromFilePathOpts, files map[string][]byte) *Info {
+	root := filepath.Join(c.Mkdir(), "root")
+	writeTreeFiles(c, root, files)
+	info := Info{PieceLength: 16384}
+	_, err := info.BuildFromFilePathOpts(context.Background(), root, opts)
+	c.Assert(err, qt.IsNil)
+	return &info
+}
+
+func fileIndex(c *qt.C, info *Info, path string) int {
+	for i, fi := range info.UpvertedFiles() {
+		if fi.DisplayPath(info) == path {
+			return i
+		}
+	}
+	c.Fatalf("no file %q", path)
+	return -1
+}
+
+func TestCompareFilesHybrid(t *testing.T) {
+	c := qt.New(t)
+	opts := BuildFromFilePathOpts{Version: InfoVersionHybrid}
+	a := buildCompareInfo(c, opts, map[string][]byte{
+		"x": fileData(40000, 1),
+		"y": fileData(20000, 2),
+	})
+	b := buildCompareInfo(c, opts, map[string][]byte{
+		"renamed": fileData(40000, 1),
+		"y":       fileData(20000, 3),
+		"z":       fileData(100, 4),
+	})
+	cmp := CompareFiles(a, b)
+	c.Check(cmp.Exact, qt.DeepEquals, []FileMatch{
+		{A: fileIndex(c, a, "x"), B: fileIndex(c, b, "renamed"), By: FileMatchPiecesRoot},
+	})
+	// y has the same path and length, but the pieces roots differ.
+	c.Check(cmp.Probable, qt.HasLen, 0)
+	c.Check(cmp.OnlyA, qt.DeepEquals, []int{fileIndex(c, a, "y")})
+	c.Check(cmp.OnlyB, qt.DeepEquals, []int{fileIndex(c, b, "y"), fileIndex(c, b, "z")})
+}
+
+func TestCompareFilesV1Padded(t *testing.T) {
+	c := qt.New(t)
+	opts := BuildFromFilePathOpts{PadFiles: true}
+	a := buildCompareInfo(c, opts, map[string][]byte{
+		"a/x": fileData(40000, 1),
+		"a/y": fileData(20000, 2),
+		"a/z": fileData(100, 5),
+	})
+	b := buildCompareInfo(c, opts, map[string][]byte{
+		"b/x": fileData(40000, 1),
+		"b/z": fileData(100, 5),
+	})
+	cmp := CompareFiles(a, b)
+	// The tail of a/z is the short last piece, like b/z, so they can be compared exactly.
+	c.Check(cmp.Exact, qt.DeepEquals, []FileMatch{
+		{A: fileIndex(c, a, "a/x"), B: fileIndex(c, b, "b/x"), By: FileMatchPieces},
+		{A: fileIndex(c, a, "a/z"), B: fileIndex(c, b, "b/z"), By: FileMatchPieces},
+	})
+	c.Check(cmp.OnlyA, qt.DeepEquals, []int{fileIndex(c, a, "a/y")})
+	c.Check(cmp.OnlyB, qt.HasLen, 0)
+}
+
+func TestCompareFilesV1Unpadded(t *testing.T) {
+	c := qt.New(t)
+	var opts BuildFromFilePathOpts
+	a := buildCompareInfo(c, opts, map[string][]byte{
+		"x": fileData(40000, 1),
+		"y": fileData(20000, 2),
+	})
+	b := buildCompareInfo(c, opts, map[string][]byte{
+		"x": fileData(40000, 1),
+		"y": fileData(20000, 2),
+		"z": fileData(20000, 3),
+	})
+	cmp := CompareFiles(a, b)
+	c.Check(cmp.Exact, qt.HasLen, 0)
+	// The tail of x shares a piece with y, and y doesn't start on a piece boundary.
+	c.Check(cmp.Probable, qt.DeepEquals, []FileMatch{
+		{A: 0, B: 0, By: FileMatchSomePieces},
+		{A: 1, B: 1, By: FileMatchPath},
+	})
+	c.Check(cmp.OnlyB, qt.DeepEquals, []int{2})
+}
+
+func TestCompareFilesSha1(t *testing.T) {
+	c := qt.New(t)
+	a := &Info{Name: "a", Files: []FileInfo{
+		{Path: []string{"x"}, Length: 10, Sha1: "11111111111111111111"},
+		{Path: []string{"y"}, Length: 10, Sha1: "22222222222222222222"},
+		{Path: []string{".pad", "6"}, Length: 6, Attr: "p"},
+		{Path: []string{"empty"}},
+	}}
+	b := &Info{Name: "b", Files: []FileInfo{
+		{Path: []string{"y"}, Length: 10, Sha1: "33333333333333333333"},
+		{Path: []string{"other"}, Length: 10, Sha1: "11111111111111111111"},
+		{Path: []string{"empty"}},
+	}}
+	cmp := CompareFiles(a, b)
+	c.Check(cmp, qt.DeepEquals, FileComparison{
+		Exact: []FileMatch{{A: 0, B: 1, By: FileMatchSha1}},
+		OnlyA: []int{1},
+		OnlyB: []int{0},
+	})
+	c.Check(FileMatchSha1.String(), qt.Equals, "sha1")
+	c.Check(FileMatchPath.Exact(), qt.IsFalse)
+}
@@ -0,0 +1,226 @@
+package metainfo
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dustin/go-humanize"
+)
+
+type DumpOpts struct {
+	// Where to show the creation date. Local time if nil.
+	Location *time.Location
+	// Whether to leave out the file table, which can be long.
+	NoFiles bool
+	// Whether to include BEP 47 padding files in the file table.
+	ShowPadding bool
+	// Whether to list the v1 piece hashes.
+	PieceHashes bool
+}
+
+// Writes a readable summary of the MetaInfo to w, for people rather than programs. Problems with the
+// MetaInfo, such as info bytes that don't decode, are reported inline along with whatever could be
+// shown, and the problems found by Validate are listed at the end. Only errors writing to w are
+// returned.
+func Dump(w io.Writer, mi *MetaInfo, opts DumpOpts) error {
+	d := dumper{w: w, opts: opts}
+	if d.opts.Location == nil {
+		d.opts.Location = time.Local
+	}
+	d.metaInfo(mi)
+	return d.err
+}
+
+type dumper struct {
+	w    io.Writer
+	opts DumpOpts
+	// The first error writing.
+	err error
+}
+
+func (d *dumper) printf(format string, a ...interface{}) {
+	if d.err != nil {
+		return
+	}
+	_, d.err = fmt.Fprintf(d.w, format, a...)
+}
+
+func (d *dumper) field(name string, format string, a ...interface{}) {
+	d.printf("%-14s%s\n", name+":", fmt.Sprintf(format, a...))
+}
+
+func (d *dumper) metaInfo(mi *MetaInfo) {
+	d.field("Info hash", "%s", mi.HashInfoBytes().HexString())
+	if v2, ok := mi.HashInfoBytesV2(); ok {
+		d.field("Info hash v2", "%s", v2.HexString())
+	}
+	info, err := mi.Info()
+	if err != nil {
+		d.field("Info", "can't decode: %v", err)
+	} else {
+		d.info(info)
+	}
+	if created, ok := mi.CreationTime(); ok {
+		d.field("Created", "%s", created.In(d.opts.Location).Format(time.RFC1123Z))
+	}
+	if mi.CreatedBy != "" {
+		d.field("Created by", "%q", mi.CreatedBy)
+	}
+	if mi.Comment != "" {
+		d.field("Comment", "%q", mi.Comment)
+	}
+	if mi.Encoding != "" {
+		d.field("Encoding", "%q", mi.Encoding)
+	}
+	d.trackers(mi)
+	d.list("Webseeds", mi.UrlList)
+	d.list("HTTP seeds", mi.HttpSeeds)
+	nodes := make([]string, 0, len(mi.Nodes))
+	for _, n := range mi.Nodes {
+		nodes = append(nodes, n.String())
+	}
+	d.list("Nodes", nodes)
+	if err == nil && !d.opts.NoFiles {
+		d.files(info)
+	}
+	if err == nil && d.opts.PieceHashes {
+		d.pieceHashes(info)
+	}
+	d.problems(mi.Validate())
+}
+
+func (d *dumper) info(info *Info) {
+	d.field("Name", "%q", info.BestName())
+	if info.NameUTF8 != "" && info.NameUTF8 != info.Name {
+		d.field("Raw name", "%q", info.Name)
+	}
+	d.field("Version", "%s", infoVersionString(info))
+	d.field("Piece length", "%s (%d)", humanize.IBytes(uint64(info.PieceLength)), info.PieceLength)
+	pieces := fmt.Sprintf("%d", info.NumPieces())
+	if err := info.ValidatePieces(); err != nil {
+		pieces += fmt.Sprintf(" (%v)", err)
+	}
+	d.field("Pieces", "%s", pieces)
+	if info.IsMerkle() {
+		d.field("Root hash", "%x", info.RootHash)
+	}
+	files := info.UpvertedFilesSkippingPadding()
+	d.field("Files", "%d", len(files))
+	d.field("Total size", "%s (%d bytes)", humanize.IBytes(uint64(info.TotalLengthSkippingPadding())), info.TotalLengthSkippingPadding())
+	d.field("Private", "%v", info.IsPrivate())
+	if info.Source != "" {
+		d.field("Source", "%q", info.Source)
+	}
+}
+
+func infoVersionString(info *Info) string {
+	switch {
+	case info.HasV1() && info.HasV2():
+		return "hybrid"
+	case info.HasV2():
+		return "v2"
+	case info.IsMerkle():
+		return "v1 merkle (unsupported)"
+	default:
+		return "v1"
+	}
+}
+
+// The trackers are shown as they are in the MetaInfo, rather than normalized, so that malformed
+// ones can be seen. Tiers are numbered from 1, as most clients show them.
+func (d *dumper) trackers(mi *MetaInfo) {
+	if mi.Announce == "" && len(mi.AnnounceList) == 0 {
+		d.field("Trackers", "none")
+		return
+	}
+	if mi.Announce != "" {
+		d.field("Announce", "%s", mi.Announce)
+	}
+	if len(mi.AnnounceList) == 0 {
+		return
+	}
+	d.printf("Announce list:\n")
+	for i, tier := range mi.AnnounceList {
+		d.printf("  tier %d:\n", i+1)
+		for _, url := range tier {
+			d.printf("    %s\n", url)
+		}
+	}
+}
+
+func (d *dumper) list(name string, items []string) {
+	if len(items) == 0 {
+		return
+	}
+	d.printf("%s:\n", name)
+	for _, item := range items {
+		d.printf("  %s\n", item)
+	}
+}
+
+func (d *dumper) files(info *Info) {
+	d.printf("File table:\n")
+	tw := tabwriter.NewWriter(&errWriter{d}, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(tw, "\tindex\toffset\tsize\t\tpath\n")
+	var offset int64
+	for i, fi := range info.UpvertedFiles() {
+		if !fi.IsPadding() || d.opts.ShowPadding {
+			var tags []string
+			if fi.IsPadding() {
+				tags = append(tags, "padding")
+			}
+			if fi.IsSymlink() {
+				tags = append(tags, "symlink to "+strings.Join(fi.SymlinkPath, "/"))
+			}
+			path := fi.DisplayPath(info)
+			if len(tags) != 0 {
+				path += " (" + strings.Join(tags, ", ") + ")"
+			}
+			// Right alignment applies to every cell, so the path goes after a trailing empty cell.
+			fmt.Fprintf(tw, "\t%d\t%d\t%s\t\t%s\n", i, offset, humanize.IBytes(uint64(fi.Length)), path)
+		}
+		offset += fi.Length
+	}
+	tw.Flush()
+}
+
+func (d *dumper) pieceHashes(info *Info) {
+	if !info.HasV1() || info.IsMerkle() {
+		return
+	}
+	d.printf("Piece hashes:\n")
+	for i := 0; i < info.NumPieces(); i++ {
+		d.printf("  %d: %s\n", i, info.Piece(i).Hash().HexString())
+	}
+}
+
+func (d *dumper) problems(err error) {
+	if err == nil {
+		return
+	}
+	errs := []error{err}
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		errs = joined.Unwrap()
+	}
+	d.printf("Problems:\n")
+	for _, err := range errs {
+		d.printf("  %v\n", err)
+	}
+}
+
+// Passes writes to the dumper, so that errors are kept with the rest.
+type errWriter struct {
+	d *dumper
+}
+
+func (me *errWriter) Write(b []byte) (int, error) {
+	if me.d.err != nil {
+		return 0, me.d.err
+	}
+	n, err := me.d.w.Write(b)
+	me.d.err = err
+	return n, err
+}
@@ -0,0 +1,70 @@
+package metainfo
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestDump(t *testing.T) {
+	c := qt.New(t)
+	mi, err := LoadFromFile("testdata/continuum.torrent")
+	c.Assert(err, qt.IsNil)
+	var buf bytes.Buffer
+	c.Assert(Dump(&buf, mi, DumpOpts{Location: time.UTC}), qt.IsNil)
+	out := buf.String()
+	c.Check(out, qt.Contains, "Info hash:    4029ef207642d5d6b8b9a0a484a103262f764710\n")
+	c.Check(out, qt.Contains, "Piece length: 4.0 MiB (4194304)\n")
+	c.Check(out, qt.Contains, "Pieces:       1526\n")
+	c.Check(out, qt.Contains, "Total size:   6.0 GiB (6397469459 bytes)\n")
+	c.Check(out, qt.Contains, "Created:      Sat, 23 Jun 2012 11:40:57 +0000\n")
+	c.Check(out, qt.Contains, "  tier 2:\n    http://retracker.local/announce\n")
+	c.Check(out, qt.Matches, `(?s).*\n +1 +1609073588 +1\.5 GiB  Continuum\.S01E02\.720p\.WEB-DL\.Rus\.Eng\.HDCLUB\.mkv\n.*`)
+	c.Check(out, qt.Not(qt.Contains), "Problems:")
+}
+
+func TestDumpHybridPadding(t *testing.T) {
+	c := qt.New(t)
+	mi, err := LoadFromFile("testdata/hybrid.torrent")
+	c.Assert(err, qt.IsNil)
+	var buf bytes.Buffer
+	c.Assert(Dump(&buf, mi, DumpOpts{}), qt.IsNil)
+	c.Check(buf.String(), qt.Contains, "Version:      hybrid\n")
+	c.Check(buf.String(), qt.Contains, "Info hash v2: ")
+	c.Check(buf.String(), qt.Not(qt.Contains), ".pad/")
+	buf.Reset()
+	c.Assert(Dump(&buf, mi, DumpOpts{ShowPadding: true, PieceHashes: true}), qt.IsNil)
+	c.Check(buf.String(), qt.Contains, "(padding)\n")
+	c.Check(buf.String(), qt.Contains, "Piece hashes:\n  0: ")
+}
+
+func TestDumpMalformed(t *testing.T) {
+	c := qt.New(t)
+	mi := &MetaInfo{
+		InfoBytes: []byte("x"),
+		Announce:  "http://example.com/announce",
+		Nodes:     []Node{"bad"},
+	}
+	var buf bytes.Buffer
+	c.Assert(Dump(&buf, mi, DumpOpts{}), qt.IsNil)
+	out := buf.String()
+	c.Check(out, qt.Contains, "Info:         can't decode: ")
+	c.Check(out, qt.Contains, "Announce:     http://example.com/announce\n")
+	c.Check(out, qt.Contains, "Nodes:\n  bad\n")
+	c.Check(out, qt.Matches, `(?s).*Problems:\n  decoding info: .*\n  bad node "bad": .*`)
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New("nope")
+}
+
+func TestDumpWriteError(t *testing.T) {
+	mi, err := LoadFromFile("testdata/continuum.torrent")
+	qt.Assert(t, err, qt.IsNil)
+	qt.Check(t, Dump(failingWriter{}, mi, DumpOpts{}), qt.ErrorMatches, "nope")
+}
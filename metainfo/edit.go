@@ -0,0 +1,43 @@
+package metainfo
+
+// These helpers edit only the outer MetaInfo dict. The info bytes, and so the infohash, are never
+// touched.
+
+// Replaces the trackers. The tiers are normalized, as by AnnounceList.Normalize. Announce is set to
+// the first tracker for clients that don't support BEP 12.
+func (mi *MetaInfo) SetAnnounceList(tiers [][]string) {
+	mi.AnnounceList = AnnounceList(tiers).normalized()
+	mi.Announce = ""
+	if len(mi.AnnounceList) != 0 {
+		mi.Announce = mi.AnnounceList[0][0]
+	}
+}
+
+// Removes the tracker from Announce and every tier of AnnounceList, dropping any tiers that become
+// empty.
+func (mi *MetaInfo) RemoveTracker(url string) {
+	al := mi.UpvertedAnnounceList()
+	al.Remove(url)
+	mi.SetAnnounceList(al)
+}
+
+// Adds a BEP 19 webseed, if it isn't already present.
+func (mi *MetaInfo) AddWebSeed(url string) {
+	for _, u := range mi.UrlList {
+		if u == url {
+			return
+		}
+	}
+	mi.UrlList = append(mi.UrlList, url)
+}
+
+// Removes every occurrence of the BEP 19 webseed.
+func (mi *MetaInfo) RemoveWebSeed(url string) {
+	var urls UrlList
+	for _, u := range mi.UrlList {
+		if u != url {
+			urls = append(urls, u)
+		}
+	}
+	mi.UrlList = urls
+}
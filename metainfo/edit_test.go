@@ -0,0 +1,72 @@
+package metainfo
+
+import (
+	"bytes"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestSetAnnounceListNormalizes(t *testing.T) {
+	var mi MetaInfo
+	mi.SetAnnounceList([][]string{{}, {"", "a", "b", "a"}, {"b"}, {"c"}})
+	qt.Assert(t, mi.AnnounceList, qt.DeepEquals, AnnounceList{{"a", "b"}, {"c"}})
+	qt.Assert(t, mi.Announce, qt.Equals, "a")
+	mi.SetAnnounceList(nil)
+	qt.Assert(t, mi.AnnounceList, qt.IsNil)
+	qt.Assert(t, mi.Announce, qt.Equals, "")
+}
+
+func TestRemoveTracker(t *testing.T) {
+	mi := MetaInfo{
+		Announce:     "a",
+		AnnounceList: AnnounceList{{"a"}, {"b", "a", "c"}},
+	}
+	mi.RemoveTracker("a")
+	qt.Assert(t, mi.AnnounceList, qt.DeepEquals, AnnounceList{{"b", "c"}})
+	qt.Assert(t, mi.Announce, qt.Equals, "b")
+	// A lone announce is upverted first.
+	mi = MetaInfo{Announce: "a"}
+	mi.RemoveTracker("a")
+	qt.Assert(t, mi.Announce, qt.Equals, "")
+	qt.Assert(t, mi.AnnounceList, qt.IsNil)
+}
+
+func TestWebSeedEdits(t *testing.T) {
+	var mi MetaInfo
+	mi.AddWebSeed("http://a/")
+	mi.AddWebSeed("http://b/")
+	mi.AddWebSeed("http://a/")
+	qt.Assert(t, mi.UrlList, qt.DeepEquals, UrlList{"http://a/", "http://b/"})
+	mi.RemoveWebSeed("http://a/")
+	qt.Assert(t, mi.UrlList, qt.DeepEquals, UrlList{"http://b/"})
+}
+
+// No combination of edits may change the infohash.
+func TestEditsPreserveInfoHash(t *testing.T) {
+	c := qt.New(t)
+	mi, err := LoadFromFile("testdata/archlinux-2011.08.19-netinstall-i686.iso.torrent")
+	c.Assert(err, qt.IsNil)
+	expected := mi.HashInfoBytes()
+	check := func() {
+		c.Helper()
+		loaded, err := LoadBytes(mustWriteBytes(c, mi))
+		c.Assert(err, qt.IsNil)
+		c.Assert(loaded.HashInfoBytes(), qt.Equals, expected)
+	}
+	mi.SetAnnounceList([][]string{{"http://a/announce"}, {"http://b/announce", "http://a/announce"}})
+	check()
+	mi.AddWebSeed("http://seed/")
+	check()
+	mi.RemoveTracker("http://a/announce")
+	check()
+	mi.RemoveWebSeed("http://seed/")
+	mi.RemoveTracker("http://b/announce")
+	check()
+}
+
+func mustWriteBytes(c *qt.C, mi *MetaInfo) []byte {
+	var buf bytes.Buffer
+	c.Assert(mi.Write(&buf), qt.IsNil)
+	return buf.Bytes()
+}
@@ -0,0 +1,86 @@
+package metainfo
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// A file's data doesn't have the pieces root given for it in the file tree.
+type FileRootError struct {
+	// As in the keys of Info.FileRoots.
+	Path     string
+	Expected Hash32
+	Actual   Hash32
+}
+
+func (me FileRootError) Error() string {
+	return fmt.Sprintf("file %q has pieces root %x, expected %x", me.Path, me.Actual, me.Expected)
+}
+
+// Returns the BEP 52 pieces roots of the files in the file tree, by their paths in the tree joined
+// with "/". For single-file infos, that's the name. Empty files have no root, and are left out, as
+// are roots of the wrong length. The map is empty for infos without v2 fields.
+func (info *Info) FileRoots() map[string]Hash32 {
+	ret := make(map[string]Hash32)
+	if !info.HasV2() {
+		return ret
+	}
+	info.FileTree.walkFiles(nil, func(path []string, file FileTreeFile) {
+		if len(file.PiecesRoot) != Hash32Size {
+			return
+		}
+		var h Hash32
+		copy(h[:], file.PiecesRoot)
+		ret[strings.Join(path, "/")] = h
+	})
+	return ret
+}
+
+// Checks the file at name on disk against the pieces root of the file at path in the file tree,
+// with path as in the keys of FileRoots. Unlike v1 pieces, which can span files, this needs nothing
+// but the one file. A FileRootError is returned if the data doesn't match.
+func (info *Info) VerifyFileRoot(path, name string) error {
+	ft := &info.FileTree
+	for _, elem := range strings.Split(path, "/") {
+		sub, ok := ft.Dir[elem]
+		if !ok {
+			return fmt.Errorf("no file %q in file tree", path)
+		}
+		ft = &sub
+	}
+	if ft.IsDir() {
+		return fmt.Errorf("%q is a directory in the file tree", path)
+	}
+	if err := checkV2PieceLength(info.PieceLength); err != nil {
+		return err
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if fi.Size() != ft.File.Length {
+		return fmt.Errorf("file %q is %v bytes, expected %v", path, fi.Size(), ft.File.Length)
+	}
+	if ft.File.Length == 0 {
+		return nil
+	}
+	if len(ft.File.PiecesRoot) != Hash32Size {
+		return fmt.Errorf("file %q has pieces root of length %v", path, len(ft.File.PiecesRoot))
+	}
+	root, _, err := generateV2PieceLayer(f, ft.File.Length, info.PieceLength, func(int64) error { return nil })
+	if err != nil {
+		return fmt.Errorf("hashing %q: %w", name, err)
+	}
+	var expected Hash32
+	copy(expected[:], ft.File.PiecesRoot)
+	if Hash32(root) != expected {
+		return FileRootError{Path: path, Expected: expected, Actual: root}
+	}
+	return nil
+}
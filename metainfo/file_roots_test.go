@@ -0,0 +1,86 @@
+package metainfo
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+// Writes the data described by testdata/hybrid.torrent.
+func writeHybridTestData(c *qt.C) (root string) {
+	root = filepath.Join(c.Mkdir(), "hybrid")
+	a := make([]byte, 20000)
+	for i := range a {
+		a[i] = byte(i % 251)
+	}
+	writeTreeFiles(c, root, map[string][]byte{"a": a, "b": fileData(5000, 0)})
+	return
+}
+
+// The roots are from testdata/hybrid.torrent, which wasn't made by this package. File a is longer
+// than a piece, and b is shorter.
+func TestVerifyFileRoot(t *testing.T) {
+	c := qt.New(t)
+	mi, err := LoadFromFile("testdata/hybrid.torrent")
+	c.Assert(err, qt.IsNil)
+	info, err := mi.UnmarshalInfo()
+	c.Assert(err, qt.IsNil)
+	roots := info.FileRoots()
+	c.Check(roots, qt.HasLen, 2)
+	for path := range roots {
+		c.Check(roots[path].AsString(), qt.Equals, info.FileTree.Dir[path].File.PiecesRoot)
+	}
+	root := writeHybridTestData(c)
+	for _, path := range []string{"a", "b"} {
+		c.Check(info.VerifyFileRoot(path, filepath.Join(root, path)), qt.IsNil)
+	}
+	// Flip a bit in the second piece of a.
+	name := filepath.Join(root, "a")
+	data, err := ioutil.ReadFile(name)
+	c.Assert(err, qt.IsNil)
+	data[19999] ^= 1
+	c.Assert(ioutil.WriteFile(name, data, 0o600), qt.IsNil)
+	err = info.VerifyFileRoot("a", name)
+	var rootErr FileRootError
+	c.Assert(errors.As(err, &rootErr), qt.IsTrue)
+	c.Check(rootErr.Path, qt.Equals, "a")
+	c.Check(rootErr.Expected, qt.Equals, roots["a"])
+	c.Check(rootErr.Actual, qt.Not(qt.Equals), roots["a"])
+	// The other file can still be checked alone.
+	c.Check(info.VerifyFileRoot("b", filepath.Join(root, "b")), qt.IsNil)
+	c.Check(info.VerifyFileRoot("c", name), qt.ErrorMatches, `no file "c" in file tree`)
+	c.Check(info.VerifyFileRoot("b", name), qt.ErrorMatches, `file "b" is 20000 bytes, expected 5000`)
+}
+
+// Checks the files against roots from a torrent libtorrent made from the same data.
+func TestVerifyFileRootLibtorrent(t *testing.T) {
+	c := qt.New(t)
+	mi, _, _ := loadLibtorrentHybrid(c)
+	info, err := mi.UnmarshalInfo()
+	c.Assert(err, qt.IsNil)
+	c.Check(info.FileRoots(), qt.HasLen, 2)
+	root := writeHybridTestData(c)
+	for _, path := range []string{"a", "b"} {
+		c.Check(info.VerifyFileRoot(path, filepath.Join(root, path)), qt.IsNil)
+	}
+}
+
+func TestFileRootsSingleFile(t *testing.T) {
+	c := qt.New(t)
+	name := filepath.Join(c.Mkdir(), "single")
+	c.Assert(ioutil.WriteFile(name, fileData(40000, 1), 0o600), qt.IsNil)
+	info := Info{PieceLength: 16384}
+	_, err := info.BuildFromFilePathOpts(context.Background(), name, BuildFromFilePathOpts{Version: InfoVersionHybrid})
+	c.Assert(err, qt.IsNil)
+	roots := info.FileRoots()
+	c.Assert(roots, qt.HasLen, 1)
+	_, ok := roots["single"]
+	c.Check(ok, qt.IsTrue)
+	c.Check(info.VerifyFileRoot("single", name), qt.IsNil)
+	var v1 Info
+	c.Check(v1.FileRoots(), qt.HasLen, 0)
+}
@@ -1,22 +1,49 @@
 package metainfo
 
-import "strings"
+import (
+	"strings"
+	"unicode/utf8"
+)
 
 // Information specific to a single file inside the MetaInfo structure.
 type FileInfo struct {
 	Length   int64    `bencode:"length"` // BEP3
 	Path     []string `bencode:"path"`   // BEP3
 	PathUTF8 []string `bencode:"path.utf-8,omitempty"`
+	Attr     string   `bencode:"attr,omitempty"` // BEP47
+	// Where the file links to, relative to the root, for symlink files. BEP 47.
+	SymlinkPath []string `bencode:"symlink path,omitempty"`
+	// Hex MD5 of the file, from the original BitTorrent specification.
+	Md5sum string `bencode:"md5sum,omitempty"`
+	// SHA-1 of the file, as the 20 raw bytes. BEP 47.
+	Sha1 string `bencode:"sha1,omitempty"`
+	// Modification time in seconds since the epoch. Not standardized, but emitted by some clients.
+	// Some, like archive.org, emit it as a string, which is ignored.
+	Mtime int64 `bencode:"mtime,omitempty,ignore_unmarshal_type_error"`
 }
 
 func (fi *FileInfo) DisplayPath(info *Info) string {
 	if info.IsDir() {
-		return strings.Join(fi.Path, "/")
+		return strings.Join(fi.BestPath(), "/")
 	} else {
-		return info.Name
+		return info.BestName()
 	}
 }
 
+// The path to display, which is PathUTF8 if it's set and every component is valid, and otherwise
+// Path.
+func (fi *FileInfo) BestPath() []string {
+	if len(fi.PathUTF8) == 0 {
+		return fi.Path
+	}
+	for _, comp := range fi.PathUTF8 {
+		if !utf8.ValidString(comp) {
+			return fi.Path
+		}
+	}
+	return fi.PathUTF8
+}
+
 func (me FileInfo) Offset(info *Info) (ret int64) {
 	for _, fi := range info.UpvertedFiles() {
 		if me.DisplayPath(info) == fi.DisplayPath(info) {
@@ -26,3 +53,34 @@ func (me FileInfo) Offset(info *Info) (ret int64) {
 	}
 	panic("not found")
 }
+
+// The attr field marks the file as padding (BEP 47), so its content is zeroes. This alone
+// determines how the file is hashed.
+func (fi *FileInfo) hasPaddingAttr() bool {
+	return strings.ContainsRune(fi.Attr, 'p')
+}
+
+// The attr field marks the file as a symlink (BEP 47), to the path in SymlinkPath. It has no data.
+func (fi *FileInfo) IsSymlink() bool {
+	return strings.ContainsRune(fi.Attr, 'l')
+}
+
+// Whether the file is BEP 47 padding, and not a real file. This is determined by the attr field, or
+// the convention of placing padding files in the ".pad" directory for clients that omit attr.
+func (fi *FileInfo) IsPadding() bool {
+	return fi.hasPaddingAttr() || len(fi.Path) == 2 && fi.Path[0] == ".pad"
+}
+
+// Like Offset, but excluding the lengths of any padding files before this one. This is the offset
+// of the file's data among the real files only, and not in the torrent.
+func (me FileInfo) OffsetSkippingPadding(info *Info) (ret int64) {
+	for _, fi := range info.UpvertedFiles() {
+		if me.DisplayPath(info) == fi.DisplayPath(info) {
+			return
+		}
+		if !fi.IsPadding() {
+			ret += fi.Length
+		}
+	}
+	panic("not found")
+}
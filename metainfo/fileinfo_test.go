@@ -0,0 +1,68 @@
+package metainfo
+
+import (
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestFileInfoIsPadding(t *testing.T) {
+	c := qt.New(t)
+	c.Check((&FileInfo{Path: []string{".pad", "16384"}, Attr: "p"}).IsPadding(), qt.IsTrue)
+	c.Check((&FileInfo{Path: []string{".pad", "16384"}}).IsPadding(), qt.IsTrue)
+	c.Check((&FileInfo{Path: []string{"pad"}, Attr: "xp"}).IsPadding(), qt.IsTrue)
+	c.Check((&FileInfo{Path: []string{".pad"}}).IsPadding(), qt.IsFalse)
+	c.Check((&FileInfo{Path: []string{"a", ".pad", "1"}}).IsPadding(), qt.IsFalse)
+	c.Check((&FileInfo{Path: []string{"a"}, Attr: "x"}).IsPadding(), qt.IsFalse)
+}
+
+func TestFileInfoBestPath(t *testing.T) {
+	c := qt.New(t)
+	c.Check((&FileInfo{Path: []string{"a"}}).BestPath(), qt.DeepEquals, []string{"a"})
+	c.Check((&FileInfo{Path: []string{"a"}, PathUTF8: []string{"b", "c"}}).BestPath(), qt.DeepEquals, []string{"b", "c"})
+	c.Check((&FileInfo{Path: []string{"a"}, PathUTF8: []string{"b", "\xff"}}).BestPath(), qt.DeepEquals, []string{"a"})
+	c.Check((&Info{Name: "a"}).BestName(), qt.Equals, "a")
+	c.Check((&Info{Name: "a", NameUTF8: "b"}).BestName(), qt.Equals, "b")
+	c.Check((&Info{Name: "a", NameUTF8: "\xff"}).BestName(), qt.Equals, "a")
+}
+
+func TestPaddingMidList(t *testing.T) {
+	c := qt.New(t)
+	info := Info{
+		PieceLength: 4,
+		Files: []FileInfo{
+			{Length: 1, Path: []string{"a"}},
+			{Length: 3, Path: []string{".pad", "3"}, Attr: "p"},
+			{Length: 2, Path: []string{"b"}},
+			{Length: 2, Path: []string{".pad", "2"}},
+			{Length: 5, Path: []string{"c"}},
+		},
+	}
+	c.Check(info.UpvertedFilesSkippingPadding(), qt.DeepEquals, []FileInfo{
+		{Length: 1, Path: []string{"a"}},
+		{Length: 2, Path: []string{"b"}},
+		{Length: 5, Path: []string{"c"}},
+	})
+	c.Check(info.TotalLength(), qt.Equals, int64(13))
+	c.Check(info.TotalLengthSkippingPadding(), qt.Equals, int64(8))
+	c.Check(info.Files[4].Offset(&info), qt.Equals, int64(8))
+	c.Check(info.Files[4].OffsetSkippingPadding(&info), qt.Equals, int64(3))
+}
+
+func TestPaddingAfterLastFile(t *testing.T) {
+	c := qt.New(t)
+	info := Info{
+		PieceLength: 4,
+		Files: []FileInfo{
+			{Length: 4, Path: []string{"a"}},
+			{Length: 1, Path: []string{"b"}},
+			{Length: 3, Path: []string{".pad", "3"}, Attr: "p"},
+		},
+	}
+	files := info.UpvertedFilesSkippingPadding()
+	c.Check(files, qt.HasLen, 2)
+	c.Check(files[1].Path, qt.DeepEquals, []string{"b"})
+	c.Check(info.TotalLength(), qt.Equals, int64(8))
+	c.Check(info.TotalLengthSkippingPadding(), qt.Equals, int64(5))
+	c.Check(files[1].OffsetSkippingPadding(&info), qt.Equals, int64(4))
+}
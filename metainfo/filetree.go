@@ -0,0 +1,110 @@
+package metainfo
+
+import (
+	"sort"
+
+	"github.com/anacrolix/torrent/bencode"
+)
+
+// The key in a v2 file tree dict that holds the properties of a file, rather than naming a child.
+const FileTreePropertiesKey = ""
+
+// The properties of a file in a BEP 52 file tree.
+type FileTreeFile struct {
+	Length int64 `bencode:"length"`
+	// The root of the file's merkle tree. Omitted for empty files.
+	PiecesRoot string `bencode:"pieces root,omitempty"`
+}
+
+// A node in the BEP 52 "file tree". A node is either a file, in which case File is set and Dir is
+// nil, or a directory of named children. The bencoding is handled manually, as files are
+// distinguished from directories by the presence of the empty key.
+type FileTree struct {
+	File FileTreeFile
+	Dir  map[string]FileTree
+}
+
+var (
+	_ bencode.Marshaler   = FileTree{}
+	_ bencode.Unmarshaler = (*FileTree)(nil)
+)
+
+func (ft *FileTree) UnmarshalBencode(b []byte) (err error) {
+	var dir map[string]bencode.Bytes
+	err = bencode.Unmarshal(b, &dir)
+	if err != nil {
+		return
+	}
+	if props, ok := dir[FileTreePropertiesKey]; ok {
+		ft.Dir = nil
+		return bencode.Unmarshal(props, &ft.File)
+	}
+	ft.File = FileTreeFile{}
+	ft.Dir = make(map[string]FileTree, len(dir))
+	for name, b := range dir {
+		var sub FileTree
+		err = bencode.Unmarshal(b, &sub)
+		if err != nil {
+			return
+		}
+		ft.Dir[name] = sub
+	}
+	return
+}
+
+func (ft FileTree) MarshalBencode() ([]byte, error) {
+	if ft.IsDir() {
+		return bencode.Marshal(ft.Dir)
+	}
+	return bencode.Marshal(map[string]FileTreeFile{FileTreePropertiesKey: ft.File})
+}
+
+func (ft *FileTree) IsDir() bool {
+	return ft.Dir != nil
+}
+
+// The names of the children of a directory node, in the order they're bencoded.
+func (ft *FileTree) orderedKeys() (ret []string) {
+	for name := range ft.Dir {
+		ret = append(ret, name)
+	}
+	sort.Strings(ret)
+	return
+}
+
+// Calls f for each file under the node, in file tree order. path is the path of the node itself.
+func (ft *FileTree) walkFiles(path []string, f func(path []string, file FileTreeFile)) {
+	if !ft.IsDir() {
+		f(path, ft.File)
+		return
+	}
+	for _, name := range ft.orderedKeys() {
+		sub := ft.Dir[name]
+		sub.walkFiles(append(path[:len(path):len(path)], name), f)
+	}
+}
+
+// Returns the files in the tree in the v1 FileInfo form.
+func (ft *FileTree) upvertedFiles() (ret []FileInfo) {
+	ft.walkFiles(nil, func(path []string, file FileTreeFile) {
+		ret = append(ret, FileInfo{
+			Length: file.Length,
+			Path:   path,
+		})
+	})
+	return
+}
+
+// Adds a file at the given path below the node, creating directories as required.
+func (ft *FileTree) insert(path []string, file FileTreeFile) {
+	if len(path) == 0 {
+		*ft = FileTree{File: file}
+		return
+	}
+	if ft.Dir == nil {
+		ft.Dir = make(map[string]FileTree)
+	}
+	sub := ft.Dir[path[0]]
+	sub.insert(path[1:], file)
+	ft.Dir[path[0]] = sub
+}
@@ -0,0 +1,103 @@
+package metainfo
+
+import (
+	"strings"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/anacrolix/torrent/bencode"
+)
+
+var testPiecesRoot = strings.Repeat("\xaa", 32)
+
+func TestUnmarshalV2MultiFileInfo(t *testing.T) {
+	c := qt.New(t)
+	mi, err := LoadBytes(bencode.MustMarshal(map[string]interface{}{
+		"info": map[string]interface{}{
+			"name":         "dir",
+			"piece length": 16384,
+			"meta version": 2,
+			"file tree": map[string]interface{}{
+				"b": map[string]interface{}{
+					"": map[string]interface{}{"length": 1, "pieces root": testPiecesRoot},
+				},
+				"a": map[string]interface{}{
+					"c": map[string]interface{}{
+						"": map[string]interface{}{"length": 2, "pieces root": testPiecesRoot},
+					},
+					"empty": map[string]interface{}{
+						"": map[string]interface{}{"length": 0},
+					},
+				},
+			},
+		},
+		"piece layers": map[string]interface{}{},
+	}))
+	c.Assert(err, qt.IsNil)
+	info, err := mi.UnmarshalInfo()
+	c.Assert(err, qt.IsNil)
+	c.Check(info.HasV1(), qt.IsFalse)
+	c.Check(info.HasV2(), qt.IsTrue)
+	c.Check(info.IsDir(), qt.IsTrue)
+	c.Check(info.UpvertedFiles(), qt.DeepEquals, []FileInfo{
+		{Length: 2, Path: []string{"a", "c"}},
+		{Length: 0, Path: []string{"a", "empty"}},
+		{Length: 1, Path: []string{"b"}},
+	})
+	c.Check(info.TotalLength(), qt.Equals, int64(3))
+	c.Check(info.FileTree.Dir["a"].Dir["c"].File.PiecesRoot, qt.Equals, testPiecesRoot)
+	// The info must survive a round trip unchanged, or the infohash would differ.
+	b, err := bencode.Marshal(info)
+	c.Assert(err, qt.IsNil)
+	c.Check(string(b), qt.Equals, string(mi.InfoBytes))
+}
+
+func TestUnmarshalV2SingleFileInfo(t *testing.T) {
+	c := qt.New(t)
+	infoBytes := bencode.MustMarshal(map[string]interface{}{
+		"name":         "file",
+		"piece length": 16384,
+		"meta version": 2,
+		"file tree": map[string]interface{}{
+			"file": map[string]interface{}{
+				"": map[string]interface{}{"length": 42, "pieces root": testPiecesRoot},
+			},
+		},
+	})
+	var info Info
+	c.Assert(bencode.Unmarshal(infoBytes, &info), qt.IsNil)
+	c.Check(info.IsDir(), qt.IsFalse)
+	files := info.UpvertedFiles()
+	c.Check(files, qt.DeepEquals, []FileInfo{{Length: 42}})
+	c.Check(files[0].DisplayPath(&info), qt.Equals, "file")
+	c.Check(info.TotalLength(), qt.Equals, int64(42))
+}
+
+func TestHybridInfoPrefersV1Files(t *testing.T) {
+	c := qt.New(t)
+	infoBytes := bencode.MustMarshal(map[string]interface{}{
+		"name":         "dir",
+		"piece length": 16384,
+		"meta version": 2,
+		"pieces":       strings.Repeat("\x00", 40),
+		"files": []interface{}{
+			map[string]interface{}{"length": 1, "path": []string{"a"}},
+			map[string]interface{}{"length": 16383, "path": []string{".pad", "16383"}, "attr": "p"},
+			map[string]interface{}{"length": 1, "path": []string{"b"}},
+		},
+		"file tree": map[string]interface{}{
+			"a": map[string]interface{}{"": map[string]interface{}{"length": 1, "pieces root": testPiecesRoot}},
+			"b": map[string]interface{}{"": map[string]interface{}{"length": 1, "pieces root": testPiecesRoot}},
+		},
+	})
+	var info Info
+	c.Assert(bencode.Unmarshal(infoBytes, &info), qt.IsNil)
+	c.Check(info.HasV1(), qt.IsTrue)
+	c.Check(info.HasV2(), qt.IsTrue)
+	c.Check(info.UpvertedFiles(), qt.HasLen, 3)
+	c.Check(info.FileTree.upvertedFiles(), qt.DeepEquals, []FileInfo{
+		{Length: 1, Path: []string{"a"}},
+		{Length: 1, Path: []string{"b"}},
+	})
+}
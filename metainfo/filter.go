@@ -0,0 +1,45 @@
+package metainfo
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// Files that don't belong in torrents made from working directories, for use with GlobFilter.
+var JunkFilePatterns = []string{
+	".DS_Store",
+	"Thumbs.db",
+	"desktop.ini",
+	".git",
+	// Partial downloads from common browsers and clients.
+	"*.part",
+	"*.crdownload",
+	"*.!qB",
+	"*.!ut",
+}
+
+// Returns a BuildFromFilePathOpts.Filter that leaves out anything matching one of the patterns.
+// Patterns use path.Match syntax, and are matched against both the name and the slash-separated
+// path relative to the root. So "*.part" leaves out partial files anywhere, and "docs/drafts" leaves
+// out only that directory.
+func GlobFilter(patterns ...string) (func(path string, fi os.FileInfo) bool, error) {
+	for _, p := range patterns {
+		if _, err := path.Match(p, ""); err != nil {
+			return nil, fmt.Errorf("bad pattern %q: %w", p, err)
+		}
+	}
+	return func(relPath string, fi os.FileInfo) bool {
+		relPath = filepath.ToSlash(relPath)
+		for _, p := range patterns {
+			if m, _ := path.Match(p, path.Base(relPath)); m {
+				return false
+			}
+			if m, _ := path.Match(p, relPath); m {
+				return false
+			}
+		}
+		return true
+	}, nil
+}
@@ -0,0 +1,93 @@
+package metainfo
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/anacrolix/torrent/bencode"
+)
+
+func buildFiltered(root string, filter func(string, os.FileInfo) bool) (Info, error) {
+	info := Info{PieceLength: 16384}
+	_, err := info.BuildFromFilePathOpts(context.Background(), root, BuildFromFilePathOpts{Filter: filter})
+	return info, err
+}
+
+func TestBuildFromFilePathFilter(t *testing.T) {
+	c := qt.New(t)
+	filter, err := GlobFilter(JunkFilePatterns...)
+	c.Assert(err, qt.IsNil)
+	root := filepath.Join(c.Mkdir(), "root")
+	writeTreeFiles(c, root, pathFiles("a", "b/c", "b/c.part", ".git/config", "b/.DS_Store", "Thumbs.db"))
+	filtered, err := buildFiltered(root, filter)
+	c.Assert(err, qt.IsNil)
+
+	// The excluded files must affect neither the files nor the pieces.
+	clean := filepath.Join(c.Mkdir(), "root")
+	writeTreeFiles(c, clean, pathFiles("a", "b/c"))
+	expected, err := buildFiltered(clean, nil)
+	c.Assert(err, qt.IsNil)
+	c.Check(filtered.Files, qt.DeepEquals, expected.Files)
+	c.Check(string(bencode.MustMarshal(filtered)), qt.Equals, string(bencode.MustMarshal(expected)))
+}
+
+func TestBuildFromFilePathFilterPaths(t *testing.T) {
+	c := qt.New(t)
+	root := c.Mkdir()
+	writeTreeFiles(c, root, pathFiles("docs/drafts/x", "docs/final", "other/drafts/y"))
+	filter, err := GlobFilter("docs/drafts")
+	c.Assert(err, qt.IsNil)
+	info, err := buildFiltered(root, filter)
+	c.Assert(err, qt.IsNil)
+	c.Check(info.Files, qt.HasLen, 2)
+	c.Check(info.Files[0].Path, qt.DeepEquals, []string{"docs", "final"})
+	c.Check(info.Files[1].Path, qt.DeepEquals, []string{"other", "drafts", "y"})
+}
+
+func TestBuildFromFilePathFilterEverything(t *testing.T) {
+	c := qt.New(t)
+	root := c.Mkdir()
+	writeTreeFiles(c, root, pathFiles("a", "b/c"))
+	_, err := buildFiltered(root, func(string, os.FileInfo) bool { return false })
+	c.Check(err, qt.ErrorMatches, "every file was excluded by the filter")
+}
+
+func TestBuildFromFilePathFilterSymlinkedDir(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks need privileges")
+	}
+	c := qt.New(t)
+	root := c.Mkdir()
+	writeTreeFiles(c, root, pathFiles("a"))
+	target := c.Mkdir()
+	writeTreeFiles(c, target, pathFiles("b"))
+	c.Assert(os.Symlink(target, filepath.Join(root, "link")), qt.IsNil)
+	var filtered []os.FileInfo
+	info, err := buildFiltered(root, func(path string, fi os.FileInfo) bool {
+		if path == "link" {
+			filtered = append(filtered, fi)
+			return false
+		}
+		return true
+	})
+	c.Assert(err, qt.IsNil)
+	c.Check(info.Files, qt.HasLen, 1)
+	c.Assert(filtered, qt.HasLen, 1)
+	// The filter is given the target, so it can tell the link is to a directory.
+	c.Check(filtered[0].IsDir(), qt.IsTrue)
+	// Without the filter, the directory is followed.
+	info, err = buildFiltered(root, nil)
+	c.Assert(err, qt.IsNil)
+	c.Check(info.Files, qt.HasLen, 2)
+	c.Check(info.Files[1].Path, qt.DeepEquals, []string{"link", "b"})
+}
+
+func TestGlobFilterBadPattern(t *testing.T) {
+	_, err := GlobFilter("[")
+	qt.Assert(t, err, qt.ErrorMatches, `bad pattern "\[": syntax error in pattern`)
+}
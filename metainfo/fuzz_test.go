@@ -0,0 +1,108 @@
+package metainfo
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/anacrolix/torrent/bencode"
+)
+
+// Adds the small fixtures as seeds, or their info bytes. The fuzzer makes little progress mutating
+// large inputs.
+func addFuzzSeeds(f *testing.F, infoBytes bool) {
+	paths, err := filepath.Glob("testdata/*.torrent")
+	if err != nil {
+		f.Fatal(err)
+	}
+	for _, p := range paths {
+		b, err := ioutil.ReadFile(p)
+		if err != nil {
+			f.Fatal(err)
+		}
+		if infoBytes {
+			mi, _, err := LoadLenient(b)
+			if err != nil {
+				f.Fatal(err)
+			}
+			b = mi.InfoBytes
+		}
+		if len(b) < 1000 {
+			f.Add(b)
+		}
+	}
+}
+
+func FuzzLoadBytes(f *testing.F) {
+	addFuzzSeeds(f, false)
+	// Nesting deep enough to exhaust the stack of a decoder that recursed without a limit.
+	const depth = 100000
+	f.Add([]byte("d4:info" + strings.Repeat("l", depth) + strings.Repeat("e", depth) + "e"))
+	f.Add([]byte("d5:other" + strings.Repeat("d1:a", depth) + "i1e" + strings.Repeat("e", depth) + "e"))
+	f.Fuzz(func(t *testing.T, b []byte) {
+		mi, err := LoadBytes(b)
+		if err != nil && !errors.As(err, new(RepairedError)) {
+			return
+		}
+		// Whatever was loaded must encode again, and load strictly the same way.
+		encoded := bencode.MustMarshal(mi)
+		reloaded, err := Load(bytes.NewReader(encoded))
+		if err != nil {
+			t.Fatalf("reloading %q: %v", encoded, err)
+		}
+		if again := bencode.MustMarshal(reloaded); !bytes.Equal(again, encoded) {
+			t.Fatalf("encoded %q, then %q", encoded, again)
+		}
+		mi.Validate()
+		mi.InfoSummary()
+		mi.CheckPrivate()
+		mi.Magnet(nil, nil)
+		Dump(ioutil.Discard, mi, DumpOpts{ShowPadding: true})
+		if _, err := json.Marshal(mi); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func FuzzUnmarshalInfo(f *testing.F) {
+	addFuzzSeeds(f, true)
+	f.Fuzz(func(t *testing.T, b []byte) {
+		var info Info
+		if bencode.Unmarshal(b, &info) != nil {
+			return
+		}
+		encoded, err := bencode.Marshal(info)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var reloaded Info
+		if err := bencode.Unmarshal(encoded, &reloaded); err != nil {
+			t.Fatalf("decoding %q: %v", encoded, err)
+		}
+		if again := bencode.MustMarshal(reloaded); !bytes.Equal(again, encoded) {
+			t.Fatalf("encoded %q, then %q", encoded, again)
+		}
+		info.validate()
+		info.UpvertedFiles()
+		info.IsDir()
+		info.BestName()
+		info.FileRoots()
+		info.summary()
+		if _, err := json.Marshal(info); err != nil {
+			t.Fatal(err)
+		}
+		// Walking the pieces takes as long as there are pieces, however short the input.
+		if info.ValidatePieces() == nil && info.NumPieces() < 1000 {
+			for i := 0; i < info.NumPieces(); i++ {
+				info.PieceExtents(i)
+				if _, err := info.PieceLengthAt(i); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+	})
+}
@@ -3,8 +3,12 @@ package metainfo
 import (
 	"crypto/sha1"
 	"encoding"
+	"encoding/base32"
 	"encoding/hex"
 	"fmt"
+	"strings"
+
+	"github.com/anacrolix/torrent/bencode"
 )
 
 const HashSize = 20
@@ -63,6 +67,65 @@ func (h Hash) MarshalText() (text []byte, err error) {
 	return []byte(h.HexString()), nil
 }
 
+var (
+	_ bencode.Marshaler   = Hash{}
+	_ bencode.Unmarshaler = (*Hash)(nil)
+)
+
+// Hashes are bencoded as 20-byte strings, as in the BEP 38 similar list.
+func (h Hash) MarshalBencode() ([]byte, error) {
+	return bencode.Marshal(h[:])
+}
+
+func (h *Hash) UnmarshalBencode(b []byte) error {
+	var s string
+	err := bencode.Unmarshal(b, &s)
+	if err != nil {
+		return err
+	}
+	if len(s) != HashSize {
+		return fmt.Errorf("hash string has bad length: %d", len(s))
+	}
+	copy(h[:], s)
+	return nil
+}
+
+// Parses a v1 infohash as 40 hex characters, or 32 base32 characters as in some magnet links. Both
+// are case-insensitive.
+func ParseHash(s string) (h Hash, err error) {
+	switch len(s) {
+	case 2 * HashSize:
+		err = h.FromHexString(s)
+		if err != nil {
+			err = fmt.Errorf("parsing hash as hex: %w", err)
+		}
+	case base32.StdEncoding.EncodedLen(HashSize):
+		_, err = base32.StdEncoding.Decode(h[:], []byte(strings.ToUpper(s)))
+		if err != nil {
+			err = fmt.Errorf("parsing hash as base32: %w", err)
+		}
+	default:
+		err = fmt.Errorf("hash string has bad length %d: expected %d hex or %d base32 characters",
+			len(s), 2*HashSize, base32.StdEncoding.EncodedLen(HashSize))
+	}
+	return
+}
+
+// Sets h from a hex-encoded SHA-1 multihash.
+func (h *Hash) FromMultihash(s string) error {
+	b, err := decodeMultihash(s, multihashSha1, HashSize)
+	if err != nil {
+		return err
+	}
+	copy(h[:], b)
+	return nil
+}
+
+// Returns the hash as a hex-encoded SHA-1 multihash.
+func (h Hash) Multihash() string {
+	return encodeMultihash(multihashSha1, h[:])
+}
+
 func NewHashFromHex(s string) (h Hash) {
 	err := h.FromHexString(s)
 	if err != nil {
@@ -0,0 +1,109 @@
+package metainfo
+
+import (
+	"crypto/sha256"
+	"encoding"
+	"encoding/base32"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+const Hash32Size = 32
+
+// 32-byte SHA-256 hash used for v2 infohashes and merkle trees. BEP 52.
+type Hash32 [Hash32Size]byte
+
+var _ fmt.Formatter = (*Hash32)(nil)
+
+func (h Hash32) Format(f fmt.State, c rune) {
+	f.Write([]byte(h.HexString()))
+}
+
+func (h Hash32) Bytes() []byte {
+	return h[:]
+}
+
+func (h Hash32) AsString() string {
+	return string(h[:])
+}
+
+func (h Hash32) String() string {
+	return h.HexString()
+}
+
+func (h Hash32) HexString() string {
+	return fmt.Sprintf("%x", h[:])
+}
+
+// The first 20 bytes of the hash. This is how v2 infohashes are represented in the peer protocol
+// and to trackers and the DHT.
+func (h Hash32) Truncated() (ret Hash) {
+	copy(ret[:], h[:])
+	return
+}
+
+func (h *Hash32) FromHexString(s string) error {
+	if len(s) != 2*Hash32Size {
+		return fmt.Errorf("hash hex string has bad length: %d", len(s))
+	}
+	_, err := hex.Decode(h[:], []byte(s))
+	return err
+}
+
+// Parses a v2 hash as 64 hex characters, or base32 with or without padding. Both are
+// case-insensitive.
+func ParseHash32(s string) (h Hash32, err error) {
+	switch len(s) {
+	case 2 * Hash32Size:
+		err = h.FromHexString(s)
+		if err != nil {
+			err = fmt.Errorf("parsing hash as hex: %w", err)
+		}
+	case base32.StdEncoding.EncodedLen(Hash32Size), base32.StdEncoding.WithPadding(base32.NoPadding).EncodedLen(Hash32Size):
+		enc := base32.StdEncoding
+		if !strings.HasSuffix(s, "=") {
+			enc = enc.WithPadding(base32.NoPadding)
+		}
+		_, err = enc.Decode(h[:], []byte(strings.ToUpper(s)))
+		if err != nil {
+			err = fmt.Errorf("parsing hash as base32: %w", err)
+		}
+	default:
+		err = fmt.Errorf("hash string has bad length %d: expected %d hex or %d base32 characters",
+			len(s), 2*Hash32Size, base32.StdEncoding.WithPadding(base32.NoPadding).EncodedLen(Hash32Size))
+	}
+	return
+}
+
+// Sets h from a hex-encoded SHA-256 multihash, as in the btmh form of magnet links.
+func (h *Hash32) FromMultihash(s string) error {
+	b, err := decodeMultihash(s, multihashSha256, Hash32Size)
+	if err != nil {
+		return err
+	}
+	copy(h[:], b)
+	return nil
+}
+
+// Returns the hash as a hex-encoded SHA-256 multihash.
+func (h Hash32) Multihash() string {
+	return encodeMultihash(multihashSha256, h[:])
+}
+
+var (
+	_ encoding.TextUnmarshaler = (*Hash32)(nil)
+	_ encoding.TextMarshaler   = Hash32{}
+)
+
+func (h *Hash32) UnmarshalText(b []byte) error {
+	return h.FromHexString(string(b))
+}
+
+func (h Hash32) MarshalText() (text []byte, err error) {
+	return []byte(h.HexString()), nil
+}
+
+func HashBytesV2(b []byte) Hash32 {
+	return sha256.Sum256(b)
+}
@@ -0,0 +1,67 @@
+package metainfo
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestParseHash(t *testing.T) {
+	c := qt.New(t)
+	expected := NewHashFromHex("cb488af59a2f1a241ee8e7c72e09a6fd9491d5b5")
+	for _, s := range []string{
+		"cb488af59a2f1a241ee8e7c72e09a6fd9491d5b5",
+		"CB488AF59A2F1A241EE8E7C72E09A6FD9491D5B5",
+		"ZNEIV5M2F4NCIHXI47DS4CNG7WKJDVNV",
+		"zneiv5m2f4ncihxi47ds4cng7wkjdvnv",
+	} {
+		h, err := ParseHash(s)
+		c.Assert(err, qt.IsNil, qt.Commentf(s))
+		c.Check(h, qt.Equals, expected)
+	}
+	for _, tc := range []struct {
+		s, err string
+	}{
+		{"cb488af59a2f1a241ee8e7c72e09a6fd9491d5bz", "parsing hash as hex: .*"},
+		{"ZNEIV5M2F4NCIHXI47DS4CNG7WKJDVN1", "parsing hash as base32: .*"},
+		{"cb48", "hash string has bad length 4: expected 40 hex or 32 base32 characters"},
+	} {
+		_, err := ParseHash(tc.s)
+		c.Check(err, qt.ErrorMatches, tc.err)
+	}
+}
+
+func TestParseHash32(t *testing.T) {
+	c := qt.New(t)
+	expected := HashBytesV2([]byte("x"))
+	hexStr := expected.HexString()
+	padded := base32.StdEncoding.EncodeToString(expected[:])
+	for _, s := range []string{hexStr, strings.ToUpper(hexStr), padded, strings.ToLower(strings.TrimRight(padded, "="))} {
+		h, err := ParseHash32(s)
+		c.Assert(err, qt.IsNil)
+		c.Check(h, qt.Equals, expected)
+	}
+	var text Hash32
+	c.Assert(text.UnmarshalText([]byte(hexStr)), qt.IsNil)
+	c.Check(text, qt.Equals, expected)
+	_, err := ParseHash32(hexStr[:40])
+	c.Check(err, qt.ErrorMatches, "hash string has bad length 40: expected 64 hex or 52 base32 characters")
+}
+
+func TestHashMultihash(t *testing.T) {
+	c := qt.New(t)
+	v1 := NewHashFromHex("cb488af59a2f1a241ee8e7c72e09a6fd9491d5b5")
+	c.Check(v1.Multihash(), qt.Equals, "1114cb488af59a2f1a241ee8e7c72e09a6fd9491d5b5")
+	var h Hash
+	c.Assert(h.FromMultihash(v1.Multihash()), qt.IsNil)
+	c.Check(h, qt.Equals, v1)
+	v2 := HashBytesV2([]byte("x"))
+	var h32 Hash32
+	c.Assert(h32.FromMultihash(v2.Multihash()), qt.IsNil)
+	c.Check(h32, qt.Equals, v2)
+	// Each type only accepts its own hash function.
+	c.Check(h.FromMultihash(v2.Multihash()), qt.ErrorMatches, "unsupported multihash function code 0x12")
+	c.Check(h32.FromMultihash(v1.Multihash()), qt.ErrorMatches, "unsupported multihash function code 0x11")
+}
@@ -1,126 +1,619 @@
 package metainfo
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/anacrolix/missinggo/slices"
+
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/segments"
 )
 
 // The info dictionary.
 type Info struct {
 	PieceLength int64  `bencode:"piece length"`      // BEP3
-	Pieces      []byte `bencode:"pieces"`            // BEP3
+	Pieces      []byte `bencode:"pieces"`            // BEP3, omitted in v2-only and merkle infos
 	Name        string `bencode:"name"`              // BEP3
 	Length      int64  `bencode:"length,omitempty"`  // BEP3, mutually exclusive with Files
 	Private     *bool  `bencode:"private,omitempty"` // BEP27
 	// TODO: Document this field.
 	Source string     `bencode:"source,omitempty"`
 	Files  []FileInfo `bencode:"files,omitempty"` // BEP3, mutually exclusive with Length
+
+	MetaVersion int64    `bencode:"meta version,omitempty"` // BEP52
+	FileTree    FileTree `bencode:"file tree,omitempty"`    // BEP52
+
+	// The name in UTF-8, from older torrents that put another encoding in Name. Not standardized.
+	NameUTF8 string `bencode:"name.utf-8,omitempty"`
+
+	// Infohashes of torrents that may share files with this one. BEP 38.
+	Similar []Hash `bencode:"similar,omitempty"`
+	// Names of collections whose torrents may share files with this one. BEP 38.
+	Collections []string `bencode:"collections,omitempty"`
+
+	// The merkle root of the piece hashes, in place of Pieces. BEP 30, which isn't supported.
+	RootHash []byte `bencode:"root hash,omitempty"`
+}
+
+// Encodes pieces even if it's empty, as BEP 3 has it, except in the v2-only and merkle infos that
+// have no pieces key at all.
+func (info Info) MarshalBencode() ([]byte, error) {
+	type plain Info
+	b, err := bencode.Marshal(plain(info))
+	if err != nil || len(info.Pieces) != 0 || info.HasV1() && !info.IsMerkle() {
+		return b, err
+	}
+	var d map[string]bencode.Bytes
+	if err := bencode.Unmarshal(b, &d); err != nil {
+		return nil, err
+	}
+	delete(d, "pieces")
+	return bencode.Marshal(d)
 }
 
 // This is a helper that sets Files and Pieces from a root path and its
-// children.
+// children. Files are in FileOrderJoinedPath, as they always have been.
 func (info *Info) BuildFromFilePath(root string) (err error) {
-	info.Name = filepath.Base(root)
-	info.Files = nil
-	err = filepath.Walk(root, func(path string, fi os.FileInfo, err error) error {
-		if err != nil {
-			return err
+	_, err = info.BuildFromFilePathOpts(context.Background(), root, BuildFromFilePathOpts{
+		FileOrder: FileOrderJoinedPath,
+	})
+	return
+}
+
+// Selects the kind of info produced by the builder.
+type InfoVersion int
+
+const (
+	// Only the v1 fields (BEP 3).
+	InfoVersionV1 InfoVersion = iota
+	// Both the v1 and v2 (BEP 52) fields. Files are padded to piece boundaries (BEP 47) so both
+	// sets of piece hashes cover the same data.
+	InfoVersionHybrid
+	// Only the v2 fields. This package can't download such torrents, but other clients can.
+	InfoVersionV2
+)
+
+func (me InfoVersion) String() string {
+	switch me {
+	case InfoVersionV1:
+		return "v1"
+	case InfoVersionHybrid:
+		return "hybrid"
+	case InfoVersionV2:
+		return "v2"
+	default:
+		return fmt.Sprintf("InfoVersion(%d)", int(me))
+	}
+}
+
+// Whether the version has v2 fields.
+func (me InfoVersion) hasV2() bool {
+	return me == InfoVersionHybrid || me == InfoVersionV2
+}
+
+// Selects the order of files in infos produced by the builder. The order affects the infohash, so
+// it's fixed rather than left to the filesystem.
+type FileOrder int
+
+const (
+	// Sorted lexicographically by path component. This is the libtorrent convention, and the order
+	// of a v2 file tree.
+	FileOrderPath FileOrder = iota
+	// Sorted by the paths joined with "/". This differs from FileOrderPath only for names
+	// containing bytes that sort before '/', like "a.b" and "a/b".
+	FileOrderJoinedPath
+	// The order the files were given in, for BuildFromFileMappings.
+	fileOrderGiven
+)
+
+type BuildFromFilePathOpts struct {
+	Version InfoVersion
+	// FileOrderPath by default. Hybrid infos must use it, so the v1 files match the file tree.
+	FileOrder FileOrder
+	// If not nil, called after each piece is hashed with the number of bytes hashed so far, and the
+	// total that will be hashed. Hybrid infos hash the file data once for each version.
+	Progress func(bytesHashed, totalBytes int64)
+	// The number of v1 pieces to hash concurrently. Values less than 2 hash sequentially.
+	PieceHashers int
+	// The most files to have open at once while hashing. Files are opened for each read and closed
+	// after, so directories of many small files don't run out of descriptors. Defaults to
+	// DefaultMaxOpenFiles.
+	MaxOpenFiles int
+	// Insert BEP 47 padding files so that every file starts on a piece boundary. Hybrid infos are
+	// always padded, and v2-only infos never are.
+	PadFiles bool
+	// If not nil, files and directories below the root for which this returns false are left out.
+	// path is relative to the root. Symlinks that are followed are passed the FileInfo of their
+	// target. See GlobFilter.
+	Filter func(path string, fi os.FileInfo) bool
+	// What to do with symlinks below the root. The root itself is always followed.
+	Symlinks SymlinkPolicy
+	// Record the modification time of each file in FileInfo.Mtime. Single-file infos have no file
+	// entry to record it in. See Info.ApplyMtimes.
+	RecordMtimes bool
+	// Set the BEP 27 private flag, so that clients only get peers from the trackers. See
+	// MetaInfo.CheckPrivate.
+	Private bool
+	// Torrents can't describe directories, so empty ones are lost. With this, each empty directory
+	// below the root, or the root itself, gets a zero-length file named EmptyDirPlaceholder, so
+	// it's created where the torrent is downloaded. Zero-length files are always included.
+	EmptyDirs bool
+}
+
+// The name of the zero-length file that stands for an empty directory. See
+// BuildFromFilePathOpts.EmptyDirs.
+const EmptyDirPlaceholder = ".keep"
+
+// Like BuildFromFilePath, with options. For infos with v2 fields, the returned piece layers belong
+// in MetaInfo.PieceLayers. If ctx is done before the info is complete, ctx.Err() is returned. If
+// info.PieceLength is zero, it's set with ChoosePieceLength.
+func (info *Info) BuildFromFilePathOpts(ctx context.Context, root string, opts BuildFromFilePathOpts) (pieceLayers map[string]string, err error) {
+	w := buildWalker{
+		ctx:  ctx,
+		opts: opts,
+		root: root,
+	}
+	return info.build(ctx, filepath.Base(root), opts, w.walkRoot, func(fi FileInfo) (io.ReadCloser, error) {
+		return os.Open(filepath.Join(root, strings.Join(fi.Path, string(filepath.Separator))))
+	})
+}
+
+// Returns the problems with the options, for building with the given piece length.
+func (opts *BuildFromFilePathOpts) check(pieceLength int64) (errs []error) {
+	switch opts.Version {
+	case InfoVersionV1:
+	case InfoVersionHybrid, InfoVersionV2:
+		// A chosen piece length is always valid.
+		if pieceLength != 0 {
+			if err := checkV2PieceLength(pieceLength); err != nil {
+				errs = append(errs, err)
+			}
 		}
-		if fi.IsDir() {
-			// Directories are implicit in torrent files.
-			return nil
-		} else if path == root {
-			// The root is a file.
-			info.Length = fi.Size()
-			return nil
+	default:
+		errs = append(errs, fmt.Errorf("unknown info version %d", int(opts.Version)))
+	}
+	if opts.Symlinks == SymlinkRecord && opts.Version.hasV2() {
+		errs = append(errs, fmt.Errorf("%v infos can't record symlinks", opts.Version))
+	}
+	switch opts.FileOrder {
+	case FileOrderPath:
+	case FileOrderJoinedPath:
+		if opts.Version.hasV2() {
+			errs = append(errs, fmt.Errorf("%v infos must use FileOrderPath", opts.Version))
 		}
-		relPath, err := filepath.Rel(root, path)
-		if err != nil {
-			return fmt.Errorf("error getting relative path: %s", err)
+	case fileOrderGiven:
+		// The caller checks the given order suits the version.
+	default:
+		errs = append(errs, fmt.Errorf("unknown file order %v", opts.FileOrder))
+	}
+	return
+}
+
+// The part of building common to all sources of files. walk returns the length of the root if it's
+// a file, or the files below it, and whether the filter left anything out.
+func (info *Info) build(
+	ctx context.Context,
+	name string,
+	opts BuildFromFilePathOpts,
+	walk func() (length int64, files []FileInfo, excluded bool, err error),
+	open func(fi FileInfo) (io.ReadCloser, error),
+) (pieceLayers map[string]string, err error) {
+	defer func() {
+		if ctx.Err() != nil {
+			err = ctx.Err()
 		}
-		info.Files = append(info.Files, FileInfo{
-			Path:   strings.Split(relPath, string(filepath.Separator)),
-			Length: fi.Size(),
-		})
-		return nil
-	})
+	}()
+	if errs := opts.check(info.PieceLength); errs != nil {
+		err = errors.Join(errs...)
+		return
+	}
+	info.Name = name
+	info.Files = nil
+	info.MetaVersion = 0
+	info.FileTree = FileTree{}
+	if opts.Private {
+		private := true
+		info.Private = &private
+	}
+	length, files, excluded, err := walk()
 	if err != nil {
 		return
 	}
-	slices.Sort(info.Files, func(l, r FileInfo) bool {
-		return strings.Join(l.Path, "/") < strings.Join(r.Path, "/")
-	})
-	err = info.GeneratePieces(func(fi FileInfo) (io.ReadCloser, error) {
-		return os.Open(filepath.Join(root, strings.Join(fi.Path, string(filepath.Separator))))
-	})
+	if excluded && files == nil {
+		err = errors.New("every file was excluded by the filter")
+		return
+	}
+	info.Length = length
+	info.Files = files
+	if info.PieceLength == 0 {
+		info.PieceLength = ChoosePieceLength(info.TotalLength())
+	}
+	if opts.FileOrder != fileOrderGiven {
+		slices.Sort(info.Files, func(l, r FileInfo) bool {
+			if opts.FileOrder == FileOrderJoinedPath {
+				return strings.Join(l.Path, "/") < strings.Join(r.Path, "/")
+			}
+			return pathLess(l.Path, r.Path)
+		})
+	}
+	progress := hashProgress{
+		ctx: ctx,
+		f:   opts.Progress,
+	}
+	if opts.Version == InfoVersionHybrid {
+		progress.total = info.TotalLength()
+	}
+	// v2-only infos have no v1 files to pad.
+	if opts.PadFiles && opts.Version == InfoVersionV1 || opts.Version == InfoVersionHybrid {
+		if info.PieceLength <= 0 {
+			err = errors.New("piece length must be positive to pad files")
+			return
+		}
+		info.insertPadFiles()
+	}
+	progress.total += info.TotalLength()
+	if opts.Version.hasV2() {
+		pieceLayers, err = info.generateV2(open, &progress)
+		if err != nil {
+			err = fmt.Errorf("error generating v2 fields: %w", err)
+			return
+		}
+	}
+	if opts.Version == InfoVersionV2 {
+		// The file tree has everything.
+		info.Length = 0
+		info.Files = nil
+		info.Pieces = nil
+		return
+	}
+	err = info.generatePieces(open, &progress, opts.PieceHashers, opts.MaxOpenFiles)
 	if err != nil {
-		err = fmt.Errorf("error generating pieces: %s", err)
+		err = fmt.Errorf("error generating pieces: %w", err)
 	}
 	return
 }
 
+// The default for BuildFromFilePathOpts.MaxOpenFiles.
+const DefaultMaxOpenFiles = 64
+
+// Compares paths component by component.
+func pathLess(l, r []string) bool {
+	for i := 0; i < len(l) && i < len(r); i++ {
+		if l[i] != r[i] {
+			return l[i] < r[i]
+		}
+	}
+	return len(l) < len(r)
+}
+
+func (info *Info) openFile(fi FileInfo, open func(fi FileInfo) (io.ReadCloser, error)) (io.ReadCloser, error) {
+	if fi.Length == 0 || fi.hasPaddingAttr() || fi.IsSymlink() {
+		// There's nothing to read. Symlinks have no data, and their targets may not exist. Nor may
+		// zero-length files, which could be EmptyDirPlaceholders.
+		return zeroFile{}, nil
+	}
+	return open(fi)
+}
+
+// Reads zeroes, for the content of padding files.
+type zeroFile struct{}
+
+func (zeroFile) Read(b []byte) (int, error) {
+	for i := range b {
+		b[i] = 0
+	}
+	return len(b), nil
+}
+
+func (me zeroFile) ReadAt(b []byte, off int64) (int, error) {
+	return me.Read(b)
+}
+
+func (zeroFile) Close() error {
+	return nil
+}
+
+// Tracks the data hashed while generating an info, and whether to keep going.
+type hashProgress struct {
+	ctx    context.Context
+	f      func(bytesHashed, totalBytes int64)
+	hashed int64
+	total  int64
+}
+
+// Records that n more bytes were hashed. Returns an error if hashing should stop.
+func (me *hashProgress) add(n int64) error {
+	me.hashed += n
+	if me.f != nil {
+		me.f(me.hashed, me.total)
+	}
+	return me.ctx.Err()
+}
+
+// Inserts BEP 47 padding files so that every file after the first starts on a piece boundary.
+func (info *Info) insertPadFiles() {
+	var files []FileInfo
+	for i, fi := range info.Files {
+		files = append(files, fi)
+		if i == len(info.Files)-1 {
+			break
+		}
+		if rem := fi.Length % info.PieceLength; rem != 0 {
+			padLength := info.PieceLength - rem
+			files = append(files, FileInfo{
+				Length: padLength,
+				Path:   []string{".pad", strconv.FormatInt(padLength, 10)},
+				Attr:   "p",
+			})
+		}
+	}
+	info.Files = files
+}
+
 // Concatenates all the files in the torrent into w. open is a function that
-// gets at the contents of the given file.
+// gets at the contents of the given file. It isn't called for padding files,
+// which are all zeroes. Only one file is open at a time.
 func (info *Info) writeFiles(w io.Writer, open func(fi FileInfo) (io.ReadCloser, error)) error {
+	buf := make([]byte, 32<<10)
 	for _, fi := range info.UpvertedFiles() {
-		r, err := open(fi)
+		r, err := info.openFile(fi, open)
 		if err != nil {
 			return fmt.Errorf("error opening %v: %s", fi, err)
 		}
-		wn, err := io.CopyN(w, r, fi.Length)
+		// The LimitReader hides any WriterTo, so the buffer is used.
+		wn, err := io.CopyBuffer(w, io.LimitReader(r, fi.Length), buf)
 		r.Close()
 		if wn != fi.Length {
+			if err == nil {
+				err = io.ErrUnexpectedEOF
+			}
 			return fmt.Errorf("error copying %v: %s", fi, err)
 		}
 	}
 	return nil
 }
 
+// The concatenated files of an info, as an io.ReaderAt. Files are opened for each read and closed
+// again, with no more than cap(sem) open at once.
+type filesReaderAt struct {
+	info  *Info
+	files []FileInfo
+	open  func(fi FileInfo) (io.ReadCloser, error)
+	index segments.Index
+	sem   chan struct{}
+}
+
+// ok is false if the files don't implement io.ReaderAt, going by the first file with data. Later
+// files that don't are still read, by skipping to the offset.
+func (info *Info) newFilesReaderAt(open func(fi FileInfo) (io.ReadCloser, error), maxOpenFiles int) (
+	ret *filesReaderAt, ok bool, err error,
+) {
+	if maxOpenFiles <= 0 {
+		maxOpenFiles = DefaultMaxOpenFiles
+	}
+	files := info.UpvertedFiles()
+	ret = &filesReaderAt{
+		info:  info,
+		files: files,
+		open:  open,
+		sem:   make(chan struct{}, maxOpenFiles),
+	}
+	ok = true
+	for _, fi := range files {
+		if fi.Length == 0 || fi.hasPaddingAttr() || fi.IsSymlink() {
+			continue
+		}
+		var f io.ReadCloser
+		f, err = open(fi)
+		if err != nil {
+			err = fmt.Errorf("error opening %v: %s", fi, err)
+			return
+		}
+		_, ok = f.(io.ReaderAt)
+		f.Close()
+		break
+	}
+	ret.index = segments.NewIndex(func() (segments.Length, bool) {
+		if len(files) == 0 {
+			return -1, false
+		}
+		l := files[0].Length
+		files = files[1:]
+		return l, true
+	})
+	return
+}
+
+// Returns io.EOF only at the end of the last file. Files that are shorter than their info length
+// return io.EOF prematurely.
+func (me *filesReaderAt) ReadAt(b []byte, off int64) (n int, err error) {
+	me.index.Locate(segments.Extent{Start: off, Length: int64(len(b))}, func(i int, e segments.Extent) bool {
+		var n1 int
+		n1, err = me.readFileAt(me.files[i], b[:e.Length], e.Start)
+		n += n1
+		b = b[n1:]
+		if err == io.EOF && int64(n1) == e.Length {
+			err = nil
+		}
+		return err == nil
+	})
+	if err == nil && len(b) != 0 {
+		err = io.EOF
+	}
+	return
+}
+
+func (me *filesReaderAt) readFileAt(fi FileInfo, b []byte, off int64) (n int, err error) {
+	me.sem <- struct{}{}
+	defer func() { <-me.sem }()
+	f, err := me.info.openFile(fi, me.open)
+	if err != nil {
+		err = fmt.Errorf("error opening %v: %s", fi, err)
+		return
+	}
+	defer f.Close()
+	if ra, ok := f.(io.ReaderAt); ok {
+		return ra.ReadAt(b, off)
+	}
+	_, err = io.CopyN(io.Discard, f, off)
+	if err != nil {
+		return
+	}
+	n, err = io.ReadFull(f, b)
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	return
+}
+
 // Sets Pieces (the block of piece hashes in the Info) by using the passed
-// function to get at the torrent data.
-func (info *Info) GeneratePieces(open func(fi FileInfo) (io.ReadCloser, error)) (err error) {
+// function to get at the torrent data. Padding files are hashed as zeroes
+// without calling open.
+func (info *Info) GeneratePieces(open func(fi FileInfo) (io.ReadCloser, error)) error {
+	return info.GeneratePiecesContext(context.Background(), open, nil)
+}
+
+// Like GeneratePieces, but stops and returns ctx.Err() if ctx is done first. If progress is not
+// nil, it's called after each piece is hashed with the number of bytes hashed so far, and the total
+// length of the info.
+func (info *Info) GeneratePiecesContext(
+	ctx context.Context,
+	open func(fi FileInfo) (io.ReadCloser, error),
+	progress func(bytesHashed, totalBytes int64),
+) error {
+	err := info.generatePieces(open, &hashProgress{
+		ctx:   ctx,
+		f:     progress,
+		total: info.TotalLength(),
+	}, 1, 0)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+// If workers is greater than 1 and the opened files implement io.ReaderAt, pieces are hashed
+// concurrently, with at most maxOpenFiles files open at once.
+func (info *Info) generatePieces(
+	open func(fi FileInfo) (io.ReadCloser, error), progress *hashProgress, workers, maxOpenFiles int,
+) (
+	err error,
+) {
 	if info.PieceLength == 0 {
 		return errors.New("piece length must be non-zero")
 	}
+	if workers > 1 {
+		var (
+			ra *filesReaderAt
+			ok bool
+		)
+		ra, ok, err = info.newFilesReaderAt(open, maxOpenFiles)
+		if err != nil {
+			return
+		}
+		if ok {
+			info.Pieces, err = generatePiecesParallel(ra, info.TotalLength(), info.PieceLength, workers, nil, progress.add)
+			return
+		}
+	}
 	pr, pw := io.Pipe()
+	writerDone := make(chan struct{})
 	go func() {
+		defer close(writerDone)
 		err := info.writeFiles(pw, open)
 		pw.CloseWithError(err)
 	}()
-	defer pr.Close()
-	info.Pieces, err = GeneratePieces(pr, info.PieceLength, nil)
+	defer func() {
+		// Unblock the writer if we stopped early, and don't leave it running.
+		pr.Close()
+		<-writerDone
+	}()
+	info.Pieces, err = generatePieces(pr, info.PieceLength, nil, progress.add)
 	return
 }
 
+// The total length of the files, including BEP 47 padding, which is the length the v1 pieces cover.
 func (info *Info) TotalLength() (ret int64) {
-	if info.IsDir() {
-		for _, fi := range info.Files {
-			ret += fi.Length
-		}
-	} else {
-		ret = info.Length
+	for _, fi := range info.UpvertedFiles() {
+		ret += fi.Length
 	}
 	return
 }
 
+// The total length of the real files, excluding BEP 47 padding.
+func (info *Info) TotalLengthSkippingPadding() (ret int64) {
+	for _, fi := range info.UpvertedFilesSkippingPadding() {
+		ret += fi.Length
+	}
+	return
+}
+
+// The number of pieces. For infos with v1 fields, that's the number of hashes in the pieces field.
+// v2-only infos have no such field, and each file takes up whole pieces of its own. See
+// ValidatePieces for checking that the pieces field agrees with the files.
 func (info *Info) NumPieces() int {
-	return len(info.Pieces) / 20
+	if !info.HasV1() {
+		return info.numV2Pieces()
+	}
+	return len(info.Pieces) / HashSize
 }
 
 func (info *Info) IsDir() bool {
+	if !info.HasV1() {
+		return !info.isV2SingleFile()
+	}
 	return len(info.Files) != 0
 }
 
+// Whether the info contains v1 fields. See the upgrade path in BEP 52: hybrid torrents contain
+// both.
+func (info *Info) HasV1() bool {
+	return info.MetaVersion < 2 || info.Files != nil || info.Length != 0 || len(info.Pieces) != 0
+}
+
+// Whether the info is a BEP 30 merkle torrent, with a root hash instead of the piece hashes. Their
+// metadata can be used, but there are no pieces to check data against, so they can't be
+// downloaded.
+func (info *Info) IsMerkle() bool {
+	return len(info.RootHash) != 0
+}
+
+// Whether the info has the BEP 27 private flag set.
+func (info *Info) IsPrivate() bool {
+	return info.Private != nil && *info.Private
+}
+
+// Whether the info declares BEP 52 (v2) support, and so should contain a file tree.
+func (info *Info) HasV2() bool {
+	return info.MetaVersion >= 2
+}
+
+// A v2 single-file torrent has a file tree with only the file named by the info name at its
+// root.
+func (info *Info) isV2SingleFile() bool {
+	if len(info.FileTree.Dir) != 1 {
+		return false
+	}
+	root, ok := info.FileTree.Dir[info.Name]
+	return ok && !root.IsDir()
+}
+
 // The files field, converted up from the old single-file in the parent info
 // dict if necessary. This is a helper to avoid having to conditionally handle
-// single and multi-file torrent infos.
+// single and multi-file torrent infos. v2-only infos have their files derived
+// from the file tree, in the same form.
 func (info *Info) UpvertedFiles() []FileInfo {
+	if !info.HasV1() {
+		return info.upvertedV2Files()
+	}
 	if len(info.Files) == 0 {
 		return []FileInfo{{
 			Length: info.Length,
@@ -132,6 +625,34 @@ func (info *Info) UpvertedFiles() []FileInfo {
 	return info.Files
 }
 
+// Like UpvertedFiles, but without BEP 47 padding files, for presenting the files a user would
+// expect to see.
+func (info *Info) UpvertedFilesSkippingPadding() (ret []FileInfo) {
+	for _, fi := range info.UpvertedFiles() {
+		if !fi.IsPadding() {
+			ret = append(ret, fi)
+		}
+	}
+	return
+}
+
+func (info *Info) upvertedV2Files() []FileInfo {
+	if info.isV2SingleFile() {
+		return []FileInfo{{
+			Length: info.FileTree.Dir[info.Name].File.Length,
+		}}
+	}
+	return info.FileTree.upvertedFiles()
+}
+
+// The name to display, which is NameUTF8 if it's set and valid, and otherwise Name.
+func (info *Info) BestName() string {
+	if info.NameUTF8 != "" && utf8.ValidString(info.NameUTF8) {
+		return info.NameUTF8
+	}
+	return info.Name
+}
+
 func (info *Info) Piece(index int) Piece {
 	return Piece{info, pieceIndex(index)}
 }
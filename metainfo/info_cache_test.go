@@ -0,0 +1,128 @@
+package metainfo
+
+import (
+	"bytes"
+	"strconv"
+	"sync"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/anacrolix/torrent/bencode"
+)
+
+func TestInfoCached(t *testing.T) {
+	c := qt.New(t)
+	mi, err := LoadFromFile("testdata/continuum.torrent")
+	c.Assert(err, qt.IsNil)
+	info, err := mi.Info()
+	c.Assert(err, qt.IsNil)
+	again, err := mi.Info()
+	c.Assert(err, qt.IsNil)
+	c.Check(again, qt.Equals, info)
+	fresh, err := mi.UnmarshalInfo()
+	c.Assert(err, qt.IsNil)
+	c.Check(&fresh, qt.Not(qt.Equals), info)
+	c.Check(fresh.Name, qt.Equals, info.Name)
+	// Copies share the cache.
+	copied := *mi
+	copiedInfo, err := copied.Info()
+	c.Assert(err, qt.IsNil)
+	c.Check(copiedInfo, qt.Equals, info)
+}
+
+func TestInfoCacheInvalidated(t *testing.T) {
+	c := qt.New(t)
+	mi, err := LoadFromFile("testdata/continuum.torrent")
+	c.Assert(err, qt.IsNil)
+	info, err := mi.Info()
+	c.Assert(err, qt.IsNil)
+	c.Assert(mi.SetPrivate(true), qt.IsNil)
+	private, err := mi.Info()
+	c.Assert(err, qt.IsNil)
+	c.Check(private, qt.Not(qt.Equals), info)
+	c.Check(private.IsPrivate(), qt.IsTrue)
+	// Assigning the field directly doesn't use the stale Info.
+	mi.InfoBytes = bencode.MustMarshal(Info{Name: "direct", PieceLength: 1})
+	direct, err := mi.Info()
+	c.Assert(err, qt.IsNil)
+	c.Check(direct.Name, qt.Equals, "direct")
+	// Changing them in place needs SetInfoBytes.
+	mi.SetInfoBytes(bencode.MustMarshal(Info{Name: "before", PieceLength: 1}))
+	_, err = mi.Info()
+	c.Assert(err, qt.IsNil)
+	copy(mi.InfoBytes[bytes.Index(mi.InfoBytes, []byte("before")):], "after!")
+	stale, err := mi.Info()
+	c.Assert(err, qt.IsNil)
+	c.Check(stale.Name, qt.Equals, "before")
+	mi.SetInfoBytes(mi.InfoBytes)
+	edited, err := mi.Info()
+	c.Assert(err, qt.IsNil)
+	c.Check(edited.Name, qt.Equals, "after!")
+	// A shorter slice of the same bytes is different info bytes.
+	mi.SetInfoBytes(bencode.MustMarshal(Info{Name: "whole", PieceLength: 1}))
+	_, err = mi.Info()
+	c.Assert(err, qt.IsNil)
+	mi.InfoBytes = mi.InfoBytes[:len(mi.InfoBytes)-1]
+	_, err = mi.Info()
+	c.Check(err, qt.Not(qt.IsNil))
+	mi.SetInfoBytes([]byte("x"))
+	_, err = mi.Info()
+	c.Check(err, qt.Not(qt.IsNil))
+	_, err = mi.Info()
+	c.Check(err, qt.Not(qt.IsNil))
+}
+
+func TestInfoConcurrent(t *testing.T) {
+	c := qt.New(t)
+	mi, err := LoadFromFile("testdata/continuum.torrent")
+	c.Assert(err, qt.IsNil)
+	var wg sync.WaitGroup
+	infos := make([]*Info, 8)
+	for i := range infos {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			infos[i], _ = mi.Info()
+			mi.Magnet(nil, nil)
+			mi.Validate()
+		}(i)
+	}
+	wg.Wait()
+	for _, info := range infos {
+		c.Check(info, qt.Equals, infos[0])
+	}
+}
+
+func manyFilesMetaInfo(b *testing.B) *MetaInfo {
+	info := Info{Name: "many", PieceLength: 1 << 20}
+	var total int64
+	for i := 0; i < 100000; i++ {
+		info.Files = append(info.Files, FileInfo{Path: []string{"dir", strconv.Itoa(i)}, Length: 1000})
+		total += 1000
+	}
+	info.Pieces = make([]byte, (total+info.PieceLength-1)/info.PieceLength*HashSize)
+	var mi MetaInfo
+	mi.SetInfoBytes(bencode.MustMarshal(info))
+	return &mi
+}
+
+func BenchmarkUnmarshalInfoManyFiles(b *testing.B) {
+	mi := manyFilesMetaInfo(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := mi.UnmarshalInfo(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkInfoManyFiles(b *testing.B) {
+	mi := manyFilesMetaInfo(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := mi.Info(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
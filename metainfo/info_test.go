@@ -1,8 +1,12 @@
 package metainfo
 
 import (
+	"context"
+	"errors"
+	"strings"
 	"testing"
 
+	qt "github.com/frankban/quicktest"
 	"github.com/stretchr/testify/assert"
 
 	"github.com/anacrolix/torrent/bencode"
@@ -14,3 +18,93 @@ func TestMarshalInfo(t *testing.T) {
 	assert.NoError(t, err)
 	assert.EqualValues(t, "d4:name0:12:piece lengthi0e6:pieces0:e", string(b))
 }
+
+// v2-only and merkle infos have no pieces key.
+func TestMarshalInfoWithoutPieces(t *testing.T) {
+	c := qt.New(t)
+	b, err := bencode.Marshal(Info{MetaVersion: 2, Name: "a"})
+	c.Assert(err, qt.IsNil)
+	c.Check(string(b), qt.Equals, "d12:meta versioni2e4:name1:a12:piece lengthi0ee")
+	b, err = bencode.Marshal(&Info{Name: "a", RootHash: []byte("r")})
+	c.Assert(err, qt.IsNil)
+	c.Check(string(b), qt.Equals, "d4:name1:a12:piece lengthi0e9:root hash1:re")
+}
+
+func TestInfoSimilarAndCollections(t *testing.T) {
+	c := qt.New(t)
+	info := Info{
+		PieceLength: 1,
+		Pieces:      []byte{},
+		Name:        "a",
+		Similar:     []Hash{{1}, {2}},
+		Collections: []string{"x", "y"},
+	}
+	b, err := bencode.Marshal(info)
+	c.Assert(err, qt.IsNil)
+	c.Check(string(b), qt.Equals, "d11:collectionsl1:x1:ye4:name1:a12:piece lengthi1e6:pieces0:"+
+		"7:similarl20:\x01"+strings.Repeat("\x00", 19)+"20:\x02"+strings.Repeat("\x00", 19)+"ee")
+	var decoded Info
+	c.Assert(bencode.Unmarshal(b, &decoded), qt.IsNil)
+	c.Check(decoded, qt.DeepEquals, info)
+	err = bencode.Unmarshal([]byte("d7:similarl3:abcee"), &decoded)
+	c.Check(err, qt.ErrorMatches, ".*hash string has bad length: 3")
+	mi := MetaInfo{InfoBytes: []byte("d4:name1:a12:piece lengthi1e7:similarl3:abcee")}
+	var decodeErr InfoDecodeError
+	c.Check(errors.As(mi.Validate(), &decodeErr), qt.IsTrue)
+}
+
+func TestLenientSimilar(t *testing.T) {
+	c := qt.New(t)
+	h := strings.Repeat("h", 20)
+	// The malformed node makes the info dict go through repair too.
+	mi, repairs, err := LoadLenient([]byte("d4:infod4:name1:a12:piece lengthi1e6:pieces20:" + h +
+		"7:similarl3:abc20:" + h + "ee5:nodesli42eee"))
+	c.Assert(err, qt.IsNil)
+	c.Check(repairs, qt.DeepEquals, Repairs{
+		{"info.similar[0]", "skipped malformed entry"},
+		{"nodes[0]", "skipped malformed entry"},
+	})
+	info, err := mi.UnmarshalInfo()
+	c.Assert(err, qt.IsNil)
+	var expected Hash
+	copy(expected[:], h)
+	c.Check(info.Similar, qt.DeepEquals, []Hash{expected})
+}
+
+func TestMerkleInfo(t *testing.T) {
+	c := qt.New(t)
+	mi, err := LoadFromFile("testdata/merkle.torrent")
+	c.Assert(err, qt.IsNil)
+	c.Check(mi.HashInfoBytes().HexString(), qt.Equals, "f054b0bb7c26232450ae95e221c4400ace95ad3e")
+	info, err := mi.UnmarshalInfo()
+	c.Assert(err, qt.IsNil)
+	c.Check(info.IsMerkle(), qt.IsTrue)
+	c.Check(info.RootHash, qt.HasLen, 20)
+	c.Check(info.TotalLength(), qt.Equals, int64(100000))
+	c.Check(mi.Validate(), qt.IsNil)
+	// Re-encoding doesn't lose the root hash, so the infohash is kept.
+	b, err := bencode.Marshal(info)
+	c.Assert(err, qt.IsNil)
+	c.Check(string(b), qt.Equals, string(mi.InfoBytes))
+	var regular Info
+	c.Check(regular.IsMerkle(), qt.IsFalse)
+}
+
+func TestLenientMerkle(t *testing.T) {
+	c := qt.New(t)
+	strict, err := LoadFromFile("testdata/merkle.torrent")
+	c.Assert(err, qt.IsNil)
+	// The malformed node forces the lenient path, where the info needs pieces or a root hash.
+	mi, repairs, err := LoadLenient(bencode.MustMarshal(map[string]interface{}{
+		"nodes": []interface{}{42},
+		"info":  bencode.Bytes(strict.InfoBytes),
+	}))
+	c.Assert(err, qt.IsNil)
+	c.Check(repairs, qt.DeepEquals, Repairs{{"nodes[0]", "skipped malformed entry"}})
+	c.Check(mi.HashInfoBytes(), qt.Equals, strict.HashInfoBytes())
+	info, err := mi.UnmarshalInfo()
+	c.Assert(err, qt.IsNil)
+	c.Check(info.IsMerkle(), qt.IsTrue)
+	_, err = VerifyData(context.Background(), &info, c.Mkdir(), VerifyOpts{})
+	c.Check(err, qt.ErrorMatches, "merkle infos have no pieces to check against")
+}
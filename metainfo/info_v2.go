@@ -0,0 +1,142 @@
+package metainfo
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/anacrolix/torrent/merkle"
+)
+
+func checkV2PieceLength(pieceLength int64) error {
+	if pieceLength < merkle.BlockSize || pieceLength&(pieceLength-1) != 0 {
+		return fmt.Errorf("v2 piece length must be a power of two of at least %v", merkle.BlockSize)
+	}
+	return nil
+}
+
+// Sets the v2 fields of the info from the files it describes, and returns the piece layers for the
+// MetaInfo. Padding files are skipped.
+func (info *Info) generateV2(
+	open func(fi FileInfo) (io.ReadCloser, error), progress *hashProgress,
+) (
+	pieceLayers map[string]string, err error,
+) {
+	err = checkV2PieceLength(info.PieceLength)
+	if err != nil {
+		return
+	}
+	// Determine the v1 layout before the v2 fields are set.
+	files := info.UpvertedFiles()
+	isDir := info.IsDir()
+	info.MetaVersion = 2
+	info.FileTree = FileTree{Dir: make(map[string]FileTree)}
+	pieceLayers = make(map[string]string)
+	for _, fi := range files {
+		if fi.hasPaddingAttr() {
+			continue
+		}
+		var file FileTreeFile
+		file, err = info.generateV2File(fi, open, pieceLayers, progress)
+		if err != nil {
+			return
+		}
+		path := fi.Path
+		if !isDir {
+			path = []string{info.Name}
+		}
+		info.FileTree.insert(path, file)
+	}
+	return
+}
+
+func (info *Info) generateV2File(
+	fi FileInfo,
+	open func(fi FileInfo) (io.ReadCloser, error),
+	pieceLayers map[string]string,
+	progress *hashProgress,
+) (
+	file FileTreeFile, err error,
+) {
+	file.Length = fi.Length
+	if fi.Length == 0 {
+		return
+	}
+	r, err := open(fi)
+	if err != nil {
+		err = fmt.Errorf("error opening %v: %s", fi, err)
+		return
+	}
+	defer r.Close()
+	root, layer, err := generateV2PieceLayer(io.LimitReader(r, fi.Length), fi.Length, info.PieceLength, progress.add)
+	if err != nil {
+		err = fmt.Errorf("error hashing %v: %w", fi, err)
+		return
+	}
+	file.PiecesRoot = string(root[:])
+	if layer != nil {
+		pieceLayers[file.PiecesRoot] = string(layer)
+	}
+	return
+}
+
+// Returns the merkle root of length bytes of data in r, and the concatenated hashes of the piece
+// layer of the tree if the data spans more than one piece. onPiece is called with the length of
+// each piece after it's hashed, and hashing stops if it returns an error.
+func generateV2PieceLayer(
+	r io.Reader, length, pieceLength int64, onPiece func(length int64) error,
+) (
+	root merkle.Hash, layer []byte, err error,
+) {
+	blocksPerPiece := int(pieceLength / merkle.BlockSize)
+	var (
+		blockHashes []merkle.Hash
+		pieceHashes []merkle.Hash
+		buf         = make([]byte, merkle.BlockSize)
+	)
+	var pieceBytes int64
+	for remaining := length; remaining > 0; {
+		n := int64(len(buf))
+		if remaining < n {
+			n = remaining
+		}
+		_, err = io.ReadFull(r, buf[:n])
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return
+		}
+		remaining -= n
+		pieceBytes += n
+		blockHashes = append(blockHashes, sha256.Sum256(buf[:n]))
+		if len(blockHashes) == blocksPerPiece || remaining == 0 {
+			err = onPiece(pieceBytes)
+			if err != nil {
+				return
+			}
+			pieceBytes = 0
+			if length <= pieceLength {
+				// The file's tree is sized to its blocks, and has no piece layer.
+				root = merkle.Root(blockHashes, merkle.Hash{})
+				return
+			}
+			for len(blockHashes) < blocksPerPiece {
+				blockHashes = append(blockHashes, merkle.Hash{})
+			}
+			pieceHashes = append(pieceHashes, merkle.Root(blockHashes, merkle.Hash{}))
+			blockHashes = blockHashes[:0]
+		}
+	}
+	if len(pieceHashes) == 0 {
+		err = errors.New("no data")
+		return
+	}
+	root = merkle.Root(pieceHashes, merkle.ZeroRoot(blocksPerPiece))
+	layer = make([]byte, 0, len(pieceHashes)*sha256.Size)
+	for _, h := range pieceHashes {
+		layer = append(layer, h[:]...)
+	}
+	return
+}
@@ -0,0 +1,174 @@
+package metainfo
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/anacrolix/torrent/bencode"
+)
+
+// The keys and raw values of a bencoded info dict, for editing it without going through Info. Info
+// drops keys it doesn't know, and encodes values in its own way, so decoding and encoding it again
+// can change the infohash. An InfoDict keeps keys in their original order, and encodes every entry
+// that isn't set again with its original bytes.
+type InfoDict struct {
+	entries []infoDictEntry
+}
+
+type infoDictEntry struct {
+	key string
+	// The encoded key and value as they were parsed, or as set.
+	rawKey bencode.Bytes
+	value  bencode.Bytes
+}
+
+// Parses a bencoded dict, such as MetaInfo.InfoBytes. Duplicate keys are an error, as there'd be no
+// telling which one applies.
+func ParseInfoDict(b []byte) (*InfoDict, error) {
+	if len(b) == 0 || b[0] != 'd' {
+		return nil, errors.New("not a dict")
+	}
+	d := bencode.NewDecoder(bytes.NewReader(b[1:]))
+	ret := new(InfoDict)
+	seen := make(map[string]struct{})
+	for {
+		offset := 1 + d.Offset
+		if offset >= int64(len(b)) {
+			return nil, errors.New("dict not terminated")
+		}
+		if b[offset] == 'e' {
+			if offset+1 != int64(len(b)) {
+				return nil, fmt.Errorf("%v trailing bytes after dict", int64(len(b))-offset-1)
+			}
+			return ret, nil
+		}
+		var e infoDictEntry
+		err := d.Decode(&e.rawKey)
+		if err == nil && (e.rawKey[0] < '0' || e.rawKey[0] > '9') {
+			// The decoder would make a string of an integer.
+			err = errors.New("not a string")
+		}
+		if err == nil {
+			err = bencode.Unmarshal(e.rawKey, &e.key)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("decoding key at offset %v: %w", offset, err)
+		}
+		if _, ok := seen[e.key]; ok {
+			return nil, fmt.Errorf("duplicate key %q", e.key)
+		}
+		seen[e.key] = struct{}{}
+		err = d.Decode(&e.value)
+		if err != nil {
+			return nil, fmt.Errorf("decoding value of %q: %w", e.key, err)
+		}
+		ret.entries = append(ret.entries, e)
+	}
+}
+
+// The keys, in order.
+func (me *InfoDict) Keys() (ret []string) {
+	for _, e := range me.entries {
+		ret = append(ret, e.key)
+	}
+	return
+}
+
+func (me *InfoDict) index(key string) int {
+	for i, e := range me.entries {
+		if e.key == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// Returns the encoded value for the key.
+func (me *InfoDict) Get(key string) (value bencode.Bytes, ok bool) {
+	i := me.index(key)
+	if i < 0 {
+		return nil, false
+	}
+	return me.entries[i].value, true
+}
+
+// Decodes the value for the key into v. ok is false if the key isn't present.
+func (me *InfoDict) Unmarshal(key string, v interface{}) (ok bool, err error) {
+	b, ok := me.Get(key)
+	if !ok {
+		return
+	}
+	return true, bencode.Unmarshal(b, v)
+}
+
+// Sets the key to the bencoding of v. See SetRaw.
+func (me *InfoDict) Set(key string, v interface{}) error {
+	b, err := bencode.Marshal(v)
+	if err != nil {
+		return err
+	}
+	me.SetRaw(key, b)
+	return nil
+}
+
+// Sets the key to an encoded value. An existing key keeps its place. A new key goes before the first
+// key that sorts after it, so keys that were in canonical order stay that way.
+func (me *InfoDict) SetRaw(key string, value bencode.Bytes) {
+	if i := me.index(key); i >= 0 {
+		me.entries[i].value = value
+		return
+	}
+	e := infoDictEntry{key: key, rawKey: bencode.MustMarshal(key), value: value}
+	i := sort.Search(len(me.entries), func(i int) bool {
+		return me.entries[i].key > key
+	})
+	me.entries = append(me.entries, infoDictEntry{})
+	copy(me.entries[i+1:], me.entries[i:])
+	me.entries[i] = e
+}
+
+// Removes the key, if it's present.
+func (me *InfoDict) Delete(key string) {
+	if i := me.index(key); i >= 0 {
+		me.entries = append(me.entries[:i], me.entries[i+1:]...)
+	}
+}
+
+// Encodes the dict. If nothing was changed, that's the bytes it was parsed from.
+func (me *InfoDict) Bytes() []byte {
+	var buf bytes.Buffer
+	buf.WriteByte('d')
+	for _, e := range me.entries {
+		buf.Write(e.rawKey)
+		buf.Write(e.value)
+	}
+	buf.WriteByte('e')
+	return buf.Bytes()
+}
+
+// Decodes the dict as an Info.
+func (me *InfoDict) Info() (info Info, err error) {
+	err = bencode.Unmarshal(me.Bytes(), &info)
+	return
+}
+
+// Applies edit to the info dict, and encodes it again. The info must decode, so that a bad info
+// isn't given a new infohash.
+func editInfoDict(infoBytes []byte, edit func(d *InfoDict) error) ([]byte, error) {
+	var info Info
+	err := bencode.Unmarshal(infoBytes, &info)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshalling info: %w", err)
+	}
+	d, err := ParseInfoDict(infoBytes)
+	if err != nil {
+		return nil, fmt.Errorf("parsing info dict: %w", err)
+	}
+	err = edit(d)
+	if err != nil {
+		return nil, err
+	}
+	return d.Bytes(), nil
+}
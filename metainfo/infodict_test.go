@@ -0,0 +1,84 @@
+package metainfo
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestInfoDictRoundTrip(t *testing.T) {
+	c := qt.New(t)
+	names, err := filepath.Glob("testdata/*.torrent")
+	c.Assert(err, qt.IsNil)
+	for _, name := range names {
+		b, err := os.ReadFile(name)
+		c.Assert(err, qt.IsNil)
+		mi, _, err := LoadLenient(b)
+		c.Assert(err, qt.IsNil)
+		d, err := ParseInfoDict(mi.InfoBytes)
+		c.Assert(err, qt.IsNil, qt.Commentf(name))
+		c.Check(string(d.Bytes()), qt.Equals, string(mi.InfoBytes), qt.Commentf(name))
+	}
+}
+
+func TestInfoDictEdit(t *testing.T) {
+	c := qt.New(t)
+	// The keys are out of order, and one is encoded with a leading zero in its length.
+	d, err := ParseInfoDict([]byte("d4:name1:x6:lengthi1e02:zzi01e1:bi2ee"))
+	c.Assert(err, qt.IsNil)
+	c.Check(d.Keys(), qt.DeepEquals, []string{"name", "length", "zz", "b"})
+	v, ok := d.Get("zz")
+	c.Check(ok, qt.IsTrue)
+	c.Check(string(v), qt.Equals, "i01e")
+	var name string
+	ok, err = d.Unmarshal("name", &name)
+	c.Check(ok, qt.IsTrue)
+	c.Check(err, qt.IsNil)
+	c.Check(name, qt.Equals, "x")
+	ok, err = d.Unmarshal("missing", &name)
+	c.Check(ok, qt.IsFalse)
+	c.Check(err, qt.IsNil)
+	c.Assert(d.Set("name", "renamed"), qt.IsNil)
+	c.Assert(d.Set("a", 3), qt.IsNil)
+	d.Delete("b")
+	d.Delete("missing")
+	c.Check(string(d.Bytes()), qt.Equals, "d1:ai3e4:name7:renamed6:lengthi1e02:zzi01ee")
+	info, err := d.Info()
+	c.Assert(err, qt.IsNil)
+	c.Check(info.Name, qt.Equals, "renamed")
+	c.Check(info.Length, qt.Equals, int64(1))
+}
+
+func TestInfoDictSetKeepsCanonicalOrder(t *testing.T) {
+	c := qt.New(t)
+	d, err := ParseInfoDict([]byte("d1:ai1e1:ci3ee"))
+	c.Assert(err, qt.IsNil)
+	d.SetRaw("b", []byte("i2e"))
+	d.SetRaw("d", []byte("i4e"))
+	c.Check(string(d.Bytes()), qt.Equals, "d1:ai1e1:bi2e1:ci3e1:di4ee")
+	d, err = ParseInfoDict([]byte("de"))
+	c.Assert(err, qt.IsNil)
+	c.Check(d.Keys(), qt.HasLen, 0)
+	d.SetRaw("a", []byte("0:"))
+	c.Check(string(d.Bytes()), qt.Equals, "d1:a0:e")
+}
+
+func TestParseInfoDictErrors(t *testing.T) {
+	for _, test := range []struct {
+		input string
+		err   string
+	}{
+		{"", "not a dict"},
+		{"li1ee", "not a dict"},
+		{"d1:ai1e", "dict not terminated"},
+		{"d1:ai1eex", "1 trailing bytes after dict"},
+		{"d1:ai1e1:ai2ee", `duplicate key "a"`},
+		{"di1ei2ee", "decoding key at offset 1: .*"},
+		{"d1:ae", `decoding value of "a": .*`},
+	} {
+		_, err := ParseInfoDict([]byte(test.input))
+		qt.Check(t, err, qt.ErrorMatches, test.err, qt.Commentf("%q", test.input))
+	}
+}
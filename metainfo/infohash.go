@@ -0,0 +1,120 @@
+package metainfo
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"errors"
+	"hash"
+	"io"
+
+	"github.com/anacrolix/torrent/bencode"
+)
+
+// Returns the v1 infohash of the metainfo read from r, without decoding it. See
+// ReadInfoHashAndName.
+func ReadInfoHash(r io.Reader) (Hash, error) {
+	infoHash, _, err := ReadInfoHashAndName(r)
+	return infoHash, err
+}
+
+// Returns the v1 infohash of the metainfo read from r, and the best name of its info, as for
+// Info.BestName. The info is hashed as it streams past, so only the name is kept in memory, and
+// nothing else is decoded. The info must be a dict. If "info" is duplicated, the last is used, as by
+// Load. r is read to the end of the metainfo, and maybe beyond.
+func ReadInfoHashAndName(r io.Reader) (infoHash Hash, name string, err error) {
+	hr := &hashingReader{r: bufio.NewReader(r), h: sha1.New()}
+	d := bencode.NewDecoder(hr)
+	tok, err := d.NextToken()
+	if err != nil {
+		return
+	}
+	if tok.Kind != bencode.DictStart {
+		err = errors.New("metainfo isn't a dict")
+		return
+	}
+	found := false
+	for {
+		tok, err = d.NextToken()
+		if err != nil {
+			return
+		}
+		if tok.Kind == bencode.DictEnd {
+			break
+		}
+		if string(tok.Bytes) != "info" {
+			if err = d.SkipValue(); err != nil {
+				return
+			}
+			continue
+		}
+		hr.h.Reset()
+		hr.hashing = true
+		name, err = readInfoName(d)
+		hr.hashing = false
+		if err != nil {
+			return
+		}
+		found = true
+	}
+	if !found {
+		err = errors.New("metainfo has no info")
+		return
+	}
+	hr.h.Sum(infoHash[:0])
+	return
+}
+
+// Reads the info dict, returning its best name.
+func readInfoName(d *bencode.Decoder) (string, error) {
+	tok, err := d.NextToken()
+	if err != nil {
+		return "", err
+	}
+	if tok.Kind != bencode.DictStart {
+		return "", errors.New("info isn't a dict")
+	}
+	var info Info
+	for {
+		tok, err = d.NextToken()
+		if err != nil {
+			return "", err
+		}
+		if tok.Kind == bencode.DictEnd {
+			return info.BestName(), nil
+		}
+		var name *string
+		switch string(tok.Bytes) {
+		case "name":
+			name = &info.Name
+		case "name.utf-8":
+			name = &info.NameUTF8
+		default:
+			if err := d.SkipValue(); err != nil {
+				return "", err
+			}
+			continue
+		}
+		// Names that aren't strings are ignored, as they'd fail to decode into an Info.
+		var v interface{}
+		if err := d.Decode(&v); err != nil {
+			return "", err
+		}
+		*name, _ = v.(string)
+	}
+}
+
+// Hashes what's read through it while hashing is set. The bencode.Decoder reads no more than the
+// values it consumes, so the boundaries are exact.
+type hashingReader struct {
+	r       io.Reader
+	h       hash.Hash
+	hashing bool
+}
+
+func (me *hashingReader) Read(b []byte) (n int, err error) {
+	n, err = me.r.Read(b)
+	if me.hashing {
+		me.h.Write(b[:n])
+	}
+	return
+}
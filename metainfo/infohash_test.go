@@ -0,0 +1,99 @@
+package metainfo
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/anacrolix/torrent/bencode"
+)
+
+func TestReadInfoHashMatchesLoad(t *testing.T) {
+	c := qt.New(t)
+	paths, err := filepath.Glob("testdata/*.torrent")
+	c.Assert(err, qt.IsNil)
+	for _, p := range paths {
+		mi, err := LoadFromFile(p)
+		if err != nil {
+			continue
+		}
+		info, err := mi.UnmarshalInfo()
+		c.Assert(err, qt.IsNil, qt.Commentf(p))
+		f, err := os.Open(p)
+		c.Assert(err, qt.IsNil)
+		infoHash, name, err := ReadInfoHashAndName(f)
+		f.Close()
+		c.Assert(err, qt.IsNil, qt.Commentf(p))
+		c.Check(infoHash, qt.Equals, mi.HashInfoBytes(), qt.Commentf(p))
+		c.Check(name, qt.Equals, info.BestName(), qt.Commentf(p))
+	}
+}
+
+func TestReadInfoHash(t *testing.T) {
+	c := qt.New(t)
+	info := "d4:name1:a10:name.utf-81:b6:pieces0:e"
+	infoHash, name, err := ReadInfoHashAndName(strings.NewReader("d8:announce1:x4:info" + info + "1:zi1ee"))
+	c.Assert(err, qt.IsNil)
+	c.Check(infoHash, qt.Equals, HashBytes([]byte(info)))
+	c.Check(name, qt.Equals, "b")
+	// The last info, as Load uses.
+	infoHash, err = ReadInfoHash(strings.NewReader("d4:infod1:ai1ee4:info" + info + "e"))
+	c.Assert(err, qt.IsNil)
+	c.Check(infoHash, qt.Equals, HashBytes([]byte(info)))
+	// Names that aren't strings don't stop the infohash being read.
+	_, name, err = ReadInfoHashAndName(strings.NewReader("d4:infod4:nameli1eeee"))
+	c.Assert(err, qt.IsNil)
+	c.Check(name, qt.Equals, "")
+
+	for _, s := range []string{
+		"",
+		"le",
+		"de",
+		"d4:infoli1eee",
+		"d4:info3:abce",
+		"d4:infod4:name",
+		"d4:infod4:name1:ae",
+		"d4:infode",
+	} {
+		_, err := ReadInfoHash(strings.NewReader(s))
+		c.Check(err, qt.Not(qt.IsNil), qt.Commentf("%q", s))
+	}
+}
+
+// A metainfo that's mostly pieces.
+func largeMetaInfoBytes(tb testing.TB, piecesLen int) []byte {
+	infoBytes, err := bencode.Marshal(Info{Name: "large", PieceLength: 1 << 18, Pieces: make([]byte, piecesLen)})
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return bencode.MustMarshal(MetaInfo{Announce: "http://tracker.example.com/announce", InfoBytes: infoBytes})
+}
+
+// Getting the infohash of a 60 MB torrent by streaming it, and by loading it.
+func BenchmarkReadInfoHash(b *testing.B) {
+	data := largeMetaInfoBytes(b, 60<<20)
+	b.Run("ReadInfoHash", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(int64(len(data)))
+		for i := 0; i < b.N; i++ {
+			if _, err := ReadInfoHash(bytes.NewReader(data)); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("Load", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(int64(len(data)))
+		for i := 0; i < b.N; i++ {
+			mi, err := LoadWithOpts(bytes.NewReader(data), LoadOpts{MaxSize: -1, MaxPiecesLength: -1})
+			if err != nil {
+				b.Fatal(err)
+			}
+			mi.HashInfoBytes()
+		}
+	})
+}
@@ -0,0 +1,338 @@
+package metainfo
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/anacrolix/torrent/bencode"
+)
+
+var (
+	_ json.Marshaler   = MetaInfo{}
+	_ json.Unmarshaler = (*MetaInfo)(nil)
+	_ json.Marshaler   = Info{}
+	_ json.Unmarshaler = (*Info)(nil)
+)
+
+// The JSON form of a MetaInfo. Keys are as in the bencoding. The info is given both decoded, for
+// inspection, and as the raw info bytes, so that it can be restored exactly.
+type metaInfoJSON struct {
+	InfoHash     string            `json:"info hash,omitempty"`
+	InfoBytes    []byte            `json:"info bytes,omitempty"`
+	Info         json.RawMessage   `json:"info,omitempty"`
+	Announce     string            `json:"announce,omitempty"`
+	AnnounceList AnnounceList      `json:"announce-list,omitempty"`
+	Nodes        []Node            `json:"nodes,omitempty"`
+	NodesAsPairs bool              `json:"nodes as pairs,omitempty"`
+	CreationDate string            `json:"creation date,omitempty"`
+	Comment      string            `json:"comment,omitempty"`
+	CreatedBy    string            `json:"created by,omitempty"`
+	Encoding     string            `json:"encoding,omitempty"`
+	UrlList      []string          `json:"url-list,omitempty"`
+	HttpSeeds    []string          `json:"httpseeds,omitempty"`
+	PieceLayers  map[string]string `json:"piece layers,omitempty"`
+	// Unknown fields are raw bencode, which is base64 in JSON.
+	UnknownFields map[string][]byte `json:"unknown fields,omitempty"`
+}
+
+// Encodes the MetaInfo as JSON, for tools like jq. The infohash is in hex, the creation date is
+// RFC 3339, piece layers are hex, and unknown fields are base64 of their bencoding. The info appears
+// decoded under "info", and as the raw info bytes in base64 under "info bytes". If the info bytes
+// don't decode, only the raw form is included.
+func (mi MetaInfo) MarshalJSON() ([]byte, error) {
+	j := metaInfoJSON{
+		Announce:     mi.Announce,
+		AnnounceList: mi.AnnounceList,
+		Nodes:        mi.Nodes,
+		NodesAsPairs: mi.NodesAsPairs,
+		Comment:      mi.Comment,
+		CreatedBy:    mi.CreatedBy,
+		Encoding:     mi.Encoding,
+		UrlList:      mi.UrlList,
+		HttpSeeds:    mi.HttpSeeds,
+	}
+	if mi.InfoBytes != nil {
+		j.InfoHash = mi.HashInfoBytes().HexString()
+		j.InfoBytes = mi.InfoBytes
+		if info, err := mi.Info(); err == nil {
+			b, err := json.Marshal(info)
+			if err != nil {
+				return nil, fmt.Errorf("encoding info: %w", err)
+			}
+			j.Info = b
+		}
+	}
+	if mi.CreationDate != 0 {
+		j.CreationDate = time.Unix(mi.CreationDate, 0).UTC().Format(time.RFC3339)
+	}
+	if mi.PieceLayers != nil {
+		j.PieceLayers = make(map[string]string, len(mi.PieceLayers))
+		for root, layer := range mi.PieceLayers {
+			j.PieceLayers[hex.EncodeToString([]byte(root))] = hex.EncodeToString([]byte(layer))
+		}
+	}
+	if mi.UnknownFields != nil {
+		j.UnknownFields = make(map[string][]byte, len(mi.UnknownFields))
+		for k, v := range mi.UnknownFields {
+			j.UnknownFields[k] = v
+		}
+	}
+	return json.Marshal(j)
+}
+
+// Decodes JSON as produced by MarshalJSON. The raw info bytes are used if the decoded info is as
+// they'd produce, so JSON from MarshalJSON restores the info bytes exactly. Otherwise, such as after
+// the decoded info is edited, the info bytes are encoded from it, and the infohash changes. The
+// "info hash" key is ignored.
+func (mi *MetaInfo) UnmarshalJSON(b []byte) error {
+	var j metaInfoJSON
+	err := json.Unmarshal(b, &j)
+	if err != nil {
+		return err
+	}
+	ret := MetaInfo{
+		InfoBytes:    j.InfoBytes,
+		Announce:     j.Announce,
+		AnnounceList: j.AnnounceList,
+		Nodes:        j.Nodes,
+		NodesAsPairs: j.NodesAsPairs,
+		Comment:      j.Comment,
+		CreatedBy:    j.CreatedBy,
+		Encoding:     j.Encoding,
+		UrlList:      j.UrlList,
+		HttpSeeds:    j.HttpSeeds,
+	}
+	if len(j.Info) != 0 {
+		ret.InfoBytes, err = infoBytesFromJSON(j.Info, j.InfoBytes)
+		if err != nil {
+			return err
+		}
+	}
+	ret.SetInfoBytes(ret.InfoBytes)
+	if j.CreationDate != "" {
+		t, err := time.Parse(time.RFC3339, j.CreationDate)
+		if err != nil {
+			return fmt.Errorf("parsing creation date: %w", err)
+		}
+		ret.CreationDate = t.Unix()
+	}
+	if j.PieceLayers != nil {
+		ret.PieceLayers = make(map[string]string, len(j.PieceLayers))
+		for root, layer := range j.PieceLayers {
+			rootBytes, err := hex.DecodeString(root)
+			if err != nil {
+				return fmt.Errorf("decoding piece layers root %q: %w", root, err)
+			}
+			layerBytes, err := hex.DecodeString(layer)
+			if err != nil {
+				return fmt.Errorf("decoding piece layer for %q: %w", root, err)
+			}
+			ret.PieceLayers[string(rootBytes)] = string(layerBytes)
+		}
+	}
+	if j.UnknownFields != nil {
+		ret.UnknownFields = make(map[string]bencode.Bytes, len(j.UnknownFields))
+		for k, v := range j.UnknownFields {
+			ret.UnknownFields[k] = v
+		}
+	}
+	*mi = ret
+	return nil
+}
+
+// Returns raw if it decodes to the given JSON info, and otherwise encodes the JSON info.
+func infoBytesFromJSON(view json.RawMessage, raw []byte) ([]byte, error) {
+	var info Info
+	err := json.Unmarshal(view, &info)
+	if err != nil {
+		return nil, fmt.Errorf("decoding info: %w", err)
+	}
+	if raw != nil {
+		var rawInfo Info
+		if bencode.Unmarshal(raw, &rawInfo) == nil {
+			// Compare the canonical JSON forms, which don't depend on formatting or key order.
+			want, err := json.Marshal(info)
+			if err != nil {
+				return nil, err
+			}
+			got, err := json.Marshal(rawInfo)
+			if err != nil {
+				return nil, err
+			}
+			if bytes.Equal(want, got) {
+				return raw, nil
+			}
+		}
+	}
+	return bencode.Marshal(info)
+}
+
+// The JSON form of an Info. Keys are as in the bencoding.
+type infoJSON struct {
+	PieceLength int64           `json:"piece length"`
+	Pieces      []string        `json:"pieces,omitempty"`
+	Name        string          `json:"name"`
+	Length      int64           `json:"length,omitempty"`
+	Private     *bool           `json:"private,omitempty"`
+	Source      string          `json:"source,omitempty"`
+	Files       []fileInfoJSON  `json:"files,omitempty"`
+	MetaVersion int64           `json:"meta version,omitempty"`
+	FileTree    json.RawMessage `json:"file tree,omitempty"`
+	NameUTF8    string          `json:"name.utf-8,omitempty"`
+	Similar     []Hash          `json:"similar,omitempty"`
+	Collections []string        `json:"collections,omitempty"`
+	// In hex.
+	RootHash string `json:"root hash,omitempty"`
+}
+
+type fileInfoJSON struct {
+	Length      int64    `json:"length"`
+	Path        []string `json:"path"`
+	PathUTF8    []string `json:"path.utf-8,omitempty"`
+	Attr        string   `json:"attr,omitempty"`
+	SymlinkPath []string `json:"symlink path,omitempty"`
+	Md5sum      string   `json:"md5sum,omitempty"`
+	// In hex.
+	Sha1  string `json:"sha1,omitempty"`
+	Mtime int64  `json:"mtime,omitempty"`
+}
+
+// Encodes the info as JSON, with keys as in the bencoding. The pieces are a list of hex piece
+// hashes, and the pieces roots of the file tree are hex. Strings that aren't valid UTF-8 can't be
+// represented exactly, so prefer MetaInfo.MarshalJSON, which keeps the raw info bytes too.
+func (info Info) MarshalJSON() ([]byte, error) {
+	j := infoJSON{
+		PieceLength: info.PieceLength,
+		Name:        info.Name,
+		Length:      info.Length,
+		Private:     info.Private,
+		Source:      info.Source,
+		MetaVersion: info.MetaVersion,
+		NameUTF8:    info.NameUTF8,
+		Similar:     info.Similar,
+		Collections: info.Collections,
+		RootHash:    hex.EncodeToString(info.RootHash),
+	}
+	for b := info.Pieces; len(b) != 0; {
+		// A trailing partial hash is kept as is, so malformed pieces survive too.
+		n := HashSize
+		if len(b) < n {
+			n = len(b)
+		}
+		j.Pieces = append(j.Pieces, hex.EncodeToString(b[:n]))
+		b = b[n:]
+	}
+	for _, fi := range info.Files {
+		fj := fileInfoJSON(fi)
+		fj.Sha1 = hex.EncodeToString([]byte(fi.Sha1))
+		j.Files = append(j.Files, fj)
+	}
+	if info.FileTree.IsDir() || info.FileTree.File != (FileTreeFile{}) {
+		b, err := json.Marshal(fileTreeJSON(info.FileTree))
+		if err != nil {
+			return nil, err
+		}
+		j.FileTree = b
+	}
+	return json.Marshal(j)
+}
+
+func (info *Info) UnmarshalJSON(b []byte) error {
+	var j infoJSON
+	err := json.Unmarshal(b, &j)
+	if err != nil {
+		return err
+	}
+	ret := Info{
+		PieceLength: j.PieceLength,
+		Name:        j.Name,
+		Length:      j.Length,
+		Private:     j.Private,
+		Source:      j.Source,
+		MetaVersion: j.MetaVersion,
+		NameUTF8:    j.NameUTF8,
+		Similar:     j.Similar,
+		Collections: j.Collections,
+	}
+	if j.RootHash != "" {
+		ret.RootHash, err = hex.DecodeString(j.RootHash)
+		if err != nil {
+			return fmt.Errorf("decoding root hash: %w", err)
+		}
+	}
+	for i, s := range j.Pieces {
+		h, err := hex.DecodeString(s)
+		if err != nil {
+			return fmt.Errorf("decoding piece %v: %w", i, err)
+		}
+		ret.Pieces = append(ret.Pieces, h...)
+	}
+	for i, fj := range j.Files {
+		fi := FileInfo(fj)
+		sha1, err := hex.DecodeString(fj.Sha1)
+		if err != nil {
+			return fmt.Errorf("decoding sha1 of file %v: %w", i, err)
+		}
+		fi.Sha1 = string(sha1)
+		ret.Files = append(ret.Files, fi)
+	}
+	if len(j.FileTree) != 0 {
+		ret.FileTree, err = fileTreeFromJSON(j.FileTree)
+		if err != nil {
+			return fmt.Errorf("decoding file tree: %w", err)
+		}
+	}
+	*info = ret
+	return nil
+}
+
+// Returns the file tree in the shape of its bencoding, with the pieces roots in hex.
+func fileTreeJSON(ft FileTree) interface{} {
+	if !ft.IsDir() {
+		props := map[string]interface{}{"length": ft.File.Length}
+		if ft.File.PiecesRoot != "" {
+			props["pieces root"] = hex.EncodeToString([]byte(ft.File.PiecesRoot))
+		}
+		return map[string]interface{}{FileTreePropertiesKey: props}
+	}
+	ret := make(map[string]interface{}, len(ft.Dir))
+	for name, sub := range ft.Dir {
+		ret[name] = fileTreeJSON(sub)
+	}
+	return ret
+}
+
+func fileTreeFromJSON(b json.RawMessage) (ft FileTree, err error) {
+	var dir map[string]json.RawMessage
+	err = json.Unmarshal(b, &dir)
+	if err != nil {
+		return
+	}
+	if props, ok := dir[FileTreePropertiesKey]; ok {
+		var file struct {
+			Length     int64  `json:"length"`
+			PiecesRoot string `json:"pieces root"`
+		}
+		err = json.Unmarshal(props, &file)
+		if err != nil {
+			return
+		}
+		root, err := hex.DecodeString(file.PiecesRoot)
+		if err != nil {
+			return ft, fmt.Errorf("decoding pieces root: %w", err)
+		}
+		ft.File = FileTreeFile{Length: file.Length, PiecesRoot: string(root)}
+		return ft, nil
+	}
+	ft.Dir = make(map[string]FileTree, len(dir))
+	for name, b := range dir {
+		ft.Dir[name], err = fileTreeFromJSON(b)
+		if err != nil {
+			return ft, fmt.Errorf("%q: %w", name, err)
+		}
+	}
+	return
+}
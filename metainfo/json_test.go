@@ -0,0 +1,107 @@
+package metainfo
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/anacrolix/torrent/bencode"
+)
+
+func TestJSONRoundTripFixtures(t *testing.T) {
+	paths, err := filepath.Glob("testdata/*.torrent")
+	qt.Assert(t, err, qt.IsNil)
+	for _, path := range paths {
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			c := qt.New(t)
+			b, err := os.ReadFile(path)
+			c.Assert(err, qt.IsNil)
+			// Some fixtures only load with repairs.
+			mi, _, err := LoadLenient(b)
+			c.Assert(err, qt.IsNil)
+			b, err = json.Marshal(mi)
+			c.Assert(err, qt.IsNil)
+			var got MetaInfo
+			c.Assert(json.Unmarshal(b, &got), qt.IsNil)
+			c.Check(got.HashInfoBytes(), qt.Equals, mi.HashInfoBytes())
+			c.Check([]byte(got.InfoBytes), qt.DeepEquals, []byte(mi.InfoBytes))
+			want, err := bencode.Marshal(mi)
+			c.Assert(err, qt.IsNil)
+			gotBytes, err := bencode.Marshal(got)
+			c.Assert(err, qt.IsNil)
+			c.Check(string(gotBytes), qt.Equals, string(want))
+		})
+	}
+}
+
+func TestJSONView(t *testing.T) {
+	c := qt.New(t)
+	mi, err := LoadFromFile("testdata/hybrid.torrent")
+	c.Assert(err, qt.IsNil)
+	b, err := json.Marshal(mi)
+	c.Assert(err, qt.IsNil)
+	var view struct {
+		InfoHash     string `json:"info hash"`
+		CreationDate string `json:"creation date"`
+		Info         struct {
+			Pieces   []string                   `json:"pieces"`
+			FileTree map[string]json.RawMessage `json:"file tree"`
+		} `json:"info"`
+		PieceLayers map[string]string `json:"piece layers"`
+	}
+	c.Assert(json.Unmarshal(b, &view), qt.IsNil)
+	c.Check(view.InfoHash, qt.Equals, mi.HashInfoBytes().HexString())
+	info, err := mi.UnmarshalInfo()
+	c.Assert(err, qt.IsNil)
+	c.Assert(view.Info.Pieces, qt.HasLen, info.NumPieces())
+	c.Check(view.Info.Pieces[0], qt.Equals, info.Piece(0).Hash().HexString())
+	c.Check(view.Info.FileTree, qt.HasLen, len(info.FileTree.Dir))
+	c.Check(view.PieceLayers, qt.HasLen, len(mi.PieceLayers))
+	if mi.CreationDate != 0 {
+		c.Check(view.CreationDate, qt.Matches, `\d{4}-\d\d-\d\dT\d\d:\d\d:\d\dZ`)
+	}
+}
+
+func TestJSONEditedInfo(t *testing.T) {
+	c := qt.New(t)
+	mi, err := LoadFromFile("testdata/continuum.torrent")
+	c.Assert(err, qt.IsNil)
+	b, err := json.Marshal(mi)
+	c.Assert(err, qt.IsNil)
+	var doc map[string]interface{}
+	c.Assert(json.Unmarshal(b, &doc), qt.IsNil)
+	doc["info"].(map[string]interface{})["name"] = "renamed"
+	doc["creation date"] = "2020-01-02T03:04:05Z"
+	b, err = json.Marshal(doc)
+	c.Assert(err, qt.IsNil)
+	var got MetaInfo
+	c.Assert(json.Unmarshal(b, &got), qt.IsNil)
+	c.Check(got.HashInfoBytes(), qt.Not(qt.Equals), mi.HashInfoBytes())
+	info, err := got.UnmarshalInfo()
+	c.Assert(err, qt.IsNil)
+	c.Check(info.Name, qt.Equals, "renamed")
+	c.Check(got.CreationDate, qt.Equals, int64(1577934245))
+	oldInfo, err := mi.UnmarshalInfo()
+	c.Assert(err, qt.IsNil)
+	oldInfo.Name = "renamed"
+	c.Check(info, qt.DeepEquals, oldInfo)
+}
+
+func TestInfoJSONRoundTrip(t *testing.T) {
+	c := qt.New(t)
+	mi, err := LoadFromFile("testdata/hybrid.torrent")
+	c.Assert(err, qt.IsNil)
+	info, err := mi.UnmarshalInfo()
+	c.Assert(err, qt.IsNil)
+	b, err := json.Marshal(info)
+	c.Assert(err, qt.IsNil)
+	var got Info
+	c.Assert(json.Unmarshal(b, &got), qt.IsNil)
+	c.Check(got, qt.DeepEquals, info)
+	infoBytes, err := bencode.Marshal(got)
+	c.Assert(err, qt.IsNil)
+	c.Check(HashBytes(infoBytes), qt.Equals, mi.HashInfoBytes())
+}
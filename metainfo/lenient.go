@@ -0,0 +1,397 @@
+package metainfo
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/anacrolix/torrent/bencode"
+)
+
+// A field that LoadLenient couldn't decode as expected, and so repaired or dropped.
+type Repair struct {
+	// The path to the field, such as "creation date" or "info.files[1].length".
+	Field string
+	// What was wrong, or was done about it, such as "had wrong type" or "dropped".
+	Problem string
+}
+
+func (me Repair) String() string {
+	return me.Field + " " + me.Problem
+}
+
+// The repairs made by LoadLenient.
+type Repairs []Repair
+
+// For bencode.Decoder.OnDuplicateKey.
+func (me *Repairs) addDuplicateKey(warning *bencode.DecodeError) {
+	*me = append(*me, Repair{warning.Path, "was duplicated"})
+}
+
+func (me Repairs) String() string {
+	ss := make([]string, 0, len(me))
+	for _, r := range me {
+		ss = append(ss, r.String())
+	}
+	return "loaded with repairs: " + strings.Join(ss, ", ")
+}
+
+// Returned along with the MetaInfo when data that doesn't decode strictly was loaded anyway. The
+// info bytes may not hash the same as the original data intended.
+type RepairedError struct {
+	// The error from decoding strictly. It's nil if the data decoded, but had duplicate dict keys,
+	// of which the last values were loaded. Other clients may load the first, and the infohash is of
+	// the info with all of them.
+	Strict error
+	// The repairs that were recorded. Data can fail to decode strictly without any field being
+	// changed, in which case this is empty.
+	Repairs Repairs
+}
+
+func (me RepairedError) Error() string {
+	if len(me.Repairs) == 0 {
+		return fmt.Sprintf("loaded with repairs after: %v", me.Strict)
+	}
+	return me.Repairs.String()
+}
+
+func (me RepairedError) Unwrap() error {
+	return me.Strict
+}
+
+// Returned by LoadLenient when the data doesn't decode strictly, and can't be repaired either.
+type LenientDecodeError struct {
+	// The error from decoding strictly.
+	Strict error
+	// Why the data couldn't be repaired.
+	Reason string
+}
+
+func (me LenientDecodeError) Error() string {
+	return fmt.Sprintf("%v (can't repair: %v)", me.Strict, me.Reason)
+}
+
+func (me LenientDecodeError) Unwrap() error {
+	return me.Strict
+}
+
+// Loads a MetaInfo from b. If b doesn't decode strictly, the fields that can be recovered are loaded
+// instead, and repairs describes what was changed or dropped. The info bytes of a repaired MetaInfo
+// are reconstructed, and may not have the infohash the original data intended.
+func LoadLenient(b []byte) (mi *MetaInfo, repairs Repairs, err error) {
+	mi, err = LoadBytes(b)
+	var repaired RepairedError
+	if errors.As(err, &repaired) {
+		return mi, repaired.Repairs, nil
+	}
+	return
+}
+
+// Repairs data that failed to decode strictly with the error strict.
+func repair(b []byte, strict error, opts LoadOpts) (*MetaInfo, Repairs, error) {
+	var r repairer
+	d := opts.newDecoder(b)
+	d.OnDuplicateKey = r.repairs.addDuplicateKey
+	mi, reason := r.metaInfo(d)
+	if mi == nil {
+		return nil, nil, LenientDecodeError{strict, reason}
+	}
+	return mi, r.repairs, nil
+}
+
+// Rebuilds MetaInfo fields from generically decoded bencode, recording anything that doesn't fit.
+type repairer struct {
+	repairs Repairs
+}
+
+func (r *repairer) add(field, problem string) {
+	r.repairs = append(r.repairs, Repair{field, problem})
+}
+
+func (r *repairer) string(v interface{}, field string) (s string, ok bool) {
+	s, ok = v.(string)
+	if !ok {
+		r.add(field, "had wrong type")
+	}
+	return
+}
+
+func (r *repairer) int(v interface{}, field string) (i int64, ok bool) {
+	i, ok = v.(int64)
+	if !ok {
+		r.add(field, "had wrong type")
+	}
+	return
+}
+
+func (r *repairer) list(v interface{}, field string) (l []interface{}) {
+	l, ok := v.([]interface{})
+	if !ok {
+		r.add(field, "had wrong type")
+	}
+	return
+}
+
+func (r *repairer) dict(v interface{}, field string) (d map[string]interface{}) {
+	d, ok := v.(map[string]interface{})
+	if !ok {
+		r.add(field, "had wrong type")
+	}
+	return
+}
+
+// Returns the strings in a list, skipping anything else.
+func (r *repairer) strings(v interface{}, field string) (ret []string) {
+	for i, elem := range r.list(v, field) {
+		if s, ok := elem.(string); ok {
+			ret = append(ret, s)
+		} else {
+			r.add(indexField(field, i), "skipped malformed entry")
+		}
+	}
+	return
+}
+
+func indexField(field string, i int) string {
+	return fmt.Sprintf("%s[%d]", field, i)
+}
+
+func sortedKeys(d map[string]interface{}) (ret []string) {
+	for k := range d {
+		ret = append(ret, k)
+	}
+	sort.Strings(ret)
+	return
+}
+
+// Returns nil and the reason if the data can't be repaired at all.
+func (r *repairer) metaInfo(d *bencode.Decoder) (mi *MetaInfo, reason string) {
+	var v interface{}
+	// Trailing data is ignored.
+	err := d.Decode(&v)
+	if err != nil {
+		return nil, fmt.Sprintf("decoding bencode: %v", err)
+	}
+	dict, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, "not a dict"
+	}
+	infoDict, ok := dict["info"].(map[string]interface{})
+	if !ok {
+		return nil, "info missing or not a dict"
+	}
+	info, reason := r.info(infoDict)
+	if reason != "" {
+		return nil, reason
+	}
+	mi = new(MetaInfo)
+	infoBytes, err := bencode.Marshal(info)
+	if err != nil {
+		return nil, fmt.Sprintf("encoding info: %v", err)
+	}
+	mi.SetInfoBytes(infoBytes)
+	for _, key := range sortedKeys(dict) {
+		v := dict[key]
+		switch key {
+		case "info":
+		case "announce":
+			mi.Announce, _ = r.string(v, key)
+		case "announce-list":
+			mi.AnnounceList = r.announceList(v, key)
+		case "nodes":
+			mi.Nodes, mi.NodesAsPairs = r.nodes(v, key)
+		case "creation date":
+			if s, ok := v.(string); ok {
+				if i, ok := parseCreationDate(s); ok {
+					mi.CreationDate = i
+					r.add(key, "parsed from string")
+					continue
+				}
+			}
+			mi.CreationDate, _ = r.int(v, key)
+		case "comment":
+			mi.Comment, _ = r.string(v, key)
+		case "created by":
+			mi.CreatedBy, _ = r.string(v, key)
+		case "encoding":
+			mi.Encoding, _ = r.string(v, key)
+		case "url-list":
+			mi.UrlList = r.urlList(v, key)
+		case "httpseeds":
+			mi.HttpSeeds = r.urlList(v, key)
+		case "piece layers":
+			for hash, layer := range r.dict(v, key) {
+				if s, ok := layer.(string); ok {
+					if mi.PieceLayers == nil {
+						mi.PieceLayers = make(map[string]string)
+					}
+					mi.PieceLayers[hash] = s
+				} else {
+					r.add(fmt.Sprintf("%s[%x]", key, hash), "skipped malformed entry")
+				}
+			}
+		default:
+			// Anything decoded generically can be encoded again.
+			if mi.UnknownFields == nil {
+				mi.UnknownFields = make(map[string]bencode.Bytes)
+			}
+			mi.UnknownFields[key] = bencode.MustMarshal(v)
+		}
+	}
+	return
+}
+
+// A single URL is allowed in place of a list.
+func (r *repairer) urlList(v interface{}, field string) UrlList {
+	if s, ok := v.(string); ok {
+		return UrlList{s}.withoutEmpty()
+	}
+	return UrlList(r.strings(v, field)).withoutEmpty()
+}
+
+// Tiers should be lists of strings, but lists of bare strings are common, and each of those becomes
+// its own tier. Anything else is skipped.
+func (r *repairer) announceList(v interface{}, field string) (ret AnnounceList) {
+	for i, elem := range r.list(v, field) {
+		elemField := indexField(field, i)
+		switch elem := elem.(type) {
+		case string:
+			r.add(elemField, "was a bare string")
+			ret = append(ret, []string{elem})
+		case []interface{}:
+			if tier := r.strings(elem, elemField); len(tier) != 0 {
+				ret = append(ret, tier)
+			}
+		default:
+			r.add(elemField, "skipped malformed entry")
+		}
+	}
+	return
+}
+
+// Nodes are "host:port" strings, or [host, port] pairs per BEP 5. pairs is whether every node kept
+// was a pair.
+func (r *repairer) nodes(v interface{}, field string) (ret []Node, pairs bool) {
+	var kept []interface{}
+	for i, elem := range r.list(v, field) {
+		switch elem := elem.(type) {
+		case string:
+			if elem != "" {
+				ret = append(ret, Node(elem))
+				kept = append(kept, elem)
+				continue
+			}
+		case []interface{}:
+			if n, err := nodeFromPair(elem); err == nil {
+				ret = append(ret, n)
+				kept = append(kept, elem)
+				continue
+			}
+		}
+		r.add(indexField(field, i), "skipped malformed entry")
+	}
+	return ret, nodesArePairs(kept)
+}
+
+// Returns a reason if the info can't be repaired.
+func (r *repairer) info(d map[string]interface{}) (info Info, reason string) {
+	for _, key := range sortedKeys(d) {
+		v := d[key]
+		field := "info." + key
+		switch key {
+		case "piece length":
+			info.PieceLength, _ = r.int(v, field)
+		case "pieces":
+			s, _ := r.string(v, field)
+			info.Pieces = []byte(s)
+		case "name":
+			info.Name, _ = r.string(v, field)
+		case "name.utf-8":
+			info.NameUTF8, _ = r.string(v, field)
+		case "length":
+			info.Length, _ = r.int(v, field)
+		case "private":
+			if i, ok := r.int(v, field); ok {
+				private := i == 1
+				info.Private = &private
+			}
+		case "source":
+			info.Source, _ = r.string(v, field)
+		case "files":
+			for i, elem := range r.list(v, field) {
+				if fi, ok := r.fileInfo(elem, indexField(field, i)); ok {
+					info.Files = append(info.Files, fi)
+				}
+			}
+		case "meta version":
+			info.MetaVersion, _ = r.int(v, field)
+		case "similar":
+			for i, elem := range r.list(v, field) {
+				if s, ok := elem.(string); ok && len(s) == HashSize {
+					var h Hash
+					copy(h[:], s)
+					info.Similar = append(info.Similar, h)
+				} else {
+					r.add(indexField(field, i), "skipped malformed entry")
+				}
+			}
+		case "collections":
+			info.Collections = r.strings(v, field)
+		case "root hash":
+			s, _ := r.string(v, field)
+			info.RootHash = []byte(s)
+		case "file tree":
+			err := info.FileTree.UnmarshalBencode(bencode.MustMarshal(v))
+			if err != nil {
+				info.FileTree = FileTree{}
+				r.add(field, "dropped")
+			}
+		default:
+			// The Info can't hold it, so the infohash will change.
+			r.add(field, "dropped")
+		}
+	}
+	if len(info.Pieces) == 0 && !info.HasV2() && !info.IsMerkle() {
+		reason = "info has no pieces"
+	}
+	return
+}
+
+// ok is false if the entry isn't usable and should be skipped.
+func (r *repairer) fileInfo(v interface{}, field string) (fi FileInfo, ok bool) {
+	d, ok := v.(map[string]interface{})
+	if !ok {
+		r.add(field, "skipped malformed entry")
+		return
+	}
+	for _, key := range sortedKeys(d) {
+		v := d[key]
+		keyField := field + "." + key
+		switch key {
+		case "length":
+			fi.Length, _ = r.int(v, keyField)
+		case "path":
+			fi.Path = r.strings(v, keyField)
+		case "path.utf-8":
+			fi.PathUTF8 = r.strings(v, keyField)
+		case "attr":
+			fi.Attr, _ = r.string(v, keyField)
+		case "symlink path":
+			fi.SymlinkPath = r.strings(v, keyField)
+		case "md5sum":
+			fi.Md5sum, _ = r.string(v, keyField)
+		case "sha1":
+			fi.Sha1, _ = r.string(v, keyField)
+		case "mtime":
+			fi.Mtime, _ = r.int(v, keyField)
+		default:
+			r.add(keyField, "dropped")
+		}
+	}
+	if len(fi.Path) == 0 {
+		r.add(field, "skipped without path")
+		return fi, false
+	}
+	return fi, true
+}
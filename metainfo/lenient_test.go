@@ -0,0 +1,120 @@
+package metainfo
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/anacrolix/torrent/bencode"
+)
+
+func TestLoadLenientStrict(t *testing.T) {
+	c := qt.New(t)
+	b, err := ioutil.ReadFile("testdata/hybrid.torrent")
+	c.Assert(err, qt.IsNil)
+	mi, repairs, err := LoadLenient(b)
+	c.Assert(err, qt.IsNil)
+	c.Check(repairs, qt.IsNil)
+	c.Check(mi.InfoBytes, qt.Not(qt.HasLen), 0)
+}
+
+func TestLoadLenientRepairs(t *testing.T) {
+	for _, tc := range []struct {
+		filename string
+		repairs  string
+	}{
+		{"lenient-tiers.torrent", "loaded with repairs: nodes[0] skipped malformed entry"},
+		{"lenient-bare-announce-list.torrent", "loaded with repairs: " +
+			"announce-list[0] was a bare string, " +
+			"announce-list[1][0] skipped malformed entry, " +
+			"announce-list[2] was a bare string"},
+		{"lenient-file-fields.torrent", "loaded with repairs: nodes[0] skipped malformed entry"},
+	} {
+		t.Run(tc.filename, func(t *testing.T) {
+			c := qt.New(t)
+			b, err := ioutil.ReadFile(filepath.Join("testdata", tc.filename))
+			c.Assert(err, qt.IsNil)
+			_, repairs, err := LoadLenient(b)
+			c.Assert(err, qt.IsNil)
+			c.Check(repairs.String(), qt.Equals, tc.repairs)
+		})
+	}
+}
+
+func TestLoadLenientDuplicateKeys(t *testing.T) {
+	c := qt.New(t)
+	dups := []byte("d7:comment5:first7:comment6:second4:infod4:name1:a4:name1:b6:pieces20:aaaaaaaaaaaaaaaaaaaaee")
+	mi, repairs, err := LoadLenient(dups)
+	c.Assert(err, qt.IsNil)
+	c.Check(repairs, qt.DeepEquals, Repairs{{"comment", "was duplicated"}, {"info.name", "was duplicated"}})
+	c.Check(mi.Comment, qt.Equals, "second")
+	info, err := mi.UnmarshalInfo()
+	c.Assert(err, qt.IsNil)
+	c.Check(info.Name, qt.Equals, "b")
+	// The infohash is of the info as it was.
+	c.Check(mi.HashInfoBytes(), qt.Equals, HashBytes([]byte("d4:name1:a4:name1:b6:pieces20:aaaaaaaaaaaaaaaaaaaae")))
+	// Duplicates found while repairing are recorded along with the repairs.
+	b := []byte("d5:nodesli42ee4:infod4:name1:a4:name1:b6:pieces20:aaaaaaaaaaaaaaaaaaaaee")
+	_, repairs, err = LoadLenient(b)
+	c.Assert(err, qt.IsNil)
+	c.Check(repairs, qt.DeepEquals, Repairs{{"info.name", "was duplicated"}, {"nodes[0]", "skipped malformed entry"}})
+	// Load doesn't report them, and LoadStrict rejects them.
+	_, err = Load(bytes.NewReader(dups))
+	c.Check(err, qt.IsNil)
+	_, err = LoadStrict(bytes.NewReader(dups))
+	c.Check(errors.Is(err, bencode.ErrNotCanonical), qt.IsTrue)
+}
+
+func TestLoadLenientWrongTypes(t *testing.T) {
+	c := qt.New(t)
+	mi, repairs, err := LoadLenient(bencode.MustMarshal(map[string]interface{}{
+		"creation date": "yesterday",
+		"comment":       "kept",
+		// Forces the lenient path, as the strict decoder doesn't look inside the info.
+		"nodes": []interface{}{42},
+		"info": map[string]interface{}{
+			"name":         "dir",
+			"piece length": 16384,
+			"pieces":       "01234567890123456789",
+			"files": []interface{}{
+				map[string]interface{}{"length": 1, "path": []interface{}{"a"}, "extra": 1},
+				"not a file",
+				map[string]interface{}{"length": 1},
+			},
+		},
+	}))
+	c.Assert(err, qt.IsNil)
+	c.Check(repairs, qt.DeepEquals, Repairs{
+		{"info.files[0].extra", "dropped"},
+		{"info.files[1]", "skipped malformed entry"},
+		{"info.files[2]", "skipped without path"},
+		{"creation date", "had wrong type"},
+		{"nodes[0]", "skipped malformed entry"},
+	})
+	c.Check(mi.CreationDate, qt.Equals, int64(0))
+	c.Check(mi.Comment, qt.Equals, "kept")
+	info, err := mi.UnmarshalInfo()
+	c.Assert(err, qt.IsNil)
+	c.Check(info.Files, qt.DeepEquals, []FileInfo{{Length: 1, Path: []string{"a"}}})
+}
+
+func TestLoadLenientUnrepairable(t *testing.T) {
+	for _, b := range []string{
+		"",
+		"d4:info",
+		"i42e",
+		// The rest only fail strictly because of the nodes.
+		"d5:nodesli42eee",
+		"d4:infoi1e5:nodesli42eee",
+		"d4:infod4:name1:xe5:nodesli42eee",
+	} {
+		c := qt.New(t)
+		_, _, err := LoadLenient([]byte(b))
+		var lde LenientDecodeError
+		c.Check(errors.As(err, &lde), qt.IsTrue, qt.Commentf("%q", b))
+	}
+}
@@ -0,0 +1,133 @@
+package metainfo
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/anacrolix/torrent/bencode"
+)
+
+// The limits applied by LoadOpts when they're left as zero. They're well beyond what real torrents
+// need, but stop untrusted data from exhausting memory.
+const (
+	DefaultMaxSize         = 16 << 20
+	DefaultMaxDepth        = 256
+	DefaultMaxPiecesLength = 8 << 20
+)
+
+type LoadOpts struct {
+	// Load what can be recovered from data that doesn't decode strictly. See LoadLenient.
+	AllowRepair bool
+	// Data longer than this is rejected without being decoded. Zero means DefaultMaxSize, and
+	// negative means no limit.
+	MaxSize int64
+	// Lists and dicts nested deeper than this are a bencode syntax error. Zero means
+	// DefaultMaxDepth, and negative means no limit.
+	MaxDepth int
+	// Info pieces longer than this are rejected. Zero means DefaultMaxPiecesLength, and negative
+	// means no limit.
+	MaxPiecesLength int64
+	// Reject data that isn't canonically encoded, or has anything after the metainfo, as for
+	// bencode.Decoder.Strict. Such data encodes differently once loaded, which can change the
+	// infohash. It isn't repaired, even with AllowRepair.
+	Strict bool
+}
+
+func (opts LoadOpts) withDefaults() LoadOpts {
+	if opts.MaxSize == 0 {
+		opts.MaxSize = DefaultMaxSize
+	}
+	if opts.MaxDepth == 0 {
+		opts.MaxDepth = DefaultMaxDepth
+	}
+	if opts.MaxPiecesLength == 0 {
+		opts.MaxPiecesLength = DefaultMaxPiecesLength
+	}
+	return opts
+}
+
+// Returns a decoder for b that enforces the limits.
+func (opts LoadOpts) newDecoder(b []byte) *bencode.Decoder {
+	d := bencode.NewDecoder(bytes.NewReader(b))
+	d.MaxDepth = opts.MaxDepth
+	// No string can be longer than the data holding it, so don't allocate for one.
+	d.MaxStrLen = int64(len(b))
+	d.Strict = opts.Strict
+	return d
+}
+
+// Returned when loading data that exceeds one of the limits in LoadOpts.
+type LimitError struct {
+	// The limit that was exceeded, such as "size" or "pieces length".
+	Limit string
+	Max   int64
+}
+
+func (me LimitError) Error() string {
+	return fmt.Sprintf("metainfo exceeds max %v of %v bytes", me.Limit, me.Max)
+}
+
+// Loads a MetaInfo from an io.Reader as directed by opts. If the data was repaired, the MetaInfo
+// is returned along with a RepairedError.
+func LoadWithOpts(r io.Reader, opts LoadOpts) (*MetaInfo, error) {
+	opts = opts.withDefaults()
+	if opts.MaxSize > 0 {
+		r = io.LimitReader(r, opts.MaxSize+1)
+	}
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return loadBytes(b, opts)
+}
+
+// opts must have the defaults applied.
+func loadBytes(b []byte, opts LoadOpts) (*MetaInfo, error) {
+	if opts.MaxSize > 0 && int64(len(b)) > opts.MaxSize {
+		return nil, LimitError{"size", opts.MaxSize}
+	}
+	var mi MetaInfo
+	var duplicates Repairs
+	d := opts.newDecoder(b)
+	if opts.AllowRepair {
+		d.OnDuplicateKey = duplicates.addDuplicateKey
+	}
+	strictErr := d.Decode(&mi)
+	if strictErr == nil {
+		mi.SetInfoBytes(mi.InfoBytes)
+		if err := opts.checkPiecesLength(&mi); err != nil {
+			return nil, err
+		}
+		if len(duplicates) != 0 {
+			return &mi, RepairedError{Repairs: duplicates}
+		}
+		return &mi, nil
+	}
+	if !opts.AllowRepair || opts.Strict {
+		return nil, strictErr
+	}
+	repaired, repairs, err := repair(b, strictErr, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := opts.checkPiecesLength(repaired); err != nil {
+		return nil, err
+	}
+	return repaired, RepairedError{Strict: strictErr, Repairs: repairs}
+}
+
+func (opts LoadOpts) checkPiecesLength(mi *MetaInfo) error {
+	if opts.MaxPiecesLength < 0 {
+		return nil
+	}
+	var info struct {
+		Pieces []byte `bencode:"pieces"`
+	}
+	// Problems with the info don't stop a MetaInfo loading, they're for UnmarshalInfo to report.
+	if bencode.Unmarshal(mi.InfoBytes, &info) == nil && int64(len(info.Pieces)) > opts.MaxPiecesLength {
+		return LimitError{"pieces length", opts.MaxPiecesLength}
+	}
+	return nil
+}
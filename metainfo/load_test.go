@@ -0,0 +1,120 @@
+package metainfo
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/anacrolix/torrent/bencode"
+)
+
+// The data claims a 1 GB string, but is tiny. Nothing should be allocated for the string.
+func TestLoadHugeStringPrefix(t *testing.T) {
+	c := qt.New(t)
+	for _, b := range []string{
+		"d7:comment1000000000:xe",
+		"d4:info1000000000:xe",
+		// Fails strictly on the nodes, so this string is seen by the lenient decoder.
+		"d5:nodesli42ee7:comment1000000000:xe",
+	} {
+		var se *bencode.SyntaxError
+		started := time.Now()
+		_, err := LoadBytes([]byte(b))
+		c.Check(errors.As(err, &se), qt.IsTrue, qt.Commentf("%q: %v", b, err))
+		c.Check(err, qt.ErrorMatches, ".*string length 1000000000 exceeds max of .*")
+		c.Check(time.Since(started) < time.Second, qt.IsTrue)
+	}
+}
+
+func TestLoadDeepNesting(t *testing.T) {
+	c := qt.New(t)
+	const depth = 100000
+	nested := strings.Repeat("l", depth) + strings.Repeat("e", depth)
+	for _, b := range []string{
+		"d7:comment" + nested + "e",
+		"d4:info" + nested + "e",
+		"d5:nodesli42ee7:comment" + nested + "e",
+	} {
+		started := time.Now()
+		_, err := LoadBytes([]byte(b))
+		c.Check(err, qt.ErrorMatches, ".*nesting exceeds max depth of 256.*")
+		c.Check(time.Since(started) < time.Second, qt.IsTrue)
+	}
+	mi, err := LoadWithOpts(strings.NewReader("d5:other"+nested+"e"), LoadOpts{MaxDepth: -1})
+	c.Assert(err, qt.IsNil)
+	c.Check(mi.UnknownFields["other"], qt.HasLen, 2*depth)
+}
+
+func TestLoadMaxSize(t *testing.T) {
+	c := qt.New(t)
+	b := bencode.MustMarshal(map[string]interface{}{
+		"comment": strings.Repeat("x", DefaultMaxSize),
+		"info":    map[string]interface{}{"pieces": ""},
+	})
+	_, err := Load(bytes.NewReader(b))
+	c.Check(err, qt.Equals, LimitError{"size", DefaultMaxSize})
+	_, err = LoadBytes(b)
+	c.Check(err, qt.Equals, LimitError{"size", DefaultMaxSize})
+	_, err = LoadWithOpts(bytes.NewReader(b), LoadOpts{MaxSize: -1})
+	c.Check(err, qt.IsNil)
+}
+
+func TestLoadMaxPiecesLength(t *testing.T) {
+	c := qt.New(t)
+	info := map[string]interface{}{
+		"name":         "x",
+		"piece length": 16384,
+		"pieces":       strings.Repeat("p", 40),
+	}
+	strict := bencode.MustMarshal(map[string]interface{}{"info": info})
+	lenient := bencode.MustMarshal(map[string]interface{}{"info": info, "nodes": []interface{}{42}})
+	for _, b := range [][]byte{strict, lenient} {
+		_, err := LoadWithOpts(bytes.NewReader(b), LoadOpts{AllowRepair: true, MaxPiecesLength: 39})
+		c.Check(err, qt.Equals, LimitError{"pieces length", 39})
+		_, err = LoadWithOpts(bytes.NewReader(b), LoadOpts{AllowRepair: true, MaxPiecesLength: 40})
+		c.Check(err == nil || errors.As(err, new(RepairedError)), qt.IsTrue)
+	}
+}
+
+func TestLoadDecodeErrorContext(t *testing.T) {
+	c := qt.New(t)
+	b := []byte("d4:infod6:lengthi1e4:name1:a12:piece lengthi16384e6:pieces0:e12:piece layersd1:ali1ei2eeee")
+	_, err := LoadBytes(b)
+	var de *bencode.DecodeError
+	c.Assert(errors.As(err, &de), qt.IsTrue, qt.Commentf("%v", err))
+	c.Check(de.Path, qt.Equals, "piece layers.a")
+	c.Check(de.Offset, qt.Equals, int64(len(b)-len("li1ei2eeee")))
+	c.Check(de.Kind, qt.Equals, "list")
+
+	mi, err := LoadBytes([]byte("d4:infod5:filesld6:lengthi1e4:pathl1:aeed6:length1:x4:pathl1:beee4:name1:a12:piece lengthi16384e6:pieces0:ee"))
+	c.Assert(err, qt.IsNil)
+	_, err = mi.Info()
+	c.Assert(err, qt.ErrorMatches, "wrong type at info.files\\[1\\].length: expected integer, got string at offset 42")
+	c.Check(errors.As(err, &de), qt.IsTrue)
+}
+
+func TestLoadStrict(t *testing.T) {
+	c := qt.New(t)
+	for _, name := range []string{"hybrid.torrent", "builder-v1.torrent", "archlinux-2011.08.19-netinstall-i686.iso.torrent"} {
+		b, err := ioutil.ReadFile(filepath.Join("testdata", name))
+		c.Assert(err, qt.IsNil)
+		_, err = LoadStrict(bytes.NewReader(b))
+		c.Check(err, qt.IsNil, qt.Commentf("%v", name))
+		_, err = LoadStrict(bytes.NewReader(append(b, 'x')))
+		c.Check(err, qt.Equals, bencode.ErrUnusedTrailingBytes{NumUnusedBytes: 1})
+	}
+	// Unsorted keys load leniently, but wouldn't bencode the same again.
+	b := []byte("d4:infod6:lengthi1e4:name1:a6:pieces0:12:piece lengthi16384eee")
+	_, err := Load(bytes.NewReader(b))
+	c.Assert(err, qt.IsNil)
+	_, err = LoadStrict(bytes.NewReader(b))
+	c.Check(errors.Is(err, bencode.ErrNotCanonical), qt.IsTrue, qt.Commentf("%v", err))
+	_, err = LoadWithOpts(bytes.NewReader(b), LoadOpts{Strict: true, AllowRepair: true})
+	c.Check(errors.Is(err, bencode.ErrNotCanonical), qt.IsTrue)
+}
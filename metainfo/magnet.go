@@ -1,51 +1,110 @@
 package metainfo
 
 import (
-	"encoding/base32"
 	"encoding/hex"
 	"errors"
 	"fmt"
 	"net/url"
+	"sort"
 	"strings"
 )
 
 // Magnet link components.
 type Magnet struct {
-	InfoHash    Hash       // Expected in this implementation
-	Trackers    []string   // "tr" values
-	DisplayName string     // "dn" value, if not empty
-	Params      url.Values // All other values, such as "x.pe", "as", "xs" etc.
+	InfoHash Hash // "xt" btih value. Zero for a v2-only link.
+	// "xt" btmh value, if present. Hybrid links have both infohashes. BEP 52.
+	InfoHashV2  *Hash32
+	Trackers    []string // "tr" values
+	DisplayName string   // "dn" value, if not empty
+	// "xs" values. URLs of the .torrent file. BEP 9.
+	ExactSource []string
+	// The "xs" urn:btpk value. The ed25519 public key of a BEP 46 mutable torrent, whose infohash is
+	// found in the DHT, where the key's holder can update it. Zero if there's none.
+	PublicKey [32]byte
+	// "s" value. The salt of the mutable torrent's DHT item. BEP 46.
+	Salt []byte
+	// "as" values. URLs of the .torrent file, or of web seeds. BEP 9.
+	AcceptableSource []string
+	// "x.pe" values. Addresses of peers to connect to directly, as "host:port" with IPv6 hosts
+	// bracketed. BEP 9. Values that aren't valid addresses are left in Params.
+	Peers []string
+	// "so" value. The files to download. Empty if there's none.
+	SelectOnly SelectOnly
+	Params     url.Values // All other values, such as "kt" etc.
 }
 
-const xtPrefix = "urn:btih:"
+const (
+	xtPrefix     = "urn:btih:"
+	xtV2Prefix   = "urn:btmh:"
+	xsBtpkPrefix = "urn:btpk:"
+)
+
+// Whether the link is to a BEP 46 mutable torrent, found by its PublicKey.
+func (m Magnet) IsMutable() bool {
+	return m.PublicKey != [32]byte{}
+}
 
+// Returns the magnet link in a canonical form, so that equal Magnets give equal links. Parameters
+// are in the order xt, dn, tr, ws, xs, s, as, x.pe, so, and then any others sorted by key. Values
+// keep their order within each key, and the urn:btpk xs comes first. Mutable torrent links only
+// have an xt if they have an infohash.
 func (m Magnet) String() string {
-	// Deep-copy m.Params
-	vs := make(url.Values, len(m.Params)+len(m.Trackers)+2)
-	for k, v := range m.Params {
-		vs[k] = append([]string(nil), v...)
+	// Transmission and Deluge both expect "urn:btih:" to be unescaped. Deluge wants it to be at the
+	// start of the magnet link. The InfoHash field is expected to be BitTorrent in this
+	// implementation.
+	var params []string
+	if m.InfoHash != (Hash{}) || m.InfoHashV2 == nil && !m.IsMutable() {
+		params = append(params, "xt="+xtPrefix+m.InfoHash.HexString())
 	}
-
-	for _, tr := range m.Trackers {
-		vs.Add("tr", tr)
+	if m.InfoHashV2 != nil {
+		params = append(params, "xt="+xtV2Prefix+m.InfoHashV2.Multihash())
+	}
+	add := func(key string, values ...string) {
+		for _, v := range values {
+			params = append(params, magnetEscape(key)+"="+magnetEscape(v))
+		}
 	}
+	add("xt", m.Params["xt"]...)
 	if m.DisplayName != "" {
-		vs.Add("dn", m.DisplayName)
+		add("dn", m.DisplayName)
+	}
+	add("tr", m.Trackers...)
+	add("ws", m.Params["ws"]...)
+	if m.IsMutable() {
+		params = append(params, "xs="+xsBtpkPrefix+hex.EncodeToString(m.PublicKey[:]))
+	}
+	add("xs", m.ExactSource...)
+	if len(m.Salt) != 0 {
+		add("s", hex.EncodeToString(m.Salt))
+	}
+	add("as", m.AcceptableSource...)
+	add("x.pe", m.Peers...)
+	if !m.SelectOnly.IsEmpty() {
+		add("so", m.SelectOnly.String())
+	}
+	keys := make([]string, 0, len(m.Params))
+	for k := range m.Params {
+		if k != "xt" && k != "ws" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		add(k, m.Params[k]...)
 	}
-
-	// Transmission and Deluge both expect "urn:btih:" to be unescaped. Deluge wants it to be at the
-	// start of the magnet link. The InfoHash field is expected to be BitTorrent in this
-	// implementation.
 	u := url.URL{
 		Scheme:   "magnet",
-		RawQuery: "xt=" + xtPrefix + m.InfoHash.HexString(),
-	}
-	if len(vs) != 0 {
-		u.RawQuery += "&" + vs.Encode()
+		RawQuery: strings.Join(params, "&"),
 	}
 	return u.String()
 }
 
+// Like url.QueryEscape, but spaces are encoded as "%20", which more clients understand than "+".
+func magnetEscape(s string) string {
+	// A literal "+" is escaped, so any left are spaces.
+	return strings.Replace(url.QueryEscape(s), "+", "%20", -1)
+}
+
 // Deprecated: Use ParseMagnetUri.
 var ParseMagnetURI = ParseMagnetUri
 
@@ -61,17 +120,85 @@ func ParseMagnetUri(uri string) (m Magnet, err error) {
 		return
 	}
 	q := u.Query()
-	xt := q.Get("xt")
-	m.InfoHash, err = parseInfohash(q.Get("xt"))
-	if err != nil {
-		err = fmt.Errorf("error parsing infohash %q: %w", xt, err)
+	var otherXts []string
+	haveV1 := false
+	for _, xt := range q["xt"] {
+		switch {
+		case strings.HasPrefix(xt, xtPrefix) && !haveV1:
+			m.InfoHash, err = parseInfohash(xt)
+			haveV1 = true
+		case strings.HasPrefix(xt, xtV2Prefix) && m.InfoHashV2 == nil:
+			var v2 Hash32
+			v2, err = parseInfohashV2(xt)
+			m.InfoHashV2 = &v2
+		default:
+			otherXts = append(otherXts, xt)
+			continue
+		}
+		if err != nil {
+			err = fmt.Errorf("error parsing infohash %q: %w", xt, err)
+			return
+		}
+	}
+	var exactSources []string
+	for _, xs := range q["xs"] {
+		if !strings.HasPrefix(xs, xsBtpkPrefix) || m.IsMutable() {
+			exactSources = append(exactSources, xs)
+			continue
+		}
+		var pk []byte
+		pk, err = hex.DecodeString(xs[len(xsBtpkPrefix):])
+		if err == nil && len(pk) != len(m.PublicKey) {
+			err = fmt.Errorf("public key is %d bytes", len(pk))
+		}
+		if err != nil {
+			err = fmt.Errorf("error parsing public key %q: %w", xs, err)
+			return
+		}
+		copy(m.PublicKey[:], pk)
+	}
+	if !haveV1 && m.InfoHashV2 == nil && !m.IsMutable() {
+		err = fmt.Errorf("error parsing infohash %q: %w", q.Get("xt"), errors.New("bad xt parameter prefix"))
 		return
 	}
-	dropFirst(q, "xt")
+	q["xt"] = otherXts
+	if len(otherXts) == 0 {
+		q.Del("xt")
+	}
 	m.DisplayName = q.Get("dn")
 	dropFirst(q, "dn")
 	m.Trackers = q["tr"]
 	delete(q, "tr")
+	m.ExactSource = exactSources
+	delete(q, "xs")
+	if s := q.Get("s"); s != "" && m.IsMutable() {
+		m.Salt, err = hex.DecodeString(s)
+		if err != nil {
+			err = fmt.Errorf("error parsing salt %q: %w", s, err)
+			return
+		}
+		dropFirst(q, "s")
+	}
+	m.AcceptableSource = q["as"]
+	delete(q, "as")
+	// Invalid peer addresses are left in Params, rather than failing the parse.
+	var badPeers []string
+	for _, pe := range q["x.pe"] {
+		// Unbracketed IPv6 hosts are fixed up the same way as DHT nodes.
+		hostPort := Node(pe).String()
+		if validateHostPort(hostPort) != nil {
+			badPeers = append(badPeers, pe)
+			continue
+		}
+		m.Peers = append(m.Peers, hostPort)
+	}
+	q["x.pe"] = badPeers
+	if len(badPeers) == 0 {
+		q.Del("x.pe")
+	}
+	// Invalid ranges are kept in SelectOnly, rather than failing the parse.
+	m.SelectOnly = ParseSelectOnly(q.Get("so"))
+	dropFirst(q, "so")
 	if len(q) == 0 {
 		q = nil
 	}
@@ -84,28 +211,13 @@ func parseInfohash(xt string) (ih Hash, err error) {
 		err = errors.New("bad xt parameter prefix")
 		return
 	}
-	encoded := xt[len(xtPrefix):]
-	decode := func() func(dst, src []byte) (int, error) {
-		switch len(encoded) {
-		case 40:
-			return hex.Decode
-		case 32:
-			return base32.StdEncoding.Decode
-		}
-		return nil
-	}()
-	if decode == nil {
-		err = fmt.Errorf("unhandled xt parameter encoding (encoded length %d)", len(encoded))
-		return
-	}
-	n, err := decode(ih[:], []byte(encoded))
-	if err != nil {
-		err = fmt.Errorf("error decoding xt: %w", err)
-		return
-	}
-	if n != 20 {
-		panic(n)
-	}
+	return ParseHash(xt[len(xtPrefix):])
+}
+
+// Parses a btmh xt value, which is "urn:btmh:" and a hex-encoded multihash. Only SHA-256 multihashes
+// are used for infohashes.
+func parseInfohashV2(xt string) (ih Hash32, err error) {
+	err = ih.FromMultihash(strings.TrimPrefix(xt, xtV2Prefix))
 	return
 }
 
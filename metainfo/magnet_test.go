@@ -2,10 +2,13 @@ package metainfo
 
 import (
 	"encoding/hex"
+	"net/url"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/anacrolix/torrent/bencode"
 )
 
 var (
@@ -113,3 +116,216 @@ func contains(haystack []string, needle string) bool {
 	}
 	return false
 }
+
+const exampleV2Hex = "caf1e1c30e81cb361b9ee167c4aa64228a7fa4fa9f6105232b28ad099f3a302e"
+
+func TestParseMagnetV2(t *testing.T) {
+	var v2 Hash32
+	hex.Decode(v2[:], []byte(exampleV2Hex))
+	hybrid := "magnet:?xt=urn:btih:51340689c960f0778a4387aef9b4b52fd08390cd&xt=urn:btmh:1220" + exampleV2Hex + "&dn=x"
+	m, err := ParseMagnetUri(hybrid)
+	require.NoError(t, err)
+	assert.EqualValues(t, exampleMagnet.InfoHash, m.InfoHash)
+	require.NotNil(t, m.InfoHashV2)
+	assert.EqualValues(t, v2, *m.InfoHashV2)
+	assert.Nil(t, m.Params)
+	assert.Equal(t, hybrid, m.String())
+
+	v2Only := "magnet:?xt=urn:btmh:1220" + exampleV2Hex
+	m, err = ParseMagnetUri(v2Only)
+	require.NoError(t, err)
+	assert.True(t, m.InfoHash == Hash{})
+	assert.EqualValues(t, v2, *m.InfoHashV2)
+	assert.Equal(t, v2Only, m.String())
+}
+
+func TestParseMagnetBadMultihash(t *testing.T) {
+	for _, tc := range []struct {
+		multihash string
+		err       string
+	}{
+		{"zz20" + exampleV2Hex, "error decoding multihash"},
+		{"12", "multihash too short"},
+		{"1120" + exampleV2Hex, "unsupported multihash function code 0x11"},
+		{"1214" + exampleV2Hex[:40], "bad multihash digest length 20"},
+		{"1220" + exampleV2Hex[:62], "bad multihash digest length 32 with 31 bytes of digest"},
+	} {
+		_, err := ParseMagnetUri("magnet:?xt=urn:btmh:" + tc.multihash)
+		if assert.Error(t, err, tc.multihash) {
+			assert.Contains(t, err.Error(), tc.err)
+		}
+	}
+}
+
+func TestMagnetizeV2(t *testing.T) {
+	mi, err := LoadFromFile("testdata/hybrid.torrent")
+	require.NoError(t, err)
+	v2, ok := mi.HashInfoBytesV2()
+	require.True(t, ok)
+	m := mi.Magnet(nil, nil)
+	assert.Equal(t, mi.HashInfoBytes(), m.InfoHash)
+	require.NotNil(t, m.InfoHashV2)
+	assert.Equal(t, v2, *m.InfoHashV2)
+	assert.Contains(t, m.String(), "xt=urn:btih:"+mi.HashInfoBytes().HexString()+"&xt=urn:btmh:1220"+v2.HexString())
+
+	// A v2-only info has no meaningful v1 infohash.
+	info, err := mi.UnmarshalInfo()
+	require.NoError(t, err)
+	info.Pieces = nil
+	info.Length = 0
+	info.Files = nil
+	mi.InfoBytes, err = bencode.Marshal(info)
+	require.NoError(t, err)
+	m = mi.Magnet(nil, nil)
+	assert.True(t, m.InfoHash == Hash{})
+	assert.Equal(t, HashBytesV2(mi.InfoBytes), *m.InfoHashV2)
+	assert.NotContains(t, m.String(), "btih")
+}
+
+func TestMagnetSources(t *testing.T) {
+	uri := "magnet:?xt=urn:btih:51340689c960f0778a4387aef9b4b52fd08390cd" +
+		"&xs=http%3A%2F%2Fa%2Fx.torrent&xs=http%3A%2F%2Fb%2Fx.torrent&as=http%3A%2F%2Fc%2Fx.torrent&kt=x"
+	m, err := ParseMagnetUri(uri)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"http://a/x.torrent", "http://b/x.torrent"}, m.ExactSource)
+	assert.Equal(t, []string{"http://c/x.torrent"}, m.AcceptableSource)
+	assert.EqualValues(t, url.Values{"kt": {"x"}}, m.Params)
+	assert.Equal(t, uri, m.String())
+
+	mi := MetaInfo{InfoBytes: []byte("d4:name1:xe")}
+	m = mi.MagnetWithOpts(MagnetOpts{ExactSources: []string{"http://a/x.torrent"}})
+	assert.Equal(t, []string{"http://a/x.torrent"}, m.ExactSource)
+	assert.Contains(t, m.String(), "&xs=http%3A%2F%2Fa%2Fx.torrent")
+}
+
+func TestMagnetMutable(t *testing.T) {
+	const pk = "8543d3e6115f0f98c944077a4493dcd543e49c739fd998550a1f614ab36ed63e"
+	uri := "magnet:?xs=urn:btpk:" + pk + "&xs=http%3A%2F%2Fa%2Fx.torrent&s=73616c74"
+	m, err := ParseMagnetUri(uri)
+	require.NoError(t, err)
+	assert.True(t, m.IsMutable())
+	assert.Equal(t, pk, hex.EncodeToString(m.PublicKey[:]))
+	assert.Equal(t, []byte("salt"), m.Salt)
+	assert.Equal(t, []string{"http://a/x.torrent"}, m.ExactSource)
+	assert.True(t, m.InfoHash == Hash{})
+	assert.Nil(t, m.Params)
+	assert.Equal(t, uri, m.String())
+
+	// The infohash it last pointed to can be included.
+	withXt := "magnet:?xt=urn:btih:51340689c960f0778a4387aef9b4b52fd08390cd&xs=urn:btpk:" + pk
+	m, err = ParseMagnetUri(withXt)
+	require.NoError(t, err)
+	assert.True(t, m.IsMutable())
+	assert.Nil(t, m.Salt)
+	assert.Equal(t, withXt, m.String())
+
+	for _, bad := range []string{
+		"magnet:?xs=urn:btpk:" + pk[:62],
+		"magnet:?xs=urn:btpk:zz" + pk[2:],
+		"magnet:?xs=urn:btpk:" + pk + "&s=zz",
+		"magnet:?xs=http%3A%2F%2Fa%2Fx.torrent",
+	} {
+		_, err := ParseMagnetUri(bad)
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestMagnetPeers(t *testing.T) {
+	const xt = "magnet:?xt=urn:btih:51340689c960f0778a4387aef9b4b52fd08390cd"
+	m, err := ParseMagnetUri(xt +
+		"&x.pe=1.2.3.4%3A6881&x.pe=%5B2001%3Adb8%3A%3A1%5D%3A6881&x.pe=2001%3Adb8%3A%3A2%3A6882&x.pe=peer.example.com%3A1")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1.2.3.4:6881", "[2001:db8::1]:6881", "[2001:db8::2]:6882", "peer.example.com:1"}, m.Peers)
+	assert.Nil(t, m.Params)
+	for _, pe := range []string{"1.2.3.4", "1.2.3.4:0", "1.2.3.4:65536", ":6881", "bad host:6881", "[::1:6881"} {
+		m, err := ParseMagnetUri(xt + "&x.pe=" + url.QueryEscape(pe))
+		require.NoError(t, err, pe)
+		assert.Empty(t, m.Peers, pe)
+		assert.Equal(t, []string{pe}, m.Params["x.pe"], pe)
+	}
+	// A bad address doesn't lose the good ones.
+	m, err = ParseMagnetUri(xt + "&x.pe=1.2.3.4%3A6881&x.pe=bad%3A0")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1.2.3.4:6881"}, m.Peers)
+	assert.Equal(t, url.Values{"x.pe": {"bad:0"}}, m.Params)
+
+	mi := MetaInfo{InfoBytes: []byte("d4:name1:xe")}
+	m = mi.MagnetWithOpts(MagnetOpts{Peers: []string{"[::1]:6881"}})
+	assert.Contains(t, m.String(), "&x.pe=%5B%3A%3A1%5D%3A6881")
+	parsed, err := ParseMagnetUri(m.String())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"[::1]:6881"}, parsed.Peers)
+}
+
+func TestMagnetGoldenStrings(t *testing.T) {
+	for _, tc := range []struct {
+		file, magnet string
+	}{
+		{
+			"../testdata/bootstrap.dat.torrent",
+			"magnet:?xt=urn:btih:36719ba2cecf9f3bd7c5abfb7a88e939611b536c&dn=bootstrap.dat" +
+				"&tr=udp%3A%2F%2Ftracker.openbittorrent.com%3A80&tr=udp%3A%2F%2Ftracker.publicbt.com%3A80" +
+				"&tr=udp%3A%2F%2Fcoppersurfer.tk%3A6969%2Fannounce&tr=udp%3A%2F%2Fopen.demonii.com%3A1337" +
+				"&tr=http%3A%2F%2Fbttracker.crunchbanglinux.org%3A6969%2Fannounce",
+		},
+		{
+			"testdata/SKODAOCTAVIA336x280_archive.torrent",
+			"magnet:?xt=urn:btih:d4b197dff199aad447a9a352e31528adbbd97922&dn=SKODAOCTAVIA336x280" +
+				"&tr=http%3A%2F%2Fbt1.archive.org%3A6969%2Fannounce&tr=http%3A%2F%2Fbt2.archive.org%3A6969%2Fannounce" +
+				"&ws=https%3A%2F%2Farchive.org%2Fdownload%2F&ws=http%3A%2F%2Fia601600.us.archive.org%2F26%2Fitems%2F" +
+				"&ws=http%3A%2F%2Fia801600.us.archive.org%2F26%2Fitems%2F",
+		},
+		{
+			"testdata/hybrid.torrent",
+			"magnet:?xt=urn:btih:8133052cff3e133aca802ac1892220949a075369" +
+				"&xt=urn:btmh:1220eb741e50250eac9606f108aadb3886ddfc237c51421fdae69d3c9a241a5ea743" +
+				"&dn=hybrid&tr=http%3A%2F%2Fexample.com%2Fannounce",
+		},
+	} {
+		mi, err := LoadFromFile(tc.file)
+		require.NoError(t, err)
+		info, err := mi.UnmarshalInfo()
+		require.NoError(t, err)
+		for i := 0; i < 3; i++ {
+			assert.Equal(t, tc.magnet, mi.Magnet(nil, &info).String(), tc.file)
+		}
+		m, err := ParseMagnetUri(tc.magnet)
+		require.NoError(t, err)
+		assert.EqualValues(t, mi.Magnet(nil, &info), m, tc.file)
+	}
+}
+
+func TestMagnetStringRoundTrip(t *testing.T) {
+	v2 := HashBytesV2([]byte("x"))
+	for _, m := range []Magnet{
+		exampleMagnet,
+		{InfoHashV2: &v2, DisplayName: "a b+c&d=e/f:g"},
+		{
+			InfoHash:         exampleMagnet.InfoHash,
+			InfoHashV2:       &v2,
+			Trackers:         []string{"udp://b:1", "http://a/announce?x=1&y=2"},
+			ExactSource:      []string{"http://a/x.torrent"},
+			AcceptableSource: []string{"http://b/x.torrent"},
+			Peers:            []string{"[::1]:6881", "1.2.3.4:6881"},
+			Params: url.Values{
+				"ws": {"http://c/"},
+				"xt": {"urn:sha1:YNCKHTQCWBTRNJIV4WNAE52SJUQCZO5C"},
+				"kt": {"b", "a"},
+			},
+			SelectOnly: SelectOnly{Ranges: []IndexRange{{0, 2}, {5, 5}}, Invalid: []string{"x"}},
+		},
+	} {
+		s := m.String()
+		parsed, err := ParseMagnetUri(s)
+		require.NoError(t, err, s)
+		assert.EqualValues(t, m, parsed, s)
+		assert.Equal(t, s, parsed.String())
+	}
+}
+
+func TestMagnetStringEscaping(t *testing.T) {
+	m := Magnet{DisplayName: "a b+c", Params: url.Values{"z": {"1"}, "kt": {"x y"}}}
+	assert.Equal(t,
+		"magnet:?xt=urn:btih:0000000000000000000000000000000000000000&dn=a%20b%2Bc&kt=x%20y&z=1",
+		m.String())
+}
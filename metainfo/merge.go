@@ -0,0 +1,87 @@
+package metainfo
+
+import (
+	"fmt"
+
+	"github.com/anacrolix/torrent/bencode"
+)
+
+// Combines two MetaInfos for the same info, such as from different trackers. The trackers, webseeds
+// and nodes of both are kept, without duplicates, with a's first. The earliest creation date is
+// kept, and a's other fields are preferred where they're set. Neither argument is modified. It's an
+// error if the infohashes differ.
+func Merge(a, b *MetaInfo) (*MetaInfo, error) {
+	if a.HashInfoBytes() != b.HashInfoBytes() {
+		return nil, fmt.Errorf("infohashes differ: %v and %v", a.HashInfoBytes(), b.HashInfoBytes())
+	}
+	ret := &MetaInfo{
+		InfoBytes:    a.InfoBytes,
+		CreationDate: a.CreationDate,
+		Comment:      firstNonEmpty(a.Comment, b.Comment),
+		CreatedBy:    firstNonEmpty(a.CreatedBy, b.CreatedBy),
+		Encoding:     firstNonEmpty(a.Encoding, b.Encoding),
+		NodesAsPairs: a.NodesAsPairs || len(a.Nodes) == 0 && b.NodesAsPairs,
+	}
+	if b.CreationDate != 0 && (ret.CreationDate == 0 || b.CreationDate < ret.CreationDate) {
+		ret.CreationDate = b.CreationDate
+	}
+	tiers := append(a.UpvertedAnnounceList().Clone(), b.UpvertedAnnounceList()...)
+	if len(tiers) != 0 {
+		ret.SetAnnounceList(tiers)
+	}
+	for _, mi := range []*MetaInfo{a, b} {
+		for _, url := range mi.UrlList {
+			ret.AddWebSeed(url)
+		}
+		for _, url := range mi.HttpSeeds {
+			ret.HttpSeeds = appendMissingString(ret.HttpSeeds, url)
+		}
+		for _, n := range mi.Nodes {
+			ret.Nodes = appendMissingNode(ret.Nodes, n)
+		}
+		for k, v := range mi.PieceLayers {
+			if _, ok := ret.PieceLayers[k]; !ok {
+				if ret.PieceLayers == nil {
+					ret.PieceLayers = make(map[string]string)
+				}
+				ret.PieceLayers[k] = v
+			}
+		}
+		for k, v := range mi.UnknownFields {
+			if _, ok := ret.UnknownFields[k]; !ok {
+				if ret.UnknownFields == nil {
+					ret.UnknownFields = make(map[string]bencode.Bytes)
+				}
+				ret.UnknownFields[k] = v
+			}
+		}
+	}
+	return ret, nil
+}
+
+func firstNonEmpty(ss ...string) string {
+	for _, s := range ss {
+		if s != "" {
+			return s
+		}
+	}
+	return ""
+}
+
+func appendMissingString(ss []string, s string) []string {
+	for _, have := range ss {
+		if have == s {
+			return ss
+		}
+	}
+	return append(ss, s)
+}
+
+func appendMissingNode(nodes []Node, n Node) []Node {
+	for _, have := range nodes {
+		if have == n {
+			return nodes
+		}
+	}
+	return append(nodes, n)
+}
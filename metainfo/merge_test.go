@@ -0,0 +1,81 @@
+package metainfo
+
+import (
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+	"github.com/google/go-cmp/cmp/cmpopts"
+
+	"github.com/anacrolix/torrent/bencode"
+)
+
+// MetaInfos are compared without their cached Info.
+var metaInfoEquals = qt.CmpEquals(cmpopts.IgnoreUnexported(MetaInfo{}))
+
+func TestMerge(t *testing.T) {
+	c := qt.New(t)
+	info := bencode.MustMarshal(Info{Name: "a", PieceLength: 1})
+	a := MetaInfo{
+		InfoBytes:    info,
+		Announce:     "http://a/announce",
+		AnnounceList: AnnounceList{{"http://a/announce", "http://b/announce"}},
+		Nodes:        []Node{"a:1"},
+		CreationDate: 2000,
+		UrlList:      UrlList{"http://a/ws"},
+		HttpSeeds:    UrlList{"http://a/seed"},
+		UnknownFields: map[string]bencode.Bytes{
+			"x": bencode.Bytes("1:a"),
+		},
+	}
+	b := MetaInfo{
+		InfoBytes:    info,
+		AnnounceList: AnnounceList{{"http://b/announce", "http://c/announce"}, {"http://a/announce"}},
+		Nodes:        []Node{"b:2", "a:1"},
+		CreationDate: 1000,
+		Comment:      "from b",
+		CreatedBy:    "b",
+		UrlList:      UrlList{"http://b/ws", "http://a/ws"},
+		HttpSeeds:    UrlList{"http://a/seed", "http://b/seed"},
+		UnknownFields: map[string]bencode.Bytes{
+			"x": bencode.Bytes("1:b"),
+			"y": bencode.Bytes("1:b"),
+		},
+	}
+	aBefore := a
+	merged, err := Merge(&a, &b)
+	c.Assert(err, qt.IsNil)
+	c.Check(merged, metaInfoEquals, &MetaInfo{
+		InfoBytes:    info,
+		Announce:     "http://a/announce",
+		AnnounceList: AnnounceList{{"http://a/announce", "http://b/announce"}, {"http://c/announce"}},
+		Nodes:        []Node{"a:1", "b:2"},
+		CreationDate: 1000,
+		Comment:      "from b",
+		CreatedBy:    "b",
+		UrlList:      UrlList{"http://a/ws", "http://b/ws"},
+		HttpSeeds:    UrlList{"http://a/seed", "http://b/seed"},
+		UnknownFields: map[string]bencode.Bytes{
+			"x": bencode.Bytes("1:a"),
+			"y": bencode.Bytes("1:b"),
+		},
+	})
+	c.Check(a, metaInfoEquals, aBefore)
+
+	a.CreationDate = 0
+	a.Comment = "from a"
+	merged, err = Merge(&a, &b)
+	c.Assert(err, qt.IsNil)
+	c.Check(merged.CreationDate, qt.Equals, int64(1000))
+	c.Check(merged.Comment, qt.Equals, "from a")
+	merged, err = Merge(&MetaInfo{InfoBytes: info}, &MetaInfo{InfoBytes: info})
+	c.Assert(err, qt.IsNil)
+	c.Check(merged, metaInfoEquals, &MetaInfo{InfoBytes: info})
+}
+
+func TestMergeDifferentInfoHashes(t *testing.T) {
+	c := qt.New(t)
+	a := MetaInfo{InfoBytes: bencode.MustMarshal(Info{Name: "a", PieceLength: 1})}
+	b := MetaInfo{InfoBytes: bencode.MustMarshal(Info{Name: "b", PieceLength: 1})}
+	_, err := Merge(&a, &b)
+	c.Check(err, qt.ErrorMatches, "infohashes differ: .* and .*")
+}
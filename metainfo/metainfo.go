@@ -2,12 +2,17 @@ package metainfo
 
 import (
 	"bytes"
+	"fmt"
 	"io"
 	"net/url"
 	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
-	gobencode "github.com/IncSW/go-bencode"
 	"github.com/anacrolix/torrent/bencode"
 )
 
@@ -24,162 +29,173 @@ type MetaInfo struct {
 	CreatedBy    string  `bencode:"created by,omitempty"`
 	Encoding     string  `bencode:"encoding,omitempty"`
 	UrlList      UrlList `bencode:"url-list,omitempty"` // BEP 19
-}
+	// Webseeds that serve pieces by infohash and index, rather than files. BEP 17.
+	HttpSeeds UrlList `bencode:"httpseeds,omitempty"`
+	// Maps the pieces root of each file in a v2 info to the concatenated hashes of the layer of its
+	// merkle tree with one node per piece. BEP 52.
+	PieceLayers map[string]string `bencode:"piece layers,omitempty"`
+	// Top-level keys that aren't handled by the fields above, so that they survive a round trip.
+	// Known fields take precedence over these when encoding.
+	UnknownFields map[string]bencode.Bytes `bencode:"-"`
+	// Whether Nodes are encoded as [host, port] pairs, as in BEP 5, rather than as strings. It's set
+	// when decoding, so that the style survives a round trip.
+	NodesAsPairs bool `bencode:"-"`
 
-// Load a MetaInfo from an io.Reader. Returns a non-nil error in case of
-// failure.
-func Load(r io.Reader) (*MetaInfo, error) {
-	var mi MetaInfo
-	d := bencode.NewDecoder(r)
-	err := d.Decode(&mi)
-	if err != nil {
-		return nil, err
-	}
-	return &mi, nil
+	// The decoded info for Info. It's set by the loaders and SetInfoBytes, and copies of the MetaInfo
+	// share it.
+	infoCache *infoCache
 }
 
-func LoadBytes(bts []byte) (*MetaInfo, error) {
-	if mi, err := Load(bytes.NewBuffer(bts)); err != nil {
-		if nbts := newBts(bts); nbts != nil {
-			return Load(bytes.NewBuffer(nbts))
-		}
-		return mi, err
-	} else {
-		return mi, err
-	}
-}
-
-func newBts(rb []byte) (bts []byte) {
-	defer func() {
-		_ = recover()
-	}()
-	decode, err := gobencode.Unmarshal(rb)
-	if err != nil || decode == nil {
-		return nil
-	}
-	switch decode.(type) {
-	case map[string]interface{}:
-		miDe := decode.(map[string]interface{})
-		ifAnnounce := miDe["announce"]
-		ifAnnounceList := miDe["announce-list"]
-		ifCreationDate := miDe["creation date"]
-		ifComment := miDe["comment"]
-		ifCreatedBy := miDe["created by"]
-		ifEncoding := miDe["encoding"]
-		ifUrlList := miDe["url-list"]
-		ifInfoBytes := miDe["info"]
-
-		mi := &MetaInfo{}
-
-		if ifAnnounce != nil {
-			mi.Announce = string(ifAnnounce.([]uint8))
-		}
-		if ifAnnounceList != nil {
-			var announceList [][]string
-			for _, v := range ifAnnounceList.([]interface{}) {
-				announceList = append(announceList, []string{string(v.([]uint8))})
-			}
-			mi.AnnounceList = announceList
-		}
-		if ifCreationDate != nil {
-			mi.CreationDate = ifCreationDate.(int64)
-		}
-		if ifComment != nil {
-			mi.Comment = string(ifComment.([]uint8))
+// The MetaInfo fields with the default struct bencoding.
+type metaInfoFields MetaInfo
+
+// The keys of the MetaInfo fields.
+var metaInfoKeys = func() map[string]struct{} {
+	ret := make(map[string]struct{})
+	t := reflect.TypeOf(metaInfoFields{})
+	for i := 0; i < t.NumField(); i++ {
+		key := strings.Split(t.Field(i).Tag.Get("bencode"), ",")[0]
+		if key != "-" {
+			ret[key] = struct{}{}
 		}
-		if ifCreatedBy != nil {
-			mi.CreatedBy = string(ifCreatedBy.([]uint8))
+	}
+	return ret
+}()
+
+var (
+	_ bencode.Marshaler   = MetaInfo{}
+	_ bencode.Unmarshaler = (*MetaInfo)(nil)
+)
+
+func (mi *MetaInfo) UnmarshalBencode(b []byte) (err error) {
+	d := bencode.NewDecoder(bytes.NewReader(b))
+	// Creation dates too large for an int64 get the latest one instead.
+	d.OnClamp = func(*bencode.DecodeError) {}
+	err = d.Decode((*metaInfoFields)(mi))
+	if err != nil {
+		return
+	}
+	var raw map[string]bencode.Bytes
+	err = bencode.Unmarshal(b, &raw)
+	if err != nil {
+		return
+	}
+	mi.UnknownFields = nil
+	mi.NodesAsPairs = false
+	if b, ok := raw["nodes"]; ok {
+		var nodes interface{}
+		// The nodes already decoded, so this can't fail.
+		bencode.Unmarshal(b, &nodes)
+		l, _ := nodes.([]interface{})
+		mi.NodesAsPairs = nodesArePairs(l)
+	}
+	if b, ok := raw["creation date"]; ok {
+		// Some torrents have the date as a string of digits. Any other type is ignored.
+		var s string
+		if bencode.Unmarshal(b, &s) == nil {
+			mi.CreationDate, _ = parseCreationDate(s)
 		}
-		if ifEncoding != nil {
-			mi.Encoding = string(ifEncoding.([]uint8))
+	}
+	for k, v := range raw {
+		if _, ok := metaInfoKeys[k]; ok {
+			continue
 		}
-		if ifUrlList != nil {
-			var urlList []string
-			for _, v := range ifUrlList.([]interface{}) {
-				urlList = append(urlList, string(v.([]uint8)))
-			}
-			mi.UrlList = urlList
+		if mi.UnknownFields == nil {
+			mi.UnknownFields = make(map[string]bencode.Bytes)
 		}
+		mi.UnknownFields[k] = v
+	}
+	return
+}
 
-		if ifInfoBytes != nil {
-			info := &Info{}
-			switch ifInfoBytes.(type) {
-			case map[string]interface{}:
-				infoDe := ifInfoBytes.(map[string]interface{})
-				ifInfoPieceLength := infoDe["piece length"]
-				ifInfoPieces := infoDe["pieces"]
-				ifInfoName := infoDe["name"]
-				ifInfoLength := infoDe["length"]
-				ifInfoPrivate := infoDe["private"]
-				ifInfoSource := infoDe["source"]
-				ifInfoFiles := infoDe["files"]
-
-				if ifInfoPieceLength != nil {
-					info.PieceLength = ifInfoPieceLength.(int64)
-				}
-				if ifInfoPieces != nil {
-					info.Pieces = ifInfoPieces.([]uint8)
-				} else {
-					return nil
-				}
-				if ifInfoName != nil {
-					info.Name = string(ifInfoName.([]uint8))
-				}
-				if ifInfoLength != nil {
-					info.Length = ifInfoLength.(int64)
-				}
-				if ifInfoPrivate != nil {
-					p := (ifInfoPrivate.(int64) == 1)
-					info.Private = &p
-				}
-				if ifInfoSource != nil {
-					info.Source = string(ifInfoSource.([]uint8))
-				}
-				if ifInfoFiles != nil {
-					switch ifInfoFiles.(type) {
-					case []interface{}:
-						var files []FileInfo
-						for _, v := range ifInfoFiles.([]interface{}) {
-							switch v.(type) {
-							case map[string]interface{}:
-								fl := v.(map[string]interface{})
-								ifFileLength := fl["length"]
-								ifFilePath := fl["path"]
-
-								var lt int64
-								if ifFileLength != nil {
-									lt = ifFileLength.(int64)
-								}
-								if ifFilePath != nil {
-									var fls []string
-									switch ifFilePath.(type) {
-									case []interface{}:
-										for _, w := range ifFilePath.([]interface{}) {
-											fls = append(fls, string(w.([]uint8)))
-										}
-									}
-									if len(fls) > 0 {
-										files = append(files, FileInfo{Length: lt, Path: fls})
-									}
-								}
-							}
-						}
-						info.Files = files
-					}
-				}
-				if infobts, err := bencode.Marshal(&info); err == nil {
-					mi.InfoBytes = infobts
-				}
+func (mi MetaInfo) MarshalBencode() ([]byte, error) {
+	b, err := bencode.Marshal(metaInfoFields(mi))
+	pairs := mi.NodesAsPairs && len(mi.Nodes) != 0
+	if err != nil || len(mi.UnknownFields) == 0 && !pairs {
+		return b, err
+	}
+	entries, err := dictEntries(b)
+	if err != nil {
+		return nil, err
+	}
+	known := len(entries)
+	for i := range entries {
+		if pairs && string(entries[i].key) == "nodes" {
+			entries[i].value, err = bencode.Marshal(nodePairs(mi.Nodes))
+			if err != nil {
+				return nil, err
 			}
-		} else {
-			return nil
 		}
+	}
+	for k, v := range mi.UnknownFields {
+		i := sort.Search(known, func(i int) bool { return string(entries[i].key) >= k })
+		if i == known || string(entries[i].key) != k {
+			entries = append(entries, dictEntry{[]byte(k), v})
+		}
+	}
+	sort.Sort(dictEntriesByKey(entries))
+	ret := make([]byte, 0, len(b)+len(entries)*16)
+	ret = append(ret, 'd')
+	for _, e := range entries {
+		ret = strconv.AppendInt(ret, int64(len(e.key)), 10)
+		ret = append(ret, ':')
+		ret = append(append(ret, e.key...), e.value...)
+	}
+	return append(ret, 'e'), nil
+}
+
+// A key and encoded value of a dict.
+type dictEntry struct {
+	key   []byte
+	value []byte
+}
+
+// Sorts dictEntry by key.
+type dictEntriesByKey []dictEntry
 
-		if nbts, err := bencode.Marshal(&mi); err == nil {
-			return nbts
+func (me dictEntriesByKey) Len() int           { return len(me) }
+func (me dictEntriesByKey) Less(i, j int) bool { return bytes.Compare(me[i].key, me[j].key) < 0 }
+func (me dictEntriesByKey) Swap(i, j int)      { me[i], me[j] = me[j], me[i] }
+
+// Returns the entries of the encoded dict b, in order. The values are slices of b.
+func dictEntries(b []byte) (entries []dictEntry, err error) {
+	d := bencode.NewDecoder(bytes.NewReader(b))
+	tok, err := d.NextToken()
+	if err != nil {
+		return
+	}
+	if tok.Kind != bencode.DictStart {
+		return nil, fmt.Errorf("expected a dict, got %v", tok.Kind)
+	}
+	for {
+		tok, err = d.NextToken()
+		if err != nil || tok.Kind == bencode.DictEnd {
+			return
+		}
+		key := b[d.Offset-int64(len(tok.Bytes)) : d.Offset]
+		start := d.Offset
+		if err = d.SkipValue(); err != nil {
+			return
 		}
+		entries = append(entries, dictEntry{key, b[start:d.Offset]})
 	}
-	return nil
+}
+
+// Load a MetaInfo from an io.Reader. Returns a non-nil error in case of
+// failure. The default limits in LoadOpts apply.
+func Load(r io.Reader) (*MetaInfo, error) {
+	return LoadWithOpts(r, LoadOpts{})
+}
+
+// Like Load, but rejects data that isn't canonically encoded. See LoadOpts.Strict.
+func LoadStrict(r io.Reader) (*MetaInfo, error) {
+	return LoadWithOpts(r, LoadOpts{Strict: true})
+}
+
+// Like Load, but if the data doesn't decode strictly, what can be recovered from it is loaded and
+// returned along with a RepairedError. Duplicate dict keys are reported that way too.
+func LoadBytes(bts []byte) (*MetaInfo, error) {
+	return loadBytes(bts, LoadOpts{AllowRepair: true}.withDefaults())
 }
 
 // Convenience function for loading a MetaInfo from a file.
@@ -192,54 +208,232 @@ func LoadFromFile(filename string) (*MetaInfo, error) {
 	return Load(f)
 }
 
+// Decodes the info bytes into a new Info each time. See Info for a cached Info that's shared. A
+// *bencode.DecodeError has a path from the metainfo, like "info.files[3].length", but its offset is
+// into the info bytes.
 func (mi MetaInfo) UnmarshalInfo() (info Info, err error) {
-	err = bencode.Unmarshal(mi.InfoBytes, &info)
+	err = unmarshalInfo(mi.InfoBytes, &info)
 	return
 }
 
+func unmarshalInfo(b []byte, info *Info) error {
+	err := bencode.Unmarshal(b, info)
+	if de, ok := err.(*bencode.DecodeError); ok {
+		ret := *de
+		ret.Path = "info"
+		if de.Path != "" {
+			ret.Path += "." + de.Path
+		}
+		return &ret
+	}
+	return err
+}
+
+// Returns the decoded info bytes, decoding them at most once for MetaInfos that are loaded or have
+// their info bytes set with SetInfoBytes. The Info is shared with other callers and copies of the
+// MetaInfo, and must not be modified. Use UnmarshalInfo for a copy to modify. The cache is keyed on
+// the info bytes slice, so if InfoBytes is assigned directly, they're decoded on every call until
+// SetInfoBytes is used. The info bytes must not be modified in place without passing them to
+// SetInfoBytes again, or the stale Info is returned. It's safe to call concurrently.
+func (mi *MetaInfo) Info() (*Info, error) {
+	c := mi.infoCache
+	infoBytes := mi.InfoBytes
+	if c == nil || !sameBytes(infoBytes, c.infoBytes) {
+		info, err := mi.UnmarshalInfo()
+		return &info, err
+	}
+	c.once.Do(func() {
+		c.info = new(Info)
+		c.err = unmarshalInfo(infoBytes, c.info)
+	})
+	return c.info, c.err
+}
+
+// Sets the info bytes, and resets the Info cached for them.
+func (mi *MetaInfo) SetInfoBytes(b []byte) {
+	mi.InfoBytes = b
+	mi.infoCache = &infoCache{infoBytes: b}
+}
+
+// Whether a and b are the same slice of the same array.
+func sameBytes(a, b []byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	return len(a) == 0 || &a[0] == &b[0]
+}
+
+type infoCache struct {
+	// The info bytes the cache is for. If InfoBytes is another slice, the cache is stale.
+	infoBytes []byte
+	once      sync.Once
+	info      *Info
+	err       error
+}
+
 func (mi MetaInfo) HashInfoBytes() (infoHash Hash) {
 	return HashBytes(mi.InfoBytes)
 }
 
+// Returns the v2 infohash, and whether the info dict declares v2 support with a meta version of 2
+// or greater. BEP 52.
+func (mi MetaInfo) HashInfoBytesV2() (infoHash Hash32, ok bool) {
+	var info struct {
+		MetaVersion int64 `bencode:"meta version"`
+	}
+	if bencode.Unmarshal(mi.InfoBytes, &info) != nil || info.MetaVersion < 2 {
+		return
+	}
+	return HashBytesV2(mi.InfoBytes), true
+}
+
+// Returns the v2 infohash truncated to 20 bytes, as used to announce a v2 or hybrid torrent to
+// trackers and peers.
+func (mi MetaInfo) HashInfoBytesV2Truncated() (infoHash Hash, ok bool) {
+	v2, ok := mi.HashInfoBytesV2()
+	return v2.Truncated(), ok
+}
+
 // Encode to bencoded form.
 func (mi MetaInfo) Write(w io.Writer) error {
 	return bencode.NewEncoder(w).Encode(mi)
 }
 
-// Set good default values in preparation for creating a new MetaInfo file.
+// Returns the creation date, and whether it's set.
+func (mi *MetaInfo) CreationTime() (time.Time, bool) {
+	if mi.CreationDate == 0 {
+		return time.Time{}, false
+	}
+	return time.Unix(mi.CreationDate, 0), true
+}
+
+// Sets the creation date, to the second. The zero time clears it.
+func (mi *MetaInfo) SetCreationTime(t time.Time) {
+	if t.IsZero() {
+		mi.CreationDate = 0
+		return
+	}
+	mi.CreationDate = t.Unix()
+}
+
+// Parses a creation date that was encoded as a string of Unix seconds.
+func parseCreationDate(s string) (int64, bool) {
+	i, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+	return i, err == nil
+}
+
+// The CreatedBy set by SetDefaults and SetDefaultsOpts.
+const DefaultCreatedBy = "github.com/anacrolix/torrent"
+
+// Set good default values in preparation for creating a new MetaInfo file. The comment is cleared,
+// and the creator and creation date are replaced.
+//
+// Deprecated: Use SetDefaultsOpts, which leaves fields that are already set alone.
 func (mi *MetaInfo) SetDefaults() {
 	mi.Comment = ""
-	mi.CreatedBy = "github.com/anacrolix/torrent"
+	mi.CreatedBy = DefaultCreatedBy
 	mi.CreationDate = time.Now().Unix()
-	// mi.Info.PieceLength = 256 * 1024
 }
 
-// Creates a Magnet from a MetaInfo. Optional infohash and parsed info can be provided.
+type SetDefaultsOpts struct {
+	// The creator to set. DefaultCreatedBy if empty.
+	CreatedBy string
+	// Returns the creation date to set. time.Now if nil, and can be fixed for reproducible output.
+	Now func() time.Time
+}
+
+// Sets the creator and creation date for a new MetaInfo file, where they aren't already set. The
+// MetaInfo is returned, for chaining.
+func (mi *MetaInfo) SetDefaultsOpts(opts SetDefaultsOpts) *MetaInfo {
+	if mi.CreatedBy == "" {
+		mi.CreatedBy = opts.CreatedBy
+		if mi.CreatedBy == "" {
+			mi.CreatedBy = DefaultCreatedBy
+		}
+	}
+	if mi.CreationDate == 0 {
+		now := time.Now
+		if opts.Now != nil {
+			now = opts.Now
+		}
+		mi.CreationDate = now().Unix()
+	}
+	return mi
+}
+
+// Creates a Magnet from a MetaInfo. Optional infohash and parsed info can be provided. If the info
+// declares v2 support, the v2 infohash is included too, and the v1 infohash is left out unless the
+// info is hybrid.
 func (mi *MetaInfo) Magnet(infoHash *Hash, info *Info) (m Magnet) {
-	for t := range mi.UpvertedAnnounceList().DistinctValues() {
-		m.Trackers = append(m.Trackers, t)
+	return mi.MagnetWithOpts(MagnetOpts{InfoHash: infoHash, Info: info})
+}
+
+type MagnetOpts struct {
+	// Used instead of the hash of the info bytes, if not nil.
+	InfoHash *Hash
+	// The parsed info, if available. The display name is taken from it.
+	Info *Info
+	// URLs where the .torrent file can be fetched, included as "xs" values.
+	ExactSources []string
+	// Addresses of peers to connect to directly, such as our own, included as "x.pe" values.
+	Peers []string
+	// The files to download, included as the "so" value. See SelectOnlyIndices.
+	SelectOnly SelectOnly
+}
+
+// Like Magnet, with more options.
+func (mi *MetaInfo) MagnetWithOpts(opts MagnetOpts) (m Magnet) {
+	m.Trackers = mi.UpvertedAnnounceListMerged().OrderedDistinctValues()
+	if opts.Info != nil {
+		m.DisplayName = opts.Info.Name
 	}
-	if info != nil {
-		m.DisplayName = info.Name
+	if v2, ok := mi.HashInfoBytesV2(); ok {
+		m.InfoHashV2 = &v2
 	}
-	if infoHash != nil {
-		m.InfoHash = *infoHash
-	} else {
+	if opts.InfoHash != nil {
+		m.InfoHash = *opts.InfoHash
+	} else if m.InfoHashV2 == nil || mi.infoHasV1(opts.Info) {
 		m.InfoHash = mi.HashInfoBytes()
 	}
-	m.Params = make(url.Values)
-	m.Params["ws"] = mi.UrlList
+	m.ExactSource = append([]string(nil), opts.ExactSources...)
+	m.Peers = append([]string(nil), opts.Peers...)
+	m.SelectOnly = opts.SelectOnly
+	// Magnet links don't distinguish BEP 17 webseeds.
+	if ws := append(append([]string(nil), mi.UrlList...), mi.HttpSeeds...); len(ws) != 0 {
+		m.Params = url.Values{"ws": ws}
+	}
 	return
 }
 
+// info is decoded from the info bytes if it's nil. Undecodable infos are assumed to be v1.
+func (mi *MetaInfo) infoHasV1(info *Info) bool {
+	if info == nil {
+		decoded, err := mi.Info()
+		if err != nil {
+			return true
+		}
+		info = decoded
+	}
+	return info.HasV1()
+}
+
 // Returns the announce list converted from the old single announce field if
-// necessary.
+// necessary. The result is a normalized copy, as by AnnounceList.Normalize.
 func (mi *MetaInfo) UpvertedAnnounceList() AnnounceList {
-	if mi.AnnounceList.OverridesAnnounce(mi.Announce) {
-		return mi.AnnounceList
+	if al := mi.AnnounceList.normalized(); len(al) != 0 {
+		return al
 	}
-	if mi.Announce != "" {
-		return [][]string{{mi.Announce}}
+	return AnnounceList{{mi.Announce}}.normalized()
+}
+
+// Like UpvertedAnnounceList, but Announce isn't dropped when AnnounceList is present. If it's not in
+// any tier, it's added as a tier of its own before the others. BEP 12 says Announce should be
+// ignored in that case, so this is for listing every tracker, not for announcing.
+func (mi *MetaInfo) UpvertedAnnounceListMerged() AnnounceList {
+	al := mi.AnnounceList.normalized()
+	announce := AnnounceList{{mi.Announce}}.normalized()
+	if len(announce) == 0 || al.contains(announce[0][0]) {
+		return al
 	}
-	return nil
+	return append(announce, al...)
 }
@@ -1,13 +1,19 @@
 package metainfo
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"io"
 	"io/ioutil"
+	"math"
+	"math/rand"
 	"os"
 	"path"
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/anacrolix/missinggo"
 	qt "github.com/frankban/quicktest"
@@ -48,6 +54,8 @@ func TestFile(t *testing.T) {
 	testFile(t, "testdata/continuum.torrent")
 	testFile(t, "testdata/23516C72685E8DB0C8F15553382A927F185C4F01.torrent")
 	testFile(t, "testdata/trackerless.torrent")
+	testFile(t, "testdata/hybrid.torrent")
+	testFile(t, "testdata/gbk-utf8-alternates.torrent")
 }
 
 // Ensure that the correct number of pieces are generated when hashing files.
@@ -101,6 +109,70 @@ func TestBuildFromFilePathOrder(t *testing.T) {
 	}}, info.Files)
 }
 
+// Creates the files below root, keyed by slash-separated path, and the directories they're in.
+func writeTreeFiles(c *qt.C, root string, files map[string][]byte) {
+	for p, data := range files {
+		name := filepath.Join(root, filepath.FromSlash(p))
+		c.Assert(os.MkdirAll(filepath.Dir(name), 0o700), qt.IsNil)
+		c.Assert(ioutil.WriteFile(name, data, 0o600), qt.IsNil)
+	}
+}
+
+// Files at the paths for writeTreeFiles, with content derived from the path.
+func pathFiles(paths ...string) map[string][]byte {
+	ret := make(map[string][]byte, len(paths))
+	for _, p := range paths {
+		ret[p] = []byte(strings.Repeat(p, 3))
+	}
+	return ret
+}
+
+// The same content must give the same info bytes however the directory entries were created.
+func TestBuildFromFilePathOptsDeterministic(t *testing.T) {
+	c := qt.New(t)
+	paths := []string{"a.b", "a/b", "a/a", "c/d/e", "b", "a-b"}
+	rand.New(rand.NewSource(1)).Shuffle(len(paths), func(i, j int) {
+		paths[i], paths[j] = paths[j], paths[i]
+	})
+	var infoBytes []string
+	for i := 0; i < 2; i++ {
+		root := filepath.Join(c.Mkdir(), "root")
+		// One at a time, so the entries are created in the order given.
+		for _, p := range paths {
+			writeTreeFiles(c, root, pathFiles(p))
+		}
+		info := Info{PieceLength: 16384}
+		_, err := info.BuildFromFilePathOpts(context.Background(), root, BuildFromFilePathOpts{})
+		c.Assert(err, qt.IsNil)
+		var filePaths []string
+		for _, fi := range info.Files {
+			filePaths = append(filePaths, strings.Join(fi.Path, "/"))
+		}
+		c.Check(filePaths, qt.DeepEquals, []string{"a/a", "a/b", "a-b", "a.b", "b", "c/d/e"})
+		infoBytes = append(infoBytes, string(bencode.MustMarshal(info)))
+		// Reverse the order the entries are created in for the second build.
+		for i, j := 0, len(paths)-1; i < j; i, j = i+1, j-1 {
+			paths[i], paths[j] = paths[j], paths[i]
+		}
+	}
+	c.Check(infoBytes[0], qt.Equals, infoBytes[1])
+}
+
+func TestBuildFromFilePathKeepsJoinedPathOrder(t *testing.T) {
+	c := qt.New(t)
+	root := c.Mkdir()
+	writeTreeFiles(c, root, pathFiles("a/b", "a.b"))
+	info := Info{PieceLength: 16384}
+	c.Assert(info.BuildFromFilePath(root), qt.IsNil)
+	c.Check(info.Files[0].Path, qt.DeepEquals, []string{"a.b"})
+	c.Check(info.Files[1].Path, qt.DeepEquals, []string{"a", "b"})
+	_, err := info.BuildFromFilePathOpts(context.Background(), root, BuildFromFilePathOpts{
+		Version:   InfoVersionHybrid,
+		FileOrder: FileOrderJoinedPath,
+	})
+	c.Check(err, qt.ErrorMatches, "hybrid infos must use FileOrderPath")
+}
+
 func testUnmarshal(t *testing.T, input string, expected *MetaInfo) {
 	var actual MetaInfo
 	err := bencode.Unmarshal([]byte(input), &actual)
@@ -147,6 +219,31 @@ func TestMetainfoWithStringURLList(t *testing.T) {
 		}, "&"))
 }
 
+func TestUrlListEncodings(t *testing.T) {
+	c := qt.New(t)
+	for _, case_ := range []struct {
+		urlList  string
+		expected UrlList
+	}{
+		{"1:a", UrlList{"a"}},
+		{"0:", nil},
+		{"l1:a0:1:be", UrlList{"a", "b"}},
+		{"l0:e", nil},
+		{"le", nil},
+	} {
+		var mi MetaInfo
+		err := bencode.Unmarshal([]byte("d4:infode8:url-list"+case_.urlList+"e"), &mi)
+		c.Assert(err, qt.IsNil)
+		c.Check(mi.UrlList, qt.DeepEquals, case_.expected, qt.Commentf("%q", case_.urlList))
+	}
+	// The bare string is encoded as a list of one, and what's dropped isn't encoded at all.
+	mi, err := LoadFromFile("testdata/flat-url-list.torrent")
+	c.Assert(err, qt.IsNil)
+	c.Check(string(bencode.MustMarshal(mi)), qt.Contains, "8:url-listl29:https://archive.org/download/ee")
+	mi.UrlList = UrlList{""}.withoutEmpty()
+	c.Check(string(bencode.MustMarshal(mi)), qt.Not(qt.Contains), "url-list")
+}
+
 // https://github.com/anacrolix/torrent/issues/247
 //
 // The decoder buffer wasn't cleared before starting the next dict item after
@@ -155,3 +252,388 @@ func TestStringCreationDate(t *testing.T) {
 	var mi MetaInfo
 	assert.NoError(t, bencode.Unmarshal([]byte("d13:creation date23:29.03.2018 22:18:14 UTC4:infodee"), &mi))
 }
+
+// The fixture was generated from the BEP 52 specification by a standalone Python script, not by
+// this package. The expected hashes weren't computed with this package either: the info dict is
+// bytes 48 to 443 of the file, and they're the output of coreutils over that range:
+//
+//	tail -c +48 testdata/hybrid.torrent | head -c 396 | sha1sum
+//	tail -c +48 testdata/hybrid.torrent | head -c 396 | sha256sum
+func TestHybridInfoHashes(t *testing.T) {
+	c := qt.New(t)
+	mi, err := LoadFromFile("testdata/hybrid.torrent")
+	c.Assert(err, qt.IsNil)
+	c.Check(mi.HashInfoBytes().HexString(), qt.Equals, "8133052cff3e133aca802ac1892220949a075369")
+	v2, ok := mi.HashInfoBytesV2()
+	c.Assert(ok, qt.IsTrue)
+	c.Check(v2.HexString(), qt.Equals, "eb741e50250eac9606f108aadb3886ddfc237c51421fdae69d3c9a241a5ea743")
+	truncated, ok := mi.HashInfoBytesV2Truncated()
+	c.Assert(ok, qt.IsTrue)
+	c.Check(truncated.HexString(), qt.Equals, "eb741e50250eac9606f108aadb3886ddfc237c51")
+}
+
+// Loads testdata/libtorrent-hybrid.torrent, which is made from the data writeHybridTestData writes by
+// testdata/libtorrent-hybrid.py, and the v1 and v2 infohashes libtorrent reported for it. The test
+// is skipped if the files haven't been made.
+func loadLibtorrentHybrid(c *qt.C) (mi *MetaInfo, v1, v2 string) {
+	hashes, err := ioutil.ReadFile("testdata/libtorrent-hybrid.infohashes")
+	if os.IsNotExist(err) {
+		c.Skip("no libtorrent fixture: run testdata/libtorrent-hybrid.py")
+	}
+	c.Assert(err, qt.IsNil)
+	lines := strings.Fields(string(hashes))
+	c.Assert(lines, qt.HasLen, 2)
+	mi, err = LoadFromFile("testdata/libtorrent-hybrid.torrent")
+	c.Assert(err, qt.IsNil)
+	return mi, lines[0], lines[1]
+}
+
+func TestLibtorrentHybridInfoHashes(t *testing.T) {
+	c := qt.New(t)
+	mi, v1, v2 := loadLibtorrentHybrid(c)
+	c.Check(mi.HashInfoBytes().HexString(), qt.Equals, v1)
+	h, ok := mi.HashInfoBytesV2()
+	c.Assert(ok, qt.IsTrue)
+	c.Check(h.HexString(), qt.Equals, v2)
+	truncated, ok := mi.HashInfoBytesV2Truncated()
+	c.Assert(ok, qt.IsTrue)
+	c.Check(truncated.HexString(), qt.Equals, v2[:40])
+}
+
+func TestV1InfoHasNoV2Hash(t *testing.T) {
+	mi, err := LoadFromFile("testdata/continuum.torrent")
+	qt.Assert(t, err, qt.IsNil)
+	_, ok := mi.HashInfoBytesV2()
+	qt.Check(t, ok, qt.IsFalse)
+}
+
+// Builds the data described by testdata/hybrid.torrent, which was created independently from the
+// BEP 52 specification, and checks the info dict and piece layers match it exactly.
+func TestBuildHybridFromFilePath(t *testing.T) {
+	c := qt.New(t)
+	root := writeHybridTestData(c)
+	info := Info{PieceLength: 16384}
+	pieceLayers, err := info.BuildFromFilePathOpts(context.Background(), root, BuildFromFilePathOpts{Version: InfoVersionHybrid})
+	c.Assert(err, qt.IsNil)
+	expected, err := LoadFromFile("testdata/hybrid.torrent")
+	c.Assert(err, qt.IsNil)
+	c.Check(string(bencode.MustMarshal(info)), qt.Equals, string(expected.InfoBytes))
+	c.Check(pieceLayers, qt.DeepEquals, expected.PieceLayers)
+}
+
+// As TestBuildHybridFromFilePath, against the hybrid torrent libtorrent makes from the same data.
+func TestBuildHybridMatchesLibtorrent(t *testing.T) {
+	c := qt.New(t)
+	expected, _, _ := loadLibtorrentHybrid(c)
+	root := writeHybridTestData(c)
+	info := Info{PieceLength: 16384}
+	pieceLayers, err := info.BuildFromFilePathOpts(context.Background(), root, BuildFromFilePathOpts{Version: InfoVersionHybrid})
+	c.Assert(err, qt.IsNil)
+	c.Check(string(bencode.MustMarshal(info)), qt.Equals, string(expected.InfoBytes))
+	c.Check(pieceLayers, qt.DeepEquals, expected.PieceLayers)
+}
+
+func TestBuildHybridRejectsBadPieceLength(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "file")
+	qt.Assert(t, ioutil.WriteFile(root, []byte("hello"), 0o600), qt.IsNil)
+	info := Info{PieceLength: 3 << 14}
+	_, err := info.BuildFromFilePathOpts(context.Background(), root, BuildFromFilePathOpts{Version: InfoVersionHybrid})
+	qt.Assert(t, err, qt.ErrorMatches, "v2 piece length must be a power of two.*")
+}
+
+func TestGeneratePiecesProgress(t *testing.T) {
+	c := qt.New(t)
+	info := Info{
+		PieceLength: 4,
+		Files:       []FileInfo{{Length: 5}, {Length: 6}},
+	}
+	var calls [][2]int64
+	err := info.GeneratePiecesContext(context.Background(), func(fi FileInfo) (io.ReadCloser, error) {
+		return ioutil.NopCloser(missinggo.ZeroReader), nil
+	}, func(bytesHashed, totalBytes int64) {
+		calls = append(calls, [2]int64{bytesHashed, totalBytes})
+	})
+	c.Assert(err, qt.IsNil)
+	c.Check(calls, qt.DeepEquals, [][2]int64{{4, 11}, {8, 11}, {11, 11}})
+}
+
+func TestGeneratePiecesCancelled(t *testing.T) {
+	c := qt.New(t)
+	info := Info{
+		PieceLength: 1,
+		Length:      1 << 20,
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	var lastHashed int64
+	err := info.GeneratePiecesContext(ctx, func(fi FileInfo) (io.ReadCloser, error) {
+		return ioutil.NopCloser(missinggo.ZeroReader), nil
+	}, func(bytesHashed, totalBytes int64) {
+		lastHashed = bytesHashed
+		if bytesHashed == 3 {
+			cancel()
+		}
+	})
+	c.Check(err, qt.Equals, context.Canceled)
+	c.Check(lastHashed, qt.Equals, int64(3))
+}
+
+func TestBuildFromFilePathCancelled(t *testing.T) {
+	root := t.TempDir()
+	qt.Assert(t, touchFile(filepath.Join(root, "a")), qt.IsNil)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	info := Info{PieceLength: 1}
+	_, err := info.BuildFromFilePathOpts(ctx, root, BuildFromFilePathOpts{})
+	qt.Assert(t, err, qt.Equals, context.Canceled)
+}
+
+func TestBuildFromFilePathPadFiles(t *testing.T) {
+	c := qt.New(t)
+	root := t.TempDir()
+	c.Assert(ioutil.WriteFile(filepath.Join(root, "a"), []byte("hello"), 0o600), qt.IsNil)
+	c.Assert(touchFile(filepath.Join(root, "b")), qt.IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(root, "c"), []byte("wor"), 0o600), qt.IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(root, "d"), []byte("ld"), 0o600), qt.IsNil)
+	info := Info{PieceLength: 4}
+	_, err := info.BuildFromFilePathOpts(context.Background(), root, BuildFromFilePathOpts{PadFiles: true})
+	c.Assert(err, qt.IsNil)
+	c.Check(info.Files, qt.DeepEquals, []FileInfo{
+		{Length: 5, Path: []string{"a"}},
+		{Length: 3, Path: []string{".pad", "3"}, Attr: "p"},
+		{Length: 0, Path: []string{"b"}},
+		{Length: 3, Path: []string{"c"}},
+		{Length: 1, Path: []string{".pad", "1"}, Attr: "p"},
+		{Length: 2, Path: []string{"d"}},
+	})
+	expectedPieces, err := GeneratePieces(strings.NewReader("hell"+"o\x00\x00\x00"+"wor\x00"+"ld"), 4, nil)
+	c.Assert(err, qt.IsNil)
+	c.Check(info.Pieces, qt.DeepEquals, expectedPieces)
+
+	// The padding entries must survive a round trip exactly.
+	var buf bytes.Buffer
+	c.Assert(MetaInfo{InfoBytes: bencode.MustMarshal(info)}.Write(&buf), qt.IsNil)
+	mi, err := Load(&buf)
+	c.Assert(err, qt.IsNil)
+	loaded, err := mi.UnmarshalInfo()
+	c.Assert(err, qt.IsNil)
+	c.Check(loaded.Files, qt.DeepEquals, info.Files)
+	c.Check(string(bencode.MustMarshal(loaded)), qt.Equals, string(mi.InfoBytes))
+}
+
+func TestUnknownFieldsRoundTrip(t *testing.T) {
+	c := qt.New(t)
+	b, err := ioutil.ReadFile("testdata/unknown-fields.torrent")
+	c.Assert(err, qt.IsNil)
+	mi, err := Load(bytes.NewReader(b))
+	c.Assert(err, qt.IsNil)
+	c.Check(mi.Comment, qt.Equals, "odd keys")
+	c.Check(mi.UnknownFields, qt.DeepEquals, map[string]bencode.Bytes{
+		"publisher":     bencode.Bytes("7:someone"),
+		"publisher-url": bencode.Bytes("20:https://example.com/"),
+		"x-custom":      bencode.Bytes("d4:listli1e3:twoli3eee1:ni-7ee"),
+		"zzz":           bencode.Bytes("2:\x00\xff"),
+	})
+	var buf bytes.Buffer
+	c.Assert(mi.Write(&buf), qt.IsNil)
+	c.Check(buf.String(), qt.Equals, string(b))
+	c.Check(string(bencode.MustMarshal(mi)), qt.Equals, string(b))
+}
+
+func TestKnownFieldsOverrideUnknownFields(t *testing.T) {
+	mi := MetaInfo{
+		Comment: "known",
+		UnknownFields: map[string]bencode.Bytes{
+			"comment": bencode.Bytes("7:unknown"),
+			"other":   bencode.Bytes("i1e"),
+		},
+	}
+	qt.Assert(t, string(bencode.MustMarshal(mi)), qt.Equals, "d7:comment5:known5:otheri1ee")
+}
+
+// Loads a file that must need the lenient fallback.
+func loadBytesFromFile(c *qt.C, filename string) *MetaInfo {
+	b, err := ioutil.ReadFile(filename)
+	c.Assert(err, qt.IsNil)
+	_, err = Load(bytes.NewReader(b))
+	c.Assert(err, qt.Not(qt.IsNil))
+	mi, err := LoadBytes(b)
+	c.Assert(errors.As(err, new(RepairedError)), qt.IsTrue, qt.Commentf("%v", err))
+	return mi
+}
+
+// The fallback decoder must keep the BEP 12 tiers intact.
+func TestLenientLoadPreservesTiers(t *testing.T) {
+	c := qt.New(t)
+	mi := loadBytesFromFile(c, "testdata/lenient-tiers.torrent")
+	c.Check(mi.AnnounceList, qt.DeepEquals, AnnounceList{
+		{"http://a/announce", "http://b/announce"},
+		{"http://c/announce"},
+	})
+	c.Check(mi.Announce, qt.Equals, "http://a/announce")
+}
+
+func TestLenientLoadBareAnnounceList(t *testing.T) {
+	c := qt.New(t)
+	mi := loadBytesFromFile(c, "testdata/lenient-bare-announce-list.torrent")
+	c.Check(mi.AnnounceList, qt.DeepEquals, AnnounceList{
+		{"http://a/announce"},
+		{"http://b/announce"},
+		{"http://c/announce"},
+	})
+}
+
+func TestLenientLoadPreservesFileFields(t *testing.T) {
+	c := qt.New(t)
+	mi := loadBytesFromFile(c, "testdata/lenient-file-fields.torrent")
+	info, err := mi.UnmarshalInfo()
+	c.Assert(err, qt.IsNil)
+	c.Check(info.Files, qt.DeepEquals, []FileInfo{{
+		Length:   1,
+		Path:     []string{"caf\xe9"},
+		PathUTF8: []string{"café"},
+		Md5sum:   "0cc175b9c0f1b6a831c399e269772661",
+		Mtime:    1500000000,
+	}, {
+		Length: 1,
+		Path:   []string{"b"},
+		Attr:   "x",
+	}})
+	// The infohash of the info dict in the original file, as computed by sha1sum.
+	c.Check(mi.HashInfoBytes().HexString(), qt.Equals, "7326282fa49ccedc3296175a47193b04e366e56d")
+}
+
+func TestLoadWithOpts(t *testing.T) {
+	c := qt.New(t)
+	clean, err := ioutil.ReadFile("testdata/hybrid.torrent")
+	c.Assert(err, qt.IsNil)
+	malformed, err := ioutil.ReadFile("testdata/lenient-tiers.torrent")
+	c.Assert(err, qt.IsNil)
+
+	mi, err := LoadWithOpts(bytes.NewReader(clean), LoadOpts{AllowRepair: true})
+	c.Check(err, qt.IsNil)
+	c.Check(mi, qt.Not(qt.IsNil))
+
+	mi, err = LoadWithOpts(bytes.NewReader(malformed), LoadOpts{})
+	c.Check(err, qt.Not(qt.IsNil))
+	c.Check(errors.As(err, new(RepairedError)), qt.IsFalse)
+	c.Check(mi, qt.IsNil)
+
+	mi, err = LoadWithOpts(bytes.NewReader(malformed), LoadOpts{AllowRepair: true})
+	var repaired RepairedError
+	c.Assert(errors.As(err, &repaired), qt.IsTrue)
+	c.Check(repaired.Strict, qt.Not(qt.IsNil))
+	c.Check(err, qt.ErrorMatches, "loaded with repairs: nodes\\[0\\] skipped malformed entry")
+	c.Check(mi.Announce, qt.Equals, "http://a/announce")
+
+	_, err = LoadWithOpts(bytes.NewReader(clean), LoadOpts{MaxSize: int64(len(clean))})
+	c.Check(err, qt.IsNil)
+	_, err = LoadWithOpts(bytes.NewReader(clean), LoadOpts{MaxSize: int64(len(clean)) - 1})
+	c.Check(err, qt.ErrorMatches, "metainfo exceeds max size of .* bytes")
+}
+
+// The name and paths are GBK, with UTF-8 alternates.
+func TestUTF8Alternates(t *testing.T) {
+	c := qt.New(t)
+	mi, err := LoadFromFile("testdata/gbk-utf8-alternates.torrent")
+	c.Assert(err, qt.IsNil)
+	info, err := mi.UnmarshalInfo()
+	c.Assert(err, qt.IsNil)
+	c.Check(info.Name, qt.Equals, "\xd6\xd0\xce\xc4\xd7\xca\xc1\xcf")
+	c.Check(info.BestName(), qt.Equals, "中文资料")
+	var paths [][]string
+	for _, fi := range info.Files {
+		paths = append(paths, fi.BestPath())
+	}
+	c.Check(paths, qt.DeepEquals, [][]string{{"文件.txt"}, {"目录", "b.txt"}})
+	c.Check(info.Files[0].DisplayPath(&info), qt.Equals, "文件.txt")
+	c.Check(string(bencode.MustMarshal(info)), qt.Equals, string(mi.InfoBytes))
+}
+
+func TestHttpSeeds(t *testing.T) {
+	c := qt.New(t)
+	b := []byte("d9:httpseedsl17:http://a/seed.php17:http://b/seed.phpe" +
+		"4:infod4:name1:a12:piece lengthi1ee8:url-listl11:http://c/a/ee")
+	mi, err := Load(bytes.NewReader(b))
+	c.Assert(err, qt.IsNil)
+	c.Check(mi.HttpSeeds, qt.DeepEquals, UrlList{"http://a/seed.php", "http://b/seed.php"})
+	c.Check(string(bencode.MustMarshal(mi)), qt.Equals, string(b))
+	m := mi.Magnet(nil, nil)
+	c.Check(m.Params["ws"], qt.DeepEquals, []string{"http://c/a/", "http://a/seed.php", "http://b/seed.php"})
+	c.Check(mi.UrlList, qt.DeepEquals, UrlList{"http://c/a/"})
+	mi, err = Load(bytes.NewReader([]byte("d9:httpseeds17:http://a/seed.php4:infod4:name1:a12:piece lengthi1eee")))
+	c.Assert(err, qt.IsNil)
+	c.Check(mi.HttpSeeds, qt.DeepEquals, UrlList{"http://a/seed.php"})
+}
+
+func TestSetDefaultsOpts(t *testing.T) {
+	c := qt.New(t)
+	now := func() time.Time { return time.Unix(1600000000, 0) }
+	var mi MetaInfo
+	c.Check(mi.SetDefaultsOpts(SetDefaultsOpts{Now: now}), qt.Equals, &mi)
+	c.Check(mi.CreatedBy, qt.Equals, DefaultCreatedBy)
+	c.Check(mi.CreationDate, qt.Equals, int64(1600000000))
+	mi = MetaInfo{Comment: "kept", CreatedBy: "me", CreationDate: 1}
+	mi.SetDefaultsOpts(SetDefaultsOpts{CreatedBy: "tool", Now: now})
+	c.Check(mi.Comment, qt.Equals, "kept")
+	c.Check(mi.CreatedBy, qt.Equals, "me")
+	c.Check(mi.CreationDate, qt.Equals, int64(1))
+	mi = MetaInfo{}
+	mi.SetDefaultsOpts(SetDefaultsOpts{CreatedBy: "tool"})
+	c.Check(mi.CreatedBy, qt.Equals, "tool")
+	c.Check(mi.CreationDate, qt.Not(qt.Equals), int64(0))
+}
+
+func TestSetDefaultsDeprecated(t *testing.T) {
+	c := qt.New(t)
+	mi := MetaInfo{Comment: "cleared", CreatedBy: "replaced", CreationDate: 1}
+	mi.SetDefaults()
+	c.Check(mi.Comment, qt.Equals, "")
+	c.Check(mi.CreatedBy, qt.Equals, DefaultCreatedBy)
+	c.Check(mi.CreationDate, qt.Not(qt.Equals), int64(1))
+}
+
+func TestCreationTime(t *testing.T) {
+	c := qt.New(t)
+	var mi MetaInfo
+	_, ok := mi.CreationTime()
+	c.Check(ok, qt.IsFalse)
+	mi.SetCreationTime(time.Unix(1387249712, 999))
+	c.Check(mi.CreationDate, qt.Equals, int64(1387249712))
+	created, ok := mi.CreationTime()
+	c.Check(ok, qt.IsTrue)
+	c.Check(created.Equal(time.Unix(1387249712, 0)), qt.IsTrue)
+	mi.SetCreationTime(time.Time{})
+	c.Check(mi.CreationDate, qt.Equals, int64(0))
+}
+
+func TestNumericStringCreationDate(t *testing.T) {
+	c := qt.New(t)
+	mi, err := LoadFromFile("testdata/string-creation-date.torrent")
+	c.Assert(err, qt.IsNil)
+	c.Check(mi.CreationDate, qt.Equals, int64(1387249712))
+	b, err := os.ReadFile("testdata/string-creation-date.torrent")
+	c.Assert(err, qt.IsNil)
+	// The strict decoder handles it, so there's nothing to repair.
+	_, repairs, err := LoadLenient(b)
+	c.Assert(err, qt.IsNil)
+	c.Check(repairs, qt.HasLen, 0)
+	// The malformed node forces the lenient path.
+	mi, repairs, err = LoadLenient(bencode.MustMarshal(map[string]interface{}{
+		"creation date": "1387249712",
+		"nodes":         []interface{}{42},
+		"info":          bencode.Bytes(mi.InfoBytes),
+	}))
+	c.Assert(err, qt.IsNil)
+	c.Check(mi.CreationDate, qt.Equals, int64(1387249712))
+	c.Check(repairs, qt.DeepEquals, Repairs{
+		{"creation date", "parsed from string"},
+		{"nodes[0]", "skipped malformed entry"},
+	})
+}
+
+func TestCreationDateOverflow(t *testing.T) {
+	c := qt.New(t)
+	mi, err := Load(strings.NewReader("d13:creation datei99999999999999999999e4:infod6:lengthi1e4:name1:a12:piece lengthi16384e6:pieces0:ee"))
+	c.Assert(err, qt.IsNil)
+	c.Check(mi.CreationDate, qt.Equals, int64(math.MaxInt64))
+}
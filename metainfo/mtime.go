@@ -0,0 +1,42 @@
+package metainfo
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// The path of the file's data, where root is as passed to BuildFromFilePath: the file itself for a
+// single-file info, or the directory holding the files. The file is found as storage would find it,
+// with LocalPath, so it's an error for the path to escape root.
+func (info *Info) dataFilePath(root string, fi *FileInfo) (string, error) {
+	if !info.IsDir() {
+		return root, nil
+	}
+	path, err := LocalPath(fi.Path...)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(root, path), nil
+}
+
+// Sets the modification times of the files under root to those recorded in the info, such as after
+// a download completes. root is as for VerifyData. Files without an mtime, padding, and symlinks are
+// left alone. The access times are set to now. It's an error for a file's path to escape root.
+func (info *Info) ApplyMtimes(root string) error {
+	now := time.Now()
+	for _, fi := range info.UpvertedFiles() {
+		if fi.Mtime == 0 || fi.IsPadding() || fi.IsSymlink() {
+			continue
+		}
+		path, err := info.dataFilePath(root, &fi)
+		if err != nil {
+			return err
+		}
+		err = os.Chtimes(path, now, time.Unix(fi.Mtime, 0))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
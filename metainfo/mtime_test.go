@@ -0,0 +1,120 @@
+package metainfo
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/anacrolix/torrent/bencode"
+)
+
+func TestBuildRecordMtimes(t *testing.T) {
+	c := qt.New(t)
+	root := c.Mkdir()
+	writeTreeFiles(c, root, pathFiles("a", "d/b"))
+	c.Assert(os.Chtimes(filepath.Join(root, "a"), time.Now(), time.Unix(1500000000, 0)), qt.IsNil)
+	c.Assert(os.Chtimes(filepath.Join(root, "d", "b"), time.Now(), time.Unix(1600000000, 0)), qt.IsNil)
+	info := Info{PieceLength: 16384}
+	_, err := info.BuildFromFilePathOpts(context.Background(), root, BuildFromFilePathOpts{
+		RecordMtimes: true,
+		PadFiles:     true,
+	})
+	c.Assert(err, qt.IsNil)
+	var mtimes []int64
+	for _, fi := range info.Files {
+		mtimes = append(mtimes, fi.Mtime)
+	}
+	c.Check(mtimes, qt.DeepEquals, []int64{1500000000, 0, 1600000000})
+	var decoded Info
+	c.Assert(bencode.Unmarshal(bencode.MustMarshal(info), &decoded), qt.IsNil)
+	c.Check(decoded.Files, qt.DeepEquals, info.Files)
+
+	_, err = info.BuildFromFilePathOpts(context.Background(), root, BuildFromFilePathOpts{})
+	c.Assert(err, qt.IsNil)
+	c.Check(info.Files[0].Mtime, qt.Equals, int64(0))
+}
+
+func TestBuildFromFSRecordMtimes(t *testing.T) {
+	c := qt.New(t)
+	fsys := fstest.MapFS{
+		"a": &fstest.MapFile{Data: []byte("hello"), ModTime: time.Unix(1500000000, 0)},
+		"b": &fstest.MapFile{Data: []byte("world")},
+	}
+	info := Info{Name: "name", PieceLength: 16384}
+	_, err := info.BuildFromFS(context.Background(), fsys, ".", BuildFromFilePathOpts{RecordMtimes: true})
+	c.Assert(err, qt.IsNil)
+	c.Check(info.Files[0].Mtime, qt.Equals, int64(1500000000))
+	// The zero time isn't recorded as a time before the epoch.
+	c.Check(info.Files[1].Mtime, qt.Equals, int64(0))
+}
+
+func TestApplyMtimes(t *testing.T) {
+	c := qt.New(t)
+	root := c.Mkdir()
+	writeTreeFiles(c, root, pathFiles("a", "b"))
+	info := Info{
+		Name: "root",
+		Files: []FileInfo{
+			{Path: []string{"a"}, Length: 3, Mtime: 1500000000},
+			{Path: []string{".pad", "1"}, Length: 1, Attr: "p", Mtime: 1},
+			{Path: []string{"b"}, Length: 3},
+			{Path: []string{"l"}, Attr: "l", SymlinkPath: []string{"a"}, Mtime: 1},
+		},
+	}
+	before, err := os.Stat(filepath.Join(root, "b"))
+	c.Assert(err, qt.IsNil)
+	c.Assert(info.ApplyMtimes(root), qt.IsNil)
+	fi, err := os.Stat(filepath.Join(root, "a"))
+	c.Assert(err, qt.IsNil)
+	c.Check(fi.ModTime().Unix(), qt.Equals, int64(1500000000))
+	fi, err = os.Stat(filepath.Join(root, "b"))
+	c.Assert(err, qt.IsNil)
+	c.Check(fi.ModTime(), qt.Equals, before.ModTime())
+	c.Assert(os.Remove(filepath.Join(root, "a")), qt.IsNil)
+	c.Check(info.ApplyMtimes(root), qt.Satisfies, os.IsNotExist)
+}
+
+// archive.org torrents have string mtimes, which don't stop the info decoding.
+func TestDecodeStringMtime(t *testing.T) {
+	c := qt.New(t)
+	var fi FileInfo
+	c.Assert(bencode.Unmarshal([]byte("d6:lengthi3e5:mtime10:14872569444:pathl1:aee"), &fi), qt.IsNil)
+	c.Check(fi, qt.DeepEquals, FileInfo{Length: 3, Path: []string{"a"}})
+	c.Assert(bencode.Unmarshal([]byte("d6:lengthi3e5:mtimei1487256944e4:pathl1:aee"), &fi), qt.IsNil)
+	c.Check(fi.Mtime, qt.Equals, int64(1487256944))
+
+	mi, err := LoadFromFile("testdata/SKODAOCTAVIA336x280_archive.torrent")
+	c.Assert(err, qt.IsNil)
+	info, err := mi.UnmarshalInfo()
+	c.Assert(err, qt.IsNil)
+	c.Check(info.Files, qt.Not(qt.HasLen), 0)
+}
+
+func TestApplyMtimesOutsideRoot(t *testing.T) {
+	c := qt.New(t)
+	dir := c.Mkdir()
+	root := filepath.Join(dir, "root")
+	writeTreeFiles(c, dir, pathFiles("root/a", "outside"))
+	before, err := os.Stat(filepath.Join(dir, "outside"))
+	c.Assert(err, qt.IsNil)
+	for _, path := range [][]string{{"..", "outside"}, {"/outside"}} {
+		info := Info{
+			Name: "root",
+			Files: []FileInfo{
+				{Path: []string{"a"}, Length: 3, Mtime: 1500000000},
+				{Path: path, Length: 3, Mtime: 1500000000},
+			},
+		}
+		err := info.ApplyMtimes(root)
+		c.Check(errors.As(err, new(FilePathError)), qt.IsTrue, qt.Commentf("%q: %v", path, err))
+	}
+	fi, err := os.Stat(filepath.Join(dir, "outside"))
+	c.Assert(err, qt.IsNil)
+	c.Check(fi.ModTime(), qt.Equals, before.ModTime())
+}
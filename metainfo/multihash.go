@@ -0,0 +1,35 @@
+package metainfo
+
+import (
+	"encoding/hex"
+	"fmt"
+)
+
+// Multihash function codes. See https://github.com/multiformats/multicodec.
+const (
+	multihashSha1   = 0x11
+	multihashSha256 = 0x12
+)
+
+// Decodes a hex-encoded multihash, which must use the hash function code and have a digest of
+// size bytes. Only single-byte codes and lengths are handled, which covers the hashes used here.
+func decodeMultihash(s string, code byte, size int) ([]byte, error) {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding multihash: %w", err)
+	}
+	if len(b) < 2 {
+		return nil, fmt.Errorf("multihash too short (%d bytes)", len(b))
+	}
+	if b[0] != code {
+		return nil, fmt.Errorf("unsupported multihash function code %#x", b[0])
+	}
+	if int(b[1]) != size || len(b) != 2+size {
+		return nil, fmt.Errorf("bad multihash digest length %d with %d bytes of digest", b[1], len(b)-2)
+	}
+	return b[2:], nil
+}
+
+func encodeMultihash(code byte, digest []byte) string {
+	return hex.EncodeToString(append([]byte{code, byte(len(digest))}, digest...))
+}
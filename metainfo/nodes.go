@@ -1,19 +1,51 @@
 package metainfo
 
 import (
+	"errors"
 	"fmt"
 	"net"
 	"strconv"
+	"strings"
 
 	"github.com/anacrolix/torrent/bencode"
 )
 
+// A DHT node, as "host:port". Nodes decoded from strings are kept as they were, so they may not be
+// valid addresses.
 type Node string
 
 var (
 	_ bencode.Unmarshaler = new(Node)
 )
 
+// Returns the node with IPv6 hosts bracketed, as net.SplitHostPort expects. Strings with an
+// unbracketed IPv6 host are split at the last colon. Anything else is returned as is.
+func (n Node) String() string {
+	s := string(n)
+	if _, _, err := net.SplitHostPort(s); err == nil {
+		return s
+	}
+	i := strings.LastIndexByte(s, ':')
+	if i < 0 {
+		return s
+	}
+	host := s[:i]
+	if strings.Contains(host, ":") && net.ParseIP(host) != nil {
+		return net.JoinHostPort(host, s[i+1:])
+	}
+	return s
+}
+
+// Returns the host and port of the node, if it has them.
+func (n Node) hostPort() (host string, port int, ok bool) {
+	host, portStr, err := net.SplitHostPort(n.String())
+	if err != nil {
+		return
+	}
+	port, err = parseNodePort(portStr)
+	return host, port, err == nil
+}
+
 func (n *Node) UnmarshalBencode(b []byte) (err error) {
 	var iface interface{}
 	err = bencode.Unmarshal(b, &iface)
@@ -22,19 +54,115 @@ func (n *Node) UnmarshalBencode(b []byte) (err error) {
 	}
 	switch v := iface.(type) {
 	case string:
+		if v == "" {
+			return errors.New("empty node")
+		}
 		*n = Node(v)
 	case []interface{}:
-		func() {
-			defer func() {
-				r := recover()
-				if r != nil {
-					err = r.(error)
-				}
-			}()
-			*n = Node(net.JoinHostPort(v[0].(string), strconv.FormatInt(v[1].(int64), 10)))
-		}()
+		*n, err = nodeFromPair(v)
 	default:
 		err = fmt.Errorf("unsupported type: %T", iface)
 	}
 	return
 }
+
+// Returns the node for a [host, port] pair, as in BEP 5.
+func nodeFromPair(pair []interface{}) (Node, error) {
+	if len(pair) != 2 {
+		return "", fmt.Errorf("node pair has %d elements", len(pair))
+	}
+	host, ok := pair[0].(string)
+	if !ok {
+		return "", fmt.Errorf("node host has type %T", pair[0])
+	}
+	port, ok := pair[1].(int64)
+	if !ok {
+		return "", fmt.Errorf("node port has type %T", pair[1])
+	}
+	host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+	if host == "" {
+		return "", errors.New("empty host")
+	}
+	if port < 1 || port > 65535 {
+		return "", fmt.Errorf("bad port %d", port)
+	}
+	return Node(net.JoinHostPort(host, strconv.FormatInt(port, 10))), nil
+}
+
+func parseNodePort(s string) (int, error) {
+	i, err := strconv.ParseUint(s, 10, 16)
+	if err != nil || i == 0 {
+		return 0, fmt.Errorf("bad port %q", s)
+	}
+	return int(i), nil
+}
+
+// Whether every entry of a decoded nodes list is a pair.
+func nodesArePairs(l []interface{}) bool {
+	for _, elem := range l {
+		if _, ok := elem.([]interface{}); !ok {
+			return false
+		}
+	}
+	return len(l) != 0
+}
+
+// Encodes the nodes as [host, port] pairs. Nodes without a valid host and port are encoded as
+// strings.
+func nodePairs(nodes []Node) (ret []interface{}) {
+	for _, n := range nodes {
+		if host, port, ok := n.hostPort(); ok {
+			ret = append(ret, []interface{}{host, port})
+		} else {
+			ret = append(ret, string(n))
+		}
+	}
+	return
+}
+
+// Whether host is an IP address or a valid hostname.
+func validNodeHost(host string) bool {
+	if net.ParseIP(host) != nil {
+		return true
+	}
+	host = strings.TrimSuffix(host, ".")
+	if host == "" || len(host) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(host, ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for i := 0; i < len(label); i++ {
+			c := label[i]
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Adds a DHT node, unless it's already present. Surrounding space and brackets are removed from
+// host, IP addresses are put in canonical form, and hostnames are lowercased. A NodeError is
+// returned if the host or port isn't valid.
+func (mi *MetaInfo) AddNode(host string, port int) error {
+	host = strings.TrimSpace(host)
+	if strings.HasPrefix(host, "[") && strings.HasSuffix(host, "]") {
+		host = host[1 : len(host)-1]
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		host = ip.String()
+	} else {
+		host = strings.ToLower(strings.TrimSuffix(host, "."))
+	}
+	n := Node(net.JoinHostPort(host, strconv.Itoa(port)))
+	if !validNodeHost(host) {
+		return NodeError{n, fmt.Errorf("bad host %q", host)}
+	}
+	if port < 1 || port > 65535 {
+		return NodeError{n, fmt.Errorf("bad port %d", port)}
+	}
+	mi.Nodes = appendMissingNode(mi.Nodes, n)
+	return nil
+}
@@ -2,6 +2,7 @@ package metainfo
 
 import (
 	"bytes"
+	"errors"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -72,3 +73,91 @@ func TestMetainfoEmptyInfoBytes(t *testing.T) {
 	var mi MetaInfo
 	require.NoError(t, bencode.Unmarshal(buf.Bytes(), &mi))
 }
+
+func TestNodeString(t *testing.T) {
+	for _, tc := range []struct {
+		node     Node
+		expected string
+	}{
+		{"1.2.3.4:6881", "1.2.3.4:6881"},
+		{"[2001:db8::1]:6881", "[2001:db8::1]:6881"},
+		{"2001:db8::1:6881", "[2001:db8::1]:6881"},
+		{"router.example.com:6881", "router.example.com:6881"},
+		{"::1", "::1"},
+		{"not a hostport", "not a hostport"},
+	} {
+		assert.Equal(t, tc.expected, tc.node.String())
+	}
+}
+
+func TestUnmarshalNodePairs(t *testing.T) {
+	var mi MetaInfo
+	require.NoError(t, bencode.Unmarshal([]byte("d5:nodesll11:2001:db8::1i6881eel13:[2001:db8::2]i6882eeee"), &mi))
+	assert.EqualValues(t, []Node{"[2001:db8::1]:6881", "[2001:db8::2]:6882"}, mi.Nodes)
+	assert.True(t, mi.NodesAsPairs)
+	for _, b := range []string{
+		"d5:nodesll7:1.2.3.4i0eee",
+		"d5:nodesll7:1.2.3.4i65536eee",
+		"d5:nodesll7:1.2.3.4eee",
+		"d5:nodesll0:i6881eee",
+		"d5:nodesli6881ei6881eee",
+		"d5:nodesl0:ee",
+	} {
+		assert.Error(t, bencode.Unmarshal([]byte(b), new(MetaInfo)), b)
+	}
+}
+
+func TestLenientSkipsMalformedNodes(t *testing.T) {
+	mi, repairs, err := LoadLenient([]byte(
+		"d4:infod4:name1:x6:pieces20:aaaaaaaaaaaaaaaaaaaae5:nodesll7:1.2.3.4i6881eel7:1.2.3.5i0eeee"))
+	require.NoError(t, err)
+	assert.EqualValues(t, []Node{"1.2.3.4:6881"}, mi.Nodes)
+	assert.True(t, mi.NodesAsPairs)
+	assert.EqualValues(t, Repairs{{"nodes[1]", "skipped malformed entry"}}, repairs)
+}
+
+func TestNodesRoundTripStyle(t *testing.T) {
+	for _, tc := range []struct {
+		in, out string
+	}{
+		{"d4:infodee", "d4:infodee"},
+		{"d4:infode5:nodesll7:1.2.3.4i6881eel11:2001:db8::1i6882eeee", ""},
+		{"d4:infode5:nodesl12:1.2.3.4:6881ee", ""},
+		// Mixed lists are encoded as strings.
+		{"d4:infode5:nodesl12:1.2.3.4:6881l7:1.2.3.5i6882eeee", "d4:infode5:nodesl12:1.2.3.4:688112:1.2.3.5:6882ee"},
+		// Unknown fields go around the pairs.
+		{"d1:ai1e4:infode5:nodesll7:1.2.3.4i6881eee5:nodfzi2e1:zi3ee", ""},
+	} {
+		if tc.out == "" {
+			tc.out = tc.in
+		}
+		var mi MetaInfo
+		require.NoError(t, bencode.Unmarshal([]byte(tc.in), &mi))
+		b, err := bencode.Marshal(mi)
+		require.NoError(t, err)
+		assert.Equal(t, tc.out, string(b))
+	}
+}
+
+func TestAddNode(t *testing.T) {
+	var mi MetaInfo
+	require.NoError(t, mi.AddNode(" [2001:DB8:0::1] ", 6881))
+	require.NoError(t, mi.AddNode("Router.Example.COM.", 6881))
+	require.NoError(t, mi.AddNode("1.2.3.4", 6881))
+	require.NoError(t, mi.AddNode("2001:db8::1", 6881))
+	assert.EqualValues(t, []Node{"[2001:db8::1]:6881", "router.example.com:6881", "1.2.3.4:6881"}, mi.Nodes)
+	for _, tc := range []struct {
+		host string
+		port int
+	}{
+		{"", 6881},
+		{"bad host", 6881},
+		{"-bad.example.com", 6881},
+		{"1.2.3.4", 0},
+		{"1.2.3.4", 65536},
+	} {
+		var target NodeError
+		assert.True(t, errors.As(mi.AddNode(tc.host, tc.port), &target), tc.host)
+	}
+	assert.Len(t, mi.Nodes, 3)
+}
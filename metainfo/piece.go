@@ -1,6 +1,9 @@
 package metainfo
 
 import (
+	"errors"
+	"fmt"
+
 	"github.com/anacrolix/missinggo"
 )
 
@@ -30,3 +33,76 @@ func (p Piece) Hash() (ret Hash) {
 func (p Piece) Index() pieceIndex {
 	return p.i
 }
+
+// Where a v1 piece is and its hash. See Info.PieceSpec.
+type PieceSpec struct {
+	Index  int
+	Offset int64
+	Length int64
+	Hash   Hash
+}
+
+// Returns the v1 piece at index i. Unlike Piece, it's an error if the piece doesn't exist, or the
+// pieces don't pass ValidatePieces, rather than a panic or a piece that doesn't fit the files.
+func (info *Info) PieceSpec(i int) (ret PieceSpec, err error) {
+	if err = info.checkV1Pieces(); err != nil {
+		return
+	}
+	if i < 0 || i >= info.NumPieces() {
+		err = fmt.Errorf("piece %v out of range [0, %v)", i, info.NumPieces())
+		return
+	}
+	p := info.Piece(i)
+	return PieceSpec{Index: i, Offset: p.Offset(), Length: p.Length(), Hash: p.Hash()}, nil
+}
+
+// Returns the v1 piece hashes, in order. It's an error if the pieces don't pass ValidatePieces.
+func (info *Info) PieceHashes() ([]Hash, error) {
+	if err := info.checkV1Pieces(); err != nil {
+		return nil, err
+	}
+	ret := make([]Hash, info.NumPieces())
+	for i := range ret {
+		copy(ret[i][:], info.Pieces[i*HashSize:])
+	}
+	return ret, nil
+}
+
+func (info *Info) checkV1Pieces() error {
+	if !info.HasV1() || info.IsMerkle() {
+		return errors.New("info has no v1 pieces")
+	}
+	return info.ValidatePieces()
+}
+
+// Returns the indices of the pieces of a whose data is also a piece of b, going by their hashes and
+// lengths, so the same data lying on piece boundaries is found wherever it is in each. That means
+// the infos must have the same piece length. Nothing is shared if either info doesn't have valid v1
+// pieces.
+func ComparePieces(a, b *Info) (shared []int) {
+	if a.PieceLength != b.PieceLength {
+		return nil
+	}
+	aHashes, err := a.PieceHashes()
+	if err != nil {
+		return nil
+	}
+	bHashes, err := b.PieceHashes()
+	if err != nil {
+		return nil
+	}
+	type key struct {
+		hash   Hash
+		length int64
+	}
+	inB := make(map[key]struct{}, len(bHashes))
+	for i, h := range bHashes {
+		inB[key{h, b.Piece(i).Length()}] = struct{}{}
+	}
+	for i, h := range aHashes {
+		if _, ok := inB[key{h, a.Piece(i).Length()}]; ok {
+			shared = append(shared, i)
+		}
+	}
+	return
+}
@@ -0,0 +1,130 @@
+package metainfo
+
+// A range of bytes within one of the files of an info.
+type FileExtent struct {
+	// The index of the file in Info.UpvertedFiles.
+	FileIndex int
+	// The offset within the file.
+	Offset int64
+	Length int64
+}
+
+// Returns the parts of the files that make up the piece, in order. Pieces that span files have an
+// extent in each of them, and zero-length files never have any. BEP 47 padding files are included,
+// so the lengths always add up to the length of the piece, unless the info describes less data than
+// its pieces cover. In v2-only infos, each piece is within a single file. Returns nil if the piece
+// doesn't exist.
+func (info *Info) PieceExtents(pieceIndex int) []FileExtent {
+	if pieceIndex < 0 || pieceIndex >= info.NumPieces() {
+		return nil
+	}
+	if !info.HasV1() {
+		e, _ := info.v2PieceExtent(pieceIndex)
+		return []FileExtent{e}
+	}
+	p := info.Piece(pieceIndex)
+	return info.FileExtents(p.Offset(), p.Length())
+}
+
+// Returns the file extents covering n bytes from off in the files of UpvertedFiles taken together.
+// This is how pieces map onto the files of infos with v1 fields. Zero-length files have no extents.
+// Fewer than n bytes are covered if the files end first.
+func (info *Info) FileExtents(off, n int64) (ret []FileExtent) {
+	for i, fi := range info.UpvertedFiles() {
+		if n <= 0 {
+			break
+		}
+		if off >= fi.Length {
+			off -= fi.Length
+			continue
+		}
+		e := FileExtent{FileIndex: i, Offset: off, Length: fi.Length - off}
+		if e.Length > n {
+			e.Length = n
+		}
+		ret = append(ret, e)
+		n -= e.Length
+		off = 0
+	}
+	return
+}
+
+// Calls fn with each of the extents of every piece, as returned by PieceExtents, in order of piece
+// and then offset. It stops early if fn returns false. For infos with v1 fields, the files are only
+// walked once, so this is cheaper than calling PieceExtents for each piece.
+func (info *Info) ForEachPieceExtent(fn func(pieceIndex int, e FileExtent) bool) {
+	if !info.HasV1() {
+		for i, numPieces := 0, info.NumPieces(); i < numPieces; i++ {
+			e, _ := info.v2PieceExtent(i)
+			if !fn(i, e) {
+				return
+			}
+		}
+		return
+	}
+	files := info.UpvertedFiles()
+	fileIndex := 0
+	var fileOff int64
+	for i, numPieces := 0, info.NumPieces(); i < numPieces; i++ {
+		n := info.Piece(i).Length()
+		for n > 0 && fileIndex < len(files) {
+			left := files[fileIndex].Length - fileOff
+			if left <= 0 {
+				fileIndex++
+				fileOff = 0
+				continue
+			}
+			e := FileExtent{FileIndex: fileIndex, Offset: fileOff, Length: left}
+			if e.Length > n {
+				e.Length = n
+			}
+			if !fn(i, e) {
+				return
+			}
+			fileOff += e.Length
+			n -= e.Length
+		}
+	}
+}
+
+// Returns the indices in UpvertedFiles of the zero-length files at the piece, in order. They have no
+// extents, and share their offset with the next file, so this is what decides which piece they go
+// with, for creating them when it's complete. It's the piece their offset is in, or the last piece
+// if they're at the end of the data. Padding files and symlinks aren't included. Nor is anything
+// for v2-only infos, or infos with no pieces: their zero-length files go with no piece.
+func (info *Info) PieceEmptyFiles(pieceIndex int) (ret []int) {
+	info.forEachEmptyFile(func(fileIndex, piece int) {
+		if piece == pieceIndex {
+			ret = append(ret, fileIndex)
+		}
+	})
+	return
+}
+
+// Maps the indices in UpvertedFiles of the zero-length files that go with a piece to that piece.
+// See PieceEmptyFiles.
+func (info *Info) EmptyFilePieces() map[int]int {
+	ret := make(map[int]int)
+	info.forEachEmptyFile(func(fileIndex, pieceIndex int) {
+		ret[fileIndex] = pieceIndex
+	})
+	return ret
+}
+
+func (info *Info) forEachEmptyFile(fn func(fileIndex, pieceIndex int)) {
+	numPieces := info.NumPieces()
+	if !info.HasV1() || numPieces == 0 || info.PieceLength <= 0 {
+		return
+	}
+	var off int64
+	for i, fi := range info.UpvertedFiles() {
+		if fi.Length == 0 && !fi.IsPadding() && !fi.IsSymlink() {
+			piece := int(off / info.PieceLength)
+			if piece >= numPieces {
+				piece = numPieces - 1
+			}
+			fn(i, piece)
+		}
+		off += fi.Length
+	}
+}
@@ -0,0 +1,167 @@
+package metainfo
+
+import (
+	"math/rand"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func extentsTestInfo(pieceLength int64, lengths ...int64) *Info {
+	info := &Info{PieceLength: pieceLength}
+	var total int64
+	for i, l := range lengths {
+		info.Files = append(info.Files, FileInfo{Path: []string{string(rune('a' + i))}, Length: l})
+		total += l
+	}
+	numPieces := (total + pieceLength - 1) / pieceLength
+	info.Pieces = make([]byte, numPieces*HashSize)
+	return info
+}
+
+func TestPieceExtents(t *testing.T) {
+	c := qt.New(t)
+	info := extentsTestInfo(4, 3, 0, 6, 0, 2)
+	c.Check(info.NumPieces(), qt.Equals, 3)
+	c.Check(info.PieceExtents(0), qt.DeepEquals, []FileExtent{
+		{FileIndex: 0, Offset: 0, Length: 3},
+		{FileIndex: 2, Offset: 0, Length: 1},
+	})
+	c.Check(info.PieceExtents(1), qt.DeepEquals, []FileExtent{
+		{FileIndex: 2, Offset: 1, Length: 4},
+	})
+	// The short final piece.
+	c.Check(info.PieceExtents(2), qt.DeepEquals, []FileExtent{
+		{FileIndex: 2, Offset: 5, Length: 1},
+		{FileIndex: 4, Offset: 0, Length: 2},
+	})
+	c.Check(info.PieceExtents(3), qt.IsNil)
+	c.Check(info.PieceExtents(-1), qt.IsNil)
+}
+
+func TestPieceExtentsSingleFile(t *testing.T) {
+	c := qt.New(t)
+	info := &Info{PieceLength: 4, Length: 5, Pieces: make([]byte, 2*HashSize)}
+	c.Check(info.PieceExtents(1), qt.DeepEquals, []FileExtent{{FileIndex: 0, Offset: 4, Length: 1}})
+}
+
+func TestPieceExtentsPadding(t *testing.T) {
+	c := qt.New(t)
+	info := extentsTestInfo(4, 3, 2)
+	info.insertPadFiles()
+	info.Pieces = make([]byte, 2*HashSize)
+	c.Check(info.PieceExtents(0), qt.DeepEquals, []FileExtent{
+		{FileIndex: 0, Offset: 0, Length: 3},
+		{FileIndex: 1, Offset: 0, Length: 1},
+	})
+	c.Check(info.PieceExtents(1), qt.DeepEquals, []FileExtent{
+		{FileIndex: 2, Offset: 0, Length: 2},
+	})
+}
+
+func TestForEachPieceExtentStops(t *testing.T) {
+	c := qt.New(t)
+	info := extentsTestInfo(4, 3, 6)
+	var calls int
+	info.ForEachPieceExtent(func(int, FileExtent) bool {
+		calls++
+		return calls < 2
+	})
+	c.Check(calls, qt.Equals, 2)
+}
+
+// Checks random layouts: the extents of each piece add up to its length, run contiguously through
+// the files, and match between PieceExtents and ForEachPieceExtent.
+func TestPieceExtentsRandomLayouts(t *testing.T) {
+	c := qt.New(t)
+	r := rand.New(rand.NewSource(1))
+	for iter := 0; iter < 500; iter++ {
+		pieceLength := 1 + r.Int63n(64)
+		lengths := make([]int64, 1+r.Intn(8))
+		var total int64
+		for i := range lengths {
+			// Plenty of zero-length files.
+			if r.Intn(3) != 0 {
+				lengths[i] = r.Int63n(200)
+			}
+			total += lengths[i]
+		}
+		if total == 0 {
+			continue
+		}
+		info := extentsTestInfo(pieceLength, lengths...)
+		if r.Intn(2) == 0 {
+			info.insertPadFiles()
+			info.Pieces = make([]byte, (info.TotalLength()+pieceLength-1)/pieceLength*HashSize)
+		}
+		files := info.UpvertedFiles()
+		byPiece := make([][]FileExtent, info.NumPieces())
+		info.ForEachPieceExtent(func(i int, e FileExtent) bool {
+			byPiece[i] = append(byPiece[i], e)
+			return true
+		})
+		var next FileExtent
+		for i := 0; i < info.NumPieces(); i++ {
+			extents := info.PieceExtents(i)
+			c.Assert(byPiece[i], qt.DeepEquals, extents, qt.Commentf("piece %v of %v", i, info))
+			var sum int64
+			for _, e := range extents {
+				c.Assert(e.Length > 0, qt.IsTrue)
+				c.Assert(e.Offset+e.Length <= files[e.FileIndex].Length, qt.IsTrue)
+				if e.FileIndex == next.FileIndex {
+					c.Assert(e.Offset, qt.Equals, next.Offset)
+				} else {
+					c.Assert(e.FileIndex > next.FileIndex, qt.IsTrue)
+					c.Assert(next.Offset, qt.Equals, files[next.FileIndex].Length)
+					c.Assert(e.Offset, qt.Equals, int64(0))
+					for _, fi := range files[next.FileIndex+1 : e.FileIndex] {
+						c.Assert(fi.Length, qt.Equals, int64(0))
+					}
+				}
+				next = FileExtent{FileIndex: e.FileIndex, Offset: e.Offset + e.Length}
+				sum += e.Length
+			}
+			c.Assert(sum, qt.Equals, info.Piece(i).Length())
+		}
+	}
+}
+
+func TestPieceEmptyFilesFirst(t *testing.T) {
+	c := qt.New(t)
+	info := extentsTestInfo(4, 0, 6)
+	c.Check(info.PieceExtents(0), qt.DeepEquals, []FileExtent{{FileIndex: 1, Offset: 0, Length: 4}})
+	c.Check(info.PieceEmptyFiles(0), qt.DeepEquals, []int{0})
+	c.Check(info.PieceEmptyFiles(1), qt.HasLen, 0)
+}
+
+func TestPieceEmptyFilesLast(t *testing.T) {
+	c := qt.New(t)
+	// The empty file is at the end of the data, which is also a piece boundary.
+	info := extentsTestInfo(4, 8, 0)
+	c.Check(info.NumPieces(), qt.Equals, 2)
+	c.Check(info.PieceEmptyFiles(0), qt.HasLen, 0)
+	c.Check(info.PieceEmptyFiles(1), qt.DeepEquals, []int{1})
+	c.Check(info.PieceEmptyFiles(2), qt.HasLen, 0)
+}
+
+func TestPieceEmptyFilesAtBoundary(t *testing.T) {
+	c := qt.New(t)
+	info := extentsTestInfo(4, 4, 0, 0, 0, 3)
+	c.Check(info.PieceExtents(0), qt.DeepEquals, []FileExtent{{FileIndex: 0, Offset: 0, Length: 4}})
+	c.Check(info.PieceExtents(1), qt.DeepEquals, []FileExtent{{FileIndex: 4, Offset: 0, Length: 3}})
+	// They start the next piece, with the file after them.
+	c.Check(info.PieceEmptyFiles(0), qt.HasLen, 0)
+	c.Check(info.PieceEmptyFiles(1), qt.DeepEquals, []int{1, 2, 3})
+	c.Check(info.EmptyFilePieces(), qt.DeepEquals, map[int]int{1: 1, 2: 1, 3: 1})
+}
+
+func TestPieceEmptyFilesWithoutPieces(t *testing.T) {
+	c := qt.New(t)
+	info := extentsTestInfo(4, 0, 0)
+	c.Check(info.NumPieces(), qt.Equals, 0)
+	c.Check(info.EmptyFilePieces(), qt.HasLen, 0)
+	// Symlinks aren't files to create.
+	info = extentsTestInfo(4, 0, 2)
+	info.Files[0].Attr = "l"
+	c.Check(info.EmptyFilePieces(), qt.HasLen, 0)
+}
@@ -0,0 +1,20 @@
+package metainfo
+
+const (
+	minChosenPieceLength = 16 << 10
+	maxChosenPieceLength = 16 << 20
+	// Piece lengths are chosen to give at most this many pieces, so between half this and this,
+	// unless the piece length is at a limit.
+	maxChosenPieces = 2000
+)
+
+// Returns a piece length suited to content of the given total length. It's the smallest power of
+// two from 16 KiB that gives at most 2000 pieces, up to 16 MiB. The result is always a valid v2
+// piece length. The builder uses this if Info.PieceLength is zero.
+func ChoosePieceLength(totalLength int64) int64 {
+	pieceLength := int64(minChosenPieceLength)
+	for pieceLength < maxChosenPieceLength && (totalLength+pieceLength-1)/pieceLength > maxChosenPieces {
+		pieceLength *= 2
+	}
+	return pieceLength
+}
@@ -0,0 +1,53 @@
+package metainfo
+
+import (
+	"context"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+// These choices change infohashes, so they mustn't change.
+func TestChoosePieceLength(t *testing.T) {
+	const (
+		KiB = 1 << 10
+		MiB = 1 << 20
+		MB  = 1000 * 1000
+		GB  = 1000 * MB
+	)
+	for _, tc := range []struct {
+		totalLength int64
+		expected    int64
+	}{
+		{0, 16 * KiB},
+		{1, 16 * KiB},
+		{1 * MB, 16 * KiB},
+		{2000 * 16 * KiB, 16 * KiB},
+		{2000*16*KiB + 1, 32 * KiB},
+		{10 * MB, 16 * KiB},
+		{100 * MB, 64 * KiB},
+		{700 * MB, 512 * KiB},
+		{1 * GB, 512 * KiB},
+		{1 << 30, 1 * MiB},
+		{4700 * MB, 4 * MiB},
+		{10 * GB, 8 * MiB},
+		{100 * GB, 16 * MiB},
+		{1000 * GB, 16 * MiB},
+		{1 << 40, 16 * MiB},
+	} {
+		actual := ChoosePieceLength(tc.totalLength)
+		qt.Check(t, actual, qt.Equals, tc.expected, qt.Commentf("total length %v", tc.totalLength))
+		qt.Check(t, checkV2PieceLength(actual), qt.IsNil)
+	}
+}
+
+func TestBuildChoosesPieceLength(t *testing.T) {
+	c := qt.New(t)
+	root := c.Mkdir()
+	writeTreeFiles(c, root, pathFiles("a"))
+	var info Info
+	_, err := info.BuildFromFilePathOpts(context.Background(), root, BuildFromFilePathOpts{Version: InfoVersionHybrid})
+	c.Assert(err, qt.IsNil)
+	c.Check(info.PieceLength, qt.Equals, int64(minChosenPieceLength))
+	c.Check(info.NumPieces(), qt.Equals, 1)
+}
@@ -0,0 +1,56 @@
+package metainfo
+
+import (
+	"errors"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestPieceSpec(t *testing.T) {
+	c := qt.New(t)
+	info, _ := buildVerifyTestInfo(c)
+	hashes, err := info.PieceHashes()
+	c.Assert(err, qt.IsNil)
+	c.Assert(hashes, qt.HasLen, 6)
+	last, err := info.PieceSpec(5)
+	c.Assert(err, qt.IsNil)
+	c.Check(last, qt.Equals, PieceSpec{Index: 5, Offset: 5 * 16384, Length: 100, Hash: hashes[5]})
+	first, err := info.PieceSpec(0)
+	c.Assert(err, qt.IsNil)
+	c.Check(first.Length, qt.Equals, int64(16384))
+	c.Check(first.Hash, qt.Equals, info.Piece(0).Hash())
+	_, err = info.PieceSpec(6)
+	c.Check(err, qt.ErrorMatches, `piece 6 out of range \[0, 6\)`)
+	_, err = info.PieceSpec(-1)
+	c.Check(err, qt.Not(qt.IsNil))
+	// A truncated pieces field.
+	info.Pieces = info.Pieces[:len(info.Pieces)-1]
+	_, err = info.PieceSpec(5)
+	c.Check(errors.As(err, new(PiecesLengthError)), qt.IsTrue)
+	_, err = info.PieceHashes()
+	c.Check(errors.As(err, new(PiecesLengthError)), qt.IsTrue)
+}
+
+func TestComparePieces(t *testing.T) {
+	c := qt.New(t)
+	opts := BuildFromFilePathOpts{PadFiles: true}
+	a := buildCompareInfo(c, opts, map[string][]byte{
+		"x": fileData(40000, 1),
+		"y": fileData(20000, 2),
+	})
+	// x is preceded by another file here, but padding keeps it on piece boundaries.
+	b := buildCompareInfo(c, opts, map[string][]byte{
+		"w": fileData(100, 3),
+		"x": fileData(40000, 1),
+		"y": fileData(20000, 4),
+	})
+	c.Check(ComparePieces(a, b), qt.DeepEquals, []int{0, 1, 2})
+	c.Check(ComparePieces(b, a), qt.DeepEquals, []int{1, 2, 3})
+	other := *b
+	other.PieceLength *= 2
+	c.Check(ComparePieces(a, &other), qt.HasLen, 0)
+	other = *b
+	other.Pieces = other.Pieces[:1]
+	c.Check(ComparePieces(a, &other), qt.HasLen, 0)
+}
@@ -3,14 +3,30 @@ package metainfo
 import (
 	"crypto/sha1"
 	"io"
+	"sync"
 )
 
 func GeneratePieces(r io.Reader, pieceLength int64, b []byte) ([]byte, error) {
+	return generatePieces(r, pieceLength, b, func(int64) error { return nil })
+}
+
+// onPiece is called with the length of each piece after it's hashed. Generation stops if it returns
+// an error.
+func generatePieces(r io.Reader, pieceLength int64, b []byte, onPiece func(length int64) error) ([]byte, error) {
+	// Reused for each piece. The LimitReader hides any WriterTo, so the buffer is used.
+	buf := make([]byte, 32<<10)
+	h := sha1.New()
 	for {
-		h := sha1.New()
-		written, err := io.CopyN(h, r, pieceLength)
+		h.Reset()
+		written, err := io.CopyBuffer(h, io.LimitReader(r, pieceLength), buf)
+		if err == nil && written < pieceLength {
+			err = io.EOF
+		}
 		if written > 0 {
 			b = h.Sum(b)
+			if err := onPiece(written); err != nil {
+				return b, err
+			}
 		}
 		if err == io.EOF {
 			return b, nil
@@ -20,3 +36,103 @@ func GeneratePieces(r io.Reader, pieceLength int64, b []byte) ([]byte, error) {
 		}
 	}
 }
+
+// Like GeneratePieces, but hashes up to workers pieces of the length bytes in r concurrently. The
+// output is identical to GeneratePieces. If r is only an io.Reader, the pieces are hashed
+// sequentially. An io.ReaderAt is read from offset 0, regardless of any io.Reader position.
+func GeneratePiecesParallel(r io.Reader, length, pieceLength int64, workers int, b []byte) ([]byte, error) {
+	onPiece := func(int64) error { return nil }
+	if ra, ok := r.(io.ReaderAt); ok && workers > 1 {
+		return generatePiecesParallel(ra, length, pieceLength, workers, b, onPiece)
+	}
+	return generatePieces(io.LimitReader(r, length), pieceLength, b, onPiece)
+}
+
+// onPiece is called from a single goroutine, in the order pieces complete, which may differ from
+// their order in the output.
+func generatePiecesParallel(
+	r io.ReaderAt, length, pieceLength int64, workers int, b []byte, onPiece func(length int64) error,
+) (
+	[]byte, error,
+) {
+	numPieces := (length + pieceLength - 1) / pieceLength
+	bufLength := pieceLength
+	if length < bufLength {
+		bufLength = length
+	}
+	start := len(b)
+	b = append(b, make([]byte, numPieces*sha1.Size)...)
+	type result struct {
+		length int64
+		err    error
+	}
+	var (
+		indexes = make(chan int64)
+		results = make(chan result)
+		// Closed to stop the feeder and workers early.
+		stop = make(chan struct{})
+		wg   sync.WaitGroup
+	)
+	go func() {
+		defer close(indexes)
+		for i := int64(0); i < numPieces; i++ {
+			select {
+			case indexes <- i:
+			case <-stop:
+				return
+			}
+		}
+	}()
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			h := sha1.New()
+			// Each piece is read whole, so each file in it is read once.
+			buf := make([]byte, bufLength)
+			for i := range indexes {
+				off := i * pieceLength
+				n := pieceLength
+				if length-off < n {
+					n = length - off
+				}
+				h.Reset()
+				read, err := r.ReadAt(buf[:n], off)
+				if int64(read) == n {
+					err = nil
+				} else if err == nil || err == io.EOF {
+					err = io.ErrUnexpectedEOF
+				}
+				if err == nil {
+					h.Write(buf[:n])
+					pieceStart := start + int(i)*sha1.Size
+					copy(b[pieceStart:], h.Sum(nil))
+				}
+				select {
+				case results <- result{n, err}:
+				case <-stop:
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+	var err error
+	for res := range results {
+		if err != nil {
+			// Draining until the workers have returned.
+			continue
+		}
+		err = res.err
+		if err == nil {
+			err = onPiece(res.length)
+		}
+		if err != nil {
+			close(stop)
+		}
+	}
+	return b, err
+}
@@ -0,0 +1,163 @@
+package metainfo
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"math/rand"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"testing"
+	"testing/fstest"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestGeneratePiecesParallelMatchesSequential(t *testing.T) {
+	c := qt.New(t)
+	data := make([]byte, 100003)
+	rand.New(rand.NewSource(1)).Read(data)
+	for _, pieceLength := range []int64{1 << 10, 1 << 14, 100003, 1 << 17} {
+		expected, err := GeneratePieces(bytes.NewReader(data), pieceLength, nil)
+		c.Assert(err, qt.IsNil)
+		for _, workers := range []int{1, 2, 7} {
+			actual, err := GeneratePiecesParallel(bytes.NewReader(data), int64(len(data)), pieceLength, workers, nil)
+			c.Assert(err, qt.IsNil)
+			c.Check(actual, qt.DeepEquals, expected, qt.Commentf("piece length %v, %v workers", pieceLength, workers))
+		}
+	}
+}
+
+func TestGeneratePiecesParallelShortInput(t *testing.T) {
+	_, err := GeneratePiecesParallel(bytes.NewReader(make([]byte, 10)), 20, 4, 4, nil)
+	qt.Assert(t, err, qt.Not(qt.IsNil))
+}
+
+func TestBuildFromFilePathParallel(t *testing.T) {
+	c := qt.New(t)
+	root := t.TempDir()
+	r := rand.New(rand.NewSource(2))
+	for i, l := range []int{0, 1000, 5, 70000} {
+		b := make([]byte, l)
+		r.Read(b)
+		c.Assert(ioutil.WriteFile(filepath.Join(root, fmt.Sprint(i)), b, 0o600), qt.IsNil)
+	}
+	var sequential Info
+	sequential.PieceLength = 1 << 14
+	c.Assert(sequential.BuildFromFilePath(root), qt.IsNil)
+	for _, version := range []InfoVersion{InfoVersionV1, InfoVersionHybrid} {
+		parallel := Info{PieceLength: 1 << 14}
+		_, err := parallel.BuildFromFilePathOpts(context.Background(), root, BuildFromFilePathOpts{
+			Version:      version,
+			PieceHashers: 3,
+		})
+		c.Assert(err, qt.IsNil)
+		if version == InfoVersionV1 {
+			c.Check(parallel, qt.DeepEquals, sequential)
+		}
+		c.Check(parallel.NumPieces(), qt.Equals, int(
+			(parallel.TotalLength()+parallel.PieceLength-1)/parallel.PieceLength))
+	}
+}
+
+// Counts the regular files open at once, and fails opens beyond a limit, like a low descriptor
+// ulimit.
+type openLimitFS struct {
+	fs.FS
+	limit int
+	mu    sync.Mutex
+	open  int
+	peak  int
+}
+
+func (me *openLimitFS) Open(name string) (fs.File, error) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	if me.open == me.limit {
+		return nil, errors.New("too many open files")
+	}
+	f, err := me.FS.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	if fi, err := f.Stat(); err != nil || fi.IsDir() {
+		// Only files being hashed are counted.
+		return f, err
+	}
+	me.open++
+	if me.open > me.peak {
+		me.peak = me.open
+	}
+	return &openLimitFile{f.(readerAtFile), me}, nil
+}
+
+type readerAtFile interface {
+	fs.File
+	io.ReaderAt
+}
+
+type openLimitFile struct {
+	readerAtFile
+	fs *openLimitFS
+}
+
+func (me *openLimitFile) Close() error {
+	me.fs.mu.Lock()
+	me.fs.open--
+	me.fs.mu.Unlock()
+	return me.readerAtFile.Close()
+}
+
+func TestBuildManySmallFilesOpenLimit(t *testing.T) {
+	c := qt.New(t)
+	mapFS := fstest.MapFS{}
+	r := rand.New(rand.NewSource(3))
+	for i := 0; i < 5000; i++ {
+		b := make([]byte, r.Intn(20))
+		r.Read(b)
+		mapFS[fmt.Sprintf("root/%04d", i)] = &fstest.MapFile{Data: b}
+	}
+	var expected Info
+	_, err := expected.BuildFromFS(context.Background(), mapFS, "root", BuildFromFilePathOpts{})
+	c.Assert(err, qt.IsNil)
+	// Pieces span hundreds of files.
+	c.Assert(expected.PieceLength, qt.Equals, int64(16384))
+	for _, workers := range []int{1, 8} {
+		fsys := &openLimitFS{FS: mapFS, limit: 4}
+		var info Info
+		_, err := info.BuildFromFS(context.Background(), fsys, "root", BuildFromFilePathOpts{
+			PieceHashers: workers,
+			MaxOpenFiles: 4,
+		})
+		c.Assert(err, qt.IsNil)
+		c.Check(info.Pieces, qt.DeepEquals, expected.Pieces)
+		c.Check(fsys.peak <= 4, qt.IsTrue, qt.Commentf("%v open at once", fsys.peak))
+		c.Check(fsys.open, qt.Equals, 0)
+	}
+}
+
+// A synthetic input, large enough to show the benefit of more workers.
+const benchmarkGeneratePiecesLength = 4 << 30
+
+func benchmarkGeneratePiecesParallel(b *testing.B, workers int) {
+	b.SetBytes(benchmarkGeneratePiecesLength)
+	for i := 0; i < b.N; i++ {
+		_, err := GeneratePiecesParallel(zeroFile{}, benchmarkGeneratePiecesLength, 1<<18, workers, nil)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkGeneratePiecesOneWorker(b *testing.B) {
+	benchmarkGeneratePiecesParallel(b, 1)
+}
+
+func BenchmarkGeneratePiecesNumCPUWorkers(b *testing.B) {
+	benchmarkGeneratePiecesParallel(b, runtime.NumCPU())
+}
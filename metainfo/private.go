@@ -0,0 +1,57 @@
+package metainfo
+
+import "errors"
+
+// Something a private torrent has that trackers for private torrents usually forbid. BEP 27.
+type PrivateError struct {
+	Reason string
+}
+
+func (me PrivateError) Error() string {
+	return "private torrent " + me.Reason
+}
+
+// Sets or clears the BEP 27 private flag in the info. The info bytes are encoded again, so the
+// infohash changes. Clearing the flag removes the private field, rather than setting it to 0. The
+// rest of the info is kept byte for byte, as with InfoDict.
+func (mi *MetaInfo) SetPrivate(private bool) error {
+	b, err := editInfoDict(mi.InfoBytes, func(d *InfoDict) error {
+		if !private {
+			d.Delete("private")
+			return nil
+		}
+		return d.Set("private", 1)
+	})
+	if err != nil {
+		return err
+	}
+	mi.SetInfoBytes(b)
+	return nil
+}
+
+// Checks a private torrent for peer sources other than trackers, and for having no trackers at all.
+// The problems found are returned together as PrivateErrors, joined with errors.Join. Nothing is
+// checked if the info isn't private.
+func (mi *MetaInfo) CheckPrivate() error {
+	info, err := mi.Info()
+	if err != nil {
+		return InfoDecodeError{err}
+	}
+	if !info.IsPrivate() {
+		return nil
+	}
+	var errs []error
+	if len(mi.UpvertedAnnounceList()) == 0 {
+		errs = append(errs, PrivateError{"has no trackers"})
+	}
+	if len(mi.Nodes) != 0 {
+		errs = append(errs, PrivateError{"has DHT nodes"})
+	}
+	if len(mi.UrlList) != 0 {
+		errs = append(errs, PrivateError{"has url-list webseeds"})
+	}
+	if len(mi.HttpSeeds) != 0 {
+		errs = append(errs, PrivateError{"has httpseeds"})
+	}
+	return errors.Join(errs...)
+}
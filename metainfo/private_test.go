@@ -0,0 +1,63 @@
+package metainfo
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/anacrolix/torrent/bencode"
+)
+
+func TestBuildPrivate(t *testing.T) {
+	c := qt.New(t)
+	root := filepath.Join(c.Mkdir(), "file")
+	c.Assert(os.WriteFile(root, []byte("hello"), 0o644), qt.IsNil)
+	var info Info
+	_, err := info.BuildFromFilePathOpts(context.Background(), root, BuildFromFilePathOpts{Private: true})
+	c.Assert(err, qt.IsNil)
+	c.Check(info.IsPrivate(), qt.IsTrue)
+	mi := MetaInfo{InfoBytes: bencode.MustMarshal(info)}
+	c.Check(string(mi.InfoBytes), qt.Contains, "7:privatei1e")
+}
+
+func TestSetPrivate(t *testing.T) {
+	c := qt.New(t)
+	mi := MetaInfo{InfoBytes: bencode.MustMarshal(Info{Name: "x", Pieces: make([]byte, HashSize), PieceLength: 1, Length: 1})}
+	public := mi.HashInfoBytes()
+	c.Assert(mi.SetPrivate(true), qt.IsNil)
+	c.Check(mi.HashInfoBytes(), qt.Not(qt.Equals), public)
+	info, err := mi.UnmarshalInfo()
+	c.Assert(err, qt.IsNil)
+	c.Check(info.IsPrivate(), qt.IsTrue)
+	c.Assert(mi.SetPrivate(false), qt.IsNil)
+	c.Check(mi.HashInfoBytes(), qt.Equals, public)
+}
+
+func TestCheckPrivate(t *testing.T) {
+	c := qt.New(t)
+	mi := MetaInfo{
+		InfoBytes: bencode.MustMarshal(Info{Name: "x", Pieces: make([]byte, HashSize), PieceLength: 1, Length: 1}),
+		Nodes:     []Node{"1.2.3.4:6881"},
+		UrlList:   UrlList{"http://a/"},
+	}
+	// Anything goes for public torrents.
+	c.Check(mi.CheckPrivate(), qt.IsNil)
+	c.Assert(mi.SetPrivate(true), qt.IsNil)
+	err := mi.CheckPrivate()
+	c.Check(err, qt.ErrorMatches, "private torrent has no trackers\n"+
+		"private torrent has DHT nodes\n"+
+		"private torrent has url-list webseeds")
+	var target PrivateError
+	c.Check(errors.As(err, &target), qt.IsTrue)
+	mi.Nodes = nil
+	mi.UrlList = nil
+	mi.HttpSeeds = UrlList{"http://b/"}
+	mi.SetAnnounceList([][]string{{"http://tracker/announce"}})
+	c.Check(mi.CheckPrivate(), qt.ErrorMatches, "private torrent has httpseeds")
+	mi.HttpSeeds = nil
+	c.Check(mi.CheckPrivate(), qt.IsNil)
+}
@@ -0,0 +1,185 @@
+package metainfo
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/anacrolix/torrent/bencode"
+)
+
+// Returned by Repiece when the data doesn't match the pieces of the original info.
+type BadPiecesError struct {
+	// The indices of the pieces that failed, in order.
+	Indices []int
+	// The number of pieces in the original info.
+	NumPieces int
+}
+
+func (me BadPiecesError) Error() string {
+	return fmt.Sprintf("%d of %d pieces failed verification, first %d", len(me.Indices), me.NumPieces, me.Indices[0])
+}
+
+// Returns a copy of the MetaInfo with the info hashed again using a different piece length. root is
+// where the data is, as for VerifyData. The data is checked against the current pieces first, and a
+// BadPiecesError is returned if any of them fail. Everything else in the info, including the name,
+// the file order, the private and source fields, and keys Info doesn't know, is kept. Padding files
+// are redone for the new piece length, and hybrid infos get new v2 fields and piece layers. The
+// infohashes of the original and new infos are returned too.
+func (mi *MetaInfo) Repiece(ctx context.Context, root string, pieceLength int64) (
+	ret *MetaInfo, oldInfoHash, newInfoHash Hash, err error,
+) {
+	info, err := mi.UnmarshalInfo()
+	if err != nil {
+		err = fmt.Errorf("unmarshalling info: %w", err)
+		return
+	}
+	if !info.HasV1() {
+		err = errors.New("v2-only infos can't be re-pieced")
+		return
+	}
+	if pieceLength <= 0 {
+		err = PieceLengthError{pieceLength, "not positive"}
+		return
+	}
+	hybrid := info.HasV2()
+	if hybrid {
+		err = checkV2PieceLength(pieceLength)
+		if err != nil {
+			return
+		}
+	}
+	good, err := VerifyData(ctx, &info, root, VerifyOpts{})
+	if err != nil {
+		err = fmt.Errorf("verifying data: %w", err)
+		return
+	}
+	var bad []int
+	for i, ok := range good {
+		if !ok {
+			bad = append(bad, i)
+		}
+	}
+	if len(bad) != 0 {
+		err = BadPiecesError{bad, len(good)}
+		return
+	}
+	newInfo := info
+	newInfo.PieceLength = pieceLength
+	newInfo.Pieces = nil
+	padded := false
+	newInfo.Files = nil
+	for _, fi := range info.Files {
+		if fi.hasPaddingAttr() {
+			padded = true
+			continue
+		}
+		newInfo.Files = append(newInfo.Files, fi)
+	}
+	if padded || hybrid {
+		newInfo.insertPadFiles()
+	}
+	open := func(fi FileInfo) (io.ReadCloser, error) {
+		path, err := newInfo.dataFilePath(root, &fi)
+		if err != nil {
+			return nil, err
+		}
+		return os.Open(path)
+	}
+	progress := hashProgress{ctx: ctx}
+	var pieceLayers map[string]string
+	if hybrid {
+		pieceLayers, err = newInfo.generateV2(open, &progress)
+		if err != nil {
+			err = fmt.Errorf("error generating v2 fields: %w", err)
+			return
+		}
+	}
+	err = newInfo.generatePieces(open, &progress, 1, 0)
+	if err != nil {
+		err = fmt.Errorf("error generating pieces: %w", err)
+		return
+	}
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	// Only the fields that depend on the piece length are replaced.
+	b, err := editInfoDict(mi.InfoBytes, func(d *InfoDict) error {
+		if err := d.Set("piece length", newInfo.PieceLength); err != nil {
+			return err
+		}
+		if err := d.Set("pieces", newInfo.Pieces); err != nil {
+			return err
+		}
+		if padded || hybrid {
+			if err := setRepiecedFiles(d, newInfo.Files); err != nil {
+				return err
+			}
+		}
+		if hybrid {
+			return d.Set("file tree", newInfo.FileTree)
+		}
+		return nil
+	})
+	if err != nil {
+		err = fmt.Errorf("editing info: %w", err)
+		return
+	}
+	copied := *mi
+	ret = &copied
+	ret.SetInfoBytes(b)
+	if hybrid {
+		ret.PieceLayers = pieceLayers
+	}
+	return ret, mi.HashInfoBytes(), ret.HashInfoBytes(), nil
+}
+
+// Sets the files in the info dict to files, which are the original files with the padding redone.
+// Only the padding entries are encoded again: the others keep their original bytes, so that keys and
+// values Info doesn't decode survive. The files are left alone if the padding didn't change.
+func setRepiecedFiles(d *InfoDict, files []FileInfo) error {
+	var old []bencode.Bytes
+	_, err := d.Unmarshal("files", &old)
+	if err != nil {
+		return fmt.Errorf("unmarshalling files: %w", err)
+	}
+	var kept []bencode.Bytes
+	for _, b := range old {
+		var fi FileInfo
+		err = bencode.Unmarshal(b, &fi)
+		if err != nil {
+			return fmt.Errorf("unmarshalling file: %w", err)
+		}
+		if !fi.hasPaddingAttr() {
+			kept = append(kept, b)
+		}
+	}
+	var entries []bencode.Bytes
+	for _, fi := range files {
+		if !fi.hasPaddingAttr() {
+			entries = append(entries, kept[0])
+			kept = kept[1:]
+			continue
+		}
+		b, err := bencode.Marshal(fi)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, b)
+	}
+	if len(entries) == len(old) {
+		changed := false
+		for i := range entries {
+			if !bytes.Equal(entries[i], old[i]) {
+				changed = true
+			}
+		}
+		if !changed {
+			return nil
+		}
+	}
+	return d.Set("files", entries)
+}
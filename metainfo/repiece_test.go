@@ -0,0 +1,161 @@
+package metainfo
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/anacrolix/torrent/bencode"
+)
+
+func TestRepiece(t *testing.T) {
+	c := qt.New(t)
+	info, root := buildVerifyTestInfo(c)
+	private := true
+	info.Private = &private
+	info.Source = "tracker"
+	mi := MetaInfo{Announce: "http://example.com/announce", Comment: "hello"}
+	var err error
+	mi.InfoBytes, err = bencode.Marshal(info)
+	c.Assert(err, qt.IsNil)
+	// Keys Info doesn't know survive.
+	mi.InfoBytes, err = editInfoDict(mi.InfoBytes, func(d *InfoDict) error {
+		return d.Set("x_cross_seed", "abc")
+	})
+	c.Assert(err, qt.IsNil)
+	ret, oldHash, newHash, err := mi.Repiece(context.Background(), root, 32768)
+	c.Assert(err, qt.IsNil)
+	c.Check(oldHash, qt.Equals, mi.HashInfoBytes())
+	c.Check(newHash, qt.Equals, ret.HashInfoBytes())
+	c.Check(newHash, qt.Not(qt.Equals), oldHash)
+	c.Check(ret.Announce, qt.Equals, mi.Announce)
+	c.Check(ret.Comment, qt.Equals, mi.Comment)
+	newInfo, err := ret.UnmarshalInfo()
+	c.Assert(err, qt.IsNil)
+	c.Check(newInfo.PieceLength, qt.Equals, int64(32768))
+	c.Check(newInfo.Name, qt.Equals, info.Name)
+	c.Check(newInfo.IsPrivate(), qt.IsTrue)
+	c.Check(newInfo.Source, qt.Equals, "tracker")
+	d, err := ParseInfoDict(ret.InfoBytes)
+	c.Assert(err, qt.IsNil)
+	var crossSeed string
+	ok, err := d.Unmarshal("x_cross_seed", &crossSeed)
+	c.Assert(err, qt.IsNil)
+	c.Check(ok, qt.IsTrue)
+	c.Check(crossSeed, qt.Equals, "abc")
+	var paths []string
+	for _, fi := range newInfo.Files {
+		paths = append(paths, fi.DisplayPath(&newInfo))
+	}
+	// Padding is redone for the new piece length.
+	c.Check(paths, qt.DeepEquals, []string{"a", ".pad/25536", "b", ".pad/12768", "c"})
+	good, err := VerifyData(context.Background(), &newInfo, root, VerifyOpts{})
+	c.Assert(err, qt.IsNil)
+	c.Check(good, qt.DeepEquals, allGood(newInfo.NumPieces()))
+	// The original is untouched.
+	c.Check(mi.HashInfoBytes(), qt.Equals, oldHash)
+}
+
+func TestRepieceHybrid(t *testing.T) {
+	c := qt.New(t)
+	_, root := buildVerifyTestInfo(c)
+	var info Info
+	info.PieceLength = 16384
+	pieceLayers, err := info.BuildFromFilePathOpts(context.Background(), root, BuildFromFilePathOpts{
+		Version: InfoVersionHybrid,
+	})
+	c.Assert(err, qt.IsNil)
+	mi := MetaInfo{PieceLayers: pieceLayers}
+	mi.InfoBytes, err = bencode.Marshal(info)
+	c.Assert(err, qt.IsNil)
+	_, _, _, err = mi.Repiece(context.Background(), root, 20000)
+	c.Check(err, qt.ErrorMatches, "v2 piece length must be .*")
+	ret, _, _, err := mi.Repiece(context.Background(), root, 32768)
+	c.Assert(err, qt.IsNil)
+	newInfo, err := ret.UnmarshalInfo()
+	c.Assert(err, qt.IsNil)
+	c.Check(newInfo.HasV2(), qt.IsTrue)
+	c.Check(newInfo.PieceLength, qt.Equals, int64(32768))
+	c.Check(ret.PieceLayers, qt.Not(qt.DeepEquals), mi.PieceLayers)
+	good, err := VerifyData(context.Background(), &newInfo, root, VerifyOpts{})
+	c.Assert(err, qt.IsNil)
+	c.Check(good, qt.DeepEquals, allGood(newInfo.NumPieces()))
+}
+
+func TestRepieceBadData(t *testing.T) {
+	c := qt.New(t)
+	info, root := buildVerifyTestInfo(c)
+	var mi MetaInfo
+	var err error
+	mi.InfoBytes, err = bencode.Marshal(info)
+	c.Assert(err, qt.IsNil)
+	f, err := os.OpenFile(filepath.Join(root, "b"), os.O_WRONLY, 0)
+	c.Assert(err, qt.IsNil)
+	_, err = f.WriteAt([]byte("corrupt"), 100)
+	c.Assert(err, qt.IsNil)
+	c.Assert(f.Close(), qt.IsNil)
+	ret, _, _, err := mi.Repiece(context.Background(), root, 32768)
+	c.Check(ret, qt.IsNil)
+	var bad BadPiecesError
+	c.Assert(errors.As(err, &bad), qt.IsTrue)
+	c.Check(bad, qt.DeepEquals, BadPiecesError{Indices: []int{3}, NumPieces: 6})
+	c.Check(err, qt.ErrorMatches, "1 of 6 pieces failed verification, first 3")
+	_, _, _, err = mi.Repiece(context.Background(), root, 0)
+	c.Check(err, qt.Not(qt.IsNil))
+}
+
+func TestRepieceKeepsFileEntries(t *testing.T) {
+	c := qt.New(t)
+	info, root := buildVerifyTestInfo(c)
+	var mi MetaInfo
+	var err error
+	mi.InfoBytes, err = bencode.Marshal(info)
+	c.Assert(err, qt.IsNil)
+	// Per-file keys Info doesn't know, and an mtime it can't decode.
+	mi.InfoBytes, err = editInfoDict(mi.InfoBytes, func(d *InfoDict) error {
+		var files []map[string]interface{}
+		if _, err := d.Unmarshal("files", &files); err != nil {
+			return err
+		}
+		files[0]["crc32"] = "0a1b2c3d"
+		files[4]["mtime"] = "yesterday"
+		return d.Set("files", files)
+	})
+	c.Assert(err, qt.IsNil)
+	rawFiles := func(infoBytes []byte) (ret []bencode.Bytes) {
+		d, err := ParseInfoDict(infoBytes)
+		c.Assert(err, qt.IsNil)
+		_, err = d.Unmarshal("files", &ret)
+		c.Assert(err, qt.IsNil)
+		return
+	}
+	before := rawFiles(mi.InfoBytes)
+	ret, _, _, err := mi.Repiece(context.Background(), root, 32768)
+	c.Assert(err, qt.IsNil)
+	after := rawFiles(ret.InfoBytes)
+	c.Assert(after, qt.HasLen, 5)
+	c.Check(after[0], qt.DeepEquals, before[0])
+	c.Check(after[2], qt.DeepEquals, before[2])
+	c.Check(after[4], qt.DeepEquals, before[4])
+	c.Check(after[1], qt.Not(qt.DeepEquals), before[1])
+	// The files aren't encoded again if the padding is the same.
+	ret, _, _, err = mi.Repiece(context.Background(), root, 16384)
+	c.Assert(err, qt.IsNil)
+	c.Check(ret.InfoBytes, qt.DeepEquals, mi.InfoBytes)
+}
+
+func TestRepieceOutsideRoot(t *testing.T) {
+	c := qt.New(t)
+	info, root := buildVerifyTestInfo(c)
+	info.Files[len(info.Files)-1].Path = []string{"..", "c"}
+	var mi MetaInfo
+	var err error
+	mi.InfoBytes, err = bencode.Marshal(info)
+	c.Assert(err, qt.IsNil)
+	_, _, _, err = mi.Repiece(context.Background(), root, 32768)
+	c.Check(errors.As(err, new(FilePathError)), qt.IsTrue, qt.Commentf("%v", err))
+}
@@ -0,0 +1,323 @@
+package metainfo
+
+import (
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// The longest path component, in bytes, that's safe on common filesystems.
+const MaxPathComponentLength = 255
+
+// What Info.SanitizePaths does with unsafe path components.
+type PathPolicy int
+
+const (
+	// Unsafe components are an error.
+	PathReject PathPolicy = iota
+	// Offending characters are percent-encoded. Components that are unsafe as a whole, like ".." or
+	// a reserved name, have their first character encoded.
+	PathEscape
+	// Unsafe components are removed.
+	PathStrip
+)
+
+// Names that Windows reserves for devices, with or without an extension, in any case.
+var windowsReservedNames = func() map[string]bool {
+	ret := map[string]bool{"CON": true, "PRN": true, "AUX": true, "NUL": true}
+	for i := '1'; i <= '9'; i++ {
+		ret["COM"+string(i)] = true
+		ret["LPT"+string(i)] = true
+	}
+	return ret
+}()
+
+// Returns the path of the file relative to the torrent's directory, using the OS separator, or a
+// FilePathError if any component isn't safe to create. Components are checked the same way on every
+// OS, so that a torrent considered safe anywhere is safe everywhere. LocalPath, which storage uses,
+// only refuses paths that escape their directory, so this is for refusing torrents up front.
+func (fi *FileInfo) SafePath() (string, error) {
+	if len(fi.Path) == 0 {
+		return "", FilePathError{fi.Path, "empty"}
+	}
+	for _, comp := range fi.Path {
+		if reason := unsafeComponentReason(comp); reason != "" {
+			return "", FilePathError{fi.Path, reason}
+		}
+	}
+	return filepath.Join(fi.Path...), nil
+}
+
+// Combines path components into a path relative to a directory, that's safe to create under it on
+// this OS. It's how storage, and reading data such as with VerifyData, find the files of an info.
+// Absolute components, and ".." between slashes of either kind, are a FilePathError. Empty and "."
+// components are skipped. Other components that can't be created as they are on this OS are
+// mapped to a safe local name, so that names that are only unsafe elsewhere, and names that aren't
+// UTF-8, are used as they are: only NUL is escaped, except on Windows, where components are escaped
+// as under PathEscape.
+func LocalPath(components ...string) (string, error) {
+	safeComps := make([]string, 0, len(components))
+	for _, comp := range components {
+		if isAbsComponent(comp) {
+			return "", FilePathError{components, "absolute component"}
+		}
+		for _, part := range strings.FieldsFunc(comp, isSlash) {
+			if part == ".." {
+				return "", FilePathError{components, "parent directory component"}
+			}
+		}
+		if comp == "" || comp == "." {
+			continue
+		}
+		safeComps = append(safeComps, localSafeComponent(comp))
+	}
+	return filepath.Join(safeComps...), nil
+}
+
+func isSlash(r rune) bool {
+	return r == '/' || r == '\\'
+}
+
+func isAbsComponent(comp string) bool {
+	return strings.HasPrefix(comp, "/") || strings.HasPrefix(comp, `\`) ||
+		filepath.IsAbs(comp) || filepath.VolumeName(comp) != ""
+}
+
+// Windows refuses many names that other OSes allow. Elsewhere only NUL can't be in a name.
+func localSafeComponent(comp string) string {
+	if runtime.GOOS == "windows" {
+		if unsafeComponentReason(comp) == "" {
+			return comp
+		}
+		return escapeComponent(comp)
+	}
+	return strings.ReplaceAll(comp, "\x00", "%00")
+}
+
+// Returns why the path component is unsafe to create as a file or directory, or "".
+func unsafeComponentReason(comp string) string {
+	switch comp {
+	case "":
+		return "empty component"
+	case ".":
+		return "current directory component"
+	case "..":
+		return "parent directory component"
+	}
+	if !utf8.ValidString(comp) {
+		return "invalid UTF-8"
+	}
+	for _, r := range comp {
+		if reason := unsafeRuneReason(r); reason != "" {
+			return reason
+		}
+	}
+	if isWindowsReservedName(comp) {
+		return "reserved name"
+	}
+	if last := comp[len(comp)-1]; last == '.' || last == ' ' {
+		return "ends with dot or space"
+	}
+	if len(comp) > MaxPathComponentLength {
+		return "component too long"
+	}
+	return ""
+}
+
+func unsafeRuneReason(r rune) string {
+	switch {
+	case r == 0:
+		return "contains NUL"
+	case r < 0x20 || r == 0x7f:
+		return "contains control character"
+	case r == '/' || r == '\\':
+		return "contains separator"
+	case strings.ContainsRune(`<>:"|?*`, r):
+		return "contains reserved character"
+	}
+	return ""
+}
+
+func isWindowsReservedName(comp string) bool {
+	stem := comp
+	if i := strings.IndexByte(stem, '.'); i >= 0 {
+		stem = stem[:i]
+	}
+	return windowsReservedNames[strings.ToUpper(strings.TrimRight(stem, " "))]
+}
+
+// Rewrites the name and every file path in the info so that they're safe to create, according to
+// policy. Components are first normalized to Unicode NFC, and empty and "." components are removed.
+// Under the rewriting policies, components that are too long are truncated. The info no longer has
+// its original infohash if anything changed, so this is for deciding where to store data, and not
+// for sharing.
+func (info *Info) SanitizePaths(policy PathPolicy) error {
+	name, err := sanitizePath([]string{info.Name}, policy)
+	if err != nil {
+		return err
+	}
+	if len(name) != 1 {
+		return FilePathError{[]string{info.Name}, "nothing left of name"}
+	}
+	var nameUTF8 []string
+	if info.NameUTF8 != "" {
+		nameUTF8, err = sanitizePath([]string{info.NameUTF8}, policy)
+		if err != nil {
+			return err
+		}
+		if len(nameUTF8) != 1 {
+			return FilePathError{[]string{info.NameUTF8}, "nothing left of name"}
+		}
+	}
+	// Nothing is changed unless every path can be sanitized.
+	files := append([]FileInfo(nil), info.Files...)
+	seen := make(map[string]bool, len(files))
+	for i := range files {
+		fi := &files[i]
+		path, err := sanitizePath(fi.Path, policy)
+		if err != nil {
+			return err
+		}
+		if len(path) == 0 {
+			return FilePathError{fi.Path, "nothing left of path"}
+		}
+		key := strings.Join(path, "/")
+		if seen[key] {
+			return FilePathError{fi.Path, "collides with another path"}
+		}
+		seen[key] = true
+		if fi.PathUTF8 != nil {
+			fi.PathUTF8, err = sanitizePath(fi.PathUTF8, policy)
+			if err != nil {
+				return err
+			}
+		}
+		if fi.SymlinkPath != nil {
+			fi.SymlinkPath, err = sanitizePath(fi.SymlinkPath, policy)
+			if err != nil {
+				return err
+			}
+		}
+		fi.Path = path
+	}
+	fileTree := info.FileTree
+	if info.HasV2() {
+		fileTree, err = info.FileTree.sanitizedPaths(policy)
+		if err != nil {
+			return err
+		}
+	}
+	info.Name = name[0]
+	if nameUTF8 != nil {
+		info.NameUTF8 = nameUTF8[0]
+	}
+	if info.Files != nil {
+		info.Files = files
+	}
+	info.FileTree = fileTree
+	return nil
+}
+
+// Returns a copy of the tree with sanitized paths.
+func (ft *FileTree) sanitizedPaths(policy PathPolicy) (ret FileTree, err error) {
+	num := 0
+	ft.walkFiles(nil, func(path []string, file FileTreeFile) {
+		if err != nil {
+			return
+		}
+		var safe []string
+		safe, err = sanitizePath(path, policy)
+		if err == nil && len(safe) == 0 {
+			err = FilePathError{path, "nothing left of path"}
+		}
+		if err != nil {
+			return
+		}
+		ret.insert(safe, file)
+		num++
+	})
+	if err == nil && len(ret.upvertedFiles()) != num {
+		err = FilePathError{nil, "file tree paths collide after sanitizing"}
+	}
+	return
+}
+
+// Returns the sanitized components of path. Removed components are omitted from the result.
+func sanitizePath(path []string, policy PathPolicy) (ret []string, err error) {
+	for _, comp := range path {
+		comp = norm.NFC.String(comp)
+		if comp == "" || comp == "." {
+			continue
+		}
+		reason := unsafeComponentReason(comp)
+		switch {
+		case reason == "":
+		case policy == PathEscape:
+			comp = escapeComponent(comp)
+		case policy == PathStrip:
+			if reason != "component too long" {
+				continue
+			}
+			// Truncating can leave a reserved name behind.
+			comp = truncateComponent(comp)
+			if unsafeComponentReason(comp) != "" {
+				continue
+			}
+		default:
+			return nil, FilePathError{path, reason}
+		}
+		ret = append(ret, comp)
+	}
+	return
+}
+
+// Percent-encodes the characters that make comp unsafe, and truncates it to a safe length without
+// splitting an encoded character.
+func escapeComponent(comp string) string {
+	var units []string
+	wholeUnsafe := comp == ".." || isWindowsReservedName(comp)
+	for i := 0; i < len(comp); {
+		r, w := utf8.DecodeRuneInString(comp[i:])
+		if r == utf8.RuneError && w == 1 || unsafeRuneReason(r) != "" || wholeUnsafe && i == 0 {
+			units = append(units, percentEncode(comp[i:i+w]))
+		} else {
+			units = append(units, comp[i:i+w])
+		}
+		i += w
+	}
+	for {
+		n := 0
+		for _, u := range units {
+			n += len(u)
+		}
+		if last := units[len(units)-1]; last == "." || last == " " {
+			units[len(units)-1] = percentEncode(last)
+			continue
+		}
+		if n <= MaxPathComponentLength {
+			break
+		}
+		units = units[:len(units)-1]
+	}
+	return strings.Join(units, "")
+}
+
+func percentEncode(s string) (ret string) {
+	for i := 0; i < len(s); i++ {
+		ret += fmt.Sprintf("%%%02X", s[i])
+	}
+	return
+}
+
+// Truncates an otherwise safe component to a safe length at a character boundary.
+func truncateComponent(comp string) string {
+	n := MaxPathComponentLength
+	for n > 0 && !utf8.RuneStart(comp[n]) {
+		n--
+	}
+	return strings.TrimRight(comp[:n], ". ")
+}
@@ -0,0 +1,164 @@
+package metainfo
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestFileInfoSafePath(t *testing.T) {
+	c := qt.New(t)
+	for _, case_ := range []struct {
+		path   []string
+		reason string
+	}{
+		{[]string{"a", "b.txt"}, ""},
+		{[]string{"100%.txt"}, ""},
+		{[]string{"con", "tents"}, "reserved name"},
+		{[]string{"Aux.c"}, "reserved name"},
+		{[]string{"LPT1 .txt"}, "reserved name"},
+		{[]string{"console"}, ""},
+		{nil, "empty"},
+		{[]string{"a", "", "b"}, "empty component"},
+		{[]string{"."}, "current directory component"},
+		{[]string{"a", "..", "..", "b"}, "parent directory component"},
+		{[]string{`..\..\windows\system32`}, "contains separator"},
+		{[]string{"../etc/passwd"}, "contains separator"},
+		{[]string{"a\x00b"}, "contains NUL"},
+		{[]string{"a\nb"}, "contains control character"},
+		{[]string{"C:"}, "contains reserved character"},
+		{[]string{"what?"}, "contains reserved character"},
+		{[]string{"\xff"}, "invalid UTF-8"},
+		{[]string{"trailing."}, "ends with dot or space"},
+		{[]string{"trailing "}, "ends with dot or space"},
+		{[]string{strings.Repeat("a", 255)}, ""},
+		{[]string{strings.Repeat("a", 256)}, "component too long"},
+	} {
+		fi := FileInfo{Path: case_.path}
+		path, err := fi.SafePath()
+		if case_.reason == "" {
+			c.Check(err, qt.IsNil, qt.Commentf("%q", case_.path))
+			c.Check(path, qt.Equals, filepath.Join(case_.path...))
+		} else {
+			c.Check(err, qt.DeepEquals, FilePathError{case_.path, case_.reason}, qt.Commentf("%q", case_.path))
+		}
+	}
+}
+
+func sanitizedFilePaths(c *qt.C, policy PathPolicy, paths ...[]string) ([][]string, error) {
+	info := Info{Name: "name"}
+	for _, p := range paths {
+		info.Files = append(info.Files, FileInfo{Path: p, Length: 1})
+	}
+	err := info.SanitizePaths(policy)
+	if err != nil {
+		return nil, err
+	}
+	var ret [][]string
+	for _, fi := range info.Files {
+		ret = append(ret, fi.Path)
+		_, err := fi.SafePath()
+		c.Check(err, qt.IsNil)
+	}
+	return ret, nil
+}
+
+func TestSanitizePaths(t *testing.T) {
+	c := qt.New(t)
+	long := strings.Repeat("é", 200)
+	paths := [][]string{
+		{"ok", "file"},
+		{"a", "", ".", "b"},
+		{`..\..\windows\system32`, "evil.exe"},
+		{"..", "..", "x"},
+		{"AUX", "y"},
+		{"z.", "w"},
+		{"what?", long},
+		// NFD, which is normalized to the composed form.
+		{"café"},
+	}
+	got, err := sanitizedFilePaths(c, PathEscape, paths...)
+	c.Assert(err, qt.IsNil)
+	c.Check(got, qt.DeepEquals, [][]string{
+		{"ok", "file"},
+		{"a", "b"},
+		{"..%5C..%5Cwindows%5Csystem32", "evil.exe"},
+		{"%2E%2E", "%2E%2E", "x"},
+		{"%41UX", "y"},
+		{"z%2E", "w"},
+		{"what%3F", strings.Repeat("é", 127)},
+		{"caf\u00e9"},
+	})
+	got, err = sanitizedFilePaths(c, PathStrip, paths...)
+	c.Assert(err, qt.IsNil)
+	c.Check(got, qt.DeepEquals, [][]string{
+		{"ok", "file"},
+		{"a", "b"},
+		{"evil.exe"},
+		{"x"},
+		{"y"},
+		{"w"},
+		{strings.Repeat("é", 127)},
+		{"caf\u00e9"},
+	})
+}
+
+func TestSanitizePathsErrors(t *testing.T) {
+	c := qt.New(t)
+	_, err := sanitizedFilePaths(c, PathReject, []string{"a", "", "b"}, []string{"..", "x"})
+	c.Check(err, qt.DeepEquals, FilePathError{[]string{"..", "x"}, "parent directory component"})
+	_, err = sanitizedFilePaths(c, PathStrip, []string{"x"}, []string{"..", "x"})
+	c.Check(err, qt.DeepEquals, FilePathError{[]string{"..", "x"}, "collides with another path"})
+	_, err = sanitizedFilePaths(c, PathStrip, []string{"..", ""})
+	c.Check(err, qt.DeepEquals, FilePathError{[]string{"..", ""}, "nothing left of path"})
+	info := Info{Name: "..", Files: []FileInfo{{Path: []string{"..", "x"}}}}
+	c.Check(info.SanitizePaths(PathStrip), qt.DeepEquals, FilePathError{[]string{".."}, "nothing left of name"})
+	// Nothing changed on failure.
+	info = Info{Name: "AUX", Files: []FileInfo{{Path: []string{"a:b"}}, {Path: []string{"a"}}, {Path: []string{".."}}}}
+	c.Check(info.SanitizePaths(PathStrip), qt.Not(qt.IsNil))
+	c.Check(info, qt.DeepEquals, Info{Name: "AUX", Files: []FileInfo{{Path: []string{"a:b"}}, {Path: []string{"a"}}, {Path: []string{".."}}}})
+}
+
+func TestSanitizePathsReject(t *testing.T) {
+	c := qt.New(t)
+	got, err := sanitizedFilePaths(c, PathReject, []string{"a", "", ".", "b"}, []string{"café"})
+	c.Assert(err, qt.IsNil)
+	c.Check(got, qt.DeepEquals, [][]string{{"a", "b"}, {"café"}})
+	_, err = sanitizedFilePaths(c, PathReject, []string{`..\..\windows\system32`})
+	c.Check(err, qt.DeepEquals, FilePathError{[]string{`..\..\windows\system32`}, "contains separator"})
+}
+
+func TestSanitizePathsFileTree(t *testing.T) {
+	c := qt.New(t)
+	info := Info{
+		Name:        "name",
+		MetaVersion: 2,
+		PieceLength: 1 << 14,
+	}
+	info.FileTree.insert([]string{"dir", "con.txt"}, FileTreeFile{Length: 1})
+	info.FileTree.insert([]string{"..", "x"}, FileTreeFile{Length: 2})
+	c.Assert(info.SanitizePaths(PathEscape), qt.IsNil)
+	c.Check(info.FileTree.upvertedFiles(), qt.DeepEquals, []FileInfo{
+		{Length: 2, Path: []string{"%2E%2E", "x"}},
+		{Length: 1, Path: []string{"dir", "%63on.txt"}},
+	})
+}
+
+func TestLocalPath(t *testing.T) {
+	c := qt.New(t)
+	_, err := LocalPath("a", `..\..\windows\system32`)
+	c.Check(err, qt.DeepEquals, FilePathError{[]string{"a", `..\..\windows\system32`}, "parent directory component"})
+	_, err = LocalPath("/etc", "passwd")
+	c.Check(err, qt.DeepEquals, FilePathError{[]string{"/etc", "passwd"}, "absolute component"})
+	got, err := LocalPath("a", "", ".", "b")
+	c.Assert(err, qt.IsNil)
+	c.Check(got, qt.Equals, filepath.Join("a", "b"))
+	// Sanitized paths are used as they are.
+	info := Info{Name: "AUX", Files: []FileInfo{{Path: []string{"a:b", "..", "c\x00d"}}}}
+	c.Assert(info.SanitizePaths(PathEscape), qt.IsNil)
+	got, err = LocalPath(append([]string{info.Name}, info.Files[0].Path...)...)
+	c.Assert(err, qt.IsNil)
+	c.Check(got, qt.Equals, filepath.Join(append([]string{info.Name}, info.Files[0].Path...)...))
+}
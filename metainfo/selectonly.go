@@ -0,0 +1,107 @@
+package metainfo
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// File indices to download, from the "so" magnet parameter, such as "0,2,4-7".
+type SelectOnly struct {
+	Ranges []IndexRange
+	// Parts of the parameter that aren't valid ranges. They're kept so that the parameter survives a
+	// round trip, and otherwise ignored.
+	Invalid []string
+}
+
+// An inclusive range of file indices.
+type IndexRange struct {
+	First, Last int
+}
+
+func (me IndexRange) String() string {
+	if me.First == me.Last {
+		return strconv.Itoa(me.First)
+	}
+	return strconv.Itoa(me.First) + "-" + strconv.Itoa(me.Last)
+}
+
+// Parses an "so" value. Parts that aren't valid ranges are put in Invalid, and empty parts are
+// skipped.
+func ParseSelectOnly(s string) (ret SelectOnly) {
+	for _, part := range strings.Split(s, ",") {
+		if part == "" {
+			continue
+		}
+		r, ok := parseIndexRange(part)
+		if ok {
+			ret.Ranges = append(ret.Ranges, r)
+		} else {
+			ret.Invalid = append(ret.Invalid, part)
+		}
+	}
+	return
+}
+
+func parseIndexRange(s string) (r IndexRange, ok bool) {
+	first, last := s, s
+	if i := strings.IndexByte(s, '-'); i >= 0 {
+		first, last = s[:i], s[i+1:]
+	}
+	var err error
+	r.First, err = strconv.Atoi(first)
+	if err != nil || r.First < 0 || first != strconv.Itoa(r.First) {
+		return
+	}
+	r.Last, err = strconv.Atoi(last)
+	if err != nil || r.Last < r.First || last != strconv.Itoa(r.Last) {
+		return
+	}
+	return r, true
+}
+
+// Returns the selection of the given file indices, with consecutive indices combined into ranges.
+// Negative indices are ignored.
+func SelectOnlyIndices(indices ...int) (ret SelectOnly) {
+	sorted := append([]int(nil), indices...)
+	sort.Ints(sorted)
+	for _, i := range sorted {
+		if i < 0 {
+			continue
+		}
+		if n := len(ret.Ranges); n != 0 && i <= ret.Ranges[n-1].Last+1 {
+			if i > ret.Ranges[n-1].Last {
+				ret.Ranges[n-1].Last = i
+			}
+			continue
+		}
+		ret.Ranges = append(ret.Ranges, IndexRange{i, i})
+	}
+	return
+}
+
+// Whether there's nothing in the selection, valid or otherwise. An empty selection selects nothing
+// in particular, rather than no files.
+func (me SelectOnly) IsEmpty() bool {
+	return len(me.Ranges) == 0 && len(me.Invalid) == 0
+}
+
+// Whether the file index is in one of the ranges.
+func (me SelectOnly) Contains(index int) bool {
+	for _, r := range me.Ranges {
+		if index >= r.First && index <= r.Last {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the "so" value, with the valid ranges first.
+func (me SelectOnly) String() string {
+	parts := make([]string, 0, len(me.Ranges)+len(me.Invalid))
+	for _, r := range me.Ranges {
+		parts = append(parts, r.String())
+	}
+	parts = append(parts, me.Invalid...)
+	return strings.Join(parts, ",")
+}
@@ -0,0 +1,34 @@
+package metainfo
+
+import (
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestParseSelectOnly(t *testing.T) {
+	c := qt.New(t)
+	so := ParseSelectOnly("0,2,4-7,,x,7-4,-1,3-,01,9")
+	c.Check(so.Ranges, qt.DeepEquals, []IndexRange{{0, 0}, {2, 2}, {4, 7}, {9, 9}})
+	c.Check(so.Invalid, qt.DeepEquals, []string{"x", "7-4", "-1", "3-", "01"})
+	c.Check(so.String(), qt.Equals, "0,2,4-7,9,x,7-4,-1,3-,01")
+	for i, expected := range []bool{true, false, true, false, true, true, true, true, false, true, false} {
+		c.Check(so.Contains(i), qt.Equals, expected, qt.Commentf("%v", i))
+	}
+	c.Check(ParseSelectOnly("").IsEmpty(), qt.IsTrue)
+}
+
+func TestSelectOnlyIndices(t *testing.T) {
+	so := SelectOnlyIndices(7, 0, 2, 5, 6, 2, 4, -1)
+	qt.Assert(t, so.String(), qt.Equals, "0,2,4-7")
+	qt.Assert(t, SelectOnlyIndices().IsEmpty(), qt.IsTrue)
+}
+
+func TestMagnetSelectOnly(t *testing.T) {
+	m, err := ParseMagnetUri("magnet:?xt=urn:btih:51340689c960f0778a4387aef9b4b52fd08390cd&so=0%2C2%2C4-7%2Cbad")
+	qt.Assert(t, err, qt.IsNil)
+	qt.Check(t, m.SelectOnly.Ranges, qt.DeepEquals, []IndexRange{{0, 0}, {2, 2}, {4, 7}})
+	qt.Check(t, m.SelectOnly.Invalid, qt.DeepEquals, []string{"bad"})
+	qt.Check(t, m.Params, qt.IsNil)
+	qt.Check(t, m.String(), qt.Equals, "magnet:?xt=urn:btih:51340689c960f0778a4387aef9b4b52fd08390cd&so=0%2C2%2C4-7%2Cbad")
+}
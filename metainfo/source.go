@@ -0,0 +1,23 @@
+package metainfo
+
+// Returns a copy of the MetaInfo with the source field of the info set, as used by private trackers
+// to tell apart torrents of the same files, for cross-seeding. An empty source removes the field.
+// Only the source changes: the info is edited as an InfoDict, so the other keys, including those
+// Info doesn't know, keep their exact bytes. The infohashes of the original and new infos are
+// returned, so callers can map one to the other. For hybrid infos, the v2 infohashes change too.
+func WithSource(mi *MetaInfo, source string) (ret *MetaInfo, oldInfoHash, newInfoHash Hash, err error) {
+	b, err := editInfoDict(mi.InfoBytes, func(d *InfoDict) error {
+		if source == "" {
+			d.Delete("source")
+			return nil
+		}
+		return d.Set("source", source)
+	})
+	if err != nil {
+		return
+	}
+	copied := *mi
+	ret = &copied
+	ret.SetInfoBytes(b)
+	return ret, mi.HashInfoBytes(), ret.HashInfoBytes(), nil
+}
@@ -0,0 +1,53 @@
+package metainfo
+
+import (
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/anacrolix/torrent/bencode"
+)
+
+// An info with a field that Info doesn't handle, holding a non-canonical integer.
+const sourceTestInfo = "d6:lengthi1e4:name1:x12:piece lengthi1e6:pieces20:01234567890123456789" +
+	"7:x-extrali01ei2eee"
+
+func TestWithSource(t *testing.T) {
+	c := qt.New(t)
+	mi := &MetaInfo{InfoBytes: []byte(sourceTestInfo), Comment: "kept"}
+	ret, oldHash, newHash, err := WithSource(mi, "TRACKER")
+	c.Assert(err, qt.IsNil)
+	c.Check(oldHash, qt.Equals, mi.HashInfoBytes())
+	c.Check(newHash, qt.Equals, ret.HashInfoBytes())
+	c.Check(newHash, qt.Not(qt.Equals), oldHash)
+	c.Check(ret.Comment, qt.Equals, "kept")
+	c.Check(string(mi.InfoBytes), qt.Equals, sourceTestInfo)
+	c.Check(string(ret.InfoBytes), qt.Equals, "d6:lengthi1e4:name1:x12:piece lengthi1e6:pieces20:01234567890123456789"+
+		"6:source7:TRACKER7:x-extrali01ei2eee")
+	info, err := ret.Info()
+	c.Assert(err, qt.IsNil)
+	c.Check(info.Source, qt.Equals, "TRACKER")
+	// Removing the source.
+	ret, _, _, err = WithSource(ret, "")
+	c.Assert(err, qt.IsNil)
+	c.Check(string(ret.InfoBytes), qt.Equals, "d6:lengthi1e4:name1:x12:piece lengthi1e6:pieces20:01234567890123456789"+
+		"7:x-extrali01ei2eee")
+	_, _, _, err = WithSource(&MetaInfo{InfoBytes: []byte("i1e")}, "a")
+	c.Check(err, qt.ErrorMatches, "unmarshalling info: .*")
+}
+
+func TestSetPrivateKeepsUnknownInfoFields(t *testing.T) {
+	c := qt.New(t)
+	mi := MetaInfo{InfoBytes: bencode.MustMarshal(map[string]interface{}{
+		"name":         "x",
+		"length":       1,
+		"piece length": 1,
+		"pieces":       make([]byte, HashSize),
+		"x-extra":      "kept",
+	})}
+	c.Assert(mi.SetPrivate(true), qt.IsNil)
+	var dict map[string]interface{}
+	c.Assert(bencode.Unmarshal(mi.InfoBytes, &dict), qt.IsNil)
+	c.Check(dict["x-extra"], qt.Equals, "kept")
+	c.Check(dict["private"], qt.Equals, int64(1))
+}
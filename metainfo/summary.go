@@ -0,0 +1,107 @@
+package metainfo
+
+import "fmt"
+
+// Checks that the pieces agree with the piece length and the lengths of the files. The error is a
+// PiecesLengthError, PieceLengthError or NumPiecesError. There's nothing to check for v2-only infos
+// beyond the piece length, as the number of pieces follows from the files. Nor is there for BEP 30
+// merkle infos, which have no pieces field.
+func (info *Info) ValidatePieces() error {
+	if info.HasV1() && len(info.Pieces)%HashSize != 0 {
+		return PiecesLengthError{len(info.Pieces)}
+	}
+	if info.PieceLength <= 0 {
+		if info.TotalLength() != 0 {
+			return PieceLengthError{info.PieceLength, "not positive"}
+		}
+		return nil
+	}
+	if info.HasV1() && !info.IsMerkle() {
+		expected := int((info.TotalLength() + info.PieceLength - 1) / info.PieceLength)
+		if expected != info.NumPieces() {
+			return NumPiecesError{expected, info.NumPieces()}
+		}
+	}
+	return nil
+}
+
+// Returns the length of piece i. Only the last piece can be short, except in v2-only infos, where
+// the last piece of each file can be. An error is returned if the piece doesn't exist, or the
+// pieces don't pass ValidatePieces.
+func (info *Info) PieceLengthAt(i int) (int64, error) {
+	if err := info.ValidatePieces(); err != nil {
+		return 0, err
+	}
+	if i < 0 || i >= info.NumPieces() {
+		return 0, fmt.Errorf("piece %v out of range [0, %v)", i, info.NumPieces())
+	}
+	if !info.HasV1() {
+		e, _ := info.v2PieceExtent(i)
+		return e.Length, nil
+	}
+	return info.Piece(i).Length(), nil
+}
+
+// The number of pieces in a v2-only info, where every file starts a new piece.
+func (info *Info) numV2Pieces() (ret int) {
+	if info.PieceLength <= 0 {
+		return 0
+	}
+	for _, fi := range info.upvertedV2Files() {
+		ret += int((fi.Length + info.PieceLength - 1) / info.PieceLength)
+	}
+	return
+}
+
+// Returns where piece i of a v2-only info is. ok is false if there's no such piece.
+func (info *Info) v2PieceExtent(i int) (e FileExtent, ok bool) {
+	if info.PieceLength <= 0 || i < 0 {
+		return
+	}
+	for fileIndex, fi := range info.upvertedV2Files() {
+		n := int((fi.Length + info.PieceLength - 1) / info.PieceLength)
+		if i >= n {
+			i -= n
+			continue
+		}
+		e = FileExtent{FileIndex: fileIndex, Offset: int64(i) * info.PieceLength, Length: info.PieceLength}
+		if e.Offset+e.Length > fi.Length {
+			e.Length = fi.Length - e.Offset
+		}
+		return e, true
+	}
+	return
+}
+
+// Summarizes the layout of an info.
+type InfoSummary struct {
+	NumPieces   int
+	PieceLength int64
+	// The files, excluding BEP 47 padding.
+	NumFiles int
+	// The length the pieces cover, including padding.
+	TotalLength int64
+	// The length of the files, excluding padding.
+	TotalLengthSkippingPadding int64
+}
+
+func (info *Info) summary() InfoSummary {
+	return InfoSummary{
+		NumPieces:                  info.NumPieces(),
+		PieceLength:                info.PieceLength,
+		NumFiles:                   len(info.UpvertedFilesSkippingPadding()),
+		TotalLength:                info.TotalLength(),
+		TotalLengthSkippingPadding: info.TotalLengthSkippingPadding(),
+	}
+}
+
+// Returns the summary of the info, without the caller having to keep the unmarshalled Info. If the
+// pieces don't pass Info.ValidatePieces, the summary is returned with the error. An error decoding
+// the info is an InfoDecodeError.
+func (mi *MetaInfo) InfoSummary() (InfoSummary, error) {
+	info, err := mi.Info()
+	if err != nil {
+		return InfoSummary{}, InfoDecodeError{err}
+	}
+	return info.summary(), info.ValidatePieces()
+}
@@ -0,0 +1,109 @@
+package metainfo
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/anacrolix/torrent/bencode"
+)
+
+func TestInfoSummarySingleFile(t *testing.T) {
+	c := qt.New(t)
+	info := Info{Name: "a", PieceLength: 4, Length: 9, Pieces: make([]byte, 3*HashSize)}
+	c.Assert(info.ValidatePieces(), qt.IsNil)
+	c.Check(info.summary(), qt.Equals, InfoSummary{
+		NumPieces:                  3,
+		PieceLength:                4,
+		NumFiles:                   1,
+		TotalLength:                9,
+		TotalLengthSkippingPadding: 9,
+	})
+	l, err := info.PieceLengthAt(2)
+	c.Assert(err, qt.IsNil)
+	c.Check(l, qt.Equals, int64(1))
+	l, err = info.PieceLengthAt(0)
+	c.Assert(err, qt.IsNil)
+	c.Check(l, qt.Equals, int64(4))
+	_, err = info.PieceLengthAt(3)
+	c.Check(err, qt.ErrorMatches, `piece 3 out of range \[0, 3\)`)
+}
+
+func TestInfoSummaryPadded(t *testing.T) {
+	c := qt.New(t)
+	info, _ := buildVerifyTestInfo(c)
+	c.Assert(info.ValidatePieces(), qt.IsNil)
+	c.Check(info.summary(), qt.Equals, InfoSummary{
+		NumPieces:                  6,
+		PieceLength:                16384,
+		NumFiles:                   3,
+		TotalLength:                5*16384 + 100,
+		TotalLengthSkippingPadding: 60100,
+	})
+	l, err := info.PieceLengthAt(5)
+	c.Assert(err, qt.IsNil)
+	c.Check(l, qt.Equals, int64(100))
+}
+
+func TestInfoSummaryV2Only(t *testing.T) {
+	c := qt.New(t)
+	_, root := buildVerifyTestInfo(c)
+	info := Info{PieceLength: 16384}
+	_, err := info.BuildFromFilePathOpts(context.Background(), root, BuildFromFilePathOpts{
+		Version: InfoVersionHybrid,
+	})
+	c.Assert(err, qt.IsNil)
+	info.Files = nil
+	info.Pieces = nil
+	c.Assert(info.HasV1(), qt.IsFalse)
+	c.Assert(info.ValidatePieces(), qt.IsNil)
+	// Files a, b and c have 3, 2 and 1 pieces of their own.
+	c.Check(info.summary(), qt.Equals, InfoSummary{
+		NumPieces:                  6,
+		PieceLength:                16384,
+		NumFiles:                   3,
+		TotalLength:                60100,
+		TotalLengthSkippingPadding: 60100,
+	})
+	var lengths []int64
+	for i := 0; i < info.NumPieces(); i++ {
+		l, err := info.PieceLengthAt(i)
+		c.Assert(err, qt.IsNil)
+		lengths = append(lengths, l)
+	}
+	c.Check(lengths, qt.DeepEquals, []int64{16384, 16384, 40000 - 2*16384, 16384, 20000 - 16384, 100})
+	c.Check(info.PieceExtents(4), qt.DeepEquals, []FileExtent{{FileIndex: 1, Offset: 16384, Length: 20000 - 16384}})
+}
+
+func TestValidatePiecesErrors(t *testing.T) {
+	c := qt.New(t)
+	info := Info{Name: "a", PieceLength: 4, Length: 9, Pieces: make([]byte, 2*HashSize)}
+	c.Check(info.ValidatePieces(), qt.Equals, error(NumPiecesError{Expected: 3, Actual: 2}))
+	_, err := info.PieceLengthAt(0)
+	c.Check(errors.As(err, new(NumPiecesError)), qt.IsTrue)
+	info.Pieces = make([]byte, 2*HashSize+1)
+	c.Check(info.ValidatePieces(), qt.Equals, error(PiecesLengthError{2*HashSize + 1}))
+	info.Pieces = nil
+	info.PieceLength = 0
+	c.Check(info.ValidatePieces(), qt.Equals, error(PieceLengthError{0, "not positive"}))
+	info.Length = 0
+	c.Check(info.ValidatePieces(), qt.IsNil)
+}
+
+func TestMetaInfoInfoSummary(t *testing.T) {
+	c := qt.New(t)
+	info := Info{Name: "a", PieceLength: 4, Length: 9, Pieces: make([]byte, 2*HashSize)}
+	var mi MetaInfo
+	var err error
+	mi.InfoBytes, err = bencode.Marshal(info)
+	c.Assert(err, qt.IsNil)
+	summary, err := mi.InfoSummary()
+	c.Check(err, qt.Equals, error(NumPiecesError{Expected: 3, Actual: 2}))
+	c.Check(summary.NumPieces, qt.Equals, 2)
+	c.Check(summary.TotalLength, qt.Equals, int64(9))
+	mi.InfoBytes = []byte("x")
+	_, err = mi.InfoSummary()
+	c.Check(errors.As(err, new(InfoDecodeError)), qt.IsTrue)
+}
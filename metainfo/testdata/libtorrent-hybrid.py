@@ -0,0 +1,30 @@
+#!/usr/bin/env python3
+# Makes libtorrent-hybrid.torrent from the data that writeHybridTestData writes, and records the
+# infohashes libtorrent reports for it in libtorrent-hybrid.infohashes, v1 then v2. Needs the Python
+# bindings for libtorrent 2.0 or later, which make hybrid torrents by default. The tests that use the
+# files skip until they're here.
+
+import os
+import tempfile
+
+import libtorrent as lt
+
+here = os.path.dirname(os.path.abspath(__file__))
+
+with tempfile.TemporaryDirectory() as parent:
+    root = os.path.join(parent, "hybrid")
+    os.mkdir(root)
+    with open(os.path.join(root, "a"), "wb") as f:
+        f.write(bytes(i % 251 for i in range(20000)))
+    with open(os.path.join(root, "b"), "wb") as f:
+        f.write(bytes(i * 7 % 256 for i in range(5000)))
+    fs = lt.file_storage()
+    lt.add_files(fs, root)
+    ct = lt.create_torrent(fs, 16384)
+    lt.set_piece_hashes(ct, parent)
+    with open(os.path.join(here, "libtorrent-hybrid.torrent"), "wb") as f:
+        f.write(lt.bencode(ct.generate()))
+
+ih = lt.torrent_info(os.path.join(here, "libtorrent-hybrid.torrent")).info_hashes()
+with open(os.path.join(here, "libtorrent-hybrid.infohashes"), "w") as f:
+    f.write("%s\n%s\n" % (ih.v1, ih.v2))
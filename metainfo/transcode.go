@@ -0,0 +1,96 @@
+package metainfo
+
+import (
+	"fmt"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+// The Encoding of a MetaInfo isn't a charset that names can be transcoded from.
+type UnknownEncodingError struct {
+	Encoding string
+}
+
+func (me UnknownEncodingError) Error() string {
+	return fmt.Sprintf("unknown encoding %q", me.Encoding)
+}
+
+// Like UnmarshalInfo, but names are transcoded to UTF-8 from the MetaInfo's Encoding, as by
+// Info.TranscodeNames. An UnknownEncodingError is returned along with the untranscoded info, and can
+// be ignored.
+func (mi MetaInfo) UnmarshalInfoTranscoded() (info Info, err error) {
+	info, err = mi.UnmarshalInfo()
+	if err != nil || mi.Encoding == "" {
+		return
+	}
+	err = info.TranscodeNames(mi.Encoding)
+	return
+}
+
+// Converts the name and file paths to UTF-8 from the charset enc, such as "GBK" or "Shift_JIS". If
+// they're all valid UTF-8 already, the encoding is assumed to be mislabelled, and they're left
+// alone. Otherwise all of them are converted, since legacy-encoded names can happen to be valid
+// UTF-8 too. If enc isn't known, an UnknownEncodingError is returned, and nothing is changed. The
+// info won't have the original infohash if anything changed.
+func (info *Info) TranscodeNames(enc string) error {
+	e, err := htmlindex.Get(enc)
+	if err != nil {
+		return UnknownEncodingError{enc}
+	}
+	if name, _ := htmlindex.Name(e); name == "utf-8" {
+		return nil
+	}
+	if info.namesAreUTF8() {
+		return nil
+	}
+	t := transcoder{e.NewDecoder()}
+	info.Name = t.string(info.Name)
+	for i := range info.Files {
+		fi := &info.Files[i]
+		fi.Path = t.strings(fi.Path)
+		fi.SymlinkPath = t.strings(fi.SymlinkPath)
+	}
+	return nil
+}
+
+func (info *Info) namesAreUTF8() bool {
+	if !utf8.ValidString(info.Name) {
+		return false
+	}
+	for _, fi := range info.Files {
+		for _, ss := range [][]string{fi.Path, fi.SymlinkPath} {
+			for _, s := range ss {
+				if !utf8.ValidString(s) {
+					return false
+				}
+			}
+		}
+	}
+	return true
+}
+
+type transcoder struct {
+	dec *encoding.Decoder
+}
+
+func (t transcoder) string(s string) string {
+	ret, err := t.dec.String(s)
+	if err != nil {
+		// Decoders replace what they can't decode, so this shouldn't happen.
+		return s
+	}
+	return ret
+}
+
+func (t transcoder) strings(ss []string) (ret []string) {
+	if ss == nil {
+		return nil
+	}
+	ret = make([]string, 0, len(ss))
+	for _, s := range ss {
+		ret = append(ret, t.string(s))
+	}
+	return
+}
@@ -0,0 +1,63 @@
+package metainfo
+
+import (
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestUnmarshalInfoTranscoded(t *testing.T) {
+	for _, case_ := range []struct {
+		filename string
+		name     string
+		paths    [][]string
+	}{
+		{"testdata/gbk-encoding.torrent", "中文资料", [][]string{{"文件.txt"}, {"目录", "b.txt"}}},
+		{"testdata/shift-jis-encoding.torrent", "日本語の資料", [][]string{{"ファイル.txt"}, {"フォルダ", "b.txt"}}},
+	} {
+		c := qt.New(t)
+		mi, err := LoadFromFile(case_.filename)
+		c.Assert(err, qt.IsNil)
+		raw, err := mi.UnmarshalInfo()
+		c.Assert(err, qt.IsNil)
+		c.Check(raw.Name, qt.Not(qt.Equals), case_.name)
+		info, err := mi.UnmarshalInfoTranscoded()
+		c.Assert(err, qt.IsNil)
+		c.Check(info.Name, qt.Equals, case_.name)
+		var paths [][]string
+		for _, fi := range info.Files {
+			paths = append(paths, fi.Path)
+		}
+		c.Check(paths, qt.DeepEquals, case_.paths)
+	}
+}
+
+// GBK that's also valid UTF-8 is transcoded if anything else in the info isn't valid UTF-8.
+func TestTranscodeNamesValidUTF8Coincidence(t *testing.T) {
+	c := qt.New(t)
+	info := Info{Name: "\xc4\xbf\xc2\xbc", Files: []FileInfo{{Path: []string{"\xce\xc4"}}}}
+	c.Assert(info.TranscodeNames("gbk"), qt.IsNil)
+	c.Check(info.Name, qt.Equals, "目录")
+	c.Check(info.Files[0].Path, qt.DeepEquals, []string{"文"})
+}
+
+func TestTranscodeNamesLeavesUTF8(t *testing.T) {
+	c := qt.New(t)
+	info := Info{Name: "中文", Files: []FileInfo{{Path: []string{"ok"}}}}
+	c.Assert(info.TranscodeNames("gbk"), qt.IsNil)
+	c.Check(info, qt.DeepEquals, Info{Name: "中文", Files: []FileInfo{{Path: []string{"ok"}}}})
+	info.Name = "\xce\xc4"
+	c.Assert(info.TranscodeNames("UTF-8"), qt.IsNil)
+	c.Check(info.Name, qt.Equals, "\xce\xc4")
+}
+
+func TestTranscodeNamesUnknownEncoding(t *testing.T) {
+	c := qt.New(t)
+	info := Info{Name: "\xce\xc4"}
+	c.Check(info.TranscodeNames("klingon"), qt.Equals, error(UnknownEncodingError{"klingon"}))
+	c.Check(info.Name, qt.Equals, "\xce\xc4")
+	mi := MetaInfo{Encoding: "klingon", InfoBytes: []byte("d4:name2:\xce\xc412:piece lengthi1ee")}
+	info, err := mi.UnmarshalInfoTranscoded()
+	c.Check(err, qt.ErrorMatches, `unknown encoding "klingon"`)
+	c.Check(info.Name, qt.Equals, "\xce\xc4")
+}
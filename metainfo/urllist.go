@@ -4,6 +4,8 @@ import (
 	"github.com/anacrolix/torrent/bencode"
 )
 
+// Webseed URLs. BEP 19 allows a single string in place of a list, and both are decoded. The list
+// form is always encoded, which means the same thing. Empty URLs are dropped when decoding.
 type UrlList []string
 
 var (
@@ -17,11 +19,20 @@ func (me *UrlList) UnmarshalBencode(b []byte) error {
 	if b[0] == 'l' {
 		var l []string
 		err := bencode.Unmarshal(b, &l)
-		*me = l
+		*me = UrlList(l).withoutEmpty()
 		return err
 	}
 	var s string
 	err := bencode.Unmarshal(b, &s)
-	*me = []string{s}
+	*me = UrlList{s}.withoutEmpty()
 	return err
 }
+
+func (me UrlList) withoutEmpty() (ret UrlList) {
+	for _, url := range me {
+		if url != "" {
+			ret = append(ret, url)
+		}
+	}
+	return
+}
@@ -0,0 +1,198 @@
+package metainfo
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// Piece lengths beyond this are rejected by Validate. No client would handle them.
+const maxSanePieceLength = 1 << 30
+
+// The info bytes couldn't be decoded. No info checks are done.
+type InfoDecodeError struct {
+	Err error
+}
+
+func (me InfoDecodeError) Error() string {
+	return fmt.Sprintf("decoding info: %v", me.Err)
+}
+
+func (me InfoDecodeError) Unwrap() error {
+	return me.Err
+}
+
+// The pieces field isn't a whole number of hashes.
+type PiecesLengthError struct {
+	Length int
+}
+
+func (me PiecesLengthError) Error() string {
+	return fmt.Sprintf("pieces length %v is not a multiple of %v", me.Length, HashSize)
+}
+
+// The number of pieces doesn't match the total length of the files.
+type NumPiecesError struct {
+	Expected int
+	Actual   int
+}
+
+func (me NumPiecesError) Error() string {
+	return fmt.Sprintf("expected %v pieces for total length but have %v", me.Expected, me.Actual)
+}
+
+type PieceLengthError struct {
+	PieceLength int64
+	Reason      string
+}
+
+func (me PieceLengthError) Error() string {
+	return fmt.Sprintf("bad piece length %v: %v", me.PieceLength, me.Reason)
+}
+
+// A file has a path that's empty or unsafe. The info name is checked the same way, with the name as
+// the only path component.
+type FilePathError struct {
+	Path   []string
+	Reason string
+}
+
+func (me FilePathError) Error() string {
+	return fmt.Sprintf("bad file path %q: %v", me.Path, me.Reason)
+}
+
+type AnnounceURLError struct {
+	URL string
+	Err error
+}
+
+func (me AnnounceURLError) Error() string {
+	return fmt.Sprintf("bad announce url %q: %v", me.URL, me.Err)
+}
+
+func (me AnnounceURLError) Unwrap() error {
+	return me.Err
+}
+
+type NodeError struct {
+	Node Node
+	Err  error
+}
+
+func (me NodeError) Error() string {
+	return fmt.Sprintf("bad node %q: %v", string(me.Node), me.Err)
+}
+
+func (me NodeError) Unwrap() error {
+	return me.Err
+}
+
+// Checks the MetaInfo for internal consistency. All the problems found are returned together, joined
+// with errors.Join. Each problem is one of the error types above, for use with errors.As.
+func (mi *MetaInfo) Validate() error {
+	var errs []error
+	info, err := mi.Info()
+	if err != nil {
+		errs = append(errs, InfoDecodeError{err})
+	} else {
+		errs = append(errs, info.validate()...)
+	}
+	for _, u := range mi.announceURLs() {
+		if err := validateAnnounceURL(u); err != nil {
+			errs = append(errs, AnnounceURLError{u, err})
+		}
+	}
+	for _, n := range mi.Nodes {
+		if err := validateHostPort(n.String()); err != nil {
+			errs = append(errs, NodeError{n, err})
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (mi *MetaInfo) announceURLs() (ret []string) {
+	if mi.Announce != "" {
+		ret = append(ret, mi.Announce)
+	}
+	for _, tier := range mi.AnnounceList {
+		ret = append(ret, tier...)
+	}
+	return
+}
+
+func (info *Info) validate() (errs []error) {
+	if info.PieceLength <= 0 {
+		errs = append(errs, PieceLengthError{info.PieceLength, "not positive"})
+	} else if info.PieceLength > maxSanePieceLength {
+		errs = append(errs, PieceLengthError{info.PieceLength, "too large"})
+	} else if info.HasV2() {
+		if err := checkV2PieceLength(info.PieceLength); err != nil {
+			errs = append(errs, PieceLengthError{info.PieceLength, err.Error()})
+		}
+	}
+	var pieceLengthErr PieceLengthError
+	// Bad piece lengths are reported above.
+	if err := info.ValidatePieces(); err != nil && !errors.As(err, &pieceLengthErr) {
+		errs = append(errs, err)
+	}
+	if reason := badPathReason([]string{info.Name}); reason != "" {
+		errs = append(errs, FilePathError{[]string{info.Name}, reason})
+	}
+	files := info.Files
+	if info.HasV2() {
+		files = append(files[:len(files):len(files)], info.FileTree.upvertedFiles()...)
+	}
+	for _, fi := range files {
+		if reason := badPathReason(fi.Path); reason != "" {
+			errs = append(errs, FilePathError{fi.Path, reason})
+		}
+	}
+	return
+}
+
+// Returns why the path is unsafe or empty, or "" if it's fine.
+func badPathReason(path []string) string {
+	if len(path) == 0 {
+		return "empty"
+	}
+	for _, comp := range path {
+		switch {
+		case comp == "":
+			return "empty component"
+		case comp == "..":
+			return "parent directory component"
+		case strings.ContainsRune(comp, 0):
+			return "contains NUL"
+		}
+	}
+	return ""
+}
+
+func validateAnnounceURL(s string) error {
+	u, err := url.Parse(s)
+	if err != nil {
+		return err
+	}
+	if u.Scheme == "" {
+		return errors.New("missing scheme")
+	}
+	return nil
+}
+
+// Checks a "host:port" address, with IPv6 hosts bracketed.
+func validateHostPort(hostPort string) error {
+	host, port, err := net.SplitHostPort(hostPort)
+	if err != nil {
+		return err
+	}
+	if host == "" {
+		return errors.New("empty host")
+	}
+	if !validNodeHost(host) {
+		return fmt.Errorf("bad host %q", host)
+	}
+	_, err = parseNodePort(port)
+	return err
+}
@@ -0,0 +1,76 @@
+package metainfo
+
+import (
+	"errors"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/anacrolix/torrent/bencode"
+)
+
+func TestValidateTestdata(t *testing.T) {
+	for _, name := range []string{
+		"testdata/archlinux-2011.08.19-netinstall-i686.iso.torrent",
+		"testdata/continuum.torrent",
+		"testdata/23516C72685E8DB0C8F15553382A927F185C4F01.torrent",
+		"testdata/hybrid.torrent",
+		"testdata/issue_65a.torrent",
+	} {
+		mi, err := LoadFromFile(name)
+		qt.Assert(t, err, qt.IsNil)
+		qt.Check(t, mi.Validate(), qt.IsNil, qt.Commentf("%v", name))
+	}
+}
+
+// The nodes in this torrent are tracker URLs, not host:port pairs.
+func TestValidateTrackerlessNodes(t *testing.T) {
+	mi, err := LoadFromFile("testdata/trackerless.torrent")
+	qt.Assert(t, err, qt.IsNil)
+	var target NodeError
+	qt.Assert(t, errors.As(mi.Validate(), &target), qt.IsTrue)
+	qt.Check(t, target.Node, qt.Equals, Node("udp://tracker.openbittorrent.com:80"))
+}
+
+func TestValidateBadInfoBytes(t *testing.T) {
+	mi := MetaInfo{InfoBytes: []byte("i42e")}
+	var target InfoDecodeError
+	qt.Assert(t, errors.As(mi.Validate(), &target), qt.IsTrue)
+}
+
+func TestValidateReportsAllProblems(t *testing.T) {
+	c := qt.New(t)
+	mi := MetaInfo{
+		InfoBytes: bencode.MustMarshal(Info{
+			Name:        "name",
+			PieceLength: 4,
+			Pieces:      make([]byte, 2*HashSize),
+			Files: []FileInfo{
+				{Length: 4, Path: []string{"..", "etc"}},
+				{Length: 4, Path: []string{"a\x00b"}},
+				{Length: 4, Path: nil},
+			},
+		}),
+		Announce:     "http://tracker.example/announce",
+		AnnounceList: [][]string{{"://bad"}},
+		Nodes:        []Node{"1.2.3.4:6881", "1.2.3.4", "host:0"},
+	}
+	err := mi.Validate()
+	c.Assert(err, qt.Not(qt.IsNil))
+	var numPieces NumPiecesError
+	c.Assert(errors.As(err, &numPieces), qt.IsTrue)
+	c.Check(numPieces, qt.Equals, NumPiecesError{Expected: 3, Actual: 2})
+	var announce AnnounceURLError
+	c.Assert(errors.As(err, &announce), qt.IsTrue)
+	c.Check(announce.URL, qt.Equals, "://bad")
+	// Bad piece count, three bad paths, one bad announce URL and two bad nodes.
+	c.Check(err.(interface{ Unwrap() []error }).Unwrap(), qt.HasLen, 7)
+}
+
+func TestValidatePieceLength(t *testing.T) {
+	for _, pieceLength := range []int64{0, -1, 1 << 31} {
+		mi := MetaInfo{InfoBytes: bencode.MustMarshal(Info{Name: "a", PieceLength: pieceLength})}
+		var target PieceLengthError
+		qt.Check(t, errors.As(mi.Validate(), &target), qt.IsTrue, qt.Commentf("%v", pieceLength))
+	}
+}
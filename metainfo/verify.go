@@ -0,0 +1,185 @@
+package metainfo
+
+import (
+	"context"
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/anacrolix/torrent/segments"
+)
+
+type VerifyOpts struct {
+	// If not nil, called as each piece is checked. With more than one worker, pieces can be
+	// reported out of order, but calls aren't concurrent.
+	OnPiece func(index int, good bool)
+	// If not nil, called after each piece is checked with the number of bytes checked so far, and
+	// the total.
+	Progress func(bytesChecked, totalBytes int64)
+	// The number of pieces to check concurrently. Values less than 2 check sequentially.
+	Workers int
+}
+
+// Checks the data under root against the v1 piece hashes of info, without a client. root is where
+// the data is, as passed to BuildFromFilePath: the file itself for a single-file info, or the
+// directory holding the files. Element i of the result is whether piece i is good. Missing and short
+// files make the pieces they're in bad. Other I/O errors stop the check.
+func VerifyData(ctx context.Context, info *Info, root string, opts VerifyOpts) (good []bool, err error) {
+	if !info.HasV1() {
+		return nil, errors.New("info has no v1 pieces to check against")
+	}
+	if info.IsMerkle() {
+		return nil, errors.New("merkle infos have no pieces to check against")
+	}
+	if len(info.Pieces)%HashSize != 0 {
+		return nil, PiecesLengthError{len(info.Pieces)}
+	}
+	v := verifier{
+		info:  info,
+		root:  root,
+		opts:  opts,
+		files: info.UpvertedFiles(),
+	}
+	for _, fi := range v.files {
+		v.total += fi.Length
+	}
+	numPieces := info.NumPieces()
+	if numPieces != 0 && info.PieceLength <= 0 {
+		return nil, PieceLengthError{info.PieceLength, "not positive"}
+	}
+	files := v.files
+	v.index = segments.NewIndex(func() (segments.Length, bool) {
+		if len(files) == 0 {
+			return -1, false
+		}
+		l := files[0].Length
+		files = files[1:]
+		return l, true
+	})
+	good = make([]bool, numPieces)
+	workers := opts.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	pieces := make(chan int)
+	errs := make(chan error, workers)
+	// Cancelled if a worker fails, to stop feeding the others.
+	feedCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range pieces {
+				ok, err := v.checkPiece(i)
+				if err != nil {
+					errs <- err
+					cancel()
+					return
+				}
+				good[i] = ok
+				v.report(i, ok)
+			}
+		}()
+	}
+feed:
+	for i := 0; i < numPieces; i++ {
+		select {
+		case pieces <- i:
+		case <-feedCtx.Done():
+			break feed
+		}
+	}
+	close(pieces)
+	wg.Wait()
+	select {
+	case err = <-errs:
+		return nil, err
+	default:
+	}
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
+	return good, nil
+}
+
+type verifier struct {
+	info  *Info
+	root  string
+	opts  VerifyOpts
+	files []FileInfo
+	index segments.Index
+	total int64
+
+	mu      sync.Mutex
+	checked int64
+}
+
+func (v *verifier) report(index int, good bool) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.checked += v.pieceLength(index)
+	if v.opts.OnPiece != nil {
+		v.opts.OnPiece(index, good)
+	}
+	if v.opts.Progress != nil {
+		v.opts.Progress(v.checked, v.total)
+	}
+}
+
+func (v *verifier) pieceLength(index int) int64 {
+	off := int64(index) * v.info.PieceLength
+	if off+v.info.PieceLength > v.total {
+		return v.total - off
+	}
+	return v.info.PieceLength
+}
+
+// Returns an error only for problems other than missing or short files.
+func (v *verifier) checkPiece(index int) (good bool, err error) {
+	h := sha1.New()
+	good = true
+	v.index.Locate(segments.Extent{
+		Start:  int64(index) * v.info.PieceLength,
+		Length: v.pieceLength(index),
+	}, func(i int, e segments.Extent) bool {
+		good, err = v.hashFileExtent(h, v.files[i], e)
+		return good && err == nil
+	})
+	if !good || err != nil {
+		return
+	}
+	var sum Hash
+	copy(sum[:], h.Sum(nil))
+	return sum == v.info.Piece(index).Hash(), nil
+}
+
+func (v *verifier) hashFileExtent(w io.Writer, fi FileInfo, e segments.Extent) (good bool, err error) {
+	if fi.hasPaddingAttr() || fi.IsSymlink() {
+		// There's no file to read. Padding is zeroes, whatever's on disk.
+		_, err = io.CopyN(w, zeroFile{}, e.Length)
+		return err == nil, err
+	}
+	path, err := v.info.dataFilePath(v.root, &fi)
+	if err != nil {
+		return false, err
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	n, err := io.Copy(w, io.NewSectionReader(f, e.Start, e.Length))
+	if err != nil {
+		return false, fmt.Errorf("reading %q: %w", f.Name(), err)
+	}
+	// A short file makes the piece bad. Anything beyond the info length doesn't matter.
+	return n == e.Length, nil
+}
@@ -0,0 +1,118 @@
+package metainfo
+
+import (
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+)
+
+// The data for a piece didn't match its v1 hash.
+type PieceHashError struct {
+	Index int
+}
+
+func (me PieceHashError) Error() string {
+	return fmt.Sprintf("piece %v failed verification", me.Index)
+}
+
+// The data ended partway through a piece, so it couldn't be verified. That's not a failure: the rest
+// of the piece may just not have been written yet.
+type PieceUnverifiedError struct {
+	Index int
+	// How much of the piece was read, and how long it is.
+	Read, Length int64
+}
+
+func (me PieceUnverifiedError) Error() string {
+	return fmt.Sprintf("piece %v unverified: data ended after %v of %v bytes", me.Index, me.Read, me.Length)
+}
+
+// Passes through data for consecutive v1 pieces, checking each against its hash as it ends. See
+// NewPieceVerifyingReader.
+type PieceVerifyingReader struct {
+	info *Info
+	r    io.Reader
+	// The piece being read, and how much of it is left.
+	piece     int
+	remaining int64
+	hash      hash.Hash
+	err       error
+}
+
+// Returns a reader of r, which must have the data of info from the start of piece startPiece. Data is
+// returned as it's read, and the error from the Read that completes a piece whose hash doesn't match
+// is a PieceHashError. Nothing more is read after that. If r ends partway through a piece, the error
+// is a PieceUnverifiedError instead of io.EOF. The reader ends after the last piece without reading
+// any more of r.
+func NewPieceVerifyingReader(info *Info, startPiece int, r io.Reader) *PieceVerifyingReader {
+	ret := &PieceVerifyingReader{
+		info:  info,
+		r:     r,
+		piece: startPiece,
+		hash:  sha1.New(),
+	}
+	switch {
+	case !info.HasV1() || info.IsMerkle():
+		ret.err = errors.New("info has no v1 pieces to check against")
+	case info.ValidatePieces() != nil:
+		ret.err = info.ValidatePieces()
+	case startPiece < 0 || startPiece > info.NumPieces():
+		ret.err = fmt.Errorf("start piece %v out of range [0, %v]", startPiece, info.NumPieces())
+	default:
+		ret.startPiece()
+	}
+	return ret
+}
+
+func (me *PieceVerifyingReader) startPiece() {
+	me.hash.Reset()
+	if me.piece < me.info.NumPieces() {
+		me.remaining = me.info.Piece(me.piece).Length()
+	}
+}
+
+// The index of the next piece to be verified. Pieces before it, from the start piece, have passed.
+func (me *PieceVerifyingReader) NextPiece() int {
+	return me.piece
+}
+
+func (me *PieceVerifyingReader) Read(p []byte) (n int, err error) {
+	if me.err != nil {
+		return 0, me.err
+	}
+	if me.piece >= me.info.NumPieces() {
+		me.err = io.EOF
+		return 0, me.err
+	}
+	if int64(len(p)) > me.remaining {
+		p = p[:me.remaining]
+	}
+	n, err = me.r.Read(p)
+	me.hash.Write(p[:n])
+	me.remaining -= int64(n)
+	if me.remaining == 0 {
+		var sum Hash
+		me.hash.Sum(sum[:0])
+		if sum != me.info.Piece(me.piece).Hash() {
+			me.err = PieceHashError{me.piece}
+			return n, me.err
+		}
+		me.piece++
+		me.startPiece()
+		if err == io.EOF {
+			// The error can wait for the next Read, as the piece has ended anyway.
+			err = nil
+		}
+	}
+	if err == io.EOF {
+		if length := me.info.Piece(me.piece).Length(); me.remaining != length {
+			err = PieceUnverifiedError{me.piece, length - me.remaining, length}
+		}
+	}
+	if err != nil {
+		me.err = err
+	}
+	return
+}
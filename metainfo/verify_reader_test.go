@@ -0,0 +1,88 @@
+package metainfo
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/iotest"
+
+	qt "github.com/frankban/quicktest"
+)
+
+// Returns the data the pieces of info cover, padding included.
+func verifyTestData(c *qt.C, info *Info, root string) []byte {
+	var ret []byte
+	for _, fi := range info.UpvertedFiles() {
+		if fi.IsPadding() {
+			ret = append(ret, make([]byte, fi.Length)...)
+			continue
+		}
+		b, err := os.ReadFile(filepath.Join(root, filepath.Join(fi.Path...)))
+		c.Assert(err, qt.IsNil)
+		ret = append(ret, b...)
+	}
+	c.Assert(int64(len(ret)), qt.Equals, info.TotalLength())
+	return ret
+}
+
+func TestPieceVerifyingReader(t *testing.T) {
+	c := qt.New(t)
+	info, root := buildVerifyTestInfo(c)
+	data := verifyTestData(c, &info, root)
+	r := NewPieceVerifyingReader(&info, 0, iotest.OneByteReader(bytes.NewReader(data)))
+	b, err := ioutil.ReadAll(r)
+	c.Assert(err, qt.IsNil)
+	c.Check(b, qt.DeepEquals, data)
+	c.Check(r.NextPiece(), qt.Equals, 6)
+	// Starting partway, and with more data than the info has.
+	r = NewPieceVerifyingReader(&info, 3, bytes.NewReader(append(data[3*16384:], 1, 2, 3)))
+	b, err = ioutil.ReadAll(r)
+	c.Assert(err, qt.IsNil)
+	c.Check(b, qt.DeepEquals, data[3*16384:])
+}
+
+func TestPieceVerifyingReaderDamaged(t *testing.T) {
+	c := qt.New(t)
+	info, root := buildVerifyTestInfo(c)
+	data := verifyTestData(c, &info, root)
+	data[20000] ^= 0xff
+	r := NewPieceVerifyingReader(&info, 0, bytes.NewReader(data))
+	b, err := ioutil.ReadAll(r)
+	c.Check(err, qt.Equals, error(PieceHashError{1}))
+	c.Check(b, qt.DeepEquals, data[:2*16384])
+	c.Check(r.NextPiece(), qt.Equals, 1)
+	_, err = r.Read(make([]byte, 1))
+	c.Check(err, qt.Equals, error(PieceHashError{1}))
+}
+
+func TestPieceVerifyingReaderShort(t *testing.T) {
+	c := qt.New(t)
+	info, root := buildVerifyTestInfo(c)
+	data := verifyTestData(c, &info, root)
+	// Ending on a piece boundary is a plain EOF.
+	b, err := ioutil.ReadAll(NewPieceVerifyingReader(&info, 0, bytes.NewReader(data[:2*16384])))
+	c.Check(err, qt.IsNil)
+	c.Check(b, qt.HasLen, 2*16384)
+	// Ending partway through the short last piece, after its data was damaged, doesn't fail it.
+	data[5*16384] ^= 0xff
+	r := NewPieceVerifyingReader(&info, 5, bytes.NewReader(data[5*16384:5*16384+50]))
+	_, err = ioutil.ReadAll(r)
+	var unverified PieceUnverifiedError
+	c.Assert(errors.As(err, &unverified), qt.IsTrue)
+	c.Check(unverified, qt.Equals, PieceUnverifiedError{Index: 5, Read: 50, Length: 100})
+	c.Check(r.NextPiece(), qt.Equals, 5)
+}
+
+func TestPieceVerifyingReaderBadStart(t *testing.T) {
+	c := qt.New(t)
+	info, _ := buildVerifyTestInfo(c)
+	_, err := NewPieceVerifyingReader(&info, 7, bytes.NewReader(nil)).Read(make([]byte, 1))
+	c.Check(err, qt.ErrorMatches, `start piece 7 out of range \[0, 6\]`)
+	n, err := NewPieceVerifyingReader(&info, 6, bytes.NewReader([]byte{1})).Read(make([]byte, 1))
+	c.Check(n, qt.Equals, 0)
+	c.Check(err, qt.Equals, io.EOF)
+}
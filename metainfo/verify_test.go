@@ -0,0 +1,126 @@
+package metainfo
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+// Builds an info with padding from files spanning several 16 KiB pieces.
+func buildVerifyTestInfo(c *qt.C) (info Info, root string) {
+	root = filepath.Join(c.Mkdir(), "root")
+	c.Assert(os.Mkdir(root, 0o700), qt.IsNil)
+	for name, length := range map[string]int{"a": 40000, "b": 20000, "c": 100} {
+		data := make([]byte, length)
+		for i := range data {
+			data[i] = byte(i*7) ^ name[0]
+		}
+		c.Assert(ioutil.WriteFile(filepath.Join(root, name), data, 0o600), qt.IsNil)
+	}
+	info.PieceLength = 16384
+	_, err := info.BuildFromFilePathOpts(context.Background(), root, BuildFromFilePathOpts{PadFiles: true})
+	c.Assert(err, qt.IsNil)
+	// a is 3 pieces, padded, b is 2, padded, and c is 1.
+	c.Assert(info.NumPieces(), qt.Equals, 6)
+	return
+}
+
+func allGood(n int) []bool {
+	ret := make([]bool, n)
+	for i := range ret {
+		ret[i] = true
+	}
+	return ret
+}
+
+func TestVerifyData(t *testing.T) {
+	c := qt.New(t)
+	info, root := buildVerifyTestInfo(c)
+	for _, workers := range []int{0, 4} {
+		var reported []int
+		var lastChecked, lastTotal int64
+		good, err := VerifyData(context.Background(), &info, root, VerifyOpts{
+			Workers: workers,
+			OnPiece: func(index int, good bool) {
+				reported = append(reported, index)
+			},
+			Progress: func(checked, total int64) {
+				lastChecked, lastTotal = checked, total
+			},
+		})
+		c.Assert(err, qt.IsNil)
+		c.Check(good, qt.DeepEquals, allGood(6))
+		c.Check(reported, qt.HasLen, 6)
+		c.Check(lastTotal, qt.Equals, info.TotalLength())
+		c.Check(lastChecked, qt.Equals, lastTotal)
+	}
+}
+
+// Files are found where storage puts them, and never outside root.
+func TestVerifyDataPaths(t *testing.T) {
+	c := qt.New(t)
+	info, root := buildVerifyTestInfo(c)
+	last := &info.Files[len(info.Files)-1]
+	c.Assert(last.Path, qt.DeepEquals, []string{"c"})
+	last.Path = []string{"c\x00d"}
+	local, err := LocalPath(last.Path...)
+	c.Assert(err, qt.IsNil)
+	c.Assert(os.Rename(filepath.Join(root, "c"), filepath.Join(root, local)), qt.IsNil)
+	good, err := VerifyData(context.Background(), &info, root, VerifyOpts{})
+	c.Assert(err, qt.IsNil)
+	c.Check(good, qt.DeepEquals, allGood(6))
+
+	last.Path = []string{"..", "c"}
+	_, err = VerifyData(context.Background(), &info, root, VerifyOpts{})
+	c.Check(errors.As(err, new(FilePathError)), qt.IsTrue, qt.Commentf("%v", err))
+}
+
+func TestVerifyDataDamaged(t *testing.T) {
+	c := qt.New(t)
+	info, root := buildVerifyTestInfo(c)
+	f, err := os.OpenFile(filepath.Join(root, "a"), os.O_WRONLY, 0)
+	c.Assert(err, qt.IsNil)
+	_, err = f.WriteAt([]byte{0xff}, 20000)
+	c.Assert(err, qt.IsNil)
+	c.Assert(f.Close(), qt.IsNil)
+	// Short, but its first piece is intact.
+	c.Assert(os.Truncate(filepath.Join(root, "b"), 16384), qt.IsNil)
+	c.Assert(os.Remove(filepath.Join(root, "c")), qt.IsNil)
+	good, err := VerifyData(context.Background(), &info, root, VerifyOpts{Workers: 2})
+	c.Assert(err, qt.IsNil)
+	c.Check(good, qt.DeepEquals, []bool{true, false, true, true, false, false})
+}
+
+func TestVerifyDataSingleFile(t *testing.T) {
+	c := qt.New(t)
+	root := filepath.Join(c.Mkdir(), "file")
+	c.Assert(ioutil.WriteFile(root, make([]byte, 20000), 0o600), qt.IsNil)
+	info := Info{PieceLength: 16384}
+	c.Assert(info.BuildFromFilePath(root), qt.IsNil)
+	good, err := VerifyData(context.Background(), &info, root, VerifyOpts{})
+	c.Assert(err, qt.IsNil)
+	c.Check(good, qt.DeepEquals, allGood(2))
+	good, err = VerifyData(context.Background(), &info, filepath.Join(c.Mkdir(), "missing"), VerifyOpts{})
+	c.Assert(err, qt.IsNil)
+	c.Check(good, qt.DeepEquals, []bool{false, false})
+}
+
+func TestVerifyDataCancelled(t *testing.T) {
+	c := qt.New(t)
+	info, root := buildVerifyTestInfo(c)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := VerifyData(ctx, &info, root, VerifyOpts{})
+	c.Check(err, qt.Equals, context.Canceled)
+}
+
+func TestVerifyDataNeedsV1(t *testing.T) {
+	info := Info{MetaVersion: 2, PieceLength: 16384}
+	_, err := VerifyData(context.Background(), &info, "", VerifyOpts{})
+	qt.Check(t, err, qt.ErrorMatches, "info has no v1 pieces to check against")
+}
@@ -0,0 +1,83 @@
+package metainfo
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+type WriteFileOpts struct {
+	// The permissions of the file. Zero means 0644. The umask isn't applied.
+	Mode os.FileMode
+	// Replace any existing file at the path. Otherwise an existing file is an error satisfying
+	// os.IsExist.
+	Overwrite bool
+}
+
+// Writes the MetaInfo to the file at path, replacing it atomically so that it's never left
+// partially written. See WriteToFileOpts.
+func (mi MetaInfo) WriteToFile(path string) error {
+	return mi.WriteToFileOpts(path, WriteFileOpts{})
+}
+
+// Writes the MetaInfo to a temporary file in the same directory as path, syncs it, and then moves it
+// into place.
+func (mi MetaInfo) WriteToFileOpts(path string, opts WriteFileOpts) (err error) {
+	mode := opts.Mode
+	if mode == 0 {
+		mode = 0644
+	}
+	f, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return
+	}
+	tmpName := f.Name()
+	// The temporary file is removed whatever happens. It's either been moved into place, or it's no
+	// longer wanted.
+	defer os.Remove(tmpName)
+	err = mi.Write(f)
+	if err == nil {
+		err = f.Chmod(mode)
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	closeErr := f.Close()
+	if err != nil {
+		return
+	}
+	if closeErr != nil {
+		return closeErr
+	}
+	if opts.Overwrite {
+		return replaceFile(tmpName, path)
+	}
+	return linkNewFile(tmpName, path)
+}
+
+func replaceFile(from, to string) error {
+	err := os.Rename(from, to)
+	if err != nil && runtime.GOOS == "windows" {
+		// Windows can rename over an existing file, but not a read-only one, which other platforms
+		// allow.
+		if os.Chmod(to, 0666) == nil {
+			err = os.Rename(from, to)
+		}
+	}
+	return err
+}
+
+// Gives from the name to, failing if to exists. from remains, and is up to the caller to remove.
+func linkNewFile(from, to string) error {
+	err := os.Link(from, to)
+	if err == nil || os.IsExist(err) {
+		return err
+	}
+	// Hard links aren't supported by every filesystem. Fall back on checking first, which can race
+	// with another writer.
+	if _, statErr := os.Lstat(to); statErr == nil {
+		return &os.LinkError{Op: "link", Old: from, New: to, Err: os.ErrExist}
+	}
+	return os.Rename(from, to)
+}
@@ -0,0 +1,82 @@
+package metainfo
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func writeFileTestMetaInfo(comment string) MetaInfo {
+	return MetaInfo{
+		InfoBytes: []byte("d4:name1:xe"),
+		Comment:   comment,
+	}
+}
+
+// Checks the file at path holds mi, and that no temporary files were left behind.
+func checkWrittenFile(c *qt.C, path string, mi MetaInfo) {
+	var buf bytes.Buffer
+	c.Assert(mi.Write(&buf), qt.IsNil)
+	b, err := ioutil.ReadFile(path)
+	c.Assert(err, qt.IsNil)
+	c.Check(string(b), qt.Equals, buf.String())
+	names, err := ioutil.ReadDir(filepath.Dir(path))
+	c.Assert(err, qt.IsNil)
+	c.Check(names, qt.HasLen, 1)
+}
+
+func TestWriteToFile(t *testing.T) {
+	c := qt.New(t)
+	path := filepath.Join(c.Mkdir(), "a.torrent")
+	mi := writeFileTestMetaInfo("first")
+	c.Assert(mi.WriteToFile(path), qt.IsNil)
+	checkWrittenFile(c, path, mi)
+	if runtime.GOOS != "windows" {
+		fi, err := os.Stat(path)
+		c.Assert(err, qt.IsNil)
+		c.Check(fi.Mode().Perm(), qt.Equals, os.FileMode(0644))
+	}
+	// Existing files are kept unless overwriting is asked for.
+	err := writeFileTestMetaInfo("second").WriteToFile(path)
+	c.Check(os.IsExist(err), qt.IsTrue, qt.Commentf("%v", err))
+	checkWrittenFile(c, path, mi)
+}
+
+func TestWriteToFileOptsMode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("permission bits aren't supported")
+	}
+	c := qt.New(t)
+	path := filepath.Join(c.Mkdir(), "a.torrent")
+	c.Assert(writeFileTestMetaInfo("").WriteToFileOpts(path, WriteFileOpts{Mode: 0600}), qt.IsNil)
+	fi, err := os.Stat(path)
+	c.Assert(err, qt.IsNil)
+	c.Check(fi.Mode().Perm(), qt.Equals, os.FileMode(0600))
+}
+
+// Replacing must behave the same everywhere, including Windows, where renaming over a read-only file
+// fails.
+func TestWriteToFileOverwrite(t *testing.T) {
+	c := qt.New(t)
+	path := filepath.Join(c.Mkdir(), "a.torrent")
+	c.Assert(writeFileTestMetaInfo("first").WriteToFile(path), qt.IsNil)
+	c.Assert(os.Chmod(path, 0444), qt.IsNil)
+	mi := writeFileTestMetaInfo("second")
+	c.Assert(mi.WriteToFileOpts(path, WriteFileOpts{Overwrite: true}), qt.IsNil)
+	checkWrittenFile(c, path, mi)
+	// Overwriting a file that doesn't exist is fine too.
+	c.Assert(os.Remove(path), qt.IsNil)
+	c.Assert(mi.WriteToFileOpts(path, WriteFileOpts{Overwrite: true}), qt.IsNil)
+	checkWrittenFile(c, path, mi)
+}
+
+func TestWriteToFileMissingDir(t *testing.T) {
+	c := qt.New(t)
+	err := writeFileTestMetaInfo("").WriteToFile(filepath.Join(c.Mkdir(), "missing", "a.torrent"))
+	c.Check(os.IsNotExist(err), qt.IsTrue, qt.Commentf("%v", err))
+}
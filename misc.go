@@ -83,19 +83,13 @@ func torrentRequestOffset(torrentLength, pieceSize int64, r Request) (off int64)
 }
 
 func validateInfo(info *metainfo.Info) error {
-	if len(info.Pieces)%20 != 0 {
-		return errors.New("pieces has invalid length")
+	if !info.HasV1() {
+		return errors.New("v2-only infos aren't supported")
 	}
-	if info.PieceLength == 0 {
-		if info.TotalLength() != 0 {
-			return errors.New("zero piece length")
-		}
-	} else {
-		if int((info.TotalLength()+info.PieceLength-1)/info.PieceLength) != info.NumPieces() {
-			return errors.New("piece count and file lengths are at odds")
-		}
+	if info.IsMerkle() {
+		return errors.New("merkle torrents aren't supported")
 	}
-	return nil
+	return info.ValidatePieces()
 }
 
 func chunkIndexSpec(index pp.Integer, pieceLength, chunkSize pp.Integer) ChunkSpec {
@@ -23,6 +23,9 @@ func (ms *MMapSpan) Close() (errs []error) {
 	ms.mu.Lock()
 	defer ms.mu.Unlock()
 	for _, mMap := range ms.mMaps {
+		if mMap == nil {
+			continue
+		}
 		err := mMap.Unmap()
 		if err != nil {
 			errs = append(errs, err)
@@ -77,6 +80,32 @@ func (ms *MMapSpan) locateCopy(copyArgs func(remainingArgument, mmapped []byte)
 	return
 }
 
+// Reads from the i-th mmap appended, at off within it. Returns EOF if p goes past its end.
+func (ms *MMapSpan) ReadMapAt(i int, p []byte, off int64) (n int, err error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	if i >= 0 && i < len(ms.mMaps) && off < int64(len(ms.mMaps[i])) {
+		n = copy(p, ms.mMaps[i][off:])
+	}
+	if n != len(p) {
+		err = io.EOF
+	}
+	return
+}
+
+// Writes to the i-th mmap appended, at off within it.
+func (ms *MMapSpan) WriteMapAt(i int, p []byte, off int64) (n int, err error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	if i >= 0 && i < len(ms.mMaps) && off < int64(len(ms.mMaps[i])) {
+		n = copy(ms.mMaps[i][off:], p)
+	}
+	if n != len(p) {
+		err = io.ErrShortWrite
+	}
+	return
+}
+
 func (ms *MMapSpan) WriteAt(p []byte, off int64) (n int, err error) {
 	// log.Printf("writing %v bytes at %v", len(p), off)
 	ms.mu.RLock()
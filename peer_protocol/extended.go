@@ -29,4 +29,6 @@ const (
 	// http://bittorrent.org/beps/bep_0009.html. Note that there's an
 	// LT_metadata, but I've never implemented it.
 	ExtensionNameMetadata = "ut_metadata"
+	// http://bittorrent.org/beps/bep_0028.html
+	ExtensionNameTex = "lt_tex"
 )
@@ -28,7 +28,7 @@ func (m *PexMsg) Message(pexExtendedId ExtensionNumber) Message {
 }
 
 func LoadPexMsg(b []byte) (ret PexMsg, err error) {
-	err = bencode.Unmarshal(b, &ret)
+	err = bencode.UnmarshalNetwork(b, &ret)
 	return
 }
 
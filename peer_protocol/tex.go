@@ -0,0 +1,25 @@
+package peer_protocol
+
+import (
+	"github.com/anacrolix/torrent/bencode"
+)
+
+// http://bittorrent.org/beps/bep_0028.html
+type TexMsg struct {
+	// Tracker URLs.
+	Added []string `bencode:"added"`
+}
+
+func (m *TexMsg) Message(texExtendedId ExtensionNumber) Message {
+	payload := bencode.MustMarshal(m)
+	return Message{
+		Type:            Extended,
+		ExtendedID:      texExtendedId,
+		ExtendedPayload: payload,
+	}
+}
+
+func LoadTexMsg(b []byte) (ret TexMsg, err error) {
+	err = bencode.UnmarshalNetwork(b, &ret)
+	return
+}
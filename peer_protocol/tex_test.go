@@ -0,0 +1,21 @@
+package peer_protocol
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTexMsg(t *testing.T) {
+	m := TexMsg{Added: []string{"http://a/announce", "udp://b:6969"}}
+	msg := m.Message(3)
+	assert.EqualValues(t, Extended, msg.Type)
+	assert.EqualValues(t, 3, msg.ExtendedID)
+	assert.Equal(t, "d5:addedl17:http://a/announce12:udp://b:6969ee", string(msg.ExtendedPayload))
+	rx, err := LoadTexMsg(msg.ExtendedPayload)
+	require.NoError(t, err)
+	assert.Equal(t, m, rx)
+	_, err = LoadTexMsg([]byte("d5:addedi1ee"))
+	assert.Error(t, err)
+}
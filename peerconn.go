@@ -147,6 +147,7 @@ type PeerConn struct {
 	writerCond  sync.Cond
 
 	pex pexConnState
+	tex texConnState
 }
 
 func (cn *PeerConn) connStatusString() string {
@@ -365,6 +366,9 @@ func (cn *PeerConn) onClose() {
 	if cn.pex.IsEnabled() {
 		cn.pex.Close()
 	}
+	if cn.tex.IsEnabled() {
+		cn.tex.Close()
+	}
 	cn.tickleWriter()
 	if cn.conn != nil {
 		cn.conn.Close()
@@ -647,6 +651,11 @@ func (cn *PeerConn) fillWriteBuffer() {
 			return
 		}
 	}
+	if cn.tex.IsEnabled() {
+		if flow := cn.tex.Share(cn.write); !flow {
+			return
+		}
+	}
 	cn.upload(cn.write)
 }
 
@@ -1288,7 +1297,7 @@ func (c *PeerConn) onReadExtendedMsg(id pp.ExtensionNumber, payload []byte) (err
 	switch id {
 	case pp.HandshakeExtendedID:
 		var d pp.ExtendedHandshakeMessage
-		if err := bencode.Unmarshal(payload, &d); err != nil {
+		if err := bencode.UnmarshalNetwork(payload, &d); err != nil {
 			c.logger.Printf("error parsing extended handshake message %q: %s", payload, err)
 			return errors.Wrap(err, "unmarshalling extended handshake payload")
 		}
@@ -1317,10 +1326,11 @@ func (c *PeerConn) onReadExtendedMsg(id pp.ExtensionNumber, payload []byte) (err
 			}
 		}
 		c.requestPendingMetadata()
-		if !t.cl.config.DisablePEX {
+		if t.pexEnabled() {
 			t.pex.Add(c) // we learnt enough now
 			c.pex.Init(c)
 		}
+		c.tex.Init(c)
 		return nil
 	case metadataExtendedId:
 		err := cl.gotMetadataExtensionMsg(payload, t, c)
@@ -1333,6 +1343,11 @@ func (c *PeerConn) onReadExtendedMsg(id pp.ExtensionNumber, payload []byte) (err
 			return nil // or hang-up maybe?
 		}
 		return c.pex.Recv(payload)
+	case texExtendedId:
+		if !c.tex.IsEnabled() {
+			return nil
+		}
+		return c.tex.Recv(payload)
 	default:
 		return fmt.Errorf("unexpected extended message ID: %v", id)
 	}
@@ -35,7 +35,7 @@ func (s *pexConnState) IsEnabled() bool {
 // Init is called from the reader goroutine upon the extended handshake completion
 func (s *pexConnState) Init(c *PeerConn) {
 	xid, ok := c.PeerExtensionIDs[pp.ExtensionNamePex]
-	if !ok || xid == 0 || c.t.cl.config.DisablePEX {
+	if !ok || xid == 0 || !c.t.pexEnabled() {
 		return
 	}
 	s.xid = xid
@@ -126,4 +126,5 @@ func (s *pexConnState) Close() {
 	if s.timer != nil {
 		s.timer.Stop()
 	}
+	s.enabled = false
 }
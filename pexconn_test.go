@@ -7,6 +7,7 @@ import (
 	"github.com/anacrolix/dht/v2/krpc"
 	"github.com/stretchr/testify/require"
 
+	"github.com/anacrolix/torrent/internal/testutil"
 	"github.com/anacrolix/torrent/metainfo"
 	pp "github.com/anacrolix/torrent/peer_protocol"
 )
@@ -54,3 +55,37 @@ func TestPexConnState(t *testing.T) {
 	}
 	require.EqualValues(t, targx, x)
 }
+
+// Connections made while a magnet's info was unknown are forgotten by PEX once it's private.
+func TestPexStoppedForPrivateMagnet(t *testing.T) {
+	cl, err := NewClient(TestingConfig(t))
+	require.NoError(t, err)
+	defer cl.Close()
+	mi := testutil.GreetingMetaInfo()
+	require.NoError(t, mi.SetPrivate(true))
+	torrent, _ := cl.AddTorrentInfoHash(mi.HashInfoBytes())
+	require.True(t, torrent.PexEnabled())
+
+	cl.lock()
+	defer cl.unlock()
+	addr := &net.TCPAddr{IP: net.IPv6loopback, Port: 4747}
+	c := cl.newConnection(nil, false, addr, addr.Network(), "")
+	c.PeerExtensionIDs = map[pp.ExtensionName]pp.ExtensionNumber{pp.ExtensionNamePex: pexExtendedId}
+	c.setTorrent(torrent)
+	require.NoError(t, torrent.addConnection(c))
+	torrent.pex.Add(c)
+	c.pex.Init(c)
+	require.True(t, c.pex.IsEnabled())
+
+	require.NoError(t, torrent.setInfoBytes(mi.InfoBytes))
+	require.False(t, torrent.pexEnabled())
+	require.False(t, c.pex.IsEnabled())
+	require.Empty(t, torrent.pex.ev)
+	require.Zero(t, torrent.pex.nc)
+
+	// Nor is the connection dropped over PEX when it closes.
+	c.closed.Set()
+	require.True(t, torrent.deleteConnection(c))
+	require.Empty(t, torrent.pex.ev)
+	require.Empty(t, torrent.pex.hold)
+}
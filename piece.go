@@ -225,6 +225,12 @@ func (p *Piece) uncachedPriority() (ret piecePriority) {
 	if p.t.pieceComplete(p.index) || p.t.pieceQueuedForHash(p.index) || p.t.hashingPiece(p.index) {
 		return PiecePriorityNone
 	}
+	return p.requestedPriority()
+}
+
+// The priority asked for by the files, readers and the piece's own priority, whether or not the
+// piece is complete or being hashed.
+func (p *Piece) requestedPriority() (ret piecePriority) {
 	for _, f := range p.files {
 		ret.Raise(f.prio)
 	}
@@ -8,7 +8,7 @@ import (
 )
 
 // Peers are stored with their priority at insertion. Their priority may
-// change if our apparent IP changes, we don't currently handle that.
+// change if our apparent IP changes, in which case they're reprioritized.
 type prioritizedPeersItem struct {
 	prio peerPriority
 	p    PeerInfo
@@ -74,6 +74,18 @@ func (me *prioritizedPeers) DeleteMin() (ret prioritizedPeersItem, ok bool) {
 	return
 }
 
+// Recomputes the priorities of all the peers.
+func (me *prioritizedPeers) reprioritize() {
+	var ps []PeerInfo
+	me.Each(func(p PeerInfo) {
+		ps = append(ps, p)
+	})
+	me.om.Clear(false)
+	for _, p := range ps {
+		me.Add(p)
+	}
+}
+
 func (me *prioritizedPeers) PopMax() PeerInfo {
 	return me.om.DeleteMax().(prioritizedPeersItem).p
 }
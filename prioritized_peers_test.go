@@ -53,3 +53,26 @@ func TestPrioritizedPeers(t *testing.T) {
 	min(nil)
 	pop(nil)
 }
+
+func TestPrioritizedPeersReprioritize(t *testing.T) {
+	var prio peerPriority
+	pp := prioritizedPeers{
+		om: btree.New(3),
+		getPrio: func(p PeerInfo) peerPriority {
+			if p.Addr.String() == "1.2.3.4:1" {
+				return prio
+			}
+			return 1
+		},
+	}
+	a := PeerInfo{Addr: ipPortAddr{IP: net.ParseIP("1.2.3.4"), Port: 1}}
+	b := PeerInfo{Addr: ipPortAddr{IP: net.ParseIP("5.6.7.8"), Port: 1}}
+	pp.Add(a)
+	pp.Add(b)
+	prio = 2
+	pp.reprioritize()
+	assert.Equal(t, 2, pp.Len())
+	// The existing peer is found with its new priority, rather than added again.
+	assert.True(t, pp.Add(a))
+	assert.Equal(t, a, pp.PopMax())
+}
@@ -0,0 +1,170 @@
+package torrent
+
+import (
+	"bytes"
+	"net"
+	"time"
+
+	"github.com/anacrolix/log"
+)
+
+// How long a report of our public IP counts toward it.
+const publicIpReportTtl = 2 * time.Hour
+
+// Reports of our public IP, such as from trackers per BEP 24. Each source's latest report in a
+// family is a vote, and the IP with the most votes in the family wins, the most recent report
+// breaking ties. So a tracker that disagrees, or changes its mind, doesn't flap the result. Guarded
+// by the client lock.
+type publicIpReports struct {
+	bySource map[publicIpSource]publicIpReport
+	// The winners, only changed by reports so that they're stable between them.
+	ip4, ip6 net.IP
+}
+
+type publicIpSource struct {
+	source string
+	ipv4   bool
+}
+
+type publicIpReport struct {
+	ip net.IP
+	at time.Time
+}
+
+// Records the source's report of ip, returning whether the winner of its family changed.
+func (me *publicIpReports) report(source string, ip net.IP, now time.Time) (changed bool) {
+	ipv4 := ip.To4() != nil
+	if me.bySource == nil {
+		me.bySource = make(map[publicIpSource]publicIpReport)
+	}
+	me.bySource[publicIpSource{source, ipv4}] = publicIpReport{ip, now}
+	for s, r := range me.bySource {
+		if now.Sub(r.at) > publicIpReportTtl {
+			delete(me.bySource, s)
+		}
+	}
+	best := me.best(ipv4)
+	winner := &me.ip6
+	if ipv4 {
+		winner = &me.ip4
+	}
+	if best.Equal(*winner) {
+		return false
+	}
+	*winner = best
+	return true
+}
+
+// Counts the votes for the family, then picks the winner. Ties that the most recent report doesn't
+// break go to the lowest IP, so the result doesn't depend on map order.
+func (me *publicIpReports) best(ipv4 bool) (ret net.IP) {
+	tallies := make(map[string]*publicIpTally)
+	for s, r := range me.bySource {
+		if s.ipv4 != ipv4 {
+			continue
+		}
+		key := r.ip.String()
+		t := tallies[key]
+		if t == nil {
+			t = &publicIpTally{ip: r.ip}
+			tallies[key] = t
+		}
+		t.votes++
+		if r.at.After(t.latest) {
+			t.latest = r.at
+		}
+	}
+	var best *publicIpTally
+	for _, t := range tallies {
+		if best == nil || t.beats(best) {
+			best = t
+		}
+	}
+	if best == nil {
+		return nil
+	}
+	return best.ip
+}
+
+// The votes for an IP in a family.
+type publicIpTally struct {
+	votes  int
+	latest time.Time
+	ip     net.IP
+}
+
+func (me *publicIpTally) beats(other *publicIpTally) bool {
+	if me.votes != other.votes {
+		return me.votes > other.votes
+	}
+	if !me.latest.Equal(other.latest) {
+		return me.latest.After(other.latest)
+	}
+	return bytes.Compare(me.ip.To16(), other.ip.To16()) < 0
+}
+
+// Records a report of our public IP. Peers are reprioritized if it changes what we think it is.
+// Call with the client lock held.
+func (cl *Client) reportPublicIp(source string, ip net.IP) {
+	me := &cl.publicIpReports
+	if !me.report(source, ip, time.Now()) {
+		return
+	}
+	winner := me.ip6
+	if ip.To4() != nil {
+		winner = me.ip4
+	}
+	cl.logger.WithDefaultLevel(log.Debug).Printf("reported public ip is now %v", winner)
+	for _, t := range cl.torrents {
+		// The BEP 40 priorities of peers depend on our IP.
+		t.peers.reprioritize()
+	}
+	// As do our BEP 42 DHT node IDs.
+	cl.resecureDhtServers()
+}
+
+// Our public IP in the family, as configured, or failing that, as has been reported. Call with the
+// client lock held.
+func (cl *Client) knownPublicIp(ipv4 bool) net.IP {
+	if ipv4 {
+		return firstNotNil(cl.config.PublicIp4, cl.publicIpReports.ip4)
+	}
+	return firstNotNil(cl.config.PublicIp6, cl.publicIpReports.ip6)
+}
+
+// Returns our public IPs, IPv4 first, as given by ClientConfig.PublicIp4 and PublicIp6, or
+// otherwise as reported by the most trackers. It's empty if there's nothing to go on.
+func (cl *Client) PublicIPs() (ret []net.IP) {
+	cl.rLock()
+	defer cl.rUnlock()
+	for _, ipv4 := range []bool{true, false} {
+		if ip := cl.knownPublicIp(ipv4); ip != nil {
+			ret = append(ret, ip)
+		}
+	}
+	return
+}
+
+// Whether DHT announces through the server should use implied_port, so that nodes take our port to
+// be the one our queries come from. We're behind NAT if our public IP in the server's family is
+// known, and isn't one of our own. The NAT may not map the port we listen on to the same port, but
+// it maps the server's socket to the port nodes see, and that reaches uTP on the socket too. Call
+// with the client lock held.
+func (cl *Client) dhtImpliedPort(s DhtServer) bool {
+	ip := cl.knownPublicIp(addrIpOrNil(s.Addr()).To4() != nil)
+	return ip != nil && !ipIsOurs(ip)
+}
+
+// Whether the IP is on one of our interfaces. It's taken to be if the interfaces can't be listed.
+func ipIsOurs(ip net.IP) bool {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return true
+	}
+	for _, a := range addrs {
+		if ipNet, ok := a.(*net.IPNet); ok && ipNet.IP.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,87 @@
+package torrent
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/frankban/quicktest"
+
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/internal/testutil"
+	"github.com/anacrolix/torrent/tracker"
+)
+
+func TestPublicIpReports(t *testing.T) {
+	c := quicktest.New(t)
+	var me publicIpReports
+	now := time.Now()
+	a := net.ParseIP("1.2.3.4").To4()
+	b := net.ParseIP("5.6.7.8").To4()
+	c.Check(me.report("x", a, now), quicktest.IsTrue)
+	c.Check(me.ip4, quicktest.DeepEquals, a)
+	// A tie goes to the most recent report.
+	c.Check(me.report("y", b, now.Add(time.Second)), quicktest.IsTrue)
+	c.Check(me.ip4, quicktest.DeepEquals, b)
+	// The majority wins, however recent the dissent.
+	c.Check(me.report("z", a, now.Add(2*time.Second)), quicktest.IsTrue)
+	c.Check(me.report("y", b, now.Add(3*time.Second)), quicktest.IsFalse)
+	c.Check(me.ip4, quicktest.DeepEquals, a)
+	// The families are counted apart, and the same source can report both.
+	ip6 := net.ParseIP("2001:db8::1")
+	c.Check(me.report("y", ip6, now.Add(4*time.Second)), quicktest.IsTrue)
+	c.Check(me.ip6, quicktest.DeepEquals, ip6)
+	c.Check(me.ip4, quicktest.DeepEquals, a)
+	c.Check(me.report("y", b, now.Add(5*time.Second)), quicktest.IsFalse)
+	// Old reports stop counting.
+	c.Check(me.report("y", b, now.Add(publicIpReportTtl+3*time.Second)), quicktest.IsTrue)
+	c.Check(me.ip4, quicktest.DeepEquals, b)
+}
+
+// The winner doesn't depend on the order the reports are counted in.
+func TestPublicIpReportsTies(t *testing.T) {
+	c := quicktest.New(t)
+	now := time.Now()
+	a := net.ParseIP("1.2.3.4").To4()
+	b := net.ParseIP("5.6.7.8").To4()
+	for i := 0; i < 100; i++ {
+		var me publicIpReports
+		// b's latest report is most recent, although a's first vote is.
+		me.report("w", a, now.Add(2*time.Second))
+		me.report("x", a, now)
+		me.report("y", b, now.Add(time.Second))
+		me.report("z", b, now.Add(3*time.Second))
+		c.Assert(me.best(true), quicktest.DeepEquals, b)
+		// Equally recent ties go to the lowest IP.
+		me.report("z", b, now.Add(2*time.Second))
+		c.Assert(me.best(true), quicktest.DeepEquals, a)
+	}
+}
+
+func TestTrackerExternalIp(t *testing.T) {
+	c := quicktest.New(t)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(bencode.MustMarshal(tracker.HttpResponse{Interval: 1800, ExternalIp: "\x01\x02\x03\x04"}))
+	}))
+	defer s.Close()
+
+	cfg := TestingConfig(t)
+	cfg.DisableTrackers = false
+	cl, err := NewClient(cfg)
+	c.Assert(err, quicktest.IsNil)
+	defer cl.Close()
+	c.Check(cl.PublicIPs(), quicktest.HasLen, 0)
+	mi := testutil.GreetingMetaInfo()
+	mi.Announce = s.URL + "/announce"
+	tt, err := cl.AddTorrent(mi)
+	c.Assert(err, quicktest.IsNil)
+	waitActiveTracker(c, tt)
+	ips := cl.PublicIPs()
+	c.Assert(ips, quicktest.HasLen, 1)
+	c.Check(ips[0].Equal(net.ParseIP("1.2.3.4")), quicktest.IsTrue)
+	cl.lock()
+	c.Check(cl.publicIp(net.ParseIP("5.6.7.8")).Equal(ips[0]), quicktest.IsTrue)
+	cl.unlock()
+}
@@ -1,6 +1,8 @@
 package torrent
 
 import (
+	"errors"
+
 	"github.com/anacrolix/torrent/metainfo"
 	"github.com/anacrolix/torrent/storage"
 )
@@ -15,10 +17,15 @@ type TorrentSpec struct {
 	// The name to use if the Name field from the Info isn't available.
 	DisplayName string
 	Webseeds    []string
-	DhtNodes    []string
-	PeerAddrs   []string
+	// Webseeds that serve pieces rather than files. BEP 17.
+	HttpSeeds []string
+	DhtNodes  []string
+	PeerAddrs []string
 	// The combination of the "xs" and "as" fields in magnet links, for now.
 	Sources []string
+	// The files to download once the info is available, from the "so" field in magnet links. The
+	// other files are set to PiecePriorityNone.
+	SelectOnly metainfo.SelectOnly
 
 	// The chunk size to use for outbound requests. Defaults to 16KiB if not set.
 	ChunkSize int
@@ -27,6 +34,25 @@ type TorrentSpec struct {
 	// Whether to allow data download or upload
 	DisallowDataUpload   bool
 	DisallowDataDownload bool
+
+	// Don't use the DHT for the torrent, as for content that's private without the info saying so.
+	// Ignored if the torrent is already in the client.
+	DisableDHT bool
+	// Look up peers on the DHT, but don't announce the torrent to it. See Torrent.SetDhtAnnounce.
+	// Ignored if the torrent is already in the client.
+	DisableDhtAnnounce bool
+
+	// The tracker announce key to use, such as one from Torrent.AnnounceKey saved with the
+	// torrent's resume data, so trackers don't count us twice across sessions. If zero, a random
+	// key is used. Ignored if the torrent is already in the client.
+	AnnounceKey int32
+	// The uploaded and downloaded totals from earlier sessions, as saved from TorrentStats, to
+	// continue from in tracker announces. Ignored if the torrent is already in the client.
+	Uploaded   int64
+	Downloaded int64
+	// Replaces ClientConfig.TrackerAnnounceParams for the torrent if not nil. Ignored if the torrent
+	// is already in the client.
+	TrackerAnnounceParams *TrackerAnnounceParams
 }
 
 func TorrentSpecFromMagnetUri(uri string) (spec *TorrentSpec, err error) {
@@ -34,13 +60,27 @@ func TorrentSpecFromMagnetUri(uri string) (spec *TorrentSpec, err error) {
 	if err != nil {
 		return
 	}
+	if m.InfoHash == (metainfo.Hash{}) && m.InfoHashV2 == nil {
+		err = errors.New("magnet link is to a mutable torrent, with no infohash: see Client.AddMutableTorrent")
+		return
+	}
+	if m.InfoHash == (metainfo.Hash{}) {
+		err = errors.New("v2-only magnets aren't supported")
+		return
+	}
+	spec = torrentSpecFromMagnet(m)
+	return
+}
+
+func torrentSpecFromMagnet(m metainfo.Magnet) (spec *TorrentSpec) {
 	spec = &TorrentSpec{
 		Trackers:    [][]string{m.Trackers},
 		DisplayName: m.DisplayName,
 		InfoHash:    m.InfoHash,
 		Webseeds:    m.Params["ws"],
-		Sources:     append(m.Params["xs"], m.Params["as"]...),
-		PeerAddrs:   m.Params["x.pe"], // BEP 9
+		Sources:     append(append([]string(nil), m.ExactSource...), m.AcceptableSource...),
+		PeerAddrs:   m.Peers,
+		SelectOnly:  m.SelectOnly,
 		// TODO: What's the parameter for DHT nodes?
 	}
 	return
@@ -55,12 +95,13 @@ func TorrentSpecFromMetaInfo(mi *metainfo.MetaInfo) *TorrentSpec {
 		Trackers:    mi.UpvertedAnnounceList(),
 		InfoHash:    mi.HashInfoBytes(),
 		InfoBytes:   mi.InfoBytes,
-		DisplayName: info.Name,
+		DisplayName: info.BestName(),
 		Webseeds:    mi.UrlList,
+		HttpSeeds:   mi.HttpSeeds,
 		DhtNodes: func() (ret []string) {
-			ret = make([]string, len(mi.Nodes))
+			ret = make([]string, 0, len(mi.Nodes))
 			for _, node := range mi.Nodes {
-				ret = append(ret, string(node))
+				ret = append(ret, node.String())
 			}
 			return
 		}(),
@@ -6,10 +6,6 @@ import (
 	"os"
 	"path/filepath"
 
-	"github.com/anacrolix/missinggo"
-	"github.com/anacrolix/torrent/common"
-	"github.com/anacrolix/torrent/segments"
-
 	"github.com/anacrolix/torrent/metainfo"
 )
 
@@ -70,8 +66,11 @@ func (fs *fileClientImpl) OpenTorrent(info *metainfo.Info, infoHash metainfo.Has
 	dir := fs.pathMaker(fs.baseDir, info, infoHash)
 	upvertedFiles := info.UpvertedFiles()
 	files := make([]file, 0, len(upvertedFiles))
+	// Zero-length files that go with a piece are created when it's complete. The rest are created
+	// now, as nothing else would.
+	emptyFilePieces := info.EmptyFilePieces()
 	for i, fileInfo := range upvertedFiles {
-		s, err := ToSafeFilePath(append([]string{info.Name}, fileInfo.Path...)...)
+		s, err := infoFileSafePath(info, &fileInfo)
 		if err != nil {
 			return nil, fmt.Errorf("file %v has unsafe path %q: %w", i, fileInfo.Path, err)
 		}
@@ -79,7 +78,7 @@ func (fs *fileClientImpl) OpenTorrent(info *metainfo.Info, infoHash metainfo.Has
 			path:   filepath.Join(dir, s),
 			length: fileInfo.Length,
 		}
-		if f.length == 0 {
+		if _, ok := emptyFilePieces[i]; f.length == 0 && !ok {
 			err = CreateNativeZeroLengthFile(f.path)
 			if err != nil {
 				return nil, fmt.Errorf("creating zero length file: %w", err)
@@ -89,7 +88,7 @@ func (fs *fileClientImpl) OpenTorrent(info *metainfo.Info, infoHash metainfo.Has
 	}
 	return &fileTorrentImpl{
 		files,
-		segments.NewIndex(common.LengthIterFromUpvertedFiles(upvertedFiles)),
+		allPieceExtents(info),
 		infoHash,
 		fs.pc,
 	}, nil
@@ -102,21 +101,20 @@ type file struct {
 }
 
 type fileTorrentImpl struct {
-	files          []file
-	segmentLocater segments.Index
-	infoHash       metainfo.Hash
-	completion     PieceCompletion
+	files        []file
+	pieceExtents pieceExtents
+	infoHash     metainfo.Hash
+	completion   PieceCompletion
 }
 
 func (fts *fileTorrentImpl) Piece(p metainfo.Piece) PieceImpl {
-	// Create a view onto the file-based torrent storage.
-	_io := fileTorrentImplIO{fts}
-	// Return the appropriate segments of this.
+	// Create a view onto the parts of the files the piece is in.
+	_io := fileTorrentImplIO{fts, fts.pieceExtents.piece(p)}
 	return &filePieceImpl{
 		fts,
 		p,
-		missinggo.NewSectionWriter(_io, p.Offset(), p.Length()),
-		io.NewSectionReader(_io, p.Offset(), p.Length()),
+		_io,
+		_io,
 	}
 }
 
@@ -137,9 +135,10 @@ func CreateNativeZeroLengthFile(name string) error {
 	return f.Close()
 }
 
-// Exposes file-based storage of a torrent, as one big ReadWriterAt.
+// Exposes the parts of the files a piece is in as a ReadWriterAt, with offsets within the piece.
 type fileTorrentImplIO struct {
-	fts *fileTorrentImpl
+	fts     *fileTorrentImpl
+	extents []metainfo.FileExtent
 }
 
 // Returns EOF on short or missing file.
@@ -171,44 +170,35 @@ func (fst *fileTorrentImplIO) readFileAt(file file, b []byte, off int64) (n int,
 	return
 }
 
-// Only returns EOF at the end of the torrent. Premature EOF is ErrUnexpectedEOF.
+// Returns EOF at the end of the piece, or at the end of a short or missing file.
 func (fst fileTorrentImplIO) ReadAt(b []byte, off int64) (n int, err error) {
-	fst.fts.segmentLocater.Locate(segments.Extent{off, int64(len(b))}, func(i int, e segments.Extent) bool {
-		n1, err1 := fst.readFileAt(fst.fts.files[i], b[:e.Length], e.Start)
-		n += n1
-		b = b[n1:]
-		err = err1
-		return err == nil // && int64(n1) == e.Length
+	n, err = forEachExtentPart(fst.extents, b, off, func(i int, b []byte, off int64) (int, error) {
+		return fst.readFileAt(fst.fts.files[i], b, off)
 	})
-	if len(b) != 0 && err == nil {
+	if n != len(b) && err == nil {
 		err = io.EOF
 	}
 	return
 }
 
 func (fst fileTorrentImplIO) WriteAt(p []byte, off int64) (n int, err error) {
-	//log.Printf("write at %v: %v bytes", off, len(p))
-	fst.fts.segmentLocater.Locate(segments.Extent{off, int64(len(p))}, func(i int, e segments.Extent) bool {
+	n, err = forEachExtentPart(fst.extents, p, off, func(i int, p []byte, off int64) (n int, err error) {
 		name := fst.fts.files[i].path
 		os.MkdirAll(filepath.Dir(name), 0777)
 		var f *os.File
 		f, err = os.OpenFile(name, os.O_WRONLY|os.O_CREATE, 0666)
 		if err != nil {
-			return false
+			return
 		}
-		var n1 int
-		n1, err = f.WriteAt(p[:e.Length], e.Start)
-		//log.Printf("%v %v wrote %v: %v", i, e, n1, err)
+		n, err = f.WriteAt(p, off)
 		closeErr := f.Close()
-		n += n1
-		p = p[n1:]
 		if err == nil {
 			err = closeErr
 		}
-		if err == nil && int64(n1) != e.Length {
-			err = io.ErrShortWrite
-		}
-		return err == nil
+		return
 	})
+	if n != len(p) && err == nil {
+		err = io.ErrShortWrite
+	}
 	return
 }
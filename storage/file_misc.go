@@ -7,28 +7,45 @@ type requiredLength struct {
 	length    int64
 }
 
+// Returns the lengths the files a piece is in must have for the piece to be complete. The
+// zero-length files that go with the piece must exist, so they have a length of zero.
+func pieceCompleteRequiredLengths(info *metainfo.Info, pieceIndex int) (ret []requiredLength) {
+	if pieceIndex < 0 || pieceIndex >= info.NumPieces() {
+		return
+	}
+	if info.HasV1() {
+		p := info.Piece(pieceIndex)
+		ret = extentCompleteRequiredLengths(info, p.Offset(), p.Length())
+	} else {
+		// Pieces of v2-only infos are each within one file.
+		for _, e := range info.PieceExtents(pieceIndex) {
+			ret = append(ret, requiredLength{
+				fileIndex: e.FileIndex,
+				length:    e.Offset + e.Length,
+			})
+		}
+	}
+	for _, i := range info.PieceEmptyFiles(pieceIndex) {
+		ret = append(ret, requiredLength{fileIndex: i})
+	}
+	return
+}
+
+// Returns the lengths the files must have for n bytes from off in the files taken together to be
+// complete. It's an error for the bytes to go past the end of the files.
 func extentCompleteRequiredLengths(info *metainfo.Info, off, n int64) (ret []requiredLength) {
 	if n == 0 {
 		return
 	}
-	for i, fi := range info.UpvertedFiles() {
-		if off >= fi.Length {
-			off -= fi.Length
-			continue
-		}
-		n1 := n
-		if off+n1 > fi.Length {
-			n1 = fi.Length - off
-		}
+	for _, e := range info.FileExtents(off, n) {
 		ret = append(ret, requiredLength{
-			fileIndex: i,
-			length:    off + n1,
+			fileIndex: e.FileIndex,
+			length:    e.Offset + e.Length,
 		})
-		n -= n1
-		if n == 0 {
-			return
-		}
-		off = 0
+		n -= e.Length
+	}
+	if n != 0 {
+		panic("extent exceeds torrent bounds")
 	}
-	panic("extent exceeds torrent bounds")
+	return
 }
@@ -35,3 +35,28 @@ func TestExtentCompleteRequiredLengths(t *testing.T) {
 	assert.Len(t, extentCompleteRequiredLengths(info, 5, 0), 0)
 	assert.Panics(t, func() { extentCompleteRequiredLengths(info, 6, 1) })
 }
+
+func TestPieceCompleteRequiredLengths(t *testing.T) {
+	info := &metainfo.Info{
+		PieceLength: 2,
+		Pieces:      make([]byte, 3*metainfo.HashSize),
+		Files: []metainfo.FileInfo{
+			{Path: []string{"a"}, Length: 1},
+			{Path: []string{"b"}, Length: 0},
+			{Path: []string{"c"}, Length: 4},
+		},
+	}
+	assert.EqualValues(t, []requiredLength{
+		{fileIndex: 0, length: 1},
+		{fileIndex: 2, length: 1},
+		// The zero-length file must exist.
+		{fileIndex: 1, length: 0},
+	}, pieceCompleteRequiredLengths(info, 0))
+	assert.EqualValues(t, []requiredLength{
+		{fileIndex: 2, length: 3},
+	}, pieceCompleteRequiredLengths(info, 1))
+	assert.EqualValues(t, []requiredLength{
+		{fileIndex: 2, length: 4},
+	}, pieceCompleteRequiredLengths(info, 2))
+	assert.Empty(t, pieceCompleteRequiredLengths(info, 3))
+}
@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"fmt"
 	"io"
 	"log"
 	"os"
@@ -30,7 +31,7 @@ func (fs *filePieceImpl) Completion() Completion {
 	}
 	if c.Complete {
 		// If it's allegedly complete, check that its constituent files have the necessary length.
-		for _, fi := range extentCompleteRequiredLengths(fs.p.Info, fs.p.Offset(), fs.p.Length()) {
+		for _, fi := range pieceCompleteRequiredLengths(fs.p.Info, fs.p.Index()) {
 			s, err := os.Stat(fs.files[fi.fileIndex].path)
 			if err != nil || s.Size() < fi.length {
 				c.Complete = false
@@ -46,6 +47,11 @@ func (fs *filePieceImpl) Completion() Completion {
 }
 
 func (fs *filePieceImpl) MarkComplete() error {
+	for _, i := range fs.p.Info.PieceEmptyFiles(fs.p.Index()) {
+		if err := CreateNativeZeroLengthFile(fs.files[i].path); err != nil {
+			return fmt.Errorf("creating zero length file: %w", err)
+		}
+	}
 	return fs.completion.Set(fs.pieceKey(), true)
 }
 
@@ -42,3 +42,108 @@ func TestShortFile(t *testing.T) {
 		t.Errorf("expected nil or EOF error from truncated piece, got %v", err)
 	}
 }
+
+func TestZeroLengthFilesCreatedOnCompletion(t *testing.T) {
+	td := t.TempDir()
+	s := NewFileWithCompletion(td, NewMapPieceCompletion())
+	defer s.Close()
+	info := &metainfo.Info{
+		Name:        "t",
+		PieceLength: 4,
+		Pieces:      make([]byte, 2*metainfo.HashSize),
+		Files: []metainfo.FileInfo{
+			{Path: []string{"first"}},
+			{Path: []string{"a"}, Length: 4},
+			{Path: []string{"x"}},
+			{Path: []string{"y"}},
+			{Path: []string{"z"}},
+			{Path: []string{"b"}, Length: 3},
+			{Path: []string{"last"}},
+		},
+	}
+	ts, err := s.OpenTorrent(info, metainfo.Hash{})
+	require.NoError(t, err)
+	exists := func(name string) bool {
+		_, err := os.Stat(filepath.Join(td, "t", name))
+		return err == nil
+	}
+	for _, name := range []string{"first", "x", "y", "z", "last"} {
+		assert.False(t, exists(name), name)
+	}
+	p := ts.Piece(info.Piece(0))
+	_, err = p.WriteAt([]byte("aaaa"), 0)
+	require.NoError(t, err)
+	require.NoError(t, p.MarkComplete())
+	assert.True(t, p.Completion().Complete)
+	assert.True(t, exists("first"))
+	assert.False(t, exists("x"))
+
+	p = ts.Piece(info.Piece(1))
+	_, err = p.WriteAt([]byte("bbb"), 0)
+	require.NoError(t, err)
+	require.NoError(t, p.MarkComplete())
+	for _, name := range []string{"x", "y", "z", "last"} {
+		assert.True(t, exists(name), name)
+	}
+	// A missing zero-length file makes its piece incomplete.
+	require.NoError(t, os.Remove(filepath.Join(td, "t", "y")))
+	assert.False(t, p.Completion().Complete)
+}
+
+func TestZeroLengthFilesWithoutPiecesCreatedOnOpen(t *testing.T) {
+	td := t.TempDir()
+	s := NewFileWithCompletion(td, NewMapPieceCompletion())
+	defer s.Close()
+	info := &metainfo.Info{
+		Name:        "t",
+		PieceLength: 4,
+		Files:       []metainfo.FileInfo{{Path: []string{"a"}}, {Path: []string{"b"}}},
+	}
+	_, err := s.OpenTorrent(info, metainfo.Hash{})
+	require.NoError(t, err)
+	for _, name := range []string{"a", "b"} {
+		_, err := os.Stat(filepath.Join(td, "t", name))
+		assert.NoError(t, err)
+	}
+}
+
+// Pieces are read and written in each of the files they span.
+func TestPiecesSpanningFiles(t *testing.T) {
+	info := &metainfo.Info{
+		Name:        "t",
+		PieceLength: 4,
+		Pieces:      make([]byte, 2*metainfo.HashSize),
+		Files: []metainfo.FileInfo{
+			{Path: []string{"a"}, Length: 3},
+			{Path: []string{"b"}},
+			{Path: []string{"c"}, Length: 5},
+		},
+	}
+	for _, newStorage := range []func(string) ClientImplCloser{NewFile, NewMMap} {
+		td := t.TempDir()
+		s := newStorage(td)
+		ts, err := s.OpenTorrent(info, metainfo.Hash{})
+		require.NoError(t, err)
+		for i, data := range []string{"abcd", "efgh"} {
+			p := ts.Piece(info.Piece(i))
+			n, err := p.WriteAt([]byte(data), 0)
+			require.NoError(t, err)
+			assert.Equal(t, 4, n)
+			b := make([]byte, 3)
+			n, err = p.ReadAt(b, 1)
+			require.NoError(t, err)
+			assert.Equal(t, data[1:], string(b[:n]))
+			// Reading past the end of the piece gives what's left, and EOF.
+			n, err = p.ReadAt(b, 2)
+			assert.Equal(t, io.EOF, err)
+			assert.Equal(t, data[2:], string(b[:n]))
+		}
+		require.NoError(t, ts.Close())
+		require.NoError(t, s.Close())
+		for name, expected := range map[string]string{"a": "abc", "c": "defgh"} {
+			b, err := ioutil.ReadFile(filepath.Join(td, "t", name))
+			require.NoError(t, err)
+			assert.Equal(t, expected, string(b), name)
+		}
+	}
+}
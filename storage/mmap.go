@@ -7,7 +7,6 @@ import (
 	"os"
 	"path/filepath"
 
-	"github.com/anacrolix/missinggo"
 	"github.com/edsrzf/mmap-go"
 
 	"github.com/anacrolix/torrent/metainfo"
@@ -33,9 +32,10 @@ func NewMMapWithCompletion(baseDir string, completion PieceCompletion) *mmapClie
 func (s *mmapClientImpl) OpenTorrent(info *metainfo.Info, infoHash metainfo.Hash) (t TorrentImpl, err error) {
 	span, err := mMapTorrent(info, s.baseDir)
 	t = &mmapTorrentStorage{
-		infoHash: infoHash,
-		span:     span,
-		pc:       s.pc,
+		infoHash:     infoHash,
+		span:         span,
+		pieceExtents: allPieceExtents(info),
+		pc:           s.pc,
 	}
 	return
 }
@@ -46,20 +46,45 @@ func (s *mmapClientImpl) Close() error {
 
 type mmapTorrentStorage struct {
 	infoHash metainfo.Hash
-	span     *mmap_span.MMapSpan
-	pc       PieceCompletionGetSetter
+	// Has an mmap for each file, in the order of metainfo.Info.UpvertedFiles.
+	span         *mmap_span.MMapSpan
+	pieceExtents pieceExtents
+	pc           PieceCompletionGetSetter
 }
 
 func (ts *mmapTorrentStorage) Piece(p metainfo.Piece) PieceImpl {
+	_io := mmapPieceIO{ts.span, ts.pieceExtents.piece(p)}
 	return mmapStoragePiece{
 		pc:       ts.pc,
 		p:        p,
 		ih:       ts.infoHash,
-		ReaderAt: io.NewSectionReader(ts.span, p.Offset(), p.Length()),
-		WriterAt: missinggo.NewSectionWriter(ts.span, p.Offset(), p.Length()),
+		ReaderAt: _io,
+		WriterAt: _io,
 	}
 }
 
+// Exposes the parts of the mmaps a piece is in as a ReadWriterAt, with offsets within the piece.
+type mmapPieceIO struct {
+	span    *mmap_span.MMapSpan
+	extents []metainfo.FileExtent
+}
+
+func (me mmapPieceIO) ReadAt(b []byte, off int64) (n int, err error) {
+	n, err = forEachExtentPart(me.extents, b, off, me.span.ReadMapAt)
+	if n != len(b) && err == nil {
+		err = io.EOF
+	}
+	return
+}
+
+func (me mmapPieceIO) WriteAt(b []byte, off int64) (n int, err error) {
+	n, err = forEachExtentPart(me.extents, b, off, me.span.WriteMapAt)
+	if n != len(b) && err == nil {
+		err = io.ErrShortWrite
+	}
+	return
+}
+
 func (ts *mmapTorrentStorage) Close() error {
 	errs := ts.span.Close()
 	if len(errs) > 0 {
@@ -107,7 +132,7 @@ func mMapTorrent(md *metainfo.Info, location string) (mms *mmap_span.MMapSpan, e
 	}()
 	for _, miFile := range md.UpvertedFiles() {
 		var safeName string
-		safeName, err = ToSafeFilePath(append([]string{md.Name}, miFile.Path...)...)
+		safeName, err = infoFileSafePath(md, &miFile)
 		if err != nil {
 			return
 		}
@@ -118,9 +143,8 @@ func mMapTorrent(md *metainfo.Info, location string) (mms *mmap_span.MMapSpan, e
 			err = fmt.Errorf("file %q: %s", miFile.DisplayPath(md), err)
 			return
 		}
-		if mm != nil {
-			mms.Append(mm)
-		}
+		// Zero-length files have no mmap, but keep their place.
+		mms.Append(mm)
 	}
 	mms.InitIndex()
 	return
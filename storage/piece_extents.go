@@ -0,0 +1,55 @@
+package storage
+
+import "github.com/anacrolix/torrent/metainfo"
+
+// The extents of every piece of a torrent, as for metainfo.Info.PieceExtents.
+type pieceExtents [][]metainfo.FileExtent
+
+// Walks the files once, rather than for every piece.
+func allPieceExtents(info *metainfo.Info) pieceExtents {
+	ret := make(pieceExtents, info.NumPieces())
+	info.ForEachPieceExtent(func(pieceIndex int, e metainfo.FileExtent) bool {
+		ret[pieceIndex] = append(ret[pieceIndex], e)
+		return true
+	})
+	return ret
+}
+
+// Pieces the info doesn't have hashes for are mapped as they would be if it did.
+func (me pieceExtents) piece(p metainfo.Piece) []metainfo.FileExtent {
+	if i := p.Index(); i >= 0 && i < len(me) {
+		return me[i]
+	}
+	return p.Info.FileExtents(p.Offset(), p.Length())
+}
+
+// Calls fn with the part of b that goes in each extent, starting off bytes into the extents taken
+// together, and the offset of that part within its file. It stops when b runs out, or fn returns an
+// error or doesn't handle all of its part.
+func forEachExtentPart(
+	extents []metainfo.FileExtent, b []byte, off int64,
+	fn func(fileIndex int, b []byte, off int64) (int, error),
+) (n int, err error) {
+	for _, e := range extents {
+		if len(b) == 0 {
+			break
+		}
+		if off >= e.Length {
+			off -= e.Length
+			continue
+		}
+		part := b
+		if int64(len(part)) > e.Length-off {
+			part = part[:e.Length-off]
+		}
+		var n1 int
+		n1, err = fn(e.FileIndex, part, e.Offset+off)
+		n += n1
+		b = b[n1:]
+		if err != nil || n1 != len(part) {
+			return
+		}
+		off = 0
+	}
+	return
+}
@@ -1,29 +1,21 @@
 package storage
 
 import (
-	"errors"
-	"path/filepath"
-	"strings"
+	"github.com/anacrolix/torrent/metainfo"
 )
 
-// Get the first file path component. We can't use filepath.Split because that breaks off the last
-// one. We could optimize this to avoid allocating a slice down the track.
-func firstComponent(filePath string) string {
-	return strings.SplitN(filePath, string(filepath.Separator), 2)[0]
+// Combines file info path components, ensuring the result won't escape the storage directory. See
+// metainfo.LocalPath.
+func ToSafeFilePath(fileInfoComponents ...string) (string, error) {
+	return metainfo.LocalPath(fileInfoComponents...)
 }
 
-// Combines file info path components, ensuring the result won't escape into parent directories.
-func ToSafeFilePath(fileInfoComponents ...string) (string, error) {
-	safeComps := make([]string, 0, len(fileInfoComponents))
-	for _, comp := range fileInfoComponents {
-		safeComps = append(safeComps, filepath.Clean(comp))
-	}
-	safeFilePath := filepath.Join(safeComps...)
-	fc := firstComponent(safeFilePath)
-	switch fc {
-	case "..":
-		return "", errors.New("escapes root dir")
-	default:
-		return safeFilePath, nil
+// Returns the path of the file under the torrent's storage directory. Files of infos without a name
+// go directly in the directory.
+func infoFileSafePath(info *metainfo.Info, fi *metainfo.FileInfo) (string, error) {
+	comps := fi.Path
+	if info.Name != "" {
+		comps = append([]string{info.Name}, fi.Path...)
 	}
+	return ToSafeFilePath(comps...)
 }
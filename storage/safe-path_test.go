@@ -2,8 +2,15 @@ package storage
 
 import (
 	"log"
+	"os"
 	"path/filepath"
+	"runtime"
 	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/anacrolix/torrent/metainfo"
 )
 
 func init() {
@@ -22,6 +29,14 @@ func TestSafePath(t *testing.T) {
 			filepath.FromSlash(`NewSuperHeroMovie-2019-English-720p.avi /../../../../../Roaming/Microsoft/Windows/Start Menu/Programs/Startup/test3.exe`)},
 			expectErr: true,
 		},
+		{input: []string{"a", `..\..\windows\system32`}, expectErr: true},
+		{input: []string{"a", "b/../.."}, expectErr: true},
+		{input: []string{"/etc", "passwd"}, expectErr: true},
+		{input: []string{"a", `\\server\share`}, expectErr: true},
+		{input: []string{"a", "", "b"}, expected: filepath.Join("a", "b")},
+		{input: []string{"a", ".", "b"}, expected: filepath.Join("a", "b")},
+		{input: []string{"a", "b"}, expected: filepath.Join("a", "b")},
+		{input: []string{"a", "b\x00c"}, expected: filepath.Join("a", "b%00c")},
 	} {
 		actual, err := ToSafeFilePath(_case.input...)
 		if _case.expectErr {
@@ -29,6 +44,68 @@ func TestSafePath(t *testing.T) {
 				continue
 			}
 			t.Errorf("%q: expected error, got output %q", _case.input, actual)
+		} else if err != nil || actual != _case.expected {
+			t.Errorf("%q: expected %q, got %q, %v", _case.input, _case.expected, actual, err)
 		}
 	}
 }
+
+// Names that aren't safe on every OS, or aren't UTF-8, are stored as they are where the OS allows
+// them, like they always have been.
+var locallySafeNames = []string{
+	"\xc4\xe3\xba\xc3.txt", // GBK
+	"What?.mp3",
+	"Movie: Part 1",
+	"trailing.",
+}
+
+func TestSafePathLocallySafeNames(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("names are escaped on Windows")
+	}
+	for _, name := range locallySafeNames {
+		actual, err := ToSafeFilePath("dir", name)
+		assert.NoError(t, err, name)
+		assert.Equal(t, filepath.Join("dir", name), actual)
+	}
+}
+
+func TestSafePathEscapedOnWindows(t *testing.T) {
+	if runtime.GOOS != "windows" {
+		t.Skip("names are only escaped on Windows")
+	}
+	for i, expected := range []string{"%C4%E3%BA%C3.txt", "What%3F.mp3", "Movie%3A Part 1", "trailing%2E"} {
+		actual, err := ToSafeFilePath("dir", locallySafeNames[i])
+		assert.NoError(t, err, expected)
+		assert.Equal(t, filepath.Join("dir", expected), actual)
+	}
+}
+
+func TestOpenTorrentLocallySafeNames(t *testing.T) {
+	td := t.TempDir()
+	info := &metainfo.Info{
+		Name:        "t",
+		PieceLength: 1,
+	}
+	for _, name := range locallySafeNames {
+		info.Files = append(info.Files, metainfo.FileInfo{Path: []string{name}, Length: 1})
+	}
+	info.Pieces = make([]byte, len(info.Files)*metainfo.HashSize)
+	for _, newStorage := range []func(string) ClientImplCloser{NewFile, NewMMap} {
+		s := newStorage(td)
+		ts, err := s.OpenTorrent(info, metainfo.Hash{})
+		require.NoError(t, err)
+		for i := range info.Files {
+			_, err := ts.Piece(info.Piece(i)).WriteAt([]byte{'x'}, 0)
+			require.NoError(t, err)
+		}
+		require.NoError(t, ts.Close())
+		require.NoError(t, s.Close())
+	}
+	for _, fi := range info.Files {
+		path, err := ToSafeFilePath("t", fi.Path[0])
+		require.NoError(t, err)
+		_, err = os.Stat(filepath.Join(td, path))
+		assert.NoError(t, err, fi.Path[0])
+	}
+}
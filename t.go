@@ -1,12 +1,16 @@
 package torrent
 
 import (
+	"context"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/anacrolix/missinggo/pubsub"
 
 	"github.com/anacrolix/torrent/metainfo"
+	"github.com/anacrolix/torrent/tracker"
 )
 
 // The Torrent's infohash. This is fixed and cannot change. It uniquely identifies a torrent.
@@ -14,6 +18,20 @@ func (t *Torrent) InfoHash() metainfo.Hash {
 	return t.infoHash
 }
 
+// The key sent with the torrent's tracker announces. It's fixed while the torrent is in the client,
+// and can be saved to give back with TorrentSpec.AnnounceKey.
+func (t *Torrent) AnnounceKey() int32 {
+	t.cl.rLock()
+	defer t.cl.rUnlock()
+	return t.announceKey
+}
+
+// The peer ID sent to the torrent's trackers and peers. It's the client's, so it's fixed for the
+// torrent's lifetime.
+func (t *Torrent) PeerID() PeerID {
+	return t.cl.peerID
+}
+
 // Returns a channel that is closed when the info (.Info()) for the torrent has become available.
 func (t *Torrent) GotInfo() <-chan struct{} {
 	// TODO: We shouldn't need to lock to take a channel here, if the event is only ever set.
@@ -113,6 +131,42 @@ func (t *Torrent) Seeding() bool {
 	return t.seeding()
 }
 
+// Whether peers are announced to and found on the DHT for the torrent. This is disabled for the
+// whole client by ClientConfig.NoDHT, for the torrent by TorrentSpec.DisableDHT, and for private
+// torrents once their info is known. BEP 27. See also DhtAnnounce.
+func (t *Torrent) DhtEnabled() bool {
+	t.cl.rLock()
+	defer t.cl.rUnlock()
+	return t.dhtEnabled()
+}
+
+// Whether the torrent is announced to the DHT when peers are looked up there, so that other peers
+// find it. It isn't if the DHT isn't enabled for the torrent, if the DHT is read-only, or if it's
+// disabled with SetDhtAnnounce or TorrentSpec.DisableDhtAnnounce.
+func (t *Torrent) DhtAnnounce() bool {
+	t.cl.rLock()
+	defer t.cl.rUnlock()
+	return t.dhtEnabled() && t.dhtAnnounceAllowed()
+}
+
+// Sets whether the torrent is announced to the DHT, or only looks up peers there. Announces in
+// progress are restarted to match. See DhtAnnounce.
+func (t *Torrent) SetDhtAnnounce(announce bool) {
+	t.cl.lock()
+	defer t.cl.unlock()
+	t.dhtAnnounceDisabled = !announce
+	t.cl.event.Broadcast()
+}
+
+// Whether peers are exchanged with PEX for the torrent. This is disabled for the whole client by
+// ClientConfig.DisablePEX, and for private torrents once their info is known. BEP 27. There's no
+// local service discovery to disable.
+func (t *Torrent) PexEnabled() bool {
+	t.cl.rLock()
+	defer t.cl.rUnlock()
+	return t.pexEnabled()
+}
+
 // Clobbers the torrent display name. The display name is used as the torrent
 // name if the metainfo is not available.
 func (t *Torrent) SetDisplayName(dn string) {
@@ -197,15 +251,9 @@ func (t *Torrent) initFiles() {
 	var offset int64
 	t.files = new([]*File)
 	for _, fi := range t.info.UpvertedFiles() {
-		var path []string
-		if len(fi.PathUTF8) != 0 {
-			path = fi.PathUTF8
-		} else {
-			path = fi.Path
-		}
 		*t.files = append(*t.files, &File{
 			t,
-			strings.Join(append([]string{t.info.Name}, path...), "/"),
+			strings.Join(append([]string{t.info.BestName()}, fi.BestPath()...), "/"),
 			offset,
 			fi.Length,
 			fi,
@@ -250,6 +298,58 @@ func (t *Torrent) AddTrackers(announceList [][]string) {
 	t.addTrackers(announceList)
 }
 
+// Adds DHT nodes, given as "host:port", such as the metainfo's nodes, to help find peers for the
+// torrent. Nothing is added for private torrents, or if the DHT is disabled. See
+// Client.AddDhtNodes.
+func (t *Torrent) AddDhtNodes(nodes []string) {
+	t.cl.rLock()
+	enabled := t.dhtEnabled()
+	t.cl.rUnlock()
+	if enabled {
+		t.cl.AddDhtNodes(nodes)
+	}
+}
+
+// The result of scraping one of a Torrent's trackers.
+type TrackerScrape struct {
+	Url   string
+	Stats tracker.ScrapeStats
+	// tracker.ErrScrapeUnsupported if the tracker doesn't support scrape.
+	Err error
+}
+
+// Scrapes the torrent's HTTP and UDP trackers for their seeder, leecher and completed counts,
+// without waiting to announce. The trackers are scraped concurrently, and the results are ordered
+// by URL.
+func (t *Torrent) Scrape(ctx context.Context) []TrackerScrape {
+	t.cl.rLock()
+	var ret []TrackerScrape
+	for _url, ta := range t.trackerAnnouncers {
+		if _, ok := ta.(*trackerScraper); ok {
+			ret = append(ret, TrackerScrape{Url: _url})
+		}
+	}
+	opts := tracker.ScrapeOpts{
+		HTTPProxy: t.cl.config.HTTPProxy,
+		UserAgent: t.cl.config.HTTPUserAgent,
+	}
+	t.cl.rUnlock()
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Url < ret[j].Url
+	})
+	var wg sync.WaitGroup
+	for i := range ret {
+		wg.Add(1)
+		go func(ts *TrackerScrape) {
+			defer wg.Done()
+			stats, err := tracker.ScrapeWithOpts(ctx, ts.Url, []metainfo.Hash{t.infoHash}, opts)
+			ts.Stats, ts.Err = stats[t.infoHash], err
+		}(&ret[i])
+	}
+	wg.Wait()
+	return ret
+}
+
 func (t *Torrent) Piece(i pieceIndex) *Piece {
 	return t.piece(i)
 }
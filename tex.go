@@ -0,0 +1,91 @@
+package torrent
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+// Whether trackers are exchanged with the torrent's peers, as BEP 28 describes. It waits for the
+// info, as private torrents must only use the trackers in their metainfo.
+func (t *Torrent) texEnabled() bool {
+	return t.cl.config.TrackerExchange && !t.cl.config.DisableTrackers && t.haveInfo() && !t.private()
+}
+
+// Whether a tracker URL from tracker exchange is one we'd use or share. Only HTTP and UDP trackers
+// are, without credentials.
+func validTexTrackerUrl(s string) bool {
+	if len(s) > texMaxUrlLen || strings.TrimSpace(s) != s {
+		return false
+	}
+	u, err := url.Parse(s)
+	if err != nil || u.User != nil || u.Hostname() == "" {
+		return false
+	}
+	switch u.Scheme {
+	case "http", "https", "udp":
+		return true
+	default:
+		return false
+	}
+}
+
+// The URLs of the announce list's trackers that are working, in the order they're tried. Call with
+// the client lock held.
+func (t *Torrent) workingTrackerUrls() (ret []string) {
+	if t.trackerTiers == nil {
+		return
+	}
+	for _, tier := range t.trackerTiers.tiers {
+		for _, e := range tier {
+			if e.working() {
+				ret = append(ret, e.url)
+			}
+		}
+	}
+	return
+}
+
+// Adds trackers learned from a peer, once they're validated. They go in a tier after the
+// metainfo's, so they're only announced to when those fail. Call with the client lock held.
+func (t *Torrent) addTexTrackers(urls []string) {
+	if !t.texEnabled() {
+		return
+	}
+	known := t.metainfo.UpvertedAnnounceList()
+	numBefore := len(t.texTrackers)
+	for _, u := range urls {
+		if len(t.texTrackers) >= texMaxTrackers {
+			break
+		}
+		if !validTexTrackerUrl(u) || announceListContains(known, u) || containsString(t.texTrackers, u) {
+			continue
+		}
+		t.texTrackers = append(t.texTrackers, u)
+	}
+	if n := len(t.texTrackers) - numBefore; n != 0 {
+		torrent.Add("tex trackers added", int64(n))
+		t.startMissingTrackerScrapers()
+	}
+}
+
+// The trackers learned by tracker exchange that aren't in the metainfo's announce list.
+func (t *Torrent) texTrackersTier() (ret []string) {
+	known := t.metainfo.UpvertedAnnounceList()
+	for _, u := range t.texTrackers {
+		if !announceListContains(known, u) {
+			ret = append(ret, u)
+		}
+	}
+	return
+}
+
+func announceListContains(al metainfo.AnnounceList, url string) bool {
+	for _, tier := range al {
+		if containsString(tier, url) {
+			return true
+		}
+	}
+	return false
+}
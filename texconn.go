@@ -0,0 +1,116 @@
+package torrent
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/anacrolix/log"
+
+	pp "github.com/anacrolix/torrent/peer_protocol"
+)
+
+const (
+	// BEP 28 asks that tracker lists aren't sent more than once a minute.
+	texInterval = time.Minute
+	// The most tracker URLs sent in a message, or accepted from one.
+	texMaxMsgTrackers = 50
+	// The most trackers learned by a torrent from its peers.
+	texMaxTrackers = 50
+	// Longer tracker URLs aren't sent or accepted.
+	texMaxUrlLen = 256
+)
+
+// Per-connection BEP 28 tracker exchange state.
+type texConnState struct {
+	enabled bool
+	xid     pp.ExtensionNumber
+	// The tracker URLs sent to the peer.
+	sent    map[string]bool
+	timer   *time.Timer
+	gate    chan struct{}
+	readyfn func()
+	torrent *Torrent
+	dbg     log.Logger
+}
+
+func (s *texConnState) IsEnabled() bool {
+	return s.enabled
+}
+
+// Called from the reader goroutine upon the extended handshake completion.
+func (s *texConnState) Init(c *PeerConn) {
+	xid, ok := c.PeerExtensionIDs[pp.ExtensionNameTex]
+	if !ok || xid == 0 || !c.t.texEnabled() || s.enabled {
+		return
+	}
+	s.xid = xid
+	s.sent = make(map[string]bool)
+	s.torrent = c.t
+	s.dbg = c.logger.WithDefaultLevel(log.Debug)
+	s.readyfn = c.tickleWriter
+	s.gate = make(chan struct{}, 1)
+	s.timer = time.AfterFunc(0, func() {
+		s.gate <- struct{}{}
+		s.readyfn()
+	})
+	s.enabled = true
+}
+
+// Returns the next message for the peer, with the working trackers it hasn't been sent. nil if
+// there aren't any.
+func (s *texConnState) genmsg() *pp.TexMsg {
+	var tx pp.TexMsg
+	for _, u := range s.torrent.workingTrackerUrls() {
+		if len(tx.Added) == texMaxMsgTrackers {
+			break
+		}
+		if !s.sent[u] && validTexTrackerUrl(u) {
+			tx.Added = append(tx.Added, u)
+		}
+	}
+	if len(tx.Added) == 0 {
+		return nil
+	}
+	for _, u := range tx.Added {
+		s.sent[u] = true
+	}
+	return &tx
+}
+
+// Called from the writer goroutine when its buffers are empty. Returns whether there's more room on
+// the send buffer to write to.
+func (s *texConnState) Share(postfn messageWriter) bool {
+	select {
+	case <-s.gate:
+	default:
+		return true
+	}
+	s.timer.Reset(texInterval)
+	if tx := s.genmsg(); tx != nil {
+		s.dbg.Print("sending TEX message: ", tx)
+		return postfn(tx.Message(s.xid))
+	}
+	return true
+}
+
+// Called from the reader goroutine.
+func (s *texConnState) Recv(payload []byte) error {
+	rx, err := pp.LoadTexMsg(payload)
+	if err != nil {
+		return fmt.Errorf("error unmarshalling TEX message: %s", err)
+	}
+	s.dbg.Print("incoming TEX message: ", rx)
+	torrent.Add("tex trackers received", int64(len(rx.Added)))
+	added := rx.Added
+	if len(added) > texMaxMsgTrackers {
+		added = added[:texMaxMsgTrackers]
+	}
+	s.torrent.addTexTrackers(added)
+	return nil
+}
+
+func (s *texConnState) Close() {
+	if s.timer != nil {
+		s.timer.Stop()
+	}
+}
@@ -61,7 +61,15 @@ type Torrent struct {
 
 	closed   missinggo.Event
 	infoHash metainfo.Hash
-	pieces   []Piece
+	// Sent with every tracker announce, so that trackers can tell it's the same peer if our IP
+	// changes. Fixed for the torrent's lifetime in the client.
+	announceKey int32
+	// Uploaded and downloaded bytes carried over from earlier sessions, from TorrentSpec.
+	carriedUploaded   int64
+	carriedDownloaded int64
+	// From TorrentSpec, if it replaces the client's.
+	announceParams *TrackerAnnounceParams
+	pieces         []Piece
 	// Values are the piece indices that changed.
 	pieceStateChanges *pubsub.PubSub
 	// The size of chunks to request from peers over the wire. This is
@@ -107,8 +115,16 @@ type Torrent struct {
 	wantPeersEvent missinggo.Event
 	// An announcer for each tracker URL.
 	trackerAnnouncers map[string]torrentTrackerAnnouncer
+	// Announces to the trackers in trackerAnnouncers that are trackerScrapers.
+	trackerTiers *trackerTiers
 	// How many times we've initiated a DHT announce. TODO: Move into stats.
 	numDHTAnnounces int
+	// When the last DHT announce started, and how many peers DHT announces have added.
+	lastDhtAnnounce time.Time
+	numDhtPeers     int
+	// Set from TorrentSpec.DisableDHT and DisableDhtAnnounce, or with SetDhtAnnounce.
+	dhtDisabled         bool
+	dhtAnnounceDisabled bool
 
 	// Name used if the info name isn't available. Should be cleared when the
 	// Info does become available.
@@ -149,6 +165,8 @@ type Torrent struct {
 	pendingRequests map[Request]int
 
 	pex pexState
+	// Tracker URLs learned from peers with BEP 28 tracker exchange, in the order they were learned.
+	texTrackers []string
 }
 
 func (t *Torrent) numConns() int {
@@ -423,6 +441,9 @@ func (t *Torrent) onSetInfo() {
 			t.queuePieceCheck(pieceIndex(i))
 		}
 	}
+	if t.private() {
+		t.stopPex()
+	}
 	t.cl.event.Broadcast()
 	t.gotMetainfo.Set()
 	t.updateWantPeersEvent()
@@ -493,7 +514,7 @@ func (t *Torrent) name() string {
 	t.nameMu.RLock()
 	defer t.nameMu.RUnlock()
 	if t.haveInfo() {
-		return t.info.Name
+		return t.info.BestName()
 	}
 	return t.displayName
 }
@@ -588,6 +609,7 @@ func (psr PieceStateRun) String() (ret string) {
 
 func (t *Torrent) writeStatus(w io.Writer) {
 	fmt.Fprintf(w, "Infohash: %s\n", t.infoHash.HexString())
+	fmt.Fprintf(w, "Announce key: %x\n", uint32(t.announceKey))
 	fmt.Fprintf(w, "Metadata length: %d\n", t.metadataSize())
 	if !t.haveInfo() {
 		fmt.Fprintf(w, "Metadata have: ")
@@ -675,14 +697,20 @@ func (t *Torrent) newMetaInfo() metainfo.MetaInfo {
 				return nil
 			}
 		}(),
-		UrlList: func() []string {
-			ret := make([]string, 0, len(t.webSeeds))
-			for url := range t.webSeeds {
-				ret = append(ret, url)
-			}
-			return ret
-		}(),
+		UrlList:   t.webSeedURLs(webseed.StyleUrlList),
+		HttpSeeds: t.webSeedURLs(webseed.StyleHttpSeed),
+	}
+}
+
+// Returns the URLs of the torrent's web seeds that use the style.
+func (t *Torrent) webSeedURLs(style webseed.Style) []string {
+	ret := make([]string, 0, len(t.webSeeds))
+	for url, p := range t.webSeeds {
+		if p.peerImpl.(*webseedPeer).client.Style == style {
+			ret = append(ret, url)
+		}
 	}
+	return ret
 }
 
 func (t *Torrent) BytesMissing() int64 {
@@ -704,13 +732,22 @@ func (t *Torrent) bytesLeft() (left int64) {
 	return
 }
 
-// Bytes left to give in tracker announces.
-func (t *Torrent) bytesLeftAnnounce() int64 {
-	if t.haveInfo() {
-		return t.bytesLeft()
-	} else {
+// Bytes left to give in tracker announces. Only pieces that are wanted count, so that ratio
+// trackers don't take unselected files as still to be downloaded.
+func (t *Torrent) bytesLeftAnnounce() (left int64) {
+	if !t.haveInfo() {
 		return -1
 	}
+	bitmap.Flip(t._completedPieces, 0, bitmap.BitIndex(t.numPieces())).IterTyped(func(piece int) bool {
+		p := &t.pieces[piece]
+		// Pieces being checked are still wanted, though they're not pending.
+		if p.requestedPriority() == PiecePriorityNone {
+			return true
+		}
+		left += int64(p.length() - p.numDirtyBytes())
+		return true
+	})
+	return
 }
 
 func (t *Torrent) piecePartiallyDownloaded(piece pieceIndex) bool {
@@ -1254,6 +1291,84 @@ func appendMissingTrackerTiers(existing [][]string, minNumTiers int) (ret [][]st
 	return
 }
 
+// Whether the info is known, and has the BEP 27 private flag. Private torrents only get peers from
+// trackers.
+func (t *Torrent) private() bool {
+	return t.info != nil && t.info.IsPrivate()
+}
+
+func (t *Torrent) pexEnabled() bool {
+	return !t.cl.config.DisablePEX && !t.private()
+}
+
+// Forgets the connections that were listed for PEX before the info was known to be private, and
+// stops exchanging peers with them.
+func (t *Torrent) stopPex() {
+	for c := range t.conns {
+		c.pex.Close()
+		c.pex.Listed = false
+	}
+	t.pex.Reset()
+}
+
+func (t *Torrent) dhtEnabled() bool {
+	return !t.cl.config.NoDHT && t.dhtLookupsAllowed()
+}
+
+// Whether peers are looked up on the DHT servers the torrent's given, which can include those added
+// with Client.AddDhtServer despite ClientConfig.NoDHT.
+func (t *Torrent) dhtLookupsAllowed() bool {
+	return !t.private() && !t.dhtDisabled
+}
+
+// Whether the torrent is announced to the DHT servers it looks up peers on.
+func (t *Torrent) dhtAnnounceAllowed() bool {
+	return t.dhtLookupsAllowed() && !t.dhtAnnounceDisabled && !t.cl.dhtReadOnly
+}
+
+// Once the info is available, downloads the selected files, and sets the others to
+// PiecePriorityNone. Invalid ranges and indices beyond the last file are logged and ignored.
+func (t *Torrent) selectOnly(so metainfo.SelectOnly) {
+	if len(so.Invalid) != 0 {
+		t.logger.WithDefaultLevel(log.Warning).Printf("ignoring invalid select-only ranges %q", so.Invalid)
+	}
+	select {
+	case <-t.GotInfo():
+	case <-t.Closed():
+		return
+	}
+	files := t.Files()
+	for _, r := range so.Ranges {
+		if r.Last >= len(files) {
+			t.logger.WithDefaultLevel(log.Warning).Printf(
+				"select-only range %v is beyond the last file index %v", r, len(files)-1)
+		}
+	}
+	for i, f := range files {
+		if so.Contains(i) {
+			f.Download()
+		} else {
+			f.SetPriority(PiecePriorityNone)
+		}
+	}
+}
+
+// Merges the fields of mi outside the info into the torrent's, as by metainfo.Merge. mi must be for
+// this torrent.
+func (t *Torrent) mergeMetaInfo(mi *metainfo.MetaInfo) {
+	t.cl.lock()
+	defer t.cl.unlock()
+	existing := t.metainfo
+	existing.InfoBytes = mi.InfoBytes
+	merged, err := metainfo.Merge(&existing, mi)
+	if err != nil {
+		panic(err)
+	}
+	// The info bytes are kept separately once the info is set.
+	merged.InfoBytes = nil
+	t.metainfo = *merged
+}
+
 func (t *Torrent) addTrackers(announceList [][]string) {
 	fullAnnounceList := &t.metainfo.AnnounceList
 	t.metainfo.AnnounceList = appendMissingTrackerTiers(*fullAnnounceList, len(announceList))
@@ -1290,7 +1405,7 @@ func (t *Torrent) deleteConnection(c *PeerConn) (ret bool) {
 	// Avoid adding a drop event more than once. Probably we should track whether we've generated
 	// the drop event against the PexConnState instead.
 	if ret {
-		if !t.cl.config.DisablePEX {
+		if t.pexEnabled() {
 			t.pex.Drop(c)
 		}
 	}
@@ -1412,9 +1527,11 @@ func (t *Torrent) startWebsocketAnnouncer(u url.URL) torrentTrackerAnnouncer {
 	wtc, release := t.cl.websocketTrackers.Get(u.String())
 	go func() {
 		<-t.closed.LockedChan(t.cl.locker())
+		// Other torrents may still be using the socket.
+		wtc.Announce(tracker.Stopped, t.infoHash)
 		release()
 	}()
-	wst := websocketTrackerStatus{u, wtc}
+	wst := websocketTrackerStatus{u, wtc, t.infoHash}
 	go func() {
 		err := wtc.Announce(tracker.Started, t.infoHash)
 		if err != nil {
@@ -1442,11 +1559,24 @@ func (t *Torrent) startScrapingTracker(_url string) {
 		return
 	}
 	if u.Scheme == "udp" {
-		u.Scheme = "udp4"
-		t.startScrapingTracker(u.String())
-		u.Scheme = "udp6"
-		t.startScrapingTracker(u.String())
-		return
+		// Each family gets its own scraper, so that they're announced to, and back off,
+		// independently. Where a family is only preferred, the one scraper chooses.
+		switch t.cl.trackerIpFamilies(u) {
+		case TrackerIpFamiliesAll:
+			u.Scheme = "udp4"
+			t.startScrapingTracker(u.String())
+			u.Scheme = "udp6"
+			t.startScrapingTracker(u.String())
+			return
+		case TrackerIpFamiliesOnly4:
+			u.Scheme = "udp4"
+			t.startScrapingTracker(u.String())
+			return
+		case TrackerIpFamiliesOnly6:
+			u.Scheme = "udp6"
+			t.startScrapingTracker(u.String())
+			return
+		}
 	}
 	if _, ok := t.trackerAnnouncers[_url]; ok {
 		return
@@ -1467,12 +1597,11 @@ func (t *Torrent) startScrapingTracker(_url string) {
 				return nil
 			}
 		}
-		newAnnouncer := &trackerScraper{
-			u: *u,
-			t: t,
+		return &trackerScraper{
+			u:       *u,
+			t:       t,
+			backoff: announceBackoff{maxFailures: t.cl.config.TrackerMaxConsecutiveFailures},
 		}
-		go newAnnouncer.Run()
-		return newAnnouncer
 	}()
 	if sl == nil {
 		return
@@ -1489,12 +1618,15 @@ func (t *Torrent) startMissingTrackerScrapers() {
 	if t.cl.config.DisableTrackers {
 		return
 	}
-	t.startScrapingTracker(t.metainfo.Announce)
-	for _, tier := range t.metainfo.AnnounceList {
+	for _, tier := range t.metainfo.UpvertedAnnounceList() {
 		for _, url := range tier {
 			t.startScrapingTracker(url)
 		}
 	}
+	for _, url := range t.texTrackersTier() {
+		t.startScrapingTracker(url)
+	}
+	t.updateTrackerTiers()
 }
 
 // Returns an AnnounceRequest with fields filled out to defaults and current
@@ -1505,23 +1637,24 @@ func (t *Torrent) announceRequest(event tracker.AnnounceEvent) tracker.AnnounceR
 	return tracker.AnnounceRequest{
 		Event: event,
 		NumWant: func() int32 {
-			if t.wantPeers() && len(t.cl.dialers) > 0 {
-				return -1
-			} else {
+			if event == tracker.Stopped || !t.wantPeers() || len(t.cl.dialers) == 0 {
 				return 0
 			}
+			if n := t.trackerAnnounceParams().NumWant; n != 0 {
+				return n
+			}
+			return -1
 		}(),
 		Port:     uint16(t.cl.incomingPeerPort()),
 		PeerId:   t.cl.peerID,
 		InfoHash: t.infoHash,
-		Key:      t.cl.announceKey(),
+		Key:      t.announceKey,
 
 		// The following are vaguely described in BEP 3.
 
-		Left:     t.bytesLeftAnnounce(),
-		Uploaded: t.stats.BytesWrittenData.Int64(),
-		// There's no mention of wasted or unwanted download in the BEP.
-		Downloaded: t.stats.BytesReadUsefulData.Int64(),
+		Left:       t.bytesLeftAnnounce(),
+		Uploaded:   t.uploaded(),
+		Downloaded: t.downloaded(),
 	}
 }
 
@@ -1536,39 +1669,65 @@ func (t *Torrent) consumeDhtAnnouncePeers(pvs <-chan dht.PeersValues) {
 				// Can't do anything with this.
 				continue
 			}
-			t.addPeer(PeerInfo{
+			if t.addPeer(PeerInfo{
 				Addr:   ipPortAddr{cp.IP, cp.Port},
 				Source: PeerSourceDhtGetPeers,
-			})
+			}) {
+				t.numDhtPeers++
+			}
 		}
 		cl.unlock()
 	}
 }
 
-func (t *Torrent) announceToDht(impliedPort bool, s DhtServer) error {
-	ps, err := s.Announce(t.infoHash, t.cl.incomingPeerPort(), impliedPort)
+func (t *Torrent) announceToDht(port int, impliedPort bool, s DhtServer) error {
+	ps, err := s.Announce(t.infoHash, port, impliedPort)
 	if err != nil {
 		return err
 	}
 	go t.consumeDhtAnnouncePeers(ps.Peers())
-	select {
-	case <-t.closed.LockedChan(t.cl.locker()):
-	case <-time.After(5 * time.Minute):
-	}
+	t.cl.lock()
+	t.lastDhtAnnounce = time.Now()
+	t.waitDhtAnnounceEnd(s, port != 0 || impliedPort)
+	t.cl.unlock()
 	ps.Close()
 	return nil
 }
 
+// Waits until a DHT announce should end: after a while, or once the torrent or server is done with,
+// or sooner if it's no longer to be made, as when the info turns out to be private. Lookups that
+// don't announce us also end once we can be announced, so that the next one is. Call with the
+// client lock held.
+func (t *Torrent) waitDhtAnnounceEnd(s DhtServer, announcing bool) {
+	cl := t.cl
+	expired := false
+	timer := time.AfterFunc(5*time.Minute, func() {
+		cl.lock()
+		expired = true
+		cl.event.Broadcast()
+		cl.unlock()
+	})
+	defer timer.Stop()
+	for !expired && !t.closed.IsSet() && cl.dhtServerCurrent(s) && t.dhtLookupsAllowed() &&
+		t.dhtAnnounceAllowed() == announcing {
+		cl.event.Wait()
+	}
+}
+
+// How long to wait before announcing to the DHT again after an announce fails, if no nodes are added
+// in the meantime.
+const dhtAnnounceRetryDelay = time.Minute
+
 func (t *Torrent) dhtAnnouncer(s DhtServer) {
 	cl := t.cl
 	cl.lock()
 	defer cl.unlock()
 	for {
 		for {
-			if t.closed.IsSet() {
+			if t.closed.IsSet() || !cl.dhtServerCurrent(s) {
 				return
 			}
-			if !t.wantPeers() {
+			if !t.wantPeers() || !t.dhtLookupsAllowed() {
 				goto wait
 			}
 			// TODO: Determine if there's a listener on the port we're announcing.
@@ -1579,15 +1738,41 @@ func (t *Torrent) dhtAnnouncer(s DhtServer) {
 		wait:
 			cl.event.Wait()
 		}
-		func() {
+		nodesAdded := cl.dhtNodesAdded
+		// Without a port, peers are only looked up.
+		port, impliedPort := 0, false
+		if t.dhtAnnounceAllowed() {
+			port, impliedPort = cl.incomingPeerPort(), cl.dhtImpliedPort(s)
+		}
+		err := func() error {
 			t.numDHTAnnounces++
 			cl.unlock()
 			defer cl.lock()
-			err := t.announceToDht(true, s)
-			if err != nil {
-				t.logger.WithDefaultLevel(log.Warning).Printf("error announcing %q to DHT: %s", t, err)
-			}
+			return t.announceToDht(port, impliedPort, s)
 		}()
+		if err != nil {
+			t.logger.WithDefaultLevel(log.Warning).Printf("error announcing %q to DHT: %s", t, err)
+			// Such as when there are no nodes to start from. Rather than trying again straight
+			// away, wait for nodes to be added, or a while.
+			t.waitDhtAnnounceRetry(nodesAdded)
+		}
+	}
+}
+
+// Waits until nodes have been added since nodesAdded, the retry delay passes, or the torrent
+// closes. Call with the client lock held.
+func (t *Torrent) waitDhtAnnounceRetry(nodesAdded int) {
+	cl := t.cl
+	retry := false
+	timer := time.AfterFunc(dhtAnnounceRetryDelay, func() {
+		cl.lock()
+		retry = true
+		cl.event.Broadcast()
+		cl.unlock()
+	})
+	defer timer.Stop()
+	for !retry && cl.dhtNodesAdded == nodesAdded && !t.closed.IsSet() {
+		cl.event.Wait()
 	}
 }
 
@@ -1620,9 +1805,24 @@ func (t *Torrent) statsLocked() (ret TorrentStats) {
 		}
 	}
 	ret.ConnStats = t.stats.Copy()
+	ret.Uploaded = t.uploaded()
+	ret.Downloaded = t.downloaded()
+	ret.LastDhtAnnounce = t.lastDhtAnnounce
+	ret.DhtPeers = t.numDhtPeers
 	return
 }
 
+// Bytes of data uploaded, for trackers, including those carried over.
+func (t *Torrent) uploaded() int64 {
+	return t.carriedUploaded + t.stats.BytesWrittenData.Int64()
+}
+
+// Bytes of useful data downloaded, for trackers, including those carried over. There's no mention
+// of wasted or unwanted download in the BEP.
+func (t *Torrent) downloaded() int64 {
+	return t.carriedDownloaded + t.stats.BytesReadUsefulData.Int64()
+}
+
 // The total number of peers in the torrent.
 func (t *Torrent) numTotalPeers() int {
 	peers := make(map[string]struct{})
@@ -1696,7 +1896,7 @@ func (t *Torrent) addConnection(c *PeerConn) (err error) {
 		panic(len(t.conns))
 	}
 	t.conns[c] = struct{}{}
-	if !t.cl.config.DisablePEX && !c.PeerExtensionBytes.SupportsExtended() {
+	if t.pexEnabled() && !c.PeerExtensionBytes.SupportsExtended() {
 		t.pex.Add(c) // as no further extended handshake expected
 	}
 	return nil
@@ -2117,7 +2317,8 @@ var WebseedHttpClient = &http.Client{
 	},
 }
 
-func (t *Torrent) addWebSeed(url string) {
+// A URL already added in another style isn't added again.
+func (t *Torrent) addWebSeed(url string, style webseed.Style) {
 	if !strings.HasPrefix(url, "http") {
 		url = "http://" + url
 	}
@@ -2144,6 +2345,8 @@ func (t *Torrent) addWebSeed(url string) {
 			// Consider a MaxConnsPerHost in the transport for this, possibly in a global Client.
 			HttpClient: WebseedHttpClient,
 			Url:        url,
+			Style:      style,
+			InfoHash:   t.infoHash,
 		},
 		activeRequests: make(map[Request]webseed.Request, maxRequests),
 	}
@@ -1,5 +1,7 @@
 package torrent
 
+import "time"
+
 // Due to ConnStats, may require special alignment on some platforms. See
 // https://github.com/anacrolix/torrent/issues/383.
 type TorrentStats struct {
@@ -13,4 +15,16 @@ type TorrentStats struct {
 	ActivePeers      int
 	ConnectedSeeders int
 	HalfOpenPeers    int
+
+	// The totals given to trackers, including any carried over from earlier sessions with
+	// TorrentSpec. Save them with the torrent's resume data to carry them over again.
+	Uploaded   int64
+	Downloaded int64
+
+	// When peers were last looked up on the DHT, which is also when we were last announced to it
+	// if Torrent.DhtAnnounce. Zero if they never have been.
+	LastDhtAnnounce time.Time
+	// The number of peers added from DHT lookups. Those found again after they've been tried are
+	// counted again.
+	DhtPeers int
 }
@@ -20,19 +20,24 @@ import (
 type HttpResponse struct {
 	FailureReason string `bencode:"failure reason"`
 	Interval      int32  `bencode:"interval"`
+	MinInterval   int32  `bencode:"min interval"`
 	TrackerId     string `bencode:"tracker id"`
 	Complete      int32  `bencode:"complete"`
 	Incomplete    int32  `bencode:"incomplete"`
 	Peers         Peers  `bencode:"peers"`
 	// BEP 7
 	Peers6 krpc.CompactIPv6NodeAddrs `bencode:"peers6"`
+	// BEP 24. Our IP as the tracker saw it, as 4 or 16 bytes.
+	ExternalIp string `bencode:"external ip,omitempty"`
+	// To be shown, for an announce that otherwise succeeded.
+	WarningMessage string `bencode:"warning message,omitempty"`
 }
 
 type Peers []Peer
 
 func (me *Peers) UnmarshalBencode(b []byte) (err error) {
 	var _v interface{}
-	err = bencode.Unmarshal(b, &_v)
+	err = bencode.UnmarshalNetwork(b, &_v)
 	if err != nil {
 		return
 	}
@@ -85,15 +90,26 @@ func setAnnounceParams(_url *url.URL, ar *AnnounceRequest, opts Announce) {
 		left = math.MaxInt64
 	}
 	q.Set("left", strconv.FormatInt(left, 10))
+	// As for UDP, -1 leaves it to the tracker.
+	if ar.NumWant >= 0 {
+		q.Set("numwant", strconv.FormatInt(int64(ar.NumWant), 10))
+	}
 
 	if ar.Event != None {
 		q.Set("event", ar.Event.String())
 	}
 	// http://stackoverflow.com/questions/17418004/why-does-tracker-server-not-understand-my-request-bittorrent-protocol
-	q.Set("compact", "1")
+	if !opts.HTTPNoCompact {
+		q.Set("compact", "1")
+	}
+	if opts.HTTPNoPeerId {
+		q.Set("no_peer_id", "1")
+	}
 	// According to https://wiki.vuze.com/w/Message_Stream_Encryption. TODO:
 	// Take EncryptionPolicy or something like it as a parameter.
-	q.Set("supportcrypto", "1")
+	if !opts.HTTPNoSupportCrypto {
+		q.Set("supportcrypto", "1")
+	}
 	doIp := func(versionKey string, ip net.IP) {
 		if ip == nil {
 			return
@@ -109,31 +125,46 @@ func setAnnounceParams(_url *url.URL, ar *AnnounceRequest, opts Announce) {
 	_url.RawQuery = q.Encode()
 }
 
-func announceHTTP(opt Announce, _url *url.URL) (ret AnnounceResponse, err error) {
-	_url = httptoo.CopyURL(_url)
-	setAnnounceParams(_url, &opt.Request, opt)
-	req, err := http.NewRequest("GET", _url.String(), nil)
-	req.Header.Set("User-Agent", opt.UserAgent)
-	req.Host = opt.HostHeader
-	if opt.Context != nil {
-		req = req.WithContext(opt.Context)
+func newHttpClient(proxy func(*http.Request) (*url.URL, error), serverName string, localIp net.IP) *http.Client {
+	dialer := net.Dialer{
+		//Timeout: 15 * time.Second,
+	}
+	if localIp != nil {
+		dialer.LocalAddr = &net.TCPAddr{IP: localIp}
 	}
-	resp, err := (&http.Client{
+	return &http.Client{
 		//Timeout: time.Second * 15,
 		Transport: &http.Transport{
-			//Dial: (&net.Dialer{
-			//	Timeout: 15 * time.Second,
-			//}).Dial,
-			Proxy: opt.HTTPProxy,
+			DialContext: dialer.DialContext,
+			Proxy:       proxy,
 			//TLSHandshakeTimeout: 15 * time.Second,
 			TLSClientConfig: &tls.Config{
 				InsecureSkipVerify: true,
-				ServerName:         opt.ServerName,
+				ServerName:         serverName,
 			},
 			// This is for S3 trackers that hold connections open.
 			DisableKeepAlives: true,
 		},
-	}).Do(req)
+	}
+}
+
+func announceHTTP(opt Announce, _url *url.URL) (ret AnnounceResponse, err error) {
+	_url = httptoo.CopyURL(_url)
+	setAnnounceParams(_url, &opt.Request, opt)
+	req, err := http.NewRequest("GET", _url.String(), nil)
+	req.Header.Set("User-Agent", opt.UserAgent)
+	for k, v := range opt.HTTPHeader {
+		req.Header[k] = v
+	}
+	req.Host = opt.HostHeader
+	if opt.Context != nil {
+		req = req.WithContext(opt.Context)
+	}
+	client := opt.HTTPClient
+	if client == nil {
+		client = newHttpClient(opt.HTTPProxy, opt.ServerName, opt.LocalIp)
+	}
+	resp, err := client.Do(req)
 	if err != nil {
 		return
 	}
@@ -145,7 +176,7 @@ func announceHTTP(opt Announce, _url *url.URL) (ret AnnounceResponse, err error)
 		return
 	}
 	var trackerResponse HttpResponse
-	err = bencode.Unmarshal(buf.Bytes(), &trackerResponse)
+	err = bencode.UnmarshalNetwork(buf.Bytes(), &trackerResponse)
 	if _, ok := err.(bencode.ErrUnusedTrailingBytes); ok {
 		err = nil
 	} else if err != nil {
@@ -153,13 +184,18 @@ func announceHTTP(opt Announce, _url *url.URL) (ret AnnounceResponse, err error)
 		return
 	}
 	if trackerResponse.FailureReason != "" {
-		err = fmt.Errorf("tracker gave failure reason: %q", trackerResponse.FailureReason)
+		err = ErrTrackerFailure{sanitizeMessage(trackerResponse.FailureReason)}
 		return
 	}
+	ret.WarningMessage = sanitizeMessage(trackerResponse.WarningMessage)
 	vars.Add("successful http announces", 1)
 	ret.Interval = trackerResponse.Interval
+	ret.MinInterval = trackerResponse.MinInterval
 	ret.Leechers = trackerResponse.Incomplete
 	ret.Seeders = trackerResponse.Complete
+	if l := len(trackerResponse.ExternalIp); l == net.IPv4len || l == net.IPv6len {
+		ret.ExternalIp = net.IP(trackerResponse.ExternalIp)
+	}
 	if len(trackerResponse.Peers) != 0 {
 		vars.Add("http responses with nonempty peers key", 1)
 	}
@@ -1,7 +1,14 @@
 package tracker
 
 import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
 	"testing"
+	"unicode/utf8"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -49,3 +56,123 @@ func TestUnmarshalHttpResponsePeers6NotCompact(t *testing.T) {
 		&hr,
 	))
 }
+
+func TestAnnounceHTTPClientAndHeader(t *testing.T) {
+	s := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Cookie") != "passkey=secret" || r.UserAgent() != "private/1.0" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		w.Write(bencode.MustMarshal(HttpResponse{Interval: 1800}))
+	}))
+	defer s.Close()
+	res, err := Announce{
+		TrackerUrl: s.URL + "/announce",
+		UserAgent:  "Go-Torrent/1.0",
+		// This client trusts only the server's certificate.
+		HTTPClient: s.Client(),
+		HTTPHeader: http.Header{
+			"Cookie":     {"passkey=secret"},
+			"User-Agent": {"private/1.0"},
+		},
+	}.Do()
+	require.NoError(t, err)
+	assert.EqualValues(t, 1800, res.Interval)
+	// Without the header, the tracker refuses.
+	_, err = Announce{
+		TrackerUrl: s.URL + "/announce",
+		HTTPClient: s.Client(),
+	}.Do()
+	assert.Error(t, err)
+}
+
+func TestAnnounceHTTPExternalIp(t *testing.T) {
+	for _, _case := range []struct {
+		externalIp string
+		expected   net.IP
+	}{
+		{"\x01\x02\x03\x04", net.ParseIP("1.2.3.4")},
+		{string(net.ParseIP("2001:db8::1")), net.ParseIP("2001:db8::1")},
+		// Values that aren't an IP are ignored.
+		{"abc", nil},
+	} {
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write(bencode.MustMarshal(HttpResponse{Interval: 1800, ExternalIp: _case.externalIp}))
+		}))
+		res, err := Announce{TrackerUrl: s.URL + "/announce"}.Do()
+		s.Close()
+		require.NoError(t, err)
+		if _case.expected == nil {
+			assert.Nil(t, res.ExternalIp)
+		} else {
+			assert.True(t, _case.expected.Equal(res.ExternalIp), "%q: %v", _case.externalIp, res.ExternalIp)
+		}
+	}
+}
+
+func TestSetAnnounceParamsNumWant(t *testing.T) {
+	for _, _case := range []struct {
+		numWant  int32
+		expected string
+	}{
+		{-1, ""},
+		{0, "0"},
+		{7, "7"},
+	} {
+		u, err := url.Parse("http://tracker.example.com/announce")
+		require.NoError(t, err)
+		setAnnounceParams(u, &AnnounceRequest{NumWant: _case.numWant}, Announce{})
+		assert.Equal(t, _case.expected, u.Query().Get("numwant"))
+	}
+}
+
+func TestSetAnnounceParamsFlags(t *testing.T) {
+	for _, _case := range []struct {
+		opts                             Announce
+		compact, noPeerId, supportCrypto string
+	}{
+		{Announce{}, "1", "", "1"},
+		{Announce{HTTPNoCompact: true}, "", "", "1"},
+		{Announce{HTTPNoPeerId: true}, "1", "1", "1"},
+		{Announce{HTTPNoSupportCrypto: true}, "1", "", ""},
+		{Announce{HTTPNoCompact: true, HTTPNoPeerId: true, HTTPNoSupportCrypto: true}, "", "1", ""},
+	} {
+		u, err := url.Parse("http://tracker.example.com/announce")
+		require.NoError(t, err)
+		setAnnounceParams(u, &AnnounceRequest{}, _case.opts)
+		q := u.Query()
+		assert.Equal(t, _case.compact, q.Get("compact"), "%+v", _case.opts)
+		assert.Equal(t, _case.noPeerId, q.Get("no_peer_id"), "%+v", _case.opts)
+		assert.Equal(t, _case.supportCrypto, q.Get("supportcrypto"), "%+v", _case.opts)
+	}
+}
+
+func TestAnnounceHTTPFailureAndWarning(t *testing.T) {
+	var hr HttpResponse
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(bencode.MustMarshal(hr))
+	}))
+	defer s.Close()
+	hr = HttpResponse{Interval: 1800, WarningMessage: "ratio\x1b[31m low\n"}
+	res, err := Announce{TrackerUrl: s.URL + "/announce"}.Do()
+	require.NoError(t, err)
+	assert.Equal(t, "ratio[31m low", res.WarningMessage)
+
+	hr = HttpResponse{FailureReason: "torrent not registered\x00" + strings.Repeat("x", 1000)}
+	_, err = Announce{TrackerUrl: s.URL + "/announce"}.Do()
+	var failure ErrTrackerFailure
+	require.True(t, errors.As(err, &failure), "%v", err)
+	assert.True(t, strings.HasPrefix(failure.Reason, "torrent not registeredxxx"))
+	assert.Len(t, failure.Reason, maxMessageLen)
+}
+
+func TestSanitizeMessage(t *testing.T) {
+	assert.Equal(t, "ok", sanitizeMessage(" ok\r\n"))
+	assert.Equal(t, "né", sanitizeMessage("n\xffé\u0085"))
+	// Bidirectional overrides and isolates can't reorder the text around the message.
+	assert.Equal(t, "evil.torrent", sanitizeMessage("evil\u202e.torrent\u2066\u2069"))
+	// Truncation doesn't split runes.
+	s := sanitizeMessage(strings.Repeat("é", maxMessageLen))
+	assert.Len(t, s, maxMessageLen)
+	assert.True(t, utf8.ValidString(s))
+}
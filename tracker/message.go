@@ -0,0 +1,38 @@
+package tracker
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// The longest tracker message kept, in bytes. Longer messages are truncated.
+const maxMessageLen = 512
+
+// A failure reason from an HTTP tracker, or an error response from a UDP tracker, such as that the
+// torrent isn't registered.
+type ErrTrackerFailure struct {
+	// Sanitized, as it's whatever the tracker sent.
+	Reason string
+}
+
+func (me ErrTrackerFailure) Error() string {
+	return fmt.Sprintf("tracker gave failure reason: %q", me.Reason)
+}
+
+// Makes text from a tracker safe to show: invalid UTF-8, control characters and format characters
+// such as bidirectional overrides are dropped, and it's truncated to maxMessageLen.
+func sanitizeMessage(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if r == utf8.RuneError || unicode.IsControl(r) || unicode.Is(unicode.Cf, r) {
+			continue
+		}
+		if b.Len()+utf8.RuneLen(r) > maxMessageLen {
+			break
+		}
+		b.WriteRune(r)
+	}
+	return strings.TrimSpace(b.String())
+}
@@ -0,0 +1,167 @@
+package tracker
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/anacrolix/missinggo/httptoo"
+
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+// Marshalled as binary by the UDP client, so be careful making changes.
+type ScrapeStats struct {
+	Seeders   int32 // Peers with the complete torrent, "complete" for HTTP trackers.
+	Completed int32 // Times the torrent has been downloaded, "downloaded" for HTTP trackers.
+	Leechers  int32 // Peers without the complete torrent, "incomplete" for HTTP trackers.
+}
+
+// Returned when a tracker doesn't support scrape. For HTTP trackers, that's when the announce URL
+// doesn't follow the convention for deriving the scrape URL, or there's nothing at the scrape URL.
+type ErrScrapeUnsupported struct {
+	TrackerUrl string
+}
+
+func (me ErrScrapeUnsupported) Error() string {
+	return fmt.Sprintf("tracker %q doesn't support scrape", me.TrackerUrl)
+}
+
+// BEP 15 says about 74 fit in a packet.
+const udpScrapeMaxInfoHashes = 70
+
+type ScrapeOpts struct {
+	HTTPProxy func(*http.Request) (*url.URL, error)
+	UserAgent string
+	// As for Announce.UdpNetwork. If empty, and the scheme is udp4 or udp6, that's used.
+	UdpNetwork string
+}
+
+// Gets the stats for the info hashes from the tracker, without announcing. Info hashes the tracker
+// doesn't know about may be missing from the result. UDP trackers are sent up to 70 info hashes at
+// a time. If ctx is nil, DefaultTrackerAnnounceTimeout is used, as for Announce.
+func Scrape(ctx context.Context, trackerUrl string, infoHashes []metainfo.Hash) (map[metainfo.Hash]ScrapeStats, error) {
+	return ScrapeWithOpts(ctx, trackerUrl, infoHashes, ScrapeOpts{})
+}
+
+func ScrapeWithOpts(ctx context.Context, trackerUrl string, infoHashes []metainfo.Hash, opts ScrapeOpts) (ret map[metainfo.Hash]ScrapeStats, err error) {
+	_url, err := url.Parse(trackerUrl)
+	if err != nil {
+		return
+	}
+	if ctx == nil {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(context.Background(), DefaultTrackerAnnounceTimeout)
+		defer cancel()
+	}
+	switch _url.Scheme {
+	case "http", "https":
+		return scrapeHTTP(ctx, _url, infoHashes, opts)
+	case "udp", "udp4", "udp6":
+		a := Announce{
+			TrackerUrl: trackerUrl,
+			UdpNetwork: opts.UdpNetwork,
+			Context:    ctx,
+		}
+		if a.UdpNetwork == "" && _url.Scheme != "udp" {
+			a.UdpNetwork = _url.Scheme
+		}
+		withUdpClient(a, _url, func(ua *udpAnnounce) {
+			ret, err = ua.Scrape(infoHashes)
+		})
+		return
+	default:
+		err = ErrBadScheme
+		return
+	}
+}
+
+// Returns the scrape URL for an HTTP announce URL, by the convention that the last path element
+// begins with "announce", which is replaced with "scrape".
+func httpScrapeUrl(announce *url.URL) (_ *url.URL, ok bool) {
+	dir, file := path.Split(announce.Path)
+	if !strings.HasPrefix(file, "announce") {
+		return nil, false
+	}
+	ret := httptoo.CopyURL(announce)
+	ret.Path = dir + "scrape" + strings.TrimPrefix(file, "announce")
+	ret.RawPath = ""
+	return ret, true
+}
+
+type httpScrapeResponse struct {
+	FailureReason string                            `bencode:"failure reason"`
+	Files         map[string]httpScrapeResponseFile `bencode:"files"`
+}
+
+type httpScrapeResponseFile struct {
+	Complete   int32 `bencode:"complete"`
+	Downloaded int32 `bencode:"downloaded"`
+	Incomplete int32 `bencode:"incomplete"`
+}
+
+func scrapeHTTP(ctx context.Context, announce *url.URL, infoHashes []metainfo.Hash, opts ScrapeOpts) (ret map[metainfo.Hash]ScrapeStats, err error) {
+	_url, ok := httpScrapeUrl(announce)
+	if !ok {
+		err = ErrScrapeUnsupported{announce.String()}
+		return
+	}
+	q := _url.Query()
+	for _, ih := range infoHashes {
+		q.Add("info_hash", string(ih[:]))
+	}
+	_url.RawQuery = q.Encode()
+	req, err := http.NewRequest("GET", _url.String(), nil)
+	if err != nil {
+		return
+	}
+	req.Header.Set("User-Agent", opts.UserAgent)
+	req = req.WithContext(ctx)
+	resp, err := newHttpClient(opts.HTTPProxy, "", nil).Do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	var buf bytes.Buffer
+	io.Copy(&buf, resp.Body)
+	if resp.StatusCode == http.StatusNotFound {
+		err = ErrScrapeUnsupported{announce.String()}
+		return
+	}
+	if resp.StatusCode != 200 {
+		err = fmt.Errorf("response from tracker: %s: %s", resp.Status, buf.String())
+		return
+	}
+	var sr httpScrapeResponse
+	err = bencode.UnmarshalNetwork(buf.Bytes(), &sr)
+	if _, ok := err.(bencode.ErrUnusedTrailingBytes); ok {
+		err = nil
+	} else if err != nil {
+		err = fmt.Errorf("error decoding %q: %s", buf.Bytes(), err)
+		return
+	}
+	if sr.FailureReason != "" {
+		err = fmt.Errorf("tracker gave failure reason: %q", sr.FailureReason)
+		return
+	}
+	ret = make(map[metainfo.Hash]ScrapeStats, len(sr.Files))
+	for k, f := range sr.Files {
+		if len(k) != len(metainfo.Hash{}) {
+			continue
+		}
+		var ih metainfo.Hash
+		copy(ih[:], k)
+		ret[ih] = ScrapeStats{
+			Seeders:   f.Complete,
+			Completed: f.Downloaded,
+			Leechers:  f.Incomplete,
+		}
+	}
+	return
+}
@@ -0,0 +1,96 @@
+package tracker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+func TestHttpScrapeUrl(t *testing.T) {
+	for _, c := range []struct {
+		announce, scrape string
+	}{
+		{"http://example.com/announce", "http://example.com/scrape"},
+		{"http://example.com/x/announce.php?passkey=a", "http://example.com/x/scrape.php?passkey=a"},
+		{"http://example.com/a", ""},
+		{"http://example.com/announce/x", ""},
+	} {
+		u, err := url.Parse(c.announce)
+		require.NoError(t, err)
+		s, ok := httpScrapeUrl(u)
+		if c.scrape == "" {
+			assert.False(t, ok, c.announce)
+			continue
+		}
+		require.True(t, ok, c.announce)
+		assert.Equal(t, c.scrape, s.String())
+	}
+}
+
+func TestScrapeHTTP(t *testing.T) {
+	ih1 := metainfo.Hash{1}
+	ih2 := metainfo.Hash{2}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/scrape" {
+			http.NotFound(w, r)
+			return
+		}
+		assert.Equal(t, []string{string(ih1[:]), string(ih2[:])}, r.URL.Query()["info_hash"])
+		w.Write(bencode.MustMarshal(map[string]interface{}{
+			"files": map[string]interface{}{
+				string(ih1[:]): map[string]int{"complete": 1, "downloaded": 2, "incomplete": 3},
+			},
+		}))
+	}))
+	defer srv.Close()
+	stats, err := Scrape(context.Background(), srv.URL+"/announce", []metainfo.Hash{ih1, ih2})
+	require.NoError(t, err)
+	assert.Equal(t, map[metainfo.Hash]ScrapeStats{ih1: {Seeders: 1, Completed: 2, Leechers: 3}}, stats)
+
+	for _, u := range []string{srv.URL + "/a", srv.URL + "/x/announce"} {
+		_, err = Scrape(context.Background(), u, []metainfo.Hash{ih1})
+		var unsupported ErrScrapeUnsupported
+		assert.True(t, errors.As(err, &unsupported), "%s: %v", u, err)
+	}
+}
+
+func TestScrapeUDP(t *testing.T) {
+	pc, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	lpc := &lossyPacketConn{PacketConn: pc}
+	defer lpc.Close()
+	srv := server{
+		pc: lpc,
+		t: map[[20]byte]torrent{
+			{1}:  {Seeders: 1, Leechers: 2},
+			{99}: {Seeders: 3, Leechers: 4},
+		},
+	}
+	go func() {
+		for srv.serveOne() == nil {
+		}
+	}()
+	var infoHashes []metainfo.Hash
+	for i := 0; i < 100; i++ {
+		infoHashes = append(infoHashes, metainfo.Hash{byte(i)})
+	}
+	stats, err := Scrape(context.Background(), fmt.Sprintf("udp://%s", pc.LocalAddr()), infoHashes)
+	require.NoError(t, err)
+	assert.Len(t, stats, 100)
+	assert.Equal(t, ScrapeStats{Seeders: 1, Leechers: 2}, stats[metainfo.Hash{1}])
+	assert.Equal(t, ScrapeStats{Seeders: 3, Leechers: 4}, stats[metainfo.Hash{99}])
+	assert.Equal(t, ScrapeStats{}, stats[metainfo.Hash{50}])
+	// The info hashes don't fit in one packet.
+	assert.Equal(t, []Action{ActionConnect, ActionScrape, ActionScrape}, lpc.Actions())
+}
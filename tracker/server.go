@@ -113,6 +113,28 @@ func (s *server) serveOne() (err error) {
 			Seeders:  t.Seeders,
 		}, b)
 		return
+	case ActionScrape:
+		if _, ok := s.conns[h.ConnectionId]; !ok {
+			s.respond(addr, ResponseHeader{
+				TransactionId: h.TransactionId,
+				Action:        ActionError,
+			}, []byte("not connected"))
+			return
+		}
+		var stats []ScrapeStats
+		var ih [20]byte
+		for readBody(r, &ih) == nil {
+			t := s.t[ih]
+			stats = append(stats, ScrapeStats{
+				Seeders:  t.Seeders,
+				Leechers: t.Leechers,
+			})
+		}
+		err = s.respond(addr, ResponseHeader{
+			TransactionId: h.TransactionId,
+			Action:        ActionScrape,
+		}, stats)
+		return
 	default:
 		err = fmt.Errorf("unhandled action: %d", h.Action)
 		s.respond(addr, ResponseHeader{
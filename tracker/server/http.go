@@ -0,0 +1,157 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/anacrolix/dht/v2/krpc"
+
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/anacrolix/torrent/tracker"
+)
+
+type httpAnnounceResponse struct {
+	Interval   int32                     `bencode:"interval"`
+	Complete   int32                     `bencode:"complete"`
+	Incomplete int32                     `bencode:"incomplete"`
+	Peers      krpc.CompactIPv4NodeAddrs `bencode:"peers"`
+	// BEP 7
+	Peers6 krpc.CompactIPv6NodeAddrs `bencode:"peers6,omitempty"`
+}
+
+type httpScrapeResponseFile struct {
+	Complete   int32 `bencode:"complete"`
+	Downloaded int32 `bencode:"downloaded"`
+	Incomplete int32 `bencode:"incomplete"`
+}
+
+// Serves announces and scrapes. The last element of the request path must start with "announce" or
+// "scrape", as the client derives scrape URLs by that convention. Peers are always given in compact
+// form, at the IP the request came from.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	base := path.Base(r.URL.Path)
+	var resp interface{}
+	var err error
+	switch {
+	case strings.HasPrefix(base, "announce"):
+		resp, err = s.serveHttpAnnounce(r)
+	case strings.HasPrefix(base, "scrape"):
+		resp, err = s.serveHttpScrape(r)
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		resp = map[string]string{"failure reason": err.Error()}
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	w.Write(bencode.MustMarshal(resp))
+}
+
+func (s *Server) serveHttpAnnounce(r *http.Request) (_ interface{}, err error) {
+	q := r.URL.Query()
+	var a announce
+	if err = httpInfoHash(q.Get("info_hash"), &a.infoHash); err != nil {
+		return
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		err = fmt.Errorf("bad remote address %q", r.RemoteAddr)
+		return
+	}
+	port, err := strconv.ParseUint(q.Get("port"), 10, 16)
+	if err != nil || port == 0 {
+		err = errors.New("bad port")
+		return
+	}
+	a.addr = nodeAddr(ip, int(port))
+	a.left = -1
+	if left := q.Get("left"); left != "" {
+		if a.left, err = strconv.ParseInt(left, 10, 64); err != nil {
+			err = errors.New("bad left")
+			return
+		}
+	}
+	switch q.Get("event") {
+	case "":
+	case "started":
+		a.event = tracker.Started
+	case "completed":
+		a.event = tracker.Completed
+	case "stopped":
+		a.event = tracker.Stopped
+	default:
+		err = errors.New("bad event")
+		return
+	}
+	a.numWant = -1
+	if numWant := q.Get("numwant"); numWant != "" {
+		n, parseErr := strconv.ParseInt(numWant, 10, 32)
+		if parseErr != nil {
+			err = errors.New("bad numwant")
+			return
+		}
+		a.numWant = int32(n)
+	}
+	ar, err := s.announce(a)
+	if err != nil {
+		return
+	}
+	resp := httpAnnounceResponse{
+		Interval:   int32(ar.interval.Seconds()),
+		Complete:   ar.stats.Seeders,
+		Incomplete: ar.stats.Leechers,
+		Peers:      krpc.CompactIPv4NodeAddrs{},
+	}
+	for _, na := range ar.peers {
+		if na.IP.To4() != nil {
+			resp.Peers = append(resp.Peers, na)
+		} else {
+			resp.Peers6 = append(resp.Peers6, na)
+		}
+	}
+	return resp, nil
+}
+
+func (s *Server) serveHttpScrape(r *http.Request) (_ interface{}, err error) {
+	infoHashes := r.URL.Query()["info_hash"]
+	if len(infoHashes) == 0 {
+		err = errors.New("no info_hash")
+		return
+	}
+	files := make(map[string]httpScrapeResponseFile, len(infoHashes))
+	for _, v := range infoHashes {
+		var ih metainfo.Hash
+		if err = httpInfoHash(v, &ih); err != nil {
+			return
+		}
+		if !s.tracked(ih) {
+			continue
+		}
+		stats := s.Scrape(ih)
+		files[v] = httpScrapeResponseFile{
+			Complete:   stats.Seeders,
+			Downloaded: stats.Completed,
+			Incomplete: stats.Leechers,
+		}
+	}
+	return map[string]interface{}{"files": files}, nil
+}
+
+func httpInfoHash(s string, ih *metainfo.Hash) error {
+	if len(s) != len(ih) {
+		return errors.New("bad info_hash")
+	}
+	copy(ih[:], s)
+	return nil
+}
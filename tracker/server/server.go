@@ -0,0 +1,204 @@
+// Package server is a BitTorrent tracker that keeps its swarms in memory. It answers announces and
+// scrapes over HTTP, as an http.Handler, and UDP (BEP 15). It's meant for tests, and small private
+// swarms such as on a LAN.
+package server
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/anacrolix/dht/v2/krpc"
+
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/anacrolix/torrent/tracker"
+)
+
+const (
+	DefaultInterval = 30 * time.Minute
+	DefaultMaxPeers = 50
+)
+
+// Returned for announces for info hashes that aren't allowed, when the Server has an allow list.
+var ErrNotAllowed = errors.New("torrent isn't registered with this tracker")
+
+// A tracker. The zero value is ready to use, and tracks any info hash.
+type Server struct {
+	// How long peers are asked to wait between announces. Peers are forgotten if they haven't
+	// announced for twice this long. DefaultInterval if zero.
+	Interval time.Duration
+	// The most peers given in an announce response. DefaultMaxPeers if zero.
+	MaxPeers int
+	// Only track the info hashes passed to Allow.
+	AllowList bool
+
+	mu       sync.Mutex
+	swarms   map[metainfo.Hash]*swarm
+	allowed  map[metainfo.Hash]bool
+	udpConns map[int64]time.Time
+}
+
+type swarm struct {
+	// Keyed by the peer's address.
+	peers map[string]*swarmPeer
+	// Announces with the completed event.
+	completed int32
+}
+
+type swarmPeer struct {
+	addr    krpc.NodeAddr
+	seeder  bool
+	expires time.Time
+}
+
+// An announce from either protocol.
+type announce struct {
+	infoHash metainfo.Hash
+	// The IP the announce came from, and the port from the request.
+	addr    krpc.NodeAddr
+	event   tracker.AnnounceEvent
+	left    int64
+	numWant int32
+	// Only return peers of the address family of addr, as UDP can't give both.
+	sameFamily bool
+}
+
+type announceResponse struct {
+	interval time.Duration
+	stats    tracker.ScrapeStats
+	peers    []krpc.NodeAddr
+}
+
+// Adds info hashes to those tracked when AllowList is set.
+func (s *Server) Allow(infoHashes ...metainfo.Hash) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.allowed == nil {
+		s.allowed = make(map[metainfo.Hash]bool)
+	}
+	for _, ih := range infoHashes {
+		s.allowed[ih] = true
+	}
+}
+
+// Returns the counts of the info hash's peers, as for a scrape.
+func (s *Server) Scrape(infoHash metainfo.Hash) tracker.ScrapeStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sw := s.swarms[infoHash]
+	if sw == nil {
+		return tracker.ScrapeStats{}
+	}
+	s.expirePeers(infoHash, sw, time.Now())
+	return sw.stats()
+}
+
+func (s *Server) interval() time.Duration {
+	if s.Interval == 0 {
+		return DefaultInterval
+	}
+	return s.Interval
+}
+
+func (s *Server) maxPeers() int {
+	if s.MaxPeers == 0 {
+		return DefaultMaxPeers
+	}
+	return s.MaxPeers
+}
+
+func (s *Server) announce(a announce) (ret announceResponse, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.AllowList && !s.allowed[a.infoHash] {
+		err = ErrNotAllowed
+		return
+	}
+	now := time.Now()
+	ret.interval = s.interval()
+	sw := s.swarms[a.infoHash]
+	if sw == nil {
+		sw = &swarm{peers: make(map[string]*swarmPeer)}
+		if s.swarms == nil {
+			s.swarms = make(map[metainfo.Hash]*swarm)
+		}
+		s.swarms[a.infoHash] = sw
+	}
+	key := a.addr.String()
+	if a.event == tracker.Stopped {
+		delete(sw.peers, key)
+	} else {
+		sw.peers[key] = &swarmPeer{
+			addr:    a.addr,
+			seeder:  a.left == 0,
+			expires: now.Add(2 * ret.interval),
+		}
+		if a.event == tracker.Completed {
+			sw.completed++
+		}
+	}
+	s.expirePeers(a.infoHash, sw, now)
+	ret.stats = sw.stats()
+	if a.event == tracker.Stopped {
+		return
+	}
+	numWant := s.maxPeers()
+	if a.numWant >= 0 && int(a.numWant) < numWant {
+		numWant = int(a.numWant)
+	}
+	ipv4 := a.addr.IP.To4() != nil
+	// Map iteration gives a different selection each time.
+	for k, p := range sw.peers {
+		if len(ret.peers) >= numWant {
+			break
+		}
+		if k == key || a.left == 0 && p.seeder {
+			continue
+		}
+		if a.sameFamily && (p.addr.IP.To4() != nil) != ipv4 {
+			continue
+		}
+		ret.peers = append(ret.peers, p.addr)
+	}
+	return
+}
+
+// Forgets peers that haven't announced in time, and the swarm if there are none left. Call with
+// the lock held.
+func (s *Server) expirePeers(infoHash metainfo.Hash, sw *swarm, now time.Time) {
+	for k, p := range sw.peers {
+		if now.After(p.expires) {
+			delete(sw.peers, k)
+		}
+	}
+	if len(sw.peers) == 0 && sw.completed == 0 {
+		delete(s.swarms, infoHash)
+	}
+}
+
+func (sw *swarm) stats() (ret tracker.ScrapeStats) {
+	ret.Completed = sw.completed
+	for _, p := range sw.peers {
+		if p.seeder {
+			ret.Seeders++
+		} else {
+			ret.Leechers++
+		}
+	}
+	return
+}
+
+func nodeAddr(ip net.IP, port int) krpc.NodeAddr {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	return krpc.NodeAddr{IP: ip, Port: port}
+}
+
+// Whether the info hash can be announced. Scrapes leave out the others.
+func (s *Server) tracked(infoHash metainfo.Hash) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return !s.AllowList || s.allowed[infoHash]
+}
@@ -0,0 +1,130 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"net"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/anacrolix/torrent/tracker"
+)
+
+var testInfoHash = metainfo.NewHashFromHex("0123456789abcdef0123456789abcdef01234567")
+
+// Starts the server on loopback, returning its HTTP and UDP announce URLs.
+func startTestServer(t *testing.T, s *Server) (httpUrl, udpUrl string) {
+	hs := httptest.NewServer(s)
+	t.Cleanup(hs.Close)
+	pc, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { pc.Close() })
+	go s.ServeUDP(pc)
+	return hs.URL + "/announce", "udp://" + pc.LocalAddr().String()
+}
+
+func testAnnounce(trackerUrl string, port uint16, left int64, event tracker.AnnounceEvent) (tracker.AnnounceResponse, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return tracker.Announce{
+		TrackerUrl: trackerUrl,
+		Context:    ctx,
+		Request: tracker.AnnounceRequest{
+			InfoHash: testInfoHash,
+			Port:     port,
+			Left:     left,
+			Event:    event,
+			NumWant:  -1,
+		},
+	}.Do()
+}
+
+func TestAnnounce(t *testing.T) {
+	for _, proto := range []string{"http", "udp"} {
+		t.Run(proto, func(t *testing.T) {
+			var s Server
+			httpUrl, udpUrl := startTestServer(t, &s)
+			trackerUrl := map[string]string{"http": httpUrl, "udp": udpUrl}[proto]
+
+			res, err := testAnnounce(trackerUrl, 1000, 0, tracker.Started)
+			require.NoError(t, err)
+			assert.EqualValues(t, DefaultInterval/time.Second, res.Interval)
+			assert.Empty(t, res.Peers)
+			assert.EqualValues(t, 1, res.Seeders)
+
+			// A leecher gets the seeder.
+			res, err = testAnnounce(trackerUrl, 1001, 10, tracker.Started)
+			require.NoError(t, err)
+			require.Len(t, res.Peers, 1)
+			assert.True(t, res.Peers[0].IP.Equal(net.IPv4(127, 0, 0, 1)))
+			assert.Equal(t, 1000, res.Peers[0].Port)
+			assert.EqualValues(t, 1, res.Seeders)
+			assert.EqualValues(t, 1, res.Leechers)
+
+			// Seeders only get leechers.
+			res, err = testAnnounce(trackerUrl, 1002, 0, tracker.None)
+			require.NoError(t, err)
+			require.Len(t, res.Peers, 1)
+			assert.Equal(t, 1001, res.Peers[0].Port)
+
+			_, err = testAnnounce(trackerUrl, 1001, 0, tracker.Completed)
+			require.NoError(t, err)
+			_, err = testAnnounce(trackerUrl, 1000, 0, tracker.Stopped)
+			require.NoError(t, err)
+			assert.Equal(t, tracker.ScrapeStats{Seeders: 2, Completed: 1}, s.Scrape(testInfoHash))
+
+			scrape, err := tracker.Scrape(nil, trackerUrl, []metainfo.Hash{testInfoHash})
+			require.NoError(t, err)
+			assert.Equal(t, tracker.ScrapeStats{Seeders: 2, Completed: 1}, scrape[testInfoHash])
+		})
+	}
+}
+
+func TestAllowList(t *testing.T) {
+	s := Server{AllowList: true}
+	httpUrl, udpUrl := startTestServer(t, &s)
+	for _, trackerUrl := range []string{httpUrl, udpUrl} {
+		_, err := testAnnounce(trackerUrl, 1000, 0, tracker.Started)
+		var failure tracker.ErrTrackerFailure
+		require.True(t, errors.As(err, &failure), "%v", err)
+		assert.Equal(t, ErrNotAllowed.Error(), failure.Reason)
+		scrape, err := tracker.Scrape(nil, trackerUrl, []metainfo.Hash{testInfoHash})
+		require.NoError(t, err)
+		assert.Zero(t, scrape[testInfoHash])
+	}
+	s.Allow(testInfoHash)
+	for _, trackerUrl := range []string{httpUrl, udpUrl} {
+		_, err := testAnnounce(trackerUrl, 1000, 0, tracker.Started)
+		require.NoError(t, err)
+	}
+}
+
+func TestPeersExpire(t *testing.T) {
+	s := Server{Interval: time.Millisecond}
+	httpUrl, _ := startTestServer(t, &s)
+	_, err := testAnnounce(httpUrl, 1000, 10, tracker.Started)
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, s.Scrape(testInfoHash).Leechers)
+	time.Sleep(10 * time.Millisecond)
+	assert.Zero(t, s.Scrape(testInfoHash))
+	res, err := testAnnounce(httpUrl, 1001, 10, tracker.Started)
+	require.NoError(t, err)
+	assert.Empty(t, res.Peers)
+}
+
+func TestUdpNotConnected(t *testing.T) {
+	var s Server
+	var b bytes.Buffer
+	binary.Write(&b, binary.BigEndian, tracker.RequestHeader{ConnectionId: 1, Action: tracker.ActionAnnounce})
+	binary.Write(&b, binary.BigEndian, tracker.AnnounceRequest{})
+	resp := s.handleUdp(b.Bytes(), &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1})
+	require.NotNil(t, resp)
+	assert.Contains(t, string(resp), errUdpNotConnected.Error())
+}
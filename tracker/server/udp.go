@@ -0,0 +1,165 @@
+package server
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"time"
+
+	"github.com/anacrolix/dht/v2/krpc"
+
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/anacrolix/torrent/tracker"
+)
+
+const (
+	// BEP 15's magic constant, that connect requests give as their connection ID.
+	udpProtocolId = 0x41727101980
+	// BEP 15 says clients can use a connection ID for a minute, and trackers should accept it for
+	// two.
+	udpConnTimeout = 2 * time.Minute
+	// About as many as fit in a packet, as BEP 15 says.
+	udpScrapeMaxInfoHashes = 74
+)
+
+var errUdpNotConnected = errors.New("connection ID unknown or expired")
+
+// Serves announces and scrapes on pc, until reading from it fails, as when it's closed. Peers are
+// given at the address the request came from, and only those of the same address family.
+func (s *Server) ServeUDP(pc net.PacketConn) error {
+	b := make([]byte, 0x10000)
+	for {
+		n, addr, err := pc.ReadFrom(b)
+		if err != nil {
+			return err
+		}
+		ua, ok := addr.(*net.UDPAddr)
+		if !ok {
+			continue
+		}
+		if resp := s.handleUdp(b[:n], ua); resp != nil {
+			pc.WriteTo(resp, addr)
+		}
+	}
+}
+
+// Returns the response to the request, or nil if it's not worth one.
+func (s *Server) handleUdp(b []byte, addr *net.UDPAddr) []byte {
+	r := bytes.NewReader(b)
+	var h tracker.RequestHeader
+	if binary.Read(r, binary.BigEndian, &h) != nil {
+		return nil
+	}
+	var resp bytes.Buffer
+	write := func(parts ...interface{}) {
+		for _, p := range parts {
+			if bm, ok := p.(encoding.BinaryMarshaler); ok {
+				b, _ := bm.MarshalBinary()
+				resp.Write(b)
+			} else {
+				binary.Write(&resp, binary.BigEndian, p)
+			}
+		}
+	}
+	fail := func(err error) []byte {
+		resp.Reset()
+		write(tracker.ResponseHeader{Action: tracker.ActionError, TransactionId: h.TransactionId})
+		resp.WriteString(err.Error())
+		return resp.Bytes()
+	}
+	if h.Action == tracker.ActionConnect {
+		if h.ConnectionId != udpProtocolId {
+			return nil
+		}
+		write(
+			tracker.ResponseHeader{Action: tracker.ActionConnect, TransactionId: h.TransactionId},
+			tracker.ConnectionResponse{ConnectionId: s.newUdpConn()},
+		)
+		return resp.Bytes()
+	}
+	if !s.udpConnected(h.ConnectionId) {
+		return fail(errUdpNotConnected)
+	}
+	switch h.Action {
+	case tracker.ActionAnnounce:
+		var ar tracker.AnnounceRequest
+		if err := binary.Read(r, binary.BigEndian, &ar); err != nil {
+			return fail(err)
+		}
+		// The IP address in the request is ignored, so peers can't announce others.
+		ann, err := s.announce(announce{
+			infoHash:   ar.InfoHash,
+			addr:       nodeAddr(addr.IP, int(ar.Port)),
+			event:      ar.Event,
+			left:       ar.Left,
+			numWant:    ar.NumWant,
+			sameFamily: true,
+		})
+		if err != nil {
+			return fail(err)
+		}
+		write(
+			tracker.ResponseHeader{Action: tracker.ActionAnnounce, TransactionId: h.TransactionId},
+			tracker.AnnounceResponseHeader{
+				Interval: int32(ann.interval.Seconds()),
+				Leechers: ann.stats.Leechers,
+				Seeders:  ann.stats.Seeders,
+			},
+		)
+		if addr.IP.To4() != nil {
+			write(krpc.CompactIPv4NodeAddrs(ann.peers))
+		} else {
+			write(krpc.CompactIPv6NodeAddrs(ann.peers))
+		}
+		return resp.Bytes()
+	case tracker.ActionScrape:
+		write(tracker.ResponseHeader{Action: tracker.ActionScrape, TransactionId: h.TransactionId})
+		for i := 0; i < udpScrapeMaxInfoHashes; i++ {
+			var ih metainfo.Hash
+			if _, err := io.ReadFull(r, ih[:]); err != nil {
+				break
+			}
+			// Responses must have stats for each info hash in order, so those that aren't tracked
+			// get zeroes.
+			var stats tracker.ScrapeStats
+			if s.tracked(ih) {
+				stats = s.Scrape(ih)
+			}
+			write(stats)
+		}
+		return resp.Bytes()
+	default:
+		return fail(errors.New("unhandled action"))
+	}
+}
+
+func (s *Server) newUdpConn() (id int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	if s.udpConns == nil {
+		s.udpConns = make(map[int64]time.Time)
+	}
+	for id, expires := range s.udpConns {
+		if now.After(expires) {
+			delete(s.udpConns, id)
+		}
+	}
+	// Unpredictable, so that the tracker can't be used to flood addresses that didn't connect.
+	if err := binary.Read(rand.Reader, binary.BigEndian, &id); err != nil {
+		panic(err)
+	}
+	s.udpConns[id] = now.Add(udpConnTimeout)
+	return
+}
+
+func (s *Server) udpConnected(id int64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	expires, ok := s.udpConns[id]
+	return ok && !time.Now().After(expires)
+}
@@ -3,6 +3,7 @@ package tracker
 import (
 	"context"
 	"errors"
+	"net"
 	"net/http"
 	"net/url"
 	"time"
@@ -28,9 +29,17 @@ type AnnounceRequest struct {
 
 type AnnounceResponse struct {
 	Interval int32 // Minimum seconds the local peer should wait before next announce.
-	Leechers int32
-	Seeders  int32
-	Peers    []Peer
+	// Seconds the local peer must wait before announcing again, if it wants to announce sooner than
+	// Interval. Zero if the tracker didn't say, as UDP trackers can't.
+	MinInterval int32
+	Leechers    int32
+	Seeders     int32
+	Peers       []Peer
+	// Our IP as the tracker saw the announce come from, if it said. Only HTTP trackers can, per
+	// BEP 24.
+	ExternalIp net.IP
+	// A warning from an HTTP tracker about an announce that otherwise succeeded. Sanitized.
+	WarningMessage string
 }
 
 type AnnounceEvent int32
@@ -56,6 +65,19 @@ type Announce struct {
 	Request    AnnounceRequest
 	HostHeader string
 	HTTPProxy  func(*http.Request) (*url.URL, error)
+	// Makes HTTP announces if not nil, instead of a client made from HTTPProxy and ServerName. Its
+	// TLS configuration, such as the CAs for a self-hosted tracker, applies.
+	HTTPClient *http.Client
+	// Added to HTTP announce requests, replacing any of the same name, including User-Agent. For
+	// things like cookies with passkeys for private trackers.
+	HTTPHeader http.Header
+	// Don't ask HTTP trackers for compact peer lists (BEP 23), for trackers that don't do them.
+	HTTPNoCompact bool
+	// Ask HTTP trackers to leave peer IDs out of non-compact peer lists.
+	HTTPNoPeerId bool
+	// Don't tell HTTP trackers we support encryption with the supportcrypto parameter.
+	HTTPNoSupportCrypto bool
+
 	ServerName string
 	UserAgent  string
 	UdpNetwork string
@@ -63,7 +85,10 @@ type Announce struct {
 	ClientIp4 krpc.NodeAddr
 	// If the port is zero, it's assumed to be the same as the Request.Port.
 	ClientIp6 krpc.NodeAddr
-	Context   context.Context
+	// The local address to announce from. It should be of the same family as the tracker's. If
+	// nil, the system chooses.
+	LocalIp net.IP
+	Context context.Context
 }
 
 // The code *is* the documentation.
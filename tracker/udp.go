@@ -10,12 +10,15 @@ import (
 	"math/rand"
 	"net"
 	"net/url"
+	"sync"
 	"time"
 
 	"github.com/anacrolix/dht/v2/krpc"
 	"github.com/anacrolix/missinggo"
 	"github.com/anacrolix/missinggo/pproffd"
 	"github.com/pkg/errors"
+
+	"github.com/anacrolix/torrent/metainfo"
 )
 
 type Action int32
@@ -65,31 +68,102 @@ func newTransactionId() int32 {
 	return int32(rand.Uint32())
 }
 
+// The wait for a response before the first retransmit. BEP 15 has 15 seconds, but that's as long as
+// an announce gets by default (see DefaultTrackerAnnounceTimeout), so there'd be no retransmits. It's
+// a variable for tests.
+var udpBaseTimeout = 3 * time.Second
+
+// Retransmits stop after this many timeouts, per BEP 15.
+const maxContiguousTimeouts = 8
+
+// How long the wait is for a response after the given number of timeouts in a row: udpBaseTimeout *
+// 2^n, as BEP 15 has it.
 func timeout(contiguousTimeouts int) (d time.Duration) {
-	if contiguousTimeouts > 8 {
-		contiguousTimeouts = 8
+	if contiguousTimeouts > maxContiguousTimeouts {
+		contiguousTimeouts = maxContiguousTimeouts
 	}
-	d = 15 * time.Second
+	d = udpBaseTimeout
 	for ; contiguousTimeouts > 0; contiguousTimeouts-- {
 		d *= 2
 	}
 	return
 }
 
-type udpAnnounce struct {
-	contiguousTimeouts   int
+// How long a tracker's connection ID can be used for, per BEP 15.
+const connectionIdValidity = time.Minute
+
+// The socket and connection ID for a tracker. They're kept between announces, so the connection ID
+// can be reused while it's valid. Announces to the same tracker take turns, as responses are read
+// from the one socket.
+type udpClient struct {
+	key                  udpClientKey
+	mu                   sync.Mutex
 	connectionIdReceived time.Time
 	connectionId         int64
 	socket               net.Conn
-	url                  url.URL
-	a                    *Announce
+	// Guarded by udpClients.
+	users     int
+	idleTimer *time.Timer
 }
 
-func (c *udpAnnounce) Close() error {
-	if c.socket != nil {
-		return c.socket.Close()
+type udpClientKey struct {
+	network, addr string
+	// The local IP, if it's not the system's choice.
+	localIp string
+}
+
+var udpClients struct {
+	sync.Mutex
+	m map[udpClientKey]*udpClient
+}
+
+// Returns the client for the tracker, which must be released when done with.
+func getUdpClient(key udpClientKey) *udpClient {
+	udpClients.Lock()
+	defer udpClients.Unlock()
+	c := udpClients.m[key]
+	if c == nil {
+		c = &udpClient{key: key}
+		if udpClients.m == nil {
+			udpClients.m = make(map[udpClientKey]*udpClient)
+		}
+		udpClients.m[key] = c
+	}
+	c.users++
+	if c.idleTimer != nil {
+		c.idleTimer.Stop()
 	}
-	return nil
+	return c
+}
+
+// Closes the socket once the client has been unused for as long as its connection ID is valid.
+func (c *udpClient) release() {
+	udpClients.Lock()
+	defer udpClients.Unlock()
+	c.users--
+	if c.users != 0 {
+		return
+	}
+	c.idleTimer = time.AfterFunc(connectionIdValidity, func() {
+		udpClients.Lock()
+		defer udpClients.Unlock()
+		if c.users != 0 || udpClients.m[c.key] != c {
+			return
+		}
+		delete(udpClients.m, c.key)
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if c.socket != nil {
+			c.socket.Close()
+		}
+	})
+}
+
+// An announce done with a udpClient.
+type udpAnnounce struct {
+	*udpClient
+	url url.URL
+	a   *Announce
 }
 
 func (c *udpAnnounce) ipv6() bool {
@@ -101,7 +175,8 @@ func (c *udpAnnounce) ipv6() bool {
 }
 
 func (c *udpAnnounce) Do(req AnnounceRequest) (res AnnounceResponse, err error) {
-	err = c.connect()
+	// The network in use is needed before connecting.
+	err = c.dial()
 	if err != nil {
 		return
 	}
@@ -115,7 +190,7 @@ func (c *udpAnnounce) Do(req AnnounceRequest) (res AnnounceResponse, err error)
 	// Clearly this limits the request URI to 255 bytes. BEP 41 supports
 	// longer but I'm not fussed.
 	options := append([]byte{optionTypeURLData, byte(len(reqURI))}, []byte(reqURI)...)
-	b, err := c.request(ActionAnnounce, req, options)
+	b, err := c.connectedRequest(ActionAnnounce, req, options)
 	if err != nil {
 		return
 	}
@@ -151,6 +226,54 @@ func (c *udpAnnounce) Do(req AnnounceRequest) (res AnnounceResponse, err error)
 	return
 }
 
+// Scrapes the info hashes, a packet's worth at a time.
+func (c *udpAnnounce) Scrape(infoHashes []metainfo.Hash) (ret map[metainfo.Hash]ScrapeStats, err error) {
+	ret = make(map[metainfo.Hash]ScrapeStats, len(infoHashes))
+	for len(infoHashes) != 0 {
+		n := len(infoHashes)
+		if n > udpScrapeMaxInfoHashes {
+			n = udpScrapeMaxInfoHashes
+		}
+		var b *bytes.Buffer
+		b, err = c.connectedRequest(ActionScrape, infoHashes[:n], nil)
+		if err != nil {
+			return
+		}
+		for _, ih := range infoHashes[:n] {
+			var ss ScrapeStats
+			err = readBody(b, &ss)
+			if err != nil {
+				if err == io.EOF {
+					err = io.ErrUnexpectedEOF
+				}
+				err = fmt.Errorf("error parsing scrape response: %s", err)
+				return
+			}
+			ret[ih] = ss
+		}
+		infoHashes = infoHashes[n:]
+	}
+	return
+}
+
+// Does the request with a connection ID. If the tracker rejects one that was reused, it may have
+// expired it early, so a new one is got and the request is tried again.
+func (c *udpAnnounce) connectedRequest(action Action, args interface{}, options []byte) (*bytes.Buffer, error) {
+	reusedConnectionId := c.connected()
+	if err := c.connect(); err != nil {
+		return nil, err
+	}
+	b, err := c.request(action, args, options)
+	if _, ok := err.(ErrTrackerFailure); ok && reusedConnectionId {
+		c.connectionIdReceived = time.Time{}
+		if err = c.connect(); err != nil {
+			return nil, err
+		}
+		b, err = c.request(action, args, options)
+	}
+	return b, err
+}
+
 // body is the binary serializable request body. trailer is optional data
 // following it, such as for BEP 41.
 func (c *udpAnnounce) write(h *RequestHeader, body interface{}, trailer []byte) (err error) {
@@ -188,21 +311,35 @@ func write(w io.Writer, data interface{}) error {
 }
 
 // args is the binary serializable request body. trailer is optional data
-// following it, such as for BEP 41.
+// following it, such as for BEP 41. The request is retransmitted each time a response times out,
+// until there have been maxContiguousTimeouts. The timeouts are counted for each request, so that
+// one that failed doesn't hold up the next with longer waits.
 func (c *udpAnnounce) request(action Action, args interface{}, options []byte) (*bytes.Buffer, error) {
+	// Responses to earlier transmissions are as good as the last.
 	tid := newTransactionId()
-	if err := errors.Wrap(
-		c.write(
-			&RequestHeader{
-				ConnectionId:  c.connectionId,
-				Action:        action,
-				TransactionId: tid,
-			}, args, options),
-		"writing request",
-	); err != nil {
-		return nil, err
+	for timeouts := 0; ; timeouts++ {
+		if err := errors.Wrap(
+			c.write(
+				&RequestHeader{
+					ConnectionId:  c.connectionId,
+					Action:        action,
+					TransactionId: tid,
+				}, args, options),
+			"writing request",
+		); err != nil {
+			return nil, err
+		}
+		c.socket.SetReadDeadline(time.Now().Add(timeout(timeouts)))
+		buf, err := c.readResponse(tid)
+		if opE, ok := errors.Cause(err).(*net.OpError); ok && opE.Timeout() && timeouts < maxContiguousTimeouts {
+			continue
+		}
+		return buf, err
 	}
-	c.socket.SetReadDeadline(time.Now().Add(timeout(c.contiguousTimeouts)))
+}
+
+// Reads until the response with the transaction ID, or the read deadline.
+func (c *udpAnnounce) readResponse(tid int32) (*bytes.Buffer, error) {
 	b := make([]byte, 0x800) // 2KiB
 	for {
 		var (
@@ -220,12 +357,12 @@ func (c *udpAnnounce) request(action Action, args interface{}, options []byte) (
 		}
 		select {
 		case <-ctx.Done():
+			// The socket is shared, so the read mustn't outlive the announce.
+			c.socket.SetReadDeadline(time.Now())
+			<-readDone
 			return nil, ctx.Err()
 		case <-readDone:
 		}
-		if opE, ok := readErr.(*net.OpError); ok && opE.Timeout() {
-			c.contiguousTimeouts++
-		}
 		if readErr != nil {
 			return nil, errors.Wrap(readErr, "reading from socket")
 		}
@@ -242,9 +379,8 @@ func (c *udpAnnounce) request(action Action, args interface{}, options []byte) (
 		if h.TransactionId != tid {
 			continue
 		}
-		c.contiguousTimeouts = 0
 		if h.Action == ActionError {
-			err = errors.New(buf.String())
+			err = ErrTrackerFailure{sanitizeMessage(buf.String())}
 		}
 		return buf, err
 	}
@@ -261,14 +397,23 @@ func readBody(r io.Reader, data ...interface{}) (err error) {
 }
 
 func (c *udpAnnounce) connected() bool {
-	return !c.connectionIdReceived.IsZero() && time.Now().Before(c.connectionIdReceived.Add(time.Minute))
+	return !c.connectionIdReceived.IsZero() && time.Now().Before(c.connectionIdReceived.Add(connectionIdValidity))
 }
 
-func (c *udpAnnounce) dialNetwork() string {
-	if c.a.UdpNetwork != "" {
-		return c.a.UdpNetwork
+func (c *udpAnnounce) dial() (err error) {
+	if c.socket != nil {
+		return nil
 	}
-	return "udp"
+	var dialer net.Dialer
+	if c.key.localIp != "" {
+		dialer.LocalAddr = &net.UDPAddr{IP: net.ParseIP(c.key.localIp)}
+	}
+	c.socket, err = dialer.Dial(c.key.network, c.key.addr)
+	if err != nil {
+		return
+	}
+	c.socket = pproffd.WrapNetConn(c.socket)
+	return
 }
 
 func (c *udpAnnounce) connect() (err error) {
@@ -276,17 +421,9 @@ func (c *udpAnnounce) connect() (err error) {
 		return nil
 	}
 	c.connectionId = connectRequestConnectionId
-	if c.socket == nil {
-		hmp := missinggo.SplitHostMaybePort(c.url.Host)
-		if hmp.NoPort {
-			hmp.NoPort = false
-			hmp.Port = 80
-		}
-		c.socket, err = net.Dial(c.dialNetwork(), hmp.String())
-		if err != nil {
-			return
-		}
-		c.socket = pproffd.WrapNetConn(c.socket)
+	err = c.dial()
+	if err != nil {
+		return
 	}
 	b, err := c.request(ActionConnect, nil, nil)
 	if err != nil {
@@ -302,13 +439,40 @@ func (c *udpAnnounce) connect() (err error) {
 	return
 }
 
+func udpDialNetwork(opt Announce) string {
+	if opt.UdpNetwork != "" {
+		return opt.UdpNetwork
+	}
+	return "udp"
+}
+
+// Does f with the client for the tracker at the URL.
+func withUdpClient(opt Announce, _url *url.URL, f func(*udpAnnounce)) {
+	hmp := missinggo.SplitHostMaybePort(_url.Host)
+	if hmp.NoPort {
+		hmp.NoPort = false
+		hmp.Port = 80
+	}
+	key := udpClientKey{network: udpDialNetwork(opt), addr: hmp.String()}
+	if opt.LocalIp != nil {
+		key.localIp = opt.LocalIp.String()
+	}
+	c := getUdpClient(key)
+	defer c.release()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	f(&udpAnnounce{
+		udpClient: c,
+		url:       *_url,
+		a:         &opt,
+	})
+}
+
 // TODO: Split on IPv6, as BEP 15 says response peer decoding depends on
 // network in use.
-func announceUDP(opt Announce, _url *url.URL) (AnnounceResponse, error) {
-	ua := udpAnnounce{
-		url: *_url,
-		a:   &opt,
-	}
-	defer ua.Close()
-	return ua.Do(opt.Request)
+func announceUDP(opt Announce, _url *url.URL) (res AnnounceResponse, err error) {
+	withUdpClient(opt, _url, func(ua *udpAnnounce) {
+		res, err = ua.Do(opt.Request)
+	})
+	return
 }
@@ -12,6 +12,7 @@ import (
 	"net/url"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/anacrolix/dht/v2/krpc"
 	_ "github.com/anacrolix/envpprof"
@@ -196,7 +197,9 @@ func TestURLPathOption(t *testing.T) {
 		panic(err)
 	}
 	defer conn.Close()
+	announced := make(chan struct{})
 	go func() {
+		defer close(announced)
 		_, err := Announce{
 			TrackerUrl: (&url.URL{
 				Scheme: "udp",
@@ -234,4 +237,113 @@ func TestURLPathOption(t *testing.T) {
 	})
 	write(w, AnnounceResponseHeader{})
 	conn.WriteTo(w.Bytes(), addr)
+	<-announced
+}
+
+// Records the actions of the requests the fake tracker receives, and drops the first few.
+type lossyPacketConn struct {
+	net.PacketConn
+	mu      sync.Mutex
+	drop    int
+	actions []Action
+}
+
+func (me *lossyPacketConn) ReadFrom(b []byte) (n int, addr net.Addr, err error) {
+	for {
+		n, addr, err = me.PacketConn.ReadFrom(b)
+		if err != nil {
+			return
+		}
+		var h RequestHeader
+		if read(bytes.NewReader(b[:n]), &h) != nil {
+			return
+		}
+		me.mu.Lock()
+		me.actions = append(me.actions, h.Action)
+		drop := me.drop > 0
+		if drop {
+			me.drop--
+		}
+		me.mu.Unlock()
+		if !drop {
+			return
+		}
+	}
+}
+
+func (me *lossyPacketConn) Actions() []Action {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	return append([]Action(nil), me.actions...)
+}
+
+// Starts a fake tracker on addr, which forgets its connection IDs when closed.
+func startLossyServer(t *testing.T, addr string, drop int) *lossyPacketConn {
+	pc, err := net.ListenPacket("udp4", addr)
+	require.NoError(t, err)
+	lpc := &lossyPacketConn{PacketConn: pc, drop: drop}
+	srv := server{pc: lpc}
+	go func() {
+		for srv.serveOne() == nil {
+		}
+	}()
+	return lpc
+}
+
+func announceLocalhost(pc net.PacketConn) (AnnounceResponse, error) {
+	return Announce{
+		TrackerUrl: fmt.Sprintf("udp://%s/announce", pc.LocalAddr()),
+		Request:    AnnounceRequest{NumWant: -1},
+	}.Do()
+}
+
+func TestAnnounceRetransmits(t *testing.T) {
+	defer func(d time.Duration) { udpBaseTimeout = d }(udpBaseTimeout)
+	udpBaseTimeout = 10 * time.Millisecond
+	pc := startLossyServer(t, "127.0.0.1:0", 2)
+	defer pc.Close()
+	ar, err := announceLocalhost(pc)
+	require.NoError(t, err)
+	assert.EqualValues(t, 900, ar.Interval)
+	assert.Equal(t, []Action{ActionConnect, ActionConnect, ActionConnect, ActionAnnounce}, pc.Actions())
+}
+
+func TestAnnounceTimeoutsNotCarried(t *testing.T) {
+	defer func(d time.Duration) { udpBaseTimeout = d }(udpBaseTimeout)
+	udpBaseTimeout = 10 * time.Millisecond
+	pc := startLossyServer(t, "127.0.0.1:0", 6)
+	defer pc.Close()
+	announce := func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		_, err := Announce{
+			TrackerUrl: fmt.Sprintf("udp://%s/announce", pc.LocalAddr()),
+			Request:    AnnounceRequest{NumWant: -1},
+			Context:    ctx,
+		}.Do()
+		return err
+	}
+	// Sent at 0, 10, 30 and 70ms, and all dropped.
+	require.Error(t, announce())
+	// The waits start again from the base, rather than at 160ms.
+	require.NoError(t, announce())
+}
+
+func TestAnnounceReusesConnectionId(t *testing.T) {
+	pc := startLossyServer(t, "127.0.0.1:0", 0)
+	defer pc.Close()
+	for i := 0; i < 2; i++ {
+		_, err := announceLocalhost(pc)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, []Action{ActionConnect, ActionAnnounce, ActionAnnounce}, pc.Actions())
+
+	// A restarted tracker rejects the connection ID, so a new one is got.
+	addr := pc.LocalAddr().String()
+	pc.Close()
+	pc = startLossyServer(t, addr, 0)
+	defer pc.Close()
+	_, err := announceLocalhost(pc)
+	require.NoError(t, err)
+	assert.Equal(t, []Action{ActionAnnounce, ActionConnect, ActionAnnounce}, pc.Actions())
 }
@@ -0,0 +1,171 @@
+package torrent
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/anacrolix/torrent/tracker"
+)
+
+// Returned for trackers that Torrent.Announce skips because they were announced to within their
+// min interval.
+var ErrAnnounceTooSoon = errors.New("announced within the tracker's min interval")
+
+// Options for Torrent.Announce.
+type AnnounceOpts struct {
+	// The announce list URLs of the trackers to announce to. All the HTTP and UDP trackers if
+	// empty.
+	Trackers []string
+	// The event to send. If it's tracker.None, trackers that haven't been sent the started event
+	// are sent it.
+	Event tracker.AnnounceEvent
+	// How many peers to ask for. If zero, as many as regular announces do.
+	NumWant int32
+	// Announce even to trackers that were announced to within their min interval.
+	IgnoreMinInterval bool
+}
+
+// The result of announcing to a tracker with Torrent.Announce.
+type TrackerAnnounce struct {
+	Url         string
+	Event       tracker.AnnounceEvent
+	NumPeers    int
+	Interval    time.Duration
+	MinInterval time.Duration
+	Err         error
+}
+
+// An announce by Torrent.Announce in progress, that others with the same event and numwant wait on
+// rather than making their own.
+type manualAnnounce struct {
+	event   tracker.AnnounceEvent
+	numWant int32
+	done    chan struct{}
+	result  trackerAnnounceResult
+}
+
+// Announces to the torrent's HTTP and UDP trackers now, regardless of their intervals, returning
+// the results sorted by URL. Peers received are added to the torrent. Concurrent calls share
+// announces to the same tracker with the same event and numwant. The results are recorded as for
+// regular announces, which are scheduled from them.
+func (t *Torrent) Announce(ctx context.Context, opts AnnounceOpts) (ret []TrackerAnnounce) {
+	t.cl.lock()
+	var scrapers []*trackerScraper
+	if t.trackerTiers != nil {
+		for _, tier := range t.trackerTiers.tiers {
+			for _, e := range tier {
+				for _, ts := range e.scrapers {
+					if len(opts.Trackers) == 0 || containsString(opts.Trackers, e.url) {
+						scrapers = append(scrapers, ts)
+					}
+				}
+			}
+		}
+	}
+	t.cl.unlock()
+	ret = make([]TrackerAnnounce, len(scrapers))
+	var wg sync.WaitGroup
+	for i, ts := range scrapers {
+		wg.Add(1)
+		go func(i int, ts *trackerScraper) {
+			defer wg.Done()
+			ret[i] = ts.manualAnnounce(ctx, opts)
+		}(i, ts)
+	}
+	wg.Wait()
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Url < ret[j].Url
+	})
+	if len(scrapers) != 0 {
+		select {
+		case t.trackerTiers.changed <- struct{}{}:
+		default:
+		}
+	}
+	return
+}
+
+func (me *trackerScraper) manualAnnounce(ctx context.Context, opts AnnounceOpts) TrackerAnnounce {
+	cl := me.t.cl
+	cl.lock()
+	event := opts.Event
+	if event == tracker.None && !me.started {
+		event = tracker.Started
+	}
+	ta := TrackerAnnounce{Url: me.u.String(), Event: event}
+	if ar := me.lastAnnounce; !opts.IgnoreMinInterval && me.working() &&
+		time.Since(ar.Completed) < ar.MinInterval {
+		cl.unlock()
+		ta.Err = ErrAnnounceTooSoon
+		return ta
+	}
+	m := me.manual
+	if m == nil || m.event != event || m.numWant != opts.NumWant {
+		m = &manualAnnounce{event: event, numWant: opts.NumWant, done: make(chan struct{})}
+		me.manual = m
+		go func() {
+			// Callers can give up waiting, but the announce is shared, so it only stops if the
+			// torrent closes.
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go func() {
+				select {
+				case <-me.t.Closed():
+					cancel()
+				case <-ctx.Done():
+				}
+			}()
+			ar := me.announce(ctx, event, opts.NumWant)
+			cl.lock()
+			defer cl.unlock()
+			me.recordAnnounce(event, ar)
+			if me.manual == m {
+				me.manual = nil
+			}
+			m.result = ar
+			close(m.done)
+		}()
+	}
+	cl.unlock()
+	select {
+	case <-m.done:
+	case <-ctx.Done():
+		ta.Err = ctx.Err()
+		return ta
+	}
+	ar := m.result
+	ta.NumPeers = ar.NumPeers
+	ta.Interval = ar.Interval
+	ta.MinInterval = ar.MinInterval
+	ta.Err = ar.Err
+	return ta
+}
+
+// The result of sending the stopped event to one of a torrent's trackers with Client.Shutdown.
+type ShutdownAnnounce struct {
+	InfoHash metainfo.Hash
+	TrackerAnnounce
+}
+
+// Returns the trackers that have been sent the started event, and marks them as stopped so they
+// aren't sent the stopped event again when the torrent closes. Call with the client lock held.
+func (t *Torrent) takeStartedTrackerScrapers() (ret []*trackerScraper) {
+	if t.trackerTiers == nil {
+		return
+	}
+	for _, tier := range t.trackerTiers.tiers {
+		for _, e := range tier {
+			for _, ts := range e.scrapers {
+				if ts.started {
+					ts.started = false
+					ret = append(ret, ts)
+				}
+			}
+		}
+	}
+	return
+}
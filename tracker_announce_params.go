@@ -0,0 +1,34 @@
+package torrent
+
+import (
+	"time"
+)
+
+// Parameters for announcing to HTTP and UDP trackers. The zero value is the default behaviour.
+type TrackerAnnounceParams struct {
+	// How many peers to ask for while peers are wanted. If zero, it's left to the tracker. Zero is
+	// asked for when peers aren't wanted, such as when seeding, and with the stopped event.
+	NumWant int32
+	// These change the parameters sent to HTTP trackers, from compact=1 and supportcrypto=1, and
+	// not sending no_peer_id. See the fields of the same names in tracker.Announce.
+	NoCompact       bool
+	NoPeerId        bool
+	NoSupportCrypto bool
+	// The least interval between announces once the torrent's data is complete, so that seeding
+	// torrents can announce less often than trackers ask. Torrents still downloading may announce
+	// as often as the trackers' min intervals allow.
+	MinSeedingInterval time.Duration
+}
+
+// The announce parameters for the torrent, from its TorrentSpec or the client's config.
+func (t *Torrent) trackerAnnounceParams() *TrackerAnnounceParams {
+	if t.announceParams != nil {
+		return t.announceParams
+	}
+	return &t.cl.config.TrackerAnnounceParams
+}
+
+// Whether the torrent has all the data it wants, and is only announcing to seed.
+func (t *Torrent) announcingToSeed() bool {
+	return t.haveInfo() && !t.needData()
+}
@@ -0,0 +1,316 @@
+package torrent
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/frankban/quicktest"
+
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/internal/testutil"
+	"github.com/anacrolix/torrent/tracker"
+)
+
+func TestTorrentAnnounce(t *testing.T) {
+	c := quicktest.New(t)
+	var mu sync.Mutex
+	var queries []url.Values
+	// Announces with the completed event block until this is closed.
+	release := make(chan struct{})
+	entered := make(chan struct{}, 10)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		queries = append(queries, r.URL.Query())
+		mu.Unlock()
+		if r.URL.Query().Get("event") == "completed" {
+			entered <- struct{}{}
+			<-release
+		}
+		w.Write(bencode.MustMarshal(map[string]interface{}{
+			"interval":     1800,
+			"min interval": 60,
+			"peers":        "",
+		}))
+	}))
+	defer s.Close()
+	numQueries := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(queries)
+	}
+
+	cfg := TestingConfig(t)
+	cfg.DisableTrackers = false
+	cl, err := NewClient(cfg)
+	c.Assert(err, quicktest.IsNil)
+	defer cl.Close()
+	mi := testutil.GreetingMetaInfo()
+	trackerUrl := s.URL + "/announce"
+	mi.Announce = trackerUrl
+	tt, err := cl.AddTorrent(mi)
+	c.Assert(err, quicktest.IsNil)
+	waitActiveTracker(c, tt)
+	c.Assert(numQueries(), quicktest.Equals, 1)
+	ctx := context.Background()
+
+	// The min interval is respected unless it's overridden.
+	res := tt.Announce(ctx, AnnounceOpts{})
+	c.Assert(res, quicktest.HasLen, 1)
+	c.Check(res[0].Url, quicktest.Equals, trackerUrl)
+	c.Check(res[0].Err, quicktest.Equals, ErrAnnounceTooSoon)
+	c.Check(numQueries(), quicktest.Equals, 1)
+	res = tt.Announce(ctx, AnnounceOpts{Trackers: []string{trackerUrl}, IgnoreMinInterval: true, NumWant: 7})
+	c.Assert(res, quicktest.HasLen, 1)
+	c.Check(res[0].Err, quicktest.IsNil)
+	c.Check(res[0].Event, quicktest.Equals, tracker.None)
+	c.Check(res[0].Interval, quicktest.Equals, 30*time.Minute)
+	c.Assert(numQueries(), quicktest.Equals, 2)
+	mu.Lock()
+	c.Check(queries[1].Get("numwant"), quicktest.Equals, "7")
+	c.Check(queries[1].Get("event"), quicktest.Equals, "")
+	mu.Unlock()
+	c.Check(tt.Announce(ctx, AnnounceOpts{Trackers: []string{"http://other/announce"}}), quicktest.HasLen, 0)
+
+	// Concurrent announces are shared.
+	var wg sync.WaitGroup
+	results := make([][]TrackerAnnounce, 3)
+	announce := func(i int) {
+		defer wg.Done()
+		results[i] = tt.Announce(ctx, AnnounceOpts{Event: tracker.Completed, IgnoreMinInterval: true})
+	}
+	wg.Add(1)
+	go announce(0)
+	<-entered
+	wg.Add(2)
+	go announce(1)
+	go announce(2)
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	c.Check(numQueries(), quicktest.Equals, 3)
+	for _, res := range results {
+		c.Assert(res, quicktest.HasLen, 1)
+		c.Check(res[0].Err, quicktest.IsNil)
+		c.Check(res[0].Event, quicktest.Equals, tracker.Completed)
+	}
+}
+
+func TestClientShutdown(t *testing.T) {
+	c := quicktest.New(t)
+	stopped := make(chan url.Values, 1)
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("event") == "stopped" {
+			stopped <- r.URL.Query()
+		}
+		w.Write(bencode.MustMarshal(map[string]interface{}{"interval": 1800, "peers": ""}))
+	}))
+	defer fast.Close()
+	// Never answers the stopped event.
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("event") == "stopped" {
+			<-release
+		}
+		w.Write(bencode.MustMarshal(map[string]interface{}{"interval": 1800, "peers": ""}))
+	}))
+	defer slow.Close()
+	defer close(release)
+
+	cfg := TestingConfig(t)
+	cfg.DisableTrackers = false
+	cl, err := NewClient(cfg)
+	c.Assert(err, quicktest.IsNil)
+	mi := testutil.GreetingMetaInfo()
+	fastUrl := fast.URL + "/announce"
+	slowUrl := slow.URL + "/announce"
+	mi.AnnounceList = [][]string{{fastUrl}, {slowUrl}}
+	tt, err := cl.AddTorrent(mi)
+	c.Assert(err, quicktest.IsNil)
+	tt.DownloadAll()
+	waitActiveTracker(c, tt)
+	// The fallback tier isn't announced to while the first works, so start it by hand.
+	c.Assert(tt.Announce(context.Background(), AnnounceOpts{Trackers: []string{slowUrl}})[0].Err, quicktest.IsNil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	var progress []ShutdownAnnounce
+	res := cl.Shutdown(ctx, func(sa ShutdownAnnounce) {
+		progress = append(progress, sa)
+	})
+	<-cl.Closed()
+	c.Assert(res, quicktest.HasLen, 2)
+	if res[0].Url != fastUrl {
+		res[0], res[1] = res[1], res[0]
+	}
+	c.Check(res[0].Url, quicktest.Equals, fastUrl)
+	c.Check(res[0].InfoHash, quicktest.Equals, tt.InfoHash())
+	c.Check(res[0].Event, quicktest.Equals, tracker.Stopped)
+	c.Check(res[0].Err, quicktest.IsNil)
+	c.Check(res[1].Url, quicktest.Equals, slowUrl)
+	c.Check(res[1].Err, quicktest.Equals, context.DeadlineExceeded)
+	c.Check(progress, quicktest.DeepEquals, res[:1])
+	q := <-stopped
+	c.Check(q.Get("left"), quicktest.Equals, strconv.Itoa(len(testutil.GreetingFileContents)))
+	c.Check(q.Get("uploaded"), quicktest.Equals, "0")
+	// The torrent's closing doesn't send the stopped event again.
+	select {
+	case q := <-stopped:
+		c.Errorf("stopped event sent again: %v", q)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestTrackerAnnounceCountersCarriedOver(t *testing.T) {
+	c := quicktest.New(t)
+	queries := make(chan url.Values, 10)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries <- r.URL.Query()
+		w.Write(bencode.MustMarshal(map[string]interface{}{"interval": 1800, "peers": ""}))
+	}))
+	defer s.Close()
+	mi := testutil.GreetingMetaInfo()
+	mi.Announce = s.URL + "/announce"
+	greetingLen := strconv.Itoa(len(testutil.GreetingFileContents))
+
+	// Adds the torrent to a new client, carrying over the stats, and checks the first announce.
+	session := func(stats TorrentStats, left string) (*Client, *Torrent) {
+		cfg := TestingConfig(t)
+		cfg.DisableTrackers = false
+		cl, err := NewClient(cfg)
+		c.Assert(err, quicktest.IsNil)
+		spec := TorrentSpecFromMetaInfo(mi)
+		spec.Uploaded = stats.Uploaded
+		spec.Downloaded = stats.Downloaded
+		tt, _, err := cl.AddTorrentSpec(spec)
+		c.Assert(err, quicktest.IsNil)
+		q := <-queries
+		c.Check(q.Get("event"), quicktest.Equals, "started")
+		c.Check(q.Get("uploaded"), quicktest.Equals, strconv.FormatInt(stats.Uploaded, 10))
+		c.Check(q.Get("downloaded"), quicktest.Equals, strconv.FormatInt(stats.Downloaded, 10))
+		c.Check(q.Get("left"), quicktest.Equals, left)
+		return cl, tt
+	}
+
+	cl, tt := session(TorrentStats{Uploaded: 1000, Downloaded: 500}, "0")
+	stats := tt.Stats()
+	c.Check(stats.Uploaded, quicktest.Equals, int64(1000))
+	c.Check(stats.Downloaded, quicktest.Equals, int64(500))
+	// Only what's wanted is left.
+	tt.DownloadAll()
+	c.Assert(tt.Announce(context.Background(), AnnounceOpts{IgnoreMinInterval: true})[0].Err, quicktest.IsNil)
+	c.Check((<-queries).Get("left"), quicktest.Equals, greetingLen)
+	cl.Close()
+	c.Check((<-queries).Get("event"), quicktest.Equals, "stopped")
+
+	// The restarted session continues from the saved stats.
+	cl, _ = session(stats, "0")
+	cl.Close()
+}
+
+// Wanted pieces that are being checked are still left.
+func TestBytesLeftAnnounceWhileChecking(t *testing.T) {
+	c := quicktest.New(t)
+	cl, err := NewClient(TestingConfig(t))
+	c.Assert(err, quicktest.IsNil)
+	defer cl.Close()
+	tt, err := cl.AddTorrent(testutil.GreetingMetaInfo())
+	c.Assert(err, quicktest.IsNil)
+	tt.DownloadAll()
+	cl.lock()
+	defer cl.unlock()
+	tt.queuePieceCheck(0)
+	c.Check(tt.piecePriority(0), quicktest.Equals, PiecePriorityNone)
+	c.Check(tt.bytesLeftAnnounce(), quicktest.Equals, tt.info.TotalLength())
+}
+
+func TestTrackerAnnounceParams(t *testing.T) {
+	c := quicktest.New(t)
+	queries := make(chan url.Values, 10)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries <- r.URL.Query()
+		w.Write(bencode.MustMarshal(map[string]interface{}{"interval": 60, "peers": ""}))
+	}))
+	defer s.Close()
+	cfg := TestingConfig(t)
+	cfg.DisableTrackers = false
+	cfg.TrackerAnnounceParams = TrackerAnnounceParams{NoPeerId: true}
+	cl, err := NewClient(cfg)
+	c.Assert(err, quicktest.IsNil)
+	defer cl.Close()
+	mi := testutil.GreetingMetaInfo()
+	mi.Announce = s.URL + "/announce"
+
+	// The client's defaults. No peers are wanted until there are pieces wanted.
+	tt, err := cl.AddTorrent(mi)
+	c.Assert(err, quicktest.IsNil)
+	q := <-queries
+	c.Check(q.Get("numwant"), quicktest.Equals, "0")
+	c.Check(q.Get("no_peer_id"), quicktest.Equals, "1")
+	c.Check(q.Get("compact"), quicktest.Equals, "1")
+	c.Check(q.Get("supportcrypto"), quicktest.Equals, "1")
+	tt.DownloadAll()
+	c.Assert(tt.Announce(context.Background(), AnnounceOpts{IgnoreMinInterval: true})[0].Err, quicktest.IsNil)
+	_, ok := (<-queries)["numwant"]
+	c.Check(ok, quicktest.IsFalse)
+	tt.Drop()
+	q = <-queries
+	c.Check(q.Get("event"), quicktest.Equals, "stopped")
+	c.Check(q.Get("numwant"), quicktest.Equals, "0")
+
+	// Overridden for the torrent.
+	spec := TorrentSpecFromMetaInfo(mi)
+	spec.TrackerAnnounceParams = &TrackerAnnounceParams{
+		NumWant:         20,
+		NoCompact:       true,
+		NoSupportCrypto: true,
+	}
+	tt, _, err = cl.AddTorrentSpec(spec)
+	c.Assert(err, quicktest.IsNil)
+	q = <-queries
+	c.Check(q.Get("no_peer_id"), quicktest.Equals, "")
+	c.Check(q.Get("compact"), quicktest.Equals, "")
+	c.Check(q.Get("supportcrypto"), quicktest.Equals, "")
+	tt.DownloadAll()
+	c.Assert(tt.Announce(context.Background(), AnnounceOpts{IgnoreMinInterval: true})[0].Err, quicktest.IsNil)
+	c.Check((<-queries).Get("numwant"), quicktest.Equals, "20")
+}
+
+func TestTrackerAnnounceParamsSeeding(t *testing.T) {
+	c := quicktest.New(t)
+	queries := make(chan url.Values, 10)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries <- r.URL.Query()
+		w.Write(bencode.MustMarshal(map[string]interface{}{"interval": 60, "peers": ""}))
+	}))
+	defer s.Close()
+	dir, mi := testutil.GreetingTestTorrent()
+	defer os.RemoveAll(dir)
+	mi.Announce = s.URL + "/announce"
+	cfg := TestingConfig(t)
+	cfg.DisableTrackers = false
+	cfg.DataDir = dir
+	cfg.TrackerAnnounceParams = TrackerAnnounceParams{NumWant: 20, MinSeedingInterval: time.Hour}
+	cl, err := NewClient(cfg)
+	c.Assert(err, quicktest.IsNil)
+	defer cl.Close()
+	tt, err := cl.AddTorrent(mi)
+	c.Assert(err, quicktest.IsNil)
+	<-queries
+	tt.DownloadAll()
+	tt.VerifyData()
+	c.Assert(tt.BytesMissing(), quicktest.Equals, int64(0))
+
+	// Seeding asks for no peers, and waits at least the min seeding interval.
+	ta := tt.Announce(context.Background(), AnnounceOpts{IgnoreMinInterval: true})
+	c.Assert(ta[0].Err, quicktest.IsNil)
+	c.Check((<-queries).Get("numwant"), quicktest.Equals, "0")
+	status := tt.AnnounceStatus()[0]
+	c.Check(status.NextAnnounce, quicktest.Equals, status.LastAnnounce.Add(time.Hour))
+}
@@ -0,0 +1,67 @@
+package torrent
+
+import (
+	"math/rand"
+	"time"
+)
+
+const (
+	minAnnounceBackoff = time.Minute
+	maxAnnounceBackoff = time.Hour
+	// The fraction each backoff is varied by at random, so that trackers aren't retried in step.
+	announceBackoffJitter = 0.2
+)
+
+// Tracks the failed announces to a tracker, and when it can be tried again. Failures back off
+// exponentially, and enough of them in a row disables the tracker.
+type announceBackoff struct {
+	// Consecutive failures that disable the tracker. Zero for no limit.
+	maxFailures int
+	// Returns a number in [0, 1) to jitter backoffs with. rand.Float64 if nil.
+	rand func() float64
+
+	consecutiveFailures int
+	lastErr             error
+	retryAt             time.Time
+}
+
+// The backoff after the given number of failures in a row, before jitter: 1m, 2m, 4m, and so on,
+// to an hour.
+func announceBackoffDelay(consecutiveFailures int) time.Duration {
+	d := minAnnounceBackoff
+	for i := 1; i < consecutiveFailures && d < maxAnnounceBackoff; i++ {
+		d *= 2
+	}
+	if d > maxAnnounceBackoff {
+		d = maxAnnounceBackoff
+	}
+	return d
+}
+
+func (me *announceBackoff) failed(now time.Time, err error) {
+	me.consecutiveFailures++
+	me.lastErr = err
+	r := rand.Float64
+	if me.rand != nil {
+		r = me.rand
+	}
+	d := float64(announceBackoffDelay(me.consecutiveFailures))
+	d *= 1 - announceBackoffJitter + 2*announceBackoffJitter*r()
+	me.retryAt = now.Add(time.Duration(d))
+}
+
+func (me *announceBackoff) succeeded() {
+	me.consecutiveFailures = 0
+	me.lastErr = nil
+	me.retryAt = time.Time{}
+}
+
+// Whether the tracker isn't to be announced to again. lastErr has why.
+func (me *announceBackoff) disabled() bool {
+	return me.maxFailures > 0 && me.consecutiveFailures >= me.maxFailures
+}
+
+// Whether an announce can be tried at the time.
+func (me *announceBackoff) ready(now time.Time) bool {
+	return !me.disabled() && !now.Before(me.retryAt)
+}
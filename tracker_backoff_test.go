@@ -0,0 +1,72 @@
+package torrent
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/frankban/quicktest"
+)
+
+func TestAnnounceBackoffDelay(t *testing.T) {
+	c := quicktest.New(t)
+	for failures, expected := range []time.Duration{
+		time.Minute, time.Minute, 2 * time.Minute, 4 * time.Minute, 8 * time.Minute, 16 * time.Minute,
+		32 * time.Minute, time.Hour, time.Hour,
+	} {
+		c.Check(announceBackoffDelay(failures), quicktest.Equals, expected, quicktest.Commentf("%d", failures))
+	}
+	c.Check(announceBackoffDelay(1000), quicktest.Equals, time.Hour)
+}
+
+func TestAnnounceBackoffJitter(t *testing.T) {
+	c := quicktest.New(t)
+	now := time.Unix(1e9, 0)
+	for _, r := range []struct {
+		rand     float64
+		expected time.Duration
+	}{
+		{0, 48 * time.Second},
+		{0.5, time.Minute},
+		{0.999999, 72 * time.Second},
+	} {
+		b := announceBackoff{rand: func() float64 { return r.rand }}
+		b.failed(now, errors.New("dns"))
+		c.Check(b.retryAt.Sub(now).Round(time.Second), quicktest.Equals, r.expected)
+	}
+}
+
+func TestAnnounceBackoffStates(t *testing.T) {
+	c := quicktest.New(t)
+	now := time.Unix(1e9, 0)
+	b := announceBackoff{maxFailures: 3, rand: func() float64 { return 0.5 }}
+	c.Check(b.ready(now), quicktest.IsTrue)
+	b.failed(now, errors.New("first"))
+	c.Check(b.ready(now), quicktest.IsFalse)
+	c.Check(b.ready(now.Add(time.Minute)), quicktest.IsTrue)
+	now = now.Add(time.Minute)
+	b.failed(now, errors.New("second"))
+	c.Check(b.retryAt, quicktest.Equals, now.Add(2*time.Minute))
+
+	// Success resets the backoff.
+	b.succeeded()
+	c.Check(b.consecutiveFailures, quicktest.Equals, 0)
+	c.Check(b.lastErr, quicktest.IsNil)
+	c.Check(b.ready(now), quicktest.IsTrue)
+
+	for i := 0; i < 3; i++ {
+		c.Check(b.disabled(), quicktest.IsFalse)
+		b.failed(now, errors.New("down"))
+	}
+	c.Check(b.disabled(), quicktest.IsTrue)
+	c.Check(b.ready(now.Add(24*time.Hour)), quicktest.IsFalse)
+	c.Check(b.lastErr, quicktest.ErrorMatches, "down")
+
+	// No limit.
+	b = announceBackoff{}
+	for i := 0; i < 100; i++ {
+		b.failed(now, errors.New("down"))
+	}
+	c.Check(b.disabled(), quicktest.IsFalse)
+	c.Check(b.retryAt.Sub(now) <= 72*time.Minute, quicktest.IsTrue)
+}
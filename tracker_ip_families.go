@@ -0,0 +1,74 @@
+package torrent
+
+import (
+	"net"
+	"net/url"
+)
+
+// The address families a tracker is announced to over. BEP 7 has clients announce over both IPv4
+// and IPv6, so that they're in the tracker's peer lists for each.
+type TrackerIpFamilies int
+
+const (
+	// Announce over each of IPv4 and IPv6 that the tracker has an address for.
+	TrackerIpFamiliesAll TrackerIpFamilies = iota
+	// Announce over IPv4 if the tracker has an IPv4 address, and otherwise over IPv6.
+	TrackerIpFamiliesPrefer4
+	// Announce over IPv6 if the tracker has an IPv6 address, and otherwise over IPv4.
+	TrackerIpFamiliesPrefer6
+	// Announce over IPv4 only.
+	TrackerIpFamiliesOnly4
+	// Announce over IPv6 only.
+	TrackerIpFamiliesOnly6
+)
+
+func (cl *Client) trackerIpFamilies(u *url.URL) TrackerIpFamilies {
+	if cl.config.TrackerIpFamilies == nil {
+		return TrackerIpFamiliesAll
+	}
+	return cl.config.TrackerIpFamilies(u)
+}
+
+// Returns the tracker addresses to announce to, given the first acceptable of each family, either of
+// which may be nil.
+func chooseTrackerIps(ip4, ip6 net.IP, families TrackerIpFamilies) (ret []net.IP) {
+	add := func(ip net.IP) {
+		if ip != nil {
+			ret = append(ret, ip)
+		}
+	}
+	switch families {
+	case TrackerIpFamiliesOnly4:
+		add(ip4)
+	case TrackerIpFamiliesOnly6:
+		add(ip6)
+	case TrackerIpFamiliesPrefer4:
+		if ip4 == nil {
+			add(ip6)
+		}
+		add(ip4)
+	case TrackerIpFamiliesPrefer6:
+		if ip6 == nil {
+			add(ip4)
+		}
+		add(ip6)
+	default:
+		add(ip4)
+		add(ip6)
+	}
+	return
+}
+
+// Returns the local address to announce to ip from, if the client listens on a specific one of its
+// family.
+func (cl *Client) trackerLocalIp(ip net.IP) net.IP {
+	network := "tcp6"
+	if ip.To4() != nil {
+		network = "tcp4"
+	}
+	local := net.ParseIP(cl.config.ListenHost(network))
+	if local == nil || local.IsUnspecified() || (local.To4() != nil) != (ip.To4() != nil) {
+		return nil
+	}
+	return local
+}
@@ -0,0 +1,76 @@
+package torrent
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+
+	"github.com/anacrolix/dht/v2/krpc"
+	"github.com/frankban/quicktest"
+
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/internal/testutil"
+)
+
+func TestChooseTrackerIps(t *testing.T) {
+	c := quicktest.New(t)
+	ip4 := net.ParseIP("1.2.3.4")
+	ip6 := net.ParseIP("2001:db8::1")
+	for _, _case := range []struct {
+		ip4, ip6 net.IP
+		families TrackerIpFamilies
+		expected []net.IP
+	}{
+		{ip4, ip6, TrackerIpFamiliesAll, []net.IP{ip4, ip6}},
+		{nil, ip6, TrackerIpFamiliesAll, []net.IP{ip6}},
+		{ip4, ip6, TrackerIpFamiliesPrefer4, []net.IP{ip4}},
+		{nil, ip6, TrackerIpFamiliesPrefer4, []net.IP{ip6}},
+		{ip4, ip6, TrackerIpFamiliesPrefer6, []net.IP{ip6}},
+		{ip4, nil, TrackerIpFamiliesPrefer6, []net.IP{ip4}},
+		{ip4, ip6, TrackerIpFamiliesOnly4, []net.IP{ip4}},
+		{nil, ip6, TrackerIpFamiliesOnly4, nil},
+		{ip4, ip6, TrackerIpFamiliesOnly6, []net.IP{ip6}},
+		{ip4, nil, TrackerIpFamiliesOnly6, nil},
+	} {
+		c.Check(chooseTrackerIps(_case.ip4, _case.ip6, _case.families), quicktest.DeepEquals, _case.expected,
+			quicktest.Commentf("%v", _case))
+	}
+}
+
+// A tracker returning both IPv4 and IPv6 peers has both added to the swarm.
+func TestTrackerPeersAndPeers6(t *testing.T) {
+	c := quicktest.New(t)
+	peers := krpc.CompactIPv4NodeAddrs{{IP: net.ParseIP("1.2.3.4").To4(), Port: 1234}}
+	peers6 := krpc.CompactIPv6NodeAddrs{{IP: net.ParseIP("2001:db8::1"), Port: 5678}}
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(bencode.MustMarshal(map[string]interface{}{
+			"interval": 1800,
+			"peers":    peers,
+			"peers6":   peers6,
+		}))
+	}))
+	defer s.Close()
+
+	cfg := TestingConfig(t)
+	cfg.DisableTrackers = false
+	// Nothing to connect to the peers with, so they stay in the swarm.
+	cfg.DisableTCP = true
+	cfg.DisableUTP = true
+	cl, err := NewClient(cfg)
+	c.Assert(err, quicktest.IsNil)
+	defer cl.Close()
+	mi := testutil.GreetingMetaInfo()
+	mi.Announce = s.URL + "/announce"
+	tt, err := cl.AddTorrent(mi)
+	c.Assert(err, quicktest.IsNil)
+	status := waitActiveTracker(c, tt)
+	c.Check(status[0].NumPeers, quicktest.Equals, 2)
+	var addrs []string
+	for _, p := range tt.KnownSwarm() {
+		addrs = append(addrs, p.Addr.String())
+	}
+	sort.Strings(addrs)
+	c.Check(addrs, quicktest.DeepEquals, []string{"1.2.3.4:1234", "[2001:db8::1]:5678"})
+}
@@ -6,7 +6,9 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"net/http"
 	"net/url"
+	"sync"
 	"time"
 
 	"github.com/anacrolix/dht/v2/krpc"
@@ -15,12 +17,17 @@ import (
 	"github.com/anacrolix/torrent/tracker"
 )
 
-// Announces a torrent to a tracker at regular intervals, when peers are
-// required.
+// Announces a torrent to a tracker. When, and to which trackers, is up to the Torrent's
+// trackerTiers.
 type trackerScraper struct {
 	u            url.URL
 	t            *Torrent
 	lastAnnounce trackerAnnounceResult
+	backoff      announceBackoff
+	// Whether the tracker has been sent the started event, and not yet the stopped event.
+	started bool
+	// The announce made by Torrent.Announce that's in progress, if any.
+	manual *manualAnnounce
 }
 
 type torrentTrackerAnnouncer interface {
@@ -36,7 +43,7 @@ func (ts *trackerScraper) statusLine() string {
 	var w bytes.Buffer
 	fmt.Fprintf(&w, "next ann: %v, last ann: %v",
 		func() string {
-			na := time.Until(ts.lastAnnounce.Completed.Add(ts.lastAnnounce.Interval))
+			na := time.Until(ts.nextAnnounce(false))
 			if na > 0 {
 				na /= time.Second
 				na *= time.Second
@@ -46,8 +53,11 @@ func (ts *trackerScraper) statusLine() string {
 			}
 		}(),
 		func() string {
+			if ts.backoff.disabled() {
+				return fmt.Sprintf("disabled after %d failures: %v", ts.backoff.consecutiveFailures, ts.backoff.lastErr)
+			}
 			if ts.lastAnnounce.Err != nil {
-				return ts.lastAnnounce.Err.Error()
+				return fmt.Sprintf("%v (%d failures)", ts.lastAnnounce.Err, ts.backoff.consecutiveFailures)
 			}
 			if ts.lastAnnounce.Completed.IsZero() {
 				return "never"
@@ -59,13 +69,63 @@ func (ts *trackerScraper) statusLine() string {
 }
 
 type trackerAnnounceResult struct {
-	Err       error
-	NumPeers  int
-	Interval  time.Duration
-	Completed time.Time
+	Err         error
+	NumPeers    int
+	Interval    time.Duration
+	MinInterval time.Duration
+	Completed   time.Time
+	// Our IPs as the tracker saw them, if it said.
+	ExternalIps []net.IP
+	// The tracker's warning, if the announce succeeded with one.
+	WarningMessage string
+}
+
+// The failure reason given by the tracker, if that's why the announce failed.
+func (me trackerAnnounceResult) failureReason() string {
+	var failure tracker.ErrTrackerFailure
+	if errors.As(me.Err, &failure) {
+		return failure.Reason
+	}
+	return ""
+}
+
+// Whether the last announce succeeded.
+func (me *trackerScraper) working() bool {
+	return !me.lastAnnounce.Completed.IsZero() && me.lastAnnounce.Err == nil
 }
 
-func (me *trackerScraper) getIp() (ip net.IP, err error) {
+// The earliest the tracker should be announced to again. Failures back off, and successes wait for
+// the interval, or if wantPeers, the min interval where that's allowed. Call with the client lock
+// held.
+func (me *trackerScraper) nextAnnounce(wantPeers bool) time.Time {
+	ar := &me.lastAnnounce
+	if ar.Completed.IsZero() {
+		return time.Time{}
+	}
+	if ar.Err != nil {
+		return me.backoff.retryAt
+	}
+	// Make sure we don't announce for at least a minute since the last one.
+	interval := ar.Interval
+	if wantPeers && me.t.canIgnoreTrackerInterval() {
+		interval = ar.MinInterval
+	}
+	if min := me.t.trackerAnnounceParams().MinSeedingInterval; me.t.announcingToSeed() && interval < min {
+		interval = min
+	}
+	if interval < time.Minute {
+		interval = time.Minute
+	}
+	return ar.Completed.Add(interval)
+}
+
+// Whether the tracker can be announced to at the time. Call with the client lock held.
+func (me *trackerScraper) canAnnounce(now time.Time, wantPeers bool) bool {
+	return !me.backoff.disabled() && !now.Before(me.nextAnnounce(wantPeers))
+}
+
+// Returns the tracker addresses to announce to, at most one for each address family.
+func (me *trackerScraper) getIps() (ret []net.IP, err error) {
 	ips, err := net.LookupIP(me.u.Hostname())
 	if err != nil {
 		return
@@ -74,37 +134,73 @@ func (me *trackerScraper) getIp() (ip net.IP, err error) {
 		err = errors.New("no ips")
 		return
 	}
-	for _, ip = range ips {
+	cfg := me.t.cl.config
+	var ip4, ip6 net.IP
+	for _, ip := range ips {
 		if me.t.cl.ipIsBlocked(ip) {
 			continue
 		}
-		switch me.u.Scheme {
-		case "udp4":
-			if ip.To4() == nil {
-				continue
-			}
-		case "udp6":
-			if ip.To4() != nil {
-				continue
+		if ip.To4() != nil {
+			if ip4 == nil && me.u.Scheme != "udp6" && !cfg.DisableIPv4 {
+				ip4 = ip
 			}
+		} else if ip6 == nil && me.u.Scheme != "udp4" && !cfg.DisableIPv6 {
+			ip6 = ip
 		}
-		return
 	}
-	err = errors.New("no acceptable ips")
+	ret = chooseTrackerIps(ip4, ip6, me.t.cl.trackerIpFamilies(&me.u))
+	if len(ret) == 0 {
+		err = errors.New("no acceptable ips")
+	}
 	return
 }
 
+// Returns the tracker URL with its host replaced by ip, so that the announce goes over ip's address
+// family.
 func (me *trackerScraper) trackerUrl(ip net.IP) string {
 	u := me.u
-	if u.Port() != "" {
-		u.Host = net.JoinHostPort(ip.String(), u.Port())
+	port := u.Port()
+	if port == "" {
+		switch u.Scheme {
+		case "http":
+			port = "80"
+		case "https":
+			port = "443"
+		default:
+			return u.String()
+		}
 	}
+	u.Host = net.JoinHostPort(ip.String(), port)
 	return u.String()
 }
 
+// Returns the HTTP client and headers configured for the tracker, if it's an HTTP tracker.
+func (me *trackerScraper) httpClientAndHeader() (client *http.Client, header http.Header) {
+	if me.u.Scheme != "http" && me.u.Scheme != "https" {
+		return
+	}
+	cfg := me.t.cl.config
+	if cfg.TrackerHTTPClientForURL != nil {
+		client = cfg.TrackerHTTPClientForURL(&me.u)
+	}
+	if cfg.TrackerHTTPHeaderForURL != nil {
+		header = cfg.TrackerHTTPHeaderForURL(&me.u)
+	}
+	return
+}
+
+// The UDP network to announce to ip over. Ignored for other trackers.
+func trackerUdpNetwork(ip net.IP) string {
+	if ip.To4() != nil {
+		return "udp4"
+	}
+	return "udp6"
+}
+
 // Return how long to wait before trying again. For most errors, we return 5
-// minutes, a relatively quick turn around for DNS changes.
-func (me *trackerScraper) announce(ctx context.Context, event tracker.AnnounceEvent) (ret trackerAnnounceResult) {
+// minutes, a relatively quick turn around for DNS changes. If numWant isn't zero, it replaces that
+// of the Torrent's announce request.
+func (me *trackerScraper) announce(ctx context.Context, event tracker.AnnounceEvent, numWant int32) (ret trackerAnnounceResult) {
 
 	defer func() {
 		ret.Completed = time.Now()
@@ -128,13 +224,27 @@ func (me *trackerScraper) announce(ctx context.Context, event tracker.AnnounceEv
 		}
 	}()
 
-	ip, err := me.getIp()
-	if err != nil {
-		ret.Err = fmt.Errorf("error getting ip: %s", err)
-		return
+	httpClient, httpHeader := me.httpClientAndHeader()
+	var ips []net.IP
+	if httpClient != nil {
+		// The client's transport decides how to connect, so the URL is left as it is.
+		ips = []net.IP{nil}
+	} else {
+		var err error
+		ips, err = me.getIps()
+		if err != nil {
+			ret.Err = fmt.Errorf("error getting ip: %s", err)
+			return
+		}
 	}
 	me.t.cl.rLock()
 	req := me.t.announceRequest(event)
+	if numWant != 0 {
+		req.NumWant = numWant
+	}
+	params := *me.t.trackerAnnounceParams()
+	clientIp4 := me.t.cl.knownPublicIp(true)
+	clientIp6 := me.t.cl.knownPublicIp(false)
 	me.t.cl.rUnlock()
 	// The default timeout works well as backpressure on concurrent access to the tracker. Since
 	// we're passing our own Context now, we will include that timeout ourselves to maintain similar
@@ -142,110 +252,137 @@ func (me *trackerScraper) announce(ctx context.Context, event tracker.AnnounceEv
 	// closed.
 	ctx, cancel := context.WithTimeout(ctx, tracker.DefaultTrackerAnnounceTimeout)
 	defer cancel()
-	me.t.logger.WithDefaultLevel(log.Debug).Printf("announcing to %q: %#v", me.u.String(), req)
-	res, err := tracker.Announce{
-		Context:    ctx,
-		HTTPProxy:  me.t.cl.config.HTTPProxy,
-		UserAgent:  me.t.cl.config.HTTPUserAgent,
-		TrackerUrl: me.trackerUrl(ip),
-		Request:    req,
-		HostHeader: me.u.Host,
-		ServerName: me.u.Hostname(),
-		UdpNetwork: me.u.Scheme,
-		ClientIp4:  krpc.NodeAddr{IP: me.t.cl.config.PublicIp4},
-		ClientIp6:  krpc.NodeAddr{IP: me.t.cl.config.PublicIp6},
-	}.Do()
-	me.t.logger.WithDefaultLevel(log.Debug).Printf("announce to %q returned %#v: %v", me.u.String(), res, err)
-	if err != nil {
-		ret.Err = fmt.Errorf("announcing: %w", err)
-		return
+	// Announce over each family at once. The tracker sees the address we announce from, so each
+	// puts us in its peer list for that family.
+	type result struct {
+		res tracker.AnnounceResponse
+		err error
 	}
-	me.t.AddPeers(peerInfos(nil).AppendFromTracker(res.Peers))
-	ret.NumPeers = len(res.Peers)
-	ret.Interval = time.Duration(res.Interval) * time.Second
-	return
-}
-
-// Returns whether we can shorten the interval, and sets notify to a channel that receives when we
-// might change our mind, or leaves it if we won't.
-func (me *trackerScraper) canIgnoreInterval(notify *<-chan struct{}) bool {
-	gotInfo := me.t.GotInfo()
-	select {
-	case <-gotInfo:
-		// Private trackers really don't like us announcing more than they specify. They're also
-		// tracking us very carefully, so it's best to comply.
-		private := me.t.info.Private
-		return private == nil || !*private
-	default:
-		*notify = gotInfo
-		return false
-	}
-}
-
-func (me *trackerScraper) Run() {
+	results := make([]result, len(ips))
+	var wg sync.WaitGroup
+	for i, ip := range ips {
+		wg.Add(1)
+		go func(i int, ip net.IP) {
+			defer wg.Done()
+			me.t.logger.WithDefaultLevel(log.Debug).Printf("announcing to %q at %v: %#v", me.u.String(), ip, req)
+			announce := tracker.Announce{
+				Context:    ctx,
+				HTTPProxy:  me.t.cl.config.HTTPProxy,
+				HTTPClient: httpClient,
+				HTTPHeader: httpHeader,
 
-	defer me.announceStopped()
+				HTTPNoCompact:       params.NoCompact,
+				HTTPNoPeerId:        params.NoPeerId,
+				HTTPNoSupportCrypto: params.NoSupportCrypto,
 
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-	go func() {
-		defer cancel()
-		select {
-		case <-ctx.Done():
-		case <-me.t.Closed():
+				UserAgent:  me.t.cl.config.HTTPUserAgent,
+				TrackerUrl: me.u.String(),
+				Request:    req,
+				HostHeader: me.u.Host,
+				ServerName: me.u.Hostname(),
+				UdpNetwork: me.u.Scheme,
+				ClientIp4:  krpc.NodeAddr{IP: clientIp4},
+				ClientIp6:  krpc.NodeAddr{IP: clientIp6},
+			}
+			if ip != nil {
+				announce.TrackerUrl = me.trackerUrl(ip)
+				announce.UdpNetwork = trackerUdpNetwork(ip)
+				announce.LocalIp = me.t.cl.trackerLocalIp(ip)
+			}
+			res, err := announce.Do()
+			me.t.logger.WithDefaultLevel(log.Debug).Printf("announce to %q at %v returned %#v: %v", me.u.String(), ip, res, err)
+			results[i] = result{res, err}
+		}(i, ip)
+	}
+	wg.Wait()
+	// The announce works if any family does. Only the longest intervals are kept, so that no
+	// family is announced to more often than it asks.
+	ok := false
+	for _, r := range results {
+		if r.err != nil {
+			if ret.Err == nil {
+				ret.Err = fmt.Errorf("announcing: %w", r.err)
+			}
+			continue
 		}
-	}()
-
-	// make sure first announce is a "started"
-	e := tracker.Started
-
-	for {
-		ar := me.announce(ctx, e)
-		// after first announce, get back to regular "none"
-		e = tracker.None
-		me.t.cl.lock()
-		me.lastAnnounce = ar
-		me.t.cl.unlock()
-
-	recalculate:
-		// Make sure we don't announce for at least a minute since the last one.
-		interval := ar.Interval
-		if interval < time.Minute {
-			interval = time.Minute
+		res := r.res
+		me.t.AddPeers(peerInfos(nil).AppendFromTracker(res.Peers))
+		ret.NumPeers += len(res.Peers)
+		if res.ExternalIp != nil {
+			ret.ExternalIps = append(ret.ExternalIps, res.ExternalIp)
 		}
+		if res.WarningMessage != "" {
+			ret.WarningMessage = res.WarningMessage
+		}
+		interval := time.Duration(res.Interval) * time.Second
+		minInterval := time.Duration(res.MinInterval) * time.Second
+		if !ok || interval > ret.Interval {
+			ret.Interval = interval
+		}
+		if !ok || minInterval > ret.MinInterval {
+			ret.MinInterval = minInterval
+		}
+		ok = true
+	}
+	if ok {
+		ret.Err = nil
+	}
+	return
+}
 
-		me.t.cl.lock()
-		wantPeers := me.t.wantPeersEvent.C()
-		closed := me.t.closed.C()
-		me.t.cl.unlock()
-
-		// If we want peers, reduce the interval to the minimum if it's appropriate.
+// Announces, and records the result. The started event is sent if it hasn't been already.
+func (me *trackerScraper) announceAndRecord(ctx context.Context) {
+	me.t.cl.lock()
+	event := tracker.None
+	if !me.started {
+		event = tracker.Started
+	}
+	me.t.cl.unlock()
+	ar := me.announce(ctx, event, 0)
+	me.t.cl.lock()
+	defer me.t.cl.unlock()
+	me.recordAnnounce(event, ar)
+}
 
-		// A channel that receives when we should reconsider our interval. Starts as nil since that
-		// never receives.
-		var reconsider <-chan struct{}
-		select {
-		case <-wantPeers:
-			if interval > time.Minute && me.canIgnoreInterval(&reconsider) {
-				interval = time.Minute
-			}
-		default:
-			reconsider = wantPeers
+// Records the result of announcing the event. Call with the client lock held.
+func (me *trackerScraper) recordAnnounce(event tracker.AnnounceEvent, ar trackerAnnounceResult) {
+	prevReason := me.lastAnnounce.failureReason()
+	me.lastAnnounce = ar
+	if reason := ar.failureReason(); reason != "" && reason != prevReason {
+		for _, f := range me.t.cl.config.Callbacks.TrackerFailureReason {
+			f(TrackerFailureReasonEvent{
+				Torrent:    me.t,
+				TrackerUrl: me.u.String(),
+				Reason:     reason,
+			})
 		}
-
-		select {
-		case <-closed:
-			return
-		case <-reconsider:
-			// Recalculate the interval.
-			goto recalculate
-		case <-time.After(time.Until(ar.Completed.Add(interval))):
+	}
+	if ar.Err != nil {
+		me.backoff.failed(ar.Completed, ar.Err)
+		if me.backoff.disabled() {
+			me.t.logger.WithDefaultLevel(log.Warning).Printf(
+				"not announcing to %q again after %d failures: %v",
+				me.u.String(), me.backoff.consecutiveFailures, ar.Err)
 		}
+		return
+	}
+	me.backoff.succeeded()
+	me.started = event != tracker.Stopped
+	for _, ip := range ar.ExternalIps {
+		me.t.cl.reportPublicIp(me.u.String(), ip)
 	}
 }
 
+// Returns whether announces can be more frequent than trackers' intervals, when peers are wanted.
+// Call with the client lock held.
+func (t *Torrent) canIgnoreTrackerInterval() bool {
+	// Private trackers really don't like us announcing more than they specify. They're also
+	// tracking us very carefully, so it's best to comply. Until we have the info, we can't tell.
+	return t.haveInfo() && !t.info.IsPrivate()
+}
+
 func (me *trackerScraper) announceStopped() {
 	ctx, cancel := context.WithTimeout(context.Background(), tracker.DefaultTrackerAnnounceTimeout)
 	defer cancel()
-	me.announce(ctx, tracker.Stopped)
+	me.announce(ctx, tracker.Stopped, 0)
 }
@@ -0,0 +1,93 @@
+package torrent
+
+import (
+	"net"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/anacrolix/torrent/internal/testutil"
+	"github.com/anacrolix/torrent/tracker/server"
+)
+
+// Starts the tracker on loopback, returning its HTTP and UDP announce URLs.
+func startTestTracker(c *qt.C, s *server.Server) (httpUrl, udpUrl string) {
+	hs := httptest.NewServer(s)
+	c.Cleanup(hs.Close)
+	pc, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	c.Assert(err, qt.IsNil)
+	c.Cleanup(func() { pc.Close() })
+	go s.ServeUDP(pc)
+	return hs.URL + "/announce", "udp://" + pc.LocalAddr().String()
+}
+
+// A leecher finds the seeder through the tracker, and downloads from it.
+func TestTrackerServerSwarm(t *testing.T) {
+	c := qt.New(t)
+	for _, udp := range []bool{false, true} {
+		c.Run(map[bool]string{false: "http", true: "udp"}[udp], func(c *qt.C) {
+			var s server.Server
+			trackerUrl, udpUrl := startTestTracker(c, &s)
+			if udp {
+				trackerUrl = udpUrl
+			}
+			dir, mi := testutil.GreetingTestTorrent()
+			defer os.RemoveAll(dir)
+			mi.Announce = trackerUrl
+			ih := mi.HashInfoBytes()
+
+			cfg := TestingConfig(t)
+			cfg.DisableTrackers = false
+			cfg.DataDir = dir
+			cfg.Seed = true
+			seeder, err := NewClient(cfg)
+			c.Assert(err, qt.IsNil)
+			defer seeder.Close()
+			seederTorrent, err := seeder.AddTorrent(mi)
+			c.Assert(err, qt.IsNil)
+			seederTorrent.VerifyData()
+			waitTrackerPeers := func(n int32) {
+				deadline := time.Now().Add(10 * time.Second)
+				for {
+					stats := s.Scrape(ih)
+					if stats.Seeders+stats.Leechers == n {
+						return
+					}
+					if time.Now().After(deadline) {
+						c.Fatalf("tracker has %+v, waiting for %v peers", stats, n)
+					}
+					time.Sleep(10 * time.Millisecond)
+				}
+			}
+			waitTrackerPeers(1)
+
+			cfg = TestingConfig(t)
+			cfg.DisableTrackers = false
+			leecher, err := NewClient(cfg)
+			c.Assert(err, qt.IsNil)
+			defer leecher.Close()
+			// The tracker is added once pieces are wanted and have been checked, so the first
+			// announce asks for peers.
+			mi.Announce = ""
+			leecherTorrent, err := leecher.AddTorrent(mi)
+			c.Assert(err, qt.IsNil)
+			leecherTorrent.DownloadAll()
+			leecherTorrent.VerifyData()
+			leecherTorrent.AddTrackers([][]string{{trackerUrl}})
+			deadline := time.Now().Add(10 * time.Second)
+			for leecherTorrent.BytesMissing() != 0 {
+				if time.Now().After(deadline) {
+					c.Fatalf("leecher didn't download from the seeder: %+v", leecherTorrent.AnnounceStatus())
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+			waitTrackerPeers(2)
+			// The leecher leaves the swarm when it closes.
+			leecher.Close()
+			waitTrackerPeers(1)
+		})
+	}
+}
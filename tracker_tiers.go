@@ -0,0 +1,390 @@
+package torrent
+
+import (
+	"context"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Announces a torrent to its HTTP and UDP trackers as BEP 12 says. The trackers in a tier are tried
+// in order, and the first that works is moved to the front of its tier and used until it fails. The
+// next tier is only tried if every tracker in the tier fails. Websocket trackers keep their own
+// connections, and are announced to separately.
+type trackerTiers struct {
+	t *Torrent
+	// The trackers of the torrent's UpvertedAnnounceList, in the order they're to be tried. Guarded
+	// by the client lock.
+	tiers [][]*trackerTierEntry
+	// The tracker being announced to, if one is working. Guarded by the client lock.
+	active *trackerTierEntry
+	// Receives when the tiers change.
+	changed chan struct{}
+}
+
+// A tracker URL from the announce list. UDP trackers have a trackerScraper for each of IPv4 and IPv6
+// that are enabled, unless a family is only preferred, and are working if any is.
+type trackerTierEntry struct {
+	url      string
+	scrapers []*trackerScraper
+	// Whether the tracker was learned by tracker exchange, and isn't in the metainfo.
+	tex bool
+}
+
+func (me *trackerTierEntry) working() bool {
+	for _, ts := range me.scrapers {
+		if ts.working() {
+			return true
+		}
+	}
+	return false
+}
+
+// The earliest next announce of the entry's trackers. ok is false if they're all disabled.
+func (me *trackerTierEntry) nextAnnounce(wantPeers bool) (ret time.Time, ok bool) {
+	for _, ts := range me.scrapers {
+		if ts.backoff.disabled() {
+			continue
+		}
+		if next := ts.nextAnnounce(wantPeers); !ok || next.Before(ret) {
+			ret, ok = next, true
+		}
+	}
+	return
+}
+
+// Whether any of the entry's trackers can be announced to at the time.
+func (me *trackerTierEntry) canAnnounce(now time.Time, wantPeers bool) bool {
+	for _, ts := range me.scrapers {
+		if ts.canAnnounce(now, wantPeers) {
+			return true
+		}
+	}
+	return false
+}
+
+// Updates the tiers from the torrent's announce list, keeping the order that trackers have been
+// promoted to. Starts announcing if there are trackers and it hasn't already. Call with the client
+// lock held.
+func (t *Torrent) updateTrackerTiers() {
+	var oldTiers [][]*trackerTierEntry
+	if t.trackerTiers != nil {
+		oldTiers = t.trackerTiers.tiers
+	}
+	var tiers [][]*trackerTierEntry
+	haveScrapers := false
+	announceList := t.metainfo.UpvertedAnnounceList()
+	numMetainfoTiers := len(announceList)
+	if tex := t.texTrackersTier(); len(tex) != 0 {
+		announceList = append(announceList, tex)
+	}
+	for i, urls := range announceList {
+		var tier []*trackerTierEntry
+		have := make(map[string]bool)
+		if i < len(oldTiers) {
+			for _, e := range oldTiers[i] {
+				if containsString(urls, e.url) {
+					tier = append(tier, e)
+					have[e.url] = true
+				}
+			}
+		}
+		for _, _url := range urls {
+			if !have[_url] {
+				tier = append(tier, &trackerTierEntry{url: _url})
+			}
+		}
+		for _, e := range tier {
+			e.scrapers = t.trackerScrapersForUrl(e.url)
+			e.tex = i >= numMetainfoTiers
+			haveScrapers = haveScrapers || len(e.scrapers) != 0
+		}
+		tiers = append(tiers, tier)
+	}
+	if t.trackerTiers == nil {
+		if !haveScrapers {
+			return
+		}
+		t.trackerTiers = &trackerTiers{
+			t:       t,
+			changed: make(chan struct{}, 1),
+		}
+		go t.trackerTiers.Run()
+	}
+	me := t.trackerTiers
+	me.tiers = tiers
+	select {
+	case me.changed <- struct{}{}:
+	default:
+	}
+}
+
+// Returns the trackerScrapers that were started for the announce list URL.
+func (t *Torrent) trackerScrapersForUrl(_url string) (ret []*trackerScraper) {
+	add := func(_url string) {
+		if ts, ok := t.trackerAnnouncers[_url].(*trackerScraper); ok {
+			ret = append(ret, ts)
+		}
+	}
+	u, err := url.Parse(_url)
+	if err != nil {
+		return
+	}
+	add(_url)
+	if u.Scheme != "udp" {
+		return
+	}
+	for _, scheme := range []string{"udp4", "udp6"} {
+		u.Scheme = scheme
+		add(u.String())
+	}
+	return
+}
+
+func containsString(ss []string, s string) bool {
+	for _, have := range ss {
+		if have == s {
+			return true
+		}
+	}
+	return false
+}
+
+func (me *trackerTiers) Run() {
+	t := me.t
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		defer cancel()
+		select {
+		case <-ctx.Done():
+		case <-t.Closed():
+		}
+	}()
+	defer me.announceStopped()
+
+	for {
+		active := me.announceTiers(ctx)
+
+	recalculate:
+		t.cl.lock()
+		me.active = active
+		wantPeers := t.wantPeersEvent.C()
+		closed := t.closed.C()
+		gotInfo := t.gotMetainfo.C()
+		// A channel that receives when the intervals might shorten. Starts as nil since that never
+		// receives.
+		var reconsider <-chan struct{}
+		wanted := false
+		select {
+		case <-wantPeers:
+			wanted = true
+			if !t.haveInfo() {
+				reconsider = gotInfo
+			}
+		default:
+			reconsider = wantPeers
+		}
+		var next time.Time
+		var haveNext bool
+		if active != nil {
+			next, haveNext = active.nextAnnounce(wanted)
+		} else {
+			// Nothing works, so wait for the first tracker that can be tried again.
+			for _, tier := range me.tiers {
+				for _, e := range tier {
+					if en, ok := e.nextAnnounce(wanted); ok && (!haveNext || en.Before(next)) {
+						next, haveNext = en, true
+					}
+				}
+			}
+		}
+		t.cl.unlock()
+
+		var wake <-chan time.Time
+		var timer *time.Timer
+		if haveNext {
+			timer = time.NewTimer(time.Until(next))
+			wake = timer.C
+		}
+		stopTimer := func() {
+			if timer != nil {
+				timer.Stop()
+			}
+		}
+		select {
+		case <-closed:
+			stopTimer()
+			return
+		case <-me.changed:
+		case <-reconsider:
+			stopTimer()
+			goto recalculate
+		case <-wake:
+		}
+		stopTimer()
+	}
+}
+
+// Goes through the tiers, announcing to trackers that are due, until one works. Returns the working
+// tracker, if there is one.
+func (me *trackerTiers) announceTiers(ctx context.Context) *trackerTierEntry {
+	cl := me.t.cl
+	cl.lock()
+	wantPeers := me.t.wantPeers()
+	tiers := make([][]*trackerTierEntry, 0, len(me.tiers))
+	for _, tier := range me.tiers {
+		tiers = append(tiers, append([]*trackerTierEntry(nil), tier...))
+	}
+	cl.unlock()
+	for _, tier := range tiers {
+		for _, e := range tier {
+			cl.lock()
+			working := e.working()
+			due := e.canAnnounce(time.Now(), wantPeers)
+			cl.unlock()
+			if !due {
+				if working {
+					return e
+				}
+				continue
+			}
+			me.announceEntry(ctx, e)
+			if ctx.Err() != nil {
+				return nil
+			}
+			cl.lock()
+			working = e.working()
+			if working {
+				me.promote(e)
+			}
+			cl.unlock()
+			if working {
+				return e
+			}
+		}
+	}
+	return nil
+}
+
+// Announces to the entry's trackers that are due, concurrently.
+func (me *trackerTiers) announceEntry(ctx context.Context, e *trackerTierEntry) {
+	cl := me.t.cl
+	cl.lock()
+	wantPeers := me.t.wantPeers()
+	var due []*trackerScraper
+	now := time.Now()
+	for _, ts := range e.scrapers {
+		if ts.canAnnounce(now, wantPeers) {
+			due = append(due, ts)
+		}
+	}
+	cl.unlock()
+	var wg sync.WaitGroup
+	for _, ts := range due {
+		wg.Add(1)
+		go func(ts *trackerScraper) {
+			defer wg.Done()
+			ts.announceAndRecord(ctx)
+		}(ts)
+	}
+	wg.Wait()
+}
+
+// Moves the entry to the front of its tier. Call with the client lock held.
+func (me *trackerTiers) promote(e *trackerTierEntry) {
+	for _, tier := range me.tiers {
+		for i, have := range tier {
+			if have == e {
+				copy(tier[1:i+1], tier[:i])
+				tier[0] = e
+				return
+			}
+		}
+	}
+}
+
+// Tells the trackers that were sent the started event that the torrent has stopped.
+func (me *trackerTiers) announceStopped() {
+	me.t.cl.lock()
+	started := me.t.takeStartedTrackerScrapers()
+	me.t.cl.unlock()
+	var wg sync.WaitGroup
+	for _, ts := range started {
+		wg.Add(1)
+		go func(ts *trackerScraper) {
+			defer wg.Done()
+			ts.announceStopped()
+		}(ts)
+	}
+	wg.Wait()
+}
+
+// The announce state of one of a Torrent's trackers.
+type TrackerAnnounceStatus struct {
+	Url string
+	// The index of the tracker's tier in the announce list.
+	Tier int
+	// Whether this is the tracker being announced to. Others in its tier, and those in later tiers,
+	// aren't used while it's working.
+	Active bool
+	// Whether the tracker was learned from peers by tracker exchange, rather than being in the
+	// metainfo or added with AddTrackers. Those trackers are in the last tier.
+	Tex bool
+	// When the last announce completed. Zero if there hasn't been one.
+	LastAnnounce time.Time
+	// The error of the last announce, if it failed. It's kept if the tracker is disabled.
+	Err error
+	// The reason the tracker gave for the last announce failing, if it did. Sanitized, as are the
+	// other messages from trackers.
+	FailureReason string
+	// The tracker's warning about the last announce, that otherwise succeeded.
+	WarningMessage string
+	NumPeers       int
+	// From the last successful announce.
+	Interval    time.Duration
+	MinInterval time.Duration
+	// Announces that have failed since the last that succeeded.
+	ConsecutiveFailures int
+	// Whether the tracker won't be announced to again, having failed
+	// ClientConfig.TrackerMaxConsecutiveFailures times in a row.
+	Disabled bool
+	// The earliest the tracker will be announced to again. Zero if it hasn't been announced to.
+	// Failures back off exponentially, with some jitter.
+	NextAnnounce time.Time
+}
+
+// Returns the status of the torrent's HTTP and UDP trackers in the order they're tried: by tier,
+// and within a tier, working trackers having been moved to the front.
+func (t *Torrent) AnnounceStatus() (ret []TrackerAnnounceStatus) {
+	t.cl.rLock()
+	defer t.cl.rUnlock()
+	if t.trackerTiers == nil {
+		return
+	}
+	wantPeers := t.wantPeers()
+	for i, tier := range t.trackerTiers.tiers {
+		for _, e := range tier {
+			for _, ts := range e.scrapers {
+				ar := ts.lastAnnounce
+				ret = append(ret, TrackerAnnounceStatus{
+					Url:                 ts.u.String(),
+					Tier:                i,
+					Active:              e == t.trackerTiers.active,
+					Tex:                 e.tex,
+					LastAnnounce:        ar.Completed,
+					Err:                 ar.Err,
+					FailureReason:       ar.failureReason(),
+					WarningMessage:      ar.WarningMessage,
+					NumPeers:            ar.NumPeers,
+					Interval:            ar.Interval,
+					MinInterval:         ar.MinInterval,
+					ConsecutiveFailures: ts.backoff.consecutiveFailures,
+					Disabled:            ts.backoff.disabled(),
+					NextAnnounce:        ts.nextAnnounce(wantPeers),
+				})
+			}
+		}
+	}
+	return
+}
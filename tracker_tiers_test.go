@@ -0,0 +1,279 @@
+package torrent
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/frankban/quicktest"
+
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/internal/testutil"
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+// A tracker that fails, or counts announces and responds with no peers.
+func newCountingTracker(fail bool, announces *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fail {
+			http.Error(w, "down", http.StatusInternalServerError)
+			return
+		}
+		atomic.AddInt32(announces, 1)
+		w.Write(bencode.MustMarshal(map[string]interface{}{
+			"interval":     1800,
+			"min interval": 60,
+			"peers":        "",
+		}))
+	}))
+}
+
+// Returns the announce status once a tracker is active.
+func waitActiveTracker(c *quicktest.C, tt *Torrent) []TrackerAnnounceStatus {
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		status := tt.AnnounceStatus()
+		for _, s := range status {
+			if s.Active {
+				return status
+			}
+		}
+		if time.Now().After(deadline) {
+			c.Fatalf("no tracker became active: %+v", status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestTrackerTiersPromoteWorkingTracker(t *testing.T) {
+	c := quicktest.New(t)
+	var goodAnnounces, fallbackAnnounces int32
+	bad := newCountingTracker(true, nil)
+	defer bad.Close()
+	good := newCountingTracker(false, &goodAnnounces)
+	defer good.Close()
+	fallback := newCountingTracker(false, &fallbackAnnounces)
+	defer fallback.Close()
+
+	cfg := TestingConfig(t)
+	cfg.DisableTrackers = false
+	cl, err := NewClient(cfg)
+	c.Assert(err, quicktest.IsNil)
+	defer cl.Close()
+	mi := testutil.GreetingMetaInfo()
+	mi.AnnounceList = metainfo.AnnounceList{
+		{bad.URL + "/announce", good.URL + "/announce"},
+		{fallback.URL + "/announce"},
+	}
+	tt, err := cl.AddTorrent(mi)
+	c.Assert(err, quicktest.IsNil)
+	status := waitActiveTracker(c, tt)
+	c.Assert(status, quicktest.HasLen, 3)
+
+	// The working tracker is moved to the front of its tier.
+	c.Check(status[0].Url, quicktest.Equals, good.URL+"/announce")
+	c.Check(status[0].Tier, quicktest.Equals, 0)
+	c.Check(status[0].Active, quicktest.IsTrue)
+	c.Check(status[0].Err, quicktest.IsNil)
+	c.Check(status[0].Interval, quicktest.Equals, 30*time.Minute)
+	c.Check(status[0].MinInterval, quicktest.Equals, time.Minute)
+	c.Check(status[0].NextAnnounce.After(status[0].LastAnnounce), quicktest.IsTrue)
+
+	c.Check(status[1].Url, quicktest.Equals, bad.URL+"/announce")
+	c.Check(status[1].Active, quicktest.IsFalse)
+	c.Check(status[1].Err, quicktest.Not(quicktest.IsNil))
+	c.Check(status[1].ConsecutiveFailures, quicktest.Equals, 1)
+	c.Check(status[1].Disabled, quicktest.IsFalse)
+	c.Check(status[1].NextAnnounce.After(status[1].LastAnnounce.Add(47*time.Second)), quicktest.IsTrue)
+
+	// The next tier isn't used while a tracker in the first works.
+	c.Check(status[2].Tier, quicktest.Equals, 1)
+	c.Check(status[2].LastAnnounce.IsZero(), quicktest.IsTrue)
+	c.Check(atomic.LoadInt32(&goodAnnounces), quicktest.Equals, int32(1))
+	c.Check(atomic.LoadInt32(&fallbackAnnounces), quicktest.Equals, int32(0))
+}
+
+func TestTrackerTiersFallThrough(t *testing.T) {
+	c := quicktest.New(t)
+	var fallbackAnnounces int32
+	bad := newCountingTracker(true, nil)
+	defer bad.Close()
+	fallback := newCountingTracker(false, &fallbackAnnounces)
+	defer fallback.Close()
+
+	cfg := TestingConfig(t)
+	cfg.DisableTrackers = false
+	cfg.TrackerMaxConsecutiveFailures = 1
+	cl, err := NewClient(cfg)
+	c.Assert(err, quicktest.IsNil)
+	defer cl.Close()
+	mi := testutil.GreetingMetaInfo()
+	mi.AnnounceList = metainfo.AnnounceList{{bad.URL + "/announce"}, {fallback.URL + "/announce"}}
+	tt, err := cl.AddTorrent(mi)
+	c.Assert(err, quicktest.IsNil)
+	status := waitActiveTracker(c, tt)
+	c.Assert(status, quicktest.HasLen, 2)
+	c.Check(status[0].Active, quicktest.IsFalse)
+	c.Check(status[0].ConsecutiveFailures, quicktest.Equals, 1)
+	// The failure disabled the tracker, and its error is kept.
+	c.Check(status[0].Disabled, quicktest.IsTrue)
+	c.Check(status[0].Err, quicktest.Not(quicktest.IsNil))
+	c.Check(status[1].Url, quicktest.Equals, fallback.URL+"/announce")
+	c.Check(status[1].Active, quicktest.IsTrue)
+	c.Check(atomic.LoadInt32(&fallbackAnnounces), quicktest.Equals, int32(1))
+}
+
+func TestTrackerAnnounceKeyAndPeerId(t *testing.T) {
+	c := quicktest.New(t)
+	var mu sync.Mutex
+	var queries []url.Values
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		queries = append(queries, r.URL.Query())
+		mu.Unlock()
+		w.Write(bencode.MustMarshal(map[string]interface{}{
+			"interval": 1800,
+			"peers":    "",
+		}))
+	}))
+	defer s.Close()
+
+	cfg := TestingConfig(t)
+	cfg.DisableTrackers = false
+	cl, err := NewClient(cfg)
+	c.Assert(err, quicktest.IsNil)
+	defer cl.Close()
+	mi := testutil.GreetingMetaInfo()
+	mi.Announce = s.URL + "/announce"
+	spec := TorrentSpecFromMetaInfo(mi)
+	spec.AnnounceKey = 42
+	tt, _, err := cl.AddTorrentSpec(spec)
+	c.Assert(err, quicktest.IsNil)
+	c.Check(tt.AnnounceKey(), quicktest.Equals, int32(42))
+	c.Check(tt.PeerID(), quicktest.Equals, cl.PeerID())
+	waitActiveTracker(c, tt)
+	tt.Drop()
+	// The stopped event is sent with the same key and peer ID as the started.
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		mu.Lock()
+		n := len(queries)
+		mu.Unlock()
+		if n >= 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			c.Fatal("no stopped announce")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	c.Assert(queries, quicktest.HasLen, 2)
+	c.Check(queries[0].Get("event"), quicktest.Equals, "started")
+	c.Check(queries[1].Get("event"), quicktest.Equals, "stopped")
+	peerId := cl.PeerID()
+	for _, q := range queries {
+		c.Check(q.Get("key"), quicktest.Equals, "42")
+		c.Check(q.Get("peer_id"), quicktest.Equals, string(peerId[:]))
+	}
+
+	// Torrents are given their own random keys otherwise.
+	other, _ := cl.AddTorrentInfoHash(metainfo.Hash{1})
+	c.Check(other.AnnounceKey(), quicktest.Not(quicktest.Equals), int32(0))
+}
+
+func TestTrackerHTTPClientAndHeaderForURL(t *testing.T) {
+	c := quicktest.New(t)
+	var announces int32
+	s := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Cookie") != "passkey=secret" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		atomic.AddInt32(&announces, 1)
+		w.Write(bencode.MustMarshal(map[string]interface{}{
+			"interval": 1800,
+			"peers":    "",
+		}))
+	}))
+	defer s.Close()
+
+	cfg := TestingConfig(t)
+	cfg.DisableTrackers = false
+	cfg.TrackerHTTPClientForURL = func(u *url.URL) *http.Client {
+		if u.Host == s.Listener.Addr().String() {
+			return s.Client()
+		}
+		return nil
+	}
+	cfg.TrackerHTTPHeaderForURL = func(u *url.URL) http.Header {
+		return http.Header{"Cookie": {"passkey=secret"}}
+	}
+	cl, err := NewClient(cfg)
+	c.Assert(err, quicktest.IsNil)
+	defer cl.Close()
+	mi := testutil.GreetingMetaInfo()
+	mi.Announce = s.URL + "/announce"
+	tt, err := cl.AddTorrent(mi)
+	c.Assert(err, quicktest.IsNil)
+	status := waitActiveTracker(c, tt)
+	c.Check(status[0].Err, quicktest.IsNil)
+	c.Check(atomic.LoadInt32(&announces), quicktest.Equals, int32(1))
+}
+
+func TestTrackerFailureReasonAndWarning(t *testing.T) {
+	c := quicktest.New(t)
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(bencode.MustMarshal(map[string]interface{}{
+			"failure reason": "torrent not registered\x07",
+		}))
+	}))
+	defer failing.Close()
+	warning := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(bencode.MustMarshal(map[string]interface{}{
+			"interval":        1800,
+			"peers":           "",
+			"warning message": "ratio low",
+		}))
+	}))
+	defer warning.Close()
+
+	cfg := TestingConfig(t)
+	cfg.DisableTrackers = false
+	var mu sync.Mutex
+	var events []TrackerFailureReasonEvent
+	cfg.Callbacks.TrackerFailureReason = append(cfg.Callbacks.TrackerFailureReason, func(e TrackerFailureReasonEvent) {
+		mu.Lock()
+		events = append(events, e)
+		mu.Unlock()
+	})
+	cl, err := NewClient(cfg)
+	c.Assert(err, quicktest.IsNil)
+	defer cl.Close()
+	mi := testutil.GreetingMetaInfo()
+	failingUrl := failing.URL + "/announce"
+	mi.AnnounceList = metainfo.AnnounceList{{failingUrl}, {warning.URL + "/announce"}}
+	tt, err := cl.AddTorrent(mi)
+	c.Assert(err, quicktest.IsNil)
+	status := waitActiveTracker(c, tt)
+	c.Assert(status, quicktest.HasLen, 2)
+	c.Check(status[0].FailureReason, quicktest.Equals, "torrent not registered")
+	c.Check(status[0].WarningMessage, quicktest.Equals, "")
+	c.Check(status[1].FailureReason, quicktest.Equals, "")
+	c.Check(status[1].WarningMessage, quicktest.Equals, "ratio low")
+	// The same reason again isn't another event.
+	c.Check(tt.Announce(context.Background(), AnnounceOpts{Trackers: []string{failingUrl}})[0].Err,
+		quicktest.Not(quicktest.IsNil))
+	mu.Lock()
+	defer mu.Unlock()
+	c.Assert(events, quicktest.HasLen, 1)
+	c.Check(events[0].Torrent, quicktest.Equals, tt)
+	c.Check(events[0].TrackerUrl, quicktest.Equals, failingUrl)
+	c.Check(events[0].Reason, quicktest.Equals, "torrent not registered")
+}
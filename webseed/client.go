@@ -33,11 +33,24 @@ func (r Request) Cancel() {
 	r.cancel()
 }
 
+// How data is requested from a webseed.
+type Style int
+
+const (
+	// Files are fetched by path with range requests. BEP 19, from url-list.
+	StyleUrlList Style = iota
+	// Pieces are fetched by infohash and index. BEP 17, from httpseeds.
+	StyleHttpSeed
+)
+
 type Client struct {
 	HttpClient *http.Client
 	Url        string
 	FileIndex  segments.Index
 	Info       *metainfo.Info
+	Style      Style
+	// Required for StyleHttpSeed.
+	InfoHash metainfo.Hash
 }
 
 type RequestResult struct {
@@ -48,8 +61,7 @@ type RequestResult struct {
 func (ws *Client) NewRequest(r RequestSpec) Request {
 	ctx, cancel := context.WithCancel(context.Background())
 	var requestParts []requestPart
-	if !ws.FileIndex.Locate(r, func(i int, e segments.Extent) bool {
-		req, err := NewRequest(ws.Url, i, ws.Info, e.Start, e.Length)
+	addPart := func(req *http.Request, err error, e segments.Extent) {
 		if err != nil {
 			panic(err)
 		}
@@ -67,9 +79,34 @@ func (ws *Client) NewRequest(r RequestSpec) Request {
 			}
 		}()
 		requestParts = append(requestParts, part)
-		return true
-	}) {
-		panic("request out of file bounds")
+	}
+	switch ws.Style {
+	case StyleUrlList:
+		if !ws.FileIndex.Locate(r, func(i int, e segments.Extent) bool {
+			req, err := NewRequest(ws.Url, i, ws.Info, e.Start, e.Length)
+			addPart(req, err, e)
+			return true
+		}) {
+			panic("request out of file bounds")
+		}
+	case StyleHttpSeed:
+		if r.Start < 0 || r.End() > ws.Info.TotalLength() {
+			panic("request out of torrent bounds")
+		}
+		for off := r.Start; off < r.End(); {
+			piece := int(off / ws.Info.PieceLength)
+			begin := off - int64(piece)*ws.Info.PieceLength
+			length := ws.Info.PieceLength - begin
+			if rest := r.End() - off; rest < length {
+				length = rest
+			}
+			req, err := NewHttpSeedRequest(ws.Url, ws.InfoHash, ws.Info, piece, begin, length)
+			// The response holds only what was asked for.
+			addPart(req, err, segments.Extent{Start: 0, Length: length})
+			off += length
+		}
+	default:
+		panic(fmt.Sprintf("unknown webseed style %v", ws.Style))
 	}
 	req := Request{
 		cancel: cancel,
@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"net/url"
 	"path"
+	"strconv"
 	"strings"
 
 	"github.com/anacrolix/torrent/metainfo"
@@ -24,6 +25,10 @@ func trailingPath(infoName string, pathComps []string) string {
 // Creates a request per BEP 19.
 func NewRequest(url_ string, fileIndex int, info *metainfo.Info, offset, length int64) (*http.Request, error) {
 	fileInfo := info.UpvertedFiles()[fileIndex]
+	if info.IsDir() && !strings.HasSuffix(url_, "/") {
+		// The URL can only be for a directory holding the torrent's. libtorrent does the same.
+		url_ += "/"
+	}
 	if strings.HasSuffix(url_, "/") {
 		// BEP specifies that we append the file path. We need to escape each component of the path
 		// for things like spaces and '#'.
@@ -38,3 +43,21 @@ func NewRequest(url_ string, fileIndex int, info *metainfo.Info, offset, length
 	}
 	return req, nil
 }
+
+// Creates a request per BEP 17 for length bytes at begin in the piece. The range is left out when
+// it's the whole piece.
+func NewHttpSeedRequest(url_ string, infoHash metainfo.Hash, info *metainfo.Info, piece int, begin, length int64) (*http.Request, error) {
+	query := url.Values{
+		"info_hash": {infoHash.AsString()},
+		"piece":     {strconv.Itoa(piece)},
+	}
+	if begin != 0 || length != info.Piece(piece).Length() {
+		// Inclusive, as for HTTP ranges.
+		query.Set("ranges", fmt.Sprintf("%d-%d", begin, begin+length-1))
+	}
+	sep := "?"
+	if strings.Contains(url_, "?") {
+		sep = "&"
+	}
+	return http.NewRequest(http.MethodGet, url_+sep+query.Encode(), nil)
+}
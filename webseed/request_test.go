@@ -1,10 +1,17 @@
 package webseed
 
 import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"net/url"
+	"strconv"
+	"strings"
 	"testing"
 
 	qt "github.com/frankban/quicktest"
+
+	"github.com/anacrolix/torrent/metainfo"
 )
 
 func TestTrailingPath(t *testing.T) {
@@ -21,3 +28,78 @@ func TestTrailingPath(t *testing.T) {
 		"a_1-b_c2/d 3. (e, f).g",
 	)
 }
+
+func TestNewHttpSeedRequest(t *testing.T) {
+	c := qt.New(t)
+	info := metainfo.Info{PieceLength: 4, Length: 10}
+	ih := metainfo.Hash{0xff, 'a'}
+	req, err := NewHttpSeedRequest("http://example.com/seed", ih, &info, 1, 0, 4)
+	c.Assert(err, qt.IsNil)
+	c.Check(req.URL.String(), qt.Equals, "http://example.com/seed?info_hash=%FFa"+strings.Repeat("%00", 18)+"&piece=1")
+	req, err = NewHttpSeedRequest("http://example.com/seed?key=a", ih, &info, 2, 1, 1)
+	c.Assert(err, qt.IsNil)
+	c.Check(req.URL.Query(), qt.DeepEquals, url.Values{
+		"key":       {"a"},
+		"info_hash": {ih.AsString()},
+		"piece":     {"2"},
+		"ranges":    {"1-1"},
+	})
+}
+
+func TestClientHttpSeed(t *testing.T) {
+	c := qt.New(t)
+	data := []byte("0123456789")
+	info := metainfo.Info{PieceLength: 4, Length: int64(len(data))}
+	ih := metainfo.Hash{1}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("info_hash") != ih.AsString() {
+			http.NotFound(w, r)
+			return
+		}
+		piece, _ := strconv.Atoi(q.Get("piece"))
+		b := data[piece*4:]
+		if len(b) > 4 {
+			b = b[:4]
+		}
+		if ranges := q.Get("ranges"); ranges != "" {
+			var begin, end int
+			fmt.Sscanf(ranges, "%d-%d", &begin, &end)
+			b = b[begin : end+1]
+		}
+		w.Write(b)
+	}))
+	defer srv.Close()
+	ws := Client{
+		HttpClient: srv.Client(),
+		Url:        srv.URL,
+		Info:       &info,
+		Style:      StyleHttpSeed,
+		InfoHash:   ih,
+	}
+	for _, r := range []RequestSpec{{Start: 0, Length: 4}, {Start: 2, Length: 7}, {Start: 8, Length: 2}} {
+		result := <-ws.NewRequest(r).Result
+		c.Assert(result.Err, qt.IsNil)
+		c.Check(string(result.Bytes), qt.Equals, string(data[r.Start:r.End()]))
+	}
+}
+
+func TestNewRequestTrailingSlash(t *testing.T) {
+	c := qt.New(t)
+	multi := metainfo.Info{Name: "dir", Files: []metainfo.FileInfo{{Path: []string{"a b"}, Length: 1}}}
+	single := metainfo.Info{Name: "file", Length: 1}
+	for _, case_ := range []struct {
+		url      string
+		info     *metainfo.Info
+		expected string
+	}{
+		{"http://example.com/", &multi, "http://example.com/dir/a+b"},
+		{"http://example.com", &multi, "http://example.com/dir/a+b"},
+		{"http://example.com/", &single, "http://example.com/file"},
+		{"http://example.com/some.iso", &single, "http://example.com/some.iso"},
+	} {
+		req, err := NewRequest(case_.url, 0, case_.info, 0, 1)
+		c.Assert(err, qt.IsNil)
+		c.Check(req.URL.String(), qt.Equals, case_.expected)
+	}
+}
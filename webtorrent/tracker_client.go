@@ -34,8 +34,53 @@ type TrackerClient struct {
 	outboundOffers map[string]outboundOffer // OfferID to outboundOffer
 	wsConn         *websocket.Conn
 	closed         bool
+	closing        chan struct{}
 	stats          TrackerClientStats
 	pingTicker     *time.Ticker
+	// The torrents announced to the tracker, and not yet stopped. They share the socket, and are
+	// reannounced when it reconnects.
+	torrents map[[20]byte]*torrentAnnounce
+}
+
+// What the tracker has said about a torrent.
+type TorrentAnnounceStats struct {
+	// When the tracker last responded to an announce.
+	LastResponse time.Time
+	// How often the tracker wants the torrent announced. Zero if it hasn't said.
+	Interval time.Duration
+	// Seeders and leechers in the swarm, as reported by the tracker.
+	Complete, Incomplete int
+	// The last failure reason given by the tracker, if any.
+	FailureReason string
+}
+
+type torrentAnnounce struct {
+	// Whether an announce has been written, and so should be repeated if the socket reconnects.
+	written bool
+	stats   TorrentAnnounceStats
+	// Reannounces at the tracker's interval.
+	timer *time.Timer
+}
+
+// Announces aren't more frequent than this, whatever the tracker's interval.
+const minReannounceInterval = time.Minute
+
+// Variables for tests.
+var (
+	minReconnectBackoff = 10 * time.Second
+	maxReconnectBackoff = 5 * time.Minute
+)
+
+// How long to wait before reconnecting after the given number of failed attempts in a row.
+func reconnectBackoff(failures int) time.Duration {
+	d := minReconnectBackoff
+	for i := 0; i < failures && d < maxReconnectBackoff; i++ {
+		d *= 2
+	}
+	if d > maxReconnectBackoff {
+		d = maxReconnectBackoff
+	}
+	return d
 }
 
 func (me *TrackerClient) Stats() TrackerClientStats {
@@ -44,6 +89,25 @@ func (me *TrackerClient) Stats() TrackerClientStats {
 	return me.stats
 }
 
+// Returns what the tracker has said about the torrent, if it's being announced.
+func (me *TrackerClient) TorrentStats(infoHash [20]byte) (_ TorrentAnnounceStats, ok bool) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	ta, ok := me.torrents[infoHash]
+	if !ok {
+		return
+	}
+	return ta.stats, true
+}
+
+// Returns a channel that's closed by Close. Call with mu held.
+func (me *TrackerClient) closingChan() chan struct{} {
+	if me.closing == nil {
+		me.closing = make(chan struct{})
+	}
+	return me.closing
+}
+
 func (me *TrackerClient) peerIdBinary() string {
 	return binaryToJsonString(me.PeerId[:])
 }
@@ -104,10 +168,14 @@ func (tc *TrackerClient) doWebsocket() error {
 	return err
 }
 
+// Keeps a websocket to the tracker open until Close, reconnecting after failures with exponential
+// backoff.
 func (tc *TrackerClient) Run() error {
+	tc.mu.Lock()
 	tc.pingTicker = time.NewTicker(60 * time.Second)
 	tc.cond.L = &tc.mu
-	tc.mu.Lock()
+	closing := tc.closingChan()
+	failures := 0
 	for !tc.closed {
 		tc.mu.Unlock()
 		err := tc.doWebsocket()
@@ -116,9 +184,19 @@ func (tc *TrackerClient) Run() error {
 		if tc.closed {
 			level = log.Debug
 		}
+		if tc.wsConn != nil {
+			// The connection was made, so the next problem is a fresh one.
+			tc.wsConn = nil
+			failures = 0
+		}
+		backoff := reconnectBackoff(failures)
+		failures++
 		tc.mu.Unlock()
 		tc.Logger.WithDefaultLevel(level).Printf("websocket instance ended: %v", err)
-		time.Sleep(time.Minute)
+		select {
+		case <-time.After(backoff):
+		case <-closing:
+		}
 		tc.mu.Lock()
 	}
 	tc.mu.Unlock()
@@ -127,12 +205,24 @@ func (tc *TrackerClient) Run() error {
 
 func (tc *TrackerClient) Close() error {
 	tc.mu.Lock()
+	if tc.closed {
+		tc.mu.Unlock()
+		return nil
+	}
 	tc.closed = true
+	close(tc.closingChan())
 	if tc.wsConn != nil {
 		tc.wsConn.Close()
 	}
 	tc.closeUnusedOffers()
-	tc.pingTicker.Stop()
+	for _, ta := range tc.torrents {
+		if ta.timer != nil {
+			ta.timer.Stop()
+		}
+	}
+	if tc.pingTicker != nil {
+		tc.pingTicker.Stop()
+	}
 	tc.mu.Unlock()
 	tc.cond.Broadcast()
 	return nil
@@ -145,20 +235,28 @@ func (tc *TrackerClient) announceOffers() {
 	tc.mu.Lock()
 	offers := tc.outboundOffers
 	tc.outboundOffers = nil
-	tc.mu.Unlock()
-
-	if offers == nil {
-		return
+	var infoHashes [][20]byte
+	for ih, ta := range tc.torrents {
+		// Announces that haven't been written yet will be on the new socket.
+		if ta.written {
+			infoHashes = append(infoHashes, ih)
+		}
 	}
+	tc.mu.Unlock()
 
-	// Iterate over our locally-owned offers, close any existing "invalid" ones from before the
-	// socket reconnected, reannounce the infohash, adding it back into the tc.outboundOffers.
-	tc.Logger.WithDefaultLevel(log.Info).Printf("reannouncing %d infohashes after restart", len(offers))
+	// Close any existing "invalid" offers from before the socket reconnected.
 	for _, offer := range offers {
 		// TODO: Capture the errors? Are we even in a position to do anything with them?
 		offer.peerConnection.Close()
+	}
+	if len(infoHashes) == 0 {
+		return
+	}
+	// Reannounce the torrents on the new socket, which adds offers back into tc.outboundOffers.
+	tc.Logger.WithDefaultLevel(log.Info).Printf("reannouncing %d infohashes after restart", len(infoHashes))
+	for _, ih := range infoHashes {
 		// Use goroutine here to allow read loop to start and ensure the buffer drains.
-		go tc.Announce(tracker.Started, offer.infoHash)
+		go tc.Announce(tracker.Started, ih)
 	}
 }
 
@@ -169,7 +267,25 @@ func (tc *TrackerClient) closeUnusedOffers() {
 	tc.outboundOffers = nil
 }
 
+// Announces the torrent. The torrent is then reannounced at the tracker's interval, and when the
+// socket reconnects, until it's announced with the stopped event. The stopped event is only sent if
+// the socket is connected.
 func (tc *TrackerClient) Announce(event tracker.AnnounceEvent, infoHash [20]byte) error {
+	if event == tracker.Stopped {
+		return tc.announceStopped(infoHash)
+	}
+	tc.mu.Lock()
+	if tc.closed {
+		tc.mu.Unlock()
+		return fmt.Errorf("%T closed", tc)
+	}
+	if _, ok := tc.torrents[infoHash]; !ok {
+		if tc.torrents == nil {
+			tc.torrents = make(map[[20]byte]*torrentAnnounce)
+		}
+		tc.torrents[infoHash] = &torrentAnnounce{}
+	}
+	tc.mu.Unlock()
 	metrics.Add("outbound announces", 1)
 	var randOfferId [20]byte
 	_, err := rand.Read(randOfferId[:])
@@ -217,6 +333,9 @@ func (tc *TrackerClient) Announce(event tracker.AnnounceEvent, infoHash [20]byte
 		pc.Close()
 		return fmt.Errorf("write AnnounceRequest: %w", err)
 	}
+	if ta, ok := tc.torrents[infoHash]; ok {
+		ta.written = true
+	}
 	if tc.outboundOffers == nil {
 		tc.outboundOffers = make(map[string]outboundOffer)
 	}
@@ -229,7 +348,80 @@ func (tc *TrackerClient) Announce(event tracker.AnnounceEvent, infoHash [20]byte
 	return nil
 }
 
+func (tc *TrackerClient) announceStopped(infoHash [20]byte) error {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	ta, ok := tc.torrents[infoHash]
+	if !ok {
+		return nil
+	}
+	if ta.timer != nil {
+		ta.timer.Stop()
+	}
+	delete(tc.torrents, infoHash)
+	for id, offer := range tc.outboundOffers {
+		if offer.infoHash == infoHash {
+			offer.peerConnection.Close()
+			delete(tc.outboundOffers, id)
+		}
+	}
+	if tc.wsConn == nil {
+		return nil
+	}
+	// The torrent may be gone already, so there are no stats to include.
+	data, err := json.Marshal(AnnounceRequest{
+		Event:    tracker.Stopped.String(),
+		Action:   "announce",
+		InfoHash: binaryToJsonString(infoHash[:]),
+		PeerID:   tc.peerIdBinary(),
+	})
+	if err != nil {
+		return fmt.Errorf("marshalling request: %w", err)
+	}
+	return tc.writeMessage(data)
+}
+
+// Records the tracker's response to an announce of ours, and schedules the next at its interval.
+// Call with mu held.
+func (tc *TrackerClient) handleAnnounceResponse(ar AnnounceResponse, infoHash [20]byte) {
+	ta, ok := tc.torrents[infoHash]
+	if !ok {
+		return
+	}
+	ta.stats.LastResponse = time.Now()
+	ta.stats.FailureReason = ar.FailureReason
+	if ar.FailureReason != "" {
+		tc.Logger.WithDefaultLevel(log.Warning).Printf("tracker gave failure reason for %x: %q", infoHash, ar.FailureReason)
+	}
+	if ar.Complete != nil {
+		ta.stats.Complete = *ar.Complete
+	}
+	if ar.Incomplete != nil {
+		ta.stats.Incomplete = *ar.Incomplete
+	}
+	if ar.Interval == nil || *ar.Interval <= 0 {
+		return
+	}
+	ta.stats.Interval = time.Duration(*ar.Interval) * time.Second
+	next := ta.stats.Interval
+	if next < minReannounceInterval {
+		next = minReannounceInterval
+	}
+	if ta.timer != nil {
+		ta.timer.Stop()
+	}
+	ta.timer = time.AfterFunc(next, func() {
+		err := tc.Announce(tracker.None, infoHash)
+		if err != nil {
+			tc.Logger.WithDefaultLevel(log.Warning).Printf("error reannouncing %x: %v", infoHash, err)
+		}
+	})
+}
+
 func (tc *TrackerClient) writeMessage(data []byte) error {
+	if tc.cond.L == nil {
+		tc.cond.L = &tc.mu
+	}
 	for tc.wsConn == nil {
 		if tc.closed {
 			return fmt.Errorf("%T closed", tc)
@@ -262,6 +454,15 @@ func (tc *TrackerClient) trackerReadLoop(tracker *websocket.Conn) error {
 			tc.handleOffer(*ar.Offer, ar.OfferID, ih, ar.PeerID)
 		case ar.Answer != nil:
 			tc.handleAnswer(ar.OfferID, *ar.Answer)
+		default:
+			ih, err := jsonStringToInfoHash(ar.InfoHash)
+			if err != nil {
+				tc.Logger.WithDefaultLevel(log.Warning).Printf("error decoding info_hash in announce response: %v", err)
+				break
+			}
+			tc.mu.Lock()
+			tc.handleAnnounceResponse(ar, ih)
+			tc.mu.Unlock()
 		}
 	}
 }
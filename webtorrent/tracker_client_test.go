@@ -0,0 +1,152 @@
+package webtorrent
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/anacrolix/log"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/anacrolix/torrent/tracker"
+)
+
+func TestReconnectBackoff(t *testing.T) {
+	assert.Equal(t, 10*time.Second, reconnectBackoff(0))
+	assert.Equal(t, 20*time.Second, reconnectBackoff(1))
+	assert.Equal(t, 160*time.Second, reconnectBackoff(4))
+	assert.Equal(t, 5*time.Minute, reconnectBackoff(5))
+	assert.Equal(t, 5*time.Minute, reconnectBackoff(100))
+}
+
+func TestJsonStringToInfoHash(t *testing.T) {
+	ih := [20]byte{0xff, 1}
+	got, err := jsonStringToInfoHash(binaryToJsonString(ih[:]))
+	require.NoError(t, err)
+	assert.Equal(t, ih, got)
+	_, err = jsonStringToInfoHash(strings.Repeat("a", 21))
+	assert.Error(t, err)
+	_, err = jsonStringToInfoHash("Ā" + strings.Repeat("a", 19))
+	assert.Error(t, err)
+}
+
+// A tracker that records the announces on each connection, and responds with swarm counts. The
+// first connection is dropped after its first announce.
+type fakeTracker struct {
+	mu    sync.Mutex
+	conns [][]AnnounceRequest
+	got   chan struct{}
+}
+
+func (me *fakeTracker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer c.Close()
+	me.mu.Lock()
+	conn := len(me.conns)
+	me.conns = append(me.conns, nil)
+	me.mu.Unlock()
+	for {
+		var ar AnnounceRequest
+		if c.ReadJSON(&ar) != nil {
+			return
+		}
+		me.mu.Lock()
+		me.conns[conn] = append(me.conns[conn], ar)
+		me.mu.Unlock()
+		one, two := 1, 2
+		interval := 120
+		c.WriteJSON(AnnounceResponse{
+			Action:     "announce",
+			InfoHash:   ar.InfoHash,
+			Interval:   &interval,
+			Complete:   &one,
+			Incomplete: &two,
+		})
+		me.got <- struct{}{}
+		if conn == 0 {
+			return
+		}
+	}
+}
+
+func (me *fakeTracker) Conns() [][]AnnounceRequest {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	return append([][]AnnounceRequest(nil), me.conns...)
+}
+
+func (me *fakeTracker) wait(t *testing.T) {
+	select {
+	case <-me.got:
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for announce")
+	}
+}
+
+func TestTrackerClientReconnectsAndMultiplexes(t *testing.T) {
+	defer func(d time.Duration) { minReconnectBackoff = d }(minReconnectBackoff)
+	minReconnectBackoff = 10 * time.Millisecond
+	ft := &fakeTracker{got: make(chan struct{})}
+	srv := httptest.NewServer(ft)
+	defer srv.Close()
+	tc := &TrackerClient{
+		Url: "ws" + strings.TrimPrefix(srv.URL, "http"),
+		GetAnnounceRequest: func(event tracker.AnnounceEvent, infoHash [20]byte) (tracker.AnnounceRequest, error) {
+			return tracker.AnnounceRequest{Event: event, Left: 1}, nil
+		},
+		Logger: log.Default,
+	}
+	ran := make(chan struct{})
+	go func() {
+		defer close(ran)
+		tc.Run()
+	}()
+	defer func() {
+		tc.Close()
+		<-ran
+	}()
+
+	ih1, ih2 := [20]byte{1}, [20]byte{2}
+	require.NoError(t, tc.Announce(tracker.Started, ih1))
+	ft.wait(t)
+	// The first connection was dropped, so the torrent is reannounced on the next.
+	ft.wait(t)
+	require.NoError(t, tc.Announce(tracker.Started, ih2))
+	ft.wait(t)
+
+	conns := ft.Conns()
+	require.Len(t, conns, 2)
+	require.Len(t, conns[0], 1)
+	assert.Equal(t, binaryToJsonString(ih1[:]), conns[0][0].InfoHash)
+	require.Len(t, conns[1], 2)
+	assert.Equal(t, binaryToJsonString(ih1[:]), conns[1][0].InfoHash)
+	assert.Equal(t, "started", conns[1][0].Event)
+	assert.Equal(t, binaryToJsonString(ih2[:]), conns[1][1].InfoHash)
+	assert.Len(t, conns[1][1].Offers, 1)
+	assert.EqualValues(t, 2, tc.Stats().Dials)
+
+	// The response is handled after the tracker sends it.
+	require.Eventually(t, func() bool {
+		stats, _ := tc.TorrentStats(ih2)
+		return !stats.LastResponse.IsZero()
+	}, 10*time.Second, time.Millisecond)
+	stats, _ := tc.TorrentStats(ih2)
+	assert.Equal(t, 1, stats.Complete)
+	assert.Equal(t, 2, stats.Incomplete)
+	assert.Equal(t, 2*time.Minute, stats.Interval)
+
+	require.NoError(t, tc.Announce(tracker.Stopped, ih2))
+	ft.wait(t)
+	conns = ft.Conns()
+	assert.Equal(t, "stopped", conns[1][2].Event)
+	_, ok := tc.TorrentStats(ih2)
+	assert.False(t, ok)
+}
@@ -35,6 +35,8 @@ type AnnounceResponse struct {
 	Answer     *webrtc.SessionDescription `json:"answer,omitempty"`
 	Offer      *webrtc.SessionDescription `json:"offer,omitempty"`
 	OfferID    string                     `json:"offer_id,omitempty"`
+	// Sent instead of the rest when an announce fails.
+	FailureReason string `json:"failure reason,omitempty"`
 }
 
 // I wonder if this is a defacto standard way to decode bytes to JSON for webtorrent. I don't really
@@ -48,14 +50,12 @@ func binaryToJsonString(b []byte) string {
 }
 
 func jsonStringToInfoHash(s string) (ih [20]byte, err error) {
-	defer func() {
-		r := recover()
-		if r == nil {
-			return
-		}
-		panic(fmt.Sprintf("%q", s))
-	}()
-	for i, c := range []rune(s) {
+	runes := []rune(s)
+	if len(runes) != len(ih) {
+		err = fmt.Errorf("bad infohash string length %v: %q", len(runes), s)
+		return
+	}
+	for i, c := range runes {
 		if c < 0 || c > math.MaxUint8 {
 			err = fmt.Errorf("bad infohash string: %v", s)
 			return
@@ -13,12 +13,14 @@ import (
 )
 
 type websocketTrackerStatus struct {
-	url url.URL
-	tc  *webtorrent.TrackerClient
+	url      url.URL
+	tc       *webtorrent.TrackerClient
+	infoHash [20]byte
 }
 
 func (me websocketTrackerStatus) statusLine() string {
-	return fmt.Sprintf("%+v", me.tc.Stats())
+	ts, _ := me.tc.TorrentStats(me.infoHash)
+	return fmt.Sprintf("%+v, torrent: %+v", me.tc.Stats(), ts)
 }
 
 func (me websocketTrackerStatus) URL() *url.URL {